@@ -9,20 +9,85 @@ This part of the service runs on the client or the app.
 */
 
 import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math/rand"
 	"time"
 
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/kyber.v2/util/key"
 	"gopkg.in/dedis/onet.v2"
 	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/network"
 )
 
 // ServiceName is used for registration on the onet.
 const ServiceName = "Decenarch"
 const StatTimeFormat = "2006/01/02 15:04:05.0000"
 
+// Threshold returns the number of conodes of a roster of n conodes needed for
+// the DKG and the collective signatures
+func Threshold(n int) int {
+	return n - (n-1)/3
+}
+
 // Client is a structure to communicate with the Decenarch
 // service
 type Client struct {
 	*onet.Client
+	// KeyPair is used to sign the save requests, it can be nil if the
+	// cothority accepts save requests from anyone
+	KeyPair *key.Pair
+	// Engine is the consensus engine used by the conodes for the saves,
+	// empty for the default engine
+	Engine string
+	// FalsePositiveRate is the target false positive rate of the Bloom
+	// filters sent with the setup and save requests, 0 for the default
+	FalsePositiveRate float64
+	// BlockInterval is the minimal number of seconds between two blocks
+	// sent with the setup request, 0 for the default
+	BlockInterval int64
+	// ForceSetup makes the setup run the DKG again on conodes already set
+	// up, signed with the KeyPair of an authorized client if the archive has any
+	ForceSetup bool
+	// Scheme is the signature scheme sent with the setup request, empty for
+	// SchemeCosi
+	Scheme string
+	// Sync makes the saves return only once the pages are stored in a
+	// block of the skipchain
+	Sync bool
+	// IncludeProof makes the saves return the transcript of the consensus
+	IncludeProof bool
+	// IncludeChainProof makes the retrievals return the inclusion proof of
+	// the skipblock storing the page
+	IncludeChainProof bool
+	// Render makes the conodes save the page rendered by their browser
+	Render bool
+	// Template is the request replayed by the conodes to fetch the pages,
+	// nil for GET requests, see RequestTemplate
+	Template *RequestTemplate
+	// Sign tunes the signing protocols of the saves, nil for the options of
+	// the conodes, see SignOptions
+	Sign *SignOptions
+	// Namespace is the archive set up, saved to and retrieved from, empty
+	// for the default archive, see namespace.go
+	Namespace string
+	// Force makes the conodes archive the pages again even if they did not
+	// change since their last snapshot
+	Force bool
+	// Extractor is the leaf extractor of the saves, empty for the text of
+	// the pages, see SaveRequest
+	Extractor string
+	// Headers override the headers of the fetches of the saves, and
+	// SetupHeaders are the headers agreed by the setup, see headers.go
+	Headers      map[string]string
+	SetupHeaders map[string]string
+	// Diagnostics asks the conodes why leaves were dropped from the
+	// consensus pages, see DivergenceSummary
+	Diagnostics bool
 }
 
 // NewClient instantiates a new decenarch.Client
@@ -30,11 +95,38 @@ func NewClient() *Client {
 	return &Client{Client: onet.NewClient(Suite, ServiceName)}
 }
 
-// Setup will setup everything is needed for DecenArch
-func (c *Client) Setup(r *onet.Roster) (*SetupResponse, error) {
+// NewSignedClient instantiates a new decenarch.Client signing its save
+// requests with the given key pair
+func NewSignedClient(kp *key.Pair) *Client {
+	return &Client{Client: onet.NewClient(Suite, ServiceName), KeyPair: kp}
+}
+
+// Setup will setup everything is needed for DecenArch. Only the clients
+// whose public key is in authorized will be allowed to save web pages, if no
+// key is given anyone can save web pages
+func (c *Client) Setup(r *onet.Roster, authorized ...kyber.Point) (*SetupResponse, error) {
+	return c.SetupCtx(context.Background(), r, authorized...)
+}
+
+// SetupCtx is Setup, returning the error of ctx if ctx is done before the
+// conode answers. The setup cannot be canceled and goes on on the conodes.
+// The request is signed with the key pair of the client, if any, as needed to
+// force the setup or to set up a new namespace.
+func (c *Client) SetupCtx(ctx context.Context, r *onet.Roster, authorized ...kyber.Point) (*SetupResponse, error) {
 	dst := r.RandomServerIdentity()
+	req := &SetupRequest{Roster: r, AuthorizedKeys: authorized, FalsePositiveRate: c.FalsePositiveRate, BlockInterval: c.BlockInterval, Force: c.ForceSetup, Scheme: c.Scheme, Namespace: c.Namespace, FetchHeaders: c.SetupHeaders, Timestamp: time.Now().Unix()}
+	if c.KeyPair != nil {
+		sig, err := schnorr.Sign(Suite, c.KeyPair.Private, req.Message())
+		if err != nil {
+			return nil, err
+		}
+		req.PublicKey = c.KeyPair.Public
+		req.Signature = sig
+	}
 	resp := &SetupResponse{}
-	err := c.SendProtobuf(dst, &SetupRequest{Roster: r}, resp)
+	err := withContext(ctx, func(cl *onet.Client) error {
+		return sendWith(cl, dst, req, resp)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -42,35 +134,381 @@ func (c *Client) Setup(r *onet.Roster) (*SetupResponse, error) {
 	return resp, nil
 }
 
+// GetSetupInfo returns how the archive of the namespace of the client was set
+// up on the conode dst
+func (c *Client) GetSetupInfo(dst *network.ServerIdentity) (*SetupInfoResponse, error) {
+	resp := &SetupInfoResponse{}
+	err := c.send(dst, &SetupInfoRequest{Namespace: c.Namespace}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// GetPublicKey returns the collective key of the conode dst for the archive
+// of the namespace of the client
+func (c *Client) GetPublicKey(dst *network.ServerIdentity) (*PublicKeyResponse, error) {
+	resp := &PublicKeyResponse{}
+	err := c.send(dst, &PublicKeyRequest{Namespace: c.Namespace}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
 // Save will record the website requested in the conodes
 func (c *Client) Save(r *onet.Roster, url string) (*SaveResponse, error) {
+	return c.save(c.Client, r.RandomServerIdentity(), r, url, "")
+}
+
+// SaveCtx is Save, stopped when ctx is done. The conode leading the save is
+// then asked to cancel it, see Cancel, and the error of ctx is returned.
+func (c *Client) SaveCtx(ctx context.Context, r *onet.Roster, url string) (*SaveResponse, error) {
 	dst := r.RandomServerIdentity()
+	session, err := NewSession()
+	if err != nil {
+		return nil, err
+	}
+	var resp *SaveResponse
+	err = withContext(ctx, func(cl *onet.Client) error {
+		var err error
+		resp, err = c.save(cl, dst, r, url, session)
+		return err
+	})
+	if ctxErr := ctx.Err(); ctxErr != nil && err == ctxErr {
+		if _, cancelErr := c.Cancel(dst, session); cancelErr != nil {
+			log.Lvl2("Could not cancel the save on", dst.Address, ":", cancelErr)
+		}
+		return nil, err
+	}
+	return resp, err
+}
+
+// Cancel asks the conode dst to stop the save of the given session, see
+// CancelRequest. It returns false if no save of the session runs on dst,
+// e.g. if it already ended.
+func (c *Client) Cancel(dst *network.ServerIdentity, session string) (bool, error) {
+	// the connection of the client may be busy with the save
+	resp := &CancelResponse{}
+	err := DecodeError(onet.NewClient(Suite, ServiceName).SendProtobuf(dst, &CancelRequest{Session: session}, resp))
+	if err != nil {
+		return false, err
+	}
+	return resp.Canceled, nil
+}
+
+// NewSession returns a random identifier of a save, see SaveRequest
+func NewSession() (string, error) {
+	b := make([]byte, 16)
+	if _, err := cryptorand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// withContext returns the error of f, or the error of ctx if ctx is done
+// before f returns. f sends its requests with the onet client cl, dedicated to
+// the call, whose connections are closed once ctx is done, so that f returns
+// in the background and its result is dropped.
+func withContext(ctx context.Context, f func(cl *onet.Client) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cl := onet.NewClient(Suite, ServiceName)
+	defer func() {
+		if err := cl.Close(); err != nil {
+			log.Lvl3("Could not close the connections:", err)
+		}
+	}()
+	done := make(chan error, 1)
+	go func() {
+		done <- f(cl)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// save sends the save request of url to the conode dst with the onet client
+// cl, with the session given by the caller
+func (c *Client) save(cl *onet.Client, dst *network.ServerIdentity, r *onet.Roster, url, session string) (*SaveResponse, error) {
 	log.Lvl4("Sending message to", dst)
 	resp := &SaveResponse{Times: make([]string, 0)}
 	resp.Times = append(resp.Times, "genstart;"+time.Now().Format(StatTimeFormat))
-	err := c.SendProtobuf(dst, &SaveRequest{url, r}, resp)
+	req := &SaveRequest{
+		Url:               url,
+		Roster:            r,
+		Timestamp:         time.Now().Unix(),
+		Engine:            c.Engine,
+		FalsePositiveRate: c.FalsePositiveRate,
+		Sync:              c.Sync,
+		IncludeProof:      c.IncludeProof,
+		Render:            c.Render,
+		Template:          c.Template,
+		Sign:              c.Sign,
+		Namespace:         c.Namespace,
+		Force:             c.Force,
+		Extractor:         c.Extractor,
+		Headers:           c.Headers,
+		Diagnostics:       c.Diagnostics,
+		Session:           session,
+	}
+	if c.KeyPair != nil {
+		sig, err := schnorr.Sign(Suite, c.KeyPair.Private, req.Message())
+		if err != nil {
+			return nil, err
+		}
+		req.PublicKey = c.KeyPair.Public
+		req.Signature = sig
+	}
+	err := sendWith(cl, dst, req, resp)
 	if err != nil {
 		return nil, err
 	}
 	return resp, nil
 }
 
+// send sends the request to dst and decodes the typed errors of the service,
+// see DecodeError
+func (c *Client) send(dst *network.ServerIdentity, req, resp interface{}) error {
+	return sendWith(c.Client, dst, req, resp)
+}
+
+// sendWith is send with the onet client cl, see withContext
+func sendWith(cl *onet.Client, dst *network.ServerIdentity, req, resp interface{}) error {
+	return DecodeError(cl.SendProtobuf(dst, req, resp))
+}
+
 // Retrieve will send the website requested to the client
 func (c *Client) Retrieve(r *onet.Roster, url string, timestamp string) (*RetrieveResponse, error) {
+	return c.RetrieveCtx(context.Background(), r, url, timestamp)
+}
+
+// RetrieveCtx is Retrieve, returning the error of ctx if ctx is done before a
+// conode returns the page. No other conode is asked once ctx is done.
+func (c *Client) RetrieveCtx(ctx context.Context, r *onet.Roster, url string, timestamp string) (*RetrieveResponse, error) {
 	// if no timestamp is given, take 'now as timestamp'
 	if timestamp == "" {
 		t := time.Now()
 		timestamp = t.Format("2006/01/02 15:04")
 	}
-	resp := &RetrieveResponse{}
+	// the conodes are asked in a random order until one of them returns
+	// the page, so that a page can be retrieved while some are offline
+	err := errors.New("empty roster")
+	for _, i := range rand.Perm(len(r.List)) {
+		resp := &RetrieveResponse{}
+		dst := r.List[i]
+		err = withContext(ctx, func(cl *onet.Client) error {
+			return sendWith(
+				cl,
+				dst,
+				&RetrieveRequest{Roster: r, Url: url, Timestamp: timestamp, IncludeChainProof: c.IncludeChainProof, Namespace: c.Namespace},
+				resp)
+		})
+		if ctxErr := ctx.Err(); ctxErr != nil && err == ctxErr {
+			return nil, err
+		}
+		if err == nil {
+			log.Lvl2("Page", resp.Main.Url, "sucessfully retrieved!")
+			return resp, nil
+		}
+		log.Lvl2("Conode", dst.Address, "could not retrieve the page:", err)
+	}
+	return nil, err
+}
+
+// Flush asks every conode of the roster to store the pages saved since its
+// last block, and returns the number of pages stored
+func (c *Client) Flush(r *onet.Roster) (int, error) {
+	pages := 0
+	for _, dst := range r.List {
+		resp := &FlushResponse{}
+		if err := c.send(dst, &FlushRequest{}, resp); err != nil {
+			return pages, err
+		}
+		pages += resp.Pages
+	}
+	return pages, nil
+}
+
+// Prune asks the conodes to move the content of the pages stored before the
+// given time out of their hot storage tier, and returns the number of conodes
+// the approved pruning was propagated to. The request is sent to the conode
+// dst of the roster, signed with its private key.
+func (c *Client) Prune(dst *network.ServerIdentity, private kyber.Scalar, r *onet.Roster, before time.Time) (int, error) {
+	req := &PruneRequest{Roster: r, Before: before.Unix(), Namespace: c.Namespace, Timestamp: time.Now().Unix()}
+	sig, err := schnorr.Sign(Suite, private, req.RequestMessage())
+	if err != nil {
+		return 0, err
+	}
+	req.Signature = sig
+	resp := &PruneResponse{}
+	if err := c.send(dst, req, resp); err != nil {
+		return 0, err
+	}
+	return resp.Conodes, nil
+}
+
+// Content returns the content of the page whose content hash is hash, stored
+// in the storage tiers of the conode dst
+func (c *Client) Content(dst *network.ServerIdentity, hash string) ([]byte, error) {
+	resp := &ContentResponse{}
+	if err := c.send(dst, &ContentRequest{Hash: hash}, resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// Import asks the conode dst to store the exported block in the skipchain of
+// its roster and returns the ID of the new block. The request is signed with
+// the key pair of the client, which must be an authorized client of the
+// archive or the key pair of dst.
+func (c *Client) Import(dst *network.ServerIdentity, block *Block) ([]byte, error) {
+	if c.KeyPair == nil {
+		return nil, errors.New("import requests must be signed, use NewSignedClient")
+	}
+	req := &ImportRequest{Block: *block, Timestamp: time.Now().Unix(), PublicKey: c.KeyPair.Public, Namespace: c.Namespace}
+	sig, err := schnorr.Sign(Suite, c.KeyPair.Private, req.Message())
+	if err != nil {
+		return nil, err
+	}
+	req.Signature = sig
+	resp := &ImportResponse{}
+	if err := c.send(dst, req, resp); err != nil {
+		return nil, err
+	}
+	return resp.BlockID, nil
+}
+
+// Mirror asks the conode dst to mirror, with the roster r, the archive whose
+// genesis block is originID in the archive of the namespace of the client.
+// The request is signed with the private key of the conode. It returns the
+// number of blocks mirrored.
+func (c *Client) Mirror(dst *network.ServerIdentity, private kyber.Scalar, r, origin *onet.Roster, originID []byte) (int, error) {
+	req := &MirrorRequest{Roster: r, Origin: origin, OriginID: originID, Timestamp: time.Now().Unix(), Namespace: c.Namespace}
+	sig, err := schnorr.Sign(Suite, private, req.Message())
+	if err != nil {
+		return 0, err
+	}
+	req.Signature = sig
+	resp := &MirrorResponse{}
+	if err := c.send(dst, req, resp); err != nil {
+		return 0, err
+	}
+	return resp.Blocks, nil
+}
+
+// Subscribe registers a webhook on the conode dst, which posts the events of
+// the given types to url, all of them if no type is given. The request is
+// signed with the key pair of the client, if any. It returns the ID of the
+// subscription.
+func (c *Client) Subscribe(dst *network.ServerIdentity, url string, events ...string) (string, error) {
+	req := &SubscribeRequest{Url: url, Events: events, Timestamp: time.Now().Unix()}
+	if c.KeyPair != nil {
+		sig, err := schnorr.Sign(Suite, c.KeyPair.Private, req.Message())
+		if err != nil {
+			return "", err
+		}
+		req.PublicKey = c.KeyPair.Public
+		req.Signature = sig
+	}
+	resp := &SubscribeResponse{}
+	if err := c.send(dst, req, resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// Unsubscribe removes the subscription of the given ID from the conode dst
+func (c *Client) Unsubscribe(dst *network.ServerIdentity, id string) error {
+	return c.send(dst, &UnsubscribeRequest{ID: id}, &UnsubscribeResponse{})
+}
+
+// WatchFeed asks the conode dst to save the pages linked by the new entries
+// of the feed at url, polled every interval. A zero interval means the default
+// interval of the conode. It returns the feeds watched by the conode. The
+// client must be signed, its key owns the feed.
+func (c *Client) WatchFeed(dst *network.ServerIdentity, url string, interval time.Duration) ([]FeedStatus, error) {
+	return c.watchFeed(dst, &WatchFeedRequest{Url: url, Interval: int64(interval / time.Second)})
+}
+
+// UnwatchFeed asks the conode dst to stop watching the feed at url. It
+// returns the feeds still watched by the conode.
+func (c *Client) UnwatchFeed(dst *network.ServerIdentity, url string) ([]FeedStatus, error) {
+	return c.watchFeed(dst, &WatchFeedRequest{Url: url, Remove: true})
+}
+
+// Feeds returns the feeds watched by the conode dst
+func (c *Client) Feeds(dst *network.ServerIdentity) ([]FeedStatus, error) {
+	return c.watchFeed(dst, &WatchFeedRequest{})
+}
+
+// watchFeed sends the feed request to dst, signed with the key pair of the
+// client if it changes a feed
+func (c *Client) watchFeed(dst *network.ServerIdentity, req *WatchFeedRequest) ([]FeedStatus, error) {
+	if req.Url != "" {
+		if c.KeyPair == nil {
+			return nil, errors.New("feed requests must be signed, see NewSignedClient")
+		}
+		req.Timestamp = time.Now().Unix()
+		sig, err := schnorr.Sign(Suite, c.KeyPair.Private, req.Message())
+		if err != nil {
+			return nil, err
+		}
+		req.PublicKey = c.KeyPair.Public
+		req.Signature = sig
+	}
+	resp := &WatchFeedResponse{}
+	if err := c.send(dst, req, resp); err != nil {
+		return nil, err
+	}
+	return resp.Feeds, nil
+}
+
+// Stats asks the conode dst how often the page of url changes, from its
+// observations in the archive of the namespace of the client
+func (c *Client) Stats(dst *network.ServerIdentity, url string) (*ChangeStats, error) {
+	resp := &StatsResponse{}
+	if err := c.send(dst, &StatsRequest{Url: url, Namespace: c.Namespace}, resp); err != nil {
+		return nil, err
+	}
+	return &resp.Stats, nil
+}
+
+// Status returns the status of a random conode of the roster and of the other
+// conodes of its setup, as seen by this conode
+func (c *Client) Status(r *onet.Roster) (*StatusResponse, error) {
 	dst := r.RandomServerIdentity()
-	err := c.SendProtobuf(
-		dst,
-		&RetrieveRequest{Roster: r, Url: url, Timestamp: timestamp},
-		resp)
+	resp := &StatusResponse{}
+	err := c.send(dst, &StatusRequest{Roster: r}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Admin sends an admin command to the conode dst. The request is signed with
+// private, which must be the private key of the conode
+func (c *Client) Admin(dst *network.ServerIdentity, private kyber.Scalar, command string) (*AdminResponse, error) {
+	return c.AdminWithArgument(dst, private, command, nil)
+}
+
+// AdminWithArgument sends the admin command with its argument to dst, signed
+// with the private key of the conode
+func (c *Client) AdminWithArgument(dst *network.ServerIdentity, private kyber.Scalar, command string, argument []byte) (*AdminResponse, error) {
+	req := &AdminRequest{Command: command, Timestamp: time.Now().Unix(), Argument: argument}
+	sig, err := schnorr.Sign(Suite, private, req.Message())
+	if err != nil {
+		return nil, err
+	}
+	req.Signature = sig
+	resp := &AdminResponse{}
+	err = c.send(dst, req, resp)
 	if err != nil {
 		return nil, err
 	}
-	log.Info("Page", resp.Main.Url, "sucessfully retrieved!")
 	return resp, nil
 }
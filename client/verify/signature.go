@@ -0,0 +1,269 @@
+package verify
+
+/*
+The signature.go defines the signatures of the archive, checked by the
+verifier. The signing side is in the package lib, which checks the signatures
+with the functions of this file, so that a page valid for the conodes is valid
+for the verifier.
+*/
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/group/edwards25519"
+	"gopkg.in/dedis/kyber.v2/pairing/bn256"
+	"gopkg.in/dedis/kyber.v2/sign/bls"
+	"gopkg.in/dedis/kyber.v2/sign/cosi"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/kyber.v2/util/encoding"
+)
+
+// Signature schemes of the archive, see decenarch.SetupRequest
+const (
+	SchemeCosi = "ftcosi"
+	SchemeBLS  = "bls"
+)
+
+// cosiSuite is the group of the keys of the conodes, whose hash is SHA-512
+// as in the collective signatures of ftcosi, which are EdDSA compatible
+type cosiSuite struct {
+	*edwards25519.SuiteEd25519
+}
+
+// Hash implements kyber.HashFactory
+func (cosiSuite) Hash() hash.Hash {
+	return sha512.New()
+}
+
+var (
+	// Suite is the group of the keys of the conodes, see decenarch.Suite
+	Suite = edwards25519.NewBlakeSHA256Ed25519()
+	// CosiSuite is the suite of the collective signatures, see
+	// decenarch.CosiSuite
+	CosiSuite cosi.Suite = cosiSuite{Suite}
+	// BLSSuite is the suite of the BLS signatures, see decenarch.BLSSuite
+	BLSSuite = bn256.NewSuite()
+	// blsKeySuite is the suite of the group of the BLS keys, for the masks
+	// of the signers
+	blsKeySuite = bn256.NewSuiteG2()
+)
+
+// SignerKey is the BLS key of a conode, see SchemeBLS
+//    - Conode is the public key of the conode in the roster, hex encoded
+//    - Public is the marshaled BLS public key, on the group G2 of BLSSuite
+//    - Possession is the BLS signature of PossessionMessage(Public), which
+//      proves that the conode knows the private key, against the rogue key
+//      attacks on the aggregated keys
+//    - Endorsement is the Schnorr signature of EndorsementMessage(Public) by
+//      the conode
+type SignerKey struct {
+	Conode      string
+	Public      []byte
+	Possession  []byte
+	Endorsement []byte
+}
+
+// PossessionMessage returns the bytes signed with the BLS key public to prove
+// the possession of its private key
+func PossessionMessage(public []byte) []byte {
+	return append([]byte("bls-possession"), public...)
+}
+
+// EndorsementMessage returns the bytes signed by a conode to endorse the BLS
+// key public
+func EndorsementMessage(public []byte) []byte {
+	return append([]byte("bls-endorsement"), public...)
+}
+
+// TimestampMessage returns the bytes collectively signed to endorse that the
+// page of content hash pageHash was captured at the given unix time
+func TimestampMessage(pageHash string, captured int64) []byte {
+	msg := []byte("timestamp")
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(captured))
+	return append(append(msg, b...), []byte(pageHash)...)
+}
+
+// ContentHash returns the hexadecimal sha256 hash of data, used as address of
+// the content in the storage tiers and to match the additional resources of
+// a page
+func ContentHash(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// SignerMask returns the mask of the conodes of publics that took part in the
+// collective signature, stored after the signature itself
+func SignerMask(publics []kyber.Point, sig []byte) (*cosi.Mask, error) {
+	mask, err := cosi.NewMask(CosiSuite, publics, nil)
+	if err != nil {
+		return nil, err
+	}
+	lenSig := CosiSuite.PointLen() + CosiSuite.ScalarLen()
+	if len(sig) != lenSig+mask.Len() {
+		return nil, fmt.Errorf("signature does not match a roster of %d conodes", len(publics))
+	}
+	if err := mask.SetMask(sig[lenSig:]); err != nil {
+		return nil, err
+	}
+	return mask, nil
+}
+
+// MaskIndices returns the indices of the conodes enabled in mask, in the order
+// of the roster
+func MaskIndices(mask *cosi.Mask) []int {
+	var indices []int
+	for i := 0; ; i++ {
+		enabled, err := mask.IndexEnabled(i)
+		if err != nil {
+			return indices
+		}
+		if enabled {
+			indices = append(indices, i)
+		}
+	}
+}
+
+// VerifyCosi returns an error if sig is not a collective signature of msg by
+// at least threshold conodes of publics. Only the conodes of the signer mask
+// are checked, so that a signature made while some conodes were offline is
+// valid.
+func VerifyCosi(publics []kyber.Point, msg, sig []byte, threshold int) error {
+	mask, err := SignerMask(publics, sig)
+	if err != nil {
+		return err
+	}
+	if signers := mask.CountEnabled(); signers < threshold {
+		return fmt.Errorf("signed by %d conodes, %d needed", signers, threshold)
+	}
+	return cosi.Verify(CosiSuite, publics, msg, sig, cosi.NewThresholdPolicy(threshold))
+}
+
+// SignerPublic returns the BLS public key of k, or an error if k is not the
+// key of the conode of public key conode
+func SignerPublic(k SignerKey, conode kyber.Point) (kyber.Point, error) {
+	hexConode, err := encoding.PointToStringHex(Suite, conode)
+	if err != nil {
+		return nil, err
+	}
+	if k.Conode != hexConode {
+		return nil, errors.New("BLS key of another conode")
+	}
+	if err := schnorr.Verify(Suite, conode, EndorsementMessage(k.Public), k.Endorsement); err != nil {
+		return nil, fmt.Errorf("BLS key not endorsed by the conode: %v", err)
+	}
+	public := BLSSuite.G2().Point()
+	if err := public.UnmarshalBinary(k.Public); err != nil {
+		return nil, err
+	}
+	if err := bls.Verify(BLSSuite, public, PossessionMessage(k.Public), k.Possession); err != nil {
+		return nil, fmt.Errorf("no proof of possession of the BLS key: %v", err)
+	}
+	return public, nil
+}
+
+// SignerPublics returns the BLS public keys of the conodes of publics, in
+// order, from keys. The conodes without a valid key in keys get nil.
+func SignerPublics(publics []kyber.Point, keys []SignerKey) []kyber.Point {
+	signers := make([]kyber.Point, len(publics))
+	for i, p := range publics {
+		for _, k := range keys {
+			if public, err := SignerPublic(k, p); err == nil {
+				signers[i] = public
+				break
+			}
+		}
+	}
+	return signers
+}
+
+// maskPublics returns signers where the conodes without BLS key get the
+// neutral element, which they cannot sign with
+func maskPublics(signers []kyber.Point) []kyber.Point {
+	publics := make([]kyber.Point, len(signers))
+	for i, s := range signers {
+		if s == nil {
+			s = blsKeySuite.Point().Null()
+		}
+		publics[i] = s
+	}
+	return publics
+}
+
+// NewBLSMask returns the empty mask of the BLS signatures of signers, the BLS
+// public keys of the roster, nil for the conodes without BLS key
+func NewBLSMask(signers []kyber.Point) (*cosi.Mask, error) {
+	return cosi.NewMask(blsKeySuite, maskPublics(signers), nil)
+}
+
+// BLSSignerMask returns the mask of the conodes of publics whose BLS
+// signatures are aggregated in sig, with their BLS keys from keys. The mask
+// aggregates the BLS keys of the signers.
+func BLSSignerMask(publics []kyber.Point, keys []SignerKey, sig []byte) (*cosi.Mask, error) {
+	signers := SignerPublics(publics, keys)
+	mask, err := NewBLSMask(signers)
+	if err != nil {
+		return nil, err
+	}
+	lenSig := BLSSuite.G1().PointLen()
+	if len(sig) != lenSig+mask.Len() {
+		return nil, fmt.Errorf("BLS signature does not match a roster of %d conodes", len(publics))
+	}
+	if err := mask.SetMask(sig[lenSig:]); err != nil {
+		return nil, err
+	}
+	for i := range signers {
+		if enabled, _ := mask.IndexEnabled(i); enabled && signers[i] == nil {
+			return nil, fmt.Errorf("conode %d signed without a valid BLS key", i)
+		}
+	}
+	return mask, nil
+}
+
+// VerifyBLS returns an error if sig is not an aggregated BLS signature of msg
+// by conodes of publics accepted by policy, see BLSSignerMask
+func VerifyBLS(publics []kyber.Point, keys []SignerKey, msg, sig []byte, policy cosi.Policy) error {
+	mask, err := BLSSignerMask(publics, keys, sig)
+	if err != nil {
+		return err
+	}
+	if !policy.Check(mask) {
+		return errors.New("the signers of the BLS signature are refused by the policy")
+	}
+	lenSig := BLSSuite.G1().PointLen()
+	return bls.Verify(BLSSuite, mask.AggregatePublic, msg, sig[:lenSig])
+}
+
+// VerifySignature returns an error if sig is not a signature of msg with the
+// scheme by at least threshold conodes of publics, see VerifyCosi and
+// VerifyBLS. keys are only used by SchemeBLS.
+func VerifySignature(scheme string, publics []kyber.Point, keys []SignerKey, msg, sig []byte, threshold int) error {
+	if scheme != SchemeBLS {
+		return VerifyCosi(publics, msg, sig, threshold)
+	}
+	mask, err := BLSSignerMask(publics, keys, sig)
+	if err != nil {
+		return err
+	}
+	if signers := mask.CountEnabled(); signers < threshold {
+		return fmt.Errorf("signed by %d conodes, %d needed", signers, threshold)
+	}
+	return VerifyBLS(publics, keys, msg, sig, cosi.NewThresholdPolicy(threshold))
+}
+
+// SignatureMask returns the mask of the conodes of publics that took part in
+// the signature sig of the scheme, see SignerMask and BLSSignerMask. keys are
+// only used by SchemeBLS.
+func SignatureMask(scheme string, publics []kyber.Point, keys []SignerKey, sig []byte) (*cosi.Mask, error) {
+	if scheme != SchemeBLS {
+		return SignerMask(publics, sig)
+	}
+	return BLSSignerMask(publics, keys, sig)
+}
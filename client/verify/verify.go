@@ -0,0 +1,148 @@
+/*
+Package verify checks the snapshots of the archive without running a conode.
+It only needs the public keys of the roster that signed a snapshot. It only
+depends on kyber, so that it can be embedded in other Go programs, e.g. a
+gateway serving the archive over HTTP, without the dependencies of the
+conodes. The pages are given as Webstore, see decenarch.Webstore.Verifiable.
+The inclusion of a page in the skipchain is checked by skip.VerifyProof.
+*/
+package verify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"gopkg.in/dedis/kyber.v2"
+)
+
+// Webstore is the signed data of an archived page or additional resource,
+// see decenarch.Webstore
+//    - Url is the URL of the page and Page its content, base64 encoded
+//    - AddsUrl are the URLs of the additional resources of the page and
+//      AddsHash their content hashes, see ContentHash
+//    - CaptureTime is the unix time at which the page was captured and
+//      TimestampSig the signature of TimestampMessage, nil for the
+//      additional resources and the pages archived before the endorsement
+//    - Sig is the signature of the content, with the scheme Scheme, see
+//      VerifySignature, SignerKeys the BLS keys of its signers and Mask its
+//      participation mask, if stored with the page
+type Webstore struct {
+	Url          string
+	Page         string
+	AddsUrl      []string
+	AddsHash     []string
+	CaptureTime  int64
+	TimestampSig []byte
+	Sig          []byte
+	Scheme       string
+	SignerKeys   []SignerKey
+	Mask         []byte
+}
+
+// Snapshot is a page retrieved from the archive with its additional
+// resources, see decenarch.RetrieveResponse
+//    - Publics are the public keys of the roster that signed the pages
+//    - Threshold is the number of conodes that must have signed the pages,
+//      see decenarch.Threshold
+//    - Main is the page and Adds its additional resources
+type Snapshot struct {
+	Publics   []kyber.Point
+	Threshold int
+	Main      Webstore
+	Adds      []Webstore
+}
+
+// Verify returns an error if the page or one of its additional resources is
+// not valid
+func (s *Snapshot) Verify() error {
+	if _, err := Page(s.Publics, s.Threshold, s.Main); err != nil {
+		return err
+	}
+	for _, add := range s.Adds {
+		if err := Resource(s.Publics, s.Threshold, s.Main, add); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Page returns the content of the page, or an error if it is not
+// collectively signed by threshold conodes of publics, with the signature
+// scheme of the page. The endorsement of its capture time is checked too, if
+// any.
+func Page(publics []kyber.Point, threshold int, page Webstore) ([]byte, error) {
+	if page.Sig == nil {
+		return nil, fmt.Errorf("page %s is not signed", page.Url)
+	}
+	content, err := base64.StdEncoding.DecodeString(page.Page)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := Signers(publics, page); err != nil {
+		return nil, err
+	}
+	if err := VerifySignature(page.Scheme, publics, page.SignerKeys, content, page.Sig, threshold); err != nil {
+		return nil, err
+	}
+	if ts := page.TimestampSig; ts != nil {
+		msg := TimestampMessage(ContentHash(content), page.CaptureTime)
+		if err := VerifySignature(page.Scheme, publics, page.SignerKeys, msg, ts, threshold); err != nil {
+			return nil, errors.New("invalid endorsement of the capture time: " + err.Error())
+		}
+	}
+	return content, nil
+}
+
+// Signers returns the indices in publics of the conodes that signed the page,
+// from the participation mask of its signature. The threshold is not checked,
+// see Page. The mask stored with the page, if any, must be the mask of the
+// signature.
+func Signers(publics []kyber.Point, page Webstore) ([]int, error) {
+	if page.Sig == nil {
+		return nil, fmt.Errorf("page %s is not signed", page.Url)
+	}
+	mask, err := SignatureMask(page.Scheme, publics, page.SignerKeys, page.Sig)
+	if err != nil {
+		return nil, err
+	}
+	if page.Mask != nil && !bytes.Equal(page.Mask, mask.Mask()) {
+		return nil, fmt.Errorf("the mask of page %s is not the mask of its signature", page.Url)
+	}
+	return MaskIndices(mask), nil
+}
+
+// Resource returns an error if add is not an additional resource of the page
+// main, collectively signed by threshold conodes of publics. The resources
+// are matched by url and, for the pages storing them, by content hash, so
+// that a resource of the same url saved with another snapshot cannot be
+// substituted.
+func Resource(publics []kyber.Point, threshold int, main, add Webstore) error {
+	if add.Sig == nil {
+		return fmt.Errorf("resource %s is not signed", add.Url)
+	}
+	content, err := base64.StdEncoding.DecodeString(add.Page)
+	if err != nil {
+		return err
+	}
+	for i, addUrl := range main.AddsUrl {
+		if addUrl != add.Url {
+			continue
+		}
+		if hash := addHash(main, i); hash != "" && ContentHash(content) != hash {
+			return fmt.Errorf("the content of %s does not match its hash", add.Url)
+		}
+		return VerifySignature(add.Scheme, publics, add.SignerKeys, content, add.Sig, threshold)
+	}
+	return fmt.Errorf("%s is not a resource of %s", add.Url, main.Url)
+}
+
+// addHash returns the content hash of the i-th additional resource of page,
+// empty if the page does not store the hashes of its additional resources
+func addHash(page Webstore, i int) string {
+	if len(page.AddsHash) != len(page.AddsUrl) {
+		return ""
+	}
+	return page.AddsHash[i]
+}
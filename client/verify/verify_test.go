@@ -0,0 +1,97 @@
+package verify
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/util/key"
+
+	"github.com/dedis/student_18_decenar/lib/cositest"
+)
+
+// cosign returns the collective signature of msg by all the key pairs
+func cosign(t *testing.T, kps []*key.Pair, msg []byte) []byte {
+	sig, err := cositest.Sign(CosiSuite, kps, nil, msg)
+	require.NoError(t, err)
+	return sig
+}
+
+func TestSnapshot(t *testing.T) {
+	kps := []*key.Pair{key.NewKeyPair(Suite), key.NewKeyPair(Suite)}
+	publics := []kyber.Point{kps[0].Public, kps[1].Public}
+
+	content, css := []byte("<html></html>"), []byte("p { color: red; }")
+	add := Webstore{
+		Url:  "http://example.com/main.css",
+		Page: base64.StdEncoding.EncodeToString(css),
+		Sig:  cosign(t, kps, css),
+	}
+	main := Webstore{
+		Url:         "http://example.com",
+		Page:        base64.StdEncoding.EncodeToString(content),
+		Sig:         cosign(t, kps, content),
+		AddsUrl:     []string{add.Url},
+		AddsHash:    []string{ContentHash(css)},
+		CaptureTime: 1527847200,
+	}
+	main.TimestampSig = cosign(t, kps, TimestampMessage(ContentHash(content), main.CaptureTime))
+	s := &Snapshot{Publics: publics, Threshold: 2, Main: main, Adds: []Webstore{add}}
+	require.NoError(t, s.Verify())
+
+	page, err := Page(publics, 2, main)
+	require.NoError(t, err)
+	require.Equal(t, content, page)
+
+	// the signers are read from the mask of the signature, which must be
+	// the mask stored with the page
+	signers, err := Signers(publics, main)
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1}, signers)
+	masked := main
+	masked.Mask = main.Sig[CosiSuite.PointLen()+CosiSuite.ScalarLen():]
+	_, err = Page(publics, 2, masked)
+	require.NoError(t, err)
+	masked.Mask = []byte{1}
+	_, err = Page(publics, 2, masked)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not the mask of its signature")
+
+	// the capture time is part of the endorsement
+	moved := main
+	moved.CaptureTime++
+	_, err = Page(publics, 2, moved)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "capture time")
+
+	// an unsigned page or a page signed by another roster is refused
+	unsigned := main
+	unsigned.Sig = nil
+	_, err = Page(publics, 2, unsigned)
+	require.Error(t, err)
+	_, err = Page([]kyber.Point{publics[1], publics[0]}, 2, main)
+	require.Error(t, err)
+
+	// a resource of another snapshot does not match its hash
+	other := add
+	other.Page = base64.StdEncoding.EncodeToString([]byte("p { color: blue; }"))
+	other.Sig = cosign(t, kps, []byte("p { color: blue; }"))
+	err = Resource(publics, 2, main, other)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "does not match its hash")
+	other.Url = "http://example.com/other.css"
+	require.Error(t, Resource(publics, 2, main, other))
+	s.Adds = []Webstore{other}
+	require.Error(t, s.Verify())
+}
+
+func TestAddHash(t *testing.T) {
+	page := Webstore{AddsUrl: []string{"http://example.com/a.css", "http://example.com/b.png"}}
+	require.Equal(t, "", addHash(page, 1))
+	page.AddsHash = []string{"aa", "bb"}
+	require.Equal(t, "bb", addHash(page, 1))
+	// an inconsistent list is ignored, the signature is still verified
+	page.AddsHash = page.AddsHash[:1]
+	require.Equal(t, "", addHash(page, 0))
+}
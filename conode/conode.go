@@ -21,9 +21,9 @@ import (
 	"path"
 	"strings"
 
-	"gopkg.in/dedis/cothority.v2"
 	"gopkg.in/dedis/cothority.v2/ftcosi/check"
 
+	decenarch "github.com/dedis/student_18_decenar"
 	_ "github.com/dedis/student_18_decenar/service"
 	"gopkg.in/dedis/onet.v2/app"
 	"gopkg.in/dedis/onet.v2/cfgpath"
@@ -127,7 +127,7 @@ func setup(c *cli.Context) error {
 	if c.String("debug") != "" {
 		log.Fatal("[-] Debug option cannot be used for the 'setup' command")
 	}
-	app.InteractiveConfig(cothority.Suite, "conode")
+	app.InteractiveConfig(decenarch.Suite, "conode")
 	return nil
 }
 
@@ -0,0 +1,190 @@
+package main
+
+/*
+The bundle.go defines the export and import commands. An exported archive is
+a gzip compressed tar file holding:
+    - manifest.json, which describes the bundle
+    - blocks/NNNNNN.skipblock, the protobuf encoding of every skipblock of
+      the archive, with its roster and its links
+    - blocks/NNNNNN.json, the content of every block, with the content of its
+      pages and its collective signatures
+The blocks are numbered from 1, the genesis block is not exported.
+*/
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	skip "github.com/dedis/student_18_decenar/skip"
+
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/network"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// bundleManifest describes an exported archive
+type bundleManifest struct {
+	Genesis  string
+	Blocks   int
+	Exported string
+}
+
+// Exports the whole archive in a bundle
+func cmdExport(c *cli.Context) error {
+	out := c.String("out")
+	if out == "" {
+		log.Fatal("Please provide the file of the bundle with export --out [file]")
+	}
+	group := readGroup(c)
+	genesisID := readGenesis(group)
+
+	client := skipClient(c, group)
+	client.Tier = skip.NewRemoteTier(group.Roster)
+	chain, err := client.Chain(genesisID, group.Roster)
+	if err != nil {
+		log.Fatal("When reading the skipchain:", err)
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(&bundleManifest{
+		Genesis:  hex.EncodeToString(genesisID),
+		Blocks:   len(chain),
+		Exported: time.Now().Format(decenarch.StatTimeFormat),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeBundleFile(tw, "manifest.json", manifest); err != nil {
+		return err
+	}
+
+	for _, sb := range chain {
+		raw, err := network.Marshal(sb)
+		if err != nil {
+			return err
+		}
+		if err := writeBundleFile(tw, fmt.Sprintf("blocks/%06d.skipblock", sb.Index), raw); err != nil {
+			return err
+		}
+		// the pages are checked against the roster that signed them
+		block, err := client.BlockContent(sb.Roster, sb)
+		if err != nil {
+			return fmt.Errorf("block %d: %v", sb.Index, err)
+		}
+		content, err := json.Marshal(block)
+		if err != nil {
+			return err
+		}
+		if err := writeBundleFile(tw, fmt.Sprintf("blocks/%06d.json", sb.Index), content); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	log.Info("Archive of", len(chain), "blocks exported in", out)
+	return nil
+}
+
+// writeBundleFile adds the file to the bundle
+func writeBundleFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Imports the blocks of a bundle in the skipchain of the group
+func cmdImport(c *cli.Context) error {
+	in := c.String("in")
+	if in == "" {
+		log.Fatal("Please provide the file of the bundle with import --in [file]")
+	}
+	group := readGroup(c)
+
+	// the import is signed by an authorized client or by the conode
+	// storing the blocks
+	var client *decenarch.Client
+	dst := group.Roster.RandomServerIdentity()
+	switch {
+	case c.String("private") != "":
+		si, private, err := readPrivate(c.String("private"))
+		log.ErrFatal(err, "Couldn't read private configuration")
+		client = decenarch.NewSignedClient(&key.Pair{Public: si.Public, Private: private})
+		dst = si
+	case c.String("key") != "":
+		kp, err := readKeyPair(c.String("key"))
+		log.ErrFatal(err, "Couldn't read private key")
+		client = decenarch.NewSignedClient(kp)
+	default:
+		log.Fatal("Please sign the import with import --key [file] or --private [private.toml]")
+	}
+	client.Namespace = c.String("namespace")
+
+	f, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+
+	imported := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// the blocks are written in order in the bundle
+		if !strings.HasPrefix(hdr.Name, "blocks/") || !strings.HasSuffix(hdr.Name, ".json") {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		block := &decenarch.Block{}
+		if err := json.Unmarshal(data, block); err != nil {
+			return fmt.Errorf("%s: %v", hdr.Name, err)
+		}
+		if block.Sig == nil {
+			log.Warn("Skipping", hdr.Name, "stored before the signature of the blocks")
+			continue
+		}
+		if _, err := client.Import(dst, block); err != nil {
+			log.Fatal("When importing", hdr.Name, ":", err)
+		}
+		imported++
+	}
+	log.Info(imported, "blocks imported from", in)
+	return nil
+}
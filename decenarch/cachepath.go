@@ -0,0 +1,117 @@
+package main
+
+/*
+The cachepath.go defines the names of the files of the cache directory, so
+that every url can be stored on every operating system. The components of the
+paths are sanitized with the rules of the most restrictive system, Windows,
+whatever the system of the client, so that a cache directory can be copied
+from a system to another.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+const (
+	// maxComponentLength is the maximal length in bytes of a component of
+	// a path of the cache directory. The longer components are shortened
+	// and end with their hash
+	maxComponentLength = 96
+	// componentHashLength is the number of hexadecimal digits of the hash
+	// ending the shortened components
+	componentHashLength = 16
+)
+
+// reservedNames are the file names reserved by Windows, with or without
+// extension
+var reservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true,
+	"com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true,
+	"lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// sanitizeComponent returns a file name valid on all the systems for the
+// component c of a path:
+//    - the characters forbidden by Windows and the control characters are
+//      replaced by _
+//    - the names reserved by Windows are prefixed by _
+//    - the trailing dots and spaces are replaced by _, so that . and .. do
+//      not leave the cache directory
+//    - the components longer than maxComponentLength are shortened and end
+//      with their hash and their extension
+func sanitizeComponent(c string) string {
+	if c == "" {
+		return "_"
+	}
+	b := []byte(c)
+	for i, ch := range b {
+		if ch < 0x20 || ch == 0x7f || strings.IndexByte(`<>:"/\|?*`, ch) >= 0 {
+			b[i] = '_'
+		}
+	}
+	for i := len(b) - 1; i >= 0 && (b[i] == '.' || b[i] == ' '); i-- {
+		b[i] = '_'
+	}
+	s := string(b)
+	base := strings.ToLower(s)
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if reservedNames[strings.TrimRight(base, " ")] {
+		s = "_" + s
+	}
+	if len(s) <= maxComponentLength {
+		return s
+	}
+	h := sha256.Sum256([]byte(c))
+	suffix := "-" + hex.EncodeToString(h[:])[:componentHashLength]
+	ext := path.Ext(s)
+	if len(ext) > 16 {
+		ext = ""
+	}
+	suffix += ext
+	cut := maxComponentLength - len(suffix)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + suffix
+}
+
+// queryHash returns the shortened hash of the canonical query of url, see
+// lib.QueryHash, so that the variants of a page are stored in distinct files
+// whatever the characters of their query, and the same variant in the same
+// file whatever the order of its parameters. It returns "" if url has no
+// query once normalized.
+func queryHash(url, rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	h := lib.ContentHash([]byte(rawQuery))
+	if normalized, err := lib.NormalizeURL(url); err == nil {
+		h = lib.QueryHash(normalized)
+	}
+	if h == "" {
+		return ""
+	}
+	return h[:componentHashLength]
+}
+
+// sanitizePath returns the slash separated path p with all its components
+// sanitized, see sanitizeComponent. The empty components are removed.
+func sanitizePath(p string) []string {
+	var components []string
+	for _, c := range strings.Split(p, "/") {
+		if c != "" {
+			components = append(components, sanitizeComponent(c))
+		}
+	}
+	return components
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func TestSanitizeComponent(t *testing.T) {
+	for c, expected := range map[string]string{
+		"page.html":       "page.html",
+		"com:8080":        "com_8080",
+		`a<b>c:"d"|e?f*g`: "a_b_c__d__e_f_g",
+		"back\\slash":     "back_slash",
+		"CON":             "_CON",
+		"nul.txt":         "_nul.txt",
+		"Com1.tar.gz":     "_Com1.tar.gz",
+		"console":         "console",
+		"..":              "__",
+		".":               "_",
+		"dir. ":           "dir__",
+		"":                "_",
+		"パス":              "パス",
+	} {
+		require.Equal(t, expected, sanitizeComponent(c), c)
+	}
+
+	// the long components keep their extension and differ by their hash
+	long := strings.Repeat("a", 300) + ".html"
+	s := sanitizeComponent(long)
+	require.Equal(t, maxComponentLength, len(s))
+	require.True(t, strings.HasSuffix(s, ".html"))
+	require.NotEqual(t, s, sanitizeComponent(strings.Repeat("a", 301)+".html"))
+
+	// the multi-byte characters are not cut
+	s = sanitizeComponent(strings.Repeat("é", 100))
+	require.True(t, utf8.ValidString(s))
+	require.True(t, len(s) <= maxComponentLength)
+}
+
+func TestFolderAndFilePath(t *testing.T) {
+	folder, file, err := getFolderAndFilePath("https://例え.jp/パス/page.html")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(cachePath, "jp", "xn--r8jz45g", "パス"), folder)
+	require.Equal(t, filepath.Join(folder, "page.html"), file)
+
+	// the same page is stored at the same place under any form of its url
+	_, same, err := getFolderAndFilePath("https://xn--r8jz45g.JP/%E3%83%91%E3%82%B9/page.html")
+	require.NoError(t, err)
+	require.Equal(t, file, same)
+
+	// ports, reserved names and queries give valid paths
+	folder, file, err = getFolderAndFilePath("http://example.com:8080/aux/../con/list.php?q=" + strings.Repeat("x", 500))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(cachePath, "com_8080", "example", "_aux", "__", "_con"), folder)
+	query := lib.ContentHash([]byte("q=" + strings.Repeat("x", 500)))
+	require.Equal(t, "list_"+query[:componentHashLength]+".php", filepath.Base(file))
+
+	// the variants of a page are stored in distinct files, whatever the
+	// characters of their query and the order of their parameters
+	_, colon, err := getFolderAndFilePath("http://example.com/search?q=a:b")
+	require.NoError(t, err)
+	_, underscore, err := getFolderAndFilePath("http://example.com/search?q=a_b")
+	require.NoError(t, err)
+	require.NotEqual(t, colon, underscore)
+	_, ordered, err := getFolderAndFilePath("http://example.com/search?q=a&page=2")
+	require.NoError(t, err)
+	_, reordered, err := getFolderAndFilePath("http://example.com/search?page=2&q=a&utm_source=x")
+	require.NoError(t, err)
+	require.Equal(t, ordered, reordered)
+	_, tracked, err := getFolderAndFilePath("http://example.com/search?utm_source=x")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(cachePath, "com", "example", "search"), tracked)
+
+	// the index of a folder
+	_, file, err = getFolderAndFilePath("http://example.com/blog/")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(cachePath, "com", "example", "blog", "index.html"), file)
+}
@@ -2,29 +2,48 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"encoding/base64"
+	"encoding/hex"
 	urlpkg "net/url"
 
+	"github.com/BurntSushi/toml"
 	decenarch "github.com/dedis/student_18_decenar"
-	"golang.org/x/net/html"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/pkg/archive"
+	"github.com/dedis/student_18_decenar/protocol"
+	skip "github.com/dedis/student_18_decenar/skip"
 
+	"golang.org/x/crypto/ssh/terminal"
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/util/encoding"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
 	"gopkg.in/dedis/onet.v2/app"
+	"gopkg.in/dedis/onet.v2/network"
 
 	"gopkg.in/dedis/onet.v2/log"
 	"gopkg.in/urfave/cli.v1"
 )
 
-// path to the directory where website will be stored for consultation
-const (
-	cachePath = "/tmp/cocache"
+// path to the directory where website will be stored for consultation, in
+// the temporary directory of the system
+var (
+	cachePath = filepath.Join(os.TempDir(), "cocache")
 )
 
 func main() {
-	log.Info("Start decenarch application")
+	log.Lvl2("Start decenarch application")
 	cliApp := cli.NewApp()
 	cliApp.Name = "decenarch"
 	cliApp.Usage = "retrieve static websites"
@@ -42,10 +61,108 @@ func main() {
 					Name:  "url, u",
 					Usage: "Provide url to retrieve",
 				},
+				cli.StringFlag{
+					Name:  "namespace",
+					Usage: "Provide the namespace of the archive, empty for the default archive",
+				},
 				cli.StringFlag{
 					Name:  "timestamp, t",
 					Usage: "Provide timestamp",
 				},
+				cli.StringFlag{
+					Name:  "export, e",
+					Usage: "Export the page as a single file instead of storing it in the cache directory",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Value: formatHTML,
+					Usage: "Format of the exported file, html or mhtml",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print the result as JSON",
+				},
+				cli.BoolFlag{
+					Name:  "chain-proof",
+					Usage: "Fail if the inclusion proof of the page in the skipchain is not valid",
+				},
+				cli.StringFlag{
+					Name:  "genesis",
+					Usage: "Provide the hex ID of the genesis block checked by the inclusion proof, asked to the conodes if empty",
+				},
+			},
+		},
+		{
+			Name:      "history",
+			Usage:     "list the saved versions of the website",
+			Aliases:   []string{"h"},
+			ArgsUsage: groupsDef,
+			Action:    cmdHistory,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "url, u",
+					Usage: "Provide url of the website",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print the result as JSON",
+				},
+			},
+		},
+		{
+			Name:      "audit",
+			Usage:     "verify the signature and the inclusion proof of every saved version of the website",
+			ArgsUsage: groupsDef,
+			Action:    cmdAudit,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "url, u",
+					Usage: "Provide url of the website",
+				},
+				cli.StringFlag{
+					Name:  "genesis",
+					Usage: "Provide the hex ID of the genesis block checked by the inclusion proofs, asked to the conodes if empty",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print the result as JSON",
+				},
+			},
+		},
+		{
+			Name:      "variants",
+			Usage:     "list the saved urls of the website differing only by their query",
+			ArgsUsage: groupsDef,
+			Action:    cmdVariants,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "url, u",
+					Usage: "Provide url of the website, its query is ignored",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print the result as JSON",
+				},
+			},
+		},
+		{
+			Name:      "stats",
+			Usage:     "print how often the website changed and when to save it again",
+			ArgsUsage: groupsDef,
+			Action:    cmdStats,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "url, u",
+					Usage: "Provide url of the website",
+				},
+				cli.StringFlag{
+					Name:  "namespace",
+					Usage: "Provide the namespace of the archive, empty for the default archive",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print the result as JSON",
+				},
 			},
 		},
 		{
@@ -59,6 +176,86 @@ func main() {
 					Name:  "url, u",
 					Usage: "Provide url to save",
 				},
+				cli.StringFlag{
+					Name:  "namespace",
+					Usage: "Provide the namespace of the archive, empty for the default archive",
+				},
+				cli.StringFlag{
+					Name:  "key, k",
+					Usage: "Provide the file containing the private key used to sign the request",
+				},
+				cli.StringFlag{
+					Name:  "engine, e",
+					Usage: "Provide the consensus engine, cbf or merkle",
+				},
+				cli.StringFlag{
+					Name:  "extractor",
+					Usage: "Provide the leaf extractor, text, attributes, visible or main",
+				},
+				cli.Float64Flag{
+					Name:  "fprate, f",
+					Usage: "Provide the target false positive rate of the Bloom filters",
+				},
+				cli.BoolFlag{
+					Name:  "sync",
+					Usage: "Wait until the website is stored in a block of the skipchain",
+				},
+				cli.BoolFlag{
+					Name:  "force",
+					Usage: "Archive the website again even if it did not change since its last snapshot",
+				},
+				cli.BoolFlag{
+					Name:  "proof",
+					Usage: "Print the transcript of the consensus",
+				},
+				cli.BoolFlag{
+					Name:  "diagnostics",
+					Usage: "Print why leaves of the website were dropped from the consensus",
+				},
+				cli.StringFlag{
+					Name:  "proof-out",
+					Usage: "Provide the JSON file where to write the transcript of the consensus",
+				},
+				cli.BoolFlag{
+					Name:  "render",
+					Usage: "Save the page rendered by the browser of the conodes, for the pages built by JavaScript",
+				},
+				cli.StringFlag{
+					Name:  "method",
+					Usage: "Provide the method of the request replayed by the conodes, GET or POST",
+				},
+				cli.StringFlag{
+					Name:  "body",
+					Usage: "Provide the file containing the body of the request replayed by the conodes",
+				},
+				cli.StringSliceFlag{
+					Name:  "header",
+					Usage: "Provide a header of the request replayed by the conodes, as Name: value",
+				},
+				cli.StringSliceFlag{
+					Name:  "secret",
+					Usage: "Provide the name of a header or form field of the request redacted from the archive",
+				},
+				cli.StringSliceFlag{
+					Name:  "fetch-header",
+					Usage: "Override a header of the fetches agreed at setup, as Name: value, an empty value removes it",
+				},
+				cli.IntFlag{
+					Name:  "subtrees",
+					Usage: "Provide the number of subtrees of the signing protocols, 0 for the option of the conode",
+				},
+				cli.IntFlag{
+					Name:  "sign-timeout",
+					Usage: "Provide the seconds the conode waits for a subtree of the signing protocols, 0 for the option of the conode",
+				},
+				cli.IntFlag{
+					Name:  "sign-retries",
+					Usage: "Provide the number of runs of a signing protocol after a timeout, 0 for the option of the conode",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print the result as JSON",
+				},
 			},
 		},
 		{
@@ -67,6 +264,274 @@ func main() {
 			Aliases:   []string{"k"},
 			ArgsUsage: groupsDef,
 			Action:    cmdStart,
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "authorize, a",
+					Usage: "Provide the public key of a client allowed to save web pages",
+				},
+				cli.StringSliceFlag{
+					Name:  "fetch-header",
+					Usage: "Provide a header of the fetches of the pages by the conodes, as Name: value",
+				},
+				cli.Float64Flag{
+					Name:  "fprate, f",
+					Usage: "Provide the default target false positive rate of the Bloom filters",
+				},
+				cli.Int64Flag{
+					Name:  "interval, i",
+					Usage: "Provide the minimal number of seconds between two blocks of the skipchain",
+				},
+				cli.BoolFlag{
+					Name:  "force",
+					Usage: "Run the DKG again on conodes already set up",
+				},
+				cli.StringFlag{
+					Name:  "scheme",
+					Usage: "Provide the signature scheme of the archive, ftcosi or bls",
+				},
+				cli.StringFlag{
+					Name:  "namespace",
+					Usage: "Provide the namespace of the archive to set up, empty for the default archive",
+				},
+				cli.StringFlag{
+					Name:  "key, k",
+					Usage: "Provide the file containing the private key of an authorized client signing a forced setup or a new namespace",
+				},
+			},
+		},
+		{
+			Name:      "setupinfo",
+			Usage:     "check that the conodes agree on their setup",
+			ArgsUsage: groupsDef,
+			Action:    cmdSetupInfo,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "namespace",
+					Usage: "Provide the namespace of the archive, empty for the default archive",
+				},
+			},
+		},
+		{
+			Name:      "trust",
+			Usage:     "print the identity of the group pinned in the trust store",
+			ArgsUsage: groupsDef,
+			Action:    cmdTrust,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "reset",
+					Usage: "Pin the current roster, key and genesis block of the group",
+				},
+			},
+		},
+		{
+			Name:      "key",
+			Usage:     "print the collective key of the conodes and check it against a pinned key",
+			ArgsUsage: groupsDef,
+			Action:    cmdKey,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "pin",
+					Usage: "Provide the JSON file of the pinned key, written if it does not exist",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print the result as JSON",
+				},
+			},
+		},
+		{
+			Name:      "prune",
+			Usage:     "move the content of the old pages out of the hot storage tier of the conodes",
+			ArgsUsage: groupsDef,
+			Action:    cmdPrune,
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "days",
+					Usage: "Provide the age in days of the pages to prune",
+				},
+				cli.StringFlag{
+					Name:  "private, p",
+					Usage: "Provide the private.toml of the conode of the group leading the pruning",
+				},
+				cli.StringFlag{
+					Name:  "namespace",
+					Usage: "Provide the namespace of the archive, empty for the default archive",
+				},
+			},
+		},
+		{
+			Name:      "export",
+			Usage:     "export the whole archive in a bundle",
+			ArgsUsage: groupsDef,
+			Action:    cmdExport,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "out, o",
+					Usage: "Provide the file of the bundle",
+				},
+			},
+		},
+		{
+			Name:      "import",
+			Usage:     "import an exported archive in the skipchain",
+			ArgsUsage: groupsDef,
+			Action:    cmdImport,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "in, i",
+					Usage: "Provide the file of the bundle",
+				},
+				cli.StringFlag{
+					Name:  "key, k",
+					Usage: "Provide the file containing the private key of an authorized client signing the request",
+				},
+				cli.StringFlag{
+					Name:  "private, p",
+					Usage: "Provide the private.toml of the conode of the group storing the blocks, signing the request",
+				},
+				cli.StringFlag{
+					Name:  "namespace",
+					Usage: "Provide the namespace of the archive, empty for the default archive",
+				},
+			},
+		},
+		{
+			Name:      "mirror",
+			Usage:     "mirror the archive of another cothority in the skipchain",
+			ArgsUsage: groupsDef,
+			Action:    cmdMirror,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "origin, o",
+					Usage: "Provide the group-definition-file of the mirrored cothority",
+				},
+				cli.StringFlag{
+					Name:  "private, p",
+					Usage: "Provide the private.toml of the conode of the group leading the mirroring",
+				},
+				cli.StringFlag{
+					Name:  "namespace",
+					Usage: "Provide the namespace of the archive, empty for the default archive",
+				},
+			},
+		},
+		{
+			Name:      "flush",
+			Usage:     "store the pending pages in the skipchain",
+			ArgsUsage: groupsDef,
+			Action:    cmdFlush,
+		},
+		{
+			Name:      "subscribe",
+			Usage:     "register a webhook receiving the events of the conodes",
+			ArgsUsage: groupsDef,
+			Action:    cmdSubscribe,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "url, u",
+					Usage: "Provide the url of the webhook",
+				},
+				cli.StringSliceFlag{
+					Name:  "event, e",
+					Usage: "Provide a type of event to receive, save-completed, save-failed or block-created. All of them if not given",
+				},
+				cli.StringFlag{
+					Name:  "key, k",
+					Usage: "Provide the file containing the private key used to sign the request",
+				},
+			},
+		},
+		{
+			Name:      "unsubscribe",
+			Usage:     "remove a webhook from the conodes",
+			ArgsUsage: groupsDef,
+			Action:    cmdUnsubscribe,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "id",
+					Usage: "Provide the ID of the subscription",
+				},
+			},
+		},
+		{
+			Name:      "feed",
+			Usage:     "make the first conode of the group save the new entries of a feed, or list its feeds",
+			ArgsUsage: groupsDef,
+			Action:    cmdFeed,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "url, u",
+					Usage: "Provide the url of the RSS or Atom feed, none to list the watched feeds",
+				},
+				cli.DurationFlag{
+					Name:  "interval, i",
+					Usage: "Provide the duration between two polls of the feed, e.g. 30m",
+				},
+				cli.BoolFlag{
+					Name:  "remove",
+					Usage: "Stop watching the feed",
+				},
+				cli.StringFlag{
+					Name:  "key, k",
+					Usage: "Provide the file containing the private key of the client watching the feed",
+				},
+			},
+		},
+		{
+			Name:   "keygen",
+			Usage:  "generate a key pair to sign save requests",
+			Action: cmdKeygen,
+		},
+		{
+			Name:      "status",
+			Usage:     "show the status of the conodes",
+			Aliases:   []string{"st"},
+			ArgsUsage: groupsDef,
+			Action:    cmdStatus,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print the result as JSON",
+				},
+			},
+		},
+		{
+			Name:    "admin",
+			Usage:   "inspect and repair the storage of a conode",
+			Aliases: []string{"a"},
+			Subcommands: []cli.Command{
+				adminCommand(decenarch.AdminDumpStorage, "dump the storage of the conode"),
+				namespaceAdminCommand(decenarch.AdminShowSecretIndex, "show the index of the DKG share of the conode"),
+				namespaceAdminCommand(decenarch.AdminShowGenesis, "show the genesis block ID known by the conode"),
+				adminCommand(decenarch.AdminClearPending, "clear the state of the idle pending saves of the conode"),
+				adminCommand(decenarch.AdminShowExcluded, "show the conodes excluded from the trees, with the evidence against them"),
+				adminCommand(decenarch.AdminReadmit, "re-admit all the excluded conodes in the trees"),
+				adminCommand(decenarch.AdminReloadConfig, "reload the configuration file of the conode"),
+				{
+					Name:      decenarch.AdminExportSecret,
+					Usage:     "export the DKG share and the setup of the conode, encrypted locally with a passphrase",
+					ArgsUsage: "the private.toml of the conode",
+					Action:    cmdExportSecret,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "out, o",
+							Usage: "Provide the file where to write the backup",
+						},
+					},
+				},
+				{
+					Name:      decenarch.AdminImportSecret,
+					Usage:     "restore the DKG share and the setup exported by export-secret",
+					ArgsUsage: "the private.toml of the conode",
+					Action:    cmdImportSecret,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "backup, b",
+							Usage: "Provide the file of the backup",
+						},
+					},
+				},
+			},
 		},
 	}
 	cliApp.Flags = []cli.Flag{
@@ -75,6 +540,19 @@ func main() {
 			Value: 0,
 			Usage: "debug-level: 1 for terse, 5 for maximal",
 		},
+		cli.StringFlag{
+			Name:  "trust",
+			Value: defaultTrustPath(),
+			Usage: "Provide the trust store pinning the groups on first use, empty to disable the pinning",
+		},
+		cli.BoolFlag{
+			Name:  "trust-warn",
+			Usage: "Only warn when a group differs from the one pinned in the trust store",
+		},
+		cli.IntFlag{
+			Name:  "unsigned-before",
+			Usage: "Accept the skipblocks below this index without signature, for the archives created before the signature of the blocks",
+		},
 	}
 	cliApp.Before = func(c *cli.Context) error {
 		log.SetDebugVisible(c.Int("debug"))
@@ -85,28 +563,56 @@ func main() {
 
 // Returns the asked website if saved.
 func cmdRetrieve(c *cli.Context) error {
-	log.Info("Retrieve command")
+	info(c, "Retrieve command")
 	url := c.String("url")
 	timestamp := c.String("timestamp")
 	if url == "" {
 		log.Fatal("Please provide an url with save -u [url] ")
 	}
 	if timestamp == "" {
-		log.Info("It is possible to provide a timestamp with -t [2006/01/02 15:04]")
+		info(c, "It is possible to provide a timestamp with -t [2006/01/02 15:04]")
 	}
 	group := readGroup(c)
 	client := decenarch.NewClient()
+	client.IncludeChainProof = true
+	client.Namespace = c.String("namespace")
 	resp, err := client.Retrieve(group.Roster, url, timestamp)
 	if err != nil {
-		log.Fatal("When asking to retrieve", url, ":", err)
+		log.Fatal("When asking to retrieve", url, ":", explain(err))
+	}
+	// the page is verified against the roster of the skipblock storing
+	// it, trusted through the inclusion proof, which may not be the
+	// roster of the group
+	var signing *onet.Roster
+	sb, err := verifyChainProof(c, group, resp)
+	if err == nil {
+		info(c, "Page stored in skipblock", sb.Index, "of the skipchain")
+		signing, err = skip.SigningRoster(sb)
+	}
+	if err != nil {
+		if c.Bool("chain-proof") {
+			log.Fatal("Invalid inclusion proof of", url, ":", err)
+		}
+		log.Lvl1("Couldn't find the roster that signed the page:", err)
+	}
+	if export := c.String("export"); export != "" {
+		return exportRetrieved(c, signing, resp, export)
 	}
 	// save data on local filesystem
 	bPage, bErr := base64.StdEncoding.DecodeString(resp.Main.Page)
 	if bErr != nil {
 		return bErr
 	}
-	// modify images links
-	mbPage, err := changeImgSrc(bPage, resp.Main.Url)
+	bPage, err = protocol.RestoreInline(bPage, resp.Adds)
+	if err != nil {
+		return err
+	}
+	// the links to the additional resources point to their local copy
+	archived := map[string]bool{resp.Main.Url: true}
+	for _, adds := range resp.Adds {
+		archived[adds.Url] = true
+	}
+	mbPage, err := rewriteLinks(bPage, resp.Main.Url, archived)
 	if err != nil {
 		return err
 	}
@@ -115,64 +621,1030 @@ func cmdRetrieve(c *cli.Context) error {
 	if pErr != nil {
 		return pErr
 	}
-	log.Info("Website", url, "stored in", p)
+	info(c, "Website", url, "stored in", p)
+	out := &retrieveOutput{
+		Url:       resp.Main.Url,
+		Timestamp: resp.Main.Timestamp,
+		Path:      p,
+		Verified:  signing != nil && verifyPage(signing, resp.Main) == nil,
+		Adds:      make([]resourceOutput, 0, len(resp.Adds)),
+	}
+	// the signers are read from the signature, not from the answer of the
+	// conode
+	if signing != nil {
+		if out.Signers, err = pageSigners(signing, resp.Main); err != nil {
+			log.Lvl1("Couldn't list the signers of the page:", err)
+		}
+	}
 	for _, adds := range resp.Adds {
+		if protocol.IsInline(adds.Url) {
+			continue
+		}
 		abPage, abErr := base64.StdEncoding.DecodeString(adds.Page)
 		if abErr == nil {
-			log.Info("Storing", adds.Url)
-			_, apErr := storeWebPageOnDisk(adds.Url, abPage)
+			info(c, "Storing", adds.Url)
+			ap, apErr := storeWebPageOnDisk(adds.Url, abPage)
 			if apErr != nil {
 				log.Lvl1("An non-fatal error occured:", apErr)
+				continue
 			}
+			out.Adds = append(out.Adds, resourceOutput{Url: adds.Url, Path: ap})
 		} else {
 			log.Lvl1("An non-fatal error occured:", abErr)
 		}
 	}
+	if c.Bool("json") {
+		return printJSON(out)
+	}
 	log.Info("Website sucessfully stored in", p)
+	log.Infof("Signed by %d of %d conodes: %s", len(out.Signers), len(group.Roster.List), strings.Join(out.Signers, ", "))
 	return nil
 }
 
-// Saves the asked website and returns an exit state
-func cmdSave(c *cli.Context) error {
-	log.Info("Save command")
+// Prints the timeline of the versions of the asked website stored in the
+// skipchain, with their signers, and fails if one of them is not valid
+func cmdAudit(c *cli.Context) error {
 	url := c.String("url")
 	if url == "" {
-		log.Fatal("Please provide an url.")
+		log.Fatal("Please provide an url with audit -u [url] ")
 	}
 	group := readGroup(c)
-	client := decenarch.NewClient()
+	genesisID, err := genesisFlag(c, group)
+	if err != nil {
+		return err
+	}
 
-	// run DKG protocol
-	resp, err := client.Save(group.Roster, url)
+	var archive skip.Archive = skipClient(c, group)
+	timeline, err := archive.Timeline(genesisID, group.Roster, url)
 	if err != nil {
-		log.Fatal("When asking to save", url, ":", err)
+		log.Fatal("When auditing", url, ":", explain(err))
+	}
+	out := make([]auditOutput, len(timeline))
+	valid := true
+	for i, e := range timeline {
+		out[i] = newAuditOutput(e)
+		valid = valid && e.Valid()
+	}
+	if c.Bool("json") {
+		if err := printJSON(out); err != nil {
+			return err
+		}
+	} else {
+		if len(timeline) == 0 {
+			log.Info("No version of", url, "saved")
+		}
+		for _, o := range out {
+			status := "valid"
+			if o.Error != "" {
+				status = "INVALID: " + o.Error
+			}
+			log.Infof("%s: %s in skipblock %d, content %s, signed by %d of %d conodes (%s), %s",
+				o.Timestamp, o.Url, o.Index, o.PageHash, len(o.Signers), o.Conodes, strings.Join(o.Signers, ", "), status)
+		}
+	}
+	if !valid {
+		return errors.New("some versions of the website are not valid")
 	}
-	log.Info("Website", url, "saved.", resp)
 	return nil
 }
 
-// setup everything is needed for DecenArch to work properly, namely the
-// skipchain service and the DKG protocol
-func cmdStart(c *cli.Context) error {
+// Lists the versions of the asked website stored in the skipchain
+func cmdHistory(c *cli.Context) error {
+	url := c.String("url")
+	if url == "" {
+		log.Fatal("Please provide an url with history -u [url] ")
+	}
 	group := readGroup(c)
-	client := decenarch.NewClient()
-	resp, err := client.Setup(group.Roster)
+	genesisID := readGenesis(group)
+
+	var archive skip.Archive = skipClient(c, group)
+	history, err := archive.History(genesisID, group.Roster, url)
 	if err != nil {
-		log.Fatal("When asking to start the DKG protocol", err)
+		log.Fatal("When asking the history of", url, ":", explain(err))
+	}
+	if c.Bool("json") {
+		out := make([]historyOutput, len(history))
+		for i, w := range history {
+			out[i] = historyOutput{Url: w.Url, Timestamp: w.Timestamp, ContentType: w.ContentType, PageHash: w.PageHash}
+		}
+		return printJSON(out)
+	}
+	if len(history) == 0 {
+		log.Info("No version of", url, "saved")
+	}
+	for _, w := range history {
+		log.Infof("%s: %s (%s)", w.Timestamp, w.Url, w.ContentType)
 	}
-	log.Info("Skipchain started and DKG protocol went well with key", resp)
 	return nil
 }
 
-func readGroup(c *cli.Context) *app.Group {
-	if c.NArg() != 1 {
-		log.Fatal("Please give the group-file as argument")
+// Lists the variants of the asked website stored in the skipchain
+func cmdVariants(c *cli.Context) error {
+	url := c.String("url")
+	if url == "" {
+		log.Fatal("Please provide an url with variants -u [url] ")
 	}
-	name := c.Args().First()
-	f, err := os.Open(name)
-	log.ErrFatal(err, "Couldn't open group definition file")
-	group, err := app.ReadGroupDescToml(f)
-	log.ErrFatal(err, "Error while reading group definition file", err)
+	group := readGroup(c)
+	genesisID := readGenesis(group)
+
+	var archive skip.Archive = skipClient(c, group)
+	variants, err := archive.ListVariants(genesisID, group.Roster, url)
+	if err != nil {
+		log.Fatal("When asking the variants of", url, ":", explain(err))
+	}
+	if c.Bool("json") {
+		out := make([]variantOutput, len(variants))
+		for i, v := range variants {
+			out[i] = variantOutput{Url: v.Url, QueryHash: v.QueryHash, Versions: v.Versions, Latest: v.Latest}
+		}
+		return printJSON(out)
+	}
+	if len(variants) == 0 {
+		log.Info("No variant of", url, "saved")
+	}
+	for _, v := range variants {
+		log.Infof("%s: %d version(s), latest %s", v.Url, v.Versions, v.Latest)
+	}
+	return nil
+}
+
+// Prints the statistics of the changes of the asked website, computed by a
+// conode of the group
+func cmdStats(c *cli.Context) error {
+	url := c.String("url")
+	if url == "" {
+		log.Fatal("Please provide an url with stats -u [url] ")
+	}
+	group := readGroup(c)
+	client := decenarch.NewClient()
+	client.Namespace = c.String("namespace")
+	stats, err := client.Stats(group.Roster.RandomServerIdentity(), url)
+	if err != nil {
+		log.Fatal("When asking the statistics of", url, ":", explain(err))
+	}
+	if c.Bool("json") {
+		return printJSON(stats)
+	}
+	if len(stats.Samples) == 0 {
+		log.Info("No version of", url, "saved")
+		return nil
+	}
+	log.Infof("%s: %d version(s), %d unchanged record(s), %d change(s)", stats.Url, stats.Versions, stats.Unchanged, stats.Changes)
+	log.Info("Observed from", time.Unix(stats.First, 0).Format("2006/01/02 15:04"), "to", time.Unix(stats.Last, 0).Format("2006/01/02 15:04"))
+	log.Info("Average size:", stats.AverageSize, "bytes")
+	if stats.ChangeInterval > 0 {
+		log.Info("Changes every", time.Duration(stats.ChangeInterval)*time.Second, "on average")
+	}
+	if stats.SuggestedInterval > 0 {
+		log.Info("Save again in", time.Duration(stats.SuggestedInterval)*time.Second)
+	}
+	for i, s := range stats.Samples {
+		state := "unchanged"
+		switch {
+		case i == 0:
+			state = "first"
+		case s.Changed:
+			state = "changed"
+		}
+		if s.Unchanged {
+			log.Infof("%s: %s (record)", time.Unix(s.Time, 0).Format("2006/01/02 15:04"), state)
+			continue
+		}
+		log.Infof("%s: %s, %d bytes, %d resource(s)", time.Unix(s.Time, 0).Format("2006/01/02 15:04"), state, s.Size, s.Resources)
+	}
+	return nil
+}
+
+// readGenesis returns the ID of the genesis block of the archive, known by the
+// conodes of the group
+func readGenesis(group *app.Group) []byte {
+	status, err := decenarch.NewClient().Status(group.Roster)
+	if err != nil {
+		log.Fatal("When asking the status of the conodes:", err)
+	}
+	for _, st := range status.Conodes {
+		if st.Reachable && len(st.GenesisID) > 0 {
+			return st.GenesisID
+		}
+	}
+	log.Fatal("No conode knows the skipchain, run skipstart first")
+	return nil
+}
+
+// verifyChainProof returns the skipblock storing the retrieved page, checking
+// its inclusion proof against the genesis block of the flags, or the one known
+// by the conodes
+func verifyChainProof(c *cli.Context, group *app.Group, resp *decenarch.RetrieveResponse) (*skipchain.SkipBlock, error) {
+	genesisID, err := genesisFlag(c, group)
+	if err != nil {
+		return nil, err
+	}
+	return skip.VerifyProof(genesisID, resp.ChainProof, resp.Main)
+}
+
+// skipClient returns the client of the archive of the group, accepting the
+// unsigned skipblocks below the unsigned-before flag
+func skipClient(c *cli.Context, group *app.Group) *skip.SkipClient {
+	client := skip.NewSkipClient(decenarch.Threshold(len(group.Roster.List)))
+	client.UnsignedBefore = c.GlobalInt("unsigned-before")
+	return client
+}
+
+// genesisFlag returns the ID of the genesis block given with the genesis
+// flag, or asks it to the conodes of the group, for the archive of the
+// namespace flag if given
+func genesisFlag(c *cli.Context, group *app.Group) (skipchain.SkipBlockID, error) {
+	if g := c.String("genesis"); g != "" {
+		return hex.DecodeString(g)
+	}
+	if ns := c.String("namespace"); ns != "" {
+		client := decenarch.NewClient()
+		client.Namespace = ns
+		for _, si := range group.Roster.List {
+			if info, err := client.GetSetupInfo(si); err == nil {
+				return info.GenesisID, nil
+			}
+		}
+		return nil, fmt.Errorf("no conode knows the archive of namespace %s", ns)
+	}
+	return readGenesis(group), nil
+}
+
+// Saves the asked website and returns an exit state
+func cmdSave(c *cli.Context) error {
+	info(c, "Save command")
+	url := c.String("url")
+	if url == "" {
+		log.Fatal("Please provide an url.")
+	}
+	group := readGroup(c)
+	client := decenarch.NewClient()
+	if c.String("key") != "" {
+		kp, err := readKeyPair(c.String("key"))
+		log.ErrFatal(err, "Couldn't read private key")
+		client = decenarch.NewSignedClient(kp)
+	}
+	client.Engine = c.String("engine")
+	client.Extractor = c.String("extractor")
+	client.FalsePositiveRate = c.Float64("fprate")
+	client.Namespace = c.String("namespace")
+	client.Sync = c.Bool("sync")
+	client.Force = c.Bool("force")
+	client.Diagnostics = c.Bool("diagnostics")
+	client.IncludeProof = c.Bool("proof") || c.String("proof-out") != ""
+	client.Render = c.Bool("render")
+	template, err := readTemplate(c)
+	if err != nil {
+		return err
+	}
+	client.Template = template
+	if client.Headers, err = parseHeaders(c.StringSlice("fetch-header")); err != nil {
+		return err
+	}
+	sign := decenarch.SignOptions{Subtrees: c.Int("subtrees"), Timeout: c.Int("sign-timeout"), Retries: c.Int("sign-retries")}
+	if sign != (decenarch.SignOptions{}) {
+		client.Sign = &sign
+	}
+
+	// run DKG protocol
+	resp, err := client.Save(group.Roster, url)
+	if err != nil {
+		log.Fatal("When asking to save", url, ":", explain(err))
+	}
+	if client.IncludeProof {
+		if proof, err := archive.DecodeProof(resp.Proof); err == nil {
+			if err := proof.VerifyBelowThreshold(nil); err != nil {
+				log.Warn("The transcript does not prove the leaves dropped from the consensus:", err)
+			}
+		}
+	}
+	if c.Bool("json") {
+		out := &saveOutput{
+			Url:       resp.Url,
+			Timestamp: resp.Timestamp,
+			PageHash:  resp.PageHash,
+			BlockID:   hex.EncodeToString(resp.BlockID),
+			Adds:      resp.Adds,
+			Errors:    resp.Errors,
+			Unchanged: resp.Unchanged,
+
+			QueuePosition: resp.QueuePosition,
+			Divergence:    resp.Divergence,
+		}
+		if client.IncludeProof {
+			if c.String("proof-out") != "" {
+				if err := writeProof(resp.Proof, c.String("proof-out")); err != nil {
+					return err
+				}
+			} else if out.Proof, err = archive.DecodeProof(resp.Proof); err != nil {
+				return err
+			}
+		}
+		return printJSON(out)
+	}
+	if resp.Unchanged {
+		log.Info("Website", resp.Url, "unchanged at", resp.Timestamp, "since its last snapshot")
+	} else {
+		log.Info("Website", resp.Url, "saved at", resp.Timestamp)
+	}
+	log.Info("Content hash:", resp.PageHash)
+	if len(resp.BlockID) > 0 {
+		log.Info("Block:", hex.EncodeToString(resp.BlockID))
+	} else {
+		log.Info("The page is stored with the next block")
+	}
+	for _, add := range resp.Adds {
+		log.Info("Additional resource:", add)
+	}
+	if resp.QueuePosition > 0 {
+		log.Info("The save waited behind", resp.QueuePosition, "other saves")
+	}
+	for _, e := range resp.Errors {
+		log.Warn("Conode", e.ConodeID, "failed in", e.Phase+":", e.Message)
+	}
+	if d := resp.Divergence; d != nil {
+		log.Info("Dropped", d.Dropped, "of the", d.Leaves, "leaves of the website, threshold", d.Threshold, "of", d.Conodes, "conodes,", d.FailedConodes, "failed")
+		for _, r := range d.Reasons {
+			log.Info(" ", r.Leaves, "leaves", r.Reason)
+		}
+	}
+	if client.IncludeProof {
+		return writeProof(resp.Proof, c.String("proof-out"))
+	}
+	return nil
+}
+
+// writeProof pretty-prints the transcript of the consensus in the file out, or
+// on the standard output if out is empty
+func writeProof(raw []byte, out string) error {
+	proof, err := archive.DecodeProof(raw)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(proof, "", "  ")
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		fmt.Println(string(b))
+		return nil
+	}
+	if err := ioutil.WriteFile(out, b, 0644); err != nil {
+		return err
+	}
+	log.Lvl1("Transcript of the consensus written in", out)
+	return nil
+}
+
+// setup everything is needed for DecenArch to work properly, namely the
+// skipchain service and the DKG protocol
+func cmdStart(c *cli.Context) error {
+	group := readGroup(c)
+	authorized := make([]kyber.Point, 0)
+	for _, k := range c.StringSlice("authorize") {
+		public, err := encoding.StringHexToPoint(decenarch.Suite, k)
+		log.ErrFatal(err, "Invalid public key", k)
+		authorized = append(authorized, public)
+	}
+	client := decenarch.NewClient()
+	if c.String("key") != "" {
+		kp, err := readKeyPair(c.String("key"))
+		log.ErrFatal(err, "Couldn't read private key")
+		client = decenarch.NewSignedClient(kp)
+	}
+	client.FalsePositiveRate = c.Float64("fprate")
+	client.BlockInterval = c.Int64("interval")
+	client.ForceSetup = c.Bool("force")
+	client.Scheme = c.String("scheme")
+	client.Namespace = c.String("namespace")
+	headers, err := parseHeaders(c.StringSlice("fetch-header"))
+	if err != nil {
+		return err
+	}
+	client.SetupHeaders = headers
+	resp, err := client.Setup(group.Roster, authorized...)
+	if err != nil {
+		log.Fatal("When asking to start the DKG protocol", err)
+	}
+	log.Info("Skipchain started and DKG protocol went well with key", resp)
+	return nil
+}
+
+// Generates a key pair to sign save requests
+func cmdKeygen(c *cli.Context) error {
+	kp := key.NewKeyPair(decenarch.Suite)
+	private, err := encoding.ScalarToStringHex(decenarch.Suite, kp.Private)
+	if err != nil {
+		return err
+	}
+	public, err := encoding.PointToStringHex(decenarch.Suite, kp.Public)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Private:", private)
+	fmt.Println("Public: ", public)
+	return nil
+}
+
+// readKeyPair reads the hex encoded private key stored in the given file and
+// returns the corresponding key pair
+func readKeyPair(name string) (*key.Pair, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	private, err := encoding.StringHexToScalar(decenarch.Suite, strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, err
+	}
+	return &key.Pair{
+		Public:  decenarch.Suite.Point().Mul(private, nil),
+		Private: private,
+	}, nil
+}
+
+// readTemplate returns the request template given by the flags of the save
+// command, nil if the page is fetched with a plain GET request
+func readTemplate(c *cli.Context) (*decenarch.RequestTemplate, error) {
+	if c.String("method") == "" && c.String("body") == "" && len(c.StringSlice("header")) == 0 {
+		return nil, nil
+	}
+	t := &decenarch.RequestTemplate{
+		Method:  strings.ToUpper(c.String("method")),
+		Secrets: c.StringSlice("secret"),
+	}
+	if c.String("body") != "" {
+		body, err := ioutil.ReadFile(c.String("body"))
+		if err != nil {
+			return nil, err
+		}
+		t.Body = body
+	}
+	if t.Method == "" {
+		t.Method = "GET"
+		if len(t.Body) > 0 {
+			t.Method = "POST"
+		}
+	}
+	headers, err := parseHeaders(c.StringSlice("header"))
+	if err != nil {
+		return nil, err
+	}
+	t.Headers = headers
+	return t, t.Validate()
+}
+
+// parseHeaders returns the headers given as Name: value, nil if there are
+// none
+func parseHeaders(list []string) (map[string]string, error) {
+	var headers map[string]string
+	for _, h := range list {
+		i := strings.Index(h, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid header %q, expected Name: value", h)
+		}
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[strings.TrimSpace(h[:i])] = strings.TrimSpace(h[i+1:])
+	}
+	return headers, nil
+}
+
+// Asks the conodes to prune the pages older than the given number of days
+func cmdPrune(c *cli.Context) error {
+	days := c.Int("days")
+	if days <= 0 || c.String("private") == "" {
+		log.Fatal("Please provide the age of the pages to prune and a conode with prune --days [days] --private [private.toml]")
+	}
+	group := readGroup(c)
+	si, private, err := readPrivate(c.String("private"))
+	log.ErrFatal(err, "Couldn't read private configuration")
+	before := time.Now().AddDate(0, 0, -days)
+	client := decenarch.NewClient()
+	client.Namespace = c.String("namespace")
+	conodes, err := client.Prune(si, private, group.Roster, before)
+	if err != nil {
+		log.Fatal("When asking to prune the pages:", explain(err))
+	}
+	log.Info("Pruning of the pages stored before", before.Format("2006/01/02 15:04"), "propagated to", conodes, "conodes")
+	return nil
+}
+
+// Stores the pages pending on the conodes without waiting for the block
+// interval
+func cmdFlush(c *cli.Context) error {
+	group := readGroup(c)
+	pages, err := decenarch.NewClient().Flush(group.Roster)
+	if err != nil {
+		log.Fatal("When asking to flush the pending pages:", explain(err))
+	}
+	log.Info(pages, "pending pages stored in the skipchain")
+	return nil
+}
+
+// Registers the webhook on every conode of the group, as each conode sends
+// the events of the saves it leads
+func cmdSubscribe(c *cli.Context) error {
+	if c.String("url") == "" {
+		log.Fatal("Please provide the webhook with subscribe -u [url]")
+	}
+	group := readGroup(c)
+	client := decenarch.NewClient()
+	if c.String("key") != "" {
+		kp, err := readKeyPair(c.String("key"))
+		log.ErrFatal(err, "Couldn't read private key")
+		client = decenarch.NewSignedClient(kp)
+	}
+	for _, si := range group.Roster.List {
+		id, err := client.Subscribe(si, c.String("url"), c.StringSlice("event")...)
+		if err != nil {
+			log.Fatal("When subscribing to", si.Address, ":", explain(err))
+		}
+		log.Infof("%s: subscription %s", si.Address, id)
+	}
+	return nil
+}
+
+// Removes the subscription from the conodes of the group knowing it
+func cmdUnsubscribe(c *cli.Context) error {
+	if c.String("id") == "" {
+		log.Fatal("Please provide the subscription with unsubscribe --id [id]")
+	}
+	group := readGroup(c)
+	client := decenarch.NewClient()
+	removed := 0
+	for _, si := range group.Roster.List {
+		if err := client.Unsubscribe(si, c.String("id")); err == nil {
+			removed++
+		}
+	}
+	if removed == 0 {
+		log.Fatal("No conode knows the subscription", c.String("id"))
+	}
+	log.Info("Subscription removed from", removed, "conodes")
+	return nil
+}
+
+// Adds or removes a feed watched by the first conode of the group, and prints
+// the feeds it watches
+func cmdFeed(c *cli.Context) error {
+	group := readGroup(c)
+	dst := group.Roster.List[0]
+	client := decenarch.NewClient()
+	if c.String("key") != "" {
+		kp, err := readKeyPair(c.String("key"))
+		log.ErrFatal(err, "Couldn't read private key")
+		client = decenarch.NewSignedClient(kp)
+	}
+	var feeds []decenarch.FeedStatus
+	var err error
+	switch {
+	case c.String("url") == "":
+		feeds, err = client.Feeds(dst)
+	case c.Bool("remove"):
+		feeds, err = client.UnwatchFeed(dst, c.String("url"))
+	default:
+		feeds, err = client.WatchFeed(dst, c.String("url"), c.Duration("interval"))
+	}
+	if err != nil {
+		log.Fatal("When asking", dst.Address, "for its feeds:", explain(err))
+	}
+	for _, f := range feeds {
+		log.Infof("%s: every %ds, last poll: %s, %d entries saved", f.Url, f.Interval, f.LastPoll, f.Saved)
+		if f.Error != "" {
+			log.Warn(f.Url, "failed:", f.Error)
+		}
+	}
+	return nil
+}
+
+// Mirrors in the skipchain of the group the blocks of the archive of the
+// origin group not mirrored yet
+func cmdMirror(c *cli.Context) error {
+	if c.String("origin") == "" || c.String("private") == "" {
+		log.Fatal("Please provide the mirrored cothority and a conode with mirror --origin [group] --private [private.toml]")
+	}
+	group := readGroup(c)
+	origin := readGroupFile(c.String("origin"))
+	originID := readGenesis(origin)
+	si, private, err := readPrivate(c.String("private"))
+	log.ErrFatal(err, "Couldn't read private configuration")
+	client := decenarch.NewClient()
+	client.Namespace = c.String("namespace")
+	blocks, err := client.Mirror(si, private, group.Roster, origin.Roster, originID)
+	if err != nil {
+		log.Fatal("When mirroring the archive:", explain(err))
+	}
+	log.Info(blocks, "blocks mirrored")
+	return nil
+}
+
+// Prints the status of all the conodes of the roster
+func cmdStatus(c *cli.Context) error {
+	group := readGroup(c)
+	client := decenarch.NewClient()
+	resp, err := client.Status(group.Roster)
+	if err != nil {
+		log.Fatal("When asking the status of the conodes:", err)
+	}
+	if c.Bool("json") {
+		out := make([]statusOutput, len(resp.Conodes))
+		for i, st := range resp.Conodes {
+			out[i] = statusOutput{
+				Address:     st.Address,
+				Reachable:   st.Reachable,
+				Error:       st.Error,
+				KeyPresent:  st.KeyPresent,
+				ShareIndex:  st.ShareIndex,
+				GenesisID:   hex.EncodeToString(st.GenesisID),
+				LatestID:    hex.EncodeToString(st.LatestID),
+				StorageSize: st.StorageSize,
+				LastSave:    st.LastSave,
+				Topology:    st.Topology,
+				Interrupted: st.Interrupted,
+
+				RunningSaves: st.RunningSaves,
+				QueuedSaves:  st.QueuedSaves,
+				Verification: st.Verification,
+			}
+		}
+		return printJSON(out)
+	}
+	for _, st := range resp.Conodes {
+		if !st.Reachable {
+			log.Infof("%s: unreachable (%s)", st.Address, st.Error)
+			continue
+		}
+		log.Infof("%s: key present: %t, share index: %d, genesis: %x, latest block: %x, storage: %d bytes, last save: %s",
+			st.Address, st.KeyPresent, st.ShareIndex, st.GenesisID, st.LatestID, st.StorageSize, st.LastSave)
+		if st.Topology != "" {
+			log.Infof("%s: last tree: %s", st.Address, st.Topology)
+		}
+		if st.RunningSaves > 0 || st.QueuedSaves > 0 {
+			log.Infof("%s: %d saves running, %d waiting", st.Address, st.RunningSaves, st.QueuedSaves)
+		}
+		for _, e := range st.Interrupted {
+			log.Infof("%s: save of %s started at %s %s", st.Address, e.Url, e.Started, e.Outcome)
+		}
+		if v := st.Verification; v != nil && v.Rounds > 0 {
+			log.Infof("%s: %d blocks verified again, %d corrupted, %d unverifiable, last round: %s",
+				st.Address, v.Checked, v.Corrupted, v.Unverifiable, v.LastRound)
+			for _, f := range v.Failures {
+				log.Infof("%s: block %d (%x) failed its verification at %s: %s", st.Address, f.Index, f.BlockID, f.Time, f.Reason)
+			}
+		}
+	}
+	return nil
+}
+
+// Prints the setup of every conode of the group and checks that they agree on
+// the key, the genesis block, the signature scheme and the roster
+func cmdSetupInfo(c *cli.Context) error {
+	group := readGroup(c)
+	client := decenarch.NewClient()
+	client.Namespace = c.String("namespace")
+	var first *decenarch.SetupInfoResponse
+	consistent := true
+	for _, si := range group.Roster.List {
+		info, err := client.GetSetupInfo(si)
+		if err != nil {
+			log.Infof("%s: %s", si.Address, explain(err))
+			consistent = false
+			continue
+		}
+		log.Infof("%s: key %s, genesis %x, threshold %d, scheme %s", si.Address, info.Key, info.GenesisID, info.Threshold, info.Scheme)
+		if info.Roster != nil && !sameConodes(info.Roster, group.Roster) {
+			log.Infof("%s: set up with another roster", si.Address)
+			consistent = false
+		}
+		if first == nil {
+			first = info
+		} else if !first.Key.Equal(info.Key) || !bytes.Equal(first.GenesisID, info.GenesisID) || first.Scheme != info.Scheme {
+			consistent = false
+		}
+	}
+	if !consistent {
+		return errors.New("the conodes do not agree on the setup")
+	}
+	log.Info("The conodes agree on the setup")
+	return nil
+}
+
+// Prints the collective key of the conodes of the group, checks that they
+// agree on it and that it was created for the roster of the group, and
+// compares it to the pinned key if any
+func cmdKey(c *cli.Context) error {
+	group := readGroup(c)
+	client := decenarch.NewClient()
+	var key *keyOutput
+	for _, si := range group.Roster.List {
+		resp, err := client.GetPublicKey(si)
+		if err != nil {
+			info(c, fmt.Sprintf("%s: %s", si.Address, explain(err)))
+			continue
+		}
+		public, err := encoding.PointToStringHex(decenarch.Suite, resp.Key)
+		if err != nil {
+			return err
+		}
+		out := &keyOutput{Key: public, Created: resp.Created, RosterHash: hex.EncodeToString(resp.RosterHash)}
+		if key == nil {
+			key = out
+		} else if key.Key != out.Key || key.RosterHash != out.RosterHash {
+			return fmt.Errorf("%s reports another key than the other conodes", si.Address)
+		}
+		if out.Created > key.Created {
+			key.Created = out.Created
+		}
+	}
+	if key == nil {
+		return errors.New("no conode of the group returned its key")
+	}
+	if key.RosterHash != "" && key.RosterHash != hex.EncodeToString(decenarch.RosterHash(group.Roster)) {
+		return errors.New("the key was created for another roster than the one of the group")
+	}
+	if pin := c.String("pin"); pin != "" {
+		if err := checkPinnedKey(pin, key); err != nil {
+			return err
+		}
+	}
+	if c.Bool("json") {
+		return printJSON(key)
+	}
+	created := "unknown"
+	if key.Created != 0 {
+		created = time.Unix(key.Created, 0).Format(time.RFC3339)
+	}
+	log.Info("Collective key:", key.Key)
+	log.Info("Created:", created)
+	log.Info("Roster hash:", key.RosterHash)
+	return nil
+}
+
+// checkPinnedKey returns an error if the key differs from the key pinned in
+// the file, and pins the key if the file doesn't exist
+func checkPinnedKey(file string, key *keyOutput) error {
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		b, err := json.MarshalIndent(key, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(file, b, 0644)
+	} else if err != nil {
+		return err
+	}
+	pinned := &keyOutput{}
+	if err := json.Unmarshal(b, pinned); err != nil {
+		return err
+	}
+	if pinned.Key != key.Key || pinned.RosterHash != key.RosterHash {
+		return fmt.Errorf("the key of the conodes differs from the key pinned in %s: the key or the roster was substituted, or the conodes ran a new setup", file)
+	}
+	return nil
+}
+
+// sameConodes returns true if both rosters list the same conodes in the same
+// order
+func sameConodes(a, b *onet.Roster) bool {
+	if len(a.List) != len(b.List) {
+		return false
+	}
+	for i := range a.List {
+		if !a.List[i].Equal(b.List[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// adminCommand returns the cli command sending the given admin command to the
+// conode whose private configuration is given
+func adminCommand(name, usage string) cli.Command {
+	return cli.Command{
+		Name:      name,
+		Usage:     usage,
+		ArgsUsage: "the private.toml of the conode",
+		Action: func(c *cli.Context) error {
+			return cmdAdmin(c, name)
+		},
+	}
+}
+
+// namespaceAdminCommand is adminCommand for the commands about the archive of
+// a namespace, given as argument of the command
+func namespaceAdminCommand(name, usage string) cli.Command {
+	cmd := adminCommand(name, usage)
+	cmd.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "namespace",
+			Usage: "Provide the namespace of the archive, empty for the default archive",
+		},
+	}
+	return cmd
+}
+
+// Sends an admin command to a conode, signed with its private key
+func cmdAdmin(c *cli.Context, command string) error {
+	if c.NArg() != 1 {
+		log.Fatal("Please give the private.toml of the conode as argument")
+	}
+	si, private, err := readPrivate(c.Args().First())
+	log.ErrFatal(err, "Couldn't read private configuration")
+	client := decenarch.NewClient()
+	var argument []byte
+	if ns := c.String("namespace"); ns != "" {
+		argument = []byte(ns)
+	}
+	resp, err := client.AdminWithArgument(si, private, command, argument)
+	if err != nil {
+		log.Fatal("When sending admin command", command, ":", err)
+	}
+	log.Info(resp.Output)
+	return nil
+}
+
+// Exports the encrypted backup of the DKG share of a conode. The conode seals
+// the share to a transport key of this command, which encrypts the backup
+// with the passphrase: the passphrase never leaves this machine.
+func cmdExportSecret(c *cli.Context) error {
+	if c.String("out") == "" {
+		log.Fatal("Please provide the file of the backup with --out")
+	}
+	si, private := readSecretPrivate(c)
+	passphrase, err := readPassphrase()
+	if err != nil {
+		return err
+	}
+	if len(passphrase) < lib.MinPassphraseLength {
+		return fmt.Errorf("the passphrase must have at least %d characters", lib.MinPassphraseLength)
+	}
+	transport := key.NewKeyPair(decenarch.Suite)
+	recipient, err := encoding.PointToStringHex(decenarch.Suite, transport.Public)
+	if err != nil {
+		return err
+	}
+	arg, err := json.Marshal(&decenarch.SecretBackupArgument{Recipient: recipient})
+	if err != nil {
+		return err
+	}
+	client := decenarch.NewClient()
+	resp, err := client.AdminWithArgument(si, private, decenarch.AdminExportSecret, arg)
+	if err != nil {
+		return err
+	}
+	exported := &decenarch.SecretBackupArgument{}
+	if err := json.Unmarshal([]byte(resp.Output), exported); err != nil {
+		return err
+	}
+	content, err := lib.OpenSealed(transport.Private, exported.Sealed)
+	if err != nil {
+		return err
+	}
+	backup, err := lib.EncryptBackup(passphrase, exported.Key, exported.Index, content)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(c.String("out"), []byte(backup), 0600); err != nil {
+		return err
+	}
+	log.Info("Backup of the DKG share written to", c.String("out"))
+	return nil
+}
+
+// Restores the DKG share of a conode from its encrypted backup. The backup is
+// decrypted with the passphrase on this machine and sent sealed to a
+// transport key of the conode.
+func cmdImportSecret(c *cli.Context) error {
+	if c.String("backup") == "" {
+		log.Fatal("Please provide the file of the backup with --backup")
+	}
+	backup, err := ioutil.ReadFile(c.String("backup"))
+	if err != nil {
+		return err
+	}
+	si, private := readSecretPrivate(c)
+	passphrase, err := readPassphrase()
+	if err != nil {
+		return err
+	}
+	content, collective, index, err := lib.DecryptBackup(passphrase, string(backup))
+	if err != nil {
+		return err
+	}
+	client := decenarch.NewClient()
+	resp, err := client.Admin(si, private, decenarch.AdminBackupKey)
+	if err != nil {
+		return err
+	}
+	transport, err := encoding.StringHexToPoint(decenarch.Suite, resp.Output)
+	if err != nil {
+		return err
+	}
+	sealed, err := lib.SealTo(transport, content)
+	if err != nil {
+		return err
+	}
+	arg, err := json.Marshal(&decenarch.SecretBackupArgument{Key: collective, Index: index, Sealed: sealed})
+	if err != nil {
+		return err
+	}
+	resp, err = client.AdminWithArgument(si, private, decenarch.AdminImportSecret, arg)
+	if err != nil {
+		return err
+	}
+	log.Info(resp.Output)
+	return nil
+}
+
+// readSecretPrivate returns the identity and the private key of the conode
+// whose private configuration is given to the secret commands
+func readSecretPrivate(c *cli.Context) (*network.ServerIdentity, kyber.Scalar) {
+	if c.NArg() != 1 {
+		log.Fatal("Please give the private.toml of the conode as argument")
+	}
+	si, private, err := readPrivate(c.Args().First())
+	log.ErrFatal(err, "Couldn't read private configuration")
+	return si, private
+}
+
+// readPassphrase returns the passphrase of the backups, read from the
+// DECENARCH_PASSPHRASE environment variable or from the terminal
+func readPassphrase() (string, error) {
+	if p := os.Getenv("DECENARCH_PASSPHRASE"); p != "" {
+		return p, nil
+	}
+	fmt.Fprint(os.Stderr, "Passphrase of the backup: ")
+	p, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return string(p), err
+}
+
+// explain returns the message of an error of the service, followed by what
+// the user can do about it when the error is a typed error of decenarch
+func explain(err error) string {
+	switch e := err.(type) {
+	case *decenarch.ErrFetchFailed:
+		return e.Error() + "\nCheck that " + e.URL + " is reachable from the conodes"
+	case *decenarch.SignatureTimeoutError:
+		return e.Error() + "\nThe replaced subleaders may be offline, check them with the status command"
+	case *decenarch.CodedError:
+		switch e {
+		case decenarch.ErrNoSetup:
+			return e.Error() + "\nRun skipstart with the group-file first"
+		case decenarch.ErrConsensusThreshold:
+			return e.Error() + "\nThe page may differ between the conodes or some conodes may be offline, try again later"
+		case decenarch.ErrSignatureTimeout:
+			return e.Error() + "\nSome conodes may be offline, check them with the status command"
+		case decenarch.ErrBlockNotFound:
+			return e.Error() + "\nThe page was not saved before this time, list its versions with the history command"
+		case decenarch.ErrRedirectConsensus:
+			return e.Error() + "\nThe page may depend on the location of the conodes, try to save its final URL"
+		case decenarch.ErrQueueFull:
+			return e.Error() + "\nThe conode is busy, try again later or ask another conode of the roster"
+		}
+	}
+	return err.Error()
+}
+
+// readPrivate reads the private.toml of a conode and returns its server
+// identity and its private key
+func readPrivate(name string) (*network.ServerIdentity, kyber.Scalar, error) {
+	config := &struct {
+		Address string
+		Public  string
+		Private string
+	}{}
+	if _, err := toml.DecodeFile(name, config); err != nil {
+		return nil, nil, err
+	}
+	public, err := encoding.StringHexToPoint(decenarch.Suite, config.Public)
+	if err != nil {
+		return nil, nil, err
+	}
+	private, err := encoding.StringHexToScalar(decenarch.Suite, config.Private)
+	if err != nil {
+		return nil, nil, err
+	}
+	return network.NewServerIdentity(public, network.Address(config.Address)), private, nil
+}
+
+func readGroup(c *cli.Context) *app.Group {
+	if c.NArg() != 1 {
+		log.Fatal("Please give the group-file as argument")
+	}
+	group := readGroupFile(c.Args().First())
+	log.ErrFatal(checkTrust(c, c.Args().First(), group), "Untrusted group")
+	return group
+}
+
+// readGroupFile reads the group definition file name
+func readGroupFile(name string) *app.Group {
+	f, err := os.Open(name)
+	log.ErrFatal(err, "Couldn't open group definition file")
+	group, err := app.ReadGroupDescToml(f)
+	log.ErrFatal(err, "Error while reading group definition file", err)
 	if len(group.Roster.List) == 0 {
 		log.ErrFatalf(err, "Empty entity or invalid group defintion in: %s",
 			name)
@@ -207,81 +1679,34 @@ func storeWebPageOnDisk(mUrl string, bData []byte) (string, error) {
 // getFolderAndFilePath parses the URL and returns the corresponding folter
 // path and file path.  Example: url==http://my.example.ext/folder/file.fext
 // will return $cachePath/ext/example/my/folder as folder path and file.fext as
-// filename
+// filename. The internationalized domains are stored under their punycode
+// form, see lib.ASCIIHost, and the paths under their UTF-8 form. The hash of
+// the canonical query is added to the file name before its extension, see
+// queryHash, and all the components are sanitized, see cachepath.go.
 func getFolderAndFilePath(url string) (string, string, error) {
 	u, err := urlpkg.Parse(url)
 	if err != nil {
 		return "", "", err
 	}
+	host := lib.ASCIIHost(u.Hostname())
+	if port := u.Port(); port != "" {
+		host += ":" + port
+	}
 	var urlDir string
-	for _, dom := range strings.Split(u.Host, ".") {
+	for _, dom := range strings.Split(host, ".") {
 		urlDir = dom + "/" + urlDir
 	}
 	locDir, locFile := path.Split(u.Path)
 	if locFile == "" {
 		locFile = "index.html"
 	}
-	folderPath := path.Join(cachePath, urlDir, locDir)
-	filePath := path.Join(folderPath, locFile)
-
-	return folderPath, filePath, nil
-}
-
-// changeImgSrc iterates over the entire HTML document and changes
-// the sources of the images to use the images stored on disk
-// when retrieving a web page with deceanrch
-func changeImgSrc(bData []byte, url string) ([]byte, error) {
-	r := bytes.NewReader(bData)
-	doc, err := html.Parse(r)
-	if err != nil {
-		return nil, err
-	}
-
-	// parse and modify html document
-	err = changeNodeImgSrc(doc, url)
-	if err != nil {
-		return nil, err
-	}
-
-	// render modified html document
-	var b bytes.Buffer
-	err = html.Render(&b, doc)
-	if err != nil {
-		return nil, err
-	}
-
-	return b.Bytes(), err
-}
-
-// changeNodeImgSrc is an helper function of changeImgSrc and it changes the
-// source of a given HTML node from internet address to local address, if
-// needed
-func changeNodeImgSrc(n *html.Node, url string) error {
-	var err error
-	if n.Type == html.ElementNode && n.Data == "img" {
-		for i, a := range n.Attr {
-			if a.Key == "src" {
-				newSrc := ""
-				if strings.Contains(a.Val, "http") {
-					_, newSrc, err = getFolderAndFilePath(a.Val)
-				} else {
-					_, newSrc, err = getFolderAndFilePath(url + "/" + a.Val)
-				}
-				if err != nil {
-					return err
-				}
-				log.Lvlf4("Imgage source changed from %v to %v", a.Val, newSrc)
-				n.Attr[i].Val = newSrc
-				break
-			}
-		}
-
-	}
-
-	// recursively change children
-	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		changeNodeImgSrc(c, url)
+	if h := queryHash(url, u.RawQuery); h != "" {
+		ext := path.Ext(locFile)
+		locFile = strings.TrimSuffix(locFile, ext) + "_" + h + ext
 	}
+	folder := append([]string{cachePath}, sanitizePath(urlDir+locDir)...)
+	folderPath := filepath.Join(folder...)
+	filePath := filepath.Join(folderPath, sanitizeComponent(locFile))
 
-	return nil
+	return folderPath, filePath, nil
 }
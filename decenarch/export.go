@@ -0,0 +1,232 @@
+package main
+
+/*
+The export.go defines the single file export of a retrieved page, so that the
+users get one portable file per snapshot instead of a directory tree under
+the cache directory. The page is exported either as a self-contained HTML
+file, whose additional resources are inlined as data URIs, or as a MHTML
+file holding the page and its additional resources.
+*/
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	urlpkg "net/url"
+
+	"golang.org/x/net/html"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/urfave/cli.v1"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/protocol"
+)
+
+// formats of the single file export
+const (
+	formatHTML  = "html"
+	formatMHTML = "mhtml"
+)
+
+// exportPage returns the retrieved page as a single file in the given format
+func exportPage(resp *decenarch.RetrieveResponse, format string) ([]byte, error) {
+	switch format {
+	case formatHTML, "":
+		return exportHTML(resp)
+	case formatMHTML:
+		return exportMHTML(resp)
+	default:
+		return nil, fmt.Errorf("unknown export format %s, use %s or %s", format, formatHTML, formatMHTML)
+	}
+}
+
+// inliner inlines the additional resources of a page as data URIs
+//    - resources are the additional resources, by url
+//    - visiting are the style sheets being inlined, so that style sheets
+//      importing each other are not inlined forever
+type inliner struct {
+	resources map[string]decenarch.Webstore
+	visiting  map[string]bool
+}
+
+// newInliner returns an inliner of the additional resources of resp
+func newInliner(resp *decenarch.RetrieveResponse) *inliner {
+	in := &inliner{
+		resources: make(map[string]decenarch.Webstore),
+		visiting:  make(map[string]bool),
+	}
+	for _, add := range resp.Adds {
+		in.resources[canonical(add.Url)] = add
+	}
+	return in
+}
+
+// dataURI returns the data URI of the resource at url, false if the resource
+// is not archived with the page. The links of the style sheets are inlined
+// too.
+func (in *inliner) dataURI(url string) (string, bool) {
+	res, ok := in.resources[url]
+	if !ok || in.visiting[url] {
+		return "", false
+	}
+	content, err := base64.StdEncoding.DecodeString(res.Page)
+	if err != nil {
+		return "", false
+	}
+	contentType := contentTypeOf(res, content)
+	if strings.HasPrefix(contentType, "text/css") {
+		base, err := urlpkg.Parse(url)
+		if err != nil {
+			return "", false
+		}
+		in.visiting[url] = true
+		rw := &linkRewriter{base: base, inline: in}
+		content = []byte(rw.css(string(content)))
+		delete(in.visiting, url)
+	}
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(content), true
+}
+
+// exportHTML returns the page with its additional resources inlined as data
+// URIs. The links to other pages are absolute.
+func exportHTML(resp *decenarch.RetrieveResponse) ([]byte, error) {
+	page, base, err := decodeMain(resp)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+	rw := &linkRewriter{base: base, inline: newInliner(resp)}
+	return rw.render(doc)
+}
+
+// exportMHTML returns the page and its additional resources as a MHTML file,
+// the links are resolved by the browsers with the Content-Location of the
+// parts
+func exportMHTML(resp *decenarch.RetrieveResponse) ([]byte, error) {
+	page, _, err := decodeMain(resp)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: <Saved by decenarch>\r\n")
+	fmt.Fprintf(&b, "Snapshot-Content-Location: %s\r\n", resp.Main.Url)
+	fmt.Fprintf(&b, "Subject: %s\r\n", resp.Main.Url)
+	if t, err := time.Parse("2006/01/02 15:04", resp.Main.Timestamp); err == nil {
+		fmt.Fprintf(&b, "Date: %s\r\n", t.Format(time.RFC1123Z))
+	}
+	fmt.Fprintf(&b, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/related;\r\n\ttype=\"text/html\";\r\n\tboundary=\"%s\"\r\n\r\n", w.Boundary())
+
+	if err := writePart(w, resp.Main.Url, contentTypeOf(resp.Main, page), page); err != nil {
+		return nil, err
+	}
+	for _, add := range resp.Adds {
+		// the inline blobs are already put back in the page
+		if protocol.IsInline(add.Url) {
+			continue
+		}
+		content, err := base64.StdEncoding.DecodeString(add.Page)
+		if err != nil {
+			return nil, err
+		}
+		if err := writePart(w, add.Url, contentTypeOf(add, content), content); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	b.Write(body.Bytes())
+	return b.Bytes(), nil
+}
+
+// writePart writes a base64 encoded part of a MHTML file
+func writePart(w *multipart.Writer, url, contentType string, content []byte) error {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Transfer-Encoding", "base64")
+	h.Set("Content-Location", url)
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(content)
+	// the lines of a MIME part must not be longer than 76 characters
+	for len(encoded) > 76 {
+		if _, err := part.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = part.Write([]byte(encoded + "\r\n"))
+	return err
+}
+
+// decodeMain returns the content, with its inline blobs put back, and the url
+// of the main page
+func decodeMain(resp *decenarch.RetrieveResponse) ([]byte, *urlpkg.URL, error) {
+	if resp == nil || resp.Main.Url == "" {
+		return nil, nil, errors.New("no page to export")
+	}
+	page, err := base64.StdEncoding.DecodeString(resp.Main.Page)
+	if err != nil {
+		return nil, nil, err
+	}
+	page, err = protocol.RestoreInline(page, resp.Adds)
+	if err != nil {
+		return nil, nil, err
+	}
+	base, err := urlpkg.Parse(resp.Main.Url)
+	if err != nil {
+		return nil, nil, err
+	}
+	return page, base, nil
+}
+
+// contentTypeOf returns the content type of the page, sniffed from its
+// content if it was not stored with the page
+func contentTypeOf(page decenarch.Webstore, content []byte) string {
+	if page.ContentType != "" {
+		return page.ContentType
+	}
+	return http.DetectContentType(content)
+}
+
+// exportRetrieved writes the retrieved page as a single file at path. The
+// page is verified against signing, the roster that signed it, unverified if
+// it is nil
+func exportRetrieved(c *cli.Context, signing *onet.Roster, resp *decenarch.RetrieveResponse, path string) error {
+	b, err := exportPage(resp, c.String("format"))
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(&retrieveOutput{
+			Url:       resp.Main.Url,
+			Timestamp: resp.Main.Timestamp,
+			Path:      path,
+			Verified:  signing != nil && verifyPage(signing, resp.Main) == nil,
+			Adds:      []resourceOutput{},
+		})
+	}
+	log.Info("Website", resp.Main.Url, "exported in", path)
+	return nil
+}
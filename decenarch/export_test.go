@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func exportResponse() *decenarch.RetrieveResponse {
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	return &decenarch.RetrieveResponse{
+		Main: decenarch.Webstore{
+			Url:         "http://www.example.com/index.html",
+			ContentType: "text/html; charset=utf-8",
+			Page:        encode(`<html><head><link rel="stylesheet" href="main.css"></head><body><img src="a.png"><a href="other.html">o</a></body></html>`),
+			Timestamp:   "2018/06/01 12:00",
+		},
+		Adds: []decenarch.Webstore{
+			{Url: "http://www.example.com/main.css", ContentType: "text/css", Page: encode(`body { background: url(bg.png); }`)},
+			{Url: "http://www.example.com/a.png", ContentType: "image/png", Page: encode("png")},
+			{Url: "http://www.example.com/bg.png", ContentType: "image/png", Page: encode("bg")},
+		},
+	}
+}
+
+func TestExportHTML(t *testing.T) {
+	b, err := exportPage(exportResponse(), formatHTML)
+	require.NoError(t, err)
+	out := string(b)
+
+	require.Contains(t, out, `src="data:image/png;base64,`+base64.StdEncoding.EncodeToString([]byte("png"))+`"`)
+	require.Contains(t, out, `href="http://www.example.com/other.html"`)
+	// the links of the style sheet are inlined too
+	css := `body { background: url("data:image/png;base64,` + base64.StdEncoding.EncodeToString([]byte("bg")) + `"); }`
+	require.Contains(t, out, `href="data:text/css;base64,`+base64.StdEncoding.EncodeToString([]byte(css))+`"`)
+
+	_, err = exportPage(exportResponse(), "pdf")
+	require.Error(t, err)
+}
+
+func TestExportMHTML(t *testing.T) {
+	b, err := exportPage(exportResponse(), formatMHTML)
+	require.NoError(t, err)
+	out := string(b)
+
+	require.True(t, strings.HasPrefix(out, "From: <Saved by decenarch>\r\n"))
+	require.Contains(t, out, "Snapshot-Content-Location: http://www.example.com/index.html\r\n")
+	require.Contains(t, out, "multipart/related")
+	require.Equal(t, 4, strings.Count(out, "\r\nContent-Location: "))
+	require.Contains(t, out, "Content-Location: http://www.example.com/bg.png\r\n")
+}
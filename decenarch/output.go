@@ -0,0 +1,178 @@
+package main
+
+/*
+The output.go defines the JSON output of the commands, printed instead of
+the log lines when the --json flag is given, so that scripts can parse the
+results of the commands.
+*/
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/urfave/cli.v1"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/client/verify"
+	"github.com/dedis/student_18_decenar/pkg/archive"
+	skip "github.com/dedis/student_18_decenar/skip"
+)
+
+// saveOutput is the result of the save command
+type saveOutput struct {
+	Url       string
+	Timestamp string
+	PageHash  string
+	BlockID   string // empty if the page is stored with the next block
+	Adds      []string
+	Errors    []decenarch.NodeError `json:",omitempty"`
+	Proof     *archive.Proof        `json:",omitempty"`
+	// true if only the page was recorded unchanged since its last snapshot,
+	// whose content hash is PageHash
+	Unchanged bool `json:",omitempty"`
+	// number of saves that waited before this one on the conode
+	QueuePosition int `json:",omitempty"`
+	// the leaves dropped from the consensus page, with --diagnostics
+	Divergence *decenarch.DivergenceSummary `json:",omitempty"`
+}
+
+// resourceOutput is an additional resource stored by the retrieve command
+type resourceOutput struct {
+	Url  string
+	Path string
+}
+
+// retrieveOutput is the result of the retrieve command. Verified tells if the
+// collective signature of the page was checked against the group, it is
+// false for a page mirrored from another cothority. Signers are the addresses
+// of the conodes of the group that signed the page.
+type retrieveOutput struct {
+	Url       string
+	Timestamp string
+	Path      string
+	Verified  bool
+	Adds      []resourceOutput
+	Signers   []string `json:",omitempty"`
+}
+
+// historyOutput is a version of the page listed by the history command, only
+// the versions whose signature is valid are listed
+type historyOutput struct {
+	Url         string
+	Timestamp   string
+	ContentType string
+	PageHash    string `json:",omitempty"`
+}
+
+// auditOutput is a version of the page audited by the audit command, see
+// skip.TimelineEntry. Error is empty if its signature and its inclusion proof
+// are valid.
+type auditOutput struct {
+	Url       string
+	Timestamp string
+	PageHash  string
+	Index     int
+	BlockID   string
+	Mirrored  bool `json:",omitempty"`
+	Signers   []string
+	Conodes   int
+	Error     string `json:",omitempty"`
+}
+
+// newAuditOutput returns the output of the entry of the timeline
+func newAuditOutput(e skip.TimelineEntry) auditOutput {
+	o := auditOutput{
+		Url:       e.Page.Url,
+		Timestamp: e.Page.Timestamp,
+		PageHash:  e.PageHash,
+		Index:     e.Index,
+		BlockID:   hex.EncodeToString(e.BlockID),
+		Mirrored:  e.Mirrored,
+		Signers:   e.Signers,
+		Conodes:   e.Conodes,
+	}
+	if e.SignatureErr != nil {
+		o.Error = "invalid signature: " + e.SignatureErr.Error()
+	} else if e.ProofErr != nil {
+		o.Error = "invalid inclusion proof: " + e.ProofErr.Error()
+	}
+	return o
+}
+
+// variantOutput is a variant of the page listed by the variants command, see
+// skip.Variant
+type variantOutput struct {
+	Url       string
+	QueryHash string `json:",omitempty"`
+	Versions  int
+	Latest    string
+}
+
+// keyOutput is the collective key printed by the key command, and the key
+// pinned with --pin. Created is the unix time of the DKG, 0 if unknown.
+type keyOutput struct {
+	Key        string
+	Created    int64
+	RosterHash string
+}
+
+// statusOutput is the status of a conode listed by the status command
+type statusOutput struct {
+	Address     string
+	Reachable   bool
+	Error       string `json:",omitempty"`
+	KeyPresent  bool
+	ShareIndex  int
+	GenesisID   string
+	LatestID    string
+	StorageSize int
+	LastSave    string
+	Topology    string                   `json:",omitempty"`
+	Interrupted []decenarch.JournalEntry `json:",omitempty"`
+	// saves led by the conode that run and that wait
+	RunningSaves int
+	QueuedSaves  int
+	Verification *decenarch.VerificationStatus `json:",omitempty"`
+}
+
+// printJSON prints v as indented JSON on the standard output
+func printJSON(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+// info logs the informative lines of the commands, hidden with --json so that
+// the standard output only holds the JSON result
+func info(c *cli.Context, args ...interface{}) {
+	if !c.Bool("json") {
+		log.Info(args...)
+	}
+}
+
+// verifyPage returns an error if the page is not collectively signed by a
+// threshold of the roster
+func verifyPage(r *onet.Roster, page decenarch.Webstore) error {
+	_, err := verify.Page(r.Publics(), decenarch.Threshold(len(r.List)), page.Verifiable())
+	return err
+}
+
+// pageSigners returns the addresses of the conodes of the roster that signed
+// the page, from the participation mask of its signature
+func pageSigners(r *onet.Roster, page decenarch.Webstore) ([]string, error) {
+	indices, err := verify.Signers(r.Publics(), page.Verifiable())
+	if err != nil {
+		return nil, err
+	}
+	signers := make([]string, len(indices))
+	for i, index := range indices {
+		signers[i] = r.List[index].Address.String()
+	}
+	return signers, nil
+}
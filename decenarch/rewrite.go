@@ -0,0 +1,209 @@
+package main
+
+/*
+The rewrite.go defines how the links of a retrieved page are rewritten so
+that the copy stored in the cache directory is self-contained. The links to
+the resources archived with the page, and to the pages already stored in the
+cache directory, point to the local files with relative paths. The other
+links are made absolute, so that they still work from the cache directory.
+*/
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	urlpkg "net/url"
+
+	"golang.org/x/net/html"
+	"gopkg.in/dedis/onet.v2/log"
+
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// linkAttributes are the attributes holding a single link, by element
+var linkAttributes = map[string][]string{
+	"img":    {"src"},
+	"script": {"src"},
+	"link":   {"href"},
+	"a":      {"href"},
+	"iframe": {"src"},
+	"source": {"src"},
+	"video":  {"src", "poster"},
+	"audio":  {"src"},
+}
+
+// cssURL matches the url() of a style sheet
+var cssURL = regexp.MustCompile(`url\(\s*['"]?([^'")\s]+)['"]?\s*\)`)
+
+// linkRewriter rewrites the links of the page stored at pageURL
+//    - archived are the urls of the resources stored with the page
+//    - inline are the resources inlined as data URIs, if not nil the links
+//      are never rewritten to local files, see export.go
+type linkRewriter struct {
+	base     *urlpkg.URL
+	folder   string
+	archived map[string]bool
+	inline   *inliner
+}
+
+// rewriteLinks rewrites the links of the page at pageURL, see rewrite.go
+func rewriteLinks(bData []byte, pageURL string, archived map[string]bool) ([]byte, error) {
+	base, err := urlpkg.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	folder, _, err := getFolderAndFilePath(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(bytes.NewReader(bData))
+	if err != nil {
+		return nil, err
+	}
+	canonicalArchived := make(map[string]bool)
+	for url, ok := range archived {
+		canonicalArchived[canonical(url)] = ok
+	}
+	rw := &linkRewriter{base: base, folder: folder, archived: canonicalArchived}
+	return rw.render(doc)
+}
+
+// canonical returns the canonical form of url, see lib.URLNormalizer, so that
+// the links match the urls the resources are archived with
+func canonical(url string) string {
+	normalized, err := lib.NormalizeURL(url)
+	if err != nil {
+		return url
+	}
+	return normalized
+}
+
+// render rewrites the links of the document and renders it
+func (rw *linkRewriter) render(doc *html.Node) ([]byte, error) {
+	rw.node(doc)
+	var b bytes.Buffer
+	if err := html.Render(&b, doc); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// node rewrites the links of n and of its children
+func (rw *linkRewriter) node(n *html.Node) {
+	switch n.Type {
+	case html.ElementNode:
+		for i, a := range n.Attr {
+			switch {
+			case a.Key == "srcset":
+				n.Attr[i].Val = rw.srcset(a.Val)
+			case a.Key == "style":
+				n.Attr[i].Val = rw.css(a.Val)
+			case contains(linkAttributes[n.Data], a.Key):
+				// only the pages already stored are linked locally,
+				// the other resources must be archived with the page
+				n.Attr[i].Val = rw.link(a.Val, n.Data == "a")
+			}
+		}
+	case html.TextNode:
+		if n.Parent != nil && n.Parent.Type == html.ElementNode && n.Parent.Data == "style" {
+			n.Data = rw.css(n.Data)
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		rw.node(c)
+	}
+}
+
+// link returns the local path of the link if its target is archived with the
+// page, or stored in the cache directory for a link to another page, and the
+// absolute link otherwise
+func (rw *linkRewriter) link(link string, page bool) string {
+	link = strings.TrimSpace(link)
+	if link == "" || strings.HasPrefix(link, "#") {
+		return link
+	}
+	ref, err := urlpkg.Parse(link)
+	if err != nil {
+		return link
+	}
+	abs := rw.base.ResolveReference(ref)
+	if abs.Scheme != "http" && abs.Scheme != "https" {
+		return link
+	}
+	fragment := abs.Fragment
+	abs.Fragment = ""
+	target := canonical(abs.String())
+
+	if rw.inline != nil {
+		if uri, ok := rw.inline.dataURI(target); ok && !page {
+			return uri
+		}
+		return withFragment(target, fragment)
+	}
+	_, file, err := getFolderAndFilePath(target)
+	if err != nil {
+		return link
+	}
+	local := rw.archived[target]
+	if !local && page {
+		_, err := os.Stat(file)
+		local = err == nil
+	}
+	if !local {
+		return withFragment(target, fragment)
+	}
+	rel, err := filepath.Rel(rw.folder, file)
+	if err != nil {
+		return target
+	}
+	rel = filepath.ToSlash(rel)
+	log.Lvlf4("Link changed from %v to %v", link, rel)
+	return withFragment(rel, fragment)
+}
+
+// withFragment appends the fragment, if any, to the link
+func withFragment(link, fragment string) string {
+	if fragment == "" {
+		return link
+	}
+	return link + "#" + fragment
+}
+
+// srcset rewrites the links of a srcset attribute, a list of links followed
+// by an optional descriptor
+func (rw *linkRewriter) srcset(val string) string {
+	candidates := strings.Split(val, ",")
+	for i, c := range candidates {
+		fields := strings.Fields(c)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = rw.link(fields[0], false)
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// css rewrites the url() of a style sheet
+func (rw *linkRewriter) css(val string) string {
+	return cssURL.ReplaceAllStringFunc(val, func(m string) string {
+		link := cssURL.FindStringSubmatch(m)[1]
+		if strings.HasPrefix(link, "data:") {
+			return m
+		}
+		return "url(\"" + rw.link(link, false) + "\")"
+	})
+}
+
+// contains returns true if s is in list
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
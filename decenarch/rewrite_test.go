@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteLinks(t *testing.T) {
+	page := `<html><head>
+<link rel="stylesheet" href="/css/main.css">
+<script src="https://cdn.example.com/lib.js"></script>
+<style>body { background: url('img/bg.png'); }</style>
+</head><body>
+<img src="img/a.png" srcset="img/a.png 1x, img/a2.png 2x">
+<div style="background-image: url(&quot;data:image/png;base64,AA==&quot;)"></div>
+<a href="other.html#top">other</a>
+<a href="#local">local</a>
+<a href="mailto:me@example.com">mail</a>
+</body></html>`
+	archived := map[string]bool{
+		"http://www.example.com/blog/post.html":  true,
+		"http://www.example.com/css/main.css":    true,
+		"http://www.example.com/blog/img/a.png":  true,
+		"http://www.example.com/blog/img/bg.png": true,
+	}
+	b, err := rewriteLinks([]byte(page), "http://www.example.com/blog/post.html", archived)
+	require.NoError(t, err)
+	out := string(b)
+
+	// archived resources are relative to the folder of the page
+	require.Contains(t, out, `href="../css/main.css"`)
+	require.Contains(t, out, `src="img/a.png"`)
+	require.Contains(t, out, `srcset="img/a.png 1x, http://www.example.com/blog/img/a2.png 2x"`)
+	require.Contains(t, out, `url("img/bg.png")`)
+	// the other links are absolute
+	require.Contains(t, out, `src="https://cdn.example.com/lib.js"`)
+	require.Contains(t, out, `href="http://www.example.com/blog/other.html#top"`)
+	// fragments, data and other schemes are kept
+	require.Contains(t, out, `href="#local"`)
+	require.Contains(t, out, `href="mailto:me@example.com"`)
+	require.Contains(t, out, `data:image/png;base64,AA==`)
+}
@@ -0,0 +1,277 @@
+package main
+
+/*
+The trust.go defines the trust store of the client, which pins the identity
+of the groups on first use: the first time a group file is used, the hash of
+its roster, the collective key and the genesis block of its conodes are
+recorded, and the later commands fail if they change, e.g. if the group file
+was swapped for one listing other conodes. The collective key and the genesis
+block are only trusted when a majority of the conodes of the group report the
+same ones, and the commands on a pinned group fail when they can't be checked.
+A legitimate change, like a new roster or a forced setup, is accepted with the
+trust command.
+*/
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/dedis/kyber.v2/util/encoding"
+	"gopkg.in/dedis/onet.v2/app"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/urfave/cli.v1"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+// trustEntry is the identity of a group pinned in the trust store
+//    - Group is the absolute path of the group file
+//    - RosterHash is the decenarch.RosterHash of the roster of the file
+//    - Key is the collective key of the conodes
+//    - GenesisID is the ID of the genesis block of their archive
+//    - FirstUse is the time at which the group was pinned
+type trustEntry struct {
+	Group      string
+	RosterHash string
+	Key        string
+	GenesisID  string
+	FirstUse   string
+}
+
+// trustStore is the content of the trust store file
+type trustStore struct {
+	Groups []trustEntry
+}
+
+// defaultTrustPath returns the path of the trust store of the user
+func defaultTrustPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".decenarch", "trust.toml")
+}
+
+// readTrustStore reads the trust store file, empty if it doesn't exist
+func readTrustStore(file string) (*trustStore, error) {
+	store := &trustStore{}
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return store, nil
+	}
+	if _, err := toml.DecodeFile(file, store); err != nil {
+		return nil, fmt.Errorf("reading the trust store %s: %v", file, err)
+	}
+	return store, nil
+}
+
+// write writes the trust store to file, only readable by the user
+func (s *trustStore) write(file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := toml.NewEncoder(&b).Encode(s); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// find returns the entry pinned for the group file, nil if there is none
+func (s *trustStore) find(group string) *trustEntry {
+	for i := range s.Groups {
+		if s.Groups[i].Group == group {
+			return &s.Groups[i]
+		}
+	}
+	return nil
+}
+
+// pin records e, replacing the entry of its group if any
+func (s *trustStore) pin(e trustEntry) {
+	if pinned := s.find(e.Group); pinned != nil {
+		*pinned = e
+		return
+	}
+	s.Groups = append(s.Groups, e)
+}
+
+// errSetupUnknown is returned when the setup of a pinned group can't be
+// checked, it is never only logged
+var errSetupUnknown = errors.New("no majority of the conodes of the group report the same setup")
+
+// check returns an error if e differs from the entry pinned for its group, or
+// if the setup of e is unknown and the group is pinned. It pins e and returns
+// true if the group was not pinned yet and its setup is known.
+func (s *trustStore) check(e trustEntry) (bool, error) {
+	pinned := s.find(e.Group)
+	if pinned == nil {
+		if e.Key == "" {
+			return false, nil
+		}
+		s.pin(e)
+		return true, nil
+	}
+	var changed []string
+	if pinned.RosterHash != e.RosterHash {
+		changed = append(changed, "roster")
+	}
+	if e.Key != "" && pinned.Key != e.Key {
+		changed = append(changed, "collective key")
+	}
+	if e.Key != "" && pinned.GenesisID != e.GenesisID {
+		changed = append(changed, "genesis block")
+	}
+	if len(changed) > 0 {
+		return false, fmt.Errorf("the %s of the group %s changed since it was pinned on %s: run the trust command with --reset if the change is legitimate",
+			strings.Join(changed, ", "), e.Group, pinned.FirstUse)
+	}
+	if e.Key == "" {
+		return false, fmt.Errorf("cannot check the group %s pinned on %s: %v", e.Group, pinned.FirstUse, errSetupUnknown)
+	}
+	return false, nil
+}
+
+// trustSetup is the collective key and the genesis block reported by a
+// conode, hex encoded
+type trustSetup struct {
+	Key       string
+	GenesisID string
+}
+
+// majoritySetup returns the setup reported by a majority of the n conodes of
+// a group, or an empty setup if there is none. It returns an error if two
+// conodes report different setups.
+func majoritySetup(setups []trustSetup, n int) (trustSetup, error) {
+	for _, setup := range setups {
+		if setup != setups[0] {
+			return trustSetup{}, errors.New("the conodes of the group report different setups")
+		}
+	}
+	if len(setups) <= n/2 {
+		return trustSetup{}, nil
+	}
+	return setups[0], nil
+}
+
+// currentTrustEntry returns the identity of the group stored in the file
+// name: the hash of its roster, and the setup reported by a majority of its
+// conodes, empty if there is none, see majoritySetup
+func currentTrustEntry(name string, group *app.Group) (*trustEntry, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+	client := decenarch.NewClient()
+	var setups []trustSetup
+	for _, si := range group.Roster.List {
+		setup, err := client.GetSetupInfo(si)
+		if err != nil {
+			log.Lvl2(si.Address, "doesn't report its setup:", err)
+			continue
+		}
+		key, err := encoding.PointToStringHex(decenarch.Suite, setup.Key)
+		if err != nil {
+			return nil, err
+		}
+		setups = append(setups, trustSetup{Key: key, GenesisID: hex.EncodeToString(setup.GenesisID)})
+	}
+	setup, err := majoritySetup(setups, len(group.Roster.List))
+	if err != nil {
+		return nil, err
+	}
+	return &trustEntry{
+		Group:      abs,
+		RosterHash: hex.EncodeToString(decenarch.RosterHash(group.Roster)),
+		Key:        setup.Key,
+		GenesisID:  setup.GenesisID,
+		FirstUse:   time.Now().Format(time.RFC3339),
+	}, nil
+}
+
+// checkTrust checks the group stored in the file name against the trust
+// store given by the global flags, and pins it on first use. A mismatch is
+// only logged with --trust-warn, a pinned group whose setup can't be checked
+// is always refused.
+func checkTrust(c *cli.Context, name string, group *app.Group) error {
+	file := c.GlobalString("trust")
+	if file == "" {
+		return nil
+	}
+	entry, err := currentTrustEntry(name, group)
+	if err != nil {
+		return err
+	}
+	store, err := readTrustStore(file)
+	if err != nil {
+		return err
+	}
+	pinned, err := store.check(*entry)
+	if err != nil {
+		if c.GlobalBool("trust-warn") && entry.Key != "" {
+			log.Warn(err)
+			return nil
+		}
+		return err
+	}
+	if pinned {
+		info(c, "Pinned the group", entry.Group, "in the trust store", file)
+		return store.write(file)
+	}
+	return nil
+}
+
+// Prints the identity of the group pinned in the trust store, and pins its
+// current identity with --reset
+func cmdTrust(c *cli.Context) error {
+	if c.NArg() != 1 {
+		log.Fatal("Please give the group-file as argument")
+	}
+	name := c.Args().First()
+	file := c.GlobalString("trust")
+	if file == "" {
+		return errors.New("no trust store given")
+	}
+	store, err := readTrustStore(file)
+	if err != nil {
+		return err
+	}
+	if c.Bool("reset") {
+		entry, err := currentTrustEntry(name, readGroupFile(name))
+		if err != nil {
+			return err
+		}
+		if entry.Key == "" {
+			return errSetupUnknown
+		}
+		store.pin(*entry)
+		if err := store.write(file); err != nil {
+			return err
+		}
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	pinned := store.find(abs)
+	if pinned == nil {
+		log.Info("The group", abs, "is not pinned")
+		return nil
+	}
+	log.Info("Group:", pinned.Group)
+	log.Info("Roster hash:", pinned.RosterHash)
+	log.Info("Collective key:", pinned.Key)
+	log.Info("Genesis block:", pinned.GenesisID)
+	log.Info("Pinned on:", pinned.FirstUse)
+	return nil
+}
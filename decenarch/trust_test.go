@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trust")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, ".decenarch", "trust.toml")
+
+	store, err := readTrustStore(file)
+	require.Nil(t, err)
+	entry := trustEntry{Group: "/home/a/group.toml", RosterHash: "01", Key: "02", GenesisID: "03", FirstUse: "2018-06-01T10:00:00Z"}
+
+	// the group is pinned on first use
+	pinned, err := store.check(entry)
+	require.Nil(t, err)
+	require.True(t, pinned)
+	require.Nil(t, store.write(file))
+	stat, err := os.Stat(file)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+
+	store, err = readTrustStore(file)
+	require.Nil(t, err)
+	later := entry
+	later.FirstUse = "2018-06-02T10:00:00Z"
+	pinned, err = store.check(later)
+	require.Nil(t, err)
+	require.False(t, pinned)
+
+	// a swapped group is refused
+	swapped := later
+	swapped.RosterHash = "04"
+	swapped.Key = "05"
+	_, err = store.check(swapped)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "roster, collective key")
+	require.Equal(t, entry, *store.find(entry.Group))
+
+	// until it is pinned again
+	store.pin(swapped)
+	_, err = store.check(swapped)
+	require.Nil(t, err)
+	require.Len(t, store.Groups, 1)
+
+	// the other groups are pinned separately
+	other := entry
+	other.Group = "/home/a/other.toml"
+	pinned, err = store.check(other)
+	require.Nil(t, err)
+	require.True(t, pinned)
+	require.Len(t, store.Groups, 2)
+}
+
+func TestTrustUnknownSetup(t *testing.T) {
+	store := &trustStore{}
+	entry := trustEntry{Group: "/home/a/group.toml", RosterHash: "01", Key: "02", GenesisID: "03", FirstUse: "2018-06-01T10:00:00Z"}
+	unknown := entry
+	unknown.Key = ""
+	unknown.GenesisID = ""
+
+	// a group whose setup is unknown is not pinned
+	pinned, err := store.check(unknown)
+	require.Nil(t, err)
+	require.False(t, pinned)
+	require.Nil(t, store.find(entry.Group))
+
+	// but a pinned group whose setup is unknown is refused, and its roster
+	// is always checked
+	_, err = store.check(entry)
+	require.Nil(t, err)
+	_, err = store.check(unknown)
+	require.NotNil(t, err)
+	unknown.RosterHash = "04"
+	_, err = store.check(unknown)
+	require.Contains(t, err.Error(), "roster")
+}
+
+func TestMajoritySetup(t *testing.T) {
+	setup := trustSetup{Key: "02", GenesisID: "03"}
+	other := trustSetup{Key: "05", GenesisID: "03"}
+
+	// a single conode is not trusted for the whole group
+	s, err := majoritySetup([]trustSetup{setup}, 3)
+	require.Nil(t, err)
+	require.Equal(t, trustSetup{}, s)
+	s, err = majoritySetup([]trustSetup{setup, setup}, 3)
+	require.Nil(t, err)
+	require.Equal(t, setup, s)
+	s, err = majoritySetup(nil, 3)
+	require.Nil(t, err)
+	require.Equal(t, trustSetup{}, s)
+
+	// conodes reporting different setups are refused
+	_, err = majoritySetup([]trustSetup{setup, setup, other}, 3)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,102 @@
+package decenarch
+
+/*
+The divergence.go defines the summary of the leaves of the page of the root
+dropped from the consensus page, returned to the clients asking for it, see
+SaveRequest.Diagnostics. It only holds counts, neither the leaves nor the
+conodes having them, so that it leaks nothing of the pages fetched by the
+conodes. The number of conodes having a dropped leaf hints at why the leaf was
+dropped, see the DivergenceReason constants.
+*/
+
+import "sort"
+
+// Reasons why a leaf was dropped from the consensus page, given by the number
+// of conodes having it
+const (
+	// DivergenceRootOnly is the reason of the leaves only the root had,
+	// usually personalized or time dependent content, e.g. a session, a
+	// clock or a rotating ad
+	DivergenceRootOnly = "only on the page of the root"
+	// DivergenceMinority is the reason of the leaves a minority of the
+	// conodes had, usually variants of the page served by location or by
+	// A/B test
+	DivergenceMinority = "on the pages of a minority of the conodes"
+	// DivergenceBelowThreshold is the reason of the leaves a majority of the
+	// conodes had, but less than the threshold, usually content that changed
+	// between the fetches
+	DivergenceBelowThreshold = "on the pages of a majority of the conodes, below the threshold"
+)
+
+// DivergenceSummary describes the leaves of the page of the root dropped from
+// the consensus page
+//    - Leaves is the number of unique leaves of the page of the root
+//    - Dropped is the number of these leaves dropped from the consensus page
+//    - Threshold is the number of conodes that must have a leaf to keep it
+//    - Conodes is the number of conodes whose pages were counted
+//    - FailedConodes is the number of conodes that could not take part to
+//      the consensus
+//    - Histogram gives at index i the number of dropped leaves i conodes had.
+//      The counts of the cbf engine are upper bounds, because of the false
+//      positives of the Bloom filters
+//    - Reasons are the reasons of the dropped leaves, the most frequent first
+type DivergenceSummary struct {
+	Leaves        int
+	Dropped       int
+	Threshold     int
+	Conodes       int
+	FailedConodes int
+	Histogram     []int
+	Reasons       []DivergenceReason
+}
+
+// DivergenceReason is the number of dropped leaves for a reason, see
+// DivergenceRootOnly
+type DivergenceReason struct {
+	Reason string
+	Leaves int
+}
+
+// NewDivergenceSummary returns the summary of the leaves of the root dropped
+// from the consensus page, where count returns the number of conodes having a
+// leaf, out of the conodes whose pages were counted, and failed conodes could
+// not take part to the consensus
+func NewDivergenceSummary(leaves []string, count func(leaf string) int, threshold, conodes, failed int) *DivergenceSummary {
+	d := &DivergenceSummary{
+		Leaves:        len(leaves),
+		Threshold:     threshold,
+		Conodes:       conodes,
+		FailedConodes: failed,
+		Histogram:     make([]int, threshold),
+	}
+	reasons := make(map[string]int)
+	for _, leaf := range leaves {
+		n := count(leaf)
+		if n >= threshold {
+			continue
+		}
+		if n < 0 {
+			n = 0
+		}
+		d.Dropped++
+		d.Histogram[n]++
+		switch {
+		case n <= 1:
+			reasons[DivergenceRootOnly]++
+		case 2*n < conodes:
+			reasons[DivergenceMinority]++
+		default:
+			reasons[DivergenceBelowThreshold]++
+		}
+	}
+	for reason, n := range reasons {
+		d.Reasons = append(d.Reasons, DivergenceReason{Reason: reason, Leaves: n})
+	}
+	sort.Slice(d.Reasons, func(i, j int) bool {
+		if d.Reasons[i].Leaves != d.Reasons[j].Leaves {
+			return d.Reasons[i].Leaves > d.Reasons[j].Leaves
+		}
+		return d.Reasons[i].Reason < d.Reasons[j].Reason
+	})
+	return d
+}
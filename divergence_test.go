@@ -0,0 +1,33 @@
+package decenarch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDivergenceSummary(t *testing.T) {
+	counts := map[string]int{
+		"title":   7,
+		"content": 5,
+		"clock":   1,
+		"session": 1,
+		"geo":     2,
+		"news":    4,
+	}
+	leaves := []string{"title", "content", "clock", "session", "geo", "news"}
+	d := NewDivergenceSummary(leaves, func(leaf string) int { return counts[leaf] }, 5, 7, 1)
+	require.Equal(t, 6, d.Leaves)
+	require.Equal(t, 4, d.Dropped)
+	require.Equal(t, 1, d.FailedConodes)
+	require.Equal(t, []int{0, 2, 1, 0, 1}, d.Histogram)
+	require.Equal(t, []DivergenceReason{
+		{Reason: DivergenceRootOnly, Leaves: 2},
+		{Reason: DivergenceBelowThreshold, Leaves: 1},
+		{Reason: DivergenceMinority, Leaves: 1},
+	}, d.Reasons)
+
+	d = NewDivergenceSummary([]string{"title"}, func(string) int { return 7 }, 5, 7, 0)
+	require.Equal(t, 0, d.Dropped)
+	require.Empty(t, d.Reasons)
+}
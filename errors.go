@@ -0,0 +1,232 @@
+package decenarch
+
+/*
+This holds the errors returned by the service to the clients. The conodes only
+send the message of an error to the client, so the errors the clients may
+want to handle carry their code in their message, and the client gets back
+the typed error with DecodeError.
+*/
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/dedis/kyber.v2"
+)
+
+// Codes of the errors carried over the network, following ErrorParse
+const (
+	ErrorNoSetup = iota + 4001
+	ErrorFetchFailed
+	ErrorConsensusThreshold
+	ErrorSignatureTimeout
+	ErrorBlockNotFound
+	ErrorRedirectConsensus
+	ErrorQueueFull
+	ErrorSaveCanceled
+)
+
+// CodedError is an error identified by its code once received by a client
+type CodedError struct {
+	Code int
+	Msg  string
+}
+
+// Error implements the error interface
+func (e *CodedError) Error() string {
+	return fmt.Sprintf("[code %d] %s", e.Code, e.Msg)
+}
+
+var (
+	// ErrNoSetup is returned when the conode has no archive yet
+	ErrNoSetup = &CodedError{Code: ErrorNoSetup, Msg: "no genesis block stored: run setup first"}
+	// ErrConsensusThreshold is returned when less than the threshold of
+	// conodes fetched the page, so that no consensus could be reached
+	ErrConsensusThreshold = &CodedError{Code: ErrorConsensusThreshold, Msg: "not enough conodes fetched the page"}
+	// ErrSignatureTimeout is returned when the conodes did not sign in time
+	ErrSignatureTimeout = &CodedError{Code: ErrorSignatureTimeout, Msg: "signature protocol timed out"}
+	// ErrBlockNotFound is returned when no block of the skipchain holds the
+	// requested page
+	ErrBlockNotFound = &CodedError{Code: ErrorBlockNotFound, Msg: "could not find block in skipchain"}
+	// ErrRedirectConsensus is returned when no threshold of conodes was
+	// redirected to the same final URL
+	ErrRedirectConsensus = &CodedError{Code: ErrorRedirectConsensus, Msg: "the conodes were redirected to different URLs"}
+	// ErrQueueFull is returned when the conode already runs and queues as
+	// many saves as its operator allows
+	ErrQueueFull = &CodedError{Code: ErrorQueueFull, Msg: "too many saves in progress"}
+	// ErrSaveCanceled is returned when the client canceled the save before
+	// its pages were signed, see CancelRequest
+	ErrSaveCanceled = &CodedError{Code: ErrorSaveCanceled, Msg: "save canceled by the client"}
+)
+
+// ErrFetchFailed is returned when the conode leading a save could not fetch
+// the page
+type ErrFetchFailed struct {
+	URL    string
+	Reason string
+}
+
+// Error implements the error interface
+func (e *ErrFetchFailed) Error() string {
+	return fmt.Sprintf("[code %d] fetching %s failed: %s", ErrorFetchFailed, e.URL, e.Reason)
+}
+
+// SignatureTimeoutError is returned when the conodes did not sign in time,
+// with what the root saw of the subtrees of the signing protocol
+//    - Protocol is the name of the signing protocol
+//    - Attempts is the number of times the protocol was run
+//    - Subtrees describe the subtrees of the last run, with the subleaders
+//      the root replaced because they didn't answer in time
+type SignatureTimeoutError struct {
+	Protocol string
+	Attempts int
+	Subtrees []string
+}
+
+// Error implements the error interface
+func (e *SignatureTimeoutError) Error() string {
+	subtrees := "no subtree started"
+	if len(e.Subtrees) > 0 {
+		subtrees = strings.Join(e.Subtrees, "; ")
+	}
+	return fmt.Sprintf("[code %d] signature protocol %s timed out after %d attempts: %s",
+		ErrorSignatureTimeout, e.Protocol, e.Attempts, subtrees)
+}
+
+var (
+	codeRegexp    = regexp.MustCompile(`\[code (\d+)\] `)
+	fetchRegexp   = regexp.MustCompile(`(?s)\[code \d+\] fetching (\S+) failed: (.*)$`)
+	timeoutRegexp = regexp.MustCompile(`(?s)\[code \d+\] signature protocol (\S+) timed out after (\d+) attempts: (.*)$`)
+)
+
+// DecodeError returns the typed error whose message was received from a
+// conode, or err itself if its message carries no known code
+func DecodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	m := codeRegexp.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+	code, _ := strconv.Atoi(m[1])
+	switch code {
+	case ErrorNoSetup:
+		return ErrNoSetup
+	case ErrorConsensusThreshold:
+		return ErrConsensusThreshold
+	case ErrorSignatureTimeout:
+		if t := timeoutRegexp.FindStringSubmatch(err.Error()); t != nil {
+			e := &SignatureTimeoutError{Protocol: t[1]}
+			e.Attempts, _ = strconv.Atoi(t[2])
+			if t[3] != "no subtree started" {
+				e.Subtrees = strings.Split(t[3], "; ")
+			}
+			return e
+		}
+		return ErrSignatureTimeout
+	case ErrorBlockNotFound:
+		return ErrBlockNotFound
+	case ErrorRedirectConsensus:
+		return ErrRedirectConsensus
+	case ErrorQueueFull:
+		return ErrQueueFull
+	case ErrorSaveCanceled:
+		return ErrSaveCanceled
+	case ErrorFetchFailed:
+		if f := fetchRegexp.FindStringSubmatch(err.Error()); f != nil {
+			return &ErrFetchFailed{URL: f[1], Reason: f[2]}
+		}
+	}
+	return err
+}
+
+// QuotaError is returned when a client exceeds one of the limits configured
+// by the conode operator
+type QuotaError struct {
+	Client string // public key of the client, or "anonymous"
+	Reason string
+}
+
+// Error implements the error interface
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded for client %s: %s", e.Client, e.Reason)
+}
+
+// PolicyError is returned when the conodes refuse to archive an URL because
+// of their domain policy
+type PolicyError struct {
+	URL    string
+	Reason string
+}
+
+// Error implements the error interface
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("policy refuses to archive %s: %s", e.URL, e.Reason)
+}
+
+// SizeError is returned when a resource to archive is larger than the limit
+// configured by the conode operator
+type SizeError struct {
+	URL   string
+	Limit int64 // in bytes
+}
+
+// Error implements the error interface
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("resource too large: %s is bigger than %d bytes", e.URL, e.Limit)
+}
+
+// ReconstructionError is returned when the consensus Bloom filter
+// reconstructed from the partial decryptions is not valid
+type ReconstructionError struct {
+	Bucket int   // index of the invalid bucket, -1 if not bucket specific
+	Value  int64 // reconstructed value of the bucket
+	Conode int   // DKG share index of the faulty conode, -1 if unknown
+	Reason string
+}
+
+// Error implements the error interface
+func (e *ReconstructionError) Error() string {
+	msg := "invalid reconstruction"
+	if e.Bucket >= 0 {
+		msg += fmt.Sprintf(" of bucket %d (value %d)", e.Bucket, e.Value)
+	}
+	if e.Conode >= 0 {
+		msg += fmt.Sprintf(", faulty share %d", e.Conode)
+	}
+	return msg + ": " + e.Reason
+}
+
+// NodeError is an error of a conode during a save, carried over the network
+// in the replies of the protocols so that the client knows which conode
+// failed on what
+//    - ConodeID is the public key of the conode
+//    - Phase is the protocol, and its phase if any, in which the error
+//      happened
+//    - Code is the code of the error, see CodedError, zero if the error has
+//      no code
+//    - Message is the message of the error
+type NodeError struct {
+	ConodeID string
+	Phase    string
+	Code     int
+	Message  string
+}
+
+// NewNodeError returns the error err of the conode of public key conode in
+// the given phase
+func NewNodeError(conode kyber.Point, phase string, err error) NodeError {
+	e := NodeError{ConodeID: conode.String(), Phase: phase, Message: err.Error()}
+	if m := codeRegexp.FindStringSubmatch(e.Message); m != nil {
+		e.Code, _ = strconv.Atoi(m[1])
+	}
+	return e
+}
+
+// Error implements the error interface
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("conode %s failed in %s: %s", e.ConodeID, e.Phase, e.Message)
+}
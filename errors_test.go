@@ -0,0 +1,56 @@
+package decenarch
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeError(t *testing.T) {
+	require.Nil(t, DecodeError(nil))
+
+	// the conodes only send the message of the errors
+	for _, err := range []error{ErrNoSetup, ErrConsensusThreshold, ErrSignatureTimeout, ErrBlockNotFound, ErrRedirectConsensus, ErrQueueFull, ErrSaveCanceled} {
+		received := errors.New("websocket: close 4100: " + err.Error())
+		require.Equal(t, err, DecodeError(received))
+	}
+
+	fetch := &ErrFetchFailed{URL: "http://example.com:8080/a", Reason: "connection refused: no route"}
+	decoded, ok := DecodeError(errors.New(fetch.Error())).(*ErrFetchFailed)
+	require.True(t, ok)
+	require.Equal(t, fetch, decoded)
+
+	timeout := &SignatureTimeoutError{
+		Protocol: "SignStructured",
+		Attempts: 2,
+		Subtrees: []string{"subleader tls://10.0.0.2:7770 of 3 conodes", "subleader tls://10.0.0.6:7770 of 3 conodes, replaced tls://10.0.0.5:7770"},
+	}
+	decodedTimeout, ok := DecodeError(errors.New(timeout.Error())).(*SignatureTimeoutError)
+	require.True(t, ok)
+	require.Equal(t, timeout, decodedTimeout)
+	timeout.Subtrees = nil
+	decodedTimeout, ok = DecodeError(errors.New(timeout.Error())).(*SignatureTimeoutError)
+	require.True(t, ok)
+	require.Equal(t, timeout, decodedTimeout)
+
+	// untyped errors are returned as they are
+	other := errors.New("[code 1] unknown")
+	require.Equal(t, other, DecodeError(other))
+	plain := errors.New("no code")
+	require.Equal(t, plain, DecodeError(plain))
+}
+
+func TestNodeError(t *testing.T) {
+	conode := Suite.Point().Pick(Suite.RandomStream())
+	fetch := &ErrFetchFailed{URL: "http://example.com", Reason: "timeout"}
+	e := NewNodeError(conode, "ConsensusStructured/Consensus", fetch)
+	require.Equal(t, conode.String(), e.ConodeID)
+	require.Equal(t, ErrorFetchFailed, e.Code)
+	require.Equal(t, fetch.Error(), e.Message)
+	require.Contains(t, e.Error(), "ConsensusStructured/Consensus")
+
+	// the errors without code have a zero code
+	e = NewNodeError(conode, "ConsensusUnstructured/Consensus", errors.New("invalid signature"))
+	require.Equal(t, 0, e.Code)
+}
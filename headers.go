@@ -0,0 +1,62 @@
+package decenarch
+
+/*
+The headers.go defines the headers of the requests of the conodes fetching the
+pages. The origins may serve another variant of a page, e.g. in another
+language, to clients sending other headers, which would defeat the consensus.
+The headers are agreed at setup, like the threshold, and the root of a save
+sends them to the other conodes, so that they all fetch the page with the
+same headers. A save request can override them.
+*/
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultFetchHeaders are the headers of the conodes when none were agreed
+// at setup
+var DefaultFetchHeaders = map[string]string{
+	"User-Agent":      "Mozilla/5.0 (compatible; decenarch/1.0; +https://github.com/dedis/student_18_decenar)",
+	"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+	"Accept-Language": "en-US,en;q=0.5",
+}
+
+// ValidFetchHeaders returns an error if the conodes refuse to fetch the pages
+// with the given headers. The credentials are refused, they are sent by the
+// request templates and redacted from the stored pages, see RequestTemplate.
+func ValidFetchHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		switch http.CanonicalHeaderKey(name) {
+		case "Host", "Content-Length", "Connection", "Transfer-Encoding", "Authorization", "Cookie", "Proxy-Authorization":
+			return fmt.Errorf("header %s cannot be set for all the fetches", name)
+		}
+		if name == "" || strings.ContainsAny(name, " :\r\n") || strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid fetch header %q", name)
+		}
+	}
+	return nil
+}
+
+// MergeFetchHeaders returns the headers agreed, DefaultFetchHeaders if none
+// were agreed, overridden by the ones of override. A header of override with
+// an empty value is removed. The names are canonical, see
+// http.CanonicalHeaderKey.
+func MergeFetchHeaders(agreed, override map[string]string) map[string]string {
+	if len(agreed) == 0 {
+		agreed = DefaultFetchHeaders
+	}
+	merged := make(map[string]string, len(agreed))
+	for name, value := range agreed {
+		merged[http.CanonicalHeaderKey(name)] = value
+	}
+	for name, value := range override {
+		if value == "" {
+			delete(merged, http.CanonicalHeaderKey(name))
+		} else {
+			merged[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+	return merged
+}
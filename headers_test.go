@@ -0,0 +1,27 @@
+package decenarch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchHeaders(t *testing.T) {
+	require.Nil(t, ValidFetchHeaders(DefaultFetchHeaders))
+	require.Nil(t, ValidFetchHeaders(map[string]string{"accept-language": "fr"}))
+	for _, bad := range []map[string]string{
+		{"Cookie": "session=a"},
+		{"host": "example.com"},
+		{"X-A": "a\r\nX-B: b"},
+		{"": "a"},
+	} {
+		require.NotNil(t, ValidFetchHeaders(bad))
+	}
+
+	// the defaults are used when no headers were agreed
+	require.Equal(t, DefaultFetchHeaders, MergeFetchHeaders(nil, nil))
+	agreed := map[string]string{"user-agent": "archiver", "Accept-Language": "en"}
+	merged := MergeFetchHeaders(agreed, map[string]string{"accept-language": "fr", "User-Agent": "", "Dnt": "1"})
+	require.Equal(t, map[string]string{"Accept-Language": "fr", "Dnt": "1"}, merged)
+	require.Equal(t, "archiver", agreed["user-agent"])
+}
@@ -0,0 +1,166 @@
+package lib
+
+/*
+The backup.go defines the encryption of the backups of the DKG share of a
+conode. The backup file is encrypted with AES-GCM under a key derived from the
+passphrase of the operator with scrypt, on the machine of the operator: the
+passphrase never leaves it. Between the conode and the operator, the content
+of the backup is sealed to a transport key of the receiver, see SealTo.
+*/
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+	"gopkg.in/dedis/kyber.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+// MinPassphraseLength is the minimal length of the passphrase of a backup
+const MinPassphraseLength = 8
+
+// backupVersion is the version of the format of the backup files
+const backupVersion = 1
+
+// secretBackup is the backup file written by the export-secret command
+//    - Key is the collective key of the share, hex encoded, checked when
+//      the backup is decrypted
+//    - Index is the index of the share
+//    - Salt and Nonce are the parameters of the encryption
+//    - Data is the encrypted content of the backup
+type secretBackup struct {
+	Version int
+	Key     string
+	Index   int
+	Salt    []byte
+	Nonce   []byte
+	Data    []byte
+}
+
+// EncryptBackup returns the backup file of the content of the share of index
+// index of the collective key key, encrypted with the passphrase
+func EncryptBackup(passphrase, key string, index int, content []byte) (string, error) {
+	if len(passphrase) < MinPassphraseLength {
+		return "", fmt.Errorf("the passphrase must have at least %d characters", MinPassphraseLength)
+	}
+	backup := &secretBackup{Version: backupVersion, Key: key, Index: index, Salt: make([]byte, 32)}
+	if _, err := rand.Read(backup.Salt); err != nil {
+		return "", err
+	}
+	aead, err := backupCipher(passphrase, backup.Salt)
+	if err != nil {
+		return "", err
+	}
+	backup.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(backup.Nonce); err != nil {
+		return "", err
+	}
+	backup.Data = aead.Seal(nil, backup.Nonce, content, []byte(backup.Key))
+	out, err := json.MarshalIndent(backup, "", "  ")
+	return string(out), err
+}
+
+// DecryptBackup returns the content, the collective key and the index of the
+// share of the backup file encrypted with the passphrase
+func DecryptBackup(passphrase, encoded string) ([]byte, string, int, error) {
+	backup := &secretBackup{}
+	if err := json.Unmarshal([]byte(encoded), backup); err != nil {
+		return nil, "", 0, fmt.Errorf("invalid backup: %v", err)
+	}
+	if backup.Version != backupVersion {
+		return nil, "", 0, fmt.Errorf("backup version %d not supported", backup.Version)
+	}
+	aead, err := backupCipher(passphrase, backup.Salt)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if len(backup.Nonce) != aead.NonceSize() {
+		return nil, "", 0, errors.New("invalid backup: wrong nonce size")
+	}
+	content, err := aead.Open(nil, backup.Nonce, backup.Data, []byte(backup.Key))
+	if err != nil {
+		return nil, "", 0, errors.New("cannot decrypt the backup: wrong passphrase or corrupted backup")
+	}
+	return content, backup.Key, backup.Index, nil
+}
+
+// backupCipher returns the AES-GCM cipher keyed by the passphrase
+func backupCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(key)
+}
+
+// SealTo returns the data encrypted to the public key: an ephemeral point,
+// whose Diffie-Hellman secret with public keys an AES-GCM cipher, followed by
+// the nonce and the encrypted data
+func SealTo(public kyber.Point, data []byte) ([]byte, error) {
+	r := decenarch.Suite.Scalar().Pick(decenarch.Suite.RandomStream())
+	ephemeral, err := decenarch.Suite.Point().Mul(r, nil).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := sealCipher(decenarch.Suite.Point().Mul(r, public))
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := append(ephemeral, nonce...)
+	return aead.Seal(sealed, nonce, data, ephemeral), nil
+}
+
+// OpenSealed returns the data sealed by SealTo to the public key of private
+func OpenSealed(private kyber.Scalar, sealed []byte) ([]byte, error) {
+	ephemeral := decenarch.Suite.Point()
+	size := ephemeral.MarshalSize()
+	if len(sealed) < size {
+		return nil, errors.New("sealed data too short")
+	}
+	if err := ephemeral.UnmarshalBinary(sealed[:size]); err != nil {
+		return nil, err
+	}
+	aead, err := sealCipher(decenarch.Suite.Point().Mul(private, ephemeral))
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < size+aead.NonceSize() {
+		return nil, errors.New("sealed data too short")
+	}
+	nonce := sealed[size : size+aead.NonceSize()]
+	data, err := aead.Open(nil, nonce, sealed[size+aead.NonceSize():], sealed[:size])
+	if err != nil {
+		return nil, errors.New("cannot open the sealed data: wrong key or corrupted data")
+	}
+	return data, nil
+}
+
+// sealCipher returns the AES-GCM cipher keyed by the hash of the shared point
+func sealCipher(shared kyber.Point) (cipher.AEAD, error) {
+	b, err := shared.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(b)
+	return newGCM(key[:])
+}
+
+// newGCM returns the AES-GCM cipher of the key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
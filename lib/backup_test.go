@@ -0,0 +1,44 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/util/key"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestBackup(t *testing.T) {
+	content := []byte("share")
+	_, err := EncryptBackup("short", "key", 1, content)
+	require.NotNil(t, err)
+	backup, err := EncryptBackup("correct horse", "key", 1, content)
+	require.Nil(t, err)
+
+	_, _, _, err = DecryptBackup("wrong horse", backup)
+	require.NotNil(t, err)
+	decrypted, k, index, err := DecryptBackup("correct horse", backup)
+	require.Nil(t, err)
+	require.Equal(t, content, decrypted)
+	require.Equal(t, "key", k)
+	require.Equal(t, 1, index)
+}
+
+func TestSealTo(t *testing.T) {
+	receiver := key.NewKeyPair(decenarch.Suite)
+	other := key.NewKeyPair(decenarch.Suite)
+	sealed, err := SealTo(receiver.Public, []byte("share"))
+	require.Nil(t, err)
+
+	data, err := OpenSealed(receiver.Private, sealed)
+	require.Nil(t, err)
+	require.Equal(t, []byte("share"), data)
+	_, err = OpenSealed(other.Private, sealed)
+	require.NotNil(t, err)
+	sealed[len(sealed)-1] ^= 1
+	_, err = OpenSealed(receiver.Private, sealed)
+	require.NotNil(t, err)
+	_, err = OpenSealed(receiver.Private, sealed[:4])
+	require.NotNil(t, err)
+}
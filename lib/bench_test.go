@@ -0,0 +1,172 @@
+package lib
+
+import (
+	"strconv"
+	"testing"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/share"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/kyber.v2/util/random"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+// The benchmarks of the cryptographic pipeline of the CBF engine, in the
+// order of a save: the conodes encrypt their filter and prove its content,
+// the parents verify the proofs and aggregate the filters, and the conodes
+// partially decrypt the aggregation, which the root reconstructs. Each
+// benchmark runs for several filter sizes, e.g.
+//
+//    go test -run XXX -bench . -benchmem -cpuprofile cpu.out ./lib
+
+// benchSizes are the numbers of buckets of the benchmarked filters
+var benchSizes = []int{100, 1000, 10000}
+
+// benchNodes and benchThreshold define the cothority of the decryption
+// benchmarks
+const (
+	benchNodes     = 7
+	benchThreshold = 5
+)
+
+// benchFilter returns a filter of size buckets, one in ten set to 1
+func benchFilter(size int) []int64 {
+	set := make([]int64, size)
+	for i := 0; i < size; i += 10 {
+		set[i] = 1
+	}
+	return set
+}
+
+// benchSizesRun runs f as a sub-benchmark for each of the benchSizes
+func benchSizesRun(b *testing.B, f func(b *testing.B, size int)) {
+	for _, size := range benchSizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			f(b, size)
+		})
+	}
+}
+
+func BenchmarkEncryptIntVector(b *testing.B) {
+	pair := key.NewKeyPair(decenarch.Suite)
+	benchSizesRun(b, func(b *testing.B, size int) {
+		set := benchFilter(size)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			EncryptIntVector(pair.Public, set)
+		}
+	})
+}
+
+func BenchmarkEncryptIntVectorPool(b *testing.B) {
+	pair := key.NewKeyPair(decenarch.Suite)
+	benchSizesRun(b, func(b *testing.B, size int) {
+		set := benchFilter(size)
+		pool := NewZeroPool(pair.Public)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			pool.Fill(size)
+			b.StartTimer()
+			EncryptIntVectorPool(pool, pair.Public, set)
+		}
+	})
+}
+
+func BenchmarkCipherVectorAdd(b *testing.B) {
+	pair := key.NewKeyPair(decenarch.Suite)
+	benchSizesRun(b, func(b *testing.B, size int) {
+		cv, _ := EncryptIntVector(pair.Public, benchFilter(size))
+		sum := NewCipherVector(size)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sum.Add(*sum, *cv)
+		}
+	})
+}
+
+func BenchmarkCreateCipherTextProof(b *testing.B) {
+	pair := key.NewKeyPair(decenarch.Suite)
+	blinding := decenarch.Suite.Scalar().Pick(random.New())
+	cipher := &CipherText{
+		K: decenarch.Suite.Point().Mul(blinding, nil),
+		C: decenarch.Suite.Point().Mul(blinding, pair.Public),
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		CreateCipherTextProof(cipher, pair.Public, blinding)
+	}
+}
+
+func BenchmarkVerifyCipherVectorProof(b *testing.B) {
+	pair := key.NewKeyPair(decenarch.Suite)
+	benchSizesRun(b, func(b *testing.B, size int) {
+		cv, proof := EncryptIntVector(pair.Public, benchFilter(size))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if !proof.VerifyCipherVectorProof(cv) {
+				b.Fatal("invalid proof")
+			}
+		}
+	})
+}
+
+func BenchmarkPackCipherVector(b *testing.B) {
+	pair := key.NewKeyPair(decenarch.Suite)
+	benchSizesRun(b, func(b *testing.B, size int) {
+		cv, _ := EncryptIntVector(pair.Public, benchFilter(size))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			var unpacked CipherVector
+			if err := unpacked.Unpack(cv.Pack()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkPartialDecryption(b *testing.B) {
+	shares, public := benchShares()
+	benchSizesRun(b, func(b *testing.B, size int) {
+		cv, _ := EncryptIntVector(public, benchFilter(size))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			benchPartials(shares[:1], cv)
+		}
+	})
+}
+
+func BenchmarkReconstructVectorFromPartials(b *testing.B) {
+	shares, public := benchShares()
+	benchSizesRun(b, func(b *testing.B, size int) {
+		cv, _ := EncryptIntVector(public, benchFilter(size))
+		partials := benchPartials(shares[:benchThreshold], cv)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := ReconstructVectorFromPartials(benchNodes, benchThreshold, partials); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// benchShares returns the shares of a random secret among benchNodes nodes,
+// and the public key of this secret
+func benchShares() ([]*share.PriShare, kyber.Point) {
+	secret := decenarch.Suite.Scalar().Pick(random.New())
+	shares := share.NewPriPoly(decenarch.Suite, benchThreshold, secret, random.New()).Shares(benchNodes)
+	return shares, decenarch.Suite.Point().Mul(secret, nil)
+}
+
+// benchPartials returns the partial decryptions of cv by the given shares
+func benchPartials(shares []*share.PriShare, cv *CipherVector) map[int][]kyber.Point {
+	partials := make(map[int][]kyber.Point)
+	for _, s := range shares {
+		partials[s.I] = make([]kyber.Point, len(*cv))
+		for i, c := range *cv {
+			partials[s.I][i] = DecryptPoint(s.V, c)
+		}
+	}
+	return partials
+}
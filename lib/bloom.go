@@ -4,22 +4,71 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"math"
 	"math/big"
+	"sync"
+	"sync/atomic"
 
 	"golang.org/x/crypto/blake2b"
 	"golang.org/x/net/html"
 )
 
+// DefaultFalsePositiveRate is the target false positive rate of the Bloom
+// filters when none is given
+const DefaultFalsePositiveRate = 0.01
+
+// parallelLeaves is the number of leaves from which the filters are filled
+// by several workers, see AddAll
+const parallelLeaves = 1024
+
+// Versions of the hashing of the elements of the filters. The version is the
+// third parameter of the filters, the parameters without version use
+// HashingBigInt so that the proofs of the old saves still verify.
+const (
+	// HashingBigInt computes the locations with big.Int arithmetic on the
+	// whole SHA-256 and BLAKE2b hashes
+	HashingBigInt = iota
+	// HashingFast64 computes the locations with 64-bit arithmetic on the
+	// first halves of the SHA-256 and BLAKE2b hashes
+	HashingFast64
+)
+
+// CurrentHashing is the hashing version of the new filters
+const CurrentHashing = HashingFast64
+
+// CounterWidth returns the width in bits of the counters of the aggregated
+// filters of nodes conodes, each conode adding at most one to a counter
+func CounterWidth(nodes int) int {
+	width := 1
+	for int64(nodes)>>uint(width) > 0 {
+		width++
+	}
+	return width
+}
+
+// CounterMax returns the maximal value of a counter of the given width in
+// bits, which also bounds the integers decrypted from the aggregated filters,
+// see GetPointToIntBounded
+func CounterMax(width int) int64 {
+	return 1<<uint(width) - 1
+}
+
+// stackLocations is the number of hash functions whose locations are
+// computed without allocation by Add and Count
+const stackLocations = 32
+
 // Counting Bloom filter is a probabilistic data structure
 // The code is based on the Bloom filter library by Will Fitzgerald
 // (https://github.com/willf/bloom), adapted to implement counting
 // Bloom filter instead of simple filter
 type CBF struct {
-	Set []int64 // the counting Bloom filter byte set
-	M   uint    // maximal number of buckets
-	K   uint    // number of hash functions
+	Set     []int64 // the counting Bloom filter byte set
+	M       uint    // maximal number of buckets
+	K       uint    // number of hash functions
+	Version uint    // hashing version, see HashingFast64
+	Max     int64   // maximal count, see CounterMax, 0 for no bound
 }
 
 // NewOptimalBloomFilter returns a pointer to a CBF whose parameters are
@@ -30,64 +79,138 @@ func NewOptimalBloomFilter(root *html.Node) *CBF {
 	if root == nil {
 		return &CBF{}
 	}
-	return NewBloomFilter(getOptimalCBFParameters(root))
+	param := getOptimalCBFParameters(root, DefaultFalsePositiveRate)
+	return &CBF{Set: make([]int64, param[0]), M: param[0], K: param[1], Version: CurrentHashing}
 }
 
 // NewBloomFilter returns a pointer to a CBF with the given parameters, i.e.
-// with the given M and K
-func NewBloomFilter(param []uint) *CBF {
-	return &CBF{Set: make([]int64, param[0]), M: param[0], K: param[1]}
+// with the given M, K and optional hashing version, or an error if the
+// parameters are invalid, see checkParameters
+func NewBloomFilter(param []uint) (*CBF, error) {
+	if err := checkParameters(param); err != nil {
+		return nil, err
+	}
+	return &CBF{Set: make([]int64, param[0]), M: param[0], K: param[1], Version: hashingVersion(param)}, nil
+}
+
+// BloomFilterFromSet returns a CBF from a given set, using the given
+// paramters, or an error if the parameters are invalid
+func BloomFilterFromSet(set []int64, param []uint) (*CBF, error) {
+	if err := checkParameters(param); err != nil {
+		return nil, err
+	}
+	return &CBF{Set: set, M: param[0], K: param[1], Version: hashingVersion(param)}, nil
 }
 
-// BloomFilterFromSet returns a CBF from a given set, using the given paramters
-func BloomFilterFromSet(set []int64, param []uint) *CBF {
-	return &CBF{Set: set, M: param[0], K: param[1]}
+// checkParameters returns an error if the parameters lack M or K, or if their
+// hashing version is unknown
+func checkParameters(param []uint) error {
+	if len(param) < 2 || len(param) > 3 {
+		return fmt.Errorf("invalid Bloom filter parameters: %d values", len(param))
+	}
+	if v := hashingVersion(param); v != HashingBigInt && v != HashingFast64 {
+		return fmt.Errorf("unknown hashing version %d of the Bloom filter", v)
+	}
+	return nil
 }
 
-// GetOptimalCBFParametersToSend returns the optimal parameters, i.e. M and K,
-// for the tree rooted by root as []uint64 type. This is used to send the
-// parameters using protobuf
-func GetOptimalCBFParametersToSend(root *html.Node) []uint64 {
-	p := getOptimalCBFParameters(root)
-	return []uint64{uint64(p[0]), uint64(p[1])}
+// hashingVersion returns the hashing version of the parameters, HashingBigInt
+// for the parameters without version
+func hashingVersion(param []uint) uint {
+	if len(param) > 2 {
+		return param[2]
+	}
+	return HashingBigInt
 }
 
-// GetOptimalCBFParametersToSend returns the optimal parameters, i.e. M and K,
-// for the tree rooted by root as []uint type
-func getOptimalCBFParameters(root *html.Node) []uint {
+// GetOptimalCBFParametersToSend returns the optimal parameters, i.e. M, K
+// and the hashing version, for the tree rooted by root and the target false
+// positive rate fpRate as []uint64 type. This is used to send the parameters
+// using protobuf. If fpRate is 0, DefaultFalsePositiveRate is used
+func GetOptimalCBFParametersToSend(root *html.Node, fpRate float64) []uint64 {
+	return ParametersToSend(getOptimalCBFParameters(root, fpRate))
+}
+
+// GetOptimalCBFParametersForLeaves is GetOptimalCBFParametersToSend for the
+// given unique leaves, e.g. listed by a LeafExtractor
+func GetOptimalCBFParametersForLeaves(leaves []string, fpRate float64) []uint64 {
+	if fpRate == 0 {
+		fpRate = DefaultFalsePositiveRate
+	}
+	m, k := bestParameters(uint(len(leaves)), fpRate)
+	return ParametersToSend([]uint{m, k, CurrentHashing})
+}
+
+// ParametersToSend casts the parameters from uint to uint64, since uint64 is
+// needed to send the parameters using protobuf
+func ParametersToSend(param []uint) []uint64 {
+	sent := make([]uint64, len(param))
+	for i, p := range param {
+		sent[i] = uint64(p)
+	}
+	return sent
+}
+
+// ParametersFromSent casts the parameters received from uint64 to uint, and
+// returns an error if they are invalid, see checkParameters
+func ParametersFromSent(param []uint64) ([]uint, error) {
+	received := make([]uint, len(param))
+	for i, p := range param {
+		received[i] = uint(p)
+	}
+	if err := checkParameters(received); err != nil {
+		return nil, err
+	}
+	return received, nil
+}
+
+// GetOptimalCBFParametersToSend returns the optimal parameters, i.e. M, K
+// and the hashing version, for the tree rooted by root as []uint type
+func getOptimalCBFParameters(root *html.Node, fpRate float64) []uint {
 	if root == nil {
-		return []uint{0, 0}
+		return []uint{0, 0, CurrentHashing}
+	}
+	if fpRate == 0 {
+		fpRate = DefaultFalsePositiveRate
 	}
 	uniqueLeaves := uint(len(ListUniqueDataLeaves(root)))
-	m, k := bestParameters(uniqueLeaves, 0.01)
+	m, k := bestParameters(uniqueLeaves, fpRate)
 
-	return []uint{m, k}
+	return []uint{m, k, CurrentHashing}
 }
 
 // AddUniqueLeaves add to c the unique leaves contained
 // in the AnonTree with the root given as parameter
 // Return the CBF to allow chaining
 func (c *CBF) AddUniqueLeaves(root *html.Node) *CBF {
-	uniqueLeaves := ListUniqueDataLeaves(root)
-	for _, l := range uniqueLeaves {
-		c.Add([]byte(l))
-	}
-
-	return c
+	return c.AddAll(ListUniqueDataLeaves(root), Workers())
 }
 
 // NewFilledBloomFilter create a new Bloom filter with the given parameters,
 // add the unique leaves contained in the AnonTree with the given root and
 // return the Bloom filter
-func NewFilledBloomFilter(param []uint, root *html.Node) *CBF {
-	return NewBloomFilter(param).AddUniqueLeaves(root)
+func NewFilledBloomFilter(param []uint, root *html.Node) (*CBF, error) {
+	c, err := NewBloomFilter(param)
+	if err != nil {
+		return nil, err
+	}
+	return c.AddUniqueLeaves(root), nil
+}
+
+// NewFilledBloomFilterLeaves is NewFilledBloomFilter for the given unique
+// leaves, e.g. listed by a LeafExtractor
+func NewFilledBloomFilterLeaves(param []uint, leaves []string) (*CBF, error) {
+	c, err := NewBloomFilter(param)
+	if err != nil {
+		return nil, err
+	}
+	return c.AddAll(leaves, Workers()), nil
 }
 
 // Add add an elements e to the counting Bloom Filter c
 func (c *CBF) Add(e []byte) *CBF {
-	h := hashes(e)
-	for i := uint(0); i < c.K; i++ {
-		location := c.location(h, i)
+	var buf [stackLocations]uint
+	for _, location := range c.locations(e, buf[:0], nil) {
 		if c.Set[location] == 0 {
 			c.Set[location]++
 		}
@@ -97,13 +220,60 @@ func (c *CBF) Add(e []byte) *CBF {
 	return c
 }
 
+// AddAll adds the elements to c, like Add. If there are at least
+// parallelLeaves elements, the locations are computed by the given number of
+// workers. Return c to allow chaining
+func (c *CBF) AddAll(elements []string, workers int) *CBF {
+	if len(elements) < parallelLeaves || workers < 2 {
+		l := c.newLocator()
+		var buf []uint
+		for _, e := range elements {
+			buf = c.locations([]byte(e), buf[:0], l)
+			for _, location := range buf {
+				if c.Set[location] == 0 {
+					c.Set[location] = 1
+				}
+			}
+		}
+		return c
+	}
+
+	// the empty buckets are only set to 1 as Add does, so the workers
+	// don't need to agree on the order of the writes
+	var wg sync.WaitGroup
+	chunk := (len(elements) + workers - 1) / workers
+	for start := 0; start < len(elements); start += chunk {
+		end := start + chunk
+		if end > len(elements) {
+			end = len(elements)
+		}
+		wg.Add(1)
+		go func(elements []string) {
+			defer wg.Done()
+			l := c.newLocator()
+			var buf []uint
+			for _, e := range elements {
+				buf = c.locations([]byte(e), buf[:0], l)
+				for _, location := range buf {
+					atomic.CompareAndSwapInt64(&c.Set[location], 0, 1)
+				}
+			}
+		}(elements[start:end])
+	}
+	wg.Wait()
+	return c
+}
+
 // Count return an estimate of how many times elements e
-// has been added to the set
+// has been added to the set, at most Max if it is set
 func (c *CBF) Count(e []byte) int64 {
-	min := int64(255)
-	h := hashes(e)
-	for i := uint(0); i < c.K; i++ {
-		counter := c.Set[c.location(h, i)]
+	min := int64(math.MaxInt64)
+	if c.Max > 0 {
+		min = c.Max
+	}
+	var buf [stackLocations]uint
+	for _, location := range c.locations(e, buf[:0], nil) {
+		counter := c.Set[location]
 		if counter < min {
 			min = counter
 		}
@@ -126,6 +296,12 @@ func (c *CBF) Write(stream io.Writer) error {
 		return err
 	}
 
+	// write the hashing version
+	err = binary.Write(stream, binary.BigEndian, uint64(c.Version))
+	if err != nil {
+		return err
+	}
+
 	// finally write set
 	err = binary.Write(stream, binary.BigEndian, c.Set)
 	if err != nil {
@@ -146,31 +322,103 @@ func (c *CBF) Encode() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// hashes returns the four hash of e that are used to create
-// the k hash values
-func hashes(e []byte) [2]*big.Int {
+// locations appends the K locations of e to buf and returns it. The locations
+// of HashingBigInt are computed by l, a new locator if l is nil.
+func (c *CBF) locations(e []byte, buf []uint, l *locator) []uint {
+	if c.M == 0 {
+		return buf
+	}
+	if c.Version == HashingFast64 {
+		return fastLocations(e, uint64(c.M), c.K, buf)
+	}
+	if l == nil {
+		l = c.newLocator()
+	}
+	return append(buf, l.locate(e)...)
+}
+
+// newLocator returns a locator of the HashingBigInt locations of c, nil for
+// the other versions
+func (c *CBF) newLocator() *locator {
+	if c.Version != HashingBigInt {
+		return nil
+	}
+	return newLocator(c.M, c.K)
+}
+
+// fastLocations appends to buf the k HashingFast64 locations of e in a
+// filter of m buckets. The ith location is (a + i * b) mod m, where a and b
+// are the first 64 bits of the SHA-256 and BLAKE2b hashes of e, computed by
+// successive modular additions so that nothing overflows or is allocated.
+func fastLocations(e []byte, m uint64, k uint, buf []uint) []uint {
 	sumSHA := sha256.Sum256(e)
-	a := new(big.Int)
-	a.SetBytes(sumSHA[:])
 	sumBlake := blake2b.Sum256(e)
-	b := new(big.Int)
-	b.SetBytes(sumBlake[:])
+	location := binary.BigEndian.Uint64(sumSHA[:8]) % m
+	step := binary.BigEndian.Uint64(sumBlake[:8]) % m
+	for i := uint(0); i < k; i++ {
+		buf = append(buf, uint(location))
+		// location + step < 2m, computed without overflow
+		if location >= m-step {
+			location -= m - step
+		} else {
+			location += step
+		}
+	}
+	return buf
+}
+
+// locator computes the HashingBigInt locations of the elements in a filter
+// with the given M and K, reusing its buffers from one element to the next.
+// A locator must not be used concurrently.
+type locator struct {
+	m, k      uint
+	modulus   big.Int
+	a, b      big.Int
+	product   big.Int
+	sum       big.Int
+	index     big.Int
+	locations []uint
+}
 
-	return [2]*big.Int{a, b}
+// newLocator returns a locator for a filter with m buckets and k hash
+// functions
+func newLocator(m, k uint) *locator {
+	l := &locator{m: m, k: k, locations: make([]uint, k)}
+	l.modulus.SetUint64(uint64(m))
+	return l
 }
 
-// location returns the ith hashed location using the four base hash values
-// uses a slightly modified version of the double hashing scheme
-// see https://www.eecs.harvard.edu/~michaelm/postscripts/rsa2008.pdf
-func (c *CBF) location(h [2]*big.Int, i uint) uint {
-	secondHash := new(big.Int)
-	sum := new(big.Int)
-	res := new(big.Int)
-	secondHash.Mul(big.NewInt(int64(i)), h[1])
-	sum.Add(h[0], secondHash)
-	res.Mod(sum, big.NewInt(int64(c.M)))
+// locate returns the k locations of e, the returned slice is only valid
+// until the next call. The ith location is (a + i * b) mod m, where a and b
+// are the SHA-256 and BLAKE2b hashes of e, a slightly modified version of the
+// double hashing scheme, see
+// https://www.eecs.harvard.edu/~michaelm/postscripts/rsa2008.pdf
+func (l *locator) locate(e []byte) []uint {
+	if l.m == 0 {
+		return nil
+	}
+	sumSHA := sha256.Sum256(e)
+	l.a.SetBytes(sumSHA[:])
+	sumBlake := blake2b.Sum256(e)
+	l.b.SetBytes(sumBlake[:])
 
-	return uint(res.Uint64())
+	// reduced modulo m, a + i * b fits in 64 bits for the filters that
+	// fit in memory
+	if l.m < 1<<32 && l.k < 1<<31 {
+		a := l.a.Mod(&l.a, &l.modulus).Uint64()
+		b := l.b.Mod(&l.b, &l.modulus).Uint64()
+		for i := range l.locations {
+			l.locations[i] = uint((a + uint64(i)*b) % uint64(l.m))
+		}
+		return l.locations
+	}
+	for i := range l.locations {
+		l.index.SetUint64(uint64(i))
+		l.product.Mul(&l.index, &l.b)
+		l.sum.Add(&l.a, &l.product)
+		l.locations[i] = uint(l.sum.Mod(&l.sum, &l.modulus).Uint64())
+	}
+	return l.locations
 }
 
 // bestParameters return an estimate of m and k given the number of elements n
@@ -181,3 +429,12 @@ func bestParameters(n uint, fpRate float64) (uint, uint) {
 
 	return m, k
 }
+
+// ValidFalsePositiveRate returns an error if fpRate is not 0, meaning the
+// default rate, or strictly between 0 and 1
+func ValidFalsePositiveRate(fpRate float64) error {
+	if fpRate != 0 && (fpRate <= 0 || fpRate >= 1 || math.IsNaN(fpRate)) {
+		return fmt.Errorf("invalid false positive rate %v, must be between 0 and 1", fpRate)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package lib
+
+import (
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func TestCBFParameters(t *testing.T) {
+	root, err := html.Parse(strings.NewReader("<html><body><p>a</p><p>b</p><p>c</p></body></html>"))
+	require.Nil(t, err)
+
+	// 0 means the default rate
+	require.Equal(t, GetOptimalCBFParametersToSend(root, DefaultFalsePositiveRate), GetOptimalCBFParametersToSend(root, 0))
+
+	// a lower rate needs a bigger filter
+	low := GetOptimalCBFParametersToSend(root, 0.0001)
+	high := GetOptimalCBFParametersToSend(root, 0.1)
+	require.True(t, low[0] > high[0])
+
+	require.Nil(t, ValidFalsePositiveRate(0))
+	require.Nil(t, ValidFalsePositiveRate(0.001))
+	require.NotNil(t, ValidFalsePositiveRate(1))
+	require.NotNil(t, ValidFalsePositiveRate(-0.1))
+	require.NotNil(t, ValidFalsePositiveRate(math.NaN()))
+}
+
+// testLeaves returns n distinct leaves
+func testLeaves(n int) []string {
+	leaves := make([]string, n)
+	for i := range leaves {
+		leaves[i] = "leaf " + strconv.Itoa(i)
+	}
+	return leaves
+}
+
+// testFilter returns the filter of the parameters, which must be valid
+func testFilter(tb testing.TB, param []uint) *CBF {
+	c, err := NewBloomFilter(param)
+	require.Nil(tb, err)
+	return c
+}
+
+// testFilterFromSet is testFilter for the given set
+func testFilterFromSet(tb testing.TB, set []int64, param []uint) *CBF {
+	c, err := BloomFilterFromSet(set, param)
+	require.Nil(tb, err)
+	return c
+}
+
+func TestCBFAddAll(t *testing.T) {
+	leaves := testLeaves(5 * parallelLeaves)
+	for _, param := range [][]uint{{50000, 7}, {50000, 7, HashingFast64}} {
+		sequential := testFilter(t, param)
+		for _, l := range leaves {
+			sequential.Add([]byte(l))
+		}
+		for _, workers := range []int{1, 3, 8} {
+			parallel := testFilter(t, param).AddAll(leaves, workers)
+			require.Equal(t, sequential.Set, parallel.Set, "workers %d", workers)
+		}
+		for _, l := range leaves {
+			require.Equal(t, int64(1), sequential.Count([]byte(l)))
+		}
+
+		// the buckets already set keep their value
+		set := make([]int64, 50000)
+		for i := range set {
+			set[i] = 3
+		}
+		c := testFilterFromSet(t, set, param).AddAll(leaves, 4)
+		require.Equal(t, int64(3), c.Count([]byte(leaves[0])))
+	}
+}
+
+func TestCBFCounterOverflow(t *testing.T) {
+	require.Equal(t, 1, CounterWidth(1))
+	require.Equal(t, 8, CounterWidth(255))
+	require.Equal(t, 9, CounterWidth(256))
+	require.Equal(t, int64(511), CounterMax(CounterWidth(300)))
+
+	// the counts of more than 255 conodes are not truncated
+	param := []uint{1000, 3, HashingFast64}
+	c := testFilter(t, param).Add([]byte("leaf"))
+	for i := range c.Set {
+		c.Set[i] *= 300
+	}
+	require.Equal(t, int64(300), c.Count([]byte("leaf")))
+	c.Max = CounterMax(8)
+	require.Equal(t, int64(255), c.Count([]byte("leaf")))
+}
+
+func TestCBFHashingVersions(t *testing.T) {
+	root, err := html.Parse(strings.NewReader("<html><body><p>a</p></body></html>"))
+	require.Nil(t, err)
+	param := GetOptimalCBFParametersToSend(root, 0)
+	require.Len(t, param, 3)
+	require.Equal(t, uint64(CurrentHashing), param[2])
+	received, err := ParametersFromSent(param)
+	require.Nil(t, err)
+	require.Equal(t, param, ParametersToSend(received))
+
+	// the parameters of the old filters have no version
+	old := testFilter(t, []uint{1000, 5}).Add([]byte("leaf"))
+	require.Equal(t, uint(HashingBigInt), old.Version)
+	fast := testFilter(t, []uint{1000, 5, HashingFast64}).Add([]byte("leaf"))
+	require.NotEqual(t, old.Set, fast.Set)
+	require.Equal(t, int64(1), testFilterFromSet(t, old.Set, []uint{1000, 5}).Count([]byte("leaf")))
+	require.Equal(t, int64(1), testFilterFromSet(t, fast.Set, []uint{1000, 5, HashingFast64}).Count([]byte("leaf")))
+
+	// unknown versions and incomplete parameters are refused
+	_, err = ParametersFromSent([]uint64{1000, 5, HashingFast64 + 1})
+	require.NotNil(t, err)
+	_, err = ParametersFromSent([]uint64{1000})
+	require.NotNil(t, err)
+	_, err = NewBloomFilter([]uint{1000, 5, 7})
+	require.NotNil(t, err)
+	_, err = BloomFilterFromSet(old.Set, nil)
+	require.NotNil(t, err)
+
+	// the fast hashing doesn't allocate
+	allocs := testing.AllocsPerRun(100, func() {
+		fast.Count([]byte("leaf"))
+	})
+	require.Equal(t, float64(0), allocs)
+}
+
+func BenchmarkCBFAddSequential(b *testing.B) {
+	benchmarkCBFAddAll(b, 1, CurrentHashing)
+}
+
+func BenchmarkCBFAddParallel(b *testing.B) {
+	benchmarkCBFAddAll(b, runtime.NumCPU(), CurrentHashing)
+}
+
+func BenchmarkCBFAddBigInt(b *testing.B) {
+	benchmarkCBFAddAll(b, 1, HashingBigInt)
+}
+
+func benchmarkCBFAddAll(b *testing.B, workers int, version uint) {
+	leaves := testLeaves(50000)
+	m, k := bestParameters(uint(len(leaves)), DefaultFalsePositiveRate)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		testFilter(b, []uint{m, k, version}).AddAll(leaves, workers)
+	}
+}
+
+func BenchmarkCBFCount(b *testing.B) {
+	benchmarkCBFCount(b, CurrentHashing)
+}
+
+func BenchmarkCBFCountBigInt(b *testing.B) {
+	benchmarkCBFCount(b, HashingBigInt)
+}
+
+func benchmarkCBFCount(b *testing.B, version uint) {
+	leaves := testLeaves(1000)
+	m, k := bestParameters(uint(len(leaves)), DefaultFalsePositiveRate)
+	c := testFilter(b, []uint{m, k, version}).AddAll(leaves, 1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Count([]byte(leaves[i%len(leaves)]))
+	}
+}
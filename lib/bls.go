@@ -0,0 +1,130 @@
+package lib
+
+/*
+The bls.go defines the BLS aggregate signatures of the archives set up with
+decenarch.SchemeBLS. An aggregated signature is the sum of the BLS signatures
+of the signers followed by their mask, in the order of the roster as the
+collective signatures of ftcosi, and is verified against the BLS keys stored
+with it, see decenarch.SignerKey. The verification is defined by the package
+client/verify, for the verifiers without a conode.
+*/
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/bls"
+	"gopkg.in/dedis/kyber.v2/sign/cosi"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/kyber.v2/util/encoding"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/client/verify"
+)
+
+// NewBLSKey returns a new BLS private key
+func NewBLSKey() kyber.Scalar {
+	private, _ := bls.NewKeyPair(decenarch.BLSSuite, decenarch.BLSSuite.RandomStream())
+	return private
+}
+
+// NewSignerKey returns the BLS key of private, endorsed by the conode of
+// private key conode
+func NewSignerKey(conode kyber.Scalar, private kyber.Scalar) (*decenarch.SignerKey, error) {
+	public, err := decenarch.BLSSuite.G2().Point().Mul(private, nil).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	possession, err := bls.Sign(decenarch.BLSSuite, private, decenarch.PossessionMessage(public))
+	if err != nil {
+		return nil, err
+	}
+	endorsement, err := schnorr.Sign(decenarch.Suite, conode, decenarch.EndorsementMessage(public))
+	if err != nil {
+		return nil, err
+	}
+	hexConode, err := encoding.PointToStringHex(decenarch.Suite, decenarch.Suite.Point().Mul(conode, nil))
+	if err != nil {
+		return nil, err
+	}
+	return &decenarch.SignerKey{Conode: hexConode, Public: public, Possession: possession, Endorsement: endorsement}, nil
+}
+
+// SignerPublic returns the BLS public key of k, or an error if k is not the
+// key of the conode of public key conode, see verify.SignerPublic
+func SignerPublic(k decenarch.SignerKey, conode kyber.Point) (kyber.Point, error) {
+	return verify.SignerPublic(k, conode)
+}
+
+// SignerPublics returns the BLS public keys of the conodes of publics, in
+// order, from keys. The conodes without a valid key in keys get nil.
+func SignerPublics(publics []kyber.Point, keys []decenarch.SignerKey) []kyber.Point {
+	return verify.SignerPublics(publics, keys)
+}
+
+// AggregateBLS returns the aggregated signature of the BLS signatures sigs,
+// by index of the signer in signers, the BLS public keys of the roster
+func AggregateBLS(signers []kyber.Point, sigs map[int][]byte) ([]byte, error) {
+	mask, err := verify.NewBLSMask(signers)
+	if err != nil {
+		return nil, err
+	}
+	var all [][]byte
+	for i, sig := range sigs {
+		if i < 0 || i >= len(signers) || signers[i] == nil {
+			return nil, fmt.Errorf("no BLS key for the signature of conode %d", i)
+		}
+		if err := mask.SetBit(i, true); err != nil {
+			return nil, err
+		}
+		all = append(all, sig)
+	}
+	if len(all) == 0 {
+		return nil, errors.New("no BLS signature to aggregate")
+	}
+	agg, err := bls.AggregateSignatures(decenarch.BLSSuite, all...)
+	if err != nil {
+		return nil, err
+	}
+	return append(agg, mask.Mask()...), nil
+}
+
+// BLSSignerMask returns the mask of the conodes of publics whose BLS
+// signatures are aggregated in sig, see verify.BLSSignerMask
+func BLSSignerMask(publics []kyber.Point, keys []decenarch.SignerKey, sig []byte) (*cosi.Mask, error) {
+	return verify.BLSSignerMask(publics, keys, sig)
+}
+
+// VerifyBLS returns an error if sig is not an aggregated BLS signature of msg
+// by conodes of publics accepted by policy, see verify.VerifyBLS
+func VerifyBLS(publics []kyber.Point, keys []decenarch.SignerKey, msg, sig []byte, policy cosi.Policy) error {
+	return verify.VerifyBLS(publics, keys, msg, sig, policy)
+}
+
+// VerifySignature returns an error if sig is not a signature of msg with the
+// scheme by at least threshold conodes of publics, see
+// verify.VerifySignature. keys are only used by decenarch.SchemeBLS.
+func VerifySignature(scheme string, publics []kyber.Point, keys []decenarch.SignerKey, msg, sig []byte, threshold int) error {
+	return verify.VerifySignature(scheme, publics, keys, msg, sig, threshold)
+}
+
+// SignatureMask returns the mask of the conodes of publics that took part in
+// the signature sig of the scheme, see verify.SignatureMask. keys are only
+// used by decenarch.SchemeBLS.
+func SignatureMask(scheme string, publics []kyber.Point, keys []decenarch.SignerKey, sig []byte) (*cosi.Mask, error) {
+	return verify.SignatureMask(scheme, publics, keys, sig)
+}
+
+// MaskBytes returns the participation mask stored after the signature sig of
+// the scheme, nil if sig is too short to hold one
+func MaskBytes(scheme string, sig []byte) []byte {
+	lenSig := decenarch.CosiSuite.PointLen() + decenarch.CosiSuite.ScalarLen()
+	if scheme == decenarch.SchemeBLS {
+		lenSig = decenarch.BLSSuite.G1().PointLen()
+	}
+	if len(sig) <= lenSig {
+		return nil
+	}
+	return append([]byte{}, sig[lenSig:]...)
+}
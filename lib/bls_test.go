@@ -0,0 +1,68 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/bls"
+	"gopkg.in/dedis/kyber.v2/util/key"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestVerifyBLS(t *testing.T) {
+	msg := []byte("page")
+
+	// three conodes, the last one offline while signing
+	kps := []*key.Pair{key.NewKeyPair(decenarch.Suite), key.NewKeyPair(decenarch.Suite), key.NewKeyPair(decenarch.Suite)}
+	publics := []kyber.Point{kps[0].Public, kps[1].Public, kps[2].Public}
+	var keys []decenarch.SignerKey
+	signers := make([]kyber.Point, 3)
+	sigs := make(map[int][]byte)
+	for i := 0; i < 2; i++ {
+		private := NewBLSKey()
+		k, err := NewSignerKey(kps[i].Private, private)
+		require.NoError(t, err)
+		keys = append(keys, *k)
+		signers[i], err = SignerPublic(*k, publics[i])
+		require.NoError(t, err)
+		sigs[i], err = bls.Sign(decenarch.BLSSuite, private, msg)
+		require.NoError(t, err)
+	}
+	sig, err := AggregateBLS(signers, sigs)
+	require.NoError(t, err)
+	require.Equal(t, decenarch.BLSSuite.G1().PointLen()+1, len(sig))
+
+	mask, err := BLSSignerMask(publics, keys, sig)
+	require.NoError(t, err)
+	require.Equal(t, 2, mask.CountEnabled())
+	require.NoError(t, VerifySignature(decenarch.SchemeBLS, publics, keys, msg, sig, 2))
+	err = VerifySignature(decenarch.SchemeBLS, publics, keys, msg, sig, 3)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "signed by 2 conodes")
+	require.Error(t, VerifySignature(decenarch.SchemeBLS, publics, keys, []byte("other"), sig, 2))
+
+	// the keys must be endorsed by the conodes of the roster
+	_, err = SignerPublic(keys[0], publics[1])
+	require.Error(t, err)
+	forged := keys[1]
+	forged.Conode = keys[0].Conode
+	_, err = SignerPublic(forged, publics[0])
+	require.Error(t, err)
+	require.Error(t, VerifySignature(decenarch.SchemeBLS, publics, keys[:1], msg, sig, 2))
+
+	// a key without proof of possession is refused
+	noPossession := keys[0]
+	noPossession.Possession = keys[1].Possession
+	_, err = SignerPublic(noPossession, publics[0])
+	require.Error(t, err)
+
+	// the signature must be checked against the roster that signed it
+	require.Error(t, VerifySignature(decenarch.SchemeBLS, []kyber.Point{publics[2], publics[1], publics[0]}, keys, msg, sig, 2))
+	larger := append(publics, make([]kyber.Point, 6)...)
+	for i := 3; i < len(larger); i++ {
+		larger[i] = key.NewKeyPair(decenarch.Suite).Public
+	}
+	require.Error(t, VerifySignature(decenarch.SchemeBLS, larger, keys, msg, sig, 2))
+}
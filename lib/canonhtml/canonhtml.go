@@ -0,0 +1,95 @@
+/*
+Package canonhtml defines the canonical serialization of the consensus pages.
+html.Render writes the attributes in the order of the tree of the root, so two
+honest roots agreeing on the same leaves could sign different bytes. The
+canonical serialization sorts the attributes, keeps the first of duplicated
+attributes, merges the adjacent text nodes and writes the void elements, e.g.
+<br>, in their self-closing form <br/>, whatever their form in the page
+fetched. It is used by the roots to build the consensus page and by the
+conodes to check the page before signing it.
+*/
+package canonhtml
+
+import (
+	"bytes"
+	"io"
+	"sort"
+
+	"golang.org/x/net/html"
+)
+
+// voidElements are the elements without content, written in their
+// self-closing form
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "keygen": true, "link": true,
+	"meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// Normalize puts the tree of n in its canonical form, in place
+func Normalize(n *html.Node) {
+	if n.Type == html.ElementNode {
+		n.Attr = canonicalAttributes(n.Attr)
+		if voidElements[n.Data] && n.Namespace == "" {
+			for c := n.FirstChild; c != nil; c = n.FirstChild {
+				n.RemoveChild(c)
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		for c.Type == html.TextNode && c.NextSibling != nil && c.NextSibling.Type == html.TextNode {
+			next := c.NextSibling
+			c.Data += next.Data
+			n.RemoveChild(next)
+		}
+		Normalize(c)
+	}
+}
+
+// canonicalAttributes returns the attributes sorted by namespace and key,
+// without the duplicates
+func canonicalAttributes(attrs []html.Attribute) []html.Attribute {
+	seen := make(map[html.Attribute]bool)
+	canonical := make([]html.Attribute, 0, len(attrs))
+	for _, a := range attrs {
+		name := html.Attribute{Namespace: a.Namespace, Key: a.Key}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		canonical = append(canonical, a)
+	}
+	sort.SliceStable(canonical, func(i, j int) bool {
+		if canonical[i].Namespace != canonical[j].Namespace {
+			return canonical[i].Namespace < canonical[j].Namespace
+		}
+		return canonical[i].Key < canonical[j].Key
+	})
+	return canonical
+}
+
+// Render writes the canonical serialization of the tree of n to w. The tree
+// is normalized in place, see Normalize.
+func Render(w io.Writer, n *html.Node) error {
+	Normalize(n)
+	return html.Render(w, n)
+}
+
+// Canonical returns the canonical serialization of the HTML page
+func Canonical(page []byte) ([]byte, error) {
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := Render(&b, doc); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// IsCanonical returns true if the HTML page is in its canonical serialization
+func IsCanonical(page []byte) bool {
+	canonical, err := Canonical(page)
+	return err == nil && bytes.Equal(canonical, page)
+}
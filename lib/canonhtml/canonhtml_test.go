@@ -0,0 +1,33 @@
+package canonhtml
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func TestCanonical(t *testing.T) {
+	a, err := Canonical([]byte(`<html><body><img src="a.png" alt="a"><br><p class="x" id="p">text</p></body></html>`))
+	require.Nil(t, err)
+	b, err := Canonical([]byte(`<html><body><img alt="a" src="a.png" alt="b"/><br/><p id="p" class="x">text</p></body></html>`))
+	require.Nil(t, err)
+	require.Equal(t, string(a), string(b))
+	require.Equal(t, `<html><head></head><body><img alt="a" src="a.png"/><br/><p class="x" id="p">text</p></body></html>`, string(a))
+	require.True(t, IsCanonical(a))
+	require.False(t, IsCanonical([]byte(`<html><head></head><body><p id="p" class="x">text</p></body></html>`)))
+}
+
+func TestRenderPrunedTree(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<html><body><p title="t" class="c">one<br>two</p></body></html>`))
+	require.Nil(t, err)
+	// the consensus page drops the leaves that are not agreed on
+	p := doc.FirstChild.LastChild.FirstChild
+	p.RemoveChild(p.FirstChild.NextSibling)
+	var b bytes.Buffer
+	require.Nil(t, Render(&b, doc))
+	require.Equal(t, `<html><head></head><body><p class="c" title="t">onetwo</p></body></html>`, b.String())
+	require.True(t, IsCanonical(b.Bytes()))
+}
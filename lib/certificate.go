@@ -0,0 +1,57 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+)
+
+// CertificateHash returns the hex encoded SHA-256 hash of a DER encoded
+// certificate, used by the conodes to agree on the certificate served by the
+// origin
+func CertificateHash(der []byte) string {
+	h := sha256.Sum256(der)
+	return hex.EncodeToString(h[:])
+}
+
+// CertificateChain returns the DER encoded certificates presented by the
+// server of a TLS connection, leaf first. It returns nil if the connection
+// didn't use TLS.
+func CertificateChain(state *tls.ConnectionState) [][]byte {
+	if state == nil {
+		return nil
+	}
+	chain := make([][]byte, len(state.PeerCertificates))
+	for i, c := range state.PeerCertificates {
+		chain[i] = c.Raw
+	}
+	return chain
+}
+
+// MostCommonCertificate returns the certificate hash present at least
+// threshold times in hashes, ignoring empty hashes. It returns an empty string
+// if no hash reaches the threshold.
+func MostCommonCertificate(hashes []string, threshold int) string {
+	return MostCommon(hashes, threshold)
+}
+
+// MostCommon returns the value present at least threshold times in values,
+// ignoring empty values. It returns an empty string if no value reaches the
+// threshold.
+func MostCommon(values []string, threshold int) string {
+	counts := make(map[string]int)
+	best, bestCount := "", 0
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		counts[v]++
+		if counts[v] > bestCount {
+			best, bestCount = v, counts[v]
+		}
+	}
+	if bestCount < threshold || bestCount == 0 {
+		return ""
+	}
+	return best
+}
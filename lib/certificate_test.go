@@ -0,0 +1,30 @@
+package lib
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificateChain(t *testing.T) {
+	require.Nil(t, CertificateChain(nil))
+
+	state := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{Raw: []byte("leaf")}, {Raw: []byte("ca")}},
+	}
+	chain := CertificateChain(state)
+	require.Equal(t, [][]byte{[]byte("leaf"), []byte("ca")}, chain)
+	require.Equal(t, CertificateHash([]byte("leaf")), CertificateHash(chain[0]))
+	require.NotEqual(t, CertificateHash(chain[0]), CertificateHash(chain[1]))
+}
+
+func TestMostCommonCertificate(t *testing.T) {
+	require.Equal(t, "", MostCommonCertificate(nil, 0))
+	require.Equal(t, "", MostCommonCertificate([]string{"", ""}, 0))
+
+	hashes := []string{"a", "b", "a", "", "a", "b"}
+	require.Equal(t, "a", MostCommonCertificate(hashes, 3))
+	require.Equal(t, "", MostCommonCertificate(hashes, 4))
+}
@@ -3,24 +3,97 @@ package lib
 // adapted from https://github.com/lca1/unlynx/blob/master/lib/constants.go
 
 import (
+	"context"
+	"runtime"
 	"sync"
-
-	decenarch "github.com/dedis/student_18_decenar"
+	"sync/atomic"
 )
 
-// PARALLELIZE is true if we use protocols with parallelization of computations.
-const PARALLELIZE = true
-
 // VPARALLELIZE allows to choose the level of parallelization in the vector computations
 const VPARALLELIZE = 50
 
-// just to avoid changing everywhere
-var SuiTe = decenarch.Suite
+// workers is the number of goroutines of the vector computations, 0 means
+// GOMAXPROCS, see SetWorkers
+var workers int32
+
+// SetWorkers sets the number of goroutines of the vector computations of the
+// conode. Zero or less means GOMAXPROCS, and 1 disables the parallelization.
+func SetWorkers(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt32(&workers, int32(n))
+}
+
+// Workers returns the number of goroutines of the vector computations, see
+// SetWorkers
+func Workers() int {
+	if n := atomic.LoadInt32(&workers); n > 0 {
+		return int(n)
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// workersKey is the key of the per-save limit of the workers in a context
+type workersKey struct{}
+
+// WithWorkers returns a copy of ctx limiting the vector computations run with
+// it to n goroutines, so that a big save cannot starve the other services of
+// the conode. Zero or less means no limit other than Workers.
+func WithWorkers(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, workersKey{}, n)
+}
+
+// ContextWorkers returns the number of goroutines of the vector computations
+// run with ctx, the limit of WithWorkers capped by Workers
+func ContextWorkers(ctx context.Context) int {
+	w := Workers()
+	if n, ok := ctx.Value(workersKey{}).(int); ok && n > 0 && n < w {
+		return n
+	}
+	return w
+}
+
+// ParallelFor calls f on the batches [start, end) of VPARALLELIZE indices of
+// [0, length), with ContextWorkers(ctx) goroutines. No batch is started once
+// ctx is done, and the error of ctx is returned.
+func ParallelFor(ctx context.Context, length int, f func(start, end int)) error {
+	n := ContextWorkers(ctx)
+	if batches := (length + VPARALLELIZE - 1) / VPARALLELIZE; batches < n {
+		n = batches
+	}
+	var wg sync.WaitGroup
+	starts := make(chan int)
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range starts {
+				end := start + VPARALLELIZE
+				if end > length {
+					end = length
+				}
+				f(start, end)
+			}
+		}()
+	}
+loop:
+	for start := 0; start < length; start += VPARALLELIZE {
+		select {
+		case starts <- start:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(starts)
+	wg.Wait()
+	return ctx.Err()
+}
 
 // StartParallelize starts parallelization by instanciating number of threads
 func StartParallelize(nbrWg int) *sync.WaitGroup {
 	var wg sync.WaitGroup
-	if PARALLELIZE {
+	if Workers() > 1 {
 		wg.Add(nbrWg)
 	}
 	return &wg
@@ -28,7 +101,7 @@ func StartParallelize(nbrWg int) *sync.WaitGroup {
 
 // EndParallelize waits for a number of threads to finish
 func EndParallelize(wg *sync.WaitGroup) {
-	if PARALLELIZE {
+	if Workers() > 1 {
 		wg.Wait()
 	}
 }
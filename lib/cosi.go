@@ -0,0 +1,26 @@
+package lib
+
+import (
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/cosi"
+
+	"github.com/dedis/student_18_decenar/client/verify"
+)
+
+// SignerMask returns the mask of the conodes of publics that took part in the
+// collective signature, see verify.SignerMask
+func SignerMask(publics []kyber.Point, sig []byte) (*cosi.Mask, error) {
+	return verify.SignerMask(publics, sig)
+}
+
+// MaskIndices returns the indices of the conodes enabled in mask, in the order
+// of the roster
+func MaskIndices(mask *cosi.Mask) []int {
+	return verify.MaskIndices(mask)
+}
+
+// VerifyCosi returns an error if sig is not a collective signature of msg by
+// at least threshold conodes of publics, see verify.VerifyCosi
+func VerifyCosi(publics []kyber.Point, msg, sig []byte, threshold int) error {
+	return verify.VerifyCosi(publics, msg, sig, threshold)
+}
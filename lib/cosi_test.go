@@ -0,0 +1,43 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/util/key"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib/cositest"
+)
+
+func TestVerifyCosi(t *testing.T) {
+	suite := decenarch.CosiSuite
+	msg := []byte("page")
+
+	// three conodes, the last one offline while signing
+	kps := []*key.Pair{key.NewKeyPair(suite), key.NewKeyPair(suite), key.NewKeyPair(suite)}
+	publics := []kyber.Point{kps[0].Public, kps[1].Public, kps[2].Public}
+	sig, err := cositest.Sign(suite, kps, []int{0, 1}, msg)
+	require.NoError(t, err)
+
+	signers, err := SignerMask(publics, sig)
+	require.NoError(t, err)
+	require.Equal(t, 2, signers.CountEnabled())
+
+	require.NoError(t, VerifyCosi(publics, msg, sig, 2))
+	err = VerifyCosi(publics, msg, sig, 3)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "signed by 2 conodes")
+	require.Error(t, VerifyCosi(publics, []byte("other"), sig, 2))
+
+	// the signature must be checked against the roster that signed it
+	require.Error(t, VerifyCosi([]kyber.Point{publics[2], publics[1], publics[0]}, msg, sig, 2))
+	larger := append(publics, make([]kyber.Point, 6)...)
+	for i := 3; i < len(larger); i++ {
+		larger[i] = key.NewKeyPair(suite).Public
+	}
+	err = VerifyCosi(larger, msg, sig, 2)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "roster of 9 conodes")
+}
@@ -0,0 +1,58 @@
+/*
+Package cositest makes the collective signatures of the tests as the signing
+protocols of the conodes make them, without running the protocols, so that
+the tests of the verifications don't need a roster of conodes. It only
+depends on kyber, so that the light client can use it too.
+*/
+package cositest
+
+import (
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/cosi"
+	"gopkg.in/dedis/kyber.v2/util/key"
+)
+
+// Sign returns the collective signature of msg by the conodes of kps, in the
+// order of the roster, whose index is in signers. All the conodes sign if
+// signers is empty, the others are left out of the mask as offline conodes.
+func Sign(suite cosi.Suite, kps []*key.Pair, signers []int, msg []byte) ([]byte, error) {
+	publics := make([]kyber.Point, len(kps))
+	for i, kp := range kps {
+		publics[i] = kp.Public
+	}
+	if len(signers) == 0 {
+		signers = make([]int, len(kps))
+		for i := range signers {
+			signers[i] = i
+		}
+	}
+	mask, err := cosi.NewMask(suite, publics, nil)
+	if err != nil {
+		return nil, err
+	}
+	commitment := suite.Point().Null()
+	randoms := make([]kyber.Scalar, len(signers))
+	for i, s := range signers {
+		var v kyber.Point
+		randoms[i], v = cosi.Commit(suite)
+		commitment.Add(commitment, v)
+		if err := mask.SetBit(s, true); err != nil {
+			return nil, err
+		}
+	}
+	challenge, err := cosi.Challenge(suite, commitment, mask.AggregatePublic, msg)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]kyber.Scalar, len(signers))
+	for i, s := range signers {
+		if responses[i], err = cosi.Response(suite, kps[s].Private, randoms[i], challenge); err != nil {
+			return nil, err
+		}
+	}
+	response, err := cosi.AggregateResponses(suite, responses)
+	if err != nil {
+		return nil, err
+	}
+	return cosi.Sign(suite, commitment, response, mask)
+}
@@ -3,6 +3,8 @@ package lib
 // adapted from https://github.com/lca1/unlynx/blob/master/lib/crypto.go
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"sync"
 
@@ -10,9 +12,13 @@ import (
 	"gopkg.in/dedis/kyber.v2"
 	"gopkg.in/dedis/kyber.v2/util/random"
 	"gopkg.in/dedis/onet.v2/log"
+
+	decenarch "github.com/dedis/student_18_decenar"
 )
 
 // MaxHomomorphicInt is upper bound for integers used in messages, a failed decryption will return this value.
+// The buckets of the aggregated filters are decrypted with the bound derived
+// from the roster instead, see CounterMax.
 const MaxHomomorphicInt int64 = 100000
 
 // PointToInt creates a map between EC points and integers.
@@ -35,14 +41,14 @@ type CipherVector []CipherText
 
 // NewCipherText creates a ciphertext of null elements.
 func NewCipherText() *CipherText {
-	return &CipherText{K: SuiTe.Point().Null(), C: SuiTe.Point().Null()}
+	return &CipherText{K: decenarch.Suite.Point().Null(), C: decenarch.Suite.Point().Null()}
 }
 
 // NewCipherVector creates a ciphervector of null elements.
 func NewCipherVector(length int) *CipherVector {
 	cv := make(CipherVector, length)
 	for i := 0; i < length; i++ {
-		cv[i] = CipherText{SuiTe.Point().Null(), SuiTe.Point().Null()}
+		cv[i] = CipherText{decenarch.Suite.Point().Null(), decenarch.Suite.Point().Null()}
 	}
 	return &cv
 }
@@ -52,8 +58,8 @@ func NewCipherVector(length int) *CipherVector {
 
 // GenKey permits to generate a public/private key pairs.
 func GenKey() (secKey kyber.Scalar, pubKey kyber.Point) {
-	secKey = SuiTe.Scalar().Pick(random.New())
-	pubKey = SuiTe.Point().Mul(secKey, SuiTe.Point().Base())
+	secKey = decenarch.Suite.Scalar().Pick(random.New())
+	pubKey = decenarch.Suite.Point().Mul(secKey, decenarch.Suite.Point().Base())
 	return
 }
 
@@ -64,21 +70,21 @@ func GenKey() (secKey kyber.Scalar, pubKey kyber.Point) {
 // encrypt it using ElGamal encryption. Returns also the DLEQ proof used to
 // verify the correctness of the encrypted point
 func encryptPoint(pubkey kyber.Point, M kyber.Point) (*CipherText, *CipherTextProof) {
-	B := SuiTe.Point().Base()
-	k := SuiTe.Scalar().Pick(random.New()) // ephemeral private key
+	B := decenarch.Suite.Point().Base()
+	k := decenarch.Suite.Scalar().Pick(random.New()) // ephemeral private key
 	// ElGamal-encrypt the point to produce ciphertext (K,C).
-	K := SuiTe.Point().Mul(k, B)      // ephemeral DH public key
-	S := SuiTe.Point().Mul(k, pubkey) // ephemeral DH shared secret
-	C := S.Add(S, M)                  // message blinded with secret
+	K := decenarch.Suite.Point().Mul(k, B)      // ephemeral DH public key
+	S := decenarch.Suite.Point().Mul(k, pubkey) // ephemeral DH shared secret
+	C := S.Add(S, M)                            // message blinded with secret
 	cipher := &CipherText{K, C}
 	return cipher, CreateCipherTextProof(cipher, pubkey, k)
 }
 
 // IntToPoint maps an integer to a point in the elliptic curve
 func IntToPoint(integer int64) kyber.Point {
-	B := SuiTe.Point().Base()
-	i := SuiTe.Scalar().SetInt64(integer)
-	M := SuiTe.Point().Mul(i, B)
+	B := decenarch.Suite.Point().Base()
+	i := decenarch.Suite.Scalar().SetInt64(integer)
+	M := decenarch.Suite.Point().Mul(i, B)
 	return M
 }
 
@@ -94,7 +100,7 @@ func OneToPoint() kyber.Point {
 
 // PointToCipherText converts a point into a ciphertext
 func PointToCipherText(point kyber.Point) CipherText {
-	return CipherText{K: SuiTe.Point().Null(), C: point}
+	return CipherText{K: decenarch.Suite.Point().Null(), C: point}
 }
 
 // IntToCipherText converts an int into a ciphertext
@@ -104,40 +110,46 @@ func IntToCipherText(integer int64) CipherText {
 
 // EncryptInt encodes i as iB, encrypt it into a CipherText and returns a pointer to it.
 func EncryptInt(pubkey kyber.Point, integer int64) (*CipherText, *CipherTextProof) {
-	return encryptPoint(pubkey, IntToPoint(integer))
+	return encryptPoint(pubkey, messagePoint(integer))
+}
+
+// messagePoint is IntToPoint without scalar multiplication for 0 and 1, the
+// values of the buckets of the Bloom filters
+func messagePoint(integer int64) kyber.Point {
+	switch integer {
+	case 0:
+		return decenarch.Suite.Point().Null()
+	case 1:
+		return decenarch.Suite.Point().Base()
+	}
+	return IntToPoint(integer)
 }
 
 // EncryptIntVector encrypts a []int into a CipherVector and returns a pointer
 // to it. A vector of DLEQ proofs is also returned to prove the correctness of
 // all the ciphertext
 func EncryptIntVector(pubkey kyber.Point, intArray []int64) (*CipherVector, *CipherVectorProof) {
-	var wg sync.WaitGroup
+	cv, cvProof, _ := EncryptIntVectorContext(context.Background(), pubkey, intArray)
+	return cv, cvProof
+}
+
+// EncryptIntVectorContext is EncryptIntVector with the goroutines given by
+// ContextWorkers(ctx). An error is returned if ctx is done before all the
+// integers are encrypted.
+func EncryptIntVectorContext(ctx context.Context, pubkey kyber.Point, intArray []int64) (*CipherVector, *CipherVectorProof, error) {
 	cv := make(CipherVector, len(intArray))
 	cvProof := make(CipherVectorProof, len(intArray))
-	if PARALLELIZE {
-		for i := 0; i < len(intArray); i = i + VPARALLELIZE {
-			wg.Add(1)
-			go func(i int) {
-				for j := 0; j < VPARALLELIZE && (j+i < len(intArray)); j++ {
-					c, p := EncryptInt(pubkey, intArray[j+i])
-					cv[j+i] = *c
-					cvProof[j+i] = p
-
-				}
-				defer wg.Done()
-			}(i)
-
-		}
-		wg.Wait()
-	} else {
-		for i, n := range intArray {
-			cipher, proof := EncryptInt(pubkey, n)
-			cv[i] = *cipher
-			cvProof[i] = proof
+	err := ParallelFor(ctx, len(intArray), func(start, end int) {
+		for i := start; i < end; i++ {
+			c, p := EncryptInt(pubkey, intArray[i])
+			cv[i] = *c
+			cvProof[i] = p
 		}
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return &cv, &cvProof
+	return &cv, &cvProof, nil
 }
 
 // Decryption
@@ -145,8 +157,8 @@ func EncryptIntVector(pubkey kyber.Point, intArray []int64) (*CipherVector, *Cip
 
 // DecryptPoint decrypts an elliptic point from an El-Gamal cipher text.
 func DecryptPoint(prikey kyber.Scalar, c CipherText) kyber.Point {
-	S := SuiTe.Point().Mul(prikey, c.K) // regenerate shared secret
-	M := SuiTe.Point().Sub(c.C, S)      // use to un-blind the message
+	S := decenarch.Suite.Point().Mul(prikey, c.K) // regenerate shared secret
+	M := decenarch.Suite.Point().Sub(c.C, S)      // use to un-blind the message
 	return M
 }
 
@@ -154,7 +166,7 @@ func DecryptPoint(prikey kyber.Scalar, c CipherText) kyber.Point {
 // encoded in the exponent.
 func DecryptInt(prikey kyber.Scalar, cipher CipherText) int64 {
 	M := DecryptPoint(prikey, cipher)
-	return discreteLog(M, false)
+	return GetPointToInt(M)
 }
 
 // DecryptIntVector decrypts a cipherVector.
@@ -168,28 +180,39 @@ func DecryptIntVector(prikey kyber.Scalar, cipherVector *CipherVector) []int64 {
 
 // Brute-force the discrete log go get scalar integer
 func GetPointToInt(P kyber.Point) int64 {
-	return discreteLog(P, false)
+	m, ok := discreteLog(P, false, MaxHomomorphicInt)
+	if !ok {
+		return MaxHomomorphicInt
+	}
+	return m
+}
+
+// GetPointToIntBounded brute-forces the discrete log of P up to bound. It
+// returns false if the integer of P is not in [-bound, bound].
+func GetPointToIntBounded(P kyber.Point, bound int64) (int64, bool) {
+	return discreteLog(P, false, bound)
 }
 
-// Brute-Forces the discrete log for integer decoding.
-func discreteLog(P kyber.Point, checkNeg bool) int64 {
-	B := SuiTe.Point().Base()
+// Brute-Forces the discrete log for integer decoding, up to bound. The
+// integers found by previous calls are cached, whatever their bound.
+func discreteLog(P kyber.Point, checkNeg bool, bound int64) (int64, bool) {
+	B := decenarch.Suite.Point().Base()
 	var Bi kyber.Point
 	var m int64
 
 	object, ok := PointToInt.Get(P.String())
 	if ok == nil && object != nil {
-		return object.(int64)
+		return object.(int64), true
 	}
 	mutex.Lock()
 	if currentGreatestInt == 0 {
-		currentGreatestM = SuiTe.Point().Null()
+		currentGreatestM = decenarch.Suite.Point().Null()
 	}
 
-	BiNeg := SuiTe.Point().Neg(B)
-	for Bi, m = currentGreatestM, currentGreatestInt; !Bi.Equal(P) && !SuiTe.Point().Neg(Bi).Equal(P) && m < MaxHomomorphicInt; Bi, m = Bi.Add(Bi, B), m+1 {
+	BiNeg := decenarch.Suite.Point().Neg(B)
+	for Bi, m = currentGreatestM, currentGreatestInt; !Bi.Equal(P) && !decenarch.Suite.Point().Neg(Bi).Equal(P) && m < bound; Bi, m = Bi.Add(Bi, B), m+1 {
 		if checkNeg {
-			BiNeg := SuiTe.Point().Neg(Bi)
+			BiNeg := decenarch.Suite.Point().Neg(Bi)
 			PointToInt.Put(BiNeg.String(), -m)
 		}
 		PointToInt.Put(Bi.String(), m)
@@ -199,16 +222,12 @@ func discreteLog(P kyber.Point, checkNeg bool) int64 {
 	PointToInt.Put(Bi.String(), m)
 	currentGreatestInt = m
 
-	//no negative responses
-	if m == MaxHomomorphicInt {
-		return 0
-	}
 	mutex.Unlock()
 
-	if SuiTe.Point().Neg(Bi).Equal(P) {
-		return -m
+	if decenarch.Suite.Point().Neg(Bi).Equal(P) {
+		return -m, true
 	}
-	return m
+	return m, Bi.Equal(P)
 }
 
 // Homomorphic operations
@@ -222,27 +241,11 @@ func (c *CipherText) Add(c1, c2 CipherText) {
 
 // Add two ciphervectors and stores result in receiver.
 func (cv *CipherVector) Add(cv1, cv2 CipherVector) {
-	var wg sync.WaitGroup
-	if PARALLELIZE {
-		for i := 0; i < len(cv1); i = i + VPARALLELIZE {
-			wg.Add(1)
-			go func(i int) {
-				for j := 0; j < VPARALLELIZE && (j+i < len(cv1)); j++ {
-					(*cv)[i+j].Add(cv1[i+j], cv2[i+j])
-				}
-				defer wg.Done()
-			}(i)
-
-		}
-
-	} else {
-		for i := range cv1 {
+	ParallelFor(context.Background(), len(cv1), func(start, end int) {
+		for i := start; i < end; i++ {
 			(*cv)[i].Add(cv1[i], cv2[i])
 		}
-	}
-	if PARALLELIZE {
-		wg.Wait()
-	}
+	})
 }
 
 // String returns a string representation of a ciphertext.
@@ -261,25 +264,39 @@ func (c *CipherText) String() string {
 // Conversion
 //______________________________________________________________________________________________________________________
 
+// pointSize is the size in bytes of a marshalled point
+var pointSize = decenarch.Suite.Point().MarshalSize()
+
+// cipherTextSize is the size in bytes of a marshalled CipherText
+var cipherTextSize = 2 * pointSize
+
 // ToBytes converts a CipherVector to a byte array
 func (cv *CipherVector) ToBytes() ([]byte, int) {
-	b := make([]byte, 0)
+	b := bytes.NewBuffer(make([]byte, 0, len(*cv)*cipherTextSize))
 
 	for _, el := range *cv {
-		b = append(b, el.ToBytes()...)
+		el.marshalTo(b)
 	}
 
-	return b, len(*cv)
+	return b.Bytes(), len(*cv)
 }
 
-// FromBytes converts a byte array to a CipherVector. Note that you need to create the (empty) object beforehand.
-func (cv *CipherVector) FromBytes(data []byte, length int) {
-	*cv = make(CipherVector, length)
-	for i, pos := 0, 0; i < length*64; i, pos = i+64, pos+1 {
-		ct := CipherText{}
-		ct.FromBytes(data[i : i+64])
-		(*cv)[pos] = ct
+// FromBytes converts a byte array to a CipherVector. The data usually comes
+// from the network, so an error is returned if it is not made of exactly
+// length valid ciphertexts, and nothing is allocated before the length is
+// checked against the size of the data.
+func (cv *CipherVector) FromBytes(data []byte, length int) error {
+	if length < 0 || length > len(data)/cipherTextSize || len(data) != length*cipherTextSize {
+		return fmt.Errorf("%d bytes don't encode %d ciphertexts", len(data), length)
+	}
+	v := make(CipherVector, length)
+	for i := range v {
+		if err := v[i].FromBytes(data[i*cipherTextSize : (i+1)*cipherTextSize]); err != nil {
+			return fmt.Errorf("ciphertext %d: %v", i, err)
+		}
 	}
+	*cv = v
+	return nil
 }
 
 // ToBytes converts a CipherText to a byte array
@@ -292,28 +309,38 @@ func (c *CipherText) ToBytes() []byte {
 	if errC != nil {
 		log.Fatal(errC)
 	}
-	b := append(k, cP...)
+	b := make([]byte, 0, len(k)+len(cP))
+	b = append(b, k...)
+	b = append(b, cP...)
 
 	return b
 }
 
-// FromBytes converts a byte array to a CipherText. Note that you need to create the (empty) object beforehand.
-func (c *CipherText) FromBytes(data []byte) {
-	(*c).K = SuiTe.Point()
-	(*c).C = SuiTe.Point()
-
-	(*c).K.UnmarshalBinary(data[:32])
-	(*c).C.UnmarshalBinary(data[32:])
+// FromBytes converts a byte array to a CipherText. An error is returned if the
+// data is not made of two valid points.
+func (c *CipherText) FromBytes(data []byte) error {
+	if len(data) != cipherTextSize {
+		return fmt.Errorf("%d bytes don't encode a ciphertext", len(data))
+	}
+	k := decenarch.Suite.Point()
+	if err := k.UnmarshalBinary(data[:pointSize]); err != nil {
+		return err
+	}
+	cP := decenarch.Suite.Point()
+	if err := cP.UnmarshalBinary(data[pointSize:]); err != nil {
+		return err
+	}
+	(*c).K = k
+	(*c).C = cP
+	return nil
 }
 
 // AbstractPointsToBytes converts an array of kyber.Point to a byte array
 func AbstractPointsToBytes(aps []kyber.Point) []byte {
-	var err error
-	var apsBytes []byte
-	response := make([]byte, 0)
+	response := make([]byte, 0, len(aps)*pointSize)
 
 	for i := range aps {
-		apsBytes, err = aps[i].MarshalBinary()
+		apsBytes, err := aps[i].MarshalBinary()
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -323,18 +350,20 @@ func AbstractPointsToBytes(aps []kyber.Point) []byte {
 	return response
 }
 
-// BytesToAbstractPoints converts a byte array to an array of kyber.Point
-func BytesToAbstractPoints(target []byte) []kyber.Point {
-	var err error
-	aps := make([]kyber.Point, 0)
+// BytesToAbstractPoints converts a byte array to an array of kyber.Point. An
+// error is returned if the data is not made of valid points.
+func BytesToAbstractPoints(target []byte) ([]kyber.Point, error) {
+	if len(target)%pointSize != 0 {
+		return nil, fmt.Errorf("%d bytes don't encode points", len(target))
+	}
+	aps := make([]kyber.Point, len(target)/pointSize)
 
-	for i := 0; i < len(target); i += 32 {
-		ap := SuiTe.Point()
-		if err = ap.UnmarshalBinary(target[i : i+32]); err != nil {
-			log.Fatal(err)
+	for i := range aps {
+		ap := decenarch.Suite.Point()
+		if err := ap.UnmarshalBinary(target[i*pointSize : (i+1)*pointSize]); err != nil {
+			return nil, fmt.Errorf("point %d: %v", i, err)
 		}
-
-		aps = append(aps, ap)
+		aps[i] = ap
 	}
-	return aps
+	return aps, nil
 }
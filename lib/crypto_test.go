@@ -3,12 +3,18 @@ package lib
 // adapted from https://github.com/lca1/unlynx/blob/master/lib/crypto_test.go
 
 import (
+	"context"
 	"reflect"
+	"runtime"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"gopkg.in/dedis/kyber.v2"
 	"gopkg.in/dedis/kyber.v2/util/random"
+
+	decenarch "github.com/dedis/student_18_decenar"
 )
 
 // TestNullCipherText verifies encryption, decryption and behavior of null ciphertexts.
@@ -24,7 +30,7 @@ func TestNullCipherText(t *testing.T) {
 		t.Fatal("Decryption of encryption of 0 should be 0, got", nullDec)
 	}
 
-	var twoTimesNullEnc = CipherText{K: SuiTe.Point().Null(), C: SuiTe.Point().Null()}
+	var twoTimesNullEnc = CipherText{K: decenarch.Suite.Point().Null(), C: decenarch.Suite.Point().Null()}
 	twoTimesNullEnc.Add(*nullEnc, *nullEnc)
 	twoTimesNullDec := DecryptInt(secKey, twoTimesNullEnc)
 
@@ -74,6 +80,48 @@ func TestEncryptDecryptIntVector(t *testing.T) {
 	require.Equal(t, vector, plain)
 }
 
+func TestEncryptIntVectorContext(t *testing.T) {
+	defer SetWorkers(0)
+	require.Equal(t, runtime.GOMAXPROCS(0), Workers())
+	SetWorkers(3)
+	require.Equal(t, 3, Workers())
+	require.Equal(t, 2, ContextWorkers(WithWorkers(context.Background(), 2)))
+	require.Equal(t, 3, ContextWorkers(WithWorkers(context.Background(), 8)))
+
+	// all the batches are computed, by at most the workers of the context
+	var mutex sync.Mutex
+	running, most, covered := 0, 0, 0
+	require.Nil(t, ParallelFor(WithWorkers(context.Background(), 2), 10*VPARALLELIZE+3, func(start, end int) {
+		mutex.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		covered += end - start
+		mutex.Unlock()
+		time.Sleep(time.Millisecond)
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+	}))
+	require.Equal(t, 10*VPARALLELIZE+3, covered)
+	require.True(t, most <= 2)
+
+	secKey, pubKey := GenKey()
+	vector := make([]int64, 2*VPARALLELIZE+1)
+	vector[VPARALLELIZE] = 1
+	cipher, proof, err := EncryptIntVectorContext(context.Background(), pubKey, vector)
+	require.Nil(t, err)
+	require.Equal(t, vector, DecryptIntVector(secKey, cipher))
+	require.True(t, proof.VerifyCipherVectorProof(cipher))
+
+	// a canceled save stops the encryption
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = EncryptIntVectorContext(ctx, pubKey, vector)
+	require.Equal(t, context.Canceled, err)
+}
+
 // TestHomomorphicOpp tests homomorphic addition.
 func TestHomomorphicOpp(t *testing.T) {
 	secKey, pubKey := GenKey()
@@ -98,15 +146,16 @@ func TestHomomorphicOpp(t *testing.T) {
 func TestAbstractPointsConverter(t *testing.T) {
 	aps := make([]kyber.Point, 0)
 
-	clientPrivate := SuiTe.Scalar().Pick(random.New())
+	clientPrivate := decenarch.Suite.Scalar().Pick(random.New())
 
 	for i := 0; i < 4; i++ {
-		ap := SuiTe.Point().Mul(clientPrivate, SuiTe.Point().Base())
+		ap := decenarch.Suite.Point().Mul(clientPrivate, decenarch.Suite.Point().Base())
 		aps = append(aps, ap)
 	}
 
 	apsBytes := AbstractPointsToBytes(aps)
-	newAps := BytesToAbstractPoints(apsBytes)
+	newAps, err := BytesToAbstractPoints(apsBytes)
+	require.Nil(t, err)
 
 	for i, el := range aps {
 		if !reflect.DeepEqual(el.String(), newAps[i].String()) {
@@ -128,7 +177,7 @@ func TestCiphertextConverter(t *testing.T) {
 	ctb := ct.ToBytes()
 
 	newCT := CipherText{}
-	newCT.FromBytes(ctb)
+	require.Nil(t, newCT.FromBytes(ctb))
 
 	p := DecryptInt(secKey, newCT)
 
@@ -145,9 +194,18 @@ func TestCipherVectorConverter(t *testing.T) {
 	cvb, length := cv.ToBytes()
 
 	newCV := CipherVector{}
-	newCV.FromBytes(cvb, length)
+	require.Nil(t, newCV.FromBytes(cvb, length))
 
 	p := DecryptIntVector(secKey, &newCV)
 
 	require.Equal(t, target, p)
+
+	// truncated or inconsistent data is refused without panicking
+	require.NotNil(t, newCV.FromBytes(cvb[:len(cvb)-1], length))
+	require.NotNil(t, newCV.FromBytes(cvb, length+1))
+	require.NotNil(t, newCV.FromBytes(cvb, -1))
+	require.NotNil(t, newCV.FromBytes(nil, 1<<60))
+	require.NotNil(t, newCT.FromBytes(cvb[:10]))
+	_, err := BytesToAbstractPoints(cvb[:33])
+	require.NotNil(t, err)
 }
@@ -0,0 +1,152 @@
+package lib
+
+/*
+The decryption.go defines the proof that the buckets of the aggregated Bloom
+filter reconstructed below the threshold were decrypted correctly. Only the
+aggregated filter is decrypted, so the proof leaks nothing of the filters of
+the conodes. Each partial decryption of a bucket comes with a DLEQ proof that
+it was made with the DKG share of its conode, whose public share is given by
+the public commitments of the DKG. A verifier checks the proofs against the
+aggregated filter, reconstructs the buckets from the proven partials and
+compares them to the consensus set: a leader lowering a bucket below the
+threshold, to censor the leaves counted in it, would need a partial
+decryption it cannot prove.
+*/
+
+import (
+	"encoding"
+	"fmt"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/proof/dleq"
+	"gopkg.in/dedis/kyber.v2/share"
+	"gopkg.in/dedis/onet.v2/log"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+// scalarSize is the size in bytes of a marshalled scalar
+var scalarSize = decenarch.Suite.Scalar().MarshalSize()
+
+// dleqProofSize is the size in bytes of a marshalled DLEQ proof
+var dleqProofSize = 2*scalarSize + 2*pointSize
+
+// PublicShare returns the public key share of the DKG share index, given the
+// public commitments of the DKG, see SharedSecret
+func PublicShare(commits []kyber.Point, index int) kyber.Point {
+	return share.NewPubPoly(decenarch.Suite, nil, commits).Eval(index).V
+}
+
+// ProvePartial returns the DLEQ proof that partial is the partial decryption
+// of c by the secret share v
+func ProvePartial(v kyber.Scalar, c CipherText) *dleq.Proof {
+	p, _, _, _ := dleq.NewDLEQProof(decenarch.Suite, decenarch.Suite.Point().Base(), c.K, v)
+	return p
+}
+
+// VerifyPartial returns an error if the proof does not show that partial is
+// the partial decryption of c by the secret share of the public share pub
+func VerifyPartial(pub kyber.Point, c CipherText, partial kyber.Point, proof *dleq.Proof) error {
+	base := decenarch.Suite.Point().Base()
+	return proof.Verify(decenarch.Suite, base, c.K, pub, decenarch.Suite.Point().Sub(c.C, partial))
+}
+
+// BelowThreshold returns the indices of the buckets of set below threshold
+func BelowThreshold(set []int64, threshold int) []int {
+	buckets := make([]int, 0)
+	for i, v := range set {
+		if v < int64(threshold) {
+			buckets = append(buckets, i)
+		}
+	}
+	return buckets
+}
+
+// VerifyBelowThreshold returns an error if the buckets of set below threshold
+// were not decrypted correctly from the aggregated filter. The proofs of each
+// partial decryption, by DKG share index, are aligned with the buckets given
+// by BelowThreshold. At least threshold partials must be proven, and each
+// bucket is reconstructed from them and compared to set.
+func VerifyBelowThreshold(aggregate *CipherVector, commits []kyber.Point, nodes, threshold int, set []int64, partials map[int][]kyber.Point, proofs map[int][]*dleq.Proof) error {
+	if len(set) != len(*aggregate) {
+		return fmt.Errorf("%d buckets in the consensus set for %d encrypted buckets", len(set), len(*aggregate))
+	}
+	if len(partials) < threshold {
+		return fmt.Errorf("%d partial decryptions for a threshold of %d", len(partials), threshold)
+	}
+	buckets := BelowThreshold(set, threshold)
+	for j, partial := range partials {
+		if j < 0 || j >= nodes {
+			return fmt.Errorf("share index %d out of range", j)
+		}
+		if len(partial) != len(set) {
+			return fmt.Errorf("share %d: %d partial decryptions for %d buckets", j, len(partial), len(set))
+		}
+		if len(proofs[j]) != len(buckets) {
+			return fmt.Errorf("share %d: %d proofs for %d buckets below the threshold", j, len(proofs[j]), len(buckets))
+		}
+		pub := PublicShare(commits, j)
+		for k, i := range buckets {
+			if err := VerifyPartial(pub, (*aggregate)[i], partial[i], proofs[j][k]); err != nil {
+				return fmt.Errorf("share %d, bucket %d: %v", j, i, err)
+			}
+		}
+	}
+	for _, i := range buckets {
+		value, err := reconstructBucket(nodes, threshold, CounterMax(CounterWidth(nodes)), partials, i, -1)
+		if err != nil {
+			return fmt.Errorf("bucket %d: %v", i, err)
+		}
+		if value != set[i] {
+			return fmt.Errorf("bucket %d is %d, not %d", i, value, set[i])
+		}
+	}
+	return nil
+}
+
+// DLEQProofsToBytes converts an array of DLEQ proofs to a byte array
+func DLEQProofsToBytes(proofs []*dleq.Proof) []byte {
+	response := make([]byte, 0, len(proofs)*dleqProofSize)
+	for _, p := range proofs {
+		for _, m := range []encoding.BinaryMarshaler{p.C, p.R, p.VG, p.VH} {
+			b, err := m.MarshalBinary()
+			if err != nil {
+				log.Fatal(err)
+			}
+			response = append(response, b...)
+		}
+	}
+	return response
+}
+
+// BytesToDLEQProofs converts a byte array to an array of DLEQ proofs. An
+// error is returned if the data is not made of valid proofs.
+func BytesToDLEQProofs(target []byte) ([]*dleq.Proof, error) {
+	if len(target)%dleqProofSize != 0 {
+		return nil, fmt.Errorf("%d bytes don't encode DLEQ proofs", len(target))
+	}
+	proofs := make([]*dleq.Proof, len(target)/dleqProofSize)
+	for i := range proofs {
+		b := target[i*dleqProofSize : (i+1)*dleqProofSize]
+		p := &dleq.Proof{
+			C:  decenarch.Suite.Scalar(),
+			R:  decenarch.Suite.Scalar(),
+			VG: decenarch.Suite.Point(),
+			VH: decenarch.Suite.Point(),
+		}
+		if err := p.C.UnmarshalBinary(b[:scalarSize]); err != nil {
+			return nil, fmt.Errorf("proof %d: %v", i, err)
+		}
+		if err := p.R.UnmarshalBinary(b[scalarSize : 2*scalarSize]); err != nil {
+			return nil, fmt.Errorf("proof %d: %v", i, err)
+		}
+		if err := p.VG.UnmarshalBinary(b[2*scalarSize : 2*scalarSize+pointSize]); err != nil {
+			return nil, fmt.Errorf("proof %d: %v", i, err)
+		}
+		if err := p.VH.UnmarshalBinary(b[2*scalarSize+pointSize:]); err != nil {
+			return nil, fmt.Errorf("proof %d: %v", i, err)
+		}
+		proofs[i] = p
+	}
+	return proofs, nil
+}
@@ -0,0 +1,59 @@
+package lib
+
+import (
+	"testing"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/proof/dleq"
+	"gopkg.in/dedis/kyber.v2/share"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+func TestVerifyBelowThreshold(t *testing.T) {
+	nodes, threshold := 4, 3
+	secret := decenarch.Suite.Scalar().Pick(random.New())
+	poly := share.NewPriPoly(decenarch.Suite, threshold, secret, random.New())
+	_, commits := poly.Commit(nil).Info()
+	public := decenarch.Suite.Point().Mul(secret, nil)
+	require.True(t, commits[0].Equal(public))
+
+	set := []int64{0, 4, 2, 3, 1}
+	aggregate, _ := EncryptIntVector(public, set)
+	buckets := BelowThreshold(set, threshold)
+	require.Equal(t, []int{0, 2, 4}, buckets)
+
+	partials := make(map[int][]kyber.Point)
+	proofs := make(map[int][]*dleq.Proof)
+	for _, s := range poly.Shares(nodes)[:threshold] {
+		require.True(t, PublicShare(commits, s.I).Equal(decenarch.Suite.Point().Mul(s.V, nil)))
+		partials[s.I] = make([]kyber.Point, len(set))
+		for i, c := range *aggregate {
+			partials[s.I][i] = DecryptPoint(s.V, c)
+		}
+		for _, i := range buckets {
+			proofs[s.I] = append(proofs[s.I], ProvePartial(s.V, (*aggregate)[i]))
+		}
+	}
+	require.Nil(t, VerifyBelowThreshold(aggregate, commits, nodes, threshold, set, partials, proofs))
+
+	// the proofs survive their encoding
+	decoded, err := BytesToDLEQProofs(DLEQProofsToBytes(proofs[0]))
+	require.Nil(t, err)
+	require.Len(t, decoded, len(buckets))
+	require.True(t, decoded[1].VH.Equal(proofs[0][1].VH))
+	_, err = BytesToDLEQProofs([]byte{1, 2, 3})
+	require.NotNil(t, err)
+
+	// a bucket lowered below the threshold is detected
+	lowered := append([]int64{}, set...)
+	lowered[1] = 2
+	proofs[0] = append(proofs[0], proofs[0][0])
+	require.NotNil(t, VerifyBelowThreshold(aggregate, commits, nodes, threshold, lowered, partials, proofs))
+	proofs[0] = proofs[0][:len(buckets)]
+
+	// a forged partial decryption is detected
+	partials[1][2] = decenarch.Suite.Point().Pick(random.New())
+	require.NotNil(t, VerifyBelowThreshold(aggregate, commits, nodes, threshold, set, partials, proofs))
+}
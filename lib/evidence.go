@@ -0,0 +1,42 @@
+package lib
+
+import (
+	"errors"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+// NewEvidence returns the evidence, signed with the key pair of the reporter,
+// that the conode of public key accused misbehaved in the given protocol by
+// sending the contribution
+func NewEvidence(private kyber.Scalar, reporter kyber.Point, requestID string, accused kyber.Point, protocol string, reason error, contribution []byte) (decenarch.Evidence, error) {
+	e := decenarch.Evidence{
+		RequestID:    requestID,
+		Accused:      accused.String(),
+		Reporter:     reporter.String(),
+		Protocol:     protocol,
+		Reason:       reason.Error(),
+		Contribution: contribution,
+	}
+	sig, err := schnorr.Sign(decenarch.Suite, private, e.Message())
+	if err != nil {
+		return e, err
+	}
+	e.Signature = sig
+	return e, nil
+}
+
+// VerifyEvidence returns an error if the reporter of e is not one of publics
+// or if e is not signed by its reporter. It does not check the contribution
+// of the accused conode, see protocol.VerifyEvidence
+func VerifyEvidence(e decenarch.Evidence, publics []kyber.Point) error {
+	for _, p := range publics {
+		if p.String() == e.Reporter {
+			return schnorr.Verify(decenarch.Suite, p, e.Message(), e.Signature)
+		}
+	}
+	return errors.New("reporter of the evidence is not a conode of the roster")
+}
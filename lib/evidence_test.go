@@ -0,0 +1,35 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/util/key"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestEvidence(t *testing.T) {
+	reporter := key.NewKeyPair(decenarch.Suite)
+	accused := key.NewKeyPair(decenarch.Suite)
+	publics := []kyber.Point{reporter.Public, accused.Public}
+
+	e, err := NewEvidence(reporter.Private, reporter.Public, "request", accused.Public, "protocol", errors.New("invalid proof"), []byte("contribution"))
+	require.Nil(t, err)
+	require.Equal(t, accused.Public.String(), e.Accused)
+	require.Nil(t, VerifyEvidence(e, publics))
+
+	// the evidence cannot be changed or attributed to another conode
+	forged := e
+	forged.Accused = reporter.Public.String()
+	require.NotNil(t, VerifyEvidence(forged, publics))
+	forged = e
+	forged.Contribution = []byte("other contribution")
+	require.NotNil(t, VerifyEvidence(forged, publics))
+	forged = e
+	forged.Reporter = accused.Public.String()
+	require.NotNil(t, VerifyEvidence(forged, publics))
+	require.NotNil(t, VerifyEvidence(e, publics[1:]))
+}
@@ -0,0 +1,106 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	urlpkg "net/url"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// feedDocument holds the entries of an RSS 2.0, RSS 1.0 or Atom feed. The
+// namespaces are ignored, so that the three formats share the same fields.
+type feedDocument struct {
+	XMLName xml.Name
+	Channel struct {
+		Items []feedItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []feedItem  `xml:"item"`
+	Entries []feedEntry `xml:"entry"`
+}
+
+// feedItem is an item of an RSS feed
+type feedItem struct {
+	Link string `xml:"link"`
+	GUID struct {
+		Value       string `xml:",chardata"`
+		IsPermaLink string `xml:"isPermaLink,attr"`
+	} `xml:"guid"`
+}
+
+// feedEntry is an entry of an Atom feed
+type feedEntry struct {
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+}
+
+// ParseFeed returns the links of the entries of the RSS or Atom feed data,
+// in the order of the feed, resolved against the URL of the feed. The entries
+// without link are skipped.
+func ParseFeed(feedURL string, data []byte) ([]string, error) {
+	base, err := urlpkg.Parse(feedURL)
+	if err != nil {
+		return nil, err
+	}
+	doc := &feedDocument{}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charset.NewReaderLabel
+	if err := decoder.Decode(doc); err != nil {
+		return nil, err
+	}
+
+	var raw []string
+	switch strings.ToLower(doc.XMLName.Local) {
+	case "rss":
+		raw = itemLinks(doc.Channel.Items)
+	case "rdf":
+		raw = itemLinks(doc.Items)
+	case "feed":
+		for _, e := range doc.Entries {
+			raw = append(raw, entryLink(e))
+		}
+	default:
+		return nil, errors.New("not an RSS or Atom feed: " + doc.XMLName.Local)
+	}
+
+	links := make([]string, 0, len(raw))
+	for _, l := range raw {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		u, err := base.Parse(l)
+		if err != nil {
+			continue
+		}
+		links = append(links, u.String())
+	}
+	return links, nil
+}
+
+// itemLinks returns the link of each RSS item, or its GUID if it is a
+// permalink
+func itemLinks(items []feedItem) []string {
+	links := make([]string, len(items))
+	for i, item := range items {
+		links[i] = item.Link
+		if links[i] == "" && item.GUID.IsPermaLink != "false" {
+			links[i] = item.GUID.Value
+		}
+	}
+	return links
+}
+
+// entryLink returns the alternate link of an Atom entry
+func entryLink(e feedEntry) string {
+	for _, l := range e.Links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return l.Href
+		}
+	}
+	return ""
+}
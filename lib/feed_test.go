@@ -0,0 +1,43 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFeed(t *testing.T) {
+	rss := `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>News</title>
+<item><title>A</title><link>https://example.com/a</link></item>
+<item><title>B</title><link>/b</link></item>
+<item><title>C</title><guid>https://example.com/c</guid></item>
+<item><title>D</title><guid isPermaLink="false">tag:d</guid></item>
+</channel></rss>`
+	links, err := ParseFeed("https://example.com/feed.xml", []byte(rss))
+	require.Nil(t, err)
+	require.Equal(t, []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}, links)
+
+	rdf := `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/">
+<channel><title>News</title></channel>
+<item><link>https://example.com/a</link></item>
+</rdf:RDF>`
+	links, err = ParseFeed("https://example.com/feed.rdf", []byte(rdf))
+	require.Nil(t, err)
+	require.Equal(t, []string{"https://example.com/a"}, links)
+
+	atom := `<?xml version="1.0" encoding="ISO-8859-1"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>News</title>
+<entry><link rel="self" href="https://example.com/a.atom"/><link href="https://example.com/a"/></entry>
+<entry><link rel="alternate" href="b"/></entry>
+</feed>`
+	links, err = ParseFeed("https://example.com/news/feed.atom", []byte(atom))
+	require.Nil(t, err)
+	require.Equal(t, []string{"https://example.com/a", "https://example.com/news/b"}, links)
+
+	_, err = ParseFeed("https://example.com/", []byte("<html><body></body></html>"))
+	require.NotNil(t, err)
+	_, err = ParseFeed("https://example.com/", []byte("not xml"))
+	require.NotNil(t, err)
+}
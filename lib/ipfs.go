@@ -0,0 +1,85 @@
+package lib
+
+/*
+The ipfs.go defines the client of the HTTP API of an IPFS node, used to pin
+the content of the archived pages. The skipchain then only keeps the CID of
+the content, which anyone can fetch from the IPFS network, and its content
+hash, signed by the cothority, to check it.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ipfsTimeout is the maximal duration of a request to the IPFS node
+const ipfsTimeout = time.Minute
+
+// IPFS pins and reads contents through the HTTP API of an IPFS node
+type IPFS struct {
+	// API is the URL of the HTTP API, e.g. http://127.0.0.1:5001
+	API    string
+	client *http.Client
+}
+
+// NewIPFS returns the client of the IPFS node whose HTTP API is at api
+func NewIPFS(api string) *IPFS {
+	return &IPFS{API: strings.TrimRight(api, "/"), client: &http.Client{Timeout: ipfsTimeout}}
+}
+
+// Add pins data on the IPFS node and returns its CID
+func (i *IPFS) Add(data []byte) (string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("file", "page")
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	resp, err := i.client.Post(i.API+"/api/v0/add?pin=true&cid-version=1", w.FormDataContentType(), &body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("IPFS add failed: %s", resp.Status)
+	}
+	var added struct {
+		Hash string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&added); err != nil {
+		return "", err
+	}
+	if added.Hash == "" {
+		return "", errors.New("IPFS add returned no CID")
+	}
+	return added.Hash, nil
+}
+
+// Cat returns the content whose CID is cid. The content must be checked by
+// the caller, e.g. against its content hash.
+func (i *IPFS) Cat(cid string) ([]byte, error) {
+	resp, err := i.client.Post(i.API+"/api/v0/cat?arg="+url.QueryEscape(cid), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("IPFS cat of %s failed: %s", cid, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,47 @@
+package lib
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPFS(t *testing.T) {
+	pinned := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v0/add":
+			require.Equal(t, "true", r.URL.Query().Get("pin"))
+			f, _, err := r.FormFile("file")
+			require.Nil(t, err)
+			data, err := ioutil.ReadAll(f)
+			require.Nil(t, err)
+			cid := "b" + ContentHash(data)
+			pinned[cid] = data
+			w.Write([]byte(`{"Name":"page","Hash":"` + cid + `","Size":"1"}`))
+		case "/api/v0/cat":
+			data, ok := pinned[r.URL.Query().Get("arg")]
+			if !ok {
+				http.Error(w, "not found", http.StatusInternalServerError)
+				return
+			}
+			w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ipfs := NewIPFS(server.URL + "/")
+	cid, err := ipfs.Add([]byte("page"))
+	require.Nil(t, err)
+	data, err := ipfs.Cat(cid)
+	require.Nil(t, err)
+	require.Equal(t, []byte("page"), data)
+
+	_, err = ipfs.Cat("unknown")
+	require.NotNil(t, err)
+}
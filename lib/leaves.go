@@ -0,0 +1,314 @@
+package lib
+
+/*
+The leaves.go defines the leaf extractors, which select the leaves of the HTML
+tree of a page on which the conodes run the consensus. The right granularity
+differs between the pages: the text of a news article is enough, while the
+links of a documentation page matter, and the menus of a web application
+change on every fetch. An extractor first prunes the tree of the page, then
+gives the leaf of every node without children. The consensus page is built
+from the pruned tree of the root, so that a conode checks every leaf of the
+proposed page, see ListLeaves.
+*/
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Names of the leaf extractors
+const (
+	// ExtractorText takes the data of the leaves, the default
+	ExtractorText = "text"
+	// ExtractorAttributes takes the data of the leaves with the attributes
+	// of their element, so that the same text under another link is
+	// another leaf
+	ExtractorAttributes = "attributes"
+	// ExtractorVisible takes the data of the leaves visible to a reader,
+	// without the scripts, the hidden elements and the boilerplate of the
+	// page, e.g. the menus
+	ExtractorVisible = "visible"
+	// ExtractorMain takes the data of the leaves of the main content of the
+	// page, found as a readability tool does, see mainContent
+	ExtractorMain = "main"
+)
+
+// LeafExtractor selects the leaves of a page
+type LeafExtractor interface {
+	// Prune removes from the tree the nodes that are not part of the
+	// content of the page
+	Prune(root *html.Node)
+	// Leaf returns the leaf of n, a node without children
+	Leaf(n *html.Node) string
+}
+
+var leafExtractors = map[string]LeafExtractor{
+	ExtractorText:       textExtractor{},
+	ExtractorAttributes: attributeExtractor{},
+	ExtractorVisible:    visibleExtractor{},
+	ExtractorMain:       mainExtractor{},
+}
+
+// GetLeafExtractor returns the extractor of the given name, or the text
+// extractor if name is empty
+func GetLeafExtractor(name string) (LeafExtractor, error) {
+	if name == "" {
+		name = ExtractorText
+	}
+	e, ok := leafExtractors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown leaf extractor %s", name)
+	}
+	return e, nil
+}
+
+// LeafExtractors returns the sorted names of the leaf extractors
+func LeafExtractors() []string {
+	names := make([]string, 0, len(leafExtractors))
+	for name := range leafExtractors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WalkLeaves calls f on every node of the tree without children, with its
+// leaf given by e. The tree is not pruned.
+func WalkLeaves(root *html.Node, e LeafExtractor, f func(n *html.Node, leaf string)) {
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.FirstChild == nil {
+			f(n, e.Leaf(n))
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+}
+
+// ListLeaves returns the unique leaves of the tree given by e, in the order
+// of the tree. The tree is not pruned, so that the leaves of a proposed page
+// are all listed.
+func ListLeaves(root *html.Node, e LeafExtractor) []string {
+	leaves := make([]string, 0)
+	discovered := make(map[string]bool)
+	WalkLeaves(root, e, func(_ *html.Node, leaf string) {
+		if !discovered[leaf] {
+			discovered[leaf] = true
+			leaves = append(leaves, leaf)
+		}
+	})
+	return leaves
+}
+
+// textExtractor is the extractor of ExtractorText
+type textExtractor struct{}
+
+func (textExtractor) Prune(*html.Node) {}
+
+func (textExtractor) Leaf(n *html.Node) string {
+	return n.Data
+}
+
+// attributeExtractor is the extractor of ExtractorAttributes. The leaf of a
+// text node carries the attributes of its parent element, and the leaf of an
+// element its own attributes, sorted.
+type attributeExtractor struct{}
+
+func (attributeExtractor) Prune(*html.Node) {}
+
+func (attributeExtractor) Leaf(n *html.Node) string {
+	attrs := n.Attr
+	if n.Type == html.TextNode && n.Parent != nil {
+		attrs = n.Parent.Attr
+	}
+	if len(attrs) == 0 {
+		return n.Data
+	}
+	list := make([]string, len(attrs))
+	for i, a := range attrs {
+		list[i] = a.Key + "=" + a.Val
+	}
+	sort.Strings(list)
+	return n.Data + "\x00" + strings.Join(list, "\x00")
+}
+
+// invisibleElements are the elements whose content is not shown to a reader
+var invisibleElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"iframe":   true,
+}
+
+// boilerplateElements are the elements holding the boilerplate of a page,
+// header and footer only outside of an article or of the main content
+var boilerplateElements = map[string]bool{
+	"nav":    true,
+	"aside":  true,
+	"header": true,
+	"footer": true,
+}
+
+// visibleExtractor is the extractor of ExtractorVisible
+type visibleExtractor struct{}
+
+func (visibleExtractor) Prune(root *html.Node) {
+	var removed []*html.Node
+	var walk func(n *html.Node, inContent bool)
+	walk = func(n *html.Node, inContent bool) {
+		if n.Type == html.CommentNode || (n.Type == html.ElementNode && !visible(n, inContent)) {
+			removed = append(removed, n)
+			return
+		}
+		if n.Type == html.ElementNode && (n.Data == "article" || n.Data == "main") {
+			inContent = true
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, inContent)
+		}
+	}
+	walk(root, false)
+	for _, n := range removed {
+		if n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+	}
+}
+
+func (visibleExtractor) Leaf(n *html.Node) string {
+	return n.Data
+}
+
+// visible tells if the element n is shown to a reader and is not part of the
+// boilerplate of the page. inContent tells if n is in an article or in the
+// main content.
+func visible(n *html.Node, inContent bool) bool {
+	if invisibleElements[n.Data] {
+		return false
+	}
+	if boilerplateElements[n.Data] && !(inContent && (n.Data == "header" || n.Data == "footer")) {
+		return false
+	}
+	for _, a := range n.Attr {
+		switch strings.ToLower(a.Key) {
+		case "hidden":
+			return false
+		case "aria-hidden":
+			if strings.EqualFold(a.Val, "true") {
+				return false
+			}
+		case "style":
+			style := strings.ToLower(strings.Replace(a.Val, " ", "", -1))
+			if strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// mainExtractor is the extractor of ExtractorMain. The visible leaves are
+// kept, then the body of the page is replaced by its main content.
+type mainExtractor struct{}
+
+func (mainExtractor) Prune(root *html.Node) {
+	visibleExtractor{}.Prune(root)
+	body := findElement(root, func(n *html.Node) bool { return n.Data == "body" })
+	if body == nil {
+		return
+	}
+	content := mainContent(body)
+	if content == nil || content == body {
+		return
+	}
+	content.Parent.RemoveChild(content)
+	for c := body.FirstChild; c != nil; c = body.FirstChild {
+		body.RemoveChild(c)
+	}
+	body.AppendChild(content)
+}
+
+func (mainExtractor) Leaf(n *html.Node) string {
+	return n.Data
+}
+
+// mainContent returns the element holding the main content of the body: the
+// main element, the article with the most text, or else the element whose
+// paragraphs hold the most text. It returns nil if none is found.
+func mainContent(body *html.Node) *html.Node {
+	main := findElement(body, func(n *html.Node) bool {
+		if n.Data == "main" {
+			return true
+		}
+		for _, a := range n.Attr {
+			if a.Key == "role" && a.Val == "main" {
+				return true
+			}
+		}
+		return false
+	})
+	if main != nil {
+		return main
+	}
+	var article, best *html.Node
+	articleText, bestScore := 0, 0
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if l := textLength(n); n.Data == "article" && l > articleText {
+				article, articleText = n, l
+			}
+			// the score of an element is the text of its paragraphs
+			score := 0
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.ElementNode && c.Data == "p" {
+					score += textLength(c)
+				}
+			}
+			if score > bestScore {
+				best, bestScore = n, score
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(body)
+	if article != nil {
+		return article
+	}
+	return best
+}
+
+// findElement returns the first element of the tree, in the order of the
+// tree, for which match returns true, nil if there is none
+func findElement(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if n.Type == html.ElementNode && match(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// textLength returns the length of the text of the tree, without the
+// surrounding spaces of its text nodes
+func textLength(n *html.Node) int {
+	if n.Type == html.TextNode {
+		return len(strings.TrimSpace(n.Data))
+	}
+	l := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		l += textLength(c)
+	}
+	return l
+}
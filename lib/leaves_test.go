@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+const leavesPage = `<html><head><script>track()</script></head><body>
+<nav><a href="/">Home</a></nav>
+<div hidden>secret</div>
+<main><header>Title</header><p>first</p><p><a href="/a">link</a></p></main>
+<footer>Contact</footer>
+<!-- comment -->
+</body></html>`
+
+func parseLeavesPage(t *testing.T) *html.Node {
+	root, err := html.Parse(strings.NewReader(leavesPage))
+	require.NoError(t, err)
+	return root
+}
+
+func TestLeafExtractors(t *testing.T) {
+	_, err := GetLeafExtractor("unknown")
+	require.Error(t, err)
+	e, err := GetLeafExtractor("")
+	require.NoError(t, err)
+	require.Equal(t, textExtractor{}, e)
+	require.Equal(t, []string{ExtractorAttributes, ExtractorMain, ExtractorText, ExtractorVisible}, LeafExtractors())
+
+	// the text extractor gives the leaves of ListUniqueDataLeaves
+	root := parseLeavesPage(t)
+	require.Equal(t, ListUniqueDataLeaves(root), ListLeaves(root, e))
+	require.Contains(t, ListLeaves(root, e), "Home")
+
+	// the attributes of the parent element are part of the leaf
+	e, _ = GetLeafExtractor(ExtractorAttributes)
+	leaves := ListLeaves(root, e)
+	require.Contains(t, leaves, "link\x00href=/a")
+	require.Contains(t, leaves, "first")
+
+	// the visible extractor removes the scripts, the hidden elements and
+	// the boilerplate, but keeps the header of the main content
+	e, _ = GetLeafExtractor(ExtractorVisible)
+	e.Prune(root)
+	leaves = ListLeaves(root, e)
+	require.Contains(t, leaves, "Title")
+	require.Contains(t, leaves, "link")
+	for _, l := range []string{"track()", "Home", "secret", "Contact", " comment "} {
+		require.NotContains(t, leaves, l)
+	}
+
+	// the main extractor only keeps the main content
+	root = parseLeavesPage(t)
+	e, _ = GetLeafExtractor(ExtractorMain)
+	e.Prune(root)
+	leaves = ListLeaves(root, e)
+	require.Contains(t, leaves, "first")
+	for _, l := range []string{"\n", "Home", "Contact"} {
+		require.NotContains(t, leaves, l)
+	}
+}
+
+func TestMainContent(t *testing.T) {
+	root, err := html.Parse(strings.NewReader(`<html><body>
+<div id="menu"><p>a</p></div>
+<div id="text"><p>a long paragraph</p><p>another one</p></div>
+</body></html>`))
+	require.NoError(t, err)
+	body := findElement(root, func(n *html.Node) bool { return n.Data == "body" })
+	content := mainContent(body)
+	require.NotNil(t, content)
+	require.Equal(t, "text", content.Attr[0].Val)
+}
@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/dedis/onet.v2/log"
+)
+
+// Field names used in every structured log line
+const (
+	LogFieldRequestID = "request_id"
+	LogFieldConode    = "conode"
+	LogFieldMessage   = "msg"
+)
+
+// NewRequestID returns a random identifier used to correlate all the log
+// lines produced by the conodes during a single save
+func NewRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		log.Error("Impossible to generate request ID:", err)
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// Logger writes log lines as JSON objects. Every line contains the fields
+// given at creation of the logger, e.g. the request ID and the address of the
+// conode, so that a single archive run can be traced across the logs of the
+// service and of all the protocols of all the conodes.
+type Logger struct {
+	fields map[string]interface{}
+}
+
+// NewLogger returns a logger whose lines carry the given request ID and
+// conode address
+func NewLogger(requestID, conode string) *Logger {
+	return &Logger{fields: map[string]interface{}{
+		LogFieldRequestID: requestID,
+		LogFieldConode:    conode,
+	}}
+}
+
+// With returns a copy of the logger with an additional field
+func (l *Logger) With(key string, value interface{}) *Logger {
+	fields := make(map[string]interface{}, len(l.fields)+1)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	return &Logger{fields: fields}
+}
+
+// Lvl1 logs msg with the given key-value pairs at level 1
+func (l *Logger) Lvl1(msg string, kv ...interface{}) {
+	log.Lvl1(l.format(msg, kv))
+}
+
+// Lvl2 logs msg with the given key-value pairs at level 2
+func (l *Logger) Lvl2(msg string, kv ...interface{}) {
+	log.Lvl2(l.format(msg, kv))
+}
+
+// Lvl3 logs msg with the given key-value pairs at level 3
+func (l *Logger) Lvl3(msg string, kv ...interface{}) {
+	log.Lvl3(l.format(msg, kv))
+}
+
+// Lvl4 logs msg with the given key-value pairs at level 4
+func (l *Logger) Lvl4(msg string, kv ...interface{}) {
+	log.Lvl4(l.format(msg, kv))
+}
+
+// Info logs msg with the given key-value pairs as information
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	log.Info(l.format(msg, kv))
+}
+
+// Error logs msg with the given key-value pairs as an error
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	log.Error(l.format(msg, kv))
+}
+
+// format builds the JSON object of a log line. kv is a list of alternating
+// keys and values, a key without value is logged with a nil value. Errors and
+// other values that cannot be marshaled are logged as strings.
+func (l *Logger) format(msg string, kv []interface{}) string {
+	line := make(map[string]interface{}, len(l.fields)+len(kv)/2+1)
+	for k, v := range l.fields {
+		line[k] = v
+	}
+	line[LogFieldMessage] = msg
+	for i := 0; i < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		var value interface{}
+		if i+1 < len(kv) {
+			value = kv[i+1]
+		}
+		switch v := value.(type) {
+		case error:
+			line[key] = v.Error()
+		case fmt.Stringer:
+			line[key] = v.String()
+		default:
+			line[key] = v
+		}
+	}
+	b, err := json.Marshal(line)
+	if err != nil {
+		return fmt.Sprintf("%v %v", line, err)
+	}
+	return string(b)
+}
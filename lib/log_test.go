@@ -0,0 +1,28 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggerFormat(t *testing.T) {
+	requestID := NewRequestID()
+	require.Len(t, requestID, 16)
+
+	l := NewLogger(requestID, "tcp://127.0.0.1:7770").With("protocol", "test")
+	line := l.format("message", []interface{}{"url", "http://example.com", "error", errors.New("failure"), "dangling"})
+
+	fields := make(map[string]interface{})
+	require.Nil(t, json.Unmarshal([]byte(line), &fields))
+	require.Equal(t, requestID, fields[LogFieldRequestID])
+	require.Equal(t, "tcp://127.0.0.1:7770", fields[LogFieldConode])
+	require.Equal(t, "message", fields[LogFieldMessage])
+	require.Equal(t, "test", fields["protocol"])
+	require.Equal(t, "http://example.com", fields["url"])
+	require.Equal(t, "failure", fields["error"])
+	require.Contains(t, fields, "dangling")
+	require.Nil(t, fields["dangling"])
+}
@@ -0,0 +1,52 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sort"
+)
+
+// LeafHash returns the hash of an HTML leaf as committed in a Merkle tree
+func LeafHash(leaf string) []byte {
+	h := sha256.Sum256([]byte(leaf))
+	return h[:]
+}
+
+// LeafHashes returns the sorted hashes of the given unique leaves
+func LeafHashes(leaves []string) [][]byte {
+	hashes := make([][]byte, len(leaves))
+	for i, l := range leaves {
+		hashes[i] = LeafHash(l)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return bytes.Compare(hashes[i], hashes[j]) < 0
+	})
+	return hashes
+}
+
+// MerkleRoot returns the root of the Merkle tree whose leaves are the given
+// hashes, in the given order. An odd node is promoted to the next level. The
+// root of an empty tree is the hash of the empty string.
+func MerkleRoot(hashes [][]byte) []byte {
+	if len(hashes) == 0 {
+		h := sha256.Sum256(nil)
+		return h[:]
+	}
+	level := hashes
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			h := sha256.New()
+			h.Write([]byte{1})
+			h.Write(level[i])
+			h.Write(level[i+1])
+			next = append(next, h.Sum(nil))
+		}
+		level = next
+	}
+	return level[0]
+}
@@ -0,0 +1,26 @@
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerkleRoot(t *testing.T) {
+	require.NotNil(t, MerkleRoot(nil))
+
+	hashes := LeafHashes([]string{"c", "a", "b"})
+	for i := 1; i < len(hashes); i++ {
+		require.True(t, bytes.Compare(hashes[i-1], hashes[i]) < 0)
+	}
+	root := MerkleRoot(hashes)
+
+	// the order of the leaves doesn't change the root
+	require.Equal(t, root, MerkleRoot(LeafHashes([]string{"a", "b", "c"})))
+
+	// a different set gives a different root
+	require.NotEqual(t, root, MerkleRoot(LeafHashes([]string{"a", "b"})))
+	require.NotEqual(t, root, MerkleRoot(LeafHashes([]string{"a", "b", "d"})))
+	require.Equal(t, LeafHash("a"), MerkleRoot(LeafHashes([]string{"a"})))
+}
@@ -0,0 +1,201 @@
+package lib
+
+/*
+The packed.go defines the wire format of the encrypted Bloom filters. An
+encrypted filter is broadcast to the conodes, aggregated along the tree and
+sent again to the signers, so it is sent as a single byte slice marshaled at
+once, instead of one protobuf message per ciphertext. The vectors made mostly
+of null ciphertexts, e.g. the aggregations without contribution, are sent
+sparse, i.e. only their non null ciphertexts with their indexes. Note that the
+encryptions of 0 are random points, so the filters freshly encrypted by the
+conodes are always sent dense.
+
+A packed vector starts with its format, packedDense or packedSparse, and its
+length as uvarint. The dense format is followed by all the ciphertexts, like
+CipherVector.ToBytes. The sparse format is followed by the number of non null
+ciphertexts and, for each of them, the gap from the previous index as uvarint
+and the ciphertext.
+*/
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"gopkg.in/dedis/onet.v2/log"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+// formats of the packed vectors
+const (
+	packedDense  byte = 1
+	packedSparse byte = 2
+)
+
+// maxSparseLength is the maximal length of a sparse vector. The length of a
+// dense vector is bounded by the size of the data, whereas a short sparse
+// vector can claim any length, so the longer vectors are always sent dense.
+const maxSparseLength = 1 << 20
+
+// Pack returns the packed wire format of cv, sparse if it is shorter than the
+// dense format
+func (cv *CipherVector) Pack() []byte {
+	var nonNull []int
+	if len(*cv) <= maxSparseLength {
+		for i, c := range *cv {
+			if !c.isNull() {
+				nonNull = append(nonNull, i)
+			}
+		}
+	}
+
+	header := make([]byte, 1+binary.MaxVarintLen64)
+	n := binary.PutUvarint(header[1:], uint64(len(*cv)))
+	header = header[:1+n]
+
+	sparseSize := uvarintSize(uint64(len(nonNull)))
+	previous := 0
+	for _, i := range nonNull {
+		sparseSize += uvarintSize(uint64(i-previous)) + cipherTextSize
+		previous = i
+	}
+	if len(*cv) > maxSparseLength || sparseSize >= len(*cv)*cipherTextSize {
+		header[0] = packedDense
+		b := bytes.NewBuffer(make([]byte, 0, len(header)+len(*cv)*cipherTextSize))
+		b.Write(header)
+		for _, c := range *cv {
+			c.marshalTo(b)
+		}
+		return b.Bytes()
+	}
+
+	header[0] = packedSparse
+	b := bytes.NewBuffer(make([]byte, 0, len(header)+sparseSize))
+	b.Write(header)
+	writeUvarint(b, uint64(len(nonNull)))
+	previous = 0
+	for _, i := range nonNull {
+		writeUvarint(b, uint64(i-previous))
+		(*cv)[i].marshalTo(b)
+		previous = i
+	}
+	return b.Bytes()
+}
+
+// Unpack sets cv to the vector packed in data by Pack. The data usually comes
+// from the network, so an error is returned if it is not a valid packed
+// vector, and nothing is allocated before the length is checked against the
+// size of the data.
+func (cv *CipherVector) Unpack(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("empty packed vector")
+	}
+	format := data[0]
+	length, n := binary.Uvarint(data[1:])
+	if n <= 0 {
+		return errors.New("invalid length of packed vector")
+	}
+	body := data[1+n:]
+
+	switch format {
+	case packedDense:
+		if length > uint64(len(body)/cipherTextSize) {
+			return fmt.Errorf("%d bytes don't encode %d ciphertexts", len(body), length)
+		}
+		return cv.unmarshalParallel(body, int(length))
+	case packedSparse:
+		if length > maxSparseLength {
+			return fmt.Errorf("sparse vector of %d ciphertexts is too long", length)
+		}
+		count, n := binary.Uvarint(body)
+		if n <= 0 || count > length || count > uint64(len(body)/cipherTextSize) {
+			return errors.New("invalid number of ciphertexts of sparse vector")
+		}
+		body = body[n:]
+		v := *NewCipherVector(int(length))
+		index := uint64(0)
+		for j := uint64(0); j < count; j++ {
+			gap, n := binary.Uvarint(body)
+			if n <= 0 || len(body[n:]) < cipherTextSize {
+				return fmt.Errorf("truncated ciphertext %d of sparse vector", j)
+			}
+			// the indexes are strictly increasing, except the first one
+			// that can be 0
+			if (j > 0 && gap == 0) || gap >= length-index {
+				return fmt.Errorf("invalid index of ciphertext %d of sparse vector", j)
+			}
+			index += gap
+			if err := v[index].FromBytes(body[n : n+cipherTextSize]); err != nil {
+				return fmt.Errorf("ciphertext %d: %v", index, err)
+			}
+			body = body[n+cipherTextSize:]
+		}
+		if len(body) != 0 {
+			return errors.New("trailing data after sparse vector")
+		}
+		*cv = v
+		return nil
+	default:
+		return fmt.Errorf("unknown format %d of packed vector", format)
+	}
+}
+
+// unmarshalParallel is FromBytes, with the points unmarshaled in batches of
+// VPARALLELIZE ciphertexts if more than one worker is set, see Workers
+func (cv *CipherVector) unmarshalParallel(data []byte, length int) error {
+	if Workers() < 2 || length < 2*VPARALLELIZE {
+		return cv.FromBytes(data, length)
+	}
+	if len(data) != length*cipherTextSize {
+		return fmt.Errorf("%d bytes don't encode %d ciphertexts", len(data), length)
+	}
+	v := make(CipherVector, length)
+	var once sync.Once
+	var failure error
+	ParallelFor(context.Background(), length, func(start, end int) {
+		for i := start; i < end; i++ {
+			if err := v[i].FromBytes(data[i*cipherTextSize : (i+1)*cipherTextSize]); err != nil {
+				once.Do(func() { failure = fmt.Errorf("ciphertext %d: %v", i, err) })
+				return
+			}
+		}
+	})
+	if failure != nil {
+		return failure
+	}
+	*cv = v
+	return nil
+}
+
+// isNull returns true if both points of c are the null point
+func (c *CipherText) isNull() bool {
+	null := decenarch.Suite.Point().Null()
+	return c.K.Equal(null) && c.C.Equal(null)
+}
+
+// marshalTo writes the marshaled points of c to b, like ToBytes but without
+// intermediate buffers
+func (c *CipherText) marshalTo(b *bytes.Buffer) {
+	if _, err := c.K.MarshalTo(b); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := c.C.MarshalTo(b); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeUvarint writes x to b as uvarint
+func writeUvarint(b *bytes.Buffer, x uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutUvarint(buf[:], x)])
+}
+
+// uvarintSize returns the size of x written as uvarint
+func uvarintSize(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], x)
+}
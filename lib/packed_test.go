@@ -0,0 +1,74 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackDense(t *testing.T) {
+	secKey, pubKey := GenKey()
+	target := make([]int64, 3*VPARALLELIZE)
+	for i := range target {
+		target[i] = int64(i % 2)
+	}
+	cv, _ := EncryptIntVector(pubKey, target)
+
+	packed := cv.Pack()
+	require.Equal(t, packedDense, packed[0])
+	raw, _ := cv.ToBytes()
+	require.True(t, len(packed) < len(raw)+4)
+
+	var unpacked CipherVector
+	require.Nil(t, unpacked.Unpack(packed))
+	require.Equal(t, target, DecryptIntVector(secKey, &unpacked))
+
+	// truncated or inconsistent data is refused without panicking
+	require.NotNil(t, unpacked.Unpack(nil))
+	require.NotNil(t, unpacked.Unpack(packed[:len(packed)-1]))
+	require.NotNil(t, unpacked.Unpack(append([]byte{packedDense, 0xff, 0xff, 0xff, 0xff, 0x0f}, raw...)))
+	require.NotNil(t, unpacked.Unpack(append([]byte{3}, packed[1:]...)))
+}
+
+func TestPackSparse(t *testing.T) {
+	secKey, pubKey := GenKey()
+	cv := NewCipherVector(1000)
+	for _, i := range []int{0, 10, 999} {
+		c, _ := EncryptInt(pubKey, 1)
+		(*cv)[i] = *c
+	}
+
+	packed := cv.Pack()
+	require.Equal(t, packedSparse, packed[0])
+	require.True(t, len(packed) < 4*cipherTextSize)
+
+	var unpacked CipherVector
+	require.Nil(t, unpacked.Unpack(packed))
+	decrypted := DecryptIntVector(secKey, &unpacked)
+	require.Len(t, decrypted, 1000)
+	for i, v := range decrypted {
+		if i == 0 || i == 10 || i == 999 {
+			require.Equal(t, int64(1), v)
+		} else {
+			require.Equal(t, int64(0), v)
+		}
+	}
+
+	// the unpacked null ciphertexts don't share their points
+	unpacked[11].Add(unpacked[11], unpacked[10])
+	require.Equal(t, int64(1), DecryptInt(secKey, unpacked[11]))
+	require.Equal(t, int64(0), DecryptInt(secKey, unpacked[12]))
+
+	// an empty vector round trips
+	var empty CipherVector
+	require.Nil(t, empty.Unpack(NewCipherVector(0).Pack()))
+	require.Len(t, empty, 0)
+
+	// out of range or repeated indexes are refused
+	require.NotNil(t, unpacked.Unpack(packed[:len(packed)-1]))
+	bad := []byte{packedSparse, 2, 2, 0}
+	require.NotNil(t, unpacked.Unpack(append(bad, (*cv)[0].ToBytes()...)))
+	bad = []byte{packedSparse, 2, 1, 2}
+	require.NotNil(t, unpacked.Unpack(append(bad, (*cv)[0].ToBytes()...)))
+	require.NotNil(t, unpacked.Unpack([]byte{packedSparse, 0xff, 0xff, 0xff, 0xff, 0x0f, 0}))
+}
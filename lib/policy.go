@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// DomainPolicy decides which domains can be archived. Domains are stored as
+// hashes, see HashDomain, so that a policy can be propagated to other conodes
+// without publishing the list of refused domains. A domain matches an entry if
+// the entry is the domain itself or one of its parent domains.
+//    - Allow contains the only domains that can be archived. If empty, all
+//      the domains not in Block can be archived
+//    - Block contains the domains that cannot be archived
+type DomainPolicy struct {
+	Allow []string
+	Block []string
+}
+
+// HashDomain returns the hash of a domain as stored in a DomainPolicy. The
+// internationalized domains are hashed in their ASCII form, see ASCIIHost.
+func HashDomain(domain string) string {
+	h := sha256.Sum256([]byte(ASCIIHost(domain)))
+	return hex.EncodeToString(h[:])
+}
+
+// NewDomainPolicy returns the policy allowing and blocking the given
+// plaintext domains
+func NewDomainPolicy(allow, block []string) *DomainPolicy {
+	p := &DomainPolicy{
+		Allow: make([]string, len(allow)),
+		Block: make([]string, len(block)),
+	}
+	for i, d := range allow {
+		p.Allow[i] = HashDomain(d)
+	}
+	for i, d := range block {
+		p.Block[i] = HashDomain(d)
+	}
+	return p
+}
+
+// Allowed returns true if the given host can be archived
+func (p *DomainPolicy) Allowed(host string) bool {
+	if p == nil {
+		return true
+	}
+	hashes := domainHashes(host)
+	if matchAny(p.Block, hashes) {
+		return false
+	}
+	if len(p.Allow) > 0 && !matchAny(p.Allow, hashes) {
+		return false
+	}
+	return true
+}
+
+// domainHashes returns the hashes of host and of all its parent domains
+func domainHashes(host string) []string {
+	labels := strings.Split(ASCIIHost(host), ".")
+	hashes := make([]string, 0, len(labels))
+	for i := range labels {
+		hashes = append(hashes, HashDomain(strings.Join(labels[i:], ".")))
+	}
+	return hashes
+}
+
+// matchAny returns true if one of the hashes is in list
+func matchAny(list, hashes []string) bool {
+	for _, l := range list {
+		for _, h := range hashes {
+			if l == h {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomainPolicy(t *testing.T) {
+	// nil policy allows everything
+	var nilPolicy *DomainPolicy
+	require.True(t, nilPolicy.Allowed("example.com"))
+
+	// block list, subdomains are blocked too
+	p := NewDomainPolicy(nil, []string{"blocked.com", "internal"})
+	require.False(t, p.Allowed("blocked.com"))
+	require.False(t, p.Allowed("www.Blocked.com."))
+	require.False(t, p.Allowed("host.internal"))
+	require.True(t, p.Allowed("notblocked.com"))
+	require.True(t, p.Allowed("example.com"))
+
+	// allow list
+	p = NewDomainPolicy([]string{"epfl.ch"}, []string{"secret.epfl.ch"})
+	require.True(t, p.Allowed("epfl.ch"))
+	require.True(t, p.Allowed("dedis.epfl.ch"))
+	require.False(t, p.Allowed("secret.epfl.ch"))
+	require.False(t, p.Allowed("example.com"))
+
+	// the policy doesn't contain the plaintext domains
+	for _, h := range p.Allow {
+		require.NotEqual(t, "epfl.ch", h)
+	}
+
+	// internationalized domains match in both forms
+	p = NewDomainPolicy(nil, []string{"bücher.example"})
+	require.False(t, p.Allowed("xn--bcher-kva.example"))
+	require.False(t, p.Allowed("www.BÜCHER.example"))
+	require.True(t, p.Allowed("bucher.example"))
+}
@@ -2,12 +2,16 @@ package lib
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"sync"
 
 	decenarch "github.com/dedis/student_18_decenar"
 	"gopkg.in/dedis/kyber.v2"
 	"gopkg.in/dedis/kyber.v2/proof/dleq"
 	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/kyber.v2/util/random"
 	"gopkg.in/dedis/onet.v2"
 )
 
@@ -34,59 +38,76 @@ func (p *CompleteProofs) VerifyCompleteProofs() bool {
 	// verify also my proofs, to be sure that root did nothing
 	// wrong
 	for _, v := range *p {
-		// for both leaf and non leaf node we verify the signature of the
-		// ciphervector, i.e. the encrypted CBF set. Note that if the node
-		// creating this proof spoof someone's else identity, by using it's
-		// public key, this proof will not work and therefore it will be
-		// rejected.
-		bytesEncryptedSet := v.AggregationProof.Aggregation
-		hashed := decenarch.Suite.Hash().Sum(bytesEncryptedSet)
-		vErr := schnorr.Verify(decenarch.Suite, v.PublicKey, hashed, v.EncryptedCBFSetSignature)
-		if vErr != nil {
+		if !p.verifyCompleteProof(v) {
 			return false
 		}
+	}
+	return true
+}
 
-		// verify if the node is a leaf
-		tree, err := v.TreeMarshal.MakeTree(v.Roster)
-		if err != nil {
-			return false
-		}
+// verifyCompleteProof verifies the proof of a single node. The aggregation
+// proofs are chained along the tree: the aggregation of each node must be the
+// contribution of this node in the aggregation proof of its parent, so that
+// the aggregation of the root is the sum of the filters of all the nodes,
+// whatever the height of the tree.
+func (p *CompleteProofs) verifyCompleteProof(v *CompleteProof) bool {
+	// for both leaf and non leaf node we verify the signature of the
+	// ciphervector, i.e. the encrypted CBF set. Note that if the node
+	// creating this proof spoof someone's else identity, by using it's
+	// public key, this proof will not work and therefore it will be
+	// rejected.
+	if v.AggregationProof == nil || v.CipherVectorProof == nil {
+		return false
+	}
+	bytesEncryptedSet := v.AggregationProof.Aggregation
+	hashed := decenarch.Suite.Hash().Sum(bytesEncryptedSet)
+	vErr := schnorr.Verify(decenarch.Suite, v.PublicKey, hashed, v.EncryptedCBFSetSignature)
+	if vErr != nil {
+		return false
+	}
 
-		// verify that the node is really who he claims to be
-		treeNode := tree.Search(v.TreeNodeID)
-		if !treeNode.ServerIdentity.Public.Equal(v.PublicKey) {
-			return false
-		}
+	tree, err := v.TreeMarshal.MakeTree(v.Roster)
+	if err != nil {
+		return false
+	}
 
-		// the node is a leaf
-		isLeaf := len(treeNode.Children) == 0
+	// verify that the node is really who he claims to be
+	treeNode := tree.Search(v.TreeNodeID)
+	if treeNode == nil || !treeNode.ServerIdentity.Public.Equal(v.PublicKey) {
+		return false
+	}
+	key := v.PublicKey.String()
 
-		// verify that my vector in the aggregation proof is the correct one
-		rootAggregationproof := *((*p)[tree.Root.ServerIdentity.Public.String()].AggregationProof)
-		if bytes.Compare(rootAggregationproof.Contributions[v.PublicKey.String()], v.EncryptedBloomFilter) != 0 {
-			return false
-		}
+	// verify that the local filter of the node is part of its own
+	// aggregation...
+	if bytes.Compare(v.AggregationProof.Contributions[key], v.EncryptedBloomFilter) != 0 {
+		return false
+	}
 
-		// we use the aggregation length since it is the same as the Bloom filter length
-		filter := make(CipherVector, v.AggregationProof.Length)
-		filter.FromBytes(v.EncryptedBloomFilter, v.AggregationProof.Length)
-
-		// if the node responsible of this complete proof is a leaf, we only
-		// have to verify the signature of the ciphervector and the proof that
-		// the ciphervector containts only zeros and ones, since a leaf node is
-		// not responsible of aggregating ciphervectors of other conodes
-		if isLeaf {
-			if !v.CipherVectorProof.VerifyCipherVectorProof(&filter) {
-				return false
-			}
+	// ...and that its aggregation is part of the aggregation of its parent
+	if treeNode.Parent != nil {
+		parent, ok := (*p)[treeNode.Parent.ServerIdentity.Public.String()]
+		if !ok || parent.AggregationProof == nil {
+			return false
 		}
-
-		// if the node isn't a leaf, we verify all the proofs
-		if !v.AggregationProof.VerifyAggregationProof() && v.CipherVectorProof.VerifyCipherVectorProof(&filter) {
+		if bytes.Compare(parent.AggregationProof.Contributions[key], v.AggregationProof.Aggregation) != 0 {
 			return false
 		}
 	}
-	return true
+
+	// the local filter contains only zeros and ones. We use the
+	// aggregation length since it is the same as the Bloom filter length
+	var filter CipherVector
+	if err := filter.FromBytes(v.EncryptedBloomFilter, v.AggregationProof.Length); err != nil {
+		return false
+	}
+	if !v.CipherVectorProof.VerifyCipherVectorProof(&filter) {
+		return false
+	}
+
+	// the aggregation is the sum of the contributions, for a leaf the
+	// only contribution is its local filter
+	return v.AggregationProof.VerifyAggregationProof()
 }
 
 // AggregationProof is the zero knowledge proof used by the leader to prove
@@ -105,8 +126,10 @@ func CreateAggregationiProof(c map[string][]byte, a []byte, length int) *Aggrega
 
 // VerifyAggregationProof return true if the aggregation proof is correct
 func (p *AggregationProof) VerifyAggregationProof() bool {
-	aggregation := make(CipherVector, p.Length)
-	aggregation.FromBytes(p.Aggregation, p.Length)
+	var aggregation CipherVector
+	if err := aggregation.FromBytes(p.Aggregation, p.Length); err != nil {
+		return false
+	}
 
 	return p.VerifyAggregationProofWithAggregation(&aggregation)
 }
@@ -114,12 +137,17 @@ func (p *AggregationProof) VerifyAggregationProof() bool {
 // VerifyAggregationProofWithAggregation returns true if the aggregation proof
 // is correct with the aggregation given as parameter
 func (p *AggregationProof) VerifyAggregationProofWithAggregation(a *CipherVector) bool {
+	if len(*a) != p.Length {
+		return false
+	}
 	tmp := NewCipherVector(len(*a))
 
 	// perform sum
 	for _, c := range p.Contributions {
-		cipher := make(CipherVector, p.Length)
-		cipher.FromBytes(c, p.Length)
+		var cipher CipherVector
+		if err := cipher.FromBytes(c, p.Length); err != nil {
+			return false
+		}
 		tmp.Add(*tmp, cipher)
 	}
 
@@ -152,51 +180,140 @@ func CreateCipherTextProof(c *CipherText, publicKey kyber.Point, blinding kyber.
 }
 
 // VerifyCipherVectorProof returns true only if the vector of ciphertexts
-// contains only encryptions of either 0 or 1
+// contains only encryptions of either 0 or 1, see
+// VerifyCipherVectorProofContext
 func (p *CipherVectorProof) VerifyCipherVectorProof(cv *CipherVector) bool {
-	ch := make(chan bool, len(*p))
-	var wg sync.WaitGroup
+	ok, _ := p.VerifyCipherVectorProofContext(context.Background(), cv)
+	return ok
+}
 
-	// constants for proof verification
-	zeroPoint := ZeroToPoint()
-	onePoint := OneToPoint()
-	base := decenarch.Suite.Point().Base()
+// VerifyCipherVectorProofContext returns true only if the vector of
+// ciphertexts contains only encryptions of either 0 or 1. Otherwise the error
+// tells which proof is invalid, or that ctx was canceled. The proofs are split
+// in batches of VPARALLELIZE proofs, verified by ContextWorkers(ctx) workers,
+// and the verification stops at the first invalid batch.
+func (p *CipherVectorProof) VerifyCipherVectorProofContext(ctx context.Context, cv *CipherVector) (bool, error) {
+	if p == nil || cv == nil {
+		return false, errors.New("missing proofs or ciphertexts")
+	}
+	if len(*p) != len(*cv) {
+		return false, fmt.Errorf("%d proofs for %d ciphertexts", len(*p), len(*cv))
+	}
 
-	// verifiy all proofs
-	for i, cipherTextProof := range *p {
+	workers := ContextWorkers(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var once sync.Once
+	var failure error
+	var wg sync.WaitGroup
+	batches := make(chan int)
+	for w := 0; w < workers; w++ {
 		wg.Add(1)
-		go cipherTextProof.verify((*cv)[i], ch, &wg, zeroPoint, onePoint, base)
+		go func() {
+			defer wg.Done()
+			for start := range batches {
+				end := start + VPARALLELIZE
+				if end > len(*p) {
+					end = len(*p)
+				}
+				if err := verifyBatch((*p)[start:end], (*cv)[start:end], start); err != nil {
+					once.Do(func() { failure = err })
+					cancel()
+				}
+			}
+		}()
+	}
+loop:
+	for start := 0; start < len(*p); start += VPARALLELIZE {
+		select {
+		case batches <- start:
+		case <-ctx.Done():
+			break loop
+		}
 	}
-	// wait for proof to be verified
+	close(batches)
 	wg.Wait()
-	close(ch)
 
-	// analyze outcomes of proofs verification
-	for outcome := range ch {
-		if !outcome {
-			return false
+	if failure != nil {
+		return false, failure
+	}
+	// the context of the caller was canceled
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Verify returns true if the ciphertext c is the encryption of either 0 or 1.
+// An error is returned if the proof or the ciphertext is malformed.
+func (p *CipherTextProof) Verify(c CipherText) (bool, error) {
+	if !p.wellFormed() {
+		return false, errors.New("malformed proof")
+	}
+	if c.K == nil || c.C == nil {
+		return false, errors.New("malformed ciphertext")
+	}
+	suite := decenarch.Suite
+	if !p.verifyMessage(c, ZeroToPoint(), OneToPoint()) {
+		return false, nil
+	}
+	expected := suite.Point().Add(suite.Point().Mul(p.Proof.R, nil), suite.Point().Mul(p.Proof.C, c.K))
+	return p.Proof.VG.Equal(expected), nil
+}
+
+// verifyBatch returns an error if one of the ciphertexts is not an encryption
+// of either 0 or 1. offset is the index of the first proof of the batch in
+// the vector, used in the errors. A DLEQ proof holds if VG = R*G + C*K and
+// VH = R*X + C*(Cc - m), where (K, Cc) is the ciphertext and X the public key.
+// The second equation is checked for each proof, since m is not known by the
+// verifier, and the first one is checked for the whole batch using a random
+// linear combination: sum(rho*VG) = sum(rho*R)*G + sum(rho*C*K).
+func verifyBatch(proofs []*CipherTextProof, cts []CipherText, offset int) error {
+	suite := decenarch.Suite
+	base := suite.Point().Base()
+	zeroPoint := ZeroToPoint()
+	onePoint := OneToPoint()
+	rand := random.New()
+
+	sumVG := suite.Point().Null()
+	sumR := suite.Scalar().Zero()
+	sumCK := suite.Point().Null()
+	for i, p := range proofs {
+		if !p.wellFormed() || cts[i].K == nil || cts[i].C == nil {
+			return fmt.Errorf("malformed proof or ciphertext %d", offset+i)
 		}
+		if !p.verifyMessage(cts[i], zeroPoint, onePoint) {
+			return fmt.Errorf("invalid proof %d", offset+i)
+		}
+		rho := suite.Scalar().Pick(rand)
+		sumVG.Add(sumVG, suite.Point().Mul(rho, p.Proof.VG))
+		sumR.Add(sumR, suite.Scalar().Mul(rho, p.Proof.R))
+		sumCK.Add(sumCK, suite.Point().Mul(suite.Scalar().Mul(rho, p.Proof.C), cts[i].K))
+	}
+	expected := suite.Point().Add(suite.Point().Mul(sumR, base), sumCK)
+	if !sumVG.Equal(expected) {
+		return fmt.Errorf("invalid proof in %d-%d", offset, offset+len(proofs)-1)
 	}
+	return nil
+}
 
-	return true
+// wellFormed returns true if all the fields of the proof are set
+func (p *CipherTextProof) wellFormed() bool {
+	return p != nil && p.PublicKey != nil && p.Proof.C != nil && p.Proof.R != nil &&
+		p.Proof.VG != nil && p.Proof.VH != nil
 }
 
-// verify returns true if the ciphertext is the encryption of either 0 or 1
-func (p *CipherTextProof) verify(c CipherText, ch chan bool, wg *sync.WaitGroup, zeroPoint, onePoint, base kyber.Point) {
-	C := c.C
-	K := c.K
-	cMinusZero := decenarch.Suite.Point().Sub(C, zeroPoint)
-	cMinusOne := decenarch.Suite.Point().Sub(C, onePoint)
-	zeroProof := p.Proof.Verify(decenarch.Suite, base, p.PublicKey, K, cMinusZero)
-	oneProof := p.Proof.Verify(decenarch.Suite, base, p.PublicKey, K, cMinusOne)
-
-	// normally the condition would be
-	// (zeroProof != nil && oneProof != nil) || (zeroProof == nil && oneProof == nil),
-	// but since it is by construction impossible that the two proofs are valid at
-	// the same time, we can use only the first contidion in the if clause
-	if zeroProof != nil && oneProof != nil {
-		ch <- false
-	}
-	ch <- true
-	wg.Done()
+// verifyMessage returns true if the second equation of the DLEQ proof holds
+// for the encryption of either 0 or 1, i.e. if VH - R*X - C*Cc = -C*m with m
+// being zeroPoint or onePoint
+func (p *CipherTextProof) verifyMessage(c CipherText, zeroPoint, onePoint kyber.Point) bool {
+	suite := decenarch.Suite
+	t := suite.Point().Sub(p.Proof.VH, suite.Point().Mul(p.Proof.R, p.PublicKey))
+	t.Sub(t, suite.Point().Mul(p.Proof.C, c.C))
+	for _, m := range []kyber.Point{zeroPoint, onePoint} {
+		if t.Equal(suite.Point().Neg(suite.Point().Mul(p.Proof.C, m))) {
+			return true
+		}
+	}
+	return false
 }
@@ -1,12 +1,14 @@
 package lib
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/require"
-	"gopkg.in/dedis/cothority.v2"
 	"gopkg.in/dedis/kyber.v2/util/key"
 	"gopkg.in/dedis/onet.v2/log"
+
+	decenarch "github.com/dedis/student_18_decenar"
 )
 
 func TestMain(m *testing.M) {
@@ -15,7 +17,7 @@ func TestMain(m *testing.M) {
 
 func TestCipherVectorProof(t *testing.T) {
 	// generate keys
-	pair := key.NewKeyPair(cothority.Suite)
+	pair := key.NewKeyPair(decenarch.Suite)
 	valid := []int64{0, 0, 0, 1, 0, 0, 0, 0, 0, 1, 1, 1, 1, 0, 0, 0, 1, 1, 1, 1, 1, 1, 1}
 	invalid := []int64{3, 4, 6, 0, 1}
 
@@ -28,9 +30,93 @@ func TestCipherVectorProof(t *testing.T) {
 	require.Equal(t, false, invalidProof.VerifyCipherVectorProof(invalidEncrypted))
 }
 
+func TestCipherVectorProofBatches(t *testing.T) {
+	pair := key.NewKeyPair(decenarch.Suite)
+
+	// several batches with a single invalid ciphertext in the last one
+	set := make([]int64, 3*VPARALLELIZE+7)
+	for i := range set {
+		set[i] = int64(i % 2)
+	}
+	encrypted, proof := EncryptIntVector(pair.Public, set)
+	require.True(t, proof.VerifyCipherVectorProof(encrypted))
+
+	set[len(set)-1] = 2
+	invalidEncrypted, invalidProof := EncryptIntVector(pair.Public, set)
+	require.False(t, invalidProof.VerifyCipherVectorProof(invalidEncrypted))
+
+	// proofs of another vector or of a different length are refused
+	require.False(t, proof.VerifyCipherVectorProof(invalidEncrypted))
+	short := (*encrypted)[:len(*encrypted)-1]
+	require.False(t, proof.VerifyCipherVectorProof(&short))
+}
+
+func TestCipherVectorProofAdversarial(t *testing.T) {
+	pair := key.NewKeyPair(decenarch.Suite)
+	set := []int64{0, 1, 1, 0, 1}
+	encrypted, proof := EncryptIntVector(pair.Public, set)
+
+	// every proof alone is valid
+	for i, p := range *proof {
+		ok, err := p.Verify((*encrypted)[i])
+		require.Nil(t, err)
+		require.True(t, ok)
+	}
+
+	// swapped proofs don't hold
+	ok, err := (*proof)[0].Verify((*encrypted)[1])
+	require.Nil(t, err)
+	require.False(t, ok)
+	swapped := append(CipherVectorProof{}, *proof...)
+	swapped[0], swapped[1] = swapped[1], swapped[0]
+	ok, err = swapped.VerifyCipherVectorProofContext(context.Background(), encrypted)
+	require.False(t, ok)
+	require.NotNil(t, err)
+
+	// nil and incomplete proofs are refused without panicking
+	withNil := append(CipherVectorProof{}, *proof...)
+	withNil[2] = nil
+	ok, err = withNil.VerifyCipherVectorProofContext(context.Background(), encrypted)
+	require.False(t, ok)
+	require.NotNil(t, err)
+	incomplete := *(*proof)[3]
+	incomplete.Proof.VG = nil
+	ok, err = incomplete.Verify((*encrypted)[3])
+	require.False(t, ok)
+	require.NotNil(t, err)
+
+	// nil ciphertexts and missing proofs are refused
+	withNilCipher := append(CipherVector{}, *encrypted...)
+	withNilCipher[4].K = nil
+	ok, err = proof.VerifyCipherVectorProofContext(context.Background(), &withNilCipher)
+	require.False(t, ok)
+	require.NotNil(t, err)
+	var missing *CipherVectorProof
+	ok, err = missing.VerifyCipherVectorProofContext(context.Background(), encrypted)
+	require.False(t, ok)
+	require.NotNil(t, err)
+
+	// many invalid proofs don't block the verification
+	invalid := make([]int64, 4*VPARALLELIZE)
+	for i := range invalid {
+		invalid[i] = 2
+	}
+	invalidEncrypted, invalidProof := EncryptIntVector(pair.Public, invalid)
+	ok, err = invalidProof.VerifyCipherVectorProofContext(context.Background(), invalidEncrypted)
+	require.False(t, ok)
+	require.NotNil(t, err)
+
+	// a canceled context stops the verification
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ok, err = proof.VerifyCipherVectorProofContext(ctx, encrypted)
+	require.False(t, ok)
+	require.Equal(t, context.Canceled, err)
+}
+
 func TestAggregationProof(t *testing.T) {
 	// generate keys and vectors
-	pair := key.NewKeyPair(cothority.Suite)
+	pair := key.NewKeyPair(decenarch.Suite)
 	c1 := []int64{0, 1, 2, 3}
 	c2 := []int64{0, 1, 2, 3}
 	c3 := []int64{0, 1, 2, 3}
@@ -0,0 +1,416 @@
+package lib
+
+/*
+The strip.go defines the removal of the boilerplate of the pages before the
+consensus, e.g. the cookie banners and the ad containers, whose content
+changes on every fetch and would knock the leaves around them out of the
+consensus. The elements are selected by CSS selectors, of which a subset is
+supported, see ParseSelector. The same selectors must be applied by all the
+conodes, before the leaf extractor, see LeafExtractor.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Selector is a parsed CSS selector, see ParseSelector
+type Selector struct {
+	source string
+	chains [][]compound
+}
+
+// compound is a compound selector of a chain, matching a single element.
+// child tells if the combinator with the previous compound of the chain is
+// '>', else it is a descendant combinator.
+type compound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrSelector
+	child   bool
+}
+
+// attrSelector is an attribute selector, op is empty if the attribute must
+// only be present
+type attrSelector struct {
+	key string
+	op  string
+	val string
+}
+
+// ParseSelector parses a list of CSS selectors separated by commas. The
+// supported selectors are the type selector, the universal selector, the id
+// and class selectors and the attribute selectors with the operators =, ~=,
+// ^=, $= and *=, combined with the descendant and the child combinators.
+func ParseSelector(s string) (*Selector, error) {
+	sel := &Selector{source: s}
+	p := &selectorParser{s: s}
+	for {
+		chain, err := p.chain()
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %s", s, err)
+		}
+		sel.chains = append(sel.chains, chain)
+		if p.done() {
+			return sel, nil
+		}
+		// chain stops at the end or at a comma
+		p.i++
+	}
+}
+
+// ParseSelectors parses every selector of list, see ParseSelector
+func ParseSelectors(list []string) ([]*Selector, error) {
+	selectors := make([]*Selector, len(list))
+	for i, s := range list {
+		sel, err := ParseSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		selectors[i] = sel
+	}
+	return selectors, nil
+}
+
+// String returns the source of the selector
+func (s *Selector) String() string {
+	return s.source
+}
+
+// Match tells if the node n is an element matched by the selector
+func (s *Selector) Match(n *html.Node) bool {
+	for _, chain := range s.chains {
+		if matchChain(chain, len(chain)-1, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// StripElements removes from the tree the elements matched by one of the
+// selectors, with their content, and returns the number of removed elements
+func StripElements(root *html.Node, selectors []*Selector) int {
+	if len(selectors) == 0 {
+		return 0
+	}
+	var removed []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for _, s := range selectors {
+			if s.Match(n) {
+				removed = append(removed, n)
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	for _, n := range removed {
+		if n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+	}
+	return len(removed)
+}
+
+// StripRules are the selectors of the elements removed from the pages, see
+// StripElements. The rules of a domain also apply to its subdomains.
+type StripRules struct {
+	selectors []string
+	domains   map[string][]string
+}
+
+// NewStripRules returns the rules removing the elements of selectors from all
+// the pages and the elements of domains from the pages of each domain. It
+// returns an error if a selector is invalid.
+func NewStripRules(selectors []string, domains map[string][]string) (*StripRules, error) {
+	if _, err := ParseSelectors(selectors); err != nil {
+		return nil, err
+	}
+	r := &StripRules{selectors: selectors, domains: make(map[string][]string)}
+	for domain, list := range domains {
+		if _, err := ParseSelectors(list); err != nil {
+			return nil, fmt.Errorf("%s: %s", domain, err)
+		}
+		d := ASCIIHost(domain)
+		r.domains[d] = append(r.domains[d], list...)
+	}
+	return r, nil
+}
+
+// Selectors returns the selectors of the elements removed from the pages of
+// host, without duplicates. The rules of all the pages come first, then the
+// ones of the domains of host, from the top-level domain to host itself.
+func (r *StripRules) Selectors(host string) []string {
+	if r == nil {
+		return nil
+	}
+	var list []string
+	seen := make(map[string]bool)
+	add := func(selectors []string) {
+		for _, s := range selectors {
+			if !seen[s] {
+				seen[s] = true
+				list = append(list, s)
+			}
+		}
+	}
+	add(r.selectors)
+	labels := strings.Split(ASCIIHost(host), ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		add(r.domains[strings.Join(labels[i:], ".")])
+	}
+	return list
+}
+
+// matchChain tells if n is matched by the compounds of chain up to i
+func matchChain(chain []compound, i int, n *html.Node) bool {
+	if !chain[i].match(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	if chain[i].child {
+		return n.Parent != nil && matchChain(chain, i-1, n.Parent)
+	}
+	for a := n.Parent; a != nil; a = a.Parent {
+		if matchChain(chain, i-1, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// match tells if the node n is an element matched by the compound
+func (c *compound) match(n *html.Node) bool {
+	if n.Type != html.ElementNode || (c.tag != "" && n.Data != c.tag) {
+		return false
+	}
+	if c.id != "" && attribute(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		classes := strings.Fields(attribute(n, "class"))
+		for _, cl := range c.classes {
+			if !contains(classes, cl) {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		if !a.match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+// match tells if the element n has an attribute matching a
+func (a *attrSelector) match(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		if attr.Key != a.key {
+			continue
+		}
+		switch a.op {
+		case "":
+			return true
+		case "=":
+			return attr.Val == a.val
+		case "~=":
+			return contains(strings.Fields(attr.Val), a.val)
+		case "^=":
+			return a.val != "" && strings.HasPrefix(attr.Val, a.val)
+		case "$=":
+			return a.val != "" && strings.HasSuffix(attr.Val, a.val)
+		case "*=":
+			return a.val != "" && strings.Contains(attr.Val, a.val)
+		}
+	}
+	return false
+}
+
+// attribute returns the value of the attribute key of n, empty if n does not
+// have it
+func attribute(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// contains tells if s is in list
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// selectorParser parses the selector s from its position i
+type selectorParser struct {
+	s string
+	i int
+}
+
+func (p *selectorParser) done() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *selectorParser) peek() byte {
+	return p.s[p.i]
+}
+
+func (p *selectorParser) skipSpaces() {
+	for !p.done() && strings.IndexByte(" \t\n\r\f", p.peek()) >= 0 {
+		p.i++
+	}
+}
+
+// chain parses the compounds of a selector until a comma or the end
+func (p *selectorParser) chain() ([]compound, error) {
+	var chain []compound
+	child := false
+	for {
+		p.skipSpaces()
+		if p.done() || p.peek() == ',' {
+			break
+		}
+		if p.peek() == '>' {
+			if len(chain) == 0 || child {
+				return nil, errors.New("misplaced combinator >")
+			}
+			child = true
+			p.i++
+			continue
+		}
+		c, err := p.compound()
+		if err != nil {
+			return nil, err
+		}
+		c.child = child
+		child = false
+		chain = append(chain, c)
+	}
+	if len(chain) == 0 || child {
+		return nil, errors.New("empty selector")
+	}
+	return chain, nil
+}
+
+// compound parses a compound selector
+func (p *selectorParser) compound() (compound, error) {
+	var c compound
+	start := p.i
+	if p.peek() == '*' {
+		p.i++
+	} else {
+		c.tag = strings.ToLower(p.name())
+	}
+	for !p.done() {
+		switch p.peek() {
+		case '#':
+			p.i++
+			if c.id = p.name(); c.id == "" {
+				return c, errors.New("empty id")
+			}
+		case '.':
+			p.i++
+			class := p.name()
+			if class == "" {
+				return c, errors.New("empty class")
+			}
+			c.classes = append(c.classes, class)
+		case '[':
+			p.i++
+			a, err := p.attribute()
+			if err != nil {
+				return c, err
+			}
+			c.attrs = append(c.attrs, a)
+		default:
+			if p.i == start {
+				return c, fmt.Errorf("unexpected character %q", p.peek())
+			}
+			return c, nil
+		}
+	}
+	return c, nil
+}
+
+// attribute parses an attribute selector, after its opening bracket
+func (p *selectorParser) attribute() (attrSelector, error) {
+	var a attrSelector
+	p.skipSpaces()
+	if a.key = strings.ToLower(p.name()); a.key == "" {
+		return a, errors.New("empty attribute name")
+	}
+	p.skipSpaces()
+	if p.done() {
+		return a, errors.New("unclosed attribute selector")
+	}
+	if p.peek() != ']' {
+		for _, op := range []string{"=", "~=", "^=", "$=", "*="} {
+			if strings.HasPrefix(p.s[p.i:], op) {
+				a.op = op
+			}
+		}
+		if a.op == "" {
+			return a, fmt.Errorf("unknown attribute operator at %q", p.s[p.i:])
+		}
+		p.i += len(a.op)
+		p.skipSpaces()
+		val, err := p.value()
+		if err != nil {
+			return a, err
+		}
+		a.val = val
+		p.skipSpaces()
+	}
+	if p.done() || p.peek() != ']' {
+		return a, errors.New("unclosed attribute selector")
+	}
+	p.i++
+	return a, nil
+}
+
+// value parses the value of an attribute selector, quoted or not
+func (p *selectorParser) value() (string, error) {
+	if p.done() {
+		return "", errors.New("missing attribute value")
+	}
+	quote := p.peek()
+	if quote != '"' && quote != '\'' {
+		return p.name(), nil
+	}
+	end := strings.IndexByte(p.s[p.i+1:], quote)
+	if end < 0 {
+		return "", errors.New("unclosed attribute value")
+	}
+	val := p.s[p.i+1 : p.i+1+end]
+	p.i += end + 2
+	return val, nil
+}
+
+// name parses an identifier, empty if there is none
+func (p *selectorParser) name() string {
+	start := p.i
+	for !p.done() {
+		c := p.peek()
+		if c != '-' && c != '_' && c < 0x80 && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') {
+			break
+		}
+		p.i++
+	}
+	return p.s[start:p.i]
+}
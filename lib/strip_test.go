@@ -0,0 +1,57 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func TestParseSelector(t *testing.T) {
+	for _, s := range []string{"div", "*", "#banner", "div.ad.top", "a[href^='https://ads.']", "main > p, aside [data-ad]"} {
+		sel, err := ParseSelector(s)
+		require.NoError(t, err, s)
+		require.Equal(t, s, sel.String())
+	}
+	for _, s := range []string{"", "div,", "> p", "p >", "#", "div[", "div[x", "div[x|=y]", "a[href='x]", "div:first-child"} {
+		_, err := ParseSelector(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestStripElements(t *testing.T) {
+	root, err := html.Parse(strings.NewReader(`<html><body>
+<div id="cookie-banner">We use cookies</div>
+<main><p>content</p><div class="ad top">Buy now</div><section><p>nested</p></section></main>
+<aside><span data-ad="1">Sponsored</span></aside>
+<a href="https://ads.example.com/x">ad link</a><a href="/page">link</a>
+</body></html>`))
+	require.NoError(t, err)
+	selectors, err := ParseSelectors([]string{"#cookie-banner", ".ad", "aside [data-ad]", "main > p", "a[href^=\"https://ads.\"]"})
+	require.NoError(t, err)
+	require.Equal(t, 5, StripElements(root, selectors))
+
+	leaves := ListUniqueDataLeaves(root)
+	for _, l := range []string{"We use cookies", "Buy now", "Sponsored", "content", "ad link"} {
+		require.NotContains(t, leaves, l)
+	}
+	require.Contains(t, leaves, "nested")
+	require.Contains(t, leaves, "link")
+	require.Equal(t, 0, StripElements(root, nil))
+}
+
+func TestStripRules(t *testing.T) {
+	rules, err := NewStripRules([]string{".cookie"}, map[string][]string{
+		"example.com":      {".ad", ".cookie"},
+		"news.example.com": {"#promo"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{".cookie", ".ad", "#promo"}, rules.Selectors("News.Example.com"))
+	require.Equal(t, []string{".cookie", ".ad"}, rules.Selectors("example.com"))
+	require.Equal(t, []string{".cookie"}, rules.Selectors("example.org"))
+	require.Nil(t, (*StripRules)(nil).Selectors("example.com"))
+
+	_, err = NewStripRules(nil, map[string][]string{"example.com": {"div["}})
+	require.Error(t, err)
+}
@@ -0,0 +1,179 @@
+package lib
+
+/*
+The tier.go defines the storage tiers of the archived pages. The skipchain
+only keeps the content hash of the pages, their content is stored in a tier,
+addressed by this hash. A conode keeps the recent pages in its hot tier, and
+can move the old ones to a cold tier, e.g. a mounted network storage, once
+pruning was approved by the cothority.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dedis/student_18_decenar/client/verify"
+)
+
+// Tier stores the content of the pages by content hash, see ContentHash
+type Tier interface {
+	// Put stores the content, whose hash is hash
+	Put(hash string, data []byte) error
+	// Get returns the content whose hash is hash. The content is checked
+	// against its hash.
+	Get(hash string) ([]byte, error)
+	// Delete removes the content whose hash is hash
+	Delete(hash string) error
+	// List returns the hashes of the contents stored before the given time
+	List(before time.Time) ([]string, error)
+}
+
+// ContentHash returns the hexadecimal sha256 hash of data, used as address of
+// the content in the tiers, see verify.ContentHash
+func ContentHash(data []byte) string {
+	return verify.ContentHash(data)
+}
+
+// DiskTier is the Tier storing each content in its own file of Dir
+type DiskTier struct {
+	Dir string
+}
+
+// NewDiskTier returns the DiskTier of the directory, created if needed
+func NewDiskTier(dir string) (*DiskTier, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskTier{Dir: dir}, nil
+}
+
+// path returns the file of the content, after checking that hash is a
+// hexadecimal sha256 hash
+func (t *DiskTier) path(hash string) (string, error) {
+	if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid content hash %q", hash)
+	}
+	return filepath.Join(t.Dir, hash), nil
+}
+
+// Put implements Tier
+func (t *DiskTier) Put(hash string, data []byte) error {
+	if ContentHash(data) != hash {
+		return errors.New("content does not match its hash")
+	}
+	p, err := t.path(hash)
+	if err != nil {
+		return err
+	}
+	// write in a temporary file first so that a crash never leaves a
+	// truncated content
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// Get implements Tier
+func (t *DiskTier) Get(hash string) ([]byte, error) {
+	p, err := t.path(hash)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if ContentHash(data) != hash {
+		return nil, fmt.Errorf("content %s is corrupted", hash)
+	}
+	return data, nil
+}
+
+// Delete implements Tier
+func (t *DiskTier) Delete(hash string) error {
+	p, err := t.path(hash)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List implements Tier, the time of a content is the modification time of
+// its file
+func (t *DiskTier) List(before time.Time) ([]string, error) {
+	infos, err := ioutil.ReadDir(t.Dir)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, 0)
+	for _, info := range infos {
+		if _, err := t.path(info.Name()); err != nil || info.IsDir() {
+			continue
+		}
+		if info.ModTime().Before(before) {
+			hashes = append(hashes, info.Name())
+		}
+	}
+	return hashes, nil
+}
+
+// multiTier reads the contents from several tiers, see NewMultiTier
+type multiTier []Tier
+
+// NewMultiTier returns the Tier storing the contents in the first tier and
+// reading them from the first tier holding them, e.g. the hot tier and then
+// the cold tier. The nil tiers are ignored, nil is returned if all are nil.
+func NewMultiTier(tiers ...Tier) Tier {
+	m := make(multiTier, 0, len(tiers))
+	for _, t := range tiers {
+		if t != nil {
+			m = append(m, t)
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// Put implements Tier
+func (m multiTier) Put(hash string, data []byte) error {
+	return m[0].Put(hash, data)
+}
+
+// Get implements Tier
+func (m multiTier) Get(hash string) ([]byte, error) {
+	var err error
+	for _, t := range m {
+		var data []byte
+		if data, err = t.Get(hash); err == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+// Delete implements Tier
+func (m multiTier) Delete(hash string) error {
+	for _, t := range m {
+		if err := t.Delete(hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List implements Tier
+func (m multiTier) List(before time.Time) ([]string, error) {
+	return m[0].List(before)
+}
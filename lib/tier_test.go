@@ -0,0 +1,81 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskTier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tier")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	tier, err := NewDiskTier(dir)
+	require.Nil(t, err)
+
+	data := []byte("<html>page</html>")
+	hash := ContentHash(data)
+	require.NotNil(t, tier.Put(hash, []byte("other")))
+	require.NotNil(t, tier.Put("../escape", data))
+	require.Nil(t, tier.Put(hash, data))
+
+	got, err := tier.Get(hash)
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+
+	// corrupted contents are detected
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, hash), []byte("corrupted"), 0600))
+	_, err = tier.Get(hash)
+	require.NotNil(t, err)
+	require.Nil(t, tier.Put(hash, data))
+
+	// only the contents stored before the given time are listed
+	hashes, err := tier.List(time.Now().Add(-time.Hour))
+	require.Nil(t, err)
+	require.Empty(t, hashes)
+	hashes, err = tier.List(time.Now().Add(time.Hour))
+	require.Nil(t, err)
+	require.Equal(t, []string{hash}, hashes)
+
+	require.Nil(t, tier.Delete(hash))
+	require.Nil(t, tier.Delete(hash))
+	_, err = tier.Get(hash)
+	require.NotNil(t, err)
+}
+
+func TestMultiTier(t *testing.T) {
+	require.Nil(t, NewMultiTier(nil, nil))
+
+	hotDir, err := ioutil.TempDir("", "hot")
+	require.Nil(t, err)
+	defer os.RemoveAll(hotDir)
+	coldDir, err := ioutil.TempDir("", "cold")
+	require.Nil(t, err)
+	defer os.RemoveAll(coldDir)
+	hot, err := NewDiskTier(hotDir)
+	require.Nil(t, err)
+	cold, err := NewDiskTier(coldDir)
+	require.Nil(t, err)
+
+	data := []byte("page")
+	hash := ContentHash(data)
+	require.Nil(t, cold.Put(hash, data))
+
+	// contents are read from the cold tier if not in the hot one
+	tiers := NewMultiTier(hot, nil, cold)
+	got, err := tiers.Get(hash)
+	require.Nil(t, err)
+	require.Equal(t, data, got)
+
+	// and stored in the hot tier
+	other := []byte("other page")
+	require.Nil(t, tiers.Put(ContentHash(other), other))
+	_, err = hot.Get(ContentHash(other))
+	require.Nil(t, err)
+	_, err = cold.Get(ContentHash(other))
+	require.NotNil(t, err)
+}
@@ -0,0 +1,236 @@
+/*
+Package transcript defines the transcript of a consensus sent to the clients
+asking for it with their save request. It holds the proofs of the operations
+done by the conodes and the data needed to reconstruct the consensus, so that
+a client can check the consensus without trusting the conode leading the
+save. The transcript is built by the package protocol, but only depends on the
+package lib, so that the clients decode it without registering the protocols
+of the conodes.
+*/
+package transcript
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/proof/dleq"
+	"gopkg.in/dedis/onet.v2/network"
+
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func init() {
+	network.RegisterMessage(ConsensusProof{})
+}
+
+// Commitment is the commitment of a conode to the leaves of its HTML tree,
+// as sent by the Merkle engine, see protocol.MerkleCommitment
+type Commitment struct {
+	Public          kyber.Point
+	Hashes          [][]byte
+	Root            []byte
+	CertificateHash string
+	Redirects       []string
+	Signature       []byte
+}
+
+// Redirection is the redirect chain followed by a conode, see
+// protocol.Redirection
+type Redirection struct {
+	Public    kyber.Point
+	Chain     []string
+	Signature []byte
+}
+
+// ConsensusProof is the transcript of a consensus
+//    - SignProtocol is the protocol used to sign the page, it tells which
+//      engine ran the consensus
+//    - CompleteProofs are the proofs of the operations done by the conodes
+//    - Partials are the partial decryptions of the consensus Bloom filter,
+//      by DKG share index, see lib.AbstractPointsToBytes
+//    - ConsensusSet and ConsensusParameters are the reconstructed consensus
+//      Bloom filter and its parameters
+//    - Commitments are the commitments of the Merkle engine, see Commitment
+//    - Url is the final URL agreed on by the conodes and Redirections the
+//      redirect chains they followed, see Redirection
+//    - Threshold is the number of conodes that must have a leaf to keep it
+//    - DKGCommits are the public commitments of the DKG, see
+//      lib.AbstractPointsToBytes, the first one is the collective key
+//    - DecryptionProofs are the proofs of the partial decryptions of the
+//      buckets of ConsensusSet below the threshold, by DKG share index, see
+//      lib.DLEQProofsToBytes and VerifyBelowThreshold
+type ConsensusProof struct {
+	SignProtocol        string
+	CompleteProofs      lib.CompleteProofs
+	Partials            map[int][]byte
+	ConsensusSet        []int64
+	ConsensusParameters []uint64
+	Commitments         []Commitment
+	Url                 string
+	Redirections        []Redirection
+	Threshold           int
+	DKGCommits          []byte
+	DecryptionProofs    map[int][]byte
+}
+
+// VerifyBelowThreshold returns an error if the transcript does not prove that
+// the buckets of the consensus Bloom filter below the threshold were decrypted
+// correctly from the aggregated filter of the root, see
+// lib.VerifyBelowThreshold, so that the leaves counted in them were not
+// censored by the root. The caller must check that the first DKG commitment
+// is the collective key of the cothority. Only the transcripts of the cbf
+// engine carry partial decryptions, the others are valid.
+func (p *ConsensusProof) VerifyBelowThreshold() error {
+	if len(p.Partials) == 0 {
+		return nil
+	}
+	if len(p.DecryptionProofs) == 0 {
+		return errors.New("no proofs of the partial decryptions")
+	}
+	commits, err := lib.BytesToAbstractPoints(p.DKGCommits)
+	if err != nil || len(commits) == 0 {
+		return fmt.Errorf("invalid DKG commitments: %v", err)
+	}
+	root, err := rootProof(p.CompleteProofs)
+	if err != nil {
+		return err
+	}
+	if !p.CompleteProofs.VerifyCompleteProofs() {
+		return errors.New("invalid proofs of the aggregation")
+	}
+	if len(*root.CipherVectorProof) > 0 && !(*root.CipherVectorProof)[0].PublicKey.Equal(commits[0]) {
+		return errors.New("the filters are not encrypted under the key of the DKG")
+	}
+	var aggregate lib.CipherVector
+	if err := aggregate.FromBytes(root.AggregationProof.Aggregation, root.AggregationProof.Length); err != nil {
+		return err
+	}
+	partials := make(map[int][]kyber.Point, len(p.Partials))
+	for k, b := range p.Partials {
+		if partials[k], err = lib.BytesToAbstractPoints(b); err != nil {
+			return fmt.Errorf("partials of share %d: %v", k, err)
+		}
+	}
+	proofs := make(map[int][]*dleq.Proof, len(p.DecryptionProofs))
+	for k, b := range p.DecryptionProofs {
+		if proofs[k], err = lib.BytesToDLEQProofs(b); err != nil {
+			return fmt.Errorf("proofs of share %d: %v", k, err)
+		}
+	}
+	return lib.VerifyBelowThreshold(&aggregate, commits, len(root.Roster.List), p.Threshold, p.ConsensusSet, partials, proofs)
+}
+
+// rootProof returns the complete proof of the root of the tree of the
+// consensus, whose aggregation is the decrypted filter
+func rootProof(proofs lib.CompleteProofs) (*lib.CompleteProof, error) {
+	for _, cp := range proofs {
+		if cp == nil || cp.TreeMarshal == nil || cp.Roster == nil {
+			continue
+		}
+		tree, err := cp.TreeMarshal.MakeTree(cp.Roster)
+		if err != nil {
+			return nil, err
+		}
+		if tree.Root.ID == cp.TreeNodeID && cp.AggregationProof != nil && cp.CipherVectorProof != nil {
+			return cp, nil
+		}
+	}
+	return nil, errors.New("no proof of the root of the consensus")
+}
+
+// jsonCompleteProof is the readable encoding of a lib.CompleteProof, the
+// points and scalars are hexadecimal strings
+type jsonCompleteProof struct {
+	PublicKey                string
+	TreeNodeID               string
+	EncryptedBloomFilter     []byte
+	EncryptedCBFSetSignature []byte
+	AggregationProof         *lib.AggregationProof
+	CipherVectorProof        []map[string]string
+}
+
+// jsonCommitment is the readable encoding of a Commitment
+type jsonCommitment struct {
+	Public          string
+	Hashes          [][]byte
+	Root            []byte
+	CertificateHash string
+	Redirects       []string
+	Signature       []byte
+}
+
+// jsonRedirection is the readable encoding of a Redirection
+type jsonRedirection struct {
+	Public    string
+	Chain     []string
+	Signature []byte
+}
+
+// MarshalJSON implements json.Marshaler, so that the transcript can be read
+// by the users
+func (p *ConsensusProof) MarshalJSON() ([]byte, error) {
+	proofs := make(map[string]*jsonCompleteProof, len(p.CompleteProofs))
+	for conode, cp := range p.CompleteProofs {
+		if cp == nil {
+			continue
+		}
+		jp := &jsonCompleteProof{
+			PublicKey:                pointString(cp.PublicKey),
+			TreeNodeID:               cp.TreeNodeID.String(),
+			EncryptedBloomFilter:     cp.EncryptedBloomFilter,
+			EncryptedCBFSetSignature: cp.EncryptedCBFSetSignature,
+			AggregationProof:         cp.AggregationProof,
+		}
+		if cp.CipherVectorProof != nil {
+			for _, ctp := range *cp.CipherVectorProof {
+				jp.CipherVectorProof = append(jp.CipherVectorProof, map[string]string{
+					"PublicKey": pointString(ctp.PublicKey),
+					"C":         ctp.Proof.C.String(),
+					"R":         ctp.Proof.R.String(),
+					"VG":        pointString(ctp.Proof.VG),
+					"VH":        pointString(ctp.Proof.VH),
+				})
+			}
+		}
+		proofs[conode] = jp
+	}
+	commitments := make([]jsonCommitment, len(p.Commitments))
+	for i, c := range p.Commitments {
+		commitments[i] = jsonCommitment{
+			Public:          pointString(c.Public),
+			Hashes:          c.Hashes,
+			Root:            c.Root,
+			CertificateHash: c.CertificateHash,
+			Redirects:       c.Redirects,
+			Signature:       c.Signature,
+		}
+	}
+	redirections := make([]jsonRedirection, len(p.Redirections))
+	for i, r := range p.Redirections {
+		redirections[i] = jsonRedirection{Public: pointString(r.Public), Chain: r.Chain, Signature: r.Signature}
+	}
+	return json.Marshal(&struct {
+		SignProtocol        string
+		CompleteProofs      map[string]*jsonCompleteProof
+		Partials            map[int][]byte
+		ConsensusSet        []int64
+		ConsensusParameters []uint64
+		Commitments         []jsonCommitment
+		Url                 string
+		Redirections        []jsonRedirection
+		Threshold           int
+		DKGCommits          []byte
+		DecryptionProofs    map[int][]byte
+	}{p.SignProtocol, proofs, p.Partials, p.ConsensusSet, p.ConsensusParameters, commitments, p.Url, redirections,
+		p.Threshold, p.DKGCommits, p.DecryptionProofs})
+}
+
+// pointString returns the hexadecimal encoding of the point, empty if nil
+func pointString(p kyber.Point) string {
+	if p == nil {
+		return ""
+	}
+	return p.String()
+}
@@ -0,0 +1,37 @@
+package transcript
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestConsensusProof(t *testing.T) {
+	public := key.NewKeyPair(decenarch.Suite).Public
+	proof := &ConsensusProof{
+		Url:         "http://example.com/",
+		Commitments: []Commitment{{Public: public, Root: []byte("root")}},
+	}
+	raw, err := network.Marshal(proof)
+	require.NoError(t, err)
+	_, msg, err := network.Unmarshal(raw, decenarch.Suite)
+	require.NoError(t, err)
+	decoded := msg.(*ConsensusProof)
+	require.True(t, decoded.Commitments[0].Public.Equal(public))
+
+	// the transcripts without partial decryptions are valid, the others
+	// need the proofs of the decryptions
+	require.NoError(t, decoded.VerifyBelowThreshold())
+	decoded.Partials = map[int][]byte{1: []byte("partial")}
+	require.Error(t, decoded.VerifyBelowThreshold())
+
+	b, err := json.Marshal(decoded)
+	require.NoError(t, err)
+	require.Contains(t, string(b), public.String())
+	require.Contains(t, string(b), "http://example.com/")
+}
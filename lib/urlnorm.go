@@ -0,0 +1,218 @@
+package lib
+
+/*
+The urlnorm.go defines the canonical form of the URLs of the archive. URLs
+differing only in their fragment, default port, trailing slash or tracking
+parameters are the same page, so they are archived and looked up under the
+same canonical URL. The internationalized URLs are stored in their ASCII
+form: the hosts are encoded with punycode and the non-ASCII characters of the
+path and of the query are percent-encoded as UTF-8.
+*/
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	urlpkg "net/url"
+
+	"golang.org/x/net/idna"
+)
+
+// DefaultStripParams are the query parameters removed by default, the
+// tracking parameters added by the marketing tools
+var DefaultStripParams = []string{"utm_*", "fbclid", "gclid", "mc_cid", "mc_eid"}
+
+// URLNormalizer gives the canonical form of the URLs
+//    - StripParams are the query parameters removed from the URLs, compared
+//      without case. A parameter ending with * matches all the parameters
+//      starting with what precedes it
+type URLNormalizer struct {
+	StripParams []string
+}
+
+// NewURLNormalizer returns the normalizer removing the given query
+// parameters
+func NewURLNormalizer(stripParams []string) *URLNormalizer {
+	return &URLNormalizer{StripParams: stripParams}
+}
+
+// NormalizeURL returns the canonical form of rawURL with the default rules
+func NormalizeURL(rawURL string) (string, error) {
+	return NewURLNormalizer(DefaultStripParams).Normalize(rawURL)
+}
+
+// Normalize returns the canonical form of the absolute URL rawURL:
+//    - the scheme and the host are lower case, the host is ASCII, see
+//      ASCIIHost
+//    - the default port of the scheme is removed
+//    - the fragment is removed
+//    - the empty path is / and the other paths have no trailing slash
+//    - the stripped parameters are removed and the other ones are sorted
+//    - the non-ASCII characters are percent-encoded, the percent-encodings
+//      are upper case
+func (n *URLNormalizer) Normalize(rawURL string) (string, error) {
+	u, err := urlpkg.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return "", errors.New("not an absolute URL: " + rawURL)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := ASCIIHost(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+	u.Fragment = ""
+
+	u.Path = trimSlash(u.Path)
+	if u.RawPath != "" {
+		u.RawPath = escapeNonASCII(trimSlash(u.RawPath))
+	}
+	u.RawQuery = n.query(u.RawQuery)
+	u.ForceQuery = false
+	return u.String(), nil
+}
+
+// QueryHash returns the content hash of the query of the canonical URL url,
+// see Normalize and ContentHash, or "" if url has no query. The URLs differing
+// only in their query are variants of the same page, identified by this
+// hash.
+func QueryHash(url string) string {
+	i := strings.IndexByte(url, '?')
+	if i < 0 || i == len(url)-1 {
+		return ""
+	}
+	return ContentHash([]byte(url[i+1:]))
+}
+
+// WithoutQuery returns the canonical URL url without its query, the page of
+// which the URLs with a query are variants
+func WithoutQuery(url string) string {
+	if i := strings.IndexByte(url, '?'); i >= 0 {
+		return url[:i]
+	}
+	return url
+}
+
+// query returns the raw query without the stripped parameters, the other
+// parameters sorted by name. The order of the values of a parameter is kept.
+func (n *URLNormalizer) query(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	var kept []string
+	for _, param := range strings.Split(raw, "&") {
+		if param == "" {
+			continue
+		}
+		name := param
+		if i := strings.IndexByte(param, '='); i >= 0 {
+			name = param[:i]
+		}
+		if decoded, err := urlpkg.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if !n.stripped(name) {
+			kept = append(kept, escapeNonASCII(param))
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return paramName(kept[i]) < paramName(kept[j])
+	})
+	return strings.Join(kept, "&")
+}
+
+// stripped returns true if the query parameter name is removed
+func (n *URLNormalizer) stripped(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range n.StripParams {
+		s = strings.ToLower(s)
+		if strings.HasSuffix(s, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(s, "*")) {
+				return true
+			}
+		} else if name == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ASCIIHost returns the lower case ASCII form of host, without trailing dot.
+// The internationalized domain names are encoded with punycode, e.g.
+// xn--r8jz45g.jp for 例え.jp. The hosts that are not valid domain names are
+// only lower cased.
+func ASCIIHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for i := 0; i < len(host); i++ {
+		if host[i] >= 0x80 {
+			if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+				return ascii
+			}
+			if ascii, err := idna.Punycode.ToASCII(host); err == nil {
+				return ascii
+			}
+			return host
+		}
+	}
+	return host
+}
+
+// escapeNonASCII percent-encodes the non-ASCII bytes and the spaces of the
+// raw path or query s, and upper cases its percent-encodings
+func escapeNonASCII(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 0x80 || c == ' ':
+			b = append(b, '%', hex[c>>4], hex[c&15])
+		case c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			b = append(b, '%', upperHex(s[i+1]), upperHex(s[i+2]))
+			i += 2
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
+
+// isHex returns true if c is an hexadecimal digit
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// upperHex returns the upper case form of the hexadecimal digit c
+func upperHex(c byte) byte {
+	if c >= 'a' && c <= 'f' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+// trimSlash returns the path without its trailing slashes, / for the root
+func trimSlash(path string) string {
+	path = strings.TrimRight(path, "/")
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// paramName returns the name of the raw query parameter param
+func paramName(param string) string {
+	if i := strings.IndexByte(param, '='); i >= 0 {
+		return param[:i]
+	}
+	return param
+}
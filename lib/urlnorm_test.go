@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	for raw, expected := range map[string]string{
+		"https://example.com":                                  "https://example.com/",
+		"HTTPS://Example.COM:443/a/#top":                       "https://example.com/a",
+		"http://example.com:80/a//":                            "http://example.com/a",
+		"http://example.com:8080/a/":                           "http://example.com:8080/a",
+		"https://example.com/a?utm_source=x&b=2&UTM_Medium=y":  "https://example.com/a?b=2",
+		"https://example.com/a?utm_source=x&fbclid=1":          "https://example.com/a",
+		"https://example.com/?z=1&a=2&a=1&gclid=3":             "https://example.com/?a=2&a=1&z=1",
+		"https://example.com/a%2Fb/?q=a%20b":                   "https://example.com/a%2Fb?q=a%20b",
+		"https://[::1]:443/":                                   "https://[::1]/",
+		"https://example.com./page?":                           "https://example.com/page",
+		" https://example.com/page ":                           "https://example.com/page",
+		"https://example.com/search?q=decenarch&utm_campaign=": "https://example.com/search?q=decenarch",
+		"https://例え.JP/パス/?q=日本":                               "https://xn--r8jz45g.jp/%E3%83%91%E3%82%B9?q=%E6%97%A5%E6%9C%AC",
+		"https://xn--r8jz45g.jp/%e3%83%91%e3%82%b9":            "https://xn--r8jz45g.jp/%E3%83%91%E3%82%B9",
+		"http://bücher.example:8080/a b":                       "http://xn--bcher-kva.example:8080/a%20b",
+	} {
+		n, err := NormalizeURL(raw)
+		require.Nil(t, err, raw)
+		require.Equal(t, expected, n, raw)
+
+		// the canonical form is stable
+		again, err := NormalizeURL(n)
+		require.Nil(t, err)
+		require.Equal(t, n, again)
+	}
+
+	for _, raw := range []string{"/relative/path", "mailto:someone@example.com", "http://[::1"} {
+		_, err := NormalizeURL(raw)
+		require.NotNil(t, err, raw)
+	}
+}
+
+func TestASCIIHost(t *testing.T) {
+	require.Equal(t, "xn--r8jz45g.jp", ASCIIHost("例え.jp"))
+	require.Equal(t, "xn--bcher-kva.example", ASCIIHost("BÜCHER.example."))
+	require.Equal(t, "example.com", ASCIIHost("Example.COM"))
+	require.Equal(t, "::1", ASCIIHost("::1"))
+}
+
+func TestURLNormalizerRules(t *testing.T) {
+	n := NewURLNormalizer([]string{"ref", "session*"})
+	u, err := n.Normalize("https://example.com/a?utm_source=x&ref=home&sessionid=1&page=2")
+	require.Nil(t, err)
+	require.Equal(t, "https://example.com/a?page=2&utm_source=x", u)
+
+	// without rules, only the order of the parameters changes
+	u, err = NewURLNormalizer(nil).Normalize("https://example.com/a?utm_source=x&b=1")
+	require.Nil(t, err)
+	require.Equal(t, "https://example.com/a?b=1&utm_source=x", u)
+}
+
+func TestQueryHash(t *testing.T) {
+	a, err := NormalizeURL("https://example.com/search?q=a&page=2")
+	require.Nil(t, err)
+	b, err := NormalizeURL("https://example.com/search?page=2&q=a&utm_source=x")
+	require.Nil(t, err)
+	c, err := NormalizeURL("https://example.com/search?q=b&page=2")
+	require.Nil(t, err)
+
+	// the same query in any order is the same variant, another query is
+	// another variant of the same page
+	require.Equal(t, QueryHash(a), QueryHash(b))
+	require.NotEqual(t, QueryHash(a), QueryHash(c))
+	require.Equal(t, WithoutQuery(a), WithoutQuery(c))
+	require.Equal(t, "https://example.com/search", WithoutQuery(a))
+
+	require.Equal(t, "", QueryHash("https://example.com/search"))
+	require.Equal(t, "https://example.com/search", WithoutQuery("https://example.com/search"))
+}
@@ -2,11 +2,11 @@ package lib
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	decenarch "github.com/dedis/student_18_decenar"
 	"golang.org/x/net/html"
-	"gopkg.in/dedis/cothority.v2"
 	"gopkg.in/dedis/kyber.v2"
 	"gopkg.in/dedis/kyber.v2/share"
 	dkg "gopkg.in/dedis/kyber.v2/share/dkg/rabin"
@@ -51,7 +51,7 @@ func DKGSimulate(nbrNodes, threshold int) (dkgs []*dkg.DistKeyGenerator, err err
 
 	// 1a - initialisation
 	for i := range scalars {
-		scalars[i] = decenarch.Suite.Scalar().Pick(cothority.Suite.RandomStream())
+		scalars[i] = decenarch.Suite.Scalar().Pick(decenarch.Suite.RandomStream())
 		points[i] = decenarch.Suite.Point().Mul(scalars[i], nil)
 	}
 
@@ -119,23 +119,7 @@ func DKGSimulate(nbrNodes, threshold int) (dkgs []*dkg.DistKeyGenerator, err err
 //               / \   \
 //              D   E   F
 func ListUniqueDataLeaves(root *html.Node) []string {
-	leaves := make([]string, 0)
-	discovered := make(map[string]bool)
-	var f func(*html.Node)
-	f = func(n *html.Node) {
-		if n.FirstChild == nil { // it is a leaf
-			if !discovered[n.Data] {
-				discovered[n.Data] = true
-				leaves = append(leaves, n.Data)
-			}
-
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			f(c)
-		}
-	}
-	f(root)
-	return leaves
+	return ListLeaves(root, textExtractor{})
 }
 
 // ConcatenateErrors take a slice of errors an return a single error which is
@@ -150,27 +134,92 @@ func ConcatenateErrors(errs []error) error {
 }
 
 // ReconstructVectorFromPartials performs Lagrange interpolation with the given
-// partial decryptions to reconstruct the jointly encrypted vector
+// partial decryptions to reconstruct the jointly encrypted vector. The
+// partials are indexed by the share index of the conodes, and every
+// reconstructed value must be in [0, nodes], since each of the nodes adds at
+// most one to a bucket. Otherwise a *decenarch.ReconstructionError is
+// returned, naming the faulty share if it can be found. The discrete logs are
+// searched up to the maximal counter of nodes conodes, see CounterWidth.
 func ReconstructVectorFromPartials(nodes, threshold int, partials map[int][]kyber.Point) ([]int64, error) {
-	points := make([]kyber.Point, 0)
-	n := nodes
-	for i := 0; i < len(partials[0]); i++ {
-		shares := make([]*share.PubShare, n)
-		for j, partial := range partials {
-			shares[j] = &share.PubShare{I: j, V: partial[i]}
+	return ReconstructVectorBounded(nodes, threshold, CounterMax(CounterWidth(nodes)), partials)
+}
+
+// ReconstructVectorBounded is ReconstructVectorFromPartials with the discrete
+// logs searched up to bound, agreed at setup. A bound below nodes is raised to
+// nodes.
+func ReconstructVectorBounded(nodes, threshold int, bound int64, partials map[int][]kyber.Point) ([]int64, error) {
+	if bound < int64(nodes) {
+		bound = int64(nodes)
+	}
+	if len(partials) == 0 {
+		return nil, &decenarch.ReconstructionError{Bucket: -1, Conode: -1, Reason: "no partials"}
+	}
+	length := -1
+	for j, partial := range partials {
+		if j < 0 || j >= nodes {
+			return nil, &decenarch.ReconstructionError{Bucket: -1, Conode: j, Reason: "share index out of range"}
+		}
+		if length == -1 {
+			length = len(partial)
+		} else if len(partial) != length {
+			return nil, &decenarch.ReconstructionError{Bucket: -1, Conode: j, Reason: "partials of wrong length"}
 		}
-		message, err := share.RecoverCommit(decenarch.Suite, shares, threshold, n)
+	}
+
+	reconstructed := make([]int64, length)
+	for i := 0; i < length; i++ {
+		value, err := reconstructBucket(nodes, threshold, bound, partials, i, -1)
 		if err != nil {
 			return nil, err
 		}
-		points = append(points, message)
+		if value < 0 || value > int64(nodes) {
+			return nil, &decenarch.ReconstructionError{
+				Bucket: i,
+				Value:  value,
+				Conode: faultyShare(nodes, threshold, bound, partials, i),
+				Reason: fmt.Sprintf("value not in [0, %d]", nodes),
+			}
+		}
+		reconstructed[i] = value
 	}
 
-	// reconstruct the points by computing the dlog
-	reconstructed := make([]int64, 0)
-	for _, point := range points {
-		reconstructed = append(reconstructed, GetPointToInt(point))
+	return reconstructed, nil
+}
+
+// reconstructBucket returns the value of the bucket i reconstructed from the
+// partials, without the partial of the conode excluded, or -1 if the value
+// is not in [0, bound]
+func reconstructBucket(nodes, threshold int, bound int64, partials map[int][]kyber.Point, i, excluded int) (int64, error) {
+	shares := make([]*share.PubShare, nodes)
+	for j, partial := range partials {
+		if j != excluded {
+			shares[j] = &share.PubShare{I: j, V: partial[i]}
+		}
+	}
+	message, err := share.RecoverCommit(decenarch.Suite, shares, threshold, nodes)
+	if err != nil {
+		return 0, err
+	}
+	// compute the dlog
+	value, ok := GetPointToIntBounded(message, bound)
+	if !ok {
+		return -1, nil
 	}
+	return value, nil
+}
 
-	return reconstructed, nil
+// faultyShare returns the index of the share whose exclusion gives a valid
+// value for the bucket i, or -1 if no such share exists, for example if there
+// are not more than threshold partials
+func faultyShare(nodes, threshold int, bound int64, partials map[int][]kyber.Point, i int) int {
+	if len(partials) <= threshold {
+		return -1
+	}
+	for j := range partials {
+		value, err := reconstructBucket(nodes, threshold, bound, partials, i, j)
+		if err == nil && value >= 0 && value <= int64(nodes) {
+			return j
+		}
+	}
+	return -1
 }
@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"testing"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/share"
+	"gopkg.in/dedis/kyber.v2/util/random"
+)
+
+func TestReconstructVectorFromPartials(t *testing.T) {
+	nodes, threshold := 4, 3
+	secret := decenarch.Suite.Scalar().Pick(random.New())
+	shares := share.NewPriPoly(decenarch.Suite, threshold, secret, random.New()).Shares(nodes)
+	public := decenarch.Suite.Point().Mul(secret, nil)
+
+	set := []int64{0, 2, 4}
+	encrypted, _ := EncryptIntVector(public, set)
+	partials := make(map[int][]kyber.Point)
+	for _, s := range shares {
+		partials[s.I] = make([]kyber.Point, len(*encrypted))
+		for i, c := range *encrypted {
+			partials[s.I][i] = DecryptPoint(s.V, c)
+		}
+	}
+
+	reconstructed, err := ReconstructVectorFromPartials(nodes, threshold, partials)
+	require.Nil(t, err)
+	require.Equal(t, set, reconstructed)
+
+	// a corrupted partial is detected and its share is named
+	partials[2][1] = decenarch.Suite.Point().Pick(random.New())
+	_, err = ReconstructVectorFromPartials(nodes, threshold, partials)
+	require.NotNil(t, err)
+	rerr, ok := err.(*decenarch.ReconstructionError)
+	require.True(t, ok)
+	require.Equal(t, 1, rerr.Bucket)
+	require.Equal(t, 2, rerr.Conode)
+
+	// without the faulty share the vector is valid again
+	delete(partials, 2)
+	reconstructed, err = ReconstructVectorFromPartials(nodes, threshold, partials)
+	require.Nil(t, err)
+	require.Equal(t, set, reconstructed)
+
+	// a value larger than the number of nodes is refused
+	encrypted, _ = EncryptIntVector(public, []int64{int64(nodes + 1)})
+	for _, s := range shares {
+		partials[s.I] = []kyber.Point{DecryptPoint(s.V, (*encrypted)[0])}
+	}
+	_, err = ReconstructVectorFromPartials(nodes, threshold, partials)
+	require.NotNil(t, err)
+	rerr, ok = err.(*decenarch.ReconstructionError)
+	require.True(t, ok)
+	require.Equal(t, int64(nodes+1), rerr.Value)
+	require.Equal(t, -1, rerr.Conode)
+}
+
+func TestReconstructLargeRoster(t *testing.T) {
+	nodes, threshold := 300, 2
+	secret := decenarch.Suite.Scalar().Pick(random.New())
+	shares := share.NewPriPoly(decenarch.Suite, threshold, secret, random.New()).Shares(nodes)
+	public := decenarch.Suite.Point().Mul(secret, nil)
+
+	// the buckets above 255 are decrypted within the bound of the roster
+	set := []int64{0, 256, 300}
+	encrypted, _ := EncryptIntVector(public, set)
+	partials := make(map[int][]kyber.Point)
+	for _, s := range shares[:threshold] {
+		partials[s.I] = make([]kyber.Point, len(*encrypted))
+		for i, c := range *encrypted {
+			partials[s.I][i] = DecryptPoint(s.V, c)
+		}
+	}
+	reconstructed, err := ReconstructVectorFromPartials(nodes, threshold, partials)
+	require.Nil(t, err)
+	require.Equal(t, set, reconstructed)
+	reconstructed, err = ReconstructVectorBounded(nodes, threshold, 0, partials)
+	require.Nil(t, err)
+	require.Equal(t, set, reconstructed)
+
+	// a point out of the bound is not decrypted
+	_, ok := GetPointToIntBounded(decenarch.Suite.Point().Pick(random.New()), CounterMax(CounterWidth(nodes)))
+	require.False(t, ok)
+}
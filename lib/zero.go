@@ -0,0 +1,148 @@
+package lib
+
+/*
+The zero.go defines the pool of encryptions of 0 of a conode. Most buckets of
+the Bloom filter of a conode are 0, and the encryption of a bucket and its
+proof don't depend on its value: adding the base point to an encryption of 0
+gives an encryption of 1 with the same randomness, so the proof of the
+encryption of 0 proves the encryption of 1 as well. The conode can thus
+precompute the encryptions of its next filter, with their proofs, while it
+waits for the saves, and only adds the base point to the buckets set to 1
+when it encrypts its filter.
+
+Each precomputed encryption is used once. Deriving the encryptions from each
+other, e.g. by summing the encryptions of the pool, would link their
+randomness, and the linear relations between the ciphertexts would tell which
+buckets are 0.
+*/
+
+import (
+	"context"
+	"sync"
+
+	"gopkg.in/dedis/kyber.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+// ZeroPool holds encryptions of 0 under a public key, with their proofs,
+// precomputed by Fill and consumed by EncryptIntVectorPool
+type ZeroPool struct {
+	public kyber.Point
+
+	mutex   sync.Mutex
+	ciphers []CipherText
+	proofs  []*CipherTextProof
+	filling bool
+}
+
+// NewZeroPool returns an empty pool of encryptions of 0 under pubkey
+func NewZeroPool(pubkey kyber.Point) *ZeroPool {
+	return &ZeroPool{public: pubkey}
+}
+
+// Public returns the key of the encryptions of the pool
+func (z *ZeroPool) Public() kyber.Point {
+	return z.public
+}
+
+// Len returns the number of encryptions in the pool
+func (z *ZeroPool) Len() int {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+	return len(z.ciphers)
+}
+
+// Fill encrypts 0 until the pool holds size encryptions, using Workers
+// goroutines. It returns immediately if the pool is already being filled.
+func (z *ZeroPool) Fill(size int) {
+	z.mutex.Lock()
+	missing := size - len(z.ciphers)
+	if z.filling || missing <= 0 {
+		z.mutex.Unlock()
+		return
+	}
+	z.filling = true
+	z.mutex.Unlock()
+
+	ciphers := make([]CipherText, missing)
+	proofs := make([]*CipherTextProof, missing)
+	workers := Workers()
+	var wg sync.WaitGroup
+	chunk := (missing + workers - 1) / workers
+	for start := 0; start < missing; start += chunk {
+		end := start + chunk
+		if end > missing {
+			end = missing
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				c, p := encryptPoint(z.public, decenarch.Suite.Point().Null())
+				ciphers[i] = *c
+				proofs[i] = p
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	z.mutex.Lock()
+	z.ciphers = append(z.ciphers, ciphers...)
+	z.proofs = append(z.proofs, proofs...)
+	z.filling = false
+	z.mutex.Unlock()
+}
+
+// take removes at most n encryptions from the pool and returns them
+func (z *ZeroPool) take(n int) ([]CipherText, []*CipherTextProof) {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+	if n > len(z.ciphers) {
+		n = len(z.ciphers)
+	}
+	rest := len(z.ciphers) - n
+	ciphers := z.ciphers[rest:]
+	proofs := z.proofs[rest:]
+	z.ciphers = z.ciphers[:rest:rest]
+	z.proofs = z.proofs[:rest:rest]
+	return ciphers, proofs
+}
+
+// EncryptIntVectorPool is EncryptIntVector, using the encryptions of pool
+// for the first buckets. The buckets that the pool cannot cover are
+// encrypted as EncryptIntVector does. The pool is ignored if it is nil or
+// if its key is not pubkey.
+func EncryptIntVectorPool(pool *ZeroPool, pubkey kyber.Point, intArray []int64) (*CipherVector, *CipherVectorProof) {
+	cv, cvProof, _ := EncryptIntVectorPoolContext(context.Background(), pool, pubkey, intArray)
+	return cv, cvProof
+}
+
+// EncryptIntVectorPoolContext is EncryptIntVectorPool, where the buckets that
+// the pool cannot cover are encrypted as EncryptIntVectorContext does
+func EncryptIntVectorPoolContext(ctx context.Context, pool *ZeroPool, pubkey kyber.Point, intArray []int64) (*CipherVector, *CipherVectorProof, error) {
+	if pool == nil || !pool.public.Equal(pubkey) {
+		return EncryptIntVectorContext(ctx, pubkey, intArray)
+	}
+	ciphers, proofs := pool.take(len(intArray))
+	cv := make(CipherVector, len(intArray))
+	cvProof := make(CipherVectorProof, len(intArray))
+	for i, c := range ciphers {
+		if intArray[i] != 0 {
+			c.C = decenarch.Suite.Point().Add(c.C, messagePoint(intArray[i]))
+		}
+		cv[i] = c
+		cvProof[i] = proofs[i]
+	}
+
+	rest := len(ciphers)
+	if rest < len(intArray) {
+		restCV, restProof, err := EncryptIntVectorContext(ctx, pubkey, intArray[rest:])
+		if err != nil {
+			return nil, nil, err
+		}
+		copy(cv[rest:], *restCV)
+		copy(cvProof[rest:], *restProof)
+	}
+	return &cv, &cvProof, nil
+}
@@ -0,0 +1,43 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/util/key"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestEncryptIntVectorPool(t *testing.T) {
+	pair := key.NewKeyPair(decenarch.Suite)
+	set := []int64{0, 1, 1, 0, 0, 1, 0, 0, 0, 1}
+	pool := NewZeroPool(pair.Public)
+	pool.Fill(6)
+	require.Equal(t, 6, pool.Len())
+
+	// the pool covers the first buckets, the others are encrypted directly
+	encrypted, proof := EncryptIntVectorPool(pool, pair.Public, set)
+	require.Equal(t, 0, pool.Len())
+	require.True(t, proof.VerifyCipherVectorProof(encrypted))
+	require.Equal(t, set, DecryptIntVector(pair.Private, encrypted))
+
+	// the encryptions are not reused
+	pool.Fill(20)
+	again, _ := EncryptIntVectorPool(pool, pair.Public, set)
+	require.Equal(t, 10, pool.Len())
+	for i := range set {
+		require.False(t, (*again)[i].K.Equal((*encrypted)[i].K))
+	}
+
+	// a proof of an encryption of 0 doesn't prove the encryption of 2
+	twice, twiceProof := EncryptIntVectorPool(pool, pair.Public, []int64{2})
+	require.False(t, twiceProof.VerifyCipherVectorProof(twice))
+
+	// the pool of another key is ignored
+	other := key.NewKeyPair(decenarch.Suite)
+	encrypted, proof = EncryptIntVectorPool(pool, other.Public, set)
+	require.Equal(t, 9, pool.Len())
+	require.True(t, proof.VerifyCipherVectorProof(encrypted))
+	require.Equal(t, set, DecryptIntVector(other.Private, encrypted))
+}
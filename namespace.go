@@ -0,0 +1,36 @@
+package decenarch
+
+/*
+The namespace.go defines the namespaces of the archives hosted by the same
+conodes. Every namespace is set up on its own, with its own skipchain, its
+own collective key and its own authorized clients, so that the saves of a
+tenant are stored and signed apart from the others. The empty namespace is
+the default archive, the one of the conodes set up without namespace.
+*/
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// MaxNamespaceLength is the maximal length of a namespace
+const MaxNamespaceLength = 64
+
+// namespacePattern matches the valid namespaces, lowercase letters, digits
+// and dashes, not starting with a dash
+var namespacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// ValidNamespace returns an error if ns is not a valid namespace. The empty
+// namespace is the default archive.
+func ValidNamespace(ns string) error {
+	if ns == "" {
+		return nil
+	}
+	if len(ns) > MaxNamespaceLength {
+		return fmt.Errorf("namespace longer than %d characters", MaxNamespaceLength)
+	}
+	if !namespacePattern.MatchString(ns) {
+		return fmt.Errorf("invalid namespace %q: only lowercase letters, digits and dashes are allowed", ns)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+/*
+Package archive holds the types of the archive that Go programs using the
+cothority handle, without the internals of the conodes: the archived pages,
+the snapshots retrieved from the archive and the transcripts of the consensus
+of the saves. The types only hold what the programs need to read and check
+the pages, and are converted from the messages of the conodes, defined in the
+root package, by FromWebstore and FromBlock. See the package client to save
+and retrieve the pages.
+*/
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+
+	cosiservice "gopkg.in/dedis/cothority.v2/ftcosi/service"
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/client/verify"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/lib/transcript"
+	skip "github.com/dedis/student_18_decenar/skip"
+)
+
+// Webstore is an archived page or additional resource, see
+// decenarch.Webstore
+//    - Page is the content of the page, base64 encoded, and PageHash its
+//      content hash, the only one set in a compact block
+//    - Sig and TimestampSig are the collective signatures of the page and of
+//      its capture time, of the signature Scheme
+type Webstore struct {
+	Url          string
+	ContentType  string
+	Charset      string
+	Page         string
+	PageHash     string
+	AddsUrl      []string
+	AddsHash     []string
+	Timestamp    string
+	CaptureTime  int64
+	Sig          []byte
+	TimestampSig []byte
+	Scheme       string
+	SignerKeys   []verify.SignerKey
+	Mask         []byte
+}
+
+// FromWebstore returns the page w of a conode
+func FromWebstore(w decenarch.Webstore) Webstore {
+	v := w.Verifiable()
+	return Webstore{
+		Url:          w.Url,
+		ContentType:  w.ContentType,
+		Charset:      w.Charset,
+		Page:         w.Page,
+		PageHash:     w.PageHash,
+		AddsUrl:      w.AddsUrl,
+		AddsHash:     w.AddsHash,
+		Timestamp:    w.Timestamp,
+		CaptureTime:  w.CaptureTime,
+		Sig:          v.Sig,
+		TimestampSig: v.TimestampSig,
+		Scheme:       w.Scheme,
+		SignerKeys:   w.SignerKeys,
+		Mask:         w.Mask,
+	}
+}
+
+// verifiable returns the page checked by the verifier
+func (w *Webstore) verifiable() verify.Webstore {
+	return verify.Webstore{
+		Url:          w.Url,
+		Page:         w.Page,
+		AddsUrl:      w.AddsUrl,
+		AddsHash:     w.AddsHash,
+		CaptureTime:  w.CaptureTime,
+		TimestampSig: w.TimestampSig,
+		Sig:          w.Sig,
+		Scheme:       w.Scheme,
+		SignerKeys:   w.SignerKeys,
+		Mask:         w.Mask,
+	}
+}
+
+// stored returns the fields of the page matched against the pages of a
+// skipblock, see skip.VerifyProof
+func (w *Webstore) stored() decenarch.Webstore {
+	return decenarch.Webstore{
+		Url:       w.Url,
+		Page:      w.Page,
+		PageHash:  w.PageHash,
+		Timestamp: w.Timestamp,
+		Sig:       &cosiservice.SignatureResponse{Signature: w.Sig},
+	}
+}
+
+// Block is the content of a block of the archive, see decenarch.Block
+type Block struct {
+	Pages      []Webstore
+	Timestamp  string
+	Sig        []byte
+	Scheme     string
+	SignerKeys []verify.SignerKey
+}
+
+// FromBlock returns the block b of a conode
+func FromBlock(b decenarch.Block) Block {
+	block := Block{Timestamp: b.Timestamp, Scheme: b.Scheme, SignerKeys: b.SignerKeys}
+	for _, p := range b.Pages {
+		block.Pages = append(block.Pages, FromWebstore(p))
+	}
+	if b.Sig != nil {
+		block.Sig = b.Sig.Signature
+	}
+	return block
+}
+
+// Snapshot is a page retrieved from the archive with its additional
+// resources, checked by its Verify method, see verify.Snapshot
+//    - GenesisID is the ID of the genesis block of the archive and ChainProof
+//      the inclusion proof of the skipblock storing Main. The inclusion is
+//      not checked if GenesisID is nil
+type Snapshot struct {
+	Publics    []kyber.Point
+	Threshold  int
+	Main       Webstore
+	Adds       []Webstore
+	GenesisID  skipchain.SkipBlockID
+	ChainProof [][]byte
+}
+
+// NewSnapshot returns the snapshot of the page of resp, signed by threshold
+// conodes of the roster of the public keys publics, the threshold given at the
+// setup of the archive, see decenarch.SetupInfoResponse. The inclusion of the
+// page in the archive is only checked if genesisID, the ID of the genesis
+// block of the archive, is not nil.
+func NewSnapshot(resp *decenarch.RetrieveResponse, publics []kyber.Point, threshold int, genesisID skipchain.SkipBlockID) *Snapshot {
+	s := &Snapshot{
+		Publics:    publics,
+		Threshold:  threshold,
+		Main:       FromWebstore(resp.Main),
+		GenesisID:  genesisID,
+		ChainProof: resp.ChainProof,
+	}
+	for _, add := range resp.Adds {
+		s.Adds = append(s.Adds, FromWebstore(add))
+	}
+	return s
+}
+
+// Verify returns an error if the page, one of its additional resources or,
+// if GenesisID is set, its inclusion in the archive is not valid
+func (s *Snapshot) Verify() error {
+	v := verify.Snapshot{Publics: s.Publics, Threshold: s.Threshold, Main: s.Main.verifiable()}
+	for i := range s.Adds {
+		v.Adds = append(v.Adds, s.Adds[i].verifiable())
+	}
+	if err := v.Verify(); err != nil {
+		return err
+	}
+	if s.GenesisID != nil {
+		if _, err := skip.VerifyProof(s.GenesisID, s.ChainProof, s.Main.stored()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Proof is the transcript of the consensus of a save, asked by
+// decenarch.SaveRequest.IncludeProof. Its JSON encoding is readable by the
+// users.
+type Proof struct {
+	raw   []byte
+	proof *transcript.ConsensusProof
+}
+
+// DecodeProof returns the transcript of the consensus encoded in raw, see
+// decenarch.SaveResponse.Proof
+func DecodeProof(raw []byte) (*Proof, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("the conode returned no transcript of the consensus")
+	}
+	_, msg, err := network.Unmarshal(raw, decenarch.Suite)
+	if err != nil {
+		return nil, err
+	}
+	proof, ok := msg.(*transcript.ConsensusProof)
+	if !ok {
+		return nil, errors.New("invalid transcript of the consensus")
+	}
+	return &Proof{raw: raw, proof: proof}, nil
+}
+
+// Bytes returns the encoding of the transcript sent by the conode
+func (p *Proof) Bytes() []byte {
+	return p.raw
+}
+
+// Url returns the URL the conodes agreed on
+func (p *Proof) Url() string {
+	return p.proof.Url
+}
+
+// VerifyBelowThreshold returns an error if the transcript does not prove that
+// the leaves dropped from the consensus page were counted by less than the
+// threshold of conodes, with the collective key of the cothority key, see
+// decenarch.Client.GetPublicKey. The key is not checked if it is nil.
+func (p *Proof) VerifyBelowThreshold(key kyber.Point) error {
+	if err := p.proof.VerifyBelowThreshold(); err != nil {
+		return err
+	}
+	if key == nil || len(p.proof.Partials) == 0 {
+		return nil
+	}
+	commits, err := lib.BytesToAbstractPoints(p.proof.DKGCommits)
+	if err != nil {
+		return err
+	}
+	if !commits[0].Equal(key) {
+		return errors.New("the transcript is not made with the collective key")
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (p *Proof) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.proof)
+}
@@ -0,0 +1,116 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	cosiservice "gopkg.in/dedis/cothority.v2/ftcosi/service"
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib/cositest"
+	"github.com/dedis/student_18_decenar/lib/transcript"
+)
+
+func TestDecodeProof(t *testing.T) {
+	_, err := DecodeProof(nil)
+	require.NotNil(t, err)
+	_, err = DecodeProof([]byte{1, 2, 3})
+	require.NotNil(t, err)
+	other, err := network.Marshal(&decenarch.FlushResponse{Pages: 2})
+	require.Nil(t, err)
+	_, err = DecodeProof(other)
+	require.NotNil(t, err)
+
+	raw, err := network.Marshal(&transcript.ConsensusProof{SignProtocol: "SignMerkle", Url: "http://example.com/"})
+	require.Nil(t, err)
+	proof, err := DecodeProof(raw)
+	require.Nil(t, err)
+	require.Equal(t, raw, proof.Bytes())
+	require.Equal(t, "http://example.com/", proof.Url())
+
+	// the transcripts of the Merkle engine have no partial decryption
+	require.Nil(t, proof.VerifyBelowThreshold(decenarch.Suite.Point().Base()))
+	b, err := json.Marshal(proof)
+	require.Nil(t, err)
+	require.Contains(t, string(b), "http://example.com/")
+}
+
+func TestNewSnapshot(t *testing.T) {
+	publics := make([]kyber.Point, 4)
+	for i := range publics {
+		publics[i] = decenarch.Suite.Point().Base()
+	}
+	resp := &decenarch.RetrieveResponse{
+		Main: decenarch.Webstore{Url: "http://example.com/", Sig: &cosiservice.SignatureResponse{Signature: []byte("sig")}},
+		Adds: []decenarch.Webstore{{Url: "http://example.com/style.css"}},
+	}
+	s := NewSnapshot(resp, publics, 4, nil)
+	require.Equal(t, 4, s.Threshold)
+	require.Equal(t, "http://example.com/", s.Main.Url)
+	require.Equal(t, []byte("sig"), s.Main.Sig)
+	require.Len(t, s.Adds, 1)
+	require.Equal(t, "http://example.com/style.css", s.Adds[0].Url)
+	require.Nil(t, s.GenesisID)
+
+	// the pages are matched against the skipblocks with their signature
+	require.Equal(t, resp.Main.Sig.Signature, s.Main.stored().Sig.Signature)
+}
+
+func TestSnapshotInclusion(t *testing.T) {
+	kps := []*key.Pair{key.NewKeyPair(decenarch.Suite), key.NewKeyPair(decenarch.Suite)}
+	publics := []kyber.Point{kps[0].Public, kps[1].Public}
+	list := []*network.ServerIdentity{
+		network.NewServerIdentity(kps[0].Public, "tls://127.0.0.1:7770"),
+		network.NewServerIdentity(kps[1].Public, "tls://127.0.0.1:7772"),
+	}
+	page := func(content string) decenarch.Webstore {
+		sig, err := cositest.Sign(decenarch.CosiSuite, kps, nil, []byte(content))
+		require.NoError(t, err)
+		return decenarch.Webstore{
+			Url:       "http://example.com/",
+			Page:      base64.StdEncoding.EncodeToString([]byte(content)),
+			Timestamp: "2018/06/01 10:00",
+			Sig:       &cosiservice.SignatureResponse{Signature: sig},
+		}
+	}
+	// the page is stored in the genesis block, whose proof is itself
+	block := func(pages ...decenarch.Webstore) (*skipchain.SkipBlock, [][]byte) {
+		data, err := json.Marshal(&decenarch.Block{Pages: pages})
+		require.NoError(t, err)
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		sb := skipchain.NewSkipBlock()
+		sb.Roster = onet.NewRoster(list)
+		sb.Data = b.Bytes()
+		sb.Hash = sb.CalculateHash()
+		raw, err := network.Marshal(sb)
+		require.NoError(t, err)
+		return sb, [][]byte{raw}
+	}
+
+	main := page("<html></html>")
+	genesis, proof := block(main)
+	resp := &decenarch.RetrieveResponse{Main: main, ChainProof: proof}
+	require.NoError(t, NewSnapshot(resp, publics, 2, genesis.Hash).Verify())
+
+	// the proof must start at the genesis block of the archive
+	other, otherProof := block(page("<html>other</html>"))
+	require.Error(t, NewSnapshot(resp, publics, 2, other.Hash).Verify())
+
+	// a valid page is refused if it is not stored in the skipblock
+	resp.ChainProof = otherProof
+	require.Error(t, NewSnapshot(resp, publics, 2, other.Hash).Verify())
+	require.NoError(t, NewSnapshot(resp, publics, 2, nil).Verify())
+}
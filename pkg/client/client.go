@@ -0,0 +1,159 @@
+/*
+Package client is the thin client of the archive for other Go programs. It
+saves and retrieves the pages of a cothority given by its group file, and only
+exposes the types of the package archive, so that the programs using it don't
+depend on the internals of the conodes. The decenarch.Client of the root
+package gives access to all the options of the conodes.
+*/
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/app"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/pkg/archive"
+)
+
+// Options are the options of the saves and the retrievals of a client
+//    - Namespace is the archive of the pages, empty for the default archive
+//    - Engine is the consensus engine of the saves, empty for the default
+//      engine
+//    - Sync makes the saves return once the pages are stored in a block
+//    - Proof asks for the transcript of the consensus of the saves
+//    - GenesisID is the ID of the genesis block of the archive. If it is set,
+//      the retrieved snapshots carry the proof of their inclusion in the
+//      archive, checked by their Verify method
+//    - Threshold is the number of conodes whose signatures the snapshots
+//      need, given at the setup of the archive. If it is zero, it is asked to
+//      the first conode of the group
+type Options struct {
+	Namespace string
+	Engine    string
+	Sync      bool
+	Proof     bool
+	GenesisID []byte
+	Threshold int
+}
+
+// Client saves and retrieves the pages of a cothority
+type Client struct {
+	client    *decenarch.Client
+	roster    *onet.Roster
+	genesisID skipchain.SkipBlockID
+	threshold int
+}
+
+// SaveResult is the outcome of a save
+//    - Url is the address of the saved page, after the redirections
+//    - Timestamp is the time of the saved page, format 2006/01/02 15:04
+//    - PageHash is the content hash of the consensus page
+//    - BlockID is the ID of the block storing the page, nil if it is stored
+//      with the next block
+//    - Adds are the urls of the additional resources archived with the page
+//    - Unchanged tells that the page did not change since its last snapshot,
+//      which was not archived again
+//    - Proof is the transcript of the consensus, if asked by the options
+type SaveResult struct {
+	Url       string
+	Timestamp string
+	PageHash  string
+	BlockID   []byte
+	Adds      []string
+	Unchanged bool
+	Proof     *archive.Proof
+}
+
+// New returns a client of the cothority of the group file read from group,
+// see the conode documentation. opts can be nil for the default options.
+func New(group io.Reader, opts *Options) (*Client, error) {
+	g, err := app.ReadGroupDescToml(group)
+	if err != nil {
+		return nil, err
+	}
+	if g.Roster == nil || len(g.Roster.List) == 0 {
+		return nil, errors.New("empty group")
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+	c := decenarch.NewClient()
+	c.Namespace = opts.Namespace
+	c.Engine = opts.Engine
+	c.Sync = opts.Sync
+	c.IncludeProof = opts.Proof
+	c.IncludeChainProof = opts.GenesisID != nil
+	return &Client{client: c, roster: g.Roster, genesisID: opts.GenesisID, threshold: opts.Threshold}, nil
+}
+
+// Save archives the page of url. If ctx is done first, the save is canceled
+// and the error of ctx is returned.
+func (c *Client) Save(ctx context.Context, url string) (*SaveResult, error) {
+	resp, err := c.client.SaveCtx(ctx, c.roster, url)
+	if err != nil {
+		return nil, err
+	}
+	return newSaveResult(resp)
+}
+
+// Retrieve returns the snapshot of the page of url archived at the given
+// time, the last one if at is zero. The snapshot is not verified, see its
+// Verify method.
+func (c *Client) Retrieve(ctx context.Context, url string, at time.Time) (*archive.Snapshot, error) {
+	timestamp := ""
+	if !at.IsZero() {
+		timestamp = at.Format("2006/01/02 15:04")
+	}
+	resp, err := c.client.RetrieveCtx(ctx, c.roster, url, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	threshold, err := c.setupThreshold()
+	if err != nil {
+		return nil, err
+	}
+	return archive.NewSnapshot(resp, c.roster.Publics(), threshold, c.genesisID), nil
+}
+
+// setupThreshold returns the threshold of the options, or else the one given
+// at the setup of the archive, asked to the first conode of the group. The
+// conodes set up before the threshold was stored use decenarch.Threshold.
+func (c *Client) setupThreshold() (int, error) {
+	if c.threshold > 0 {
+		return c.threshold, nil
+	}
+	info, err := c.client.GetSetupInfo(c.roster.List[0])
+	if err != nil {
+		return 0, err
+	}
+	if info.Threshold > 0 {
+		return int(info.Threshold), nil
+	}
+	return decenarch.Threshold(len(c.roster.List)), nil
+}
+
+// newSaveResult converts the response of a conode to a save
+func newSaveResult(resp *decenarch.SaveResponse) (*SaveResult, error) {
+	r := &SaveResult{
+		Url:       resp.Url,
+		Timestamp: resp.Timestamp,
+		PageHash:  resp.PageHash,
+		BlockID:   resp.BlockID,
+		Adds:      resp.Adds,
+		Unchanged: resp.Unchanged,
+	}
+	if len(resp.Proof) > 0 {
+		proof, err := archive.DecodeProof(resp.Proof)
+		if err != nil {
+			return nil, err
+		}
+		r.Proof = proof
+	}
+	return r, nil
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(strings.NewReader("not a group"), nil)
+	require.NotNil(t, err)
+	_, err = New(strings.NewReader(""), &Options{Namespace: "news"})
+	require.NotNil(t, err)
+}
+
+func TestNewSaveResult(t *testing.T) {
+	resp := &decenarch.SaveResponse{
+		Url:       "http://example.com/",
+		Timestamp: "2018/06/01 12:00",
+		PageHash:  "hash",
+		Adds:      []string{"http://example.com/style.css"},
+		Unchanged: true,
+	}
+	r, err := newSaveResult(resp)
+	require.Nil(t, err)
+	require.Equal(t, &SaveResult{Url: resp.Url, Timestamp: resp.Timestamp, PageHash: "hash", Adds: resp.Adds, Unchanged: true}, r)
+
+	resp.Proof = []byte{1, 2, 3}
+	_, err = newSaveResult(resp)
+	require.NotNil(t, err)
+}
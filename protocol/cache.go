@@ -0,0 +1,278 @@
+package protocol
+
+/*
+The cache.go defines the disk cache of the resources fetched by a conode.
+The same style sheets and images are fetched for every save of a web site,
+so the conode keeps the responses that carry a validator, an ETag or a
+Last-Modified date, and sends a conditional request the next time: when the
+web site answers 304 Not Modified, the cached response is used instead of
+downloading the resource again. The cache is always revalidated, so a conode
+never archives a resource the web site does not serve anymore. The responses
+are cached by URL and request headers, so that the pages fetched with the
+headers agreed at setup hit the cache without being mixed with the others.
+The size of the cache is bounded, the least recently used responses are
+dropped first.
+*/
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the default maximal size in bytes of a FetchCache
+const DefaultCacheSize = 256 * 1024 * 1024
+
+// cachedResponse is a response stored by a FetchCache
+type cachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// cacheEntry is a file of a FetchCache in the list of the least recently
+// used responses
+type cacheEntry struct {
+	key  string
+	size int64
+}
+
+// FetchCache is the disk cache of the responses fetched by a conode, each in
+// its own file of the directory, named by the hash of its URL
+type FetchCache struct {
+	dir     string
+	maxSize int64
+
+	mutex   sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+// NewFetchCache returns the cache of the directory, created if needed, of at
+// most maxSize bytes, DefaultCacheSize if maxSize is not positive. The
+// responses already in the directory are kept, the most recently used first.
+func NewFetchCache(dir string, maxSize int64) (*FetchCache, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultCacheSize
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	c := &FetchCache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	for _, f := range files {
+		if f.IsDir() || strings.HasSuffix(f.Name(), ".tmp") {
+			continue
+		}
+		c.entries[f.Name()] = c.lru.PushBack(&cacheEntry{f.Name(), f.Size()})
+		c.size += f.Size()
+	}
+	c.mutex.Lock()
+	c.evict()
+	c.mutex.Unlock()
+	return c, nil
+}
+
+// Sender returns the sender fetching the GET requests through the cache with
+// send, or the sender of the conodes if send is nil. The responses are cached
+// by URL and headers, e.g. the headers agreed at setup or replayed from a
+// template, see cacheKey. The other requests are sent without the cache.
+func (c *FetchCache) Sender(send Sender) Sender {
+	send = sender(send)
+	return func(req *http.Request, check URLChecker) (*http.Response, error) {
+		if req.Method != http.MethodGet || req.Body != nil {
+			return send(req, check)
+		}
+		key := cacheKey(req.URL.String(), req.Header)
+		cached := c.get(key)
+		if cached != nil {
+			conditional, err := http.NewRequest(http.MethodGet, req.URL.String(), nil)
+			if err != nil {
+				return nil, err
+			}
+			for name, values := range req.Header {
+				conditional.Header[name] = values
+			}
+			if etag := cached.Header.Get("ETag"); etag != "" {
+				conditional.Header.Set("If-None-Match", etag)
+			}
+			if modified := cached.Header.Get("Last-Modified"); modified != "" {
+				conditional.Header.Set("If-Modified-Since", modified)
+			}
+			req = conditional
+		}
+		resp, err := send(req, check)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusNotModified && cached != nil {
+			// the response keeps the requests and the TLS state of the
+			// fetch, for the redirections and the certificate
+			resp.Body.Close()
+			resp.Status = fmt.Sprintf("%d %s", cached.StatusCode, http.StatusText(cached.StatusCode))
+			resp.StatusCode = cached.StatusCode
+			resp.Header = cached.Header
+			resp.ContentLength = int64(len(cached.Body))
+			resp.Body = ioutil.NopCloser(bytes.NewReader(cached.Body))
+			return resp, nil
+		}
+		return c.store(key, resp)
+	}
+}
+
+// store keeps resp in the cache if it has a validator and is small enough,
+// and returns it with a body that can be read again
+func (c *FetchCache) store(key string, resp *http.Response) (*http.Response, error) {
+	if resp.StatusCode != http.StatusOK || !cacheable(resp.Header) {
+		return resp, nil
+	}
+	limit := c.maxSize / 8
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		// too large for the cache, the rest of the body is read from
+		// the web site
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	// the cache only saves work, the response is valid even if it could
+	// not be stored
+	c.put(key, &cachedResponse{resp.StatusCode, resp.Header, body})
+	return resp, nil
+}
+
+// cacheable returns true if the response of the header has a validator and
+// can be stored
+func cacheable(h http.Header) bool {
+	if strings.Contains(strings.ToLower(h.Get("Cache-Control")), "no-store") {
+		return false
+	}
+	return h.Get("ETag") != "" || h.Get("Last-Modified") != ""
+}
+
+// cacheKey returns the name of the file of the response of url fetched with
+// the header. The names of the header are canonicalized and sorted, so that
+// the same headers always give the same key, and a request without header
+// has the key of the hash of its url.
+func cacheKey(url string, header http.Header) string {
+	h := sha256.New()
+	h.Write([]byte(url))
+	lines := make([]string, 0, len(header))
+	for name, values := range header {
+		lines = append(lines, http.CanonicalHeaderKey(name)+": "+strings.Join(values, ", "))
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		h.Write([]byte("\n" + line))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get returns the cached response of key, nil if there is none, and marks it
+// as the most recently used
+func (c *FetchCache) get(key string) *cachedResponse {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	path := filepath.Join(c.dir, key)
+	data, err := ioutil.ReadFile(path)
+	cached := &cachedResponse{}
+	if err == nil {
+		err = json.Unmarshal(data, cached)
+	}
+	if err != nil {
+		c.remove(e)
+		return nil
+	}
+	c.lru.MoveToFront(e)
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return cached
+}
+
+// put stores the response of key and drops the least recently used
+// responses beyond the size of the cache
+func (c *FetchCache) put(key string, cached *cachedResponse) error {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// write in a temporary file first so that a crash never leaves a
+	// truncated response
+	path := filepath.Join(c.dir, key)
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	if e, ok := c.entries[key]; ok {
+		c.size -= e.Value.(*cacheEntry).size
+		c.lru.Remove(e)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key, int64(len(data))})
+	c.size += int64(len(data))
+	c.evict()
+	return nil
+}
+
+// evict drops the least recently used responses until the cache fits its
+// size, the caller holds the lock
+func (c *FetchCache) evict() {
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops the response of e, the caller holds the lock
+func (c *FetchCache) remove(e *list.Element) {
+	entry := e.Value.(*cacheEntry)
+	os.Remove(filepath.Join(c.dir, entry.key))
+	c.lru.Remove(e)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
+
+// Size returns the size in bytes of the responses in the cache
+func (c *FetchCache) Size() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.size
+}
@@ -0,0 +1,96 @@
+package protocol
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fetchcache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the style sheet has an ETag, the image has none
+	downloads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/style.css", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("Content-Type", "text/css")
+		w.Write([]byte("body { color: red }"))
+	})
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write([]byte("png"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	cache, err := NewFetchCache(dir, 4096)
+	require.NoError(t, err)
+	fetch := GetFetcher(cache.Sender(LocalSender(addr)))
+	get := func(url string) string {
+		resp, err := fetch(url, nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	// the second fetch of the style sheet is revalidated, not downloaded
+	require.Equal(t, "body { color: red }", get("http://example.com/style.css"))
+	require.Equal(t, "body { color: red }", get("http://example.com/style.css"))
+	require.Equal(t, 1, downloads)
+	get("http://example.com/image.png")
+	get("http://example.com/image.png")
+	require.Equal(t, 3, downloads)
+
+	// the responses fetched with headers are cached apart, by headers
+	fetchAs := func(language string) Fetcher {
+		return HeaderFetcher(fetch, cache.Sender(LocalSender(addr)), map[string]string{"Accept-Language": language})
+	}
+	getAs := func(language string) string {
+		resp, err := fetchAs(language)("http://example.com/style.css", nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+	require.Equal(t, "body { color: red }", getAs("fr"))
+	require.Equal(t, 4, downloads)
+	require.Equal(t, "body { color: red }", getAs("fr"))
+	require.Equal(t, 4, downloads)
+	require.Equal(t, "body { color: red }", getAs("de"))
+	require.Equal(t, 5, downloads)
+	require.Equal(t, cacheKey("http://example.com/a", http.Header{"accept-language": {"fr"}, "X-A": {"1"}}),
+		cacheKey("http://example.com/a", http.Header{"X-A": {"1"}, "Accept-Language": {"fr"}}))
+	require.NotEqual(t, cacheKey("http://example.com/a", nil), cacheKey("http://example.com/a", http.Header{"X-A": {"1"}}))
+
+	// a new cache of the directory keeps the responses
+	cache, err = NewFetchCache(dir, 4096)
+	require.NoError(t, err)
+	require.True(t, cache.Size() > 0)
+	fetch = GetFetcher(cache.Sender(LocalSender(addr)))
+	require.Equal(t, "body { color: red }", get("http://example.com/style.css"))
+	require.Equal(t, 5, downloads)
+
+	// the least recently used responses are dropped beyond the size
+	small, err := NewFetchCache(dir, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), small.Size())
+}
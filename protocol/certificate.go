@@ -0,0 +1,98 @@
+package protocol
+
+/*
+The certificate.go defines the consensus on the TLS certificate of the saved
+page. Each conode signs the hash of the leaf certificate it observed for the
+save request, so that a node of the tree can neither forge nor repeat the
+observations of its subtree, and the root only keeps the hash observed by at
+least a threshold of conodes.
+*/
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// CertificateObservation is the hash of the leaf TLS certificate observed by
+// a conode
+//    - Public is the key of the conode
+//    - Hash is the hash of the leaf certificate, see lib.CertificateHash
+//    - Signature is the schnorr signature of the conode on the hash and the
+//      request ID
+type CertificateObservation struct {
+	Public    kyber.Point
+	Hash      string
+	Signature []byte
+}
+
+// NewCertificateObservation returns the observation of the leaf of chain by
+// the conode of private, signed for the save request requestID
+func NewCertificateObservation(requestID string, chain [][]byte, private kyber.Scalar) (*CertificateObservation, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate observed")
+	}
+	c := &CertificateObservation{
+		Public: decenarch.Suite.Point().Mul(private, nil),
+		Hash:   lib.CertificateHash(chain[0]),
+	}
+	sig, err := schnorr.Sign(decenarch.Suite, private, c.message(requestID))
+	if err != nil {
+		return nil, err
+	}
+	c.Signature = sig
+	return c, nil
+}
+
+// message returns the bytes signed by the conode
+func (c CertificateObservation) message(requestID string) []byte {
+	return []byte("certificate\x00" + requestID + "\x00" + c.Hash)
+}
+
+// Verify checks that the observation comes from a conode of publics and is
+// signed by it for the save request requestID
+func (c CertificateObservation) Verify(requestID string, publics []kyber.Point) error {
+	if !hasKey(publics, c.Public) {
+		return errors.New("certificate observed by a conode outside the roster")
+	}
+	if err := schnorr.Verify(decenarch.Suite, c.Public, c.message(requestID), c.Signature); err != nil {
+		return fmt.Errorf("invalid signature of the certificate: %v", err)
+	}
+	return nil
+}
+
+// VerifiedCertificates returns the observations of certificates signed for
+// the save request requestID by the conodes of publics, one per conode, and
+// the errors of the others
+func VerifiedCertificates(requestID string, observations []CertificateObservation, publics []kyber.Point) ([]CertificateObservation, []error) {
+	seen := make(map[string]bool)
+	var verified []CertificateObservation
+	var errs []error
+	for _, c := range observations {
+		if err := c.Verify(requestID, publics); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if seen[c.Public.String()] {
+			errs = append(errs, fmt.Errorf("certificate observed twice by %s", c.Public))
+			continue
+		}
+		seen[c.Public.String()] = true
+		verified = append(verified, c)
+	}
+	return verified, errs
+}
+
+// CertificateHashes returns the hashes of the observations
+func CertificateHashes(observations []CertificateObservation) []string {
+	hashes := make([]string, len(observations))
+	for i, c := range observations {
+		hashes[i] = c.Hash
+	}
+	return hashes
+}
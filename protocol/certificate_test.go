@@ -0,0 +1,49 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/util/key"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func TestVerifiedCertificates(t *testing.T) {
+	a := key.NewKeyPair(decenarch.Suite)
+	b := key.NewKeyPair(decenarch.Suite)
+	outsider := key.NewKeyPair(decenarch.Suite)
+	publics := []kyber.Point{a.Public, b.Public}
+	chain := [][]byte{[]byte("leaf")}
+
+	observe := func(private kyber.Scalar, requestID string) CertificateObservation {
+		c, err := NewCertificateObservation(requestID, chain, private)
+		require.NoError(t, err)
+		return *c
+	}
+	_, err := NewCertificateObservation("request", nil, a.Private)
+	require.Error(t, err)
+
+	signed := observe(a.Private, "request")
+	forged := observe(b.Private, "request")
+	forged.Hash = lib.CertificateHash([]byte("other"))
+	unsigned := CertificateObservation{Public: b.Public, Hash: signed.Hash}
+	observations := []CertificateObservation{
+		signed,
+		signed,
+		forged,
+		unsigned,
+		observe(b.Private, "other request"),
+		observe(outsider.Private, "request"),
+	}
+	verified, errs := VerifiedCertificates("request", observations, publics)
+	require.Equal(t, []CertificateObservation{signed}, verified)
+	require.Len(t, errs, 5)
+	require.Equal(t, []string{signed.Hash}, CertificateHashes(verified))
+
+	verified, errs = VerifiedCertificates("request", []CertificateObservation{signed, observe(b.Private, "request")}, publics)
+	require.Empty(t, errs)
+	require.Equal(t, signed.Hash, lib.MostCommonCertificate(CertificateHashes(verified), 2))
+}
@@ -0,0 +1,79 @@
+package protocol
+
+/*
+The charset.go defines how the conodes normalize the character encoding of
+the pages. The leaves of the pages are compared across the conodes, so every
+page is converted to UTF-8 before being parsed, whatever its charset. The
+charset declared in the page and in its content type is replaced by UTF-8, so
+that the consensus page is displayed correctly, and the original charset is
+recorded with the page.
+*/
+
+import (
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+)
+
+// utf8Charset is the name of the charset of the normalized pages
+const utf8Charset = "utf-8"
+
+// toUTF8 returns body, served with the given content type, converted to
+// UTF-8 and the name of its original charset
+func toUTF8(body []byte, contentType string) ([]byte, string, error) {
+	e, name, certain := charset.DetermineEncoding(body, contentType)
+	// a page declaring no charset and valid as UTF-8 is read as UTF-8
+	// instead of windows-1252, the default of the browsers
+	if !certain && utf8.Valid(body) {
+		return body, utf8Charset, nil
+	}
+	if e == encoding.Nop || name == utf8Charset {
+		return body, utf8Charset, nil
+	}
+	decoded, err := e.NewDecoder().Bytes(body)
+	if err != nil {
+		return nil, name, err
+	}
+	return decoded, name, nil
+}
+
+// utf8ContentType returns the content type with its charset set to UTF-8
+func utf8ContentType(contentType string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	if _, ok := params["charset"]; !ok {
+		return contentType
+	}
+	params["charset"] = utf8Charset
+	return mime.FormatMediaType(mediaType, params)
+}
+
+// setUTF8Meta sets to UTF-8 the charset declared by the meta elements of the
+// tree
+func setUTF8Meta(n *html.Node) {
+	if n.Type == html.ElementNode && n.Data == "meta" {
+		httpEquiv := false
+		for _, a := range n.Attr {
+			if strings.EqualFold(a.Key, "http-equiv") && strings.EqualFold(strings.TrimSpace(a.Val), "content-type") {
+				httpEquiv = true
+			}
+		}
+		for i, a := range n.Attr {
+			switch {
+			case strings.EqualFold(a.Key, "charset"):
+				n.Attr[i].Val = utf8Charset
+			case httpEquiv && strings.EqualFold(a.Key, "content"):
+				n.Attr[i].Val = utf8ContentType(a.Val)
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		setUTF8Meta(c)
+	}
+}
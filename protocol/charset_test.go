@@ -0,0 +1,46 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func TestToUTF8(t *testing.T) {
+	// "café" in ISO-8859-1
+	latin1 := []byte("<html><head><meta charset=\"iso-8859-1\"></head><body>caf\xe9</body></html>")
+	body, name, err := toUTF8(latin1, "text/html")
+	require.NoError(t, err)
+	require.Equal(t, "windows-1252", name)
+	require.Contains(t, string(body), "café")
+
+	// the content type has priority over the meta element
+	body, name, err = toUTF8([]byte("caf\xe9"), "text/html; charset=ISO-8859-15")
+	require.NoError(t, err)
+	require.Equal(t, "iso-8859-15", name)
+	require.Equal(t, "café", string(body))
+
+	// pages without charset are kept if they are valid UTF-8
+	page := []byte("<p>café</p>")
+	body, name, err = toUTF8(page, "text/html")
+	require.NoError(t, err)
+	require.Equal(t, utf8Charset, name)
+	require.Equal(t, page, body)
+}
+
+func TestSetUTF8Meta(t *testing.T) {
+	require.Equal(t, "text/html; charset=utf-8", utf8ContentType("text/html; charset=ISO-8859-1"))
+	require.Equal(t, "text/html", utf8ContentType("text/html"))
+
+	page := `<html><head><meta charset="iso-8859-1"><meta http-equiv="Content-Type" content="text/html; charset=iso-8859-1"></head><body></body></html>`
+	tree, err := html.Parse(bytes.NewReader([]byte(page)))
+	require.NoError(t, err)
+	setUTF8Meta(tree)
+	var b bytes.Buffer
+	require.NoError(t, html.Render(&b, tree))
+	require.Contains(t, b.String(), `<meta charset="utf-8"/>`)
+	require.Contains(t, b.String(), `content="text/html; charset=utf-8"`)
+	require.NotContains(t, b.String(), "iso-8859-1")
+}
@@ -0,0 +1,370 @@
+package protocol
+
+/*
+The consensus_merkle.go defines the ConsensusMerkle protocol, used by the
+Merkle consensus engine. Each conode fetches the page, hashes the unique
+leaves of its HTML tree and commits to the set of hashes with the signed root
+of the Merkle tree built on the sorted hashes. The commitments go up the tree
+to the root, which reconciles the sets: it checks every commitment against its
+set and keeps the hashes committed by at least threshold conodes. Unlike the
+counting Bloom filter, the intersection is exact.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/net/html"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func init() {
+	network.RegisterMessage(MerkleAnnounce{})
+	network.RegisterMessage(MerkleReply{})
+	onet.GlobalProtocolRegister(NameConsensusMerkle, NewConsensusMerkleProtocol)
+}
+
+// ConsensusMerkleState holds the local state of a node when it runs the
+// ConsensusMerkle protocol
+type ConsensusMerkleState struct {
+	*onet.TreeNodeInstance
+	RequestID   string
+	Url         string
+	ContentType string
+	Charset     string
+	Threshold   int
+
+	// LocalTree is the HTML tree fetched by the node, Leaves its unique
+	// leaves and Blobs the inline blobs extracted from it
+	LocalTree *html.Node
+	Leaves    []string
+	Blobs     []InlineBlob
+
+	// Commitments are the valid commitments of the node and its subtree,
+	// and Consensus the hashes of the leaves committed by at least
+	// Threshold conodes, computed by the root
+	Commitments []MerkleCommitment
+	Consensus   map[string]bool
+
+	// Publics are the public keys of the roster given at setup, only the
+	// commitments of these conodes are kept. The keys of the roster of the
+	// tree are used if it is nil.
+	Publics []kyber.Point
+
+	// CertificateChain is the TLS certificate chain observed by the node
+	// and CertificateHash the leaf certificate hash committed by at least
+	// Threshold nodes, computed by the root
+	CertificateChain [][]byte
+	CertificateHash  string
+
+	// see ConsensusStructuredState
+	ClientRequest *ClientRequest
+	VerifyRequest func(*ClientRequest) error
+	CheckURL      URLChecker
+	Fetch         Fetcher
+	Send          Sender
+	MaxSize       int64
+	Render        bool
+	Renderer      Renderer
+	Version       int32
+	Extractor     string
+	Strip         []string
+	VerifyStrip   func(url string, strip []string) error
+	Headers       map[string]string
+
+	Finished chan bool
+
+	doneOnce sync.Once
+}
+
+// NewConsensusMerkleProtocol initialises the structure for use in one round
+func NewConsensusMerkleProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewConsensusMerkleProtocol")
+	t := &ConsensusMerkleState{
+		TreeNodeInstance: n,
+		Version:          Version,
+		Finished:         make(chan bool, 1),
+	}
+	for _, handler := range []interface{}{t.HandleAnnounce, t.HandleReply} {
+		if err := t.RegisterHandler(handler); err != nil {
+			return nil, errors.New("couldn't register handler: " + err.Error())
+		}
+	}
+	return t, nil
+}
+
+// done ends the protocol for the node, once, whether it finished or the root
+// gave up waiting for it, see MerkleEngine.Run
+func (p *ConsensusMerkleState) done() {
+	p.doneOnce.Do(func() { p.Done() })
+}
+
+// Start fetches the page of the root and sends the announcement to the
+// children. This function is executed only by the root of the tree
+func (p *ConsensusMerkleState) Start() error {
+	p.logger().Lvl3("Starting Merkle consensus", "url", p.Url)
+	if err := p.commit(); err != nil {
+		return err
+	}
+	if p.IsLeaf() {
+		return p.HandleReply(nil)
+	}
+	return p.SendToChildren(&MerkleAnnounce{
+		RequestID:     p.RequestID,
+		Url:           p.Url,
+		ClientRequest: p.ClientRequest,
+		Render:        p.Render,
+		Version:       p.Version,
+		Extractor:     p.Extractor,
+		Strip:         p.Strip,
+		Headers:       p.Headers,
+	})
+}
+
+// HandleAnnounce fetches the page and forwards the announcement down the tree
+func (p *ConsensusMerkleState) HandleAnnounce(msg StructMerkleAnnounce) error {
+	p.RequestID = msg.MerkleAnnounce.RequestID
+	p.Url = msg.MerkleAnnounce.Url
+	p.ClientRequest = msg.MerkleAnnounce.ClientRequest
+	p.Render = msg.MerkleAnnounce.Render
+	p.Extractor = msg.MerkleAnnounce.Extractor
+	p.Strip = msg.MerkleAnnounce.Strip
+	p.Headers = msg.MerkleAnnounce.Headers
+	p.logger().Lvl4("Handling Merkle announce", "url", p.Url)
+
+	// a node that doesn't support the version of the root replies
+	// without commitments, so that its parent doesn't wait for it
+	version, err := NegotiateVersion(msg.MerkleAnnounce.Version)
+	if err != nil {
+		p.logger().Lvl1("Refusing the save", "error", err)
+		defer p.done()
+		p.Finished <- true
+		return p.SendToParent(&MerkleReply{})
+	}
+	p.Version = version
+
+	// refuse to work for clients that are not authorized
+	if p.VerifyRequest != nil {
+		if err := p.VerifyRequest(p.ClientRequest); err != nil {
+			p.logger().Lvl1("Unauthorized save request", "error", err)
+			return err
+		}
+	}
+	if p.VerifyStrip != nil {
+		if err := p.VerifyStrip(p.Url, p.Strip); err != nil {
+			p.logger().Lvl1("Refusing the strip selectors of the root", "error", err)
+			return err
+		}
+	}
+
+	// a node that cannot get the page doesn't commit but still forwards
+	// the commitments of its subtree
+	if err := p.commit(); err != nil {
+		p.logger().Lvl1("Impossible to commit to the page", "error", err)
+	}
+	if p.IsLeaf() {
+		return p.HandleReply(nil)
+	}
+	return p.SendToChildren(&msg.MerkleAnnounce)
+}
+
+// HandleReply aggregates the commitments of the children. The root computes
+// the consensus, the other nodes send the commitments to their parent.
+func (p *ConsensusMerkleState) HandleReply(reply []StructMerkleReply) error {
+	defer p.done()
+	for _, r := range reply {
+		for _, c := range r.Commitments {
+			if err := c.Verify(p.publics()); err != nil {
+				p.logger().Lvl1("Ignoring invalid commitment", "error", err)
+				continue
+			}
+			p.Commitments = append(p.Commitments, c)
+		}
+	}
+
+	if !p.IsRoot() {
+		err := p.SendToParent(&MerkleReply{Commitments: p.Commitments})
+		p.Finished <- true
+		return err
+	}
+
+	p.Consensus = ReconcileCommitments(p.Commitments, p.Threshold, p.publics())
+	certificates := make([]string, len(p.Commitments))
+	for i, c := range p.Commitments {
+		certificates[i] = c.CertificateHash
+	}
+	p.CertificateHash = lib.MostCommonCertificate(certificates, p.Threshold)
+	p.logger().Lvl3("Merkle consensus reached", "commitments", len(p.Commitments), "leaves", len(p.Consensus))
+	p.Finished <- true
+	return nil
+}
+
+// commit fetches the page and adds the commitment of the node to its leaves
+func (p *ConsensusMerkleState) commit() error {
+	template := p.ClientRequest.template()
+	if err := ValidateTemplate(template, p.Render); err != nil {
+		return err
+	}
+	renderer, err := pageRenderer(p.Render, p.Renderer)
+	if err != nil {
+		return err
+	}
+	extractor, err := lib.GetLeafExtractor(p.Extractor)
+	if err != nil {
+		return err
+	}
+	strip, err := lib.ParseSelectors(p.Strip)
+	if err != nil {
+		return err
+	}
+	fetch := HeaderFetcher(fetcher(p.Fetch), sender(p.Send), p.Headers)
+	fetch = templateFetcher(fetch, HeaderSender(sender(p.Send), p.Headers), template)
+	page, err := fetchHTMLPage(fetch, p.Url, p.CheckURL, p.MaxSize, renderer)
+	if page != nil {
+		p.Url = page.Url
+		p.ContentType = page.ContentType
+		p.Charset = page.Charset
+		p.CertificateChain = page.CertificateChain
+	}
+	if err != nil {
+		return &decenarch.ErrFetchFailed{URL: p.Url, Reason: err.Error()}
+	}
+	// see ConsensusStructuredState.GetLocalHTMLData
+	lib.StripElements(page.Tree, strip)
+	extractor.Prune(page.Tree)
+	p.LocalTree = page.Tree
+	p.Blobs = page.Blobs
+	p.Leaves = lib.ListLeaves(page.Tree, extractor)
+	var certificate string
+	if len(p.CertificateChain) > 0 {
+		certificate = lib.CertificateHash(p.CertificateChain[0])
+	}
+	c, err := NewMerkleCommitment(decenarch.Suite, p.Private(), p.Public(), p.Leaves, certificate, page.Redirects)
+	if err != nil {
+		return err
+	}
+	p.Commitments = append(p.Commitments, *c)
+	return nil
+}
+
+// publics returns the public keys of the conodes whose commitments are kept
+func (p *ConsensusMerkleState) publics() []kyber.Point {
+	if p.Publics != nil {
+		return p.Publics
+	}
+	return p.Roster().Publics()
+}
+
+// logger returns the structured logger of this node for the current save
+func (p *ConsensusMerkleState) logger() *lib.Logger {
+	return lib.NewLogger(p.RequestID, p.ServerIdentity().Address.String()).With("protocol", NameConsensusMerkle)
+}
+
+// NewMerkleCommitment returns the signed commitment to the given leaves,
+// certificate hash and redirect chain
+func NewMerkleCommitment(suite schnorr.Suite, private kyber.Scalar, public kyber.Point, leaves []string, certificate string, redirects []string) (*MerkleCommitment, error) {
+	c := &MerkleCommitment{
+		Public:          public,
+		Hashes:          lib.LeafHashes(leaves),
+		CertificateHash: certificate,
+		Redirects:       redirects,
+	}
+	c.Root = lib.MerkleRoot(c.Hashes)
+	sig, err := schnorr.Sign(suite, private, c.message())
+	if err != nil {
+		return nil, err
+	}
+	c.Signature = sig
+	return c, nil
+}
+
+// message returns the bytes signed by the conode
+func (c *MerkleCommitment) message() []byte {
+	msg := append(append([]byte{}, c.Root...), []byte(c.CertificateHash)...)
+	for _, url := range c.Redirects {
+		msg = append(append(msg, 0), []byte(url)...)
+	}
+	return msg
+}
+
+// Redirection returns the redirect chain committed by the conode, signed by
+// the signature of the commitment
+func (c *MerkleCommitment) Redirection() Redirection {
+	return Redirection{Public: c.Public, Chain: c.Redirects}
+}
+
+// Verify checks that the commitment comes from a conode of publics, that its
+// hashes are sorted, match its Merkle root, and that the root is signed by the
+// conode
+func (c *MerkleCommitment) Verify(publics []kyber.Point) error {
+	if !hasKey(publics, c.Public) {
+		return errors.New("commitment of a conode outside the roster")
+	}
+	for i := 1; i < len(c.Hashes); i++ {
+		if bytes.Compare(c.Hashes[i-1], c.Hashes[i]) >= 0 {
+			return errors.New("hashes of the commitment are not sorted")
+		}
+	}
+	if !bytes.Equal(lib.MerkleRoot(c.Hashes), c.Root) {
+		return errors.New("hashes don't match the Merkle root of the commitment")
+	}
+	if err := schnorr.Verify(decenarch.Suite, c.Public, c.message(), c.Signature); err != nil {
+		return fmt.Errorf("invalid signature of the commitment: %v", err)
+	}
+	return nil
+}
+
+// ReconcileCommitments returns the hashes, as strings, committed by at least
+// threshold conodes of publics. Only one commitment per conode is counted.
+func ReconcileCommitments(commitments []MerkleCommitment, threshold int, publics []kyber.Point) map[string]bool {
+	counts, _ := commitmentCounts(commitments, publics)
+	consensus := make(map[string]bool)
+	for h, n := range counts {
+		if n >= threshold {
+			consensus[h] = true
+		}
+	}
+	return consensus
+}
+
+// commitmentCounts returns the number of conodes of publics that committed
+// each hash, as a string, and the number of these conodes that sent a
+// commitment. Only one commitment per conode is counted.
+func commitmentCounts(commitments []MerkleCommitment, publics []kyber.Point) (map[string]int, int) {
+	counts := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, c := range commitments {
+		if seen[c.Public.String()] || !hasKey(publics, c.Public) {
+			continue
+		}
+		seen[c.Public.String()] = true
+		for _, h := range c.Hashes {
+			counts[string(h)]++
+		}
+	}
+	return counts, len(seen)
+}
+
+// hasKey returns true if public is one of the keys of publics
+func hasKey(publics []kyber.Point, public kyber.Point) bool {
+	if public == nil {
+		return false
+	}
+	for _, p := range publics {
+		if p.Equal(public) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/util/key"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func TestMerkleCommitment(t *testing.T) {
+	leaves := [][]string{
+		{"title", "first", "second"},
+		{"title", "first", "ad"},
+		{"title", "second", "other ad"},
+	}
+	commitments := make([]MerkleCommitment, len(leaves))
+	publics := make([]kyber.Point, len(leaves))
+	for i, l := range leaves {
+		kp := key.NewKeyPair(decenarch.Suite)
+		publics[i] = kp.Public
+		c, err := NewMerkleCommitment(decenarch.Suite, kp.Private, kp.Public, l, "", nil)
+		require.Nil(t, err)
+		require.Nil(t, c.Verify(publics))
+		commitments[i] = *c
+	}
+
+	// tampered commitments are refused
+	tampered := commitments[0]
+	tampered.Hashes = tampered.Hashes[1:]
+	require.NotNil(t, tampered.Verify(publics))
+	tampered = commitments[0]
+	tampered.CertificateHash = "forged"
+	require.NotNil(t, tampered.Verify(publics))
+
+	// the valid commitments of conodes outside the roster are refused and
+	// not counted, so that one conode cannot commit with fresh keys
+	var sybils []MerkleCommitment
+	for i := 0; i < 2; i++ {
+		kp := key.NewKeyPair(decenarch.Suite)
+		c, err := NewMerkleCommitment(decenarch.Suite, kp.Private, kp.Public, []string{"title", "ad"}, "", nil)
+		require.Nil(t, err)
+		require.NotNil(t, c.Verify(publics))
+		sybils = append(sybils, *c)
+	}
+	require.False(t, ReconcileCommitments(append(commitments, sybils...), 2, publics)[string(lib.LeafHash("ad"))])
+
+	// only the leaves committed by threshold conodes are kept, and a conode
+	// is counted once
+	consensus := ReconcileCommitments(append(commitments, commitments[1]), 2, publics)
+	require.Len(t, consensus, 3)
+	for _, l := range []string{"title", "first", "second"} {
+		require.True(t, consensus[string(lib.LeafHash(l))])
+	}
+	require.False(t, consensus[string(lib.LeafHash("ad"))])
+
+	counts, conodes := commitmentCounts(append(commitments, commitments[1]), publics)
+	require.Equal(t, 3, conodes)
+	require.Equal(t, 3, counts[string(lib.LeafHash("title"))])
+	require.Equal(t, 1, counts[string(lib.LeafHash("ad"))])
+}
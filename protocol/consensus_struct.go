@@ -8,8 +8,8 @@ so that it can find out who sent the message.
 */
 
 import (
+	decenarch "github.com/dedis/student_18_decenar"
 	"github.com/dedis/student_18_decenar/lib"
-	"golang.org/x/net/html"
 
 	"gopkg.in/dedis/kyber.v2"
 	"gopkg.in/dedis/onet.v2"
@@ -18,6 +18,7 @@ import (
 // Name can be used from other packages to refer to this protocol.
 const NameConsensusStructured = "ConsensusStructured"
 const NameConsensusUnstructured = "ConsensusUnstructured"
+const NameConsensusMerkle = "ConsensusMerkle"
 
 // ***************** Struct for DecenarchSave ****************************** //
 
@@ -32,13 +33,72 @@ const (
 	End
 )
 
+// String returns the name of the phase
+func (p SavePhase) String() string {
+	switch p {
+	case NilPhase:
+		return "Nil"
+	case Consensus:
+		return "Consensus"
+	case RequestMissingData:
+		return "RequestMissingData"
+	case End:
+		return "End"
+	default:
+		return "Unknown"
+	}
+}
+
 // SaveAnnounce is used to pass a message to all children when the protocol
 // called is DecenarchSave
+//     RequestID:		identifier of the save, used for logging
 //     Url:			url of the webpage the conodes will reach consensus on
-//     ParametersCBF:		parameters, i,e, m and k, of the counting Bloom filter
+//     ParametersCBF:		parameters, i,e, m, k and the hashing version, of
+//				the counting Bloom filter, see lib.HashingFast64
+//     FalsePositiveRate:	target false positive rate used to compute
+//				ParametersCBF, 0 for lib.DefaultFalsePositiveRate
+//     ClientRequest:		signed request of the client, nil if the client
+//				didn't sign the request
+//     Render:			true if the page must be rendered by a browser
+//     Version:			version of the protocol run by the root, see
+//				version.go. It is the last field so that the
+//				older conodes still decode the message
+//     Extractor:		name of the leaf extractor of the save, see
+//				lib.GetLeafExtractor, empty for the text leaves
+//     Strip:			CSS selectors of the elements removed from the
+//				page before the leaves are extracted, resolved
+//				by the root, see lib.StripElements
+//     Headers:			headers of the requests fetching the page,
+//				resolved by the root, see
+//				decenarch.MergeFetchHeaders
 type SaveAnnounceStructured struct {
-	Url           string
-	ParametersCBF []uint64
+	RequestID         string
+	Url               string
+	ParametersCBF     []uint64
+	FalsePositiveRate float64
+	ClientRequest     *ClientRequest
+	Render            bool
+	Version           int32
+	Extractor         string
+	Strip             []string
+	Headers           map[string]string
+}
+
+// ClientRequest is the signed request of the client who asked to save the web
+// page. It is forwarded to all the conodes so that each of them can check that
+// the client is authorized before doing any work. Template is the request
+// replayed by the conodes to fetch the page, nil for a GET request, see
+// template.go. A request with a template is forwarded even if it is not
+// signed. Feed is the signed request of the client watching the feed listing
+// the page, for the saves of the entries of the feeds watched by the root,
+// see decenarch.SaveRequest.
+type ClientRequest struct {
+	Url       string
+	Timestamp int64
+	PublicKey kyber.Point
+	Signature []byte
+	Template  *decenarch.RequestTemplate
+	Feed      *decenarch.WatchFeedRequest
 }
 
 // StructSaveAnnounce just contains SaveAnnounce and the data necessary to
@@ -51,20 +111,51 @@ type StructSaveAnnounceStructured struct {
 // SaveReply return the protocol status, the consensus data and the errors of
 // the conode that executed a save request.
 //     Url:		url of the webpage the conodes will reach consensus on
-//     Errs:		errors that happends during the protocol
-//     EncryptedCBFSet: set of the spectral Bloom filter of a given node merged
-//			with the sets of the children's filters. If the node is
-//			a child, it contins the classical Bloom filter
+//     Errs:		errors of the node and its subtree during the protocol
+//     PackedCBFSet:	encrypted set of the spectral Bloom filter of a given
+//			node merged with the sets of the children's filters,
+//			packed by lib.CipherVector.Pack. If the node is a
+//			child, it contins the classical Bloom filter
 //     CBFSetSig:	signature of CBFSet
 //     CompleteProofs:  complete proofs of the operations performed by the nodes
+//     CertificateHashes: unused, the unsigned hashes of the leaf TLS
+//			certificates sent by the previous versions
+//     Redirections:	signed redirect chains followed by the node and its
+//			subtree
+//     Failed:		unused, the unsigned public keys of the failed
+//			nodes sent by the previous versions
+//     Evidence:	signed evidence against the nodes of the subtree
+//			whose contribution was rejected
+//     Certificates:	signed observations of the leaf TLS certificates by
+//			the node and its subtree
+//     ContributionSig: signature of the node on its contribution, see
+//			StructuredContribution
+//     Failures:	signed failures of the nodes of the subtree that
+//			could not fetch the page. A reply without
+//			PackedCBFSet is the explicit failure of the node
+//			sending it
 type SaveReplyStructured struct {
 	Url  string
-	Errs []error
+	Errs []decenarch.NodeError
 
-	EncryptedCBFSet *lib.CipherVector
-	CBFSetSig       []byte
+	PackedCBFSet []byte
+	CBFSetSig    []byte
 
 	CompleteProofs lib.CompleteProofs
+
+	CertificateHashes []string
+
+	Redirections []Redirection
+
+	Failed []string
+
+	Evidence []decenarch.Evidence
+
+	Certificates []CertificateObservation
+
+	ContributionSig []byte
+
+	Failures []Failure
 }
 
 // StructSaveReply
@@ -74,8 +165,10 @@ type StructSaveReplyStructured struct {
 }
 
 // Message used to send the complete proofs to the parent
+//     Version:		version of the protocol run by the root
 type CompleteProofsAnnounce struct {
 	CompleteProofs lib.CompleteProofs
+	Version        int32
 }
 
 // StructCompleteProofsAnnounce
@@ -85,10 +178,19 @@ type StructCompleteProofsAnnounce struct {
 }
 
 // SaveAnnounceUnstructured
+//     Version:		version of the protocol run by the root, see
+//			SaveAnnounceStructured
+//     Headers:		see SaveAnnounceStructured, only sent in the
+//			Consensus phase
+//     RequestedUrl:	see ConsensusUnstructuredState
 type SaveAnnounceUnstructured struct {
-	Phase      SavePhase
-	Url        string
-	MasterHash map[string]map[kyber.Point][]byte
+	RequestID    string
+	Phase        SavePhase
+	Url          string
+	MasterHash   map[string]map[kyber.Point][]byte
+	Version      int32
+	Headers      map[string]string
+	RequestedUrl string
 }
 
 // StructSaveAnnounceUnstructured
@@ -100,22 +202,19 @@ type StructSaveAnnounceUnstructured struct {
 // SaveReplyUnstructured
 //     Phase:		phase the protocol is currently
 //     Url:		URL of the additional data to be archived
-//     Errs:		errors occured during the protocol
+//     Errs:		errors of the node and its subtree during the protocol
 //     MasterHash:      updated MasterHash for the given external resource.
 //			if the node has seen the resource, it adds it signature
 //			to the map.
-//     RequestedNode:	the map linking the hash of an AnonNode's data with its
-//			plaintext html data.
 //     RequestedData:	the map linking the hash of an unstructured data with
 //			its plaintext data.
 //
 type SaveReplyUnstructured struct {
 	Phase      SavePhase
 	Url        string
-	Errs       []error
+	Errs       []decenarch.NodeError
 	MasterHash map[string]map[kyber.Point][]byte
 
-	RequestedNode map[string]html.Node
 	RequestedData map[string][]byte
 }
 
@@ -124,3 +223,62 @@ type StructSaveReplyUnstructured struct {
 	*onet.TreeNode
 	SaveReplyUnstructured
 }
+
+// ***************** Struct for ConsensusMerkle ****************************** //
+
+// MerkleAnnounce is sent down the tree to start the Merkle consensus
+//     RequestID:		identifier of the save, used for logging
+//     Url:			url of the webpage the conodes will reach consensus on
+//     ClientRequest:		signed request of the client, see SaveAnnounceStructured
+//     Render:			see SaveAnnounceStructured
+//     Version:			see SaveAnnounceStructured
+//     Extractor:		see SaveAnnounceStructured
+//     Strip:			see SaveAnnounceStructured
+//     Headers:			see SaveAnnounceStructured
+type MerkleAnnounce struct {
+	RequestID     string
+	Url           string
+	ClientRequest *ClientRequest
+	Render        bool
+	Version       int32
+	Extractor     string
+	Strip         []string
+	Headers       map[string]string
+}
+
+// StructMerkleAnnounce
+type StructMerkleAnnounce struct {
+	*onet.TreeNode
+	MerkleAnnounce
+}
+
+// MerkleReply is sent up the tree with the commitments of the subtree
+type MerkleReply struct {
+	Commitments []MerkleCommitment
+}
+
+// StructMerkleReply
+type StructMerkleReply struct {
+	*onet.TreeNode
+	MerkleReply
+}
+
+// MerkleCommitment is the commitment of a conode to the leaves of its HTML
+// tree
+//     Public:		public key of the conode
+//     Hashes:		sorted hashes of the unique leaves, see lib.LeafHashes
+//     Root:		Merkle root of Hashes
+//     CertificateHash:	hash of the leaf TLS certificate observed by the
+//			conode, empty without TLS
+//     Redirects:		URLs fetched by the conode to get the page, see
+//			Redirection
+//     Signature:		schnorr signature of Root, CertificateHash and
+//			Redirects by the conode
+type MerkleCommitment struct {
+	Public          kyber.Point
+	Hashes          [][]byte
+	Root            []byte
+	CertificateHash string
+	Redirects       []string
+	Signature       []byte
+}
@@ -11,10 +11,15 @@ node will only use the `Handle`-methods, and not call `Start` again.
 */
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	urlpkg "net/url"
 	"regexp"
+	"sync"
+	"time"
 
 	"golang.org/x/net/html"
 
@@ -25,9 +30,15 @@ import (
 	"gopkg.in/dedis/onet.v2/log"
 	"gopkg.in/dedis/onet.v2/network"
 
+	decenarch "github.com/dedis/student_18_decenar"
 	"github.com/dedis/student_18_decenar/lib"
 )
 
+// replyTimeout is the time a node waits for the replies of its children, for
+// each level of its subtree. The children that didn't reply in time don't
+// contribute to the aggregation.
+var replyTimeout = 2 * time.Minute
+
 func init() {
 	network.RegisterMessage(SaveAnnounceStructured{})
 	network.RegisterMessage(SaveReplyStructured{})
@@ -39,15 +50,26 @@ func init() {
 // ConsensusStructuredProcol
 type ConsensusStructuredState struct {
 	*onet.TreeNodeInstance
+	RequestID   string
 	Phase       SavePhase
-	Errs        []error
+	Errs        []decenarch.NodeError
 	Url         string
 	ContentType string
+	Charset     string
 	SharedKey   kyber.Point
 
+	// ZeroPool holds encryptions of 0 under SharedKey precomputed by the
+	// conode, used to encrypt its filter. If ZeroPool is nil, all the
+	// buckets are encrypted when the filter is ready
+	ZeroPool *lib.ZeroPool
+
+	// LocalTree is the HTML tree fetched by the node and Blobs the inline
+	// blobs extracted from it
 	LocalTree *html.Node
+	Blobs     []InlineBlob
 
 	ParametersCBF            []uint
+	FalsePositiveRate        float64
 	CountingBloomFilter      *lib.CBF
 	EncryptedCBFSet          *lib.CipherVector
 	EncryptedCBFSetSignature []byte
@@ -55,7 +77,90 @@ type ConsensusStructuredState struct {
 	CompleteProofs       lib.CompleteProofs
 	CompleteProofsToSend lib.CompleteProofs
 
+	// ClientRequest is the signed request of the client, and VerifyRequest
+	// is used by the children to check it before fetching the web page. If
+	// VerifyRequest is nil, no check is done
+	ClientRequest *ClientRequest
+	VerifyRequest func(*ClientRequest) error
+
+	// CheckURL is used to refuse to fetch URLs, it can be nil
+	CheckURL URLChecker
+	// Fetch fetches the page, the fetcher of the conodes if nil, and Send
+	// replays the template of ClientRequest, the sender of the conodes if
+	// nil
+	Fetch Fetcher
+	Send  Sender
+	// MaxSize is the maximal size in bytes of the page, 0 means no limit
+	MaxSize int64
+	// Render tells if the page must be rendered by a browser before the
+	// consensus, with the Renderer of the conode
+	Render   bool
+	Renderer Renderer
+	// Extractor is the name of the leaf extractor of the save, see
+	// lib.GetLeafExtractor
+	Extractor string
+	// Strip are the CSS selectors of the elements removed from the page
+	// before the leaves are extracted, see lib.StripElements, sent by the
+	// root. VerifyStrip is used by the children to refuse the selectors
+	// they would not apply themselves. If VerifyStrip is nil, no check is
+	// done
+	Strip       []string
+	VerifyStrip func(url string, strip []string) error
+	// Headers are the headers of the requests fetching the page, see
+	// decenarch.MergeFetchHeaders
+	Headers map[string]string
+
+	// CertificateChain is the TLS certificate chain observed by the node,
+	// Certificates the signed observations of the leaf certificates by the
+	// node and its subtree, see certificate.go, and CertificateHash the
+	// leaf certificate hash observed by at least Threshold nodes, computed
+	// by the root
+	CertificateChain [][]byte
+	Certificates     []CertificateObservation
+	CertificateHash  string
+	Threshold        int
+
+	// Redirects are the URLs fetched by the node to get the page and
+	// Redirections the redirect chains followed by the node and its
+	// subtree, see redirect.go
+	Redirects    []string
+	Redirections []Redirection
+
+	// Failed contains the public keys of the nodes of the subtree that
+	// could not fetch the page or refused the request, and Failures their
+	// signed failures, see failure.go. The root finishes with false if
+	// less than Threshold nodes fetched the page
+	Failed   []string
+	Failures []Failure
+	// Evidence contains the signed evidence against the nodes of the
+	// subtree whose contribution was rejected by their parent, see
+	// verifyChildContribution
+	Evidence []decenarch.Evidence
+
+	// Faults are the misbehaviours injected in the node, nil for the
+	// conodes, see faults.go
+	Faults *Faults
+
+	// Version is the version of the protocol announced by the root, see
+	// version.go
+	Version int32
+
+	// Workers limits the goroutines encrypting the filter of the node and
+	// verifying the proofs of its children, see lib.WithWorkers. Zero means
+	// the workers of the conode
+	Workers int
+
 	Finished chan bool
+
+	// ctx is canceled when the protocol is shut down, to interrupt the
+	// computations on the filters
+	ctx           context.Context
+	cancel        context.CancelFunc
+	replies       []StructSaveReplyStructured
+	timeout       *time.Timer
+	aggregateOnce sync.Once
+	doneOnce      sync.Once
+	mutex         sync.Mutex
 }
 
 // NewSaveProtocol initialises the structure for use in one round
@@ -64,8 +169,10 @@ func NewConsensusStructuredProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInst
 	t := &ConsensusStructuredState{
 		TreeNodeInstance: n,
 		Url:              "",
-		Finished:         make(chan bool),
+		Version:          Version,
+		Finished:         make(chan bool, 1),
 	}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
 	for _, handler := range []interface{}{t.HandleAnnounce, t.HandleReply, t.HandleCompleteProofs} {
 		if err := t.RegisterHandler(handler); err != nil {
 			return nil, errors.New("couldn't register handler: " + err.Error())
@@ -80,30 +187,48 @@ func NewConsensusStructuredProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInst
 // Start sends the Announce-message to all children. This function is executed
 // only by the leader, i.e. root of the tree
 func (p *ConsensusStructuredState) Start() error {
-	log.Lvl3("Starting SaveLocalState")
+	p.logger().Lvl3("Starting structured consensus", "url", p.Url)
 
 	// get tree for the root
 	tree, err := p.GetLocalHTMLData()
 	if err != nil {
-		log.Error("Error in save protocol Start():", err)
-		return err
+		p.logger().Error("Error in save protocol Start()", "error", err)
+		return &decenarch.ErrFetchFailed{URL: p.Url, Reason: err.Error()}
 	}
 	p.LocalTree = tree
 
 	// compute and store CBF parameters
-	paramCBF := lib.GetOptimalCBFParametersToSend(tree)
-	p.ParametersCBF = castParametersCBF(paramCBF)
+	extractor, err := lib.GetLeafExtractor(p.Extractor)
+	if err != nil {
+		return err
+	}
+	paramCBF := lib.GetOptimalCBFParametersForLeaves(lib.ListLeaves(tree, extractor), p.FalsePositiveRate)
+	if p.ParametersCBF, err = lib.ParametersFromSent(paramCBF); err != nil {
+		return err
+	}
 
-	// send announcement to all conodes
+	// send announcement to all conodes. The conodes that cannot be
+	// contacted are failures, the consensus goes on if enough conodes
+	// remain
 	errs := p.Broadcast(&SaveAnnounceStructured{
-		Url:           p.Url,
-		ParametersCBF: paramCBF,
+		RequestID:         p.RequestID,
+		Url:               p.Url,
+		ParametersCBF:     paramCBF,
+		FalsePositiveRate: p.FalsePositiveRate,
+		ClientRequest:     p.ClientRequest,
+		Render:            p.Render,
+		Version:           p.Version,
+		Extractor:         p.Extractor,
+		Strip:             p.Strip,
+		Headers:           p.Headers,
 	})
-	// if at least one error, returns the concatenation of all the errors
-	if len(errs) > 0 {
-		log.Lvl1("Error when broadcasting message for structured data")
+	if len(errs) > len(p.Roster().List)-p.Threshold {
+		p.logger().Lvl1("Error when broadcasting message for structured data", "errors", len(errs))
 		return lib.ConcatenateErrors(errs)
+	} else if len(errs) > 0 {
+		p.logger().Lvl1("Some conodes could not be contacted", "errors", lib.ConcatenateErrors(errs))
 	}
+	p.waitReplies()
 
 	return nil
 }
@@ -114,71 +239,225 @@ func (p *ConsensusStructuredState) Start() error {
 // begining and end but each time a different 'case'. Each one can be
 // considered as an independant function.
 func (p *ConsensusStructuredState) HandleAnnounce(msg StructSaveAnnounceStructured) error {
-	log.Lvl4("Handling", p)
-	log.Lvl4("And the message", msg)
+	p.RequestID = msg.SaveAnnounceStructured.RequestID
 	p.Url = msg.SaveAnnounceStructured.Url
+	p.logger().Lvl4("Handling structured announce", "url", p.Url)
+
+	// a node that doesn't support the version of the root refuses to
+	// contribute rather than sending a filter the root cannot aggregate
+	version, err := NegotiateVersion(msg.SaveAnnounceStructured.Version)
+	if err != nil {
+		p.logger().Lvl1("Refusing the save", "error", err)
+		return p.sendFailure()
+	}
+	p.Version = version
+
+	// refuse to work for clients that are not authorized, the parent is
+	// told explicitly so that it doesn't wait for this node
+	p.ClientRequest = msg.SaveAnnounceStructured.ClientRequest
+	p.Render = msg.SaveAnnounceStructured.Render
+	p.Extractor = msg.SaveAnnounceStructured.Extractor
+	p.Strip = msg.SaveAnnounceStructured.Strip
+	p.Headers = msg.SaveAnnounceStructured.Headers
+	if p.VerifyRequest != nil {
+		if err := p.VerifyRequest(p.ClientRequest); err != nil {
+			p.logger().Lvl1("Unauthorized save request", "error", err)
+			return p.sendFailure()
+		}
+	}
+	if p.VerifyStrip != nil {
+		if err := p.VerifyStrip(p.Url, p.Strip); err != nil {
+			p.logger().Lvl1("Refusing the strip selectors of the root", "error", err)
+			return p.sendFailure()
+		}
+	}
+
+	// get CBF parameters
+	param, err := lib.ParametersFromSent(msg.SaveAnnounceStructured.ParametersCBF)
+	if err != nil {
+		p.logger().Lvl1("Refusing the save", "error", err)
+		return p.sendFailure()
+	}
+	p.ParametersCBF = param
+	p.FalsePositiveRate = msg.SaveAnnounceStructured.FalsePositiveRate
 
-	// get local version of the webpage
+	// get local version of the webpage. If the page cannot be fetched,
+	// the node contributes an empty filter so that the contributions of
+	// its subtree still reach the root
 	tree, err := p.GetLocalHTMLData()
 	if err != nil {
-		log.Error("Error in save protocol HandleAnnounce():", err)
-		return err
+		p.logger().Lvl1("Page not fetched, contributing an empty filter", "error", err)
+		p.fail()
 	}
 	p.LocalTree = tree
 
-	// get CBF parameters
-	p.ParametersCBF = castParametersCBF(msg.SaveAnnounceStructured.ParametersCBF)
-
-	// if we are in a leaf, we start the bottom-up part of the protocol
-	if p.IsLeaf() {
-		resp := StructSaveReplyStructured{
-			p.TreeNode(),
-			SaveReplyStructured{
-				Url:  msg.SaveAnnounceStructured.Url,
-				Errs: p.Errs},
+	// if we are in a leaf, we start the bottom-up part of the protocol,
+	// otherwise we wait for the children
+	p.waitReplies()
+	return nil
+}
+
+// HandleReply stores the reply of a child. The replies are aggregated once
+// all the children replied or when the timeout of the node expires, see
+// waitReplies.
+func (p *ConsensusStructuredState) HandleReply(reply StructSaveReplyStructured) error {
+	p.mutex.Lock()
+	p.replies = append(p.replies, reply)
+	complete := len(p.replies) >= len(p.Children())
+	p.mutex.Unlock()
+	if complete {
+		p.aggregateReplies()
+	}
+	return nil
+}
+
+// waitReplies aggregates the replies immediately if the node is a leaf, and
+// starts the timeout of the node otherwise. The timeout is proportional to
+// the height of the subtree of the node, so that a node gives up on a child
+// after the child gave up on its own children.
+func (p *ConsensusStructuredState) waitReplies() {
+	if len(p.Children()) == 0 {
+		p.aggregateReplies()
+		return
+	}
+	timeout := replyTimeout * time.Duration(subtreeHeight(p.TreeNode()))
+	p.mutex.Lock()
+	p.timeout = time.AfterFunc(timeout, func() {
+		p.logger().Lvl1("Timeout while waiting for the children", "timeout", timeout)
+		p.aggregateReplies()
+	})
+	p.mutex.Unlock()
+}
+
+// aggregateReplies aggregates the replies received so far, only once. The
+// children that did not reply are ignored.
+func (p *ConsensusStructuredState) aggregateReplies() {
+	p.aggregateOnce.Do(func() {
+		p.mutex.Lock()
+		if p.timeout != nil {
+			p.timeout.Stop()
+		}
+		replies := p.replies
+		p.mutex.Unlock()
+		if missing := len(p.Children()) - len(replies); missing > 0 {
+			p.logger().Lvl1("Some children did not reply", "missing", missing)
 		}
-		return p.HandleReply([]StructSaveReplyStructured{resp})
+		if err := p.aggregate(replies); err != nil {
+			p.logger().Error("Error while aggregating the replies", "error", err)
+		}
+	})
+}
+
+// sendFailure tells the parent that the node doesn't take part to the
+// consensus. The root has no parent and simply fails.
+func (p *ConsensusStructuredState) sendFailure() error {
+	defer p.done()
+	if p.IsRoot() {
+		return errors.New("root refused the request")
 	}
+	p.fail()
+	return p.SendToParent(&SaveReplyStructured{
+		Url:      p.Url,
+		Failures: p.Failures,
+	})
+}
 
-	return nil
+// fail adds the failure of the node, signed for the request, to the failures
+// of its subtree
+func (p *ConsensusStructuredState) fail() {
+	f, err := NewFailure(p.RequestID, p.Private())
+	if err != nil {
+		p.logger().Error("Cannot sign the failure", "error", err)
+		return
+	}
+	p.Failures = append(p.Failures, *f)
+	p.Failed = append(p.Failed, p.Public().String())
 }
 
-// HandleReply is the message going up the tree
+// subtreeHeight returns the height of the subtree rooted at n, 1 for a node
+// whose children are leaves
+func subtreeHeight(n *onet.TreeNode) int {
+	height := 0
+	for _, c := range n.Children {
+		if h := subtreeHeight(c) + 1; h > height {
+			height = h
+		}
+	}
+	return height
+}
+
+// aggregate is the message going up the tree
 //
 // Note: this function must be read as multiple functions with a common
 // begining and end but each time a different 'case'. Each one can be
 // considered as an independant function.
-func (p *ConsensusStructuredState) HandleReply(reply []StructSaveReplyStructured) error {
-	log.Lvl4("Handling Save Reply", p)
-	log.Lvl4("And the replies", reply)
+func (p *ConsensusStructuredState) aggregate(reply []StructSaveReplyStructured) error {
+	p.logger().Lvl4("Handling structured reply", "replies", len(reply))
 	// compute and aggregate CBF
 	err := p.AggregateCBF(p.LocalTree, reply)
 	if err != nil {
+		if p.IsRoot() {
+			p.Finished <- false
+		}
 		return err
 	}
 
 	// aggregate errors
 	p.AggregateErrors(reply)
 
+	// aggregate failures
+	p.AggregateFailures(reply)
+
+	// aggregate observed certificates and redirections
+	p.AggregateCertificates(reply)
+	p.AggregateRedirections(reply)
+
 	if !p.IsRoot() {
-		log.Lvl4("Sending Consensus to Parent")
+		p.logger().Lvl4("Sending consensus to parent")
 		resp := SaveReplyStructured{
 			Url: p.Url,
 
 			Errs: p.Errs,
 
-			EncryptedCBFSet: p.EncryptedCBFSet,
+			PackedCBFSet: p.EncryptedCBFSet.Pack(),
 
 			CompleteProofs: p.CompleteProofs,
+
+			Certificates: p.Certificates,
+
+			Redirections: p.Redirections,
+
+			Failures: p.Failures,
+
+			Evidence: p.Evidence,
+		}
+		contribution := &StructuredContribution{
+			RequestID:    p.RequestID,
+			PackedCBFSet: resp.PackedCBFSet,
+			Proof:        p.CompleteProofs[p.Public().String()],
 		}
+		if err := contribution.sign(p.Private()); err != nil {
+			return err
+		}
+		resp.ContributionSig = contribution.Signature
 		return p.SendToParent(&resp)
 	}
 
-	log.Lvl4("Consensus reach root, now send complete proofs to all conodes")
-	errs := p.Broadcast(&CompleteProofsAnnounce{p.CompleteProofs})
+	// the consensus needs the filters of at least Threshold conodes
+	if fetched := p.fetchedPages(); fetched < p.Threshold {
+		p.logger().Lvl1("Not enough conodes fetched the page", "fetched", fetched, "threshold", p.Threshold)
+		p.Finished <- false
+		return errors.New("not enough conodes fetched the page")
+	}
+
+	p.CertificateHash = lib.MostCommonCertificate(CertificateHashes(p.Certificates), p.Threshold)
+
+	p.logger().Lvl4("Consensus reached root, now send complete proofs to all conodes")
+	// the conodes that failed don't need the proofs, so the errors are
+	// only logged
+	errs := p.Broadcast(&CompleteProofsAnnounce{p.CompleteProofs, p.Version})
 	if len(errs) > 0 {
-		log.Lvl1("Error when broadcasting complete proofs")
-		return lib.ConcatenateErrors(errs)
+		p.logger().Lvl1("Error when broadcasting complete proofs", "errors", lib.ConcatenateErrors(errs))
 	}
 
 	// root is done
@@ -190,7 +469,15 @@ func (p *ConsensusStructuredState) HandleReply(reply []StructSaveReplyStructured
 // HandleCompleteProofs is responsible for storing the complete proofs received
 // from root, which is responsible for aggregating and sending them
 func (p *ConsensusStructuredState) HandleCompleteProofs(cp StructCompleteProofsAnnounce) error {
-	defer p.Done()
+	defer p.done()
+
+	// the proofs sent for another version than the one of the consensus
+	// are ignored
+	if version, err := NegotiateVersion(cp.Version); err != nil || version != p.Version {
+		p.logger().Lvl1("Ignoring the complete proofs of another protocol version", "version", cp.Version)
+		p.Finished <- true
+		return nil
+	}
 
 	// get complete proofs from root
 	p.CompleteProofsToSend = cp.CompleteProofs
@@ -205,38 +492,126 @@ func (p *ConsensusStructuredState) HandleCompleteProofs(cp StructCompleteProofsA
 // not nil, then the map is. Else, it is the other way around.  If both
 // returned value are nil, then an error occured.
 func (p *ConsensusStructuredState) GetLocalHTMLData() (*html.Node, error) {
+	template := p.ClientRequest.template()
+	if err := ValidateTemplate(template, p.Render); err != nil {
+		return nil, err
+	}
+	renderer, err := pageRenderer(p.Render, p.Renderer)
+	if err != nil {
+		return nil, err
+	}
+	extractor, err := lib.GetLeafExtractor(p.Extractor)
+	if err != nil {
+		return nil, err
+	}
+	strip, err := lib.ParseSelectors(p.Strip)
+	if err != nil {
+		return nil, err
+	}
+	fetch := HeaderFetcher(fetcher(p.Fetch), sender(p.Send), p.Headers)
+	fetch = templateFetcher(fetch, HeaderSender(sender(p.Send), p.Headers), template)
+	page, err := fetchHTMLPage(fetch, p.Url, p.CheckURL, p.MaxSize, renderer)
+	if page != nil {
+		p.Url = page.Url
+		p.ContentType = page.ContentType
+		p.Charset = page.Charset
+		p.CertificateChain = page.CertificateChain
+	}
+	if err != nil {
+		p.logger().Lvl1("Impossible to get the HTML page", "url", p.Url, "error", err)
+		return nil, err
+	}
+	p.Redirects = page.Redirects
+	p.Blobs = page.Blobs
+	// the consensus only runs on the content selected by the extractor,
+	// once the boilerplate is removed
+	if removed := lib.StripElements(page.Tree, strip); removed > 0 {
+		p.logger().Lvl3("Boilerplate removed from the page", "elements", removed)
+	}
+	extractor.Prune(page.Tree)
+	return page.Tree, nil
+}
+
+// htmlPage is an HTML page fetched by a conode
+//    - Tree is the parsed page
+//    - Url is the address of the page after the redirections
+//    - ContentType is the MIME type of the page, with an UTF-8 charset
+//    - Charset is the original charset of the page, see charset.go
+//    - Redirects are the URLs fetched to get the page, see redirect.go
+//    - CertificateChain is the TLS certificate chain of the server
+//    - Blobs are the inline blobs extracted from the tree, see inline.go
+type htmlPage struct {
+	Tree             *html.Node
+	Url              string
+	ContentType      string
+	Charset          string
+	Redirects        []string
+	CertificateChain [][]byte
+	Blobs            []InlineBlob
+}
+
+// fetchHTMLPage fetches with fetch and parses the HTML page at url. The url
+// and its redirections are checked with check, and the page can't be larger than
+// maxSize bytes if maxSize is positive. The page is converted to UTF-8 before
+// being parsed. If renderer is not nil, the tree is built from the page
+// rendered by renderer, see render.go. The large inline blobs of the tree are
+// extracted, see inline.go. If the page was fetched but is not a valid HTML
+// page, the page is returned without Tree along with the error.
+func fetchHTMLPage(fetch Fetcher, url string, check URLChecker, maxSize int64, renderer Renderer) (*htmlPage, error) {
 	// get data
-	resp, realUrl, err := getRemoteData(p.Url)
+	resp, realUrl, err := getRemoteData(fetch, url, check)
 	if err != nil {
-		log.Lvl1("Error! Impossible to retrieve remote data.")
 		return nil, err
 	}
-	p.Url = realUrl
 	defer resp.Body.Close()
-	// apply procedure according to data type
-	contentTypes := resp.Header.Get(http.CanonicalHeaderKey("Content-Type"))
-	p.ContentType = contentTypes
+	page := &htmlPage{
+		Url: realUrl,
+		// apply procedure according to data type
+		ContentType:      resp.Header.Get(http.CanonicalHeaderKey("Content-Type")),
+		Redirects:        redirectChain(resp),
+		CertificateChain: lib.CertificateChain(resp.TLS),
+	}
 
 	// handle only correct HTML data
-	if b, e := regexp.MatchString("text/html", contentTypes); b && e == nil && resp.StatusCode == 200 {
+	if b, e := regexp.MatchString("text/html", page.ContentType); b && e == nil && resp.StatusCode == 200 {
 		// procedure for html files (tree-consensus)
-		htmlTree, htmlErr := html.Parse(resp.Body)
-		if htmlErr != nil {
-			log.Lvl1("Error: Impossible to parse html code!")
-			return nil, htmlErr
+		body, err := readBody(resp, page.Url, maxSize)
+		if err != nil {
+			return page, err
 		}
-		return htmlTree, nil
+		body, page.Charset, err = toUTF8(body, page.ContentType)
+		if err != nil {
+			return page, err
+		}
+		page.ContentType = utf8ContentType(page.ContentType)
+		if renderer != nil {
+			body, err = renderer.Render(page.Url)
+			if err != nil {
+				return page, err
+			}
+			if err := checkSize(body, page.Url, maxSize); err != nil {
+				return page, err
+			}
+		}
+		page.Tree, err = html.Parse(bytes.NewReader(body))
+		if err != nil {
+			return page, err
+		}
+		setUTF8Meta(page.Tree)
+		page.Blobs = extractInline(page.Tree)
+		return page, nil
 	}
 
-	return nil, errors.New("No HTML data")
+	return page, errors.New("No HTML data")
 }
 
 // getRemoteData take a url and return: - the http response corresponding to
 // the url - the un-alias url corresponding to the response (id est the path to
 // the file on the remote server) - the url structure associated (see net/url
-// Url struct) - an error status
-func getRemoteData(url string) (*http.Response, string, error) {
-	getResp, getErr := http.Get(url)
+// Url struct) - an error status. The url and its redirections are checked
+// with check before being fetched with fetch
+func getRemoteData(fetch Fetcher, url string, check URLChecker) (*http.Response, string, error) {
+	getResp, getErr := fetch(url, check)
 	if getErr != nil {
 		return nil, "", getErr
 	}
@@ -253,7 +628,7 @@ func getRemoteData(url string) (*http.Response, string, error) {
 }
 
 // AggregateErrors put all the errors contained in the children reply inside
-// the SaveLocalState p field p.Errs. It allows the current protocol to
+// the ConsensusStructuredState p field p.Errs. It allows the current protocol to
 // transmit the errors from its children to its parent.
 func (p *ConsensusStructuredState) AggregateErrors(reply []StructSaveReplyStructured) {
 	for _, r := range reply {
@@ -261,12 +636,92 @@ func (p *ConsensusStructuredState) AggregateErrors(reply []StructSaveReplyStruct
 	}
 }
 
+// AggregateFailures adds the nodes of the subtrees of the children that
+// failed to the failed nodes of p. The failures not signed for the request by
+// a conode of the roster are dropped and their errors added to p.Errs
+func (p *ConsensusStructuredState) AggregateFailures(reply []StructSaveReplyStructured) {
+	failures := p.Failures
+	for _, r := range reply {
+		failures = append(failures, r.Failures...)
+	}
+	var errs []error
+	p.Failures, errs = VerifiedFailures(p.RequestID, failures, p.Roster().Publics())
+	for _, err := range errs {
+		p.Errs = append(p.Errs, p.nodeError(err))
+	}
+	p.Failed = nil
+	for _, f := range p.Failures {
+		p.Failed = append(p.Failed, f.Public.String())
+	}
+}
+
+// fetchedPages returns the number of nodes that contributed the filter of the
+// page they fetched to the aggregation
+func (p *ConsensusStructuredState) fetchedPages() int {
+	fetched := len(p.CompleteProofs)
+	for _, f := range p.Failed {
+		if _, ok := p.CompleteProofs[f]; ok {
+			fetched--
+		}
+	}
+	return fetched
+}
+
+// AggregateCertificates adds the signed observation of the leaf certificate
+// by the node, if any, to the observations of the children. The observations
+// not signed for the request by a conode of the roster, or repeated, are
+// dropped and their errors added to p.Errs
+func (p *ConsensusStructuredState) AggregateCertificates(reply []StructSaveReplyStructured) {
+	var observations []CertificateObservation
+	if len(p.CertificateChain) > 0 {
+		c, err := NewCertificateObservation(p.RequestID, p.CertificateChain, p.Private())
+		if err != nil {
+			p.logger().Error("Cannot sign the observed certificate", "error", err)
+		} else {
+			observations = append(observations, *c)
+		}
+	}
+	for _, r := range reply {
+		observations = append(observations, r.Certificates...)
+	}
+	var errs []error
+	p.Certificates, errs = VerifiedCertificates(p.RequestID, observations, p.Roster().Publics())
+	for _, err := range errs {
+		p.Errs = append(p.Errs, p.nodeError(err))
+	}
+}
+
+// AggregateRedirections adds the signed redirect chain followed by the node,
+// if it fetched the page, to the redirect chains followed by the children.
+// The redirect chains not signed for the request by a conode of the roster
+// are dropped and their errors added to p.Errs
+func (p *ConsensusStructuredState) AggregateRedirections(reply []StructSaveReplyStructured) {
+	var redirections []Redirection
+	if len(p.Redirects) > 0 {
+		r, err := NewRedirection(p.RequestID, p.Redirects, p.Private())
+		if err != nil {
+			p.logger().Error("Cannot sign the redirect chain", "error", err)
+		} else {
+			redirections = append(redirections, *r)
+		}
+	}
+	for _, r := range reply {
+		redirections = append(redirections, r.Redirections...)
+	}
+	var errs []error
+	p.Redirections, errs = VerifiedRedirections(p.RequestID, redirections, p.Roster().Publics())
+	for _, err := range errs {
+		p.Errs = append(p.Errs, p.nodeError(err))
+	}
+}
+
 // AggregateCBF compute the local CBF of the node, add the random CBF if the
 // node is not root and remove the newZero CBF is the node is root. Moreover,
 // the parant nodes aggregate the results of the children if the signature for
 // the CBF set is valid. If the signature is not valid, the child's
 // contribution is not taken into account and the verification error is added
-// to p.Errs, but the function does not return error in this case.
+// to p.Errs, but the function does not return error in this case. The
+// aggregation works for trees of any height, see verifyChildContribution.
 func (p *ConsensusStructuredState) AggregateCBF(locTree *html.Node, reply []StructSaveReplyStructured) error {
 	// get public key of this node as string
 	pubKeyString := p.Public().String()
@@ -274,9 +729,22 @@ func (p *ConsensusStructuredState) AggregateCBF(locTree *html.Node, reply []Stru
 	// get parameters CBF
 	param := p.ParametersCBF
 
-	// fill filter with local data
-	p.CountingBloomFilter = lib.NewFilledBloomFilter(param, locTree)
-	log.Lvl4("Filled CBF for node", p.ServerIdentity().Address, "is", p.CountingBloomFilter)
+	// fill filter with local data, the filter is empty if the node could
+	// not fetch the page
+	var err error
+	if locTree != nil {
+		extractor, err := lib.GetLeafExtractor(p.Extractor)
+		if err != nil {
+			return err
+		}
+		p.CountingBloomFilter, err = lib.NewFilledBloomFilterLeaves(param, lib.ListLeaves(locTree, extractor))
+		if err != nil {
+			return err
+		}
+	} else if p.CountingBloomFilter, err = lib.NewBloomFilter(param); err != nil {
+		return err
+	}
+	p.logger().Lvl4("Filled CBF", "set", p.CountingBloomFilter.Set)
 
 	// initialize local proof with useful fields
 	p.CompleteProofs = make(lib.CompleteProofs)
@@ -289,46 +757,70 @@ func (p *ConsensusStructuredState) AggregateCBF(locTree *html.Node, reply []Stru
 
 	// encrypt set of the filter using the collective DKG key and prove
 	// that the set contains only zeros and ones
-	localBloomEncrypted, proof := lib.EncryptIntVector(p.SharedKey, p.CountingBloomFilter.Set)
+	localBloomEncrypted, proof, err := lib.EncryptIntVectorPoolContext(p.filterContext(), p.ZeroPool, p.SharedKey, p.Faults.lieOnFilter(p.CountingBloomFilter.Set))
+	if err != nil {
+		return err
+	}
 	p.CompleteProofs[pubKeyString].CipherVectorProof = proof
 	localBloomEncryptedBytes, _ := localBloomEncrypted.ToBytes()
 	p.CompleteProofs[pubKeyString].EncryptedBloomFilter = localBloomEncryptedBytes
 
-	// aggregate children contributions after checking the signature
+	// aggregate children contributions after checking the signature. The
+	// contribution of a child is the aggregation of its subtree, so that
+	// the aggregation proofs are chained along the tree, see
+	// lib.CompleteProofs
 	childrenContributions := make(map[string][]byte)
 	childrenContributions[pubKeyString] = localBloomEncryptedBytes
 	p.EncryptedCBFSet = localBloomEncrypted
-	if !p.IsLeaf() {
-		for _, r := range reply {
-			// convert child contribution to bytes
-			bytesEncryptedBloomFilter, _ := r.EncryptedCBFSet.ToBytes()
-			// aggregate children proofs with local proof
-			for conode, proof := range r.CompleteProofs {
-				// set the child encrypted CBF for the
-				// ciphervector proof as the received encrypted
-				// bloom filter, since we use a tree of height
-				// one. Note that this should be modified if we want to use a tree of height > 1
-				proof.EncryptedBloomFilter = bytesEncryptedBloomFilter
-
-				// store the child proof
-				p.CompleteProofs[conode] = proof
+	for _, r := range reply {
+		if len(r.PackedCBFSet) == 0 && len(r.Failures) > 0 {
+			p.logger().Lvl2("Child refused the request", "child", r.ServerIdentity.Address)
+			continue
+		}
+		set, err := p.verifyChildContribution(r)
+		if err != nil {
+			p.logger().Lvl1("Invalid signature or content proof", "child", r.ServerIdentity.Address, "error", err)
+			p.Errs = append(p.Errs, p.nodeError(err))
+			// the evidence embeds the signed contribution of the
+			// child, see VerifyEvidence
+			accused := r.TreeNode.ServerIdentity.Public
+			contribution := &StructuredContribution{
+				RequestID:    p.RequestID,
+				PackedCBFSet: r.PackedCBFSet,
+				Proof:        r.CompleteProofs[accused.String()],
+				Signature:    r.ContributionSig,
 			}
-
-			// aggregate encrypted CBF set after content proof and
-			// signature verification
-			bytesEncryptedSet, _ := r.EncryptedCBFSet.ToBytes()
-			hashed := p.Suite().(kyber.HashFactory).Hash().Sum(bytesEncryptedSet)
-			conodeKey := r.TreeNode.ServerIdentity.Public.String()
-			vErr := schnorr.Verify(p.Suite(), r.TreeNode.ServerIdentity.Public, hashed, r.CompleteProofs[conodeKey].EncryptedCBFSetSignature)
-			if vErr == nil && p.CompleteProofs[conodeKey].CipherVectorProof.VerifyCipherVectorProof(r.EncryptedCBFSet) {
-				log.Lvl4("Valid encrypted CBF set signature for node", r.ServerIdentity.Address)
-				childrenContributions[r.TreeNode.ServerIdentity.Public.String()], _ = r.EncryptedCBFSet.ToBytes()
-				p.EncryptedCBFSet.Add(*p.EncryptedCBFSet, *r.EncryptedCBFSet)
-			} else {
-				log.Lvl1("Invalid signature or content proof for node", r.ServerIdentity.Address)
-				p.Errs = append(p.Errs, vErr)
+			if verr := contribution.verifySignature(accused); verr != nil {
+				p.logger().Lvl1("Unsigned contribution, no evidence", "child", r.ServerIdentity.Address, "error", verr)
+				continue
+			}
+			e, err := newContributionEvidence(p.Private(), p.Public(), p.RequestID, accused, NameConsensusStructured, err, contribution)
+			if err != nil {
+				p.logger().Lvl1("Impossible to sign the evidence", "error", err)
+				continue
 			}
+			p.Evidence = append(p.Evidence, e)
+			continue
 		}
+		p.logger().Lvl4("Valid encrypted CBF set signature", "child", r.ServerIdentity.Address)
+
+		// the evidence reported by an invalid child is not trusted, and
+		// the evidence of a valid child must be signed by its reporter
+		// and prove the misbehaviour of the accused conode
+		for _, e := range r.Evidence {
+			if err := VerifyEvidence(e, p.Roster().Publics()); err != nil {
+				p.logger().Lvl1("Invalid evidence", "child", r.ServerIdentity.Address, "error", err)
+				continue
+			}
+			p.Evidence = append(p.Evidence, e)
+		}
+
+		// keep the proofs of the whole subtree of the child
+		for conode, proof := range r.CompleteProofs {
+			p.CompleteProofs[conode] = proof
+		}
+		childrenContributions[r.TreeNode.ServerIdentity.Public.String()], _ = set.ToBytes()
+		p.EncryptedCBFSet.Add(*p.EncryptedCBFSet, *set)
 	}
 
 	// store sum of all contributions plus the local contribution of the conode
@@ -353,6 +845,71 @@ func (p *ConsensusStructuredState) AggregateCBF(locTree *html.Node, reply []Stru
 	return nil
 }
 
+// verifyChildContribution returns the aggregated encrypted CBF set of a
+// child, unpacked from its reply. An error is returned if the set is not
+// signed by the child, if the local filter of the child contains something
+// else than zeros and ones or if the aggregated set is not the sum of the
+// local filter of the child and of the sets of its children
+func (p *ConsensusStructuredState) verifyChildContribution(r StructSaveReplyStructured) (*lib.CipherVector, error) {
+	return verifyContribution(p.filterContext(), r.TreeNode.ServerIdentity.Public, r.PackedCBFSet, r.CompleteProofs[r.TreeNode.ServerIdentity.Public.String()])
+}
+
+// verifyContribution returns the encrypted CBF set packed sent by the conode
+// of public key conode with its proof, see verifyChildContribution
+func verifyContribution(ctx context.Context, conode kyber.Point, packed []byte, proof *lib.CompleteProof) (*lib.CipherVector, error) {
+	if len(packed) == 0 {
+		return nil, errors.New("child sent no encrypted CBF set")
+	}
+	set := new(lib.CipherVector)
+	if err := set.Unpack(packed); err != nil {
+		return nil, fmt.Errorf("invalid encrypted CBF set: %v", err)
+	}
+	conodeKey := conode.String()
+	if proof == nil || proof.AggregationProof == nil || proof.CipherVectorProof == nil {
+		return nil, errors.New("child sent no proof")
+	}
+
+	bytesEncryptedSet, length := set.ToBytes()
+	hashed := decenarch.Suite.Hash().Sum(bytesEncryptedSet)
+	if err := schnorr.Verify(decenarch.Suite, conode, hashed, proof.EncryptedCBFSetSignature); err != nil {
+		return nil, err
+	}
+
+	var local lib.CipherVector
+	if err := local.FromBytes(proof.EncryptedBloomFilter, length); err != nil {
+		return nil, fmt.Errorf("invalid local filter: %v", err)
+	}
+	if ok, err := proof.CipherVectorProof.VerifyCipherVectorProofContext(ctx, &local); !ok {
+		return nil, fmt.Errorf("invalid content proof of the local filter: %v", err)
+	}
+	if !bytes.Equal(proof.AggregationProof.Contributions[conodeKey], proof.EncryptedBloomFilter) {
+		return nil, errors.New("local filter is not part of the aggregation")
+	}
+	if !proof.AggregationProof.VerifyAggregationProofWithAggregation(set) {
+		return nil, errors.New("invalid aggregation proof")
+	}
+	return set, nil
+}
+
+// filterContext returns the context of the computations of the node on the
+// filters, limited to Workers goroutines
+func (p *ConsensusStructuredState) filterContext() context.Context {
+	return lib.WithWorkers(p.ctx, p.Workers)
+}
+
+// done ends the protocol for the node, once, whether it finished or the root
+// gave up waiting for it, see CBFEngine.Run
+func (p *ConsensusStructuredState) done() {
+	p.doneOnce.Do(func() { p.Done() })
+}
+
+// Shutdown interrupts the computations of the node on the filters when the
+// protocol is done
+func (p *ConsensusStructuredState) Shutdown() error {
+	p.cancel()
+	return nil
+}
+
 // signEncryptedCBFSet sign the ciphertext of a CBF set with the private key of
 // the node represented by p. An error is returned if something go wrong while
 // signing. Here we have to use the encrypt-then-sign paradigm, because the
@@ -365,19 +922,23 @@ func (p *ConsensusStructuredState) signEncryptedCBFSet() ([]byte, error) {
 	}
 
 	bytesEncryptedSet, _ := p.EncryptedCBFSet.ToBytes()
-	hashed := p.Suite().(kyber.HashFactory).Hash().Sum(bytesEncryptedSet)
-	sig, err := schnorr.Sign(p.Suite(), p.Private(), hashed)
+	hashed := decenarch.Suite.Hash().Sum(bytesEncryptedSet)
+	sig, err := schnorr.Sign(decenarch.Suite, p.Private(), hashed)
 	if err != nil {
-		log.Lvl1("Error! Impossible to sign encrypted CBF set", err)
-		p.Errs = append(p.Errs, err)
+		p.logger().Lvl1("Impossible to sign encrypted CBF set", "error", err)
+		p.Errs = append(p.Errs, p.nodeError(err))
 		return nil, err
 	}
-	log.Lvl4("Encryted CBF set", p.EncryptedCBFSet, "for node", p.ServerIdentity().Address, "signed with signature", sig)
+	p.logger().Lvl4("Encrypted CBF set signed", "signature", sig)
 	return sig, nil
 }
 
-// castParametersCBF from uint64 to uint, since uint64 is needed to send the
-// paramters across the conodes
-func castParametersCBF(param []uint64) []uint {
-	return []uint{uint(param[0]), uint(param[1])}
+// nodeError returns the error err of the node, to be sent to its parent
+func (p *ConsensusStructuredState) nodeError(err error) decenarch.NodeError {
+	return decenarch.NewNodeError(p.Public(), NameConsensusStructured+"/"+p.Phase.String(), err)
+}
+
+// logger returns the structured logger of this node for the current save
+func (p *ConsensusStructuredState) logger() *lib.Logger {
+	return lib.NewLogger(p.RequestID, p.ServerIdentity().Address.String()).With("protocol", NameConsensusStructured)
 }
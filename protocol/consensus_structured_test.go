@@ -2,13 +2,14 @@ package protocol
 
 import (
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	decenarch "github.com/dedis/student_18_decenar"
 	"github.com/dedis/student_18_decenar/lib"
 	"github.com/stretchr/testify/require"
-	"gopkg.in/dedis/cothority.v2"
 	"gopkg.in/dedis/kyber.v2"
 	"gopkg.in/dedis/kyber.v2/util/key"
 	"gopkg.in/dedis/onet.v2"
@@ -16,9 +17,37 @@ import (
 	"gopkg.in/dedis/onet.v2/network"
 )
 
-// variables used to run the test
-var website = "http://nibelung.ch/decenarch/100p.html"
-var bf []int64 = []int64{1, 0, 0, 1, 1, 1, 1, 0, 1, 0, 0, 0, 0, 0, 0, 1, 1, 0, 1, 1, 0, 1, 1, 1, 1, 0, 1, 1, 1, 1, 0, 0, 1, 1, 0, 0, 0, 0, 1, 0, 1, 1, 0, 1, 1, 1, 1, 0, 0, 1, 0, 1, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 1, 1, 0, 0, 0, 0, 1, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 1, 1, 0, 0, 1, 0, 1, 1, 1, 1, 1, 0, 1, 1, 0, 1, 1, 1, 1, 1, 1, 1, 0}
+// testPage is the page served to the conodes by the tests
+const testPage = `<html><head><title>decenarch</title></head><body>
+<h1>Decentralized archive</h1><p>The conodes agree on the content of the page.</p>
+<ul><li>first</li><li>second</li><li>third</li></ul><p>The end.</p>
+</body></html>`
+
+// testWebsite is the URL of testPage, served by newTestPageServer
+const testWebsite = "http://example.com/page.html"
+
+// newTestPageServer returns a server serving testPage at /page.html and the
+// fetcher reaching it for any host
+func newTestPageServer() (*httptest.Server, Fetcher) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(testPage))
+	})
+	server := httptest.NewServer(mux)
+	return server, LocalFetcher(server.Listener.Addr().String())
+}
+
+// expectedFilter returns the filter of a single conode for the page at url
+func expectedFilter(t *testing.T, fetch Fetcher, url string) []int64 {
+	page, err := fetchHTMLPage(fetch, url, nil, 0, nil)
+	require.Nil(t, err)
+	param, err := lib.ParametersFromSent(lib.GetOptimalCBFParametersToSend(page.Tree, 0))
+	require.Nil(t, err)
+	c, err := lib.NewFilledBloomFilter(param, page.Tree)
+	require.Nil(t, err)
+	return c.Set
+}
 
 var consensusStructuredServiceID onet.ServiceID
 
@@ -26,6 +55,13 @@ type consensusStructuredService struct {
 	*onet.ServiceProcessor
 
 	SharedKey kyber.Point
+	Fetch     Fetcher
+	Refuse    bool
+	Faults    *Faults
+
+	// Silent makes the conode never reply to its parent, until the
+	// channel is closed
+	Silent chan struct{}
 }
 
 func init() {
@@ -45,6 +81,19 @@ func (s *consensusStructuredService) NewProtocol(node *onet.TreeNodeInstance, co
 		instance, _ := NewConsensusStructuredProtocol(node)
 		protocol := instance.(*ConsensusStructuredState)
 		protocol.SharedKey = s.SharedKey
+		protocol.Fetch = s.Fetch
+		protocol.Faults = s.Faults
+		if s.Silent != nil {
+			protocol.Fetch = func(string, URLChecker) (*http.Response, error) {
+				<-s.Silent
+				return nil, errors.New("silent")
+			}
+		}
+		if s.Refuse {
+			protocol.VerifyRequest = func(*ClientRequest) error {
+				return errors.New("refused")
+			}
+		}
 		return protocol, nil
 	default:
 		return nil, errors.New("Unknown protocol")
@@ -54,31 +103,44 @@ func TestConsensusStructured(t *testing.T) {
 	nodes := []int{3, 5, 7, 15}
 	for _, nbrNodes := range nodes {
 		log.Lvlf1("Starting consensus for structured data with %d nodes", nbrNodes)
-		consensusStructured(t, nbrNodes)
+		consensusStructured(t, nbrNodes, nbrNodes)
 	}
 }
 
-func consensusStructured(t *testing.T, nbrNodes int) {
+func TestConsensusStructuredDeepTree(t *testing.T) {
+	for _, nbrNodes := range []int{7, 15} {
+		log.Lvlf1("Starting consensus for structured data with %d nodes in a binary tree", nbrNodes)
+		consensusStructured(t, nbrNodes, 2)
+	}
+}
+
+func consensusStructured(t *testing.T, nbrNodes, branchingFactor int) {
 	log.Lvl1("Running", nbrNodes, "nodes")
 	local := onet.NewLocalTest(decenarch.Suite)
 	defer local.CloseAll()
+	server, fetch := newTestPageServer()
+	defer server.Close()
+	website := testWebsite
+	bf := expectedFilter(t, fetch, website)
 
-	nodes, _, tree := local.GenBigTree(nbrNodes, nbrNodes, nbrNodes, true)
+	nodes, _, tree := local.GenBigTree(nbrNodes, nbrNodes, branchingFactor, true)
 	services := local.GetServices(nodes, consensusStructuredServiceID)
 
 	// we don't use DKG to test, but a simple random key
 	// note that DKG is tested somewhere else
-	pair := key.NewKeyPair(cothority.Suite)
+	pair := key.NewKeyPair(decenarch.Suite)
 
-	// assign right key to every service
+	// assign right key and fetcher to every service
 	for i := range services {
 		services[i].(*consensusStructuredService).SharedKey = pair.Public
+		services[i].(*consensusStructuredService).Fetch = fetch
 	}
 
 	instance, _ := services[0].(*consensusStructuredService).CreateProtocol(NameConsensusStructured, tree)
 	protocol := instance.(*ConsensusStructuredState)
 	protocol.SharedKey = pair.Public
-	protocol.Url = "http://nibelung.ch/decenarch/100p.html"
+	protocol.Fetch = fetch
+	protocol.Url = website
 	err := protocol.Start()
 	require.Nil(t, err)
 
@@ -91,6 +153,9 @@ func consensusStructured(t *testing.T, nbrNodes int) {
 		// decrypt the encrypted CBF set
 		consensus := lib.DecryptIntVector(pair.Private, protocol.EncryptedCBFSet)
 		require.Equal(t, multiplyByNbrNodes(bf, nbrNodes), consensus)
+		// the proofs of all the nodes are chained up to the root
+		require.Len(t, protocol.CompleteProofs, nbrNodes)
+		require.True(t, protocol.CompleteProofs.VerifyCompleteProofs())
 	case <-time.After(timeout):
 		t.Fatal("Didn't finish in time")
 	}
@@ -104,3 +169,211 @@ func multiplyByNbrNodes(bf []int64, nbrNodes int) []int64 {
 
 	return tmp
 }
+
+func TestConsensusStructuredFailure(t *testing.T) {
+	nbrNodes := 5
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	server, fetch := newTestPageServer()
+	defer server.Close()
+	website := testWebsite
+	bf := expectedFilter(t, fetch, website)
+
+	nodes, _, tree := local.GenBigTree(nbrNodes, nbrNodes, nbrNodes, true)
+	services := local.GetServices(nodes, consensusStructuredServiceID)
+	pair := key.NewKeyPair(decenarch.Suite)
+	for i := range services {
+		services[i].(*consensusStructuredService).SharedKey = pair.Public
+		services[i].(*consensusStructuredService).Fetch = fetch
+	}
+
+	// the last conode refuses the request, the others are enough
+	services[nbrNodes-1].(*consensusStructuredService).Refuse = true
+	instance, _ := services[0].(*consensusStructuredService).CreateProtocol(NameConsensusStructured, tree)
+	protocol := instance.(*ConsensusStructuredState)
+	protocol.SharedKey = pair.Public
+	protocol.Fetch = fetch
+	protocol.Url = website
+	protocol.Threshold = nbrNodes - 1
+	require.Nil(t, protocol.Start())
+
+	timeout := network.WaitRetry * time.Duration(network.MaxRetryConnect*nbrNodes*2) * time.Millisecond
+	select {
+	case ok := <-protocol.Finished:
+		require.True(t, ok)
+		consensus := lib.DecryptIntVector(pair.Private, protocol.EncryptedCBFSet)
+		require.Equal(t, multiplyByNbrNodes(bf, nbrNodes-1), consensus)
+		require.Len(t, protocol.CompleteProofs, nbrNodes-1)
+		require.Len(t, protocol.Failed, 1)
+		require.Nil(t, protocol.Failures[0].Verify(protocol.RequestID, tree.Roster.Publics()))
+		require.True(t, protocol.CompleteProofs.VerifyCompleteProofs())
+	case <-time.After(timeout):
+		t.Fatal("Didn't finish in time")
+	}
+
+	// without enough conodes the consensus fails
+	services[nbrNodes-2].(*consensusStructuredService).Refuse = true
+	instance, _ = services[0].(*consensusStructuredService).CreateProtocol(NameConsensusStructured, tree)
+	protocol = instance.(*ConsensusStructuredState)
+	protocol.SharedKey = pair.Public
+	protocol.Fetch = fetch
+	protocol.Url = website
+	protocol.Threshold = nbrNodes - 1
+	require.Nil(t, protocol.Start())
+	select {
+	case ok := <-protocol.Finished:
+		require.False(t, ok)
+	case <-time.After(timeout):
+		t.Fatal("Didn't finish in time")
+	}
+}
+
+func TestConsensusStructuredTimeout(t *testing.T) {
+	nbrNodes := 5
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	server, fetch := newTestPageServer()
+	defer server.Close()
+	bf := expectedFilter(t, fetch, testWebsite)
+
+	defer func(timeout time.Duration) { replyTimeout = timeout }(replyTimeout)
+	replyTimeout = 2 * time.Second
+
+	nodes, _, tree := local.GenBigTree(nbrNodes, nbrNodes, nbrNodes, true)
+	services := local.GetServices(nodes, consensusStructuredServiceID)
+	pair := key.NewKeyPair(decenarch.Suite)
+	for i := range services {
+		services[i].(*consensusStructuredService).SharedKey = pair.Public
+		services[i].(*consensusStructuredService).Fetch = fetch
+	}
+
+	// the last conode never replies, the root gives up on it without
+	// reporting it as failed, since it signed no failure
+	silent := make(chan struct{})
+	defer close(silent)
+	services[nbrNodes-1].(*consensusStructuredService).Silent = silent
+	instance, _ := services[0].(*consensusStructuredService).CreateProtocol(NameConsensusStructured, tree)
+	protocol := instance.(*ConsensusStructuredState)
+	protocol.SharedKey = pair.Public
+	protocol.Fetch = fetch
+	protocol.Url = testWebsite
+	protocol.Threshold = nbrNodes - 1
+	require.Nil(t, protocol.Start())
+
+	select {
+	case ok := <-protocol.Finished:
+		require.True(t, ok)
+		consensus := lib.DecryptIntVector(pair.Private, protocol.EncryptedCBFSet)
+		require.Equal(t, multiplyByNbrNodes(bf, nbrNodes-1), consensus)
+		require.Len(t, protocol.CompleteProofs, nbrNodes-1)
+		require.NotContains(t, protocol.CompleteProofs, nodes[nbrNodes-1].ServerIdentity.Public.String())
+		require.Empty(t, protocol.Failed)
+		require.True(t, protocol.CompleteProofs.VerifyCompleteProofs())
+	case <-time.After(10 * replyTimeout):
+		t.Fatal("Didn't finish in time")
+	}
+}
+
+func TestConsensusStructuredByzantine(t *testing.T) {
+	nbrNodes := 5
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	server, fetch := newTestPageServer()
+	defer server.Close()
+	bf := expectedFilter(t, fetch, testWebsite)
+
+	nodes, _, tree := local.GenBigTree(nbrNodes, nbrNodes, nbrNodes, true)
+	services := local.GetServices(nodes, consensusStructuredServiceID)
+	pair := key.NewKeyPair(decenarch.Suite)
+	for i := range services {
+		services[i].(*consensusStructuredService).SharedKey = pair.Public
+		services[i].(*consensusStructuredService).Fetch = fetch
+	}
+
+	// a conode lies on its filter without being detected, another one
+	// can't prove its filter and is rejected
+	services[3].(*consensusStructuredService).Faults = &Faults{WrongFilter: true}
+	services[4].(*consensusStructuredService).Faults = &Faults{InvalidProof: true}
+	instance, _ := services[0].(*consensusStructuredService).CreateProtocol(NameConsensusStructured, tree)
+	protocol := instance.(*ConsensusStructuredState)
+	protocol.SharedKey = pair.Public
+	protocol.Fetch = fetch
+	protocol.Url = testWebsite
+	protocol.Threshold = 3
+	require.Nil(t, protocol.Start())
+
+	timeout := network.WaitRetry * time.Duration(network.MaxRetryConnect*nbrNodes*2) * time.Millisecond
+	select {
+	case ok := <-protocol.Finished:
+		require.True(t, ok)
+		require.Len(t, protocol.Evidence, 1)
+		require.Equal(t, nodes[4].ServerIdentity.Public.String(), protocol.Evidence[0].Accused)
+		require.Equal(t, nodes[0].ServerIdentity.Public.String(), protocol.Evidence[0].Reporter)
+		require.Nil(t, VerifyEvidence(protocol.Evidence[0], tree.Roster.Publics()))
+		require.Len(t, protocol.CompleteProofs, nbrNodes-1)
+		require.True(t, protocol.CompleteProofs.VerifyCompleteProofs())
+
+		// the leaves added by the lie are below the threshold
+		expected := multiplyByNbrNodes(bf, 3)
+		for i := range expected {
+			expected[i] += 1 - bf[i]
+		}
+		consensus := lib.DecryptIntVector(pair.Private, protocol.EncryptedCBFSet)
+		require.Equal(t, expected, consensus)
+		for i := range consensus {
+			require.Equal(t, bf[i] > 0, consensus[i] >= int64(protocol.Threshold))
+		}
+	case <-time.After(timeout):
+		t.Fatal("Didn't finish in time")
+	}
+}
+
+func TestConsensusStructuredVersion(t *testing.T) {
+	nbrNodes := 5
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	server, fetch := newTestPageServer()
+	defer server.Close()
+
+	nodes, _, tree := local.GenBigTree(nbrNodes, nbrNodes, nbrNodes, true)
+	services := local.GetServices(nodes, consensusStructuredServiceID)
+	pair := key.NewKeyPair(decenarch.Suite)
+	for i := range services {
+		services[i].(*consensusStructuredService).SharedKey = pair.Public
+		services[i].(*consensusStructuredService).Fetch = fetch
+	}
+
+	timeout := network.WaitRetry * time.Duration(network.MaxRetryConnect*nbrNodes*2) * time.Millisecond
+	run := func(version int32) *ConsensusStructuredState {
+		instance, _ := services[0].(*consensusStructuredService).CreateProtocol(NameConsensusStructured, tree)
+		protocol := instance.(*ConsensusStructuredState)
+		protocol.SharedKey = pair.Public
+		protocol.Fetch = fetch
+		protocol.Url = testWebsite
+		protocol.Threshold = nbrNodes - 1
+		protocol.Version = version
+		require.Nil(t, protocol.Start())
+		return protocol
+	}
+
+	// the conodes refuse a version newer than theirs, so that the root
+	// doesn't reach the threshold
+	protocol := run(Version + 1)
+	select {
+	case ok := <-protocol.Finished:
+		require.False(t, ok)
+		require.Len(t, protocol.Failed, nbrNodes-1)
+	case <-time.After(timeout):
+		t.Fatal("Didn't finish in time")
+	}
+
+	// the conodes downgrade to the version of a legacy root
+	protocol = run(0)
+	select {
+	case ok := <-protocol.Finished:
+		require.True(t, ok)
+		require.Empty(t, protocol.Failed)
+	case <-time.After(timeout):
+		t.Fatal("Didn't finish in time")
+	}
+}
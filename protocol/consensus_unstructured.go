@@ -1,11 +1,10 @@
 package protocol
 
 import (
-	"encoding/base64"
 	"errors"
-	"io/ioutil"
 	"net/http"
 	urlpkg "net/url"
+	"sort"
 
 	"gopkg.in/dedis/kyber.v2"
 	"gopkg.in/dedis/kyber.v2/sign/schnorr"
@@ -13,6 +12,9 @@ import (
 	"gopkg.in/dedis/onet.v2"
 	"gopkg.in/dedis/onet.v2/log"
 	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
 )
 
 func init() {
@@ -24,8 +26,9 @@ func init() {
 // ConsensusUnstructuredState holds the local state of a node when it runs the SaveProtocol
 type ConsensusUnstructuredState struct {
 	*onet.TreeNodeInstance
+	RequestID   string
 	Phase       SavePhase
-	Errs        []error
+	Errs        []decenarch.NodeError
 	Url         string
 	ContentType string
 	Threshold   uint32
@@ -36,6 +39,38 @@ type ConsensusUnstructuredState struct {
 
 	MsgToSign []byte
 
+	// RequestedUrl is the URL of the resource requested by the root, before
+	// the redirections, which the conodes sign with the hash of the resource
+	// they fetched, see decenarch.CommitmentMessage. Url if empty
+	RequestedUrl string
+	// CheckURL is used to refuse to fetch URLs, it can be nil
+	CheckURL URLChecker
+	// Fetch fetches the resource, the fetcher of the conodes if nil
+	Fetch Fetcher
+	// Send sends the requests with Headers, the sender of the conodes if
+	// nil
+	Send Sender
+	// Headers are the headers of the requests fetching the resource, see
+	// decenarch.MergeFetchHeaders
+	Headers map[string]string
+	// MaxSize is the maximal size in bytes of the resource, 0 means no
+	// limit. Plaintext data bigger than MaxSize sent by the children is
+	// ignored
+	MaxSize int64
+	// Version is the version of the protocol announced by the root, see
+	// version.go
+	Version int32
+	// Fetched is called with the request ID of the save and the hash of the
+	// resource fetched by the conode, see decenarch.ResourceHash, it can be nil
+	Fetched func(requestID, hash string)
+	// Agreed is called with the request ID of the save and the resource
+	// agreed on announced by the root, see AgreedResource, it can be nil
+	Agreed func(requestID string, resource AgreedResource)
+	// Transcript are the commitments of all the conodes on the hash of the
+	// resource they fetched, whatever the hash, set on the root at the end
+	// of the consensus
+	Transcript []decenarch.HashCommitment
+
 	Finished chan bool
 }
 
@@ -47,6 +82,7 @@ func NewConsensusUnstructuredProtocol(n *onet.TreeNodeInstance) (onet.ProtocolIn
 		Url:              "",
 		Phase:            NilPhase,
 		PlainData:        make(map[string][]byte),
+		Version:          Version,
 		Finished:         make(chan bool),
 	}
 	for _, handler := range []interface{}{t.HandleAnnounceUnstructured, t.HandleReplyUnstructured} {
@@ -58,20 +94,27 @@ func NewConsensusUnstructuredProtocol(n *onet.TreeNodeInstance) (onet.ProtocolIn
 }
 
 func (p *ConsensusUnstructuredState) Start() error {
-	log.Lvl3("Starting ConsensusUnstructuredState")
+	p.logger().Lvl3("Starting unstructured consensus", "url", p.Url)
 	p.Phase = Consensus
+	if p.RequestedUrl == "" {
+		p.RequestedUrl = p.Url
+	}
 	hash, err := p.GetLocalDataUnstructured()
 	if err != nil {
-		log.Error("Error in save protocol Start():", err)
+		p.logger().Error("Error in save protocol Start()", "error", err)
 		return err
 	}
 	p.MasterHash = hash
 	return p.HandleAnnounceUnstructured(StructSaveAnnounceUnstructured{
 		p.TreeNode(),
 		SaveAnnounceUnstructured{
-			Url:        p.Url,
-			Phase:      Consensus,
-			MasterHash: p.MasterHash,
+			RequestID:    p.RequestID,
+			Url:          p.Url,
+			Phase:        Consensus,
+			MasterHash:   p.MasterHash,
+			Version:      p.Version,
+			Headers:      p.Headers,
+			RequestedUrl: p.RequestedUrl,
 		},
 	})
 }
@@ -82,27 +125,46 @@ func (p *ConsensusUnstructuredState) Start() error {
 // begining and end but each time a different 'case'. Each one can be
 // considered as an independant function.
 func (p *ConsensusUnstructuredState) HandleAnnounceUnstructured(msg StructSaveAnnounceUnstructured) error {
-	log.Lvl4("Handling", p)
-	log.Lvl4("And the message", msg)
+	p.RequestID = msg.SaveAnnounceUnstructured.RequestID
 	p.Phase = msg.SaveAnnounceUnstructured.Phase
 	p.Url = msg.SaveAnnounceUnstructured.Url
+	p.RequestedUrl = msg.SaveAnnounceUnstructured.RequestedUrl
+	p.logger().Lvl4("Handling unstructured announce", "phase", p.Phase)
+
+	// a node that doesn't support the version of the root answers each
+	// phase with its error instead of contributing, until the end
+	version, err := NegotiateVersion(msg.SaveAnnounceUnstructured.Version)
+	if err != nil {
+		p.logger().Lvl1("Refusing the save", "error", err)
+		if p.IsRoot() || p.Phase == End {
+			p.Done()
+			return err
+		}
+		return p.SendToParent(&SaveReplyUnstructured{
+			Phase: p.Phase,
+			Url:   p.Url,
+			Errs:  []decenarch.NodeError{p.nodeError(err)},
+		})
+	}
+	p.Version = version
+
 	switch msg.SaveAnnounceUnstructured.Phase {
 	case NilPhase:
-		log.Lvl1("NilPhase passed by", p, "msg:", msg)
+		p.logger().Lvl1("NilPhase should not be announceable")
 		err := errors.New("NilPhase should not be announceable")
 		resp := StructSaveReplyUnstructured{
 			p.TreeNode(),
 			SaveReplyUnstructured{
 				Phase: msg.SaveAnnounceUnstructured.Phase,
 				Url:   msg.SaveAnnounceUnstructured.Url,
-				Errs:  []error{err},
+				Errs:  []decenarch.NodeError{p.nodeError(err)},
 			},
 		}
 		defer p.HandleReplyUnstructured([]StructSaveReplyUnstructured{resp})
 		return err
 	case Consensus:
-		log.Lvl4("Consensus Phase")
 		p.MasterHash = msg.SaveAnnounceUnstructured.MasterHash
+		p.Headers = msg.SaveAnnounceUnstructured.Headers
 		if !p.IsLeaf() {
 			return p.SendToChildren(&msg.SaveAnnounceUnstructured)
 		} else {
@@ -117,8 +179,12 @@ func (p *ConsensusUnstructuredState) HandleAnnounceUnstructured(msg StructSaveAn
 			return p.HandleReplyUnstructured([]StructSaveReplyUnstructured{resp})
 		}
 	case RequestMissingData:
-		log.Lvl4("RequestMissingData Phase with", p)
 		p.MasterHash = msg.SaveAnnounceUnstructured.MasterHash
+		if p.Agreed != nil {
+			for hash, sigs := range p.MasterHash {
+				p.Agreed(p.RequestID, NewAgreedResource(p.RequestedUrl, hash, sigs))
+			}
+		}
 		requestedHash := getRequestedMissingHashUnstructured(p)
 		if _, ok := p.PlainData[requestedHash]; !ok {
 			if !p.IsLeaf() {
@@ -139,17 +205,16 @@ func (p *ConsensusUnstructuredState) HandleAnnounceUnstructured(msg StructSaveAn
 		}
 		return p.HandleReplyUnstructured([]StructSaveReplyUnstructured{resp})
 	case End:
-		log.Lvl4("End Phase")
 		p.SendToChildren(&msg.SaveAnnounceUnstructured)
 	default:
-		log.Lvl1("Unknown phase passed by", p, "msg:", msg)
+		p.logger().Lvl1("Unknown phase announced")
 		err := errors.New("Unknown Phase")
 		resp := StructSaveReplyUnstructured{
 			p.TreeNode(),
 			SaveReplyUnstructured{
 				Phase: msg.SaveAnnounceUnstructured.Phase,
 				Url:   msg.SaveAnnounceUnstructured.Url,
-				Errs:  []error{err}},
+				Errs:  []decenarch.NodeError{p.nodeError(err)}},
 		}
 		defer p.HandleReplyUnstructured([]StructSaveReplyUnstructured{resp})
 		return err
@@ -163,39 +228,41 @@ func (p *ConsensusUnstructuredState) HandleAnnounceUnstructured(msg StructSaveAn
 // begining and end but each time a different 'case'. Each one can be
 // considered as an independant function.
 func (p *ConsensusUnstructuredState) HandleReplyUnstructured(reply []StructSaveReplyUnstructured) error {
-	log.Lvl4("Handling Save Reply", p)
-	log.Lvl4("And the replies", reply)
+	p.logger().Lvl4("Handling unstructured reply", "phase", p.Phase, "replies", len(reply))
 	switch p.Phase {
 	case NilPhase:
-		log.Lvl1("NilPhase passed by", p)
+		p.logger().Lvl1("NilPhase should not be replyable")
 		defer p.Done()
 		return errors.New("NilPhase should not be replyable")
 	case Consensus:
-		log.Lvl4("Consensus Reply Phase")
 		locHash, err := p.GetLocalDataUnstructured()
 		if err != nil {
-			log.Lvl1("Error! Impossible to get local data", err)
-			p.Errs = append(p.Errs, err)
+			p.logger().Lvl1("Impossible to get local data", "error", err)
+			p.Errs = append(p.Errs, p.nodeError(err))
 		}
 		p.AggregateUnstructDataUnstructured(locHash, reply)
 		if p.IsRoot() {
-			log.Lvl4("Consensus reach root. Passing to next phase")
+			p.logger().Lvl4("Consensus reached root, passing to next phase")
+			p.Transcript = transcript(p.RequestedUrl, p.RequestID, p.MasterHash)
 			msMap, msErr := getMostSignedHashUnstructured(p, p.MasterHash)
 			if msErr != nil {
-				p.Errs = append(p.Errs, msErr)
+				p.Errs = append(p.Errs, p.nodeError(msErr))
 			}
 			p.MasterHash = msMap
 
 			// pass to next phase, RequestMissingData
 			p.Phase = RequestMissingData
 			msg := SaveAnnounceUnstructured{
-				Phase:      p.Phase,
-				Url:        p.Url,
-				MasterHash: p.MasterHash,
+				RequestID:    p.RequestID,
+				Phase:        p.Phase,
+				Url:          p.Url,
+				MasterHash:   p.MasterHash,
+				Version:      p.Version,
+				RequestedUrl: p.RequestedUrl,
 			}
 			p.HandleAnnounceUnstructured(StructSaveAnnounceUnstructured{p.TreeNode(), msg})
 		} else {
-			log.Lvl4("Sending Consensus to Parent")
+			p.logger().Lvl4("Sending consensus to parent")
 			resp := SaveReplyUnstructured{
 				Phase: p.Phase,
 				Url:   p.Url,
@@ -207,15 +274,18 @@ func (p *ConsensusUnstructuredState) HandleReplyUnstructured(reply []StructSaveR
 			return p.SendToParent(&resp)
 		}
 	case RequestMissingData:
-		log.Lvl4("RequestMissingData Reply Phase")
 		p.AggregateErrorsUnstructured(reply)
 		var requestedHash string
 		if p.MasterHash != nil && len(p.MasterHash) > 0 {
 			requestedHash = getRequestedMissingHashUnstructured(p)
 			for _, r := range reply {
 				if plain, ok := r.RequestedData[requestedHash]; ok {
-					hashedData := p.Suite().(kyber.HashFactory).Hash().Sum(plain)
-					if base64.StdEncoding.EncodeToString(hashedData) == requestedHash {
+					if err := checkSize(plain, p.Url, p.MaxSize); err != nil {
+						p.logger().Lvl1("Refusing plaintext data from child", "error", err)
+						p.Errs = append(p.Errs, p.nodeError(err))
+						continue
+					}
+					if decenarch.ResourceHash(plain) == requestedHash {
 						p.PlainData[requestedHash] = plain
 					}
 				}
@@ -226,7 +296,7 @@ func (p *ConsensusUnstructuredState) HandleReplyUnstructured(reply []StructSaveR
 			p.MsgToSign = p.PlainData[requestedHash]
 
 			// announce the end of the process to other conodes
-			msg := SaveAnnounceUnstructured{Phase: End, Url: p.Url}
+			msg := SaveAnnounceUnstructured{RequestID: p.RequestID, Phase: End, Url: p.Url, Version: p.Version, RequestedUrl: p.RequestedUrl}
 			return p.HandleAnnounceUnstructured(StructSaveAnnounceUnstructured{p.TreeNode(), msg})
 		} else {
 			requestedDataMap := make(map[string][]byte)
@@ -241,8 +311,7 @@ func (p *ConsensusUnstructuredState) HandleReplyUnstructured(reply []StructSaveR
 		}
 	case End:
 		// PHASE END
-		log.Lvl4("End Reply Phase")
-		log.Lvl1("Node is done")
+		p.logger().Lvl1("Node is done")
 		defer p.Done()
 		if !p.IsRoot() {
 			resp := SaveReplyUnstructured{Phase: End, Url: p.Url}
@@ -250,7 +319,7 @@ func (p *ConsensusUnstructuredState) HandleReplyUnstructured(reply []StructSaveR
 		}
 		return nil
 	default:
-		log.Lvl1("Unknown phase passed by", p)
+		p.logger().Lvl1("Unknown phase replied")
 		defer p.Done()
 		return errors.New("Unknown Phase")
 
@@ -266,24 +335,36 @@ func (p *ConsensusUnstructuredState) HandleReplyUnstructured(reply []StructSaveR
 // returned value are nil, then an error occured.
 func (p *ConsensusUnstructuredState) GetLocalDataUnstructured() (map[string]map[kyber.Point][]byte, error) {
 	// get data
-	resp, realUrl, _, err := getRemoteDataUnstructured(p.Url)
+	fetch := HeaderFetcher(fetcher(p.Fetch), sender(p.Send), p.Headers)
+	resp, realUrl, _, err := getRemoteDataUnstructured(fetch, p.Url, p.CheckURL)
 	if err != nil {
-		log.Lvl1("Error! Impossible to retrieve remote data.")
+		p.logger().Lvl1("Impossible to retrieve remote data", "url", p.Url, "error", err)
 		return nil, err
 	}
 	p.Url = realUrl
+	p.ContentType = resp.Header.Get("Content-Type")
 	defer resp.Body.Close()
-	// procedure for all other files (consensus on whole hash)
-	rawData, readErr := ioutil.ReadAll(resp.Body)
+	// procedure for all other files (consensus on whole hash), on the
+	// canonical form given by the handler of the content type, if any
+	handler := GetResourceHandler(p.ContentType)
+	rawData, readErr := readBody(resp, p.Url, resourceLimit(handler, p.MaxSize))
 	if readErr != nil {
-		log.Lvl1("Error: Impossible to read http request body!")
+		p.logger().Lvl1("Impossible to read http request body", "url", p.Url, "error", readErr)
 		return nil, readErr
 	}
-	hashedData := p.Suite().(kyber.HashFactory).Hash().Sum(rawData)
-	locHashKey := base64.StdEncoding.EncodeToString(hashedData)
-	sig, sigErr := schnorr.Sign(p.Suite(), p.Private(), []byte(locHashKey))
+	if handler != nil {
+		if rawData, readErr = handler.Canonicalize(rawData); readErr != nil {
+			p.logger().Lvl1("Invalid resource", "url", p.Url, "handler", handler.Name(), "error", readErr)
+			return nil, readErr
+		}
+	}
+	locHashKey := decenarch.ResourceHash(rawData)
+	if p.Fetched != nil {
+		p.Fetched(p.RequestID, locHashKey)
+	}
+	sig, sigErr := schnorr.Sign(decenarch.Suite, p.Private(), p.commitmentMessage(locHashKey))
 	if sigErr != nil {
-		log.Lvl1("Error: Impossible to sign data!")
+		p.logger().Lvl1("Impossible to sign data", "error", sigErr)
 		return nil, sigErr
 	}
 	localHash := make(map[string]map[kyber.Point][]byte)
@@ -298,9 +379,10 @@ func (p *ConsensusUnstructuredState) GetLocalDataUnstructured() (map[string]map[
 // getRemoteData take a url and return: - the http response corresponding to
 // the url - the un-alias url corresponding to the response (id est the path to
 // the file on the remote server) - the url structure associated (see net/url
-// Url struct) - an error status
-func getRemoteDataUnstructured(url string) (*http.Response, string, *urlpkg.URL, error) {
-	getResp, getErr := http.Get(url)
+// Url struct) - an error status. The url and its redirections are checked
+// with check before being fetched with fetch
+func getRemoteDataUnstructured(fetch Fetcher, url string, check URLChecker) (*http.Response, string, *urlpkg.URL, error) {
+	getResp, getErr := fetch(url, check)
 	if getErr != nil {
 		return nil, "", nil, getErr
 	}
@@ -334,9 +416,9 @@ func (p *ConsensusUnstructuredState) AggregateUnstructDataUnstructured(locHash m
 		for img, sigmap := range locHash {
 			for srv, sig := range sigmap {
 				vErr := schnorr.Verify(
-					p.Suite(),
+					decenarch.Suite,
 					srv,
-					[]byte(img),
+					p.commitmentMessage(img),
 					sig)
 				if vErr == nil {
 					if _, ok := p.MasterHash[img]; !ok {
@@ -351,9 +433,9 @@ func (p *ConsensusUnstructuredState) AggregateUnstructDataUnstructured(locHash m
 			for img, sigmap := range r.SaveReplyUnstructured.MasterHash {
 				for srv, sig := range sigmap {
 					vErr := schnorr.Verify(
-						p.Suite(),
+						decenarch.Suite,
 						srv,
-						[]byte(img),
+						p.commitmentMessage(img),
 						sig)
 					if vErr == nil {
 						if _, ok := p.MasterHash[img]; !ok {
@@ -368,6 +450,34 @@ func (p *ConsensusUnstructuredState) AggregateUnstructDataUnstructured(locHash m
 	}
 }
 
+// commitmentMessage returns the bytes signed by the conodes that fetched the
+// resource of the given hash
+func (p *ConsensusUnstructuredState) commitmentMessage(hash string) []byte {
+	return decenarch.CommitmentMessage(p.RequestedUrl, p.RequestID, hash)
+}
+
+// transcript returns the commitments of the conodes on the hashes of
+// masterHash for the resource url of the save requestID, sorted by conode
+func transcript(url, requestID string, masterHash map[string]map[kyber.Point][]byte) []decenarch.HashCommitment {
+	var commitments []decenarch.HashCommitment
+	for hash, sigs := range masterHash {
+		digest := decenarch.CommitmentDigest(hash)
+		for conode, sig := range sigs {
+			commitments = append(commitments, decenarch.HashCommitment{
+				Conode:    conode.String(),
+				Digest:    digest,
+				Signature: sig,
+				Url:       url,
+				RequestID: requestID,
+			})
+		}
+	}
+	sort.Slice(commitments, func(i, j int) bool {
+		return commitments[i].Conode < commitments[j].Conode
+	})
+	return commitments
+}
+
 // getMostSignedHash returns a new map containing only the entry of the map
 // where the number of signature is the highest.  If hashmap is nil, it returns
 // nil.  If no entry are under p.Threshold, it returns a non-nil error.
@@ -408,12 +518,12 @@ func getRequestedMissingHashUnstructured(p *ConsensusUnstructuredState) string {
 			verifiedSig := 0
 			for srv, sig := range sigs {
 				vErr := schnorr.Verify(
-					p.Suite(),
+					decenarch.Suite,
 					srv,
-					[]byte(dataH),
+					p.commitmentMessage(dataH),
 					sig)
 				if vErr != nil {
-					p.Errs = append(p.Errs, vErr)
+					p.Errs = append(p.Errs, p.nodeError(vErr))
 				}
 				verifiedSig += 1
 			}
@@ -425,3 +535,13 @@ func getRequestedMissingHashUnstructured(p *ConsensusUnstructuredState) string {
 	}
 	return missingHash
 }
+
+// nodeError returns the error err of the node, to be sent to its parent
+func (p *ConsensusUnstructuredState) nodeError(err error) decenarch.NodeError {
+	return decenarch.NewNodeError(p.Public(), NameConsensusUnstructured+"/"+p.Phase.String(), err)
+}
+
+// logger returns the structured logger of this node for the current save
+func (p *ConsensusUnstructuredState) logger() *lib.Logger {
+	return lib.NewLogger(p.RequestID, p.ServerIdentity().Address.String()).With("protocol", NameConsensusUnstructured)
+}
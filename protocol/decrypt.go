@@ -1,14 +1,15 @@
 package protocol
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	"gopkg.in/dedis/onet.v2"
 	"gopkg.in/dedis/onet.v2/network"
 
-	"github.com/dedis/onet/log"
 	decenarch "github.com/dedis/student_18_decenar"
 	"github.com/dedis/student_18_decenar/lib"
 	"gopkg.in/dedis/kyber.v2"
@@ -21,15 +22,24 @@ const NameDecrypt = "decrypt"
 // Decrypt is the core structure of the protocol.
 type Decrypt struct {
 	*onet.TreeNodeInstance
-	Threshold int32 // how many replies are needed to re-create the secret
-	Failures  int   // how many failures occured so far
+	RequestID string // identifier of the save, used for logging
+	Threshold int32  // how many replies are needed to re-create the secret
+	Failures  int    // how many failures occured so far
 
 	Secret          *lib.SharedSecret // secret is the private key share from the DKG.
 	EncryptedCBFSet *lib.CipherVector // election to be decrypted.
+	Lengths         []int             // lengths of the vectors batched in EncryptedCBFSet, see SetBatch
 
 	Partials map[int][]kyber.Point // parials to return
+	Proofs   map[int][]*dleq.Proof // proofs of the partials, see lib.VerifyPartial
+	Evidence []decenarch.Evidence  // evidence against the nodes that sent invalid partials
+	Faults   *Faults               // misbehaviours of the node, see faults.go
+	Workers  int                   // goroutines of the partial decryptions, see lib.WithWorkers
+	Version  int32                 // version of the protocol announced by the root, see version.go
 	Finished chan bool             // flag to signal protocol termination.
 	Received chan bool             // flag to signal that the conode received the encrypted filter
+	ctx      context.Context       // canceled when the protocol terminates
+	cancel   context.CancelFunc
 	doneOnce sync.Once
 	timeout  *time.Timer
 	mutex    sync.Mutex
@@ -44,10 +54,13 @@ func init() {
 func NewDecrypt(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 	d := &Decrypt{
 		TreeNodeInstance: n,
+		Version:          Version,
 		Finished:         make(chan bool),
 		Received:         make(chan bool),
 		Partials:         make(map[int][]kyber.Point),
+		Proofs:           make(map[int][]*dleq.Proof),
 	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
 
 	err := d.RegisterHandlers(d.HandlePrompt, d.HandlePartial)
 	if err != nil {
@@ -58,19 +71,26 @@ func NewDecrypt(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 
 // Start is called on the root node prompting it to send itself a Prompt message.
 func (d *Decrypt) Start() error {
-	log.Lvl3("Starting decrypt protocol")
+	d.logger().Lvl3("Starting decrypt protocol")
 	// set timeout
 	d.timeout = time.AfterFunc(10*time.Minute, func() {
-		log.Lvl1("decrypt protocol timeout")
+		d.logger().Lvl1("Decrypt protocol timeout")
 		d.finish(false)
 	})
 
 	// broadcast request
+	lengths := make([]int32, len(d.Lengths))
+	for i, l := range d.Lengths {
+		lengths[i] = int32(l)
+	}
 	errs := d.Broadcast(&PromptDecrypt{
-		EncryptedCBFSet: d.EncryptedCBFSet,
+		RequestID:    d.RequestID,
+		PackedCBFSet: d.EncryptedCBFSet.Pack(),
+		Lengths:      lengths,
+		Version:      d.Version,
 	})
 	if len(errs) > int(d.Threshold) {
-		log.Errorf("Some nodes failed with error(s) %v", errs)
+		d.logger().Error("Some nodes failed", "errors", lib.ConcatenateErrors(errs))
 		return errors.New("too many nodes failed in broadcast")
 	}
 
@@ -80,68 +100,136 @@ func (d *Decrypt) Start() error {
 // HandlePrompt retrieves the mixes, verifies them and performs a partial decryption
 // on the last mix before appending it to the election skipchain.
 func (d *Decrypt) HandlePrompt(prompt MessagePromptDecrypt) error {
-	log.Lvl3(d.Name() + ": sending partials to root")
 	defer d.Done()
+	d.RequestID = prompt.RequestID
+	d.logger().Lvl3("Sending partials to root")
+
+	// a node that doesn't support the version of the root refuses to
+	// decrypt, so that its partials are not counted
+	version, err := NegotiateVersion(prompt.Version)
+	if err != nil {
+		d.logger().Lvl1("Refusing to decrypt", "error", err)
+		d.Received <- true
+		return d.SendTo(d.Root(), &SendPartial{})
+	}
+	d.Version = version
 
 	// store encrypted CBF set for later verification
-	d.EncryptedCBFSet = prompt.EncryptedCBFSet
+	set := new(lib.CipherVector)
+	if err := set.Unpack(prompt.PackedCBFSet); err != nil {
+		d.logger().Lvl1("Invalid encrypted CBF set, node refuses to decrypt", "error", err)
+		d.Received <- true
+		return d.SendTo(d.Root(), &SendPartial{})
+	}
+	total := 0
+	for _, l := range prompt.Lengths {
+		if l < 0 {
+			total = -1
+			break
+		}
+		total += int(l)
+		d.Lengths = append(d.Lengths, int(l))
+	}
+	if len(prompt.Lengths) > 0 && total != len(*set) {
+		d.logger().Lvl1("Invalid batch lengths, node refuses to decrypt", "lengths", prompt.Lengths, "buckets", len(*set))
+		d.Received <- true
+		return d.SendTo(d.Root(), &SendPartial{})
+	}
+	d.EncryptedCBFSet = set
 
 	// partially decrypt
-	partials, proofs := d.getPartials(prompt.EncryptedCBFSet)
+	partials, proofs, err := d.getPartials(set)
+	if err != nil {
+		d.logger().Lvl1("Partial decryption interrupted", "error", err)
+		d.Received <- true
+		return d.SendTo(d.Root(), &SendPartial{})
+	}
+	d.Faults.lieOnPartials(partials)
 
 	// we can store encrypted filter
 	d.Received <- true
 
-	// send partials to root
+	// send the signed partials to root
 	msg := &SendPartial{
 		Partials:       partials,
 		Proofs:         proofs,
 		PublicKeyShare: decenarch.Suite.Point().Mul(d.Secret.V, nil),
 	}
+	contribution := &DecryptContribution{
+		RequestID:      d.RequestID,
+		PackedCBFSet:   prompt.PackedCBFSet,
+		Partials:       msg.Partials,
+		Proofs:         msg.Proofs,
+		PublicKeyShare: msg.PublicKeyShare,
+	}
+	if err := contribution.sign(d.Private()); err != nil {
+		d.logger().Lvl1("Impossible to sign the partials", "error", err)
+		return d.SendTo(d.Root(), &SendPartial{})
+	}
+	msg.Signature = contribution.Signature
 	return d.SendTo(d.Root(), msg)
 }
 
 // HandlePartial
 func (d *Decrypt) HandlePartial(reply MessageSendPartial) error {
-	log.Lvl3(d.ServerIdentity().Address, "got partials from", reply.Name(), "partials", len(d.Partials))
+	d.logger().Lvl3("Got partials", "from", reply.ServerIdentity.Address, "partials", len(d.Partials))
 	// handle the case in which a conode refuses to send its partial
 	if reply.Partials == nil {
-		log.Lvl1("Node", reply.ServerIdentity, "refused to reply")
+		d.logger().Lvl1("Node refused to reply", "node", reply.ServerIdentity.Address)
 		d.Failures++
 		if d.Failures > len(d.Roster().List)-int(d.Threshold) {
-			log.Lvl2(reply.ServerIdentity, "couldn't get enough shares")
+			d.logger().Lvl2("Couldn't get enough shares", "failures", d.Failures)
 			d.finish(false)
 		}
 		return nil
 	}
 
-	// verify the proofs of the partials
-	base := decenarch.Suite.Point().Base()
-	for i, p := range reply.Proofs {
-		c := &(*d.EncryptedCBFSet)[i]
-		ver := p.Verify(decenarch.Suite, base, c.K, reply.PublicKeyShare, decenarch.Suite.Point().Sub(c.C, reply.Partials[i]))
-		if ver != nil {
-			log.Print("Failed")
-			log.Lvl1("Node", reply.ServerIdentity, "sended invalid partials")
-			d.Failures++
-			if d.Failures > len(d.Roster().List)-int(d.Threshold) {
-				log.Lvl2(reply.ServerIdentity, "couldn't get enough shares")
-				d.finish(false)
-			}
-			return nil
+	// verify the proofs of the partials, the evidence embeds the signed
+	// contribution of the node, see VerifyEvidence
+	if ver := d.verifyPartials(reply); ver != nil {
+		d.logger().Lvl1("Node sent invalid partials", "node", reply.ServerIdentity.Address, "error", ver)
+		contribution := &DecryptContribution{
+			RequestID:      d.RequestID,
+			PackedCBFSet:   d.EncryptedCBFSet.Pack(),
+			Partials:       reply.Partials,
+			Proofs:         reply.Proofs,
+			PublicKeyShare: reply.PublicKeyShare,
+			Signature:      reply.Signature,
+		}
+		if err := contribution.verifySignature(reply.ServerIdentity.Public); err != nil {
+			d.logger().Lvl1("Unsigned partials, no evidence", "node", reply.ServerIdentity.Address, "error", err)
+		} else if e, err := newContributionEvidence(d.Private(), d.Public(), d.RequestID, reply.ServerIdentity.Public, NameDecrypt, ver, contribution); err != nil {
+			d.logger().Lvl1("Impossible to sign the evidence", "error", err)
+		} else {
+			d.mutex.Lock()
+			d.Evidence = append(d.Evidence, e)
+			d.mutex.Unlock()
+		}
+		d.Failures++
+		if d.Failures > len(d.Roster().List)-int(d.Threshold) {
+			d.logger().Lvl2("Couldn't get enough shares", "failures", d.Failures)
+			d.finish(false)
 		}
+		return nil
 	}
 
 	// finally add the partials of the user
 	d.mutex.Lock()
 	d.Partials[reply.RosterIndex] = reply.Partials
+	d.Proofs[reply.RosterIndex] = reply.Proofs
 	d.mutex.Unlock()
 
-	// if enough shares from children, add partials of root
+	// if enough shares from children, add partials of root, with their
+	// proofs for the transcript of the consensus
 	if len(d.Partials) >= int(d.Threshold-1) {
-		// we don't need the proofs of the leader
+		partials, proofs, err := d.getPartials(d.EncryptedCBFSet)
+		if err != nil {
+			d.logger().Lvl1("Partial decryption interrupted", "error", err)
+			d.finish(false)
+			return nil
+		}
 		d.mutex.Lock()
-		d.Partials[d.Index()], _ = d.getPartials(d.EncryptedCBFSet)
+		d.Partials[d.Index()], d.Proofs[d.Index()] = partials, proofs
 		d.mutex.Unlock()
 		d.finish(true)
 	}
@@ -149,9 +237,37 @@ func (d *Decrypt) HandlePartial(reply MessageSendPartial) error {
 	return nil
 }
 
+// verifyPartials returns an error if the partials of the reply are not
+// proven to be the partial decryptions of the encrypted filter by the DKG
+// share of the conode
+func (d *Decrypt) verifyPartials(reply MessageSendPartial) error {
+	if reply.PublicKeyShare != nil && d.Secret != nil && len(d.Secret.Commits) > 0 && !reply.PublicKeyShare.Equal(lib.PublicShare(d.Secret.Commits, reply.RosterIndex)) {
+		return errors.New("public key share not matching the DKG")
+	}
+	return verifyPartials(d.EncryptedCBFSet, reply.Partials, reply.Proofs, reply.PublicKeyShare)
+}
+
+// verifyPartials returns an error if the partials and proofs are not the
+// partial decryptions of the buckets of set with the public key share
+func verifyPartials(set *lib.CipherVector, partials []kyber.Point, proofs []*dleq.Proof, share kyber.Point) error {
+	if len(partials) != len(*set) || len(proofs) != len(partials) {
+		return fmt.Errorf("%d partials and %d proofs for %d buckets", len(partials), len(proofs), len(*set))
+	}
+	if share == nil {
+		return errors.New("missing public key share")
+	}
+	for i, p := range proofs {
+		if err := lib.VerifyPartial(share, (*set)[i], partials[i], p); err != nil {
+			return fmt.Errorf("bucket %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
 // finish terminates the protocol within onet.
 func (d *Decrypt) finish(result bool) {
 	d.timeout.Stop()
+	d.cancel()
 	select {
 	case d.Finished <- result:
 		// decrypt protocol suceeded
@@ -163,34 +279,97 @@ func (d *Decrypt) finish(result bool) {
 	d.doneOnce.Do(func() { d.Done() })
 }
 
-// getPartials
-func (d *Decrypt) getPartials(cipher *lib.CipherVector) ([]kyber.Point, []*dleq.Proof) {
-	partials := make([]kyber.Point, len(*cipher))
-	proofs := make([]*dleq.Proof, len(*cipher))
-	base := decenarch.Suite.Point().Base()
-	var wg sync.WaitGroup
-	if lib.PARALLELIZE {
-		for i := 0; i < len(*cipher); i = i + lib.VPARALLELIZE {
-			wg.Add(1)
-			go func(i int) {
-				for j := 0; j < lib.VPARALLELIZE && (j+i < len(*cipher)); j++ {
-					c := &(*cipher)[i+j]
-					partials[i+j] = lib.DecryptPoint(d.Secret.V, lib.CipherText{K: c.K, C: c.C})
-					p, _, _, _ := dleq.NewDLEQProof(decenarch.Suite, base, c.K, d.Secret.V)
-					proofs[i+j] = p
-				}
-				defer wg.Done()
-			}(i)
+// Shutdown interrupts the partial decryption of the node when the protocol
+// is done
+func (d *Decrypt) Shutdown() error {
+	d.cancel()
+	return nil
+}
 
+// SetBatch sets the vectors decrypted in one round of the protocol. They are
+// sent concatenated in EncryptedCBFSet, so that the tree and the messages are
+// set up once for all of them.
+func (d *Decrypt) SetBatch(vectors []*lib.CipherVector) {
+	set := make(lib.CipherVector, 0)
+	d.Lengths = make([]int, len(vectors))
+	for i, v := range vectors {
+		set = append(set, *v...)
+		d.Lengths[i] = len(*v)
+	}
+	d.EncryptedCBFSet = &set
+}
+
+// Batch returns the vectors decrypted by the protocol, see SetBatch
+func (d *Decrypt) Batch() []*lib.CipherVector {
+	vectors := make([]*lib.CipherVector, 0, len(d.batchLengths()))
+	d.splitBatch(func(start, end int) {
+		v := (*d.EncryptedCBFSet)[start:end]
+		vectors = append(vectors, &v)
+	})
+	return vectors
+}
+
+// BatchPartials returns the partials and their proofs by DKG share index, for
+// each vector of the batch, see SetBatch
+func (d *Decrypt) BatchPartials() ([]map[int][]kyber.Point, []map[int][]*dleq.Proof) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	partials := make([]map[int][]kyber.Point, 0, len(d.batchLengths()))
+	proofs := make([]map[int][]*dleq.Proof, 0, len(d.batchLengths()))
+	d.splitBatch(func(start, end int) {
+		vp := make(map[int][]kyber.Point, len(d.Partials))
+		for j, p := range d.Partials {
+			vp[j] = p[start:end]
+		}
+		vProofs := make(map[int][]*dleq.Proof, len(d.Proofs))
+		for j, p := range d.Proofs {
+			vProofs[j] = p[start:end]
 		}
-		wg.Wait()
-	} else {
-		for i, c := range *cipher {
-			partials[i] = lib.DecryptPoint(d.Secret.V, lib.CipherText{K: c.K, C: c.C})
-			p, _, _, _ := dleq.NewDLEQProof(decenarch.Suite, base, c.K, d.Secret.V)
-			proofs[i] = p
+		partials = append(partials, vp)
+		proofs = append(proofs, vProofs)
+	})
+	return partials, proofs
+}
+
+// batchLengths returns the lengths of the vectors of the batch, the length of
+// EncryptedCBFSet for a single vector
+func (d *Decrypt) batchLengths() []int {
+	if len(d.Lengths) == 0 && d.EncryptedCBFSet != nil {
+		return []int{len(*d.EncryptedCBFSet)}
+	}
+	return d.Lengths
+}
+
+// splitBatch calls f on the bounds in EncryptedCBFSet of each vector of the
+// batch
+func (d *Decrypt) splitBatch(f func(start, end int)) {
+	start := 0
+	for _, l := range d.batchLengths() {
+		f(start, start+l)
+		start += l
+	}
+}
+
+// getPartials returns the partial decryptions of cipher by the share of the
+// node, with their proofs, computed by at most Workers goroutines. An error
+// is returned if the protocol terminated before.
+func (d *Decrypt) getPartials(cipher *lib.CipherVector) ([]kyber.Point, []*dleq.Proof, error) {
+	partials := make([]kyber.Point, len(*cipher))
+	proofs := make([]*dleq.Proof, len(*cipher))
+	err := lib.ParallelFor(lib.WithWorkers(d.ctx, d.Workers), len(*cipher), func(start, end int) {
+		for i := start; i < end; i++ {
+			c := (*cipher)[i]
+			partials[i] = lib.DecryptPoint(d.Secret.V, c)
+			proofs[i] = lib.ProvePartial(d.Secret.V, c)
 		}
+	})
+	if err != nil {
+		return nil, nil, err
 	}
+	return partials, proofs, nil
+}
 
-	return partials, proofs
+// logger returns the structured logger of this node for the current save
+func (d *Decrypt) logger() *lib.Logger {
+	return lib.NewLogger(d.RequestID, d.ServerIdentity().Address.String()).With("protocol", NameDecrypt)
 }
@@ -1,16 +1,21 @@
 package protocol
 
 import (
-	"github.com/dedis/student_18_decenar/lib"
 	"gopkg.in/dedis/kyber.v2"
 	"gopkg.in/dedis/kyber.v2/proof/dleq"
 	"gopkg.in/dedis/onet.v2"
 )
 
 // PromptDecrypt is sent from node to node prompting the receiver to perform
-// their respective partial decryption of the last mix.
+// their respective partial decryption of the last mix. The encrypted CBF set
+// is packed by lib.CipherVector.Pack. Lengths are the lengths of the vectors
+// batched in the set, empty for a single vector, see Decrypt.SetBatch.
+// Version is the version of the protocol run by the root, see version.go.
 type PromptDecrypt struct {
-	EncryptedCBFSet *lib.CipherVector
+	RequestID    string
+	PackedCBFSet []byte
+	Lengths      []int32
+	Version      int32
 }
 
 // MessagePromptDecrypt is a wrapper around PromptDecrypt.
@@ -19,10 +24,14 @@ type MessagePromptDecrypt struct {
 	PromptDecrypt
 }
 
+// SendPartial is the partial decryption of the encrypted CBF set sent by a
+// conode to the root. Signature is the signature of the conode on its
+// contribution, see DecryptContribution.
 type SendPartial struct {
 	Partials       []kyber.Point
 	Proofs         []*dleq.Proof
 	PublicKeyShare kyber.Point
+	Signature      []byte
 }
 
 type MessageSendPartial struct {
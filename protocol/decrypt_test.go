@@ -8,11 +8,10 @@ import (
 	"gopkg.in/dedis/onet.v2"
 	"gopkg.in/dedis/onet.v2/log"
 
+	decenarch "github.com/dedis/student_18_decenar"
 	"github.com/dedis/student_18_decenar/lib"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-
-	"gopkg.in/dedis/cothority.v2"
 )
 
 var decryptServiceID onet.ServiceID
@@ -21,6 +20,7 @@ type decryptService struct {
 	*onet.ServiceProcessor
 
 	secret *lib.SharedSecret
+	faults *Faults
 }
 
 func init() {
@@ -40,6 +40,7 @@ func (s *decryptService) NewProtocol(node *onet.TreeNodeInstance, conf *onet.Gen
 		instance, _ := NewDecrypt(node)
 		decrypt := instance.(*Decrypt)
 		decrypt.Secret = s.secret
+		decrypt.Faults = s.faults
 		return decrypt, nil
 	default:
 		return nil, errors.New("Unknown protocol")
@@ -54,7 +55,7 @@ func TestDecryptProtocol(t *testing.T) {
 }
 
 func runDecrypt(t *testing.T, n int) {
-	local := onet.NewLocalTest(cothority.Suite)
+	local := onet.NewLocalTest(decenarch.Suite)
 	defer local.CloseAll()
 
 	nodes, _, tree := local.GenBigTree(n, n, n, true)
@@ -89,3 +90,93 @@ func runDecrypt(t *testing.T, n int) {
 		assert.True(t, false)
 	}
 }
+
+func TestDecryptCorruptPartials(t *testing.T) {
+	n, threshold := 7, 5
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	nodes, _, tree := local.GenBigTree(n, n, n, true)
+	services := local.GetServices(nodes, decryptServiceID)
+	dkgs, _ := lib.DKGSimulate(n, threshold)
+	shared, _ := lib.NewSharedSecret(dkgs[0])
+	set := []int64{0, 1, 0, 3}
+	cipher, _ := lib.EncryptIntVector(shared.X, set)
+
+	// the last two conodes lie, the others are just enough
+	for i := range services {
+		services[i].(*decryptService).secret, _ = lib.NewSharedSecret(dkgs[i])
+	}
+	for _, i := range []int{n - 2, n - 1} {
+		services[i].(*decryptService).faults = &Faults{CorruptPartials: true}
+	}
+
+	instance, _ := services[0].(*decryptService).CreateProtocol(NameDecrypt, tree)
+	decrypt := instance.(*Decrypt)
+	decrypt.Secret = shared
+	decrypt.EncryptedCBFSet = cipher
+	decrypt.Threshold = int32(threshold)
+	require.Nil(t, decrypt.Start())
+
+	select {
+	case ok := <-decrypt.Finished:
+		require.True(t, ok)
+		decrypt.mutex.Lock()
+		defer decrypt.mutex.Unlock()
+		require.Len(t, decrypt.Partials, threshold)
+		require.Len(t, decrypt.Proofs, threshold)
+		require.NotContains(t, decrypt.Partials, n-2)
+		require.NotContains(t, decrypt.Partials, n-1)
+		for _, e := range decrypt.Evidence {
+			require.Contains(t, []string{nodes[n-2].ServerIdentity.Public.String(), nodes[n-1].ServerIdentity.Public.String()}, e.Accused)
+			require.Nil(t, VerifyEvidence(e, tree.Roster.Publics()))
+		}
+		reconstructed, err := lib.ReconstructVectorFromPartials(n, threshold, decrypt.Partials)
+		require.Nil(t, err)
+		require.Equal(t, set, reconstructed)
+	case <-time.After(60 * time.Second):
+		t.Fatal("Didn't finish in time")
+	}
+}
+
+func TestDecryptBatch(t *testing.T) {
+	n, threshold := 5, 4
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	nodes, _, tree := local.GenBigTree(n, n, n, true)
+	services := local.GetServices(nodes, decryptServiceID)
+	dkgs, _ := lib.DKGSimulate(n, threshold)
+	shared, _ := lib.NewSharedSecret(dkgs[0])
+	for i := range services {
+		services[i].(*decryptService).secret, _ = lib.NewSharedSecret(dkgs[i])
+	}
+
+	sets := [][]int64{{0, 1, 0}, {3, 2}, {4, 0, 0, 1}}
+	ciphers := make([]*lib.CipherVector, len(sets))
+	for i, set := range sets {
+		ciphers[i], _ = lib.EncryptIntVector(shared.X, set)
+	}
+
+	instance, _ := services[0].(*decryptService).CreateProtocol(NameDecrypt, tree)
+	decrypt := instance.(*Decrypt)
+	decrypt.Secret = shared
+	decrypt.SetBatch(ciphers)
+	decrypt.Threshold = int32(threshold)
+	require.Len(t, *decrypt.EncryptedCBFSet, 9)
+	require.Equal(t, ciphers[1], decrypt.Batch()[1])
+	require.Nil(t, decrypt.Start())
+
+	select {
+	case ok := <-decrypt.Finished:
+		require.True(t, ok)
+		partials, proofs := decrypt.BatchPartials()
+		require.Len(t, partials, len(sets))
+		for i, set := range sets {
+			require.Len(t, proofs[i], len(partials[i]))
+			reconstructed, err := lib.ReconstructVectorFromPartials(n, threshold, partials[i])
+			require.Nil(t, err)
+			require.Equal(t, set, reconstructed)
+		}
+	case <-time.After(60 * time.Second):
+		t.Fatal("Didn't finish in time")
+	}
+}
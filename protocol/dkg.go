@@ -6,12 +6,13 @@ import (
 	"errors"
 	"fmt"
 
-	"gopkg.in/dedis/cothority.v2"
 	"gopkg.in/dedis/kyber.v2"
 	dkg "gopkg.in/dedis/kyber.v2/share/dkg/rabin"
 	"gopkg.in/dedis/kyber.v2/util/key"
 	"gopkg.in/dedis/onet.v2"
 	"gopkg.in/dedis/onet.v2/log"
+
+	decenarch "github.com/dedis/student_18_decenar"
 )
 
 // NameDKG is the protocol identifier string.
@@ -26,6 +27,9 @@ type SetupDKG struct {
 	*onet.TreeNodeInstance
 	DKG       *dkg.DistKeyGenerator
 	Threshold uint32
+	// Namespace is the namespace of the archive the key is created for,
+	// set by the service
+	Namespace string
 
 	nodes   []*onet.TreeNode
 	keypair *key.Pair
@@ -47,7 +51,7 @@ type SetupDKG struct {
 func NewSetupDKG(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 	o := &SetupDKG{
 		TreeNodeInstance: n,
-		keypair:          key.NewKeyPair(cothority.Suite),
+		keypair:          key.NewKeyPair(decenarch.Suite),
 		Done:             make(chan bool, 1),
 		Threshold:        uint32(len(n.Roster().List) - (len(n.Roster().List)-1)/3),
 		nodes:            n.List(),
@@ -158,7 +162,7 @@ func (o *SetupDKG) rootStartDeal(replies []structInitReply) error {
 func (o *SetupDKG) allStartDeal(ssd structStartDeal) error {
 	log.Lvl3(o.Name(), "received startDeal from:", ssd.ServerIdentity)
 	var err error
-	o.DKG, err = dkg.NewDistKeyGenerator(cothority.Suite, o.keypair.Private,
+	o.DKG, err = dkg.NewDistKeyGenerator(decenarch.Suite, o.keypair.Private,
 		ssd.Publics, int(ssd.Threshold))
 	if err != nil {
 		return err
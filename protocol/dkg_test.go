@@ -8,9 +8,8 @@ import (
 	"gopkg.in/dedis/onet.v2/log"
 	"gopkg.in/dedis/onet.v2/network"
 
+	decenarch "github.com/dedis/student_18_decenar"
 	"github.com/stretchr/testify/require"
-
-	"gopkg.in/dedis/cothority.v2"
 )
 
 func TestSetupDKG(t *testing.T) {
@@ -23,7 +22,7 @@ func TestSetupDKG(t *testing.T) {
 
 func setupDKG(t *testing.T, nbrNodes int) {
 	log.Lvl1("Running", nbrNodes, "nodes")
-	local := onet.NewLocalTest(cothority.Suite)
+	local := onet.NewLocalTest(decenarch.Suite)
 	defer local.CloseAll()
 	_, _, tree := local.GenBigTree(nbrNodes, nbrNodes, nbrNodes, true)
 	log.Lvl3(tree.Dump())
@@ -1,17 +1,31 @@
-// TODO: review doc
 /*
 Package protocol contains the functions and structure related to the save and
 retrieve protocol of the decenarch service.
 
-The protocol has two messages:
+The protocols have two kinds of messages:
 	- Announce which is sent from the root down the tree
 	- Reply which is sent back up to the root
 
-A simple protocol uses four files:
-- struct.go defines the messages sent around
-- save.go defines the actions for each message related to the save process
-- utils.go defines the structures and functions of ExplicitNode and AnonNode used
-in the save process to reach consensus on an html tree without revealing the
-original tree itself.
+The files are organized as follows:
+- consensus_struct.go defines the messages of the consensus protocols
+- consensus_structured.go defines the consensus on HTML pages using the
+counting Bloom filter of lib/bloom.go, consensus_merkle.go the consensus using
+Merkle commitments and consensus_unstructured.go the consensus on the
+additional resources, listed by links.go
+- engine.go defines the consensus engines used by the service, and
+engine_cbf.go and engine_merkle.go their implementations
+- decrypt.go, dkg.go and sign.go define the decryption, distributed key
+generation and signing protocols, sign_unstructured.go the verification of
+the additional resources, and proofstore.go the store of the complete proofs
+verified before signing
+- fetch.go defines how the conodes fetch the web pages, and template.go how
+they replay the request templates of the clients
+- version.go defines the version of the protocols carried by their
+announcements
+
+The counting Bloom filter and the handling of the HTML leaves are only
+implemented in the lib package, which is shared by the protocols and the
+service, and the canonical serialization of the consensus pages in
+lib/canonhtml.
 */
 package protocol
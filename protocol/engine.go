@@ -0,0 +1,184 @@
+package protocol
+
+/*
+The engine.go defines the interface implemented by the consensus engines. A
+consensus engine runs the protocols needed by the conodes to agree on the
+structured data, i.e. the HTML page, of a web page. The service chooses the
+engine and only deals with the result, so that new engines can be added
+without changing the save path of the service.
+*/
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang.org/x/net/html"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/proof/dleq"
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// DefaultConsensusEngine is the name of the engine used when none is given
+const DefaultConsensusEngine = NameCBFEngine
+
+// ConsensusEngine is implemented by the consensus engines on structured data
+type ConsensusEngine interface {
+	// Name returns the unique name of the engine
+	Name() string
+	// Run runs the consensus on the page described by ctx. It is only
+	// called on the root of the tree
+	Run(ctx *EngineContext) (*EngineResult, error)
+}
+
+// EngineContext holds what an engine needs from the service to run a consensus
+//    - RequestID identifies the save in the logs
+//    - Tree is the tree of the conodes taking part to the consensus
+//    - Url is the address of the page
+//    - Threshold is the number of conodes that must agree on the data
+//    - Secret is the shared secret of the conode from the DKG
+//    - FalsePositiveRate is the target false positive rate of the Bloom
+//      filters, 0 for lib.DefaultFalsePositiveRate
+//    - Logger is the logger of the save
+//    - CreateProtocol creates the protocols run by the engine
+//    - Configure is called on the root instance of each protocol created by
+//      the engine, before it is started, to add the options of the service
+//    - Diagnostics asks for the summary of the leaves dropped from the
+//      consensus page, see decenarch.DivergenceSummary
+//    - CounterWidth and MaxHomomorphicInt are the width of the counters of
+//      the aggregated filters and the bound of their decrypted values agreed
+//      at setup, 0 to derive them from the tree, see lib.CounterWidth
+//    - Workers limits the goroutines of the computations of the root on the
+//      encrypted filters, 0 for the workers of the conode, see lib.Workers
+//    - Canceled is closed when the client cancels the save, the engine then
+//      returns decenarch.ErrSaveCanceled. A nil channel is never closed
+type EngineContext struct {
+	RequestID         string
+	Tree              *onet.Tree
+	Url               string
+	Threshold         int
+	Secret            *lib.SharedSecret
+	FalsePositiveRate float64
+	Logger            *lib.Logger
+	CreateProtocol    func(name string, t *onet.Tree) (onet.ProtocolInstance, error)
+	Configure         func(pi onet.ProtocolInstance) error
+	Diagnostics       bool
+	CounterWidth      int
+	MaxHomomorphicInt int64
+	Workers           int
+	Canceled          <-chan struct{}
+}
+
+// EngineResult is the outcome of a consensus
+//    - Url is the address of the page after the redirections, reached by at
+//      least a threshold of conodes
+//    - ContentType is the MIME type of the page
+//    - Charset is the original charset of the page, the page is UTF-8
+//    - Page is the consensus page to sign
+//    - LocalTree is the HTML tree of the page fetched by the root
+//    - Leaves are the unique leaves of the page fetched by the root
+//    - Blobs are the inline blobs extracted from the page fetched by the
+//      root, see inline.go
+//    - CompleteProofs are the proofs of the operations done by the conodes
+//    - SignProtocol is the name of the protocol used to sign the page, its
+//      verification function checks the consensus of the engine
+//    - Partials, ConsensusSet and ParametersCBF allow the other conodes to
+//      verify the consensus of the CBF engine before signing
+//    - DecryptionProofs, DKGCommits and Threshold prove that the buckets of
+//      ConsensusSet below the threshold were decrypted correctly, see
+//      lib.VerifyBelowThreshold
+//    - Commitments allow the other conodes to verify the consensus of the
+//      Merkle engine before signing
+//    - Redirections are the redirect chains followed by the conodes, see
+//      AgreeOnURL
+//    - CertificateHash and CertificateChain describe the TLS certificate of
+//      the origin, see ConsensusStructuredState
+//    - Evidence is the signed evidence against the conodes whose contribution
+//      to the consensus was detected as invalid
+//    - Errors are the errors of the conodes during the consensus
+//    - Divergence summarizes the leaves of the root dropped from the
+//      consensus page, nil if the diagnostics were not asked
+type EngineResult struct {
+	Url         string
+	ContentType string
+	Charset     string
+	Page        []byte
+	LocalTree   *html.Node
+	Leaves      []string
+	Blobs       []InlineBlob
+
+	SignProtocol     string
+	CompleteProofs   lib.CompleteProofs
+	Partials         map[int][]kyber.Point
+	ConsensusSet     []int64
+	ParametersCBF    []uint
+	DecryptionProofs map[int][]*dleq.Proof
+	DKGCommits       []kyber.Point
+	Threshold        int
+	Commitments      []MerkleCommitment
+	Redirections     []Redirection
+
+	CertificateHash  string
+	CertificateChain [][]byte
+
+	Evidence   []decenarch.Evidence
+	Errors     []decenarch.NodeError
+	Divergence *decenarch.DivergenceSummary
+}
+
+var engines = struct {
+	sync.Mutex
+	m map[string]ConsensusEngine
+}{m: make(map[string]ConsensusEngine)}
+
+// RegisterConsensusEngine makes an engine available under its name. It
+// returns an error if an engine with the same name is already registered.
+func RegisterConsensusEngine(e ConsensusEngine) error {
+	engines.Lock()
+	defer engines.Unlock()
+	if _, ok := engines.m[e.Name()]; ok {
+		return fmt.Errorf("consensus engine %s already registered", e.Name())
+	}
+	engines.m[e.Name()] = e
+	return nil
+}
+
+// GetConsensusEngine returns the engine registered under name, or the default
+// engine if name is empty
+func GetConsensusEngine(name string) (ConsensusEngine, error) {
+	if name == "" {
+		name = DefaultConsensusEngine
+	}
+	engines.Lock()
+	defer engines.Unlock()
+	e, ok := engines.m[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown consensus engine %s", name)
+	}
+	return e, nil
+}
+
+// ConsensusEngines returns the sorted names of the registered engines
+func ConsensusEngines() []string {
+	engines.Lock()
+	defer engines.Unlock()
+	names := make([]string, 0, len(engines.m))
+	for n := range engines.m {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// failedConodes returns the number of distinct conodes with an error
+func failedConodes(errs []decenarch.NodeError) int {
+	failed := make(map[string]bool)
+	for _, e := range errs {
+		failed[e.ConodeID] = true
+	}
+	return len(failed)
+}
@@ -0,0 +1,279 @@
+package protocol
+
+/*
+The engine_cbf.go implements the consensus engine using counting Bloom
+filters. Each conode inserts the leaves of its HTML tree in an encrypted
+counting Bloom filter, the filters are aggregated up the tree and the
+aggregated filter is decrypted with the shared secret. The consensus page is
+the page of the root without the leaves seen by less than threshold conodes.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/proof/dleq"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/lib/canonhtml"
+)
+
+// NameCBFEngine is the name of the counting Bloom filter consensus engine
+const NameCBFEngine = "cbf"
+
+// engineTimeout is the maximal duration of each protocol run by an engine
+const engineTimeout = 24 * time.Hour
+
+func init() {
+	if err := RegisterConsensusEngine(&CBFEngine{}); err != nil {
+		panic(err)
+	}
+}
+
+// CBFEngine is the consensus engine using counting Bloom filters and
+// threshold decryption
+type CBFEngine struct{}
+
+// Name implements ConsensusEngine
+func (e *CBFEngine) Name() string {
+	return NameCBFEngine
+}
+
+// Run implements ConsensusEngine. It runs the ConsensusStructured protocol,
+// decrypts the aggregated Bloom filter and builds the consensus page.
+func (e *CBFEngine) Run(ctx *EngineContext) (*EngineResult, error) {
+	logger := ctx.Logger.With("engine", NameCBFEngine)
+
+	// run the consensus on the encrypted Bloom filters
+	instance, err := ctx.CreateProtocol(NameConsensusStructured, ctx.Tree)
+	if err != nil {
+		return nil, err
+	}
+	consensus := instance.(*ConsensusStructuredState)
+	consensus.RequestID = ctx.RequestID
+	consensus.Url = ctx.Url
+	consensus.Threshold = ctx.Threshold
+	consensus.FalsePositiveRate = ctx.FalsePositiveRate
+	if ctx.Configure != nil {
+		if err := ctx.Configure(consensus); err != nil {
+			return nil, err
+		}
+	}
+	if err := consensus.Start(); err != nil {
+		return nil, err
+	}
+	logger.Lvl4("Waiting for structured consensus")
+	select {
+	case ok := <-consensus.Finished:
+		if !ok {
+			return nil, decenarch.ErrConsensusThreshold
+		}
+	case <-time.After(engineTimeout):
+		consensus.Shutdown()
+		consensus.done()
+		return nil, errors.New("structuredConsensusProtocol timeout")
+	case <-ctx.Canceled:
+		consensus.Shutdown()
+		consensus.done()
+		return nil, decenarch.ErrSaveCanceled
+	}
+
+	// the page is archived under the URL a threshold of conodes reached
+	url, err := agreeOnRootURL(logger, consensus.Url, consensus.Redirections, ctx.Threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	// decrypt the aggregated Bloom filter
+	partials, proofs, evidence, err := e.decrypt(ctx, consensus.EncryptedCBFSet)
+	if err != nil {
+		return nil, err
+	}
+	logger.Lvl3("Decryption protocol is done")
+
+	// the leaves are listed before building the consensus page, which
+	// modifies the local tree
+	extractor, err := lib.GetLeafExtractor(consensus.Extractor)
+	if err != nil {
+		return nil, err
+	}
+	leaves := lib.ListLeaves(consensus.LocalTree, extractor)
+
+	// reconstruct the consensus page, excluding the faulty shares as long
+	// as enough shares remain
+	nodes := len(ctx.Tree.Roster.List)
+	reconstructed, err := lib.ReconstructVectorBounded(nodes, ctx.Threshold, ctx.MaxHomomorphicInt, partials)
+	for err != nil {
+		rerr, ok := err.(*decenarch.ReconstructionError)
+		if !ok || rerr.Conode < 0 || len(partials) <= ctx.Threshold {
+			return nil, err
+		}
+		logger.Lvl1("Excluding faulty share from the reconstruction", "share", rerr.Conode, "error", err)
+		delete(partials, rerr.Conode)
+		reconstructed, err = lib.ReconstructVectorBounded(nodes, ctx.Threshold, ctx.MaxHomomorphicInt, partials)
+	}
+	decryptionProofs := belowThresholdProofs(reconstructed, ctx.Threshold, partials, proofs)
+	consensusCBF, err := lib.BloomFilterFromSet(reconstructed, consensus.ParametersCBF)
+	if err != nil {
+		return nil, err
+	}
+	width := ctx.CounterWidth
+	if width == 0 {
+		width = lib.CounterWidth(nodes)
+	}
+	consensusCBF.Max = lib.CounterMax(width)
+	page, err := BuildConsensusPage(consensus.LocalTree, extractor, consensusCBF, ctx.Threshold)
+	if err != nil {
+		return nil, err
+	}
+	var divergence *decenarch.DivergenceSummary
+	if ctx.Diagnostics {
+		failed := failedConodes(consensus.Errs)
+		divergence = decenarch.NewDivergenceSummary(leaves, func(leaf string) int {
+			return int(consensusCBF.Count([]byte(leaf)))
+		}, ctx.Threshold, nodes-failed, failed)
+	}
+
+	return &EngineResult{
+		Url:              url,
+		ContentType:      consensus.ContentType,
+		Charset:          consensus.Charset,
+		Page:             page,
+		LocalTree:        consensus.LocalTree,
+		Blobs:            consensus.Blobs,
+		Leaves:           leaves,
+		SignProtocol:     NameSignStructured,
+		CompleteProofs:   consensus.CompleteProofs,
+		Partials:         partials,
+		DecryptionProofs: decryptionProofs,
+		DKGCommits:       ctx.Secret.Commits,
+		Threshold:        ctx.Threshold,
+		ConsensusSet:     reconstructed,
+		ParametersCBF:    consensus.ParametersCBF,
+		Redirections:     consensus.Redirections,
+		CertificateHash:  consensus.CertificateHash,
+		CertificateChain: consensus.CertificateChain,
+		Evidence:         append(consensus.Evidence, evidence...),
+		Errors:           consensus.Errs,
+		Divergence:       divergence,
+	}, nil
+}
+
+// decrypt runs the Decrypt protocol on the aggregated Bloom filter and returns
+// the partial decryptions of the conodes with their proofs, and the evidence
+// against the conodes that sent invalid partial decryptions
+func (e *CBFEngine) decrypt(ctx *EngineContext, set *lib.CipherVector) (map[int][]kyber.Point, map[int][]*dleq.Proof, []decenarch.Evidence, error) {
+	partials, proofs, evidence, err := e.decryptBatch(ctx, []*lib.CipherVector{set})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return partials[0], proofs[0], evidence, nil
+}
+
+// decryptBatch is decrypt for several aggregated Bloom filters, e.g. of the
+// pages of a batch save, decrypted in one round of the Decrypt protocol. The
+// partial decryptions and their proofs are returned for each filter.
+func (e *CBFEngine) decryptBatch(ctx *EngineContext, sets []*lib.CipherVector) ([]map[int][]kyber.Point, []map[int][]*dleq.Proof, []decenarch.Evidence, error) {
+	pi, err := ctx.CreateProtocol(NameDecrypt, ctx.Tree)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	p := pi.(*Decrypt)
+	p.RequestID = ctx.RequestID
+	p.SetBatch(sets)
+	p.Secret = ctx.Secret
+	p.Threshold = int32(ctx.Threshold)
+	p.Workers = ctx.Workers
+	if ctx.Configure != nil {
+		if err := ctx.Configure(p); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if err := p.Start(); err != nil {
+		return nil, nil, nil, err
+	}
+	select {
+	case ok := <-p.Finished:
+		if !ok {
+			return nil, nil, nil, errors.New("decrypt error, impossible to ge partials")
+		}
+	case <-ctx.Canceled:
+		p.finish(false)
+		return nil, nil, nil, decenarch.ErrSaveCanceled
+	}
+	partials, proofs := p.BatchPartials()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return partials, proofs, p.Evidence, nil
+}
+
+// belowThresholdProofs returns the proofs of the partial decryptions of the
+// buckets of set below threshold, by DKG share index, aligned with the buckets
+// given by lib.BelowThreshold, see lib.VerifyBelowThreshold. Only the shares
+// of partials are kept.
+func belowThresholdProofs(set []int64, threshold int, partials map[int][]kyber.Point, proofs map[int][]*dleq.Proof) map[int][]*dleq.Proof {
+	buckets := lib.BelowThreshold(set, threshold)
+	below := make(map[int][]*dleq.Proof, len(partials))
+	for j := range partials {
+		if len(proofs[j]) != len(set) {
+			continue
+		}
+		list := make([]*dleq.Proof, len(buckets))
+		for k, i := range buckets {
+			list[k] = proofs[j][i]
+		}
+		below[j] = list
+	}
+	return below
+}
+
+// BuildConsensusHtmlPage takes the tree of the root made of HTML nodes and
+// returns the consensus HTML page coming from the consensus HTML tree. Only
+// the leaves that appears in the combined Bloom filter at least threshold
+// times are included in the HTML page. All the other nodes are included by
+// the root. The tree is modified in place.
+func BuildConsensusHtmlPage(localTree *html.Node, CBF *lib.CBF, threshold int) ([]byte, error) {
+	extractor, _ := lib.GetLeafExtractor(lib.ExtractorText)
+	return BuildConsensusPage(localTree, extractor, CBF, threshold)
+}
+
+// BuildConsensusPage is BuildConsensusHtmlPage for the leaves given by the
+// extractor e. The tree must already be pruned by e.
+func BuildConsensusPage(localTree *html.Node, e lib.LeafExtractor, CBF *lib.CBF, threshold int) ([]byte, error) {
+	return buildPage(localTree, e, func(leaf string) bool {
+		return CBF.Count([]byte(leaf)) >= int64(threshold)
+	})
+}
+
+// buildPage removes from localTree the leaves given by e for which keep
+// returns false and renders the resulting HTML page in its canonical
+// serialization, see canonhtml.Render
+func buildPage(localTree *html.Node, e lib.LeafExtractor, keep func(leaf string) bool) ([]byte, error) {
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.FirstChild == nil { // it is a leaf
+			if !keep(e.Leaf(n)) {
+				n.Parent.RemoveChild(n)
+			}
+
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(localTree)
+
+	// convert *html.Nodes tree to an html page
+	var page bytes.Buffer
+	err := canonhtml.Render(&page, localTree)
+	if err != nil {
+		return nil, err
+	}
+
+	return page.Bytes(), nil
+}
@@ -0,0 +1,116 @@
+package protocol
+
+/*
+The engine_merkle.go implements the consensus engine using Merkle
+commitments, see consensus_merkle.go. It avoids the false positives of the
+counting Bloom filter, at the cost of sending the hashes of all the leaves to
+the root.
+*/
+
+import (
+	"errors"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// NameMerkleEngine is the name of the Merkle consensus engine
+const NameMerkleEngine = "merkle"
+
+func init() {
+	if err := RegisterConsensusEngine(&MerkleEngine{}); err != nil {
+		panic(err)
+	}
+}
+
+// MerkleEngine is the consensus engine using Merkle commitments and exact set
+// reconciliation
+type MerkleEngine struct{}
+
+// Name implements ConsensusEngine
+func (e *MerkleEngine) Name() string {
+	return NameMerkleEngine
+}
+
+// Run implements ConsensusEngine. It runs the ConsensusMerkle protocol and
+// builds the consensus page from the leaves committed by at least threshold
+// conodes.
+func (e *MerkleEngine) Run(ctx *EngineContext) (*EngineResult, error) {
+	logger := ctx.Logger.With("engine", NameMerkleEngine)
+
+	instance, err := ctx.CreateProtocol(NameConsensusMerkle, ctx.Tree)
+	if err != nil {
+		return nil, err
+	}
+	consensus := instance.(*ConsensusMerkleState)
+	consensus.RequestID = ctx.RequestID
+	consensus.Url = ctx.Url
+	consensus.Threshold = ctx.Threshold
+	if ctx.Configure != nil {
+		if err := ctx.Configure(consensus); err != nil {
+			return nil, err
+		}
+	}
+	if err := consensus.Start(); err != nil {
+		return nil, err
+	}
+	logger.Lvl4("Waiting for Merkle consensus")
+	select {
+	case <-consensus.Finished:
+	case <-time.After(engineTimeout):
+		consensus.Shutdown()
+		consensus.done()
+		return nil, errors.New("merkle consensus protocol timeout")
+	case <-ctx.Canceled:
+		consensus.Shutdown()
+		consensus.done()
+		return nil, decenarch.ErrSaveCanceled
+	}
+
+	// the page is archived under the URL a threshold of conodes reached
+	redirections := make([]Redirection, len(consensus.Commitments))
+	for i, c := range consensus.Commitments {
+		redirections[i] = c.Redirection()
+	}
+	url, err := agreeOnRootURL(logger, consensus.Url, redirections, ctx.Threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	// the leaves are listed by the protocol before building the consensus
+	// page, which modifies the local tree
+	extractor, err := lib.GetLeafExtractor(consensus.Extractor)
+	if err != nil {
+		return nil, err
+	}
+	page, err := buildPage(consensus.LocalTree, extractor, func(leaf string) bool {
+		return consensus.Consensus[string(lib.LeafHash(leaf))]
+	})
+	if err != nil {
+		return nil, err
+	}
+	var divergence *decenarch.DivergenceSummary
+	if ctx.Diagnostics {
+		counts, conodes := commitmentCounts(consensus.Commitments, consensus.publics())
+		divergence = decenarch.NewDivergenceSummary(consensus.Leaves, func(leaf string) int {
+			return counts[string(lib.LeafHash(leaf))]
+		}, ctx.Threshold, conodes, len(ctx.Tree.Roster.List)-conodes)
+	}
+
+	return &EngineResult{
+		Url:              url,
+		ContentType:      consensus.ContentType,
+		Charset:          consensus.Charset,
+		Page:             page,
+		LocalTree:        consensus.LocalTree,
+		Blobs:            consensus.Blobs,
+		Leaves:           consensus.Leaves,
+		Commitments:      consensus.Commitments,
+		Redirections:     redirections,
+		SignProtocol:     NameSignMerkle,
+		CertificateHash:  consensus.CertificateHash,
+		CertificateChain: consensus.CertificateChain,
+		Divergence:       divergence,
+	}, nil
+}
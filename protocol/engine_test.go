@@ -0,0 +1,34 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testEngine struct{}
+
+func (e *testEngine) Name() string { return "test" }
+
+func (e *testEngine) Run(ctx *EngineContext) (*EngineResult, error) {
+	return &EngineResult{Url: ctx.Url}, nil
+}
+
+func TestConsensusEngines(t *testing.T) {
+	// the CBF engine is the default one
+	e, err := GetConsensusEngine("")
+	require.Nil(t, err)
+	require.Equal(t, NameCBFEngine, e.Name())
+
+	_, err = GetConsensusEngine("test")
+	require.NotNil(t, err)
+
+	require.Nil(t, RegisterConsensusEngine(&testEngine{}))
+	require.NotNil(t, RegisterConsensusEngine(&testEngine{}))
+	e, err = GetConsensusEngine("test")
+	require.Nil(t, err)
+	res, err := e.Run(&EngineContext{Url: "http://example.com"})
+	require.Nil(t, err)
+	require.Equal(t, "http://example.com", res.Url)
+	require.Contains(t, ConsensusEngines(), "test")
+}
@@ -0,0 +1,254 @@
+package protocol
+
+/*
+The evidence.go defines the contributions embedded in the evidence of the
+misbehaviour of a conode, see decenarch.Evidence. The conodes sign their
+contributions to the structured consensus and to the decryption, so that the
+conode detecting an invalid contribution embeds it in the evidence, and any
+conode can check with VerifyEvidence that the accused conode did send it and
+that it is invalid before acting on the evidence. An unsigned contribution
+proves nothing against its sender, so no evidence is reported for it.
+*/
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/proof/dleq"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func init() {
+	network.RegisterMessages(StructuredContribution{}, DecryptContribution{})
+}
+
+// StructuredContribution is the contribution of a conode to the structured
+// consensus
+//    - PackedCBFSet is the encrypted CBF set aggregated by the conode, packed
+//      by lib.CipherVector.Pack
+//    - Proof is the complete proof of the conode
+//    - Signature is the schnorr signature of the conode on the digest of the
+//      contribution and of the request ID
+type StructuredContribution struct {
+	RequestID    string
+	PackedCBFSet []byte
+	Proof        *lib.CompleteProof
+	Signature    []byte
+}
+
+// digest returns the hash signed by the conode
+func (c *StructuredContribution) digest() []byte {
+	h := decenarch.Suite.Hash()
+	writeBytes(h, []byte("structured contribution"))
+	writeBytes(h, []byte(c.RequestID))
+	writeBytes(h, c.PackedCBFSet)
+	if c.Proof == nil {
+		return h.Sum(nil)
+	}
+	writeBytes(h, c.Proof.EncryptedBloomFilter)
+	writeBytes(h, c.Proof.EncryptedCBFSetSignature)
+	if c.Proof.CipherVectorProof != nil {
+		for _, p := range *c.Proof.CipherVectorProof {
+			writeMarshaler(h, p.PublicKey)
+			writeDLEQ(h, &p.Proof)
+		}
+	}
+	if a := c.Proof.AggregationProof; a != nil {
+		keys := make([]string, 0, len(a.Contributions))
+		for k := range a.Contributions {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeBytes(h, []byte(k))
+			writeBytes(h, a.Contributions[k])
+		}
+		writeBytes(h, a.Aggregation)
+		writeBytes(h, []byte(fmt.Sprint(a.Length)))
+	}
+	return h.Sum(nil)
+}
+
+// verifySignature returns an error if the contribution is not signed by the
+// conode of public key accused
+func (c *StructuredContribution) verifySignature(accused kyber.Point) error {
+	if err := schnorr.Verify(decenarch.Suite, accused, c.digest(), c.Signature); err != nil {
+		return fmt.Errorf("contribution not signed by the accused conode: %v", err)
+	}
+	return nil
+}
+
+// sign signs the contribution with the private key of the conode
+func (c *StructuredContribution) sign(private kyber.Scalar) error {
+	sig, err := schnorr.Sign(decenarch.Suite, private, c.digest())
+	if err != nil {
+		return err
+	}
+	c.Signature = sig
+	return nil
+}
+
+// verify returns whether the contribution is valid, or an error if it is not
+// signed by the conode of public key accused
+func (c *StructuredContribution) verify(ctx context.Context, accused kyber.Point) (bool, error) {
+	if err := c.verifySignature(accused); err != nil {
+		return false, err
+	}
+	_, err := verifyContribution(ctx, accused, c.PackedCBFSet, c.Proof)
+	return err == nil, nil
+}
+
+// DecryptContribution is the contribution of a conode to the decryption
+//    - PackedCBFSet is the encrypted CBF set decrypted by the conode, packed
+//      by lib.CipherVector.Pack
+//    - Partials, Proofs and PublicKeyShare are the partial decryptions sent
+//      by the conode, see SendPartial
+//    - Signature is the schnorr signature of the conode on the digest of the
+//      contribution and of the request ID
+type DecryptContribution struct {
+	RequestID      string
+	PackedCBFSet   []byte
+	Partials       []kyber.Point
+	Proofs         []*dleq.Proof
+	PublicKeyShare kyber.Point
+	Signature      []byte
+}
+
+// digest returns the hash signed by the conode
+func (c *DecryptContribution) digest() []byte {
+	h := decenarch.Suite.Hash()
+	writeBytes(h, []byte("decrypt contribution"))
+	writeBytes(h, []byte(c.RequestID))
+	writeBytes(h, c.PackedCBFSet)
+	for _, p := range c.Partials {
+		writeMarshaler(h, p)
+	}
+	for _, p := range c.Proofs {
+		writeDLEQ(h, p)
+	}
+	writeMarshaler(h, c.PublicKeyShare)
+	return h.Sum(nil)
+}
+
+// verifySignature returns an error if the contribution is not signed by the
+// conode of public key accused
+func (c *DecryptContribution) verifySignature(accused kyber.Point) error {
+	if err := schnorr.Verify(decenarch.Suite, accused, c.digest(), c.Signature); err != nil {
+		return fmt.Errorf("contribution not signed by the accused conode: %v", err)
+	}
+	return nil
+}
+
+// sign signs the contribution with the private key of the conode
+func (c *DecryptContribution) sign(private kyber.Scalar) error {
+	sig, err := schnorr.Sign(decenarch.Suite, private, c.digest())
+	if err != nil {
+		return err
+	}
+	c.Signature = sig
+	return nil
+}
+
+// verify returns whether the partial decryptions of the contribution are
+// valid, or an error if it is not signed by the conode of public key accused
+func (c *DecryptContribution) verify(accused kyber.Point) (bool, error) {
+	if err := c.verifySignature(accused); err != nil {
+		return false, err
+	}
+	set := new(lib.CipherVector)
+	if err := set.Unpack(c.PackedCBFSet); err != nil {
+		return false, fmt.Errorf("invalid encrypted CBF set: %v", err)
+	}
+	return verifyPartials(set, c.Partials, c.Proofs, c.PublicKeyShare) == nil, nil
+}
+
+// newContributionEvidence returns the evidence, signed with the key pair of
+// the reporter, that the conode of public key accused sent the invalid
+// contribution
+func newContributionEvidence(private kyber.Scalar, reporter kyber.Point, requestID string, accused kyber.Point, protocol string, reason error, contribution network.Message) (decenarch.Evidence, error) {
+	b, err := network.Marshal(contribution)
+	if err != nil {
+		return decenarch.Evidence{}, err
+	}
+	return lib.NewEvidence(private, reporter, requestID, accused, protocol, reason, b)
+}
+
+// VerifyEvidence returns an error if the evidence is not signed by its
+// reporter, see lib.VerifyEvidence, or if its contribution is not signed by
+// the accused conode or is valid. The public key share of a decryption is
+// not checked against the DKG, so that such a misbehaviour is not proven by
+// the evidence.
+func VerifyEvidence(e decenarch.Evidence, publics []kyber.Point) error {
+	if err := lib.VerifyEvidence(e, publics); err != nil {
+		return err
+	}
+	var accused kyber.Point
+	for _, p := range publics {
+		if p.String() == e.Accused {
+			accused = p
+		}
+	}
+	if accused == nil {
+		return errors.New("accused conode is not a conode of the roster")
+	}
+	if len(e.Contribution) == 0 {
+		return errors.New("evidence without contribution")
+	}
+	_, msg, err := network.Unmarshal(e.Contribution, decenarch.Suite)
+	if err != nil {
+		return fmt.Errorf("invalid contribution: %v", err)
+	}
+	var valid bool
+	switch c := msg.(type) {
+	case *StructuredContribution:
+		if c.RequestID != e.RequestID || e.Protocol != NameConsensusStructured {
+			return errors.New("contribution of another request or protocol")
+		}
+		valid, err = c.verify(context.Background(), accused)
+	case *DecryptContribution:
+		if c.RequestID != e.RequestID || e.Protocol != NameDecrypt {
+			return errors.New("contribution of another request or protocol")
+		}
+		valid, err = c.verify(accused)
+	default:
+		return errors.New("unknown contribution")
+	}
+	if err != nil {
+		return err
+	}
+	if valid {
+		return errors.New("the contribution of the accused conode is valid")
+	}
+	return nil
+}
+
+// writeMarshaler writes the length-prefixed binary encoding of m to h, empty
+// if m is nil
+func writeMarshaler(h hash.Hash, m encoding.BinaryMarshaler) {
+	var b []byte
+	if m != nil {
+		b, _ = m.MarshalBinary()
+	}
+	writeBytes(h, b)
+}
+
+// writeDLEQ writes the binary encoding of the proof to h
+func writeDLEQ(h hash.Hash, p *dleq.Proof) {
+	if p == nil {
+		writeBytes(h, nil)
+		return
+	}
+	writeMarshaler(h, p.C)
+	writeMarshaler(h, p.R)
+	writeMarshaler(h, p.VG)
+	writeMarshaler(h, p.VH)
+}
@@ -0,0 +1,70 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/proof/dleq"
+	"gopkg.in/dedis/kyber.v2/util/key"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func TestVerifyEvidence(t *testing.T) {
+	reporter := key.NewKeyPair(decenarch.Suite)
+	accused := key.NewKeyPair(decenarch.Suite)
+	publics := []kyber.Point{reporter.Public, accused.Public}
+	share := key.NewKeyPair(decenarch.Suite)
+	set, _ := lib.EncryptIntVector(share.Public, []int64{0, 1, 1})
+
+	// the partial decryptions of the accused conode, signed by it
+	contribution := func(corrupt bool) *DecryptContribution {
+		c := &DecryptContribution{
+			RequestID:      "request",
+			PackedCBFSet:   set.Pack(),
+			PublicKeyShare: share.Public,
+		}
+		for _, ct := range *set {
+			c.Partials = append(c.Partials, lib.DecryptPoint(share.Private, ct))
+			c.Proofs = append(c.Proofs, lib.ProvePartial(share.Private, ct))
+		}
+		if corrupt {
+			c.Partials[1] = decenarch.Suite.Point().Add(c.Partials[1], decenarch.Suite.Point().Base())
+		}
+		require.NoError(t, c.sign(accused.Private))
+		return c
+	}
+	evidence := func(c *DecryptContribution) decenarch.Evidence {
+		e, err := newContributionEvidence(reporter.Private, reporter.Public, "request", accused.Public, NameDecrypt, errors.New("invalid partials"), c)
+		require.NoError(t, err)
+		return e
+	}
+
+	corrupted := contribution(true)
+	require.NoError(t, VerifyEvidence(evidence(corrupted), publics))
+
+	// the valid partials of the accused conode prove nothing
+	require.Error(t, VerifyEvidence(evidence(contribution(false)), publics))
+
+	// the reporter cannot forge the partials of the accused conode
+	forged := *corrupted
+	forged.Proofs = append([]*dleq.Proof{}, corrupted.Proofs...)
+	forged.Proofs[0] = lib.ProvePartial(share.Private, (*set)[1])
+	require.Error(t, VerifyEvidence(evidence(&forged), publics))
+
+	// nor replay them for another request
+	forged = *corrupted
+	forged.RequestID = "other request"
+	require.Error(t, VerifyEvidence(evidence(&forged), publics))
+
+	// the evidence must be signed by its reporter and have a contribution
+	e := evidence(corrupted)
+	e.Reporter = accused.Public.String()
+	require.Error(t, VerifyEvidence(e, publics))
+	e, err := lib.NewEvidence(reporter.Private, reporter.Public, "request", accused.Public, NameDecrypt, errors.New("invalid partials"), nil)
+	require.NoError(t, err)
+	require.Error(t, VerifyEvidence(e, publics))
+}
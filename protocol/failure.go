@@ -0,0 +1,79 @@
+package protocol
+
+/*
+The failure.go defines the failures reported in the structured consensus. A
+conode that cannot fetch the page or refuses the request reports its failure
+to its parent, which forwards it to the root with the failures of its
+subtree. The failures are signed by the failing conodes for the save request,
+so that a parent cannot report an honest child as failed to change the number
+of fetched pages counted by the root. A child that doesn't reply in time has
+signed nothing, it simply doesn't contribute to the aggregation.
+*/
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+// Failure is the failure of a conode to fetch the page or to accept a save
+// request
+//    - Public is the key of the conode
+//    - Signature is the schnorr signature of the conode on the request ID
+type Failure struct {
+	Public    kyber.Point
+	Signature []byte
+}
+
+// NewFailure returns the failure of the conode of private, signed for the
+// save request requestID
+func NewFailure(requestID string, private kyber.Scalar) (*Failure, error) {
+	f := &Failure{Public: decenarch.Suite.Point().Mul(private, nil)}
+	sig, err := schnorr.Sign(decenarch.Suite, private, f.message(requestID))
+	if err != nil {
+		return nil, err
+	}
+	f.Signature = sig
+	return f, nil
+}
+
+// message returns the bytes signed by the conode
+func (f Failure) message(requestID string) []byte {
+	return []byte("failure\x00" + requestID)
+}
+
+// Verify checks that the failure comes from a conode of publics and is signed
+// by it for the save request requestID
+func (f Failure) Verify(requestID string, publics []kyber.Point) error {
+	if f.Public == nil || !hasKey(publics, f.Public) {
+		return errors.New("failure of a conode outside the roster")
+	}
+	if err := schnorr.Verify(decenarch.Suite, f.Public, f.message(requestID), f.Signature); err != nil {
+		return fmt.Errorf("invalid signature of the failure: %v", err)
+	}
+	return nil
+}
+
+// VerifiedFailures returns the failures signed for the save request requestID
+// by the conodes of publics, once per conode, and the errors of the others
+func VerifiedFailures(requestID string, failures []Failure, publics []kyber.Point) ([]Failure, []error) {
+	seen := make(map[string]bool)
+	var verified []Failure
+	var errs []error
+	for _, f := range failures {
+		if err := f.Verify(requestID, publics); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if seen[f.Public.String()] {
+			continue
+		}
+		seen[f.Public.String()] = true
+		verified = append(verified, f)
+	}
+	return verified, errs
+}
@@ -0,0 +1,38 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/util/key"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestVerifiedFailures(t *testing.T) {
+	a := key.NewKeyPair(decenarch.Suite)
+	b := key.NewKeyPair(decenarch.Suite)
+	outsider := key.NewKeyPair(decenarch.Suite)
+	publics := []kyber.Point{a.Public, b.Public}
+	fail := func(private kyber.Scalar, requestID string) Failure {
+		f, err := NewFailure(requestID, private)
+		require.NoError(t, err)
+		return *f
+	}
+
+	// a parent cannot report a failure of its child for another request
+	// or without the signature of the child
+	forged := Failure{Public: b.Public, Signature: fail(a.Private, "request").Signature}
+	failures := []Failure{
+		fail(a.Private, "request"),
+		fail(a.Private, "request"),
+		fail(b.Private, "other"),
+		fail(outsider.Private, "request"),
+		forged,
+	}
+	verified, errs := VerifiedFailures("request", failures, publics)
+	require.Len(t, verified, 1)
+	require.True(t, verified[0].Public.Equal(a.Public))
+	require.Len(t, errs, 3)
+}
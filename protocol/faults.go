@@ -0,0 +1,77 @@
+package protocol
+
+/*
+The faults.go defines the misbehaviours that can be injected in a conode to
+test that the protocols tolerate byzantine conodes, see the Byzantine
+simulation. A conode with faults still follows the protocols, but lies in
+one of the following ways:
+
+    - WrongFilter makes the conode contribute the complement of the Bloom
+      filter of its page, with a valid proof. The lie cannot be detected, the
+      leaves it adds are below the threshold as long as enough conodes are
+      honest
+    - InvalidProof makes the conode count the first bucket of its filter
+      twice, which its content proof cannot prove. The parent of the conode
+      rejects its contribution
+    - RefuseSignature makes the conode refuse to sign the consensus pages,
+      it is missing from the collective signatures
+    - CorruptPartials makes the conode send partial decryptions that don't
+      match their proofs. The root rejects them
+
+The conodes of a deployment never have faults.
+*/
+
+import (
+	"errors"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"gopkg.in/dedis/kyber.v2"
+)
+
+// Faults are the misbehaviours of a conode, see faults.go
+type Faults struct {
+	WrongFilter     bool
+	InvalidProof    bool
+	RefuseSignature bool
+	CorruptPartials bool
+}
+
+// lieOnFilter returns the set the conode contributes instead of set
+func (f *Faults) lieOnFilter(set []int64) []int64 {
+	if f == nil || (!f.WrongFilter && !f.InvalidProof) {
+		return set
+	}
+	lie := make([]int64, len(set))
+	copy(lie, set)
+	if f.WrongFilter {
+		for i := range lie {
+			lie[i] = 1 - lie[i]
+		}
+	}
+	if f.InvalidProof && len(lie) > 0 {
+		lie[0]++
+	}
+	return lie
+}
+
+// lieOnPartials corrupts the partial decryptions sent by the conode
+func (f *Faults) lieOnPartials(partials []kyber.Point) {
+	if f == nil || !f.CorruptPartials {
+		return
+	}
+	for i := range partials {
+		partials[i] = decenarch.Suite.Point().Add(partials[i], decenarch.Suite.Point().Base())
+	}
+}
+
+// Check returns the check of the consensus data done by the conode before
+// signing a consensus page, which refuses everything if the conode refuses to
+// sign
+func (f *Faults) Check(check ConsensusCheck) ConsensusCheck {
+	if f == nil || !f.RefuseSignature {
+		return check
+	}
+	return func(string, []byte, []byte) error {
+		return errors.New("byzantine conode refuses to sign")
+	}
+}
@@ -0,0 +1,341 @@
+package protocol
+
+/*
+The fetch.go defines how the conodes fetch the pages to archive. As every
+conode fetches the URL given by the client, the fetcher refuses the URLs that
+would make the conodes request their own network: only http and https are
+allowed, and the fetcher never connects to a loopback, private, link-local or
+otherwise reserved address. The host is resolved once and the connection is
+made to the checked address, so that a DNS answer changing between the check
+and the connection cannot bypass the protection.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	urlpkg "net/url"
+	"sync"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+// maxRedirects is the maximal number of redirections followed by a conode
+const maxRedirects = 10
+
+// fetchTimeout is the maximal duration of a single fetch
+const fetchTimeout = 30 * time.Second
+
+// URLChecker returns an error if the conode must not fetch the given URL. It
+// is called for the requested URL and for every redirection.
+type URLChecker func(u *urlpkg.URL) error
+
+// forbiddenNetworks are the networks the conodes never connect to when
+// fetching a page
+var forbiddenNetworks = mustParseCIDRs(
+	"0.0.0.0/8",      // "this" network
+	"10.0.0.0/8",     // private
+	"100.64.0.0/10",  // carrier-grade NAT
+	"127.0.0.0/8",    // loopback
+	"169.254.0.0/16", // link-local, cloud metadata
+	"172.16.0.0/12",  // private
+	"192.0.0.0/24",   // IETF protocol assignments
+	"192.168.0.0/16", // private
+	"198.18.0.0/15",  // benchmarking
+	"224.0.0.0/4",    // multicast
+	"240.0.0.0/4",    // reserved, broadcast
+	"::/128",         // unspecified
+	"::1/128",        // loopback
+	"64:ff9b::/96",   // IPv4/IPv6 translation
+	"fc00::/7",       // unique local
+	"fe80::/10",      // link-local
+	"ff00::/8",       // multicast
+)
+
+// ValidateURL returns an error if url cannot be fetched by a conode, either
+// because its scheme is not http or https or because its host is a forbidden
+// IP address. Host names are checked when they are resolved, see httpGet.
+func ValidateURL(u *urlpkg.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("refusing to fetch %s: scheme %q is not allowed", u, u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("refusing to fetch %s: no host", u)
+	}
+	if ip := net.ParseIP(host); ip != nil && forbiddenIP(ip) {
+		return fmt.Errorf("refusing to fetch %s: address %s is not public", u, ip)
+	}
+	return nil
+}
+
+// httpGet fetches url after validating it, and every redirection, with
+// ValidateURL and check. If check is nil, only ValidateURL is used.
+func httpGet(url string, check URLChecker) (*http.Response, error) {
+	return getWith(SafeTransport(), url, check, fetchTimeout)
+}
+
+// httpSend sends req as httpGet fetches an url
+func httpSend(req *http.Request, check URLChecker) (*http.Response, error) {
+	return sendWith(SafeTransport(), req, check, fetchTimeout)
+}
+
+// SafeTransport returns a transport refusing to connect to the host names
+// resolving to a forbidden IP address, for the requests of the conode to
+// addresses given by the clients
+func SafeTransport() *http.Transport {
+	return &http.Transport{
+		// never use a proxy, it would connect to the page for us
+		Proxy:               nil,
+		DialContext:         safeDialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+}
+
+// FetchOptions configure the fetcher of a conode, see NewHTTPFetcher
+//    - Timeout is the maximal duration of a fetch, zero for 30 seconds
+//    - Proxy is the URL of the HTTP proxy the pages are fetched through, nil
+//      to connect to the web sites directly. The proxy itself may have a
+//      private address
+//    - Politeness is the minimal delay between the start of two fetches to
+//      the same host, zero for no delay
+type FetchOptions struct {
+	Timeout    time.Duration
+	Proxy      *urlpkg.URL
+	Politeness time.Duration
+}
+
+// NewHTTPFetcher returns a fetcher of the conodes, fetching the pages from the
+// web as HTTPFetcher does, with the given options. Through a proxy, the host
+// names are resolved by the conode before the fetch, as the proxy connects
+// to the web sites for the conode.
+func NewHTTPFetcher(opts FetchOptions) Fetcher {
+	return GetFetcher(NewHTTPSender(opts))
+}
+
+// NewHTTPSender returns the sender of the conodes with the given options, see
+// NewHTTPFetcher
+func NewHTTPSender(opts FetchOptions) Sender {
+	transport := SafeTransport()
+	if opts.Proxy != nil {
+		proxyAddr := canonicalAddr(opts.Proxy)
+		transport.Proxy = http.ProxyURL(opts.Proxy)
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if addr == proxyAddr {
+				return (&net.Dialer{Timeout: 10 * time.Second}).DialContext(ctx, network, addr)
+			}
+			return safeDialContext(ctx, network, addr)
+		}
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = fetchTimeout
+	}
+	polite := newPoliteness(opts.Politeness)
+	return func(req *http.Request, check URLChecker) (*http.Response, error) {
+		return sendWith(transport, req, func(u *urlpkg.URL) error {
+			if check != nil {
+				if err := check(u); err != nil {
+					return err
+				}
+			}
+			if opts.Proxy != nil {
+				if err := checkResolved(u.Hostname()); err != nil {
+					return err
+				}
+			}
+			polite.wait(u.Hostname())
+			return nil
+		}, timeout)
+	}
+}
+
+// canonicalAddr returns the host:port address of u, with the default port of
+// its scheme if it has none
+func canonicalAddr(u *urlpkg.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// checkResolved returns an error if the host name resolves to a forbidden IP
+// address
+func checkResolved(host string) error {
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if forbiddenIP(ip) {
+			return fmt.Errorf("refusing to fetch %s: address %s is not public", host, ip)
+		}
+	}
+	return nil
+}
+
+// politeness delays the fetches to the same host
+type politeness struct {
+	sync.Mutex
+	delay time.Duration
+	next  map[string]time.Time
+}
+
+// newPoliteness returns a politeness delaying the fetches to the same host
+// by delay
+func newPoliteness(delay time.Duration) *politeness {
+	return &politeness{delay: delay, next: make(map[string]time.Time)}
+}
+
+// wait blocks until a fetch to host is allowed
+func (p *politeness) wait(host string) {
+	if p.delay <= 0 {
+		return
+	}
+	p.Lock()
+	now := time.Now()
+	start := p.next[host]
+	if start.Before(now) {
+		start = now
+	}
+	p.next[host] = start.Add(p.delay)
+	// forget the hosts that can be fetched again
+	for h, t := range p.next {
+		if t.Before(now) {
+			delete(p.next, h)
+		}
+	}
+	p.Unlock()
+	time.Sleep(start.Sub(now))
+}
+
+// getWith fetches url with transport as httpGet does, in at most timeout
+func getWith(transport http.RoundTripper, url string, check URLChecker, timeout time.Duration) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sendWith(transport, req, check, timeout)
+}
+
+// sendWith sends req with transport as httpSend does, in at most timeout
+func sendWith(transport http.RoundTripper, req *http.Request, check URLChecker, timeout time.Duration) (*http.Response, error) {
+	validate := func(u *urlpkg.URL) error {
+		if err := ValidateURL(u); err != nil {
+			return err
+		}
+		if check != nil {
+			return check(u)
+		}
+		return nil
+	}
+	if err := validate(req.URL); err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("stopped after too many redirects")
+			}
+			return validate(req.URL)
+		},
+	}
+	return client.Do(req)
+}
+
+// readBody reads the body of resp, fetched from url. If limit is positive and
+// the body is larger than limit bytes, a decenarch.SizeError is returned
+// without reading more than limit+1 bytes.
+func readBody(resp *http.Response, url string, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return ioutil.ReadAll(resp.Body)
+	}
+	if resp.ContentLength > limit {
+		return nil, &decenarch.SizeError{URL: url, Limit: limit}
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, &decenarch.SizeError{URL: url, Limit: limit}
+	}
+	return data, nil
+}
+
+// checkSize returns a decenarch.SizeError if limit is positive and data is
+// larger than limit bytes
+func checkSize(data []byte, url string, limit int64) error {
+	if limit > 0 && int64(len(data)) > limit {
+		return &decenarch.SizeError{URL: url, Limit: limit}
+	}
+	return nil
+}
+
+// safeDialContext resolves the host of addr and connects to the first of its
+// public addresses. The connection is made to the resolved IP so that the
+// address checked is the address used.
+func safeDialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var dialErr error
+	for _, ip := range ips {
+		if forbiddenIP(ip.IP) {
+			dialErr = fmt.Errorf("refusing to connect to %s: address %s is not public", host, ip.IP)
+			continue
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.IP.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		dialErr = err
+	}
+	if dialErr == nil {
+		dialErr = fmt.Errorf("no address found for %s", host)
+	}
+	return nil, dialErr
+}
+
+// forbiddenIP returns true if ip is not a public unicast address
+func forbiddenIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, n := range forbiddenNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// mustParseCIDRs parses the given networks and panics on error
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
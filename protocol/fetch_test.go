@@ -0,0 +1,129 @@
+package protocol
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	urlpkg "net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestValidateURL(t *testing.T) {
+	refused := []string{
+		"file:///etc/passwd",
+		"gopher://example.com/",
+		"http://127.0.0.1:8000/admin",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.1.2.3/",
+		"http://192.168.1.1/",
+		"http://[::1]/",
+		"http://[fe80::1]/",
+		"http://[::ffff:127.0.0.1]/",
+		"http:///nohost",
+	}
+	for _, s := range refused {
+		u, err := urlpkg.Parse(s)
+		require.Nil(t, err)
+		require.NotNil(t, ValidateURL(u), s)
+	}
+
+	accepted := []string{
+		"http://example.com/",
+		"https://dedis.epfl.ch/index.html",
+		"http://93.184.216.34/",
+		"http://[2001:db8::1]/",
+	}
+	for _, s := range accepted {
+		u, err := urlpkg.Parse(s)
+		require.Nil(t, err)
+		require.Nil(t, ValidateURL(u), s)
+	}
+}
+
+func TestForbiddenIP(t *testing.T) {
+	require.True(t, forbiddenIP(net.ParseIP("127.0.0.1")))
+	require.True(t, forbiddenIP(net.ParseIP("172.16.0.1")))
+	require.True(t, forbiddenIP(net.ParseIP("0.0.0.0")))
+	require.True(t, forbiddenIP(net.ParseIP("fd00::1")))
+	require.False(t, forbiddenIP(net.ParseIP("8.8.8.8")))
+	require.False(t, forbiddenIP(net.ParseIP("2a00:1450::1")))
+}
+
+func TestHTTPGetRefusesLocalhost(t *testing.T) {
+	_, err := httpGet("http://localhost:1/", nil)
+	require.NotNil(t, err)
+
+	// the proxy may be private, the fetched hosts may not
+	proxy, err := urlpkg.Parse("http://127.0.0.1:3128")
+	require.Nil(t, err)
+	fetch := NewHTTPFetcher(FetchOptions{Proxy: proxy})
+	_, err = fetch("http://localhost:1/", nil)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "not public")
+}
+
+func TestCanonicalAddr(t *testing.T) {
+	for raw, addr := range map[string]string{
+		"http://proxy.example":  "proxy.example:80",
+		"https://proxy.example": "proxy.example:443",
+		"http://127.0.0.1:3128": "127.0.0.1:3128",
+		"http://[::1]:3128/":    "[::1]:3128",
+	} {
+		u, err := urlpkg.Parse(raw)
+		require.Nil(t, err)
+		require.Equal(t, addr, canonicalAddr(u))
+	}
+}
+
+func TestPoliteness(t *testing.T) {
+	p := newPoliteness(50 * time.Millisecond)
+	start := time.Now()
+	p.wait("example.com")
+	p.wait("example.org")
+	require.True(t, time.Since(start) < 50*time.Millisecond)
+	p.wait("example.com")
+	require.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	// no delay
+	p = newPoliteness(0)
+	start = time.Now()
+	p.wait("example.com")
+	p.wait("example.com")
+	require.True(t, time.Since(start) < 50*time.Millisecond)
+}
+
+func TestReadBody(t *testing.T) {
+	newResp := func(data []byte, length int64) *http.Response {
+		return &http.Response{
+			Body:          ioutil.NopCloser(bytes.NewReader(data)),
+			ContentLength: length,
+		}
+	}
+	data := make([]byte, 100)
+
+	// no limit
+	read, err := readBody(newResp(data, -1), "http://example.com", 0)
+	require.Nil(t, err)
+	require.Equal(t, data, read)
+
+	// under the limit
+	read, err = readBody(newResp(data, -1), "http://example.com", 100)
+	require.Nil(t, err)
+	require.Equal(t, data, read)
+
+	// over the limit, with and without Content-Length
+	_, err = readBody(newResp(data, -1), "http://example.com", 99)
+	require.IsType(t, &decenarch.SizeError{}, err)
+	require.Contains(t, err.Error(), "http://example.com")
+	_, err = readBody(newResp(nil, 1000), "http://example.com", 99)
+	require.IsType(t, &decenarch.SizeError{}, err)
+
+	require.Nil(t, checkSize(data, "http://example.com", 0))
+	require.NotNil(t, checkSize(data, "http://example.com", 10))
+}
@@ -0,0 +1,115 @@
+package protocol
+
+/*
+The hooks.go defines the injection points of the protocols: the fetcher of the
+pages, the sender of the requests replayed from a template, and the clock. The conodes use the defaults, the tests replace them to
+run the whole save pipeline against a server started by the test, with frozen
+timestamps, instead of a live web site.
+*/
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Fetcher fetches url for a conode. The url and all its redirections must be
+// checked with check, that can be nil
+type Fetcher func(url string, check URLChecker) (*http.Response, error)
+
+// Sender sends req for a conode, as Fetcher does for the GET requests. It is
+// used for the requests replayed from a template, see RequestTemplate
+type Sender func(req *http.Request, check URLChecker) (*http.Response, error)
+
+// Clock returns the current time
+type Clock func() time.Time
+
+// Now is the clock of the verification functions of the signing protocols,
+// which are registered once for all the conodes of the process
+var Now Clock = time.Now
+
+// HTTPFetcher is the fetcher of the conodes, fetching the pages from the web
+func HTTPFetcher(url string, check URLChecker) (*http.Response, error) {
+	return httpGet(url, check)
+}
+
+// HTTPSender is the sender of the conodes, see HTTPFetcher
+func HTTPSender(req *http.Request, check URLChecker) (*http.Response, error) {
+	return httpSend(req, check)
+}
+
+// fetcher returns f, or the fetcher of the conodes, see httpGet, if f is nil
+func fetcher(f Fetcher) Fetcher {
+	if f == nil {
+		return httpGet
+	}
+	return f
+}
+
+// sender returns s, or the sender of the conodes, see httpSend, if s is nil
+func sender(s Sender) Sender {
+	if s == nil {
+		return httpSend
+	}
+	return s
+}
+
+// GetFetcher returns the fetcher sending GET requests with send
+func GetFetcher(send Sender) Fetcher {
+	return func(url string, check URLChecker) (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		return send(req, check)
+	}
+}
+
+// HeaderSender returns the sender setting the headers on the requests sent
+// with send, except the headers already set, e.g. by a request template. It
+// returns send if there are no headers.
+func HeaderSender(send Sender, headers map[string]string) Sender {
+	if len(headers) == 0 {
+		return send
+	}
+	return func(req *http.Request, check URLChecker) (*http.Response, error) {
+		for name, value := range headers {
+			if req.Header.Get(name) == "" {
+				req.Header.Set(name, value)
+			}
+		}
+		return send(req, check)
+	}
+}
+
+// HeaderFetcher returns the fetcher sending GET requests with the headers
+// with send, see HeaderSender. It returns fetch if there are no headers.
+func HeaderFetcher(fetch Fetcher, send Sender, headers map[string]string) Fetcher {
+	if len(headers) == 0 {
+		return fetch
+	}
+	return GetFetcher(HeaderSender(send, headers))
+}
+
+// LocalFetcher returns a fetcher connecting to addr, e.g. the address of a
+// server started with net/http/httptest, whatever the host of the URLs. The
+// URLs are checked as the fetcher of the conodes does, so the tests can save
+// the pages of any public domain name without network access. It must not be
+// used by the conodes.
+func LocalFetcher(addr string) Fetcher {
+	return GetFetcher(LocalSender(addr))
+}
+
+// LocalSender returns the sender connecting to addr, see LocalFetcher
+func LocalSender(addr string) Sender {
+	transport := &http.Transport{
+		Proxy: nil,
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+	return func(req *http.Request, check URLChecker) (*http.Response, error) {
+		return sendWith(transport, req, check, fetchTimeout)
+	}
+}
@@ -0,0 +1,77 @@
+package protocol
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	urlpkg "net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalFetcher(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusFound)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	fetch := LocalFetcher(server.Listener.Addr().String())
+
+	// the fetcher of the conodes refuses the local server
+	_, err := fetcher(nil)(server.URL+"/new", nil)
+	require.NotNil(t, err)
+
+	// any host is served by the local server
+	resp, err := fetch("http://example.com/old", nil)
+	require.Nil(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err)
+	require.Equal(t, "example.com", string(body))
+	require.Equal(t, []string{"http://example.com/old", "http://example.com/new"}, redirectChain(resp))
+
+	// the URLs and the redirections are checked
+	_, err = fetch(server.URL+"/new", nil)
+	require.NotNil(t, err)
+	refuseNew := func(u *urlpkg.URL) error {
+		if u.Path == "/new" {
+			return errors.New("refused")
+		}
+		return nil
+	}
+	_, err = fetch("http://example.com/old", refuseNew)
+	require.NotNil(t, err)
+}
+
+func TestHeaderFetcher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("User-Agent") + " " + r.Header.Get("Accept-Language")))
+	}))
+	defer server.Close()
+	send := LocalSender(server.Listener.Addr().String())
+	fetch := LocalFetcher(server.Listener.Addr().String())
+	body := func(resp *http.Response, err error) string {
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		require.Nil(t, err)
+		return string(b)
+	}
+	headers := map[string]string{"User-Agent": "archiver", "Accept-Language": "fr"}
+
+	// the fetcher is unchanged without headers
+	require.Contains(t, body(HeaderFetcher(fetch, send, nil)("http://example.com/", nil)), "Go-http-client")
+	require.Equal(t, "archiver fr", body(HeaderFetcher(fetch, send, headers)("http://example.com/", nil)))
+
+	// the headers of a request template are kept
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	require.Nil(t, err)
+	req.Header.Set("Accept-Language", "de")
+	require.Equal(t, "archiver de", body(HeaderSender(send, headers)(req, nil)))
+}
@@ -0,0 +1,199 @@
+package protocol
+
+/*
+The inline.go defines the extraction of the large inline blobs of a page, the
+data URIs and the content of the script and style elements, before the leaves
+of the page are listed. A blob would otherwise be a single huge leaf, or bloat
+the page signed by the conodes. Each blob is replaced by a placeholder holding
+the hash of its content, so the conodes agree on the placeholder as on any
+other leaf, and the blob itself is archived as an additional resource of the
+page, whose URL is the placeholder.
+*/
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+
+	urlpkg "net/url"
+
+	"golang.org/x/net/html"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+const (
+	// InlinePrefix starts the placeholders of the inline blobs
+	InlinePrefix = "decenarch-inline:"
+	// inlineMinSize is the minimal size in bytes of an extracted blob, the
+	// smaller blobs stay in the page
+	inlineMinSize = 1024
+	// maxInlineBlobs is the maximal number of blobs extracted from a page
+	maxInlineBlobs = 64
+)
+
+// InlineBlob is a blob extracted from a page
+//    - Placeholder replaces the blob in the page
+//    - ContentType is the MIME type of the blob
+//    - Data is the content of the blob
+type InlineBlob struct {
+	Placeholder string
+	ContentType string
+	Data        []byte
+}
+
+// IsInline returns true if url is the placeholder of an inline blob
+func IsInline(url string) bool {
+	return strings.HasPrefix(url, InlinePrefix)
+}
+
+// extractInline replaces the large inline blobs of the tree rooted at root by
+// their placeholder, and returns the blobs in the order of the document. The
+// same blob appearing several times is returned once.
+func extractInline(root *html.Node) []InlineBlob {
+	var blobs []InlineBlob
+	extracted := make(map[string]bool)
+	extract := func(contentType string, data []byte) (string, bool) {
+		placeholder := InlinePrefix + lib.ContentHash(data)
+		if !extracted[placeholder] {
+			if len(blobs) >= maxInlineBlobs {
+				return "", false
+			}
+			extracted[placeholder] = true
+			blobs = append(blobs, InlineBlob{Placeholder: placeholder, ContentType: contentType, Data: data})
+		}
+		return placeholder, true
+	}
+
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for i, a := range n.Attr {
+				if len(a.Val) < inlineMinSize {
+					continue
+				}
+				contentType, data, ok := parseDataURI(a.Val)
+				if !ok {
+					continue
+				}
+				if placeholder, ok := extract(contentType, data); ok {
+					n.Attr[i].Val = placeholder
+				}
+			}
+			if contentType := inlineContentType(n); contentType != "" {
+				c := n.FirstChild
+				if c != nil && c.NextSibling == nil && c.Type == html.TextNode && len(c.Data) >= inlineMinSize {
+					if placeholder, ok := extract(contentType, []byte(c.Data)); ok {
+						c.Data = placeholder
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(root)
+	return blobs
+}
+
+// inlineContentType returns the MIME type of the content of the script and
+// style elements, empty for the other elements
+func inlineContentType(n *html.Node) string {
+	switch n.Data {
+	case "style":
+		return "text/css; charset=utf-8"
+	case "script":
+		for _, a := range n.Attr {
+			if a.Key == "src" {
+				return ""
+			}
+		}
+		return "text/javascript; charset=utf-8"
+	}
+	return ""
+}
+
+// parseDataURI returns the MIME type and the content of the data URI uri,
+// false if uri is not a valid data URI
+func parseDataURI(uri string) (string, []byte, bool) {
+	if len(uri) < 5 || !strings.EqualFold(uri[:5], "data:") {
+		return "", nil, false
+	}
+	comma := strings.IndexByte(uri, ',')
+	if comma < 0 {
+		return "", nil, false
+	}
+	header, payload := uri[5:comma], uri[comma+1:]
+	encoded := false
+	if strings.HasSuffix(strings.ToLower(header), ";base64") {
+		encoded = true
+		header = header[:len(header)-len(";base64")]
+	}
+	if header == "" {
+		header = "text/plain;charset=US-ASCII"
+	}
+	var data []byte
+	if encoded {
+		d, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(payload), ""))
+		if err != nil {
+			return "", nil, false
+		}
+		data = d
+	} else {
+		d, err := urlpkg.PathUnescape(payload)
+		if err != nil {
+			return "", nil, false
+		}
+		data = []byte(d)
+	}
+	return header, data, true
+}
+
+// RestoreInline puts back in page the blobs found in resources, the
+// additional resources archived with the page. The placeholders of the
+// attributes are replaced by data URIs and the ones of the script and style
+// elements by the content of the blobs. The page is returned unchanged if it
+// has no placeholder.
+func RestoreInline(page []byte, resources []decenarch.Webstore) ([]byte, error) {
+	blobs := make(map[string]decenarch.Webstore)
+	for _, r := range resources {
+		if IsInline(r.Url) {
+			blobs[r.Url] = r
+		}
+	}
+	if len(blobs) == 0 || !bytes.Contains(page, []byte(InlinePrefix)) {
+		return page, nil
+	}
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		switch n.Type {
+		case html.ElementNode:
+			for i, a := range n.Attr {
+				if r, ok := blobs[a.Val]; ok {
+					n.Attr[i].Val = "data:" + r.ContentType + ";base64," + r.Page
+				}
+			}
+		case html.TextNode:
+			if r, ok := blobs[n.Data]; ok && n.Parent != nil && inlineContentType(n.Parent) != "" {
+				if data, err := base64.StdEncoding.DecodeString(r.Page); err == nil {
+					n.Data = string(data)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+	var b bytes.Buffer
+	if err := html.Render(&b, doc); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
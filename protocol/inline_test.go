@@ -0,0 +1,80 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+
+	"github.com/stretchr/testify/require"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func TestExtractInline(t *testing.T) {
+	script := "var a = '" + strings.Repeat("a", inlineMinSize) + "';"
+	image := bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, inlineMinSize)
+	dataURI := "data:image/png;base64," + base64.StdEncoding.EncodeToString(image)
+	page := "<html><head><style>p { color: red; }</style><script>" + script + "</script></head>" +
+		"<body><img src=\"" + dataURI + "\"><img src=\"" + dataURI + "\"><p>text</p>" +
+		"<script src=\"/a.js\"></script></body></html>"
+	tree, err := html.Parse(strings.NewReader(page))
+	require.Nil(t, err)
+
+	blobs := extractInline(tree)
+	require.Equal(t, 2, len(blobs))
+	require.Equal(t, InlinePrefix+lib.ContentHash([]byte(script)), blobs[0].Placeholder)
+	require.Equal(t, "text/javascript; charset=utf-8", blobs[0].ContentType)
+	require.Equal(t, []byte(script), blobs[0].Data)
+	require.Equal(t, "image/png", blobs[1].ContentType)
+	require.Equal(t, image, blobs[1].Data)
+
+	// the small style stays in the page, the blobs are replaced by their
+	// placeholder
+	leaves := lib.ListUniqueDataLeaves(tree)
+	require.Contains(t, leaves, "p { color: red; }")
+	require.Contains(t, leaves, blobs[0].Placeholder)
+	var b bytes.Buffer
+	require.Nil(t, html.Render(&b, tree))
+	require.Equal(t, 2, strings.Count(b.String(), blobs[1].Placeholder))
+	require.False(t, strings.Contains(b.String(), "data:"))
+
+	// the blobs are put back from the archived resources
+	var adds []decenarch.Webstore
+	for _, blob := range blobs {
+		adds = append(adds, decenarch.Webstore{
+			Url:         blob.Placeholder,
+			ContentType: blob.ContentType,
+			Page:        base64.StdEncoding.EncodeToString(blob.Data),
+		})
+	}
+	restored, err := RestoreInline(b.Bytes(), adds)
+	require.Nil(t, err)
+	require.True(t, strings.Contains(string(restored), "<script>"+script+"</script>"))
+	require.Equal(t, 2, strings.Count(string(restored), dataURI))
+	require.False(t, strings.Contains(string(restored), InlinePrefix))
+
+	unchanged, err := RestoreInline([]byte(page), adds)
+	require.Nil(t, err)
+	require.Equal(t, page, string(unchanged))
+}
+
+func TestParseDataURI(t *testing.T) {
+	ct, data, ok := parseDataURI("data:text/plain;charset=utf-8,hello%20world")
+	require.True(t, ok)
+	require.Equal(t, "text/plain;charset=utf-8", ct)
+	require.Equal(t, []byte("hello world"), data)
+
+	ct, data, ok = parseDataURI("DATA:;base64,aGVs\nbG8=")
+	require.True(t, ok)
+	require.Equal(t, "text/plain;charset=US-ASCII", ct)
+	require.Equal(t, []byte("hello"), data)
+
+	for _, uri := range []string{"https://example.com/a.png", "data:image/png;base64", "data:image/png;base64,!!"} {
+		_, _, ok := parseDataURI(uri)
+		require.False(t, ok, uri)
+	}
+}
@@ -0,0 +1,103 @@
+package protocol
+
+/*
+The links.go defines the list of the additional resources of a page, i.e. its
+CSS files and images, archived after the page by the unstructured consensus.
+The list is extracted from the consensus page and is part of the consensus
+data signed by the root, so that every conode checks, before signing the
+page, that the root will archive all the resources of the page, see
+CheckPageLinks.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"golang.org/x/net/html"
+
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// ExtractPageLinks returns the links to the additional resources of the HTML
+// page, resolved against pageURL. The inline blobs are skipped, they are
+// archived apart, see InlineBlob. If normalizer is not nil, the links are
+// given in their canonical form, without duplicates.
+func ExtractPageLinks(pageURL string, page []byte, normalizer *lib.URLNormalizer) []string {
+	var links []string
+	// parse page to extract links
+	tokensPage := html.NewTokenizer(bytes.NewReader(page))
+	for tok := tokensPage.Next(); tok != html.ErrorToken; tok = tokensPage.Next() {
+		tagName, _ := tokensPage.TagName()
+		// extract attribute
+		attributeMap := make(map[string]string)
+		for moreAttr := true; moreAttr; {
+			attrKey, attrValue, isMore := tokensPage.TagAttr()
+			moreAttr = isMore
+			attributeMap[string(attrKey)] = string(attrValue)
+		}
+		// check for relevant ressources, i.e. CSS file and/or images
+		if tok == html.StartTagToken || tok == html.SelfClosingTagToken {
+			if string(tagName) == "link" && attributeMap["rel"] == "stylesheet" {
+				links = append(links, attributeMap["href"])
+			} else if string(tagName) == "img" {
+				links = append(links, attributeMap["src"])
+			}
+		}
+	}
+	// turns found links into web-requestable links
+	requestLinks := make([]string, 0)
+	urlStruct, err := url.Parse(pageURL)
+	if err != nil {
+		return make([]string, 0)
+	}
+	for _, link := range links {
+		if IsInline(link) {
+			continue
+		}
+		urlS, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		if urlS.IsAbs() {
+			requestLinks = append(requestLinks, link)
+		} else if reqLink, err := urlStruct.Parse(link); err == nil {
+			requestLinks = append(requestLinks, reqLink.String())
+		}
+	}
+	if normalizer == nil {
+		return requestLinks
+	}
+	normalized := make([]string, 0, len(requestLinks))
+	seen := make(map[string]bool)
+	for _, link := range requestLinks {
+		if n, err := normalizer.Normalize(link); err == nil {
+			link = n
+		}
+		if !seen[link] {
+			seen[link] = true
+			normalized = append(normalized, link)
+		}
+	}
+	return normalized
+}
+
+// CheckPageLinks returns an error if adds is not the list of the additional
+// resources of the page at pageURL, see ExtractPageLinks. It is called by the
+// conodes before signing a page, with the list signed by the root.
+func CheckPageLinks(pageURL string, page []byte, adds []string, normalizer *lib.URLNormalizer) error {
+	if pageURL == "" {
+		return errors.New("no URL given for the list of the additional resources")
+	}
+	links := ExtractPageLinks(pageURL, page, normalizer)
+	if len(links) != len(adds) {
+		return fmt.Errorf("the page has %d additional resources, %d are listed", len(links), len(adds))
+	}
+	for i := range links {
+		if links[i] != adds[i] {
+			return fmt.Errorf("additional resource %s of the page not listed", links[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func TestCheckPageLinks(t *testing.T) {
+	page := []byte(`<html><head><link rel="stylesheet" href="/main.css?utm_source=feed"></head>
+<body><img src="img/a.png"><img src="decenarch-inline:00"></body></html>`)
+	normalizer := lib.NewURLNormalizer(lib.DefaultStripParams)
+	adds := ExtractPageLinks("http://example.com/blog/", page, normalizer)
+	require.Equal(t, []string{"http://example.com/main.css", "http://example.com/blog/img/a.png"}, adds)
+	require.Nil(t, CheckPageLinks("http://example.com/blog/", page, adds, normalizer))
+
+	// a root omitting, adding or changing a resource is caught
+	require.NotNil(t, CheckPageLinks("http://example.com/blog/", page, adds[:1], normalizer))
+	require.NotNil(t, CheckPageLinks("http://example.com/blog/", page, append(adds, "http://example.com/b.png"), normalizer))
+	require.NotNil(t, CheckPageLinks("http://example.com/blog/", page, []string{adds[0], "http://example.com/b.png"}, normalizer))
+	require.NotNil(t, CheckPageLinks("", page, adds, normalizer))
+
+	// the list is part of the signed digest
+	d := ConsensusDigest("id", nil, nil, nil, nil, "http://example.com/blog/", adds)
+	require.NotEqual(t, d, ConsensusDigest("id", nil, nil, nil, nil, "http://example.com/blog/", adds[:1]))
+}
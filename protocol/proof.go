@@ -0,0 +1,55 @@
+package protocol
+
+/*
+The proof.go builds the transcript of a consensus sent to the clients asking
+for it with their save request, see the package transcript, which the clients
+decode without depending on the protocols.
+*/
+
+import (
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/lib/transcript"
+)
+
+// ConsensusProof is the transcript of a consensus, see
+// transcript.ConsensusProof
+type ConsensusProof = transcript.ConsensusProof
+
+// NewConsensusProof returns the transcript of the consensus of the result
+func NewConsensusProof(r *EngineResult) *ConsensusProof {
+	p := &ConsensusProof{
+		SignProtocol:   r.SignProtocol,
+		CompleteProofs: r.CompleteProofs,
+		Partials:       make(map[int][]byte),
+		ConsensusSet:   r.ConsensusSet,
+		Url:            r.Url,
+		Threshold:      r.Threshold,
+	}
+	for _, c := range r.Commitments {
+		p.Commitments = append(p.Commitments, transcript.Commitment{
+			Public:          c.Public,
+			Hashes:          c.Hashes,
+			Root:            c.Root,
+			CertificateHash: c.CertificateHash,
+			Redirects:       c.Redirects,
+			Signature:       c.Signature,
+		})
+	}
+	for _, r := range r.Redirections {
+		p.Redirections = append(p.Redirections, transcript.Redirection{Public: r.Public, Chain: r.Chain, Signature: r.Signature})
+	}
+	for k, partial := range r.Partials {
+		p.Partials[k] = lib.AbstractPointsToBytes(partial)
+	}
+	if len(r.DecryptionProofs) > 0 {
+		p.DKGCommits = lib.AbstractPointsToBytes(r.DKGCommits)
+		p.DecryptionProofs = make(map[int][]byte, len(r.DecryptionProofs))
+		for k, proofs := range r.DecryptionProofs {
+			p.DecryptionProofs[k] = lib.DLEQProofsToBytes(proofs)
+		}
+	}
+	if len(r.ParametersCBF) > 0 {
+		p.ConsensusParameters = lib.ParametersToSend(r.ParametersCBF)
+	}
+	return p
+}
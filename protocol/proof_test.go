@@ -0,0 +1,46 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestConsensusProof(t *testing.T) {
+	public := key.NewKeyPair(decenarch.Suite).Public
+	result := &EngineResult{
+		SignProtocol:  NameSignMerkle,
+		Partials:      map[int][]kyber.Point{1: {public}},
+		ConsensusSet:  []int64{1, 0, 2},
+		ParametersCBF: []uint{3, 2},
+		Commitments:   []MerkleCommitment{{Public: public, Root: []byte("root")}},
+	}
+	proof := NewConsensusProof(result)
+	require.Equal(t, []uint64{3, 2}, proof.ConsensusParameters)
+	require.Len(t, proof.Partials, 1)
+
+	// the proof is sent to the client with the save response
+	raw, err := network.Marshal(proof)
+	require.NoError(t, err)
+	_, msg, err := network.Unmarshal(raw, decenarch.Suite)
+	require.NoError(t, err)
+	decoded := msg.(*ConsensusProof)
+	require.Equal(t, proof.ConsensusSet, decoded.ConsensusSet)
+	require.True(t, decoded.Commitments[0].Public.Equal(public))
+
+	// partial decryptions without their proofs don't prove the dropped
+	// leaves
+	require.NotNil(t, decoded.VerifyBelowThreshold())
+
+	// the points are readable in the JSON transcript
+	b, err := json.Marshal(decoded)
+	require.NoError(t, err)
+	require.Contains(t, string(b), public.String())
+	require.Contains(t, string(b), NameSignMerkle)
+}
@@ -0,0 +1,130 @@
+package protocol
+
+/*
+The proofstore.go defines the store of the complete proofs of the structured
+consensus, addressed by the request ID of the save and their digest. The complete proofs hold the encrypted
+filter of every conode, and the root broadcasts them to all the conodes at the
+end of the consensus, so the verification data of the signing protocol only
+carries their digest, see VerificationData, and the size of the signing
+messages doesn't grow with the square of the size of the roster. The conodes
+store the proofs they received before signing, and the verification function
+resolves the digest from the proofs stored for the same save, so that the
+proofs of a save are never used to verify another one.
+*/
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/dedis/onet.v2/network"
+
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// proofStoreTTL is the time after which the proofs are dropped from the store
+const proofStoreTTL = time.Hour
+
+func init() {
+	// only used to marshal the proofs for their digest
+	network.RegisterMessage(&proofEntry{})
+}
+
+// proofEntry is the proof of a conode, marshaled for the digest. The
+// contributions of the aggregation proof are hashed apart, in the order of
+// their keys.
+type proofEntry struct {
+	Conode string
+	Proof  *lib.CompleteProof
+}
+
+// storedProofs are the proofs of the store, their digest and the time they
+// were stored at
+type storedProofs struct {
+	proofs lib.CompleteProofs
+	digest []byte
+	stored time.Time
+}
+
+// proofStore holds the complete proofs of the process by request ID. The
+// verification functions are registered once for all the conodes of the
+// process, as the store, whose proofs are checked against their digest.
+var proofStore = struct {
+	sync.Mutex
+	proofs map[string]storedProofs
+}{proofs: make(map[string]storedProofs)}
+
+// ProofsDigest returns the digest of the complete proofs
+func ProofsDigest(proofs lib.CompleteProofs) ([]byte, error) {
+	conodes := make([]string, 0, len(proofs))
+	for conode := range proofs {
+		conodes = append(conodes, conode)
+	}
+	sort.Strings(conodes)
+
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, uint64(len(conodes)))
+	for _, conode := range conodes {
+		entry := &proofEntry{Conode: conode}
+		if p := proofs[conode]; p != nil {
+			proof := *p
+			if p.AggregationProof != nil {
+				aggregation := *p.AggregationProof
+				keys := make([]string, 0, len(aggregation.Contributions))
+				for k := range aggregation.Contributions {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				binary.Write(h, binary.BigEndian, uint64(len(keys)))
+				for _, k := range keys {
+					writeBytes(h, []byte(k))
+					writeBytes(h, aggregation.Contributions[k])
+				}
+				aggregation.Contributions = nil
+				proof.AggregationProof = &aggregation
+			}
+			entry.Proof = &proof
+		}
+		b, err := network.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		writeBytes(h, b)
+	}
+	return h.Sum(nil), nil
+}
+
+// StoreProofs stores the complete proofs of the save requestID, replacing the
+// ones stored before for the save, and returns their digest. The proofs
+// stored for longer than proofStoreTTL are dropped.
+func StoreProofs(requestID string, proofs lib.CompleteProofs) ([]byte, error) {
+	digest, err := ProofsDigest(proofs)
+	if err != nil {
+		return nil, err
+	}
+	now := Now()
+	proofStore.Lock()
+	defer proofStore.Unlock()
+	for id, s := range proofStore.proofs {
+		if now.Sub(s.stored) > proofStoreTTL {
+			delete(proofStore.proofs, id)
+		}
+	}
+	proofStore.proofs[requestID] = storedProofs{proofs: proofs, digest: digest, stored: now}
+	return digest, nil
+}
+
+// LoadProofs returns the complete proofs of the digest stored for the save
+// requestID, false if they are not in the store
+func LoadProofs(requestID string, digest []byte) (lib.CompleteProofs, bool) {
+	proofStore.Lock()
+	defer proofStore.Unlock()
+	s, ok := proofStore.proofs[requestID]
+	if !ok || len(digest) == 0 || !bytes.Equal(s.digest, digest) {
+		return nil, false
+	}
+	return s.proofs, true
+}
@@ -0,0 +1,59 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func TestProofStore(t *testing.T) {
+	proof := func(filter byte) *lib.CompleteProof {
+		return &lib.CompleteProof{
+			PublicKey: decenarch.Suite.Point().Base(),
+			AggregationProof: &lib.AggregationProof{
+				Contributions: map[string][]byte{"a": {1}, "b": {2}, "c": {3}},
+				Aggregation:   []byte{6},
+				Length:        1,
+			},
+			EncryptedBloomFilter: []byte{filter},
+		}
+	}
+	proofs := lib.CompleteProofs{"a": proof(1), "b": proof(2)}
+	digest, err := ProofsDigest(proofs)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		again, err := ProofsDigest(lib.CompleteProofs{"b": proof(2), "a": proof(1)})
+		require.NoError(t, err)
+		require.Equal(t, digest, again)
+	}
+	other, err := ProofsDigest(lib.CompleteProofs{"a": proof(1), "b": proof(3)})
+	require.NoError(t, err)
+	require.NotEqual(t, digest, other)
+
+	stored, err := StoreProofs("request", proofs)
+	require.NoError(t, err)
+	require.Equal(t, digest, stored)
+	loaded, ok := LoadProofs("request", digest)
+	require.True(t, ok)
+	require.Equal(t, proofs, loaded)
+	_, ok = LoadProofs("request", other)
+	require.False(t, ok)
+	_, ok = LoadProofs("request", nil)
+	require.False(t, ok)
+
+	// the proofs of a save don't verify another save
+	_, ok = LoadProofs("other request", digest)
+	require.False(t, ok)
+
+	// the proofs are dropped after proofStoreTTL
+	defer func(clock Clock) { Now = clock }(Now)
+	Now = func() time.Time { return time.Now().Add(2 * proofStoreTTL) }
+	_, err = StoreProofs("other request", lib.CompleteProofs{"a": proof(1)})
+	require.NoError(t, err)
+	_, ok = LoadProofs("request", digest)
+	require.False(t, ok)
+}
@@ -0,0 +1,138 @@
+package protocol
+
+/*
+The redirect.go defines the consensus on the URL of the saved page. The
+conodes may be redirected to different pages, e.g. by A/B tests or redirects
+depending on their location, so each conode reports the redirect chain it
+followed and the engines only archive the page under the final URL reached by
+at least a threshold of conodes. The redirect chains are signed by the conodes
+for the save request: by a Redirection in the structured consensus, by the
+commitment in the Merkle consensus. A root redirected to another URL than the
+consensus fails the save, as its page is not the archived one.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// Redirection is the redirect chain followed by a conode
+//    - Public is the key of the conode
+//    - Chain are the URLs fetched by the conode, the URL of the request
+//      first and the final URL last
+//    - Signature is the schnorr signature of the conode on the chain and the
+//      request ID, empty if the chain is signed by a MerkleCommitment
+type Redirection struct {
+	Public    kyber.Point
+	Chain     []string
+	Signature []byte
+}
+
+// NewRedirection returns the redirect chain followed by the conode of
+// private, signed for the save request requestID
+func NewRedirection(requestID string, chain []string, private kyber.Scalar) (*Redirection, error) {
+	r := &Redirection{Public: decenarch.Suite.Point().Mul(private, nil), Chain: chain}
+	sig, err := schnorr.Sign(decenarch.Suite, private, r.message(requestID))
+	if err != nil {
+		return nil, err
+	}
+	r.Signature = sig
+	return r, nil
+}
+
+// message returns the bytes signed by the conode
+func (r Redirection) message(requestID string) []byte {
+	return []byte("redirection\x00" + requestID + "\x00" + strings.Join(r.Chain, "\x00"))
+}
+
+// Verify checks that the redirect chain comes from a conode of publics and is
+// signed by it for the save request requestID
+func (r Redirection) Verify(requestID string, publics []kyber.Point) error {
+	if !hasKey(publics, r.Public) {
+		return errors.New("redirection of a conode outside the roster")
+	}
+	if err := schnorr.Verify(decenarch.Suite, r.Public, r.message(requestID), r.Signature); err != nil {
+		return fmt.Errorf("invalid signature of the redirection: %v", err)
+	}
+	return nil
+}
+
+// VerifiedRedirections returns the redirect chains signed for the save
+// request requestID by the conodes of publics, and the errors of the others
+func VerifiedRedirections(requestID string, redirections []Redirection, publics []kyber.Point) ([]Redirection, []error) {
+	var verified []Redirection
+	var errs []error
+	for _, r := range redirections {
+		if err := r.Verify(requestID, publics); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		verified = append(verified, r)
+	}
+	return verified, errs
+}
+
+// Final returns the final URL of the redirect chain
+func (r Redirection) Final() string {
+	if len(r.Chain) == 0 {
+		return ""
+	}
+	return r.Chain[len(r.Chain)-1]
+}
+
+// redirectChain returns the URLs fetched to get resp, the first request
+// first
+func redirectChain(resp *http.Response) []string {
+	var chain []string
+	for req := resp.Request; req != nil; {
+		chain = append([]string{req.URL.String()}, chain...)
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+	return chain
+}
+
+// AgreeOnURL returns the final URL reached by at least threshold conodes, or
+// decenarch.ErrRedirectConsensus. Only one redirection per conode is counted,
+// the redirections must be verified by the caller.
+func AgreeOnURL(redirections []Redirection, threshold int) (string, error) {
+	seen := make(map[string]bool)
+	var finals []string
+	for _, r := range redirections {
+		if r.Public == nil || seen[r.Public.String()] {
+			continue
+		}
+		seen[r.Public.String()] = true
+		finals = append(finals, r.Final())
+	}
+	url := lib.MostCommon(finals, threshold)
+	if url == "" {
+		return "", decenarch.ErrRedirectConsensus
+	}
+	return url, nil
+}
+
+// agreeOnRootURL returns the final URL reached by at least threshold conodes,
+// or decenarch.ErrRedirectConsensus if there is none or if the root, whose
+// page is archived, reached another URL
+func agreeOnRootURL(logger *lib.Logger, root string, redirections []Redirection, threshold int) (string, error) {
+	url, err := AgreeOnURL(redirections, threshold)
+	if err != nil {
+		return "", err
+	}
+	if url != root {
+		logger.Lvl1("The root was redirected to another URL than the consensus", "root", root, "consensus", url)
+		return "", decenarch.ErrRedirectConsensus
+	}
+	return url, nil
+}
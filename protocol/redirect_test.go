@@ -0,0 +1,90 @@
+package protocol
+
+import (
+	"net/http"
+	urlpkg "net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/util/key"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func TestRedirectChain(t *testing.T) {
+	request := func(s string, via *http.Response) *http.Request {
+		u, err := urlpkg.Parse(s)
+		require.NoError(t, err)
+		return &http.Request{URL: u, Response: via}
+	}
+	first := &http.Response{Request: request("http://example.com/", nil)}
+	second := &http.Response{Request: request("https://example.com/", first)}
+	final := &http.Response{Request: request("https://www.example.com/", second)}
+	require.Equal(t, []string{"http://example.com/", "https://example.com/", "https://www.example.com/"}, redirectChain(final))
+	require.Equal(t, []string{"http://example.com/"}, redirectChain(first))
+}
+
+func TestAgreeOnURL(t *testing.T) {
+	redirection := func(chain ...string) Redirection {
+		return Redirection{Public: key.NewKeyPair(decenarch.Suite).Public, Chain: chain}
+	}
+	a := redirection("http://example.com/", "http://example.com/a")
+	redirections := []Redirection{
+		a,
+		redirection("http://example.com/", "http://example.com/b"),
+		redirection("http://example.com/a"),
+		redirection(),
+	}
+	url, err := AgreeOnURL(redirections, 2)
+	require.NoError(t, err)
+	require.Equal(t, "http://example.com/a", url)
+
+	// a conode is counted once
+	_, err = AgreeOnURL(append(redirections[1:], a, a), 3)
+	require.Equal(t, decenarch.ErrRedirectConsensus, err)
+	_, err = AgreeOnURL(nil, 1)
+	require.Equal(t, decenarch.ErrRedirectConsensus, err)
+}
+
+func TestVerifiedRedirections(t *testing.T) {
+	a := key.NewKeyPair(decenarch.Suite)
+	b := key.NewKeyPair(decenarch.Suite)
+	outsider := key.NewKeyPair(decenarch.Suite)
+	publics := []kyber.Point{a.Public, b.Public}
+	redirect := func(private kyber.Scalar, requestID string, chain ...string) Redirection {
+		r, err := NewRedirection(requestID, chain, private)
+		require.NoError(t, err)
+		return *r
+	}
+
+	signed := redirect(a.Private, "request", "http://example.com/", "http://example.com/a")
+	forged := redirect(b.Private, "request", "http://example.com/", "http://example.com/a")
+	forged.Chain = []string{"http://example.com/", "http://example.com/b"}
+	verified, errs := VerifiedRedirections("request", []Redirection{
+		signed,
+		forged,
+		{Public: b.Public, Chain: []string{"http://example.com/b"}},
+		redirect(b.Private, "other request", "http://example.com/b"),
+		redirect(outsider.Private, "request", "http://example.com/b"),
+	}, publics)
+	require.Equal(t, []Redirection{signed}, verified)
+	require.Len(t, errs, 4)
+}
+
+func TestAgreeOnRootURL(t *testing.T) {
+	logger := lib.NewLogger("request", "conode")
+	redirections := []Redirection{
+		{Public: key.NewKeyPair(decenarch.Suite).Public, Chain: []string{"http://example.com/a"}},
+		{Public: key.NewKeyPair(decenarch.Suite).Public, Chain: []string{"http://example.com/a"}},
+		{Public: key.NewKeyPair(decenarch.Suite).Public, Chain: []string{"http://example.com/b"}},
+	}
+	url, err := agreeOnRootURL(logger, "http://example.com/a", redirections, 2)
+	require.NoError(t, err)
+	require.Equal(t, "http://example.com/a", url)
+
+	// the page of the root is not the page of the consensus
+	_, err = agreeOnRootURL(logger, "http://example.com/b", redirections, 2)
+	require.Equal(t, decenarch.ErrRedirectConsensus, err)
+}
@@ -0,0 +1,236 @@
+package protocol
+
+/*
+The render.go defines how the conodes obtain the rendered DOM of the pages
+built by JavaScript. When the client asks for it, each conode fetches the
+page as usual, so that the URL checks, the content type and the TLS
+certificate are unchanged, then gives the final URL to its Renderer and
+builds its leaves from the rendered DOM instead of the raw HTML.
+
+The CDPRenderer talks to a local headless Chromium through the Chrome
+DevTools Protocol, e.g. started with
+
+	chromium --headless --remote-debugging-port=9222 \
+		--remote-allow-origins=http://127.0.0.1:9222
+
+The requests made by the browser itself are not checked by the conode, so the
+browser should run in a network that cannot reach the private services of
+the conode.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	urlpkg "net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Renderer returns the DOM of the page at url once rendered by a browser
+type Renderer interface {
+	Render(url string) ([]byte, error)
+}
+
+// ErrNoRenderer is returned by the conodes asked to render a page without
+// renderer configured
+var ErrNoRenderer = errors.New("no renderer configured on this conode")
+
+// pageRenderer returns the renderer to use for a save, nil if the page must
+// not be rendered
+func pageRenderer(render bool, r Renderer) (Renderer, error) {
+	if !render {
+		return nil, nil
+	}
+	if r == nil {
+		return nil, ErrNoRenderer
+	}
+	return r, nil
+}
+
+// DefaultRenderTimeout is the maximal duration of a rendering
+const DefaultRenderTimeout = 30 * time.Second
+
+// CDPRenderer renders the pages with a headless Chromium
+//    - Endpoint is the HTTP address of the DevTools of the browser, e.g.
+//      http://127.0.0.1:9222
+//    - Timeout is the maximal duration of a rendering, DefaultRenderTimeout
+//      if zero
+//    - Settle is the time given to the scripts of the page after its load
+//      event, before reading the DOM
+type CDPRenderer struct {
+	Endpoint string
+	Timeout  time.Duration
+	Settle   time.Duration
+}
+
+// cdpTarget is a tab of the browser, see /json/new of the DevTools
+type cdpTarget struct {
+	ID                   string `json:"id"`
+	WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+}
+
+// cdpMessage is a command sent to the browser, or a reply or an event sent
+// by the browser
+type cdpMessage struct {
+	ID     int                    `json:"id,omitempty"`
+	Method string                 `json:"method,omitempty"`
+	Params map[string]interface{} `json:"params,omitempty"`
+	Result json.RawMessage        `json:"result,omitempty"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Render implements Renderer, it opens url in a new tab of the browser and
+// returns the outer HTML of the document once loaded
+func (r *CDPRenderer) Render(url string) ([]byte, error) {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = DefaultRenderTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	target, err := r.newTarget(timeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open a tab of the renderer: %v", err)
+	}
+	defer r.closeTarget(target)
+
+	conn, err := websocket.Dial(target.WebSocketDebuggerURL, "", r.devtools(""))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	c := &cdpConn{conn: conn, seen: make(map[string]bool)}
+
+	if _, err := c.call("Page.enable", nil); err != nil {
+		return nil, err
+	}
+	if _, err := c.call("Page.navigate", map[string]interface{}{"url": url}); err != nil {
+		return nil, err
+	}
+	if err := c.waitEvent("Page.loadEventFired"); err != nil {
+		return nil, err
+	}
+	if r.Settle > 0 {
+		time.Sleep(r.Settle)
+	}
+	raw, err := c.call("Runtime.evaluate", map[string]interface{}{
+		"expression":    "document.documentElement.outerHTML",
+		"returnByValue": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Result struct {
+			Value string `json:"value"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	if result.Result.Value == "" {
+		return nil, errors.New("the renderer returned an empty document")
+	}
+	return []byte("<!DOCTYPE html>" + result.Result.Value), nil
+}
+
+// newTarget opens a blank tab in the browser
+func (r *CDPRenderer) newTarget(timeout time.Duration) (*cdpTarget, error) {
+	req, err := http.NewRequest(http.MethodPut, r.devtools("/json/new?about:blank"), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := (&http.Client{Timeout: timeout}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	target := &cdpTarget{}
+	if err := json.Unmarshal(body, target); err != nil {
+		return nil, err
+	}
+	if target.WebSocketDebuggerURL == "" {
+		return nil, errors.New("no debugger URL for the tab")
+	}
+	return target, nil
+}
+
+// closeTarget closes the tab of the browser
+func (r *CDPRenderer) closeTarget(target *cdpTarget) {
+	resp, err := http.Get(r.devtools("/json/close/" + urlpkg.PathEscape(target.ID)))
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+// devtools returns the address of the given path of the DevTools
+func (r *CDPRenderer) devtools(path string) string {
+	return strings.TrimSuffix(r.Endpoint, "/") + path
+}
+
+// cdpConn sends the commands to a tab of the browser
+//    - seen are the events received while waiting for a reply
+type cdpConn struct {
+	conn   *websocket.Conn
+	nextID int
+	seen   map[string]bool
+}
+
+// call sends the command and returns its result, the events received in the
+// meantime are kept for waitEvent
+func (c *cdpConn) call(method string, params map[string]interface{}) (json.RawMessage, error) {
+	c.nextID++
+	id := c.nextID
+	if err := websocket.JSON.Send(c.conn, &cdpMessage{ID: id, Method: method, Params: params}); err != nil {
+		return nil, err
+	}
+	for {
+		msg := &cdpMessage{}
+		if err := websocket.JSON.Receive(c.conn, msg); err != nil {
+			return nil, err
+		}
+		if msg.ID != id {
+			if msg.Method != "" {
+				c.seen[msg.Method] = true
+			}
+			continue
+		}
+		if msg.Error != nil {
+			return nil, fmt.Errorf("%s: %s", method, msg.Error.Message)
+		}
+		return msg.Result, nil
+	}
+}
+
+// waitEvent waits until the browser sends the given event
+func (c *cdpConn) waitEvent(method string) error {
+	if c.seen[method] {
+		return nil
+	}
+	for {
+		msg := &cdpMessage{}
+		if err := websocket.JSON.Receive(c.conn, msg); err != nil {
+			return err
+		}
+		if msg.Method == method {
+			return nil
+		}
+	}
+}
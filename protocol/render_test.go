@@ -0,0 +1,71 @@
+package protocol
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+// fakeDevTools answers the DevTools requests like a browser whose documents
+// are rendered as dom. The ID of the closed tabs are sent on closed.
+func fakeDevTools(t *testing.T, dom string, closed chan string) *httptest.Server {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	mux.HandleFunc("/json/new", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPut, r.Method)
+		ws := "ws" + strings.TrimPrefix(srv.URL, "http") + "/devtools/page/tab"
+		json.NewEncoder(w).Encode(map[string]string{"id": "tab", "webSocketDebuggerUrl": ws})
+	})
+	mux.HandleFunc("/json/close/", func(w http.ResponseWriter, r *http.Request) {
+		closed <- strings.TrimPrefix(r.URL.Path, "/json/close/")
+	})
+	mux.Handle("/devtools/page/tab", websocket.Handler(func(conn *websocket.Conn) {
+		for {
+			msg := &cdpMessage{}
+			if err := websocket.JSON.Receive(conn, msg); err != nil {
+				return
+			}
+			reply := &cdpMessage{ID: msg.ID, Result: json.RawMessage(`{}`)}
+			switch msg.Method {
+			case "Page.navigate":
+				// the load event is sent before the reply
+				websocket.JSON.Send(conn, &cdpMessage{Method: "Page.loadEventFired"})
+			case "Runtime.evaluate":
+				value, _ := json.Marshal(dom)
+				reply.Result = json.RawMessage(`{"result":{"type":"string","value":` + string(value) + `}}`)
+			}
+			websocket.JSON.Send(conn, reply)
+		}
+	}))
+	return srv
+}
+
+func TestCDPRenderer(t *testing.T) {
+	closed := make(chan string, 1)
+	srv := fakeDevTools(t, `<html><body><p>rendered</p></body></html>`, closed)
+	defer srv.Close()
+
+	r := &CDPRenderer{Endpoint: srv.URL + "/", Timeout: 5 * time.Second}
+	dom, err := r.Render("http://example.com/")
+	require.NoError(t, err)
+	require.Equal(t, "<!DOCTYPE html><html><body><p>rendered</p></body></html>", string(dom))
+	require.Equal(t, "tab", <-closed)
+}
+
+func TestPageRenderer(t *testing.T) {
+	r := &CDPRenderer{}
+	renderer, err := pageRenderer(false, r)
+	require.NoError(t, err)
+	require.Nil(t, renderer)
+	renderer, err = pageRenderer(true, r)
+	require.NoError(t, err)
+	require.Equal(t, r, renderer)
+	_, err = pageRenderer(true, nil)
+	require.Equal(t, ErrNoRenderer, err)
+}
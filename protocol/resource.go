@@ -0,0 +1,194 @@
+package protocol
+
+/*
+The resource.go defines the handlers of the additional resources of a page,
+chosen by their content type. Without handler a resource is archived as opaque
+bytes. A handler bounds the size of the resources it handles, validates them
+and gives their canonical form, on which the conodes run the consensus, so
+that two conodes fetching the same document serialized differently still
+agree. It also extracts the text of the resources, to index them.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ResourceHandler is implemented by the handlers of the additional resources
+// of a given content type
+type ResourceHandler interface {
+	// Name returns the unique name of the handler
+	Name() string
+	// Match returns true if the handler handles the resources of the given
+	// media type, e.g. application/json
+	Match(mediaType string) bool
+	// MaxSize returns the maximal size in bytes of the resources handled,
+	// 0 for the limit of the conode only. The smallest limit is used
+	MaxSize() int64
+	// Canonicalize returns the canonical form of the resource, or an error
+	// if the resource is not valid
+	Canonicalize(data []byte) ([]byte, error)
+	// Text returns the text of a canonical resource, for indexing
+	Text(data []byte) string
+}
+
+var resourceHandlers = struct {
+	sync.Mutex
+	l []ResourceHandler
+}{}
+
+func init() {
+	for _, h := range []ResourceHandler{jsonHandler{}, pdfHandler{}} {
+		if err := RegisterResourceHandler(h); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterResourceHandler adds a handler to the registry. The handlers are
+// tried in their order of registration. It returns an error if a handler
+// with the same name is already registered.
+func RegisterResourceHandler(h ResourceHandler) error {
+	resourceHandlers.Lock()
+	defer resourceHandlers.Unlock()
+	for _, r := range resourceHandlers.l {
+		if r.Name() == h.Name() {
+			return fmt.Errorf("resource handler %s already registered", h.Name())
+		}
+	}
+	resourceHandlers.l = append(resourceHandlers.l, h)
+	return nil
+}
+
+// GetResourceHandler returns the handler of the resources of the given
+// content type, e.g. "application/json; charset=utf-8", or nil if no handler
+// matches
+func GetResourceHandler(contentType string) ResourceHandler {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	resourceHandlers.Lock()
+	defer resourceHandlers.Unlock()
+	for _, h := range resourceHandlers.l {
+		if h.Match(mediaType) {
+			return h
+		}
+	}
+	return nil
+}
+
+// ResourceHandlers returns the sorted names of the registered handlers
+func ResourceHandlers() []string {
+	resourceHandlers.Lock()
+	defer resourceHandlers.Unlock()
+	names := make([]string, len(resourceHandlers.l))
+	for i, h := range resourceHandlers.l {
+		names[i] = h.Name()
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResourceText returns the text of the canonical resource of the given
+// content type, empty if no handler matches
+func ResourceText(contentType string, data []byte) string {
+	h := GetResourceHandler(contentType)
+	if h == nil {
+		return ""
+	}
+	return h.Text(data)
+}
+
+// resourceLimit returns the size limit of a resource of handler h for a
+// conode whose limit is limit, 0 meaning no limit
+func resourceLimit(h ResourceHandler, limit int64) int64 {
+	if h == nil || h.MaxSize() <= 0 {
+		return limit
+	}
+	if limit <= 0 || h.MaxSize() < limit {
+		return h.MaxSize()
+	}
+	return limit
+}
+
+// jsonMaxSize is the maximal size in bytes of a JSON resource
+const jsonMaxSize = 8 * 1024 * 1024
+
+// jsonHandler handles the JSON documents. The canonical form of a document
+// has no whitespace and its object keys sorted.
+type jsonHandler struct{}
+
+// Name implements ResourceHandler
+func (jsonHandler) Name() string {
+	return "json"
+}
+
+// Match implements ResourceHandler
+func (jsonHandler) Match(mediaType string) bool {
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// MaxSize implements ResourceHandler
+func (jsonHandler) MaxSize() int64 {
+	return jsonMaxSize
+}
+
+// Canonicalize implements ResourceHandler
+func (jsonHandler) Canonicalize(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid JSON document: %v", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("invalid JSON document: data after the value")
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Text implements ResourceHandler, it returns the string values of the
+// document, one per line, the values of the objects sorted by key
+func (jsonHandler) Text(data []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return ""
+	}
+	return strings.Join(jsonStrings(v, nil), "\n")
+}
+
+// jsonStrings appends to lines the string values of the decoded JSON value v
+func jsonStrings(v interface{}, lines []string) []string {
+	switch v := v.(type) {
+	case string:
+		lines = append(lines, v)
+	case []interface{}:
+		for _, e := range v {
+			lines = jsonStrings(e, lines)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			lines = jsonStrings(v[k], lines)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,185 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// maxPDFStream is the maximal size in bytes of a decompressed content stream
+// of a PDF document read for its text
+const maxPDFStream = 16 * 1024 * 1024
+
+var pdfStreamRegexp = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+
+// pdfHandler handles the PDF documents. They are only checked to be PDF
+// documents, their canonical form is the document itself. The text is read
+// from the literal strings shown by the text operators of the content
+// streams, which covers the documents using the standard fonts.
+type pdfHandler struct{}
+
+// Name implements ResourceHandler
+func (pdfHandler) Name() string {
+	return "pdf"
+}
+
+// Match implements ResourceHandler
+func (pdfHandler) Match(mediaType string) bool {
+	return mediaType == "application/pdf"
+}
+
+// MaxSize implements ResourceHandler
+func (pdfHandler) MaxSize() int64 {
+	return 0
+}
+
+// Canonicalize implements ResourceHandler
+func (pdfHandler) Canonicalize(data []byte) ([]byte, error) {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	if !bytes.Contains(head, []byte("%PDF-")) {
+		return nil, errors.New("invalid PDF document: no header")
+	}
+	tail := data
+	if len(tail) > 1024 {
+		tail = tail[len(tail)-1024:]
+	}
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return nil, errors.New("invalid PDF document: truncated")
+	}
+	return data, nil
+}
+
+// Text implements ResourceHandler
+func (pdfHandler) Text(data []byte) string {
+	var text bytes.Buffer
+	for _, m := range pdfStreamRegexp.FindAllSubmatchIndex(data, -1) {
+		dict := data[m[2]:m[3]]
+		start := m[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		stream := data[start : start+end]
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			r, err := zlib.NewReader(bytes.NewReader(stream))
+			if err != nil {
+				continue
+			}
+			// keep what could be decompressed of a damaged stream
+			stream, _ = ioutil.ReadAll(io.LimitReader(r, maxPDFStream))
+			r.Close()
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue
+		}
+		pdfContentText(stream, &text)
+	}
+	return strings.TrimSpace(text.String())
+}
+
+// pdfContentText appends to text the literal strings shown in the text
+// objects of the content stream
+func pdfContentText(stream []byte, text *bytes.Buffer) {
+	var shown []string
+	inText := false
+	for i := 0; i < len(stream); {
+		c := stream[i]
+		switch {
+		case c == '(':
+			s, n := pdfLiteral(stream[i:])
+			if inText {
+				shown = append(shown, s)
+			}
+			i += n
+		case c == '%':
+			for i < len(stream) && stream[i] != '\n' && stream[i] != '\r' {
+				i++
+			}
+		case isPDFRegular(c):
+			j := i
+			for j < len(stream) && isPDFRegular(stream[j]) {
+				j++
+			}
+			switch op := string(stream[i:j]); op {
+			case "BT":
+				inText = true
+			case "ET":
+				inText = false
+				text.WriteString("\n")
+			case "Tj", "TJ", "'", "\"":
+				text.WriteString(strings.Join(shown, ""))
+				text.WriteString(" ")
+				shown = nil
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+}
+
+// pdfLiteral decodes the literal string starting at the opening parenthesis
+// of data, and returns it with the number of bytes it takes
+func pdfLiteral(data []byte) (string, int) {
+	var s []byte
+	depth := 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '(':
+			depth++
+			if depth > 1 {
+				s = append(s, c)
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(s), i + 1
+			}
+			s = append(s, c)
+		case '\\':
+			i++
+			if i >= len(data) {
+				return string(s), i
+			}
+			switch e := data[i]; e {
+			case 'n':
+				s = append(s, '\n')
+			case 'r':
+				s = append(s, '\r')
+			case 't':
+				s = append(s, '\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					v := 0
+					for k := 0; k < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; k++ {
+						v = v*8 + int(data[i]-'0')
+						i++
+					}
+					i--
+					s = append(s, byte(v))
+				} else {
+					s = append(s, e)
+				}
+			}
+		default:
+			s = append(s, c)
+		}
+	}
+	return string(s), len(data)
+}
+
+// isPDFRegular returns true if c is neither a whitespace nor a delimiter of
+// the PDF syntax
+func isPDFRegular(c byte) bool {
+	return !strings.ContainsRune(" \t\r\n\f\x00()<>[]{}/%", rune(c))
+}
@@ -0,0 +1,67 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceHandlers(t *testing.T) {
+	require.Equal(t, "json", GetResourceHandler("application/json; charset=utf-8").Name())
+	require.Equal(t, "json", GetResourceHandler("application/ld+json").Name())
+	require.Equal(t, "pdf", GetResourceHandler("application/pdf").Name())
+	require.Nil(t, GetResourceHandler("image/png"))
+	require.Nil(t, GetResourceHandler(""))
+	require.NotNil(t, RegisterResourceHandler(jsonHandler{}))
+	require.Equal(t, []string{"json", "pdf"}, ResourceHandlers())
+
+	// the smallest limit is used
+	h := GetResourceHandler("application/json")
+	require.Equal(t, int64(jsonMaxSize), resourceLimit(h, 0))
+	require.Equal(t, int64(100), resourceLimit(h, 100))
+	require.Equal(t, int64(100), resourceLimit(GetResourceHandler("application/pdf"), 100))
+	require.Equal(t, int64(0), resourceLimit(nil, 0))
+}
+
+func TestJSONHandler(t *testing.T) {
+	h := jsonHandler{}
+	a, err := h.Canonicalize([]byte(`{"b": [1, 2.50, "<x>"], "a": {"d": null, "c": true}}`))
+	require.Nil(t, err)
+	require.Equal(t, `{"a":{"c":true,"d":null},"b":[1,2.50,"<x>"]}`, string(a))
+
+	// the same document serialized differently has the same canonical form
+	b, err := h.Canonicalize([]byte("{\n  \"a\": {\"c\": true, \"d\": null},\n  \"b\": [1, 2.50, \"<x>\"]\n}\n"))
+	require.Nil(t, err)
+	require.Equal(t, a, b)
+
+	_, err = h.Canonicalize([]byte(`{"a": 1`))
+	require.NotNil(t, err)
+	_, err = h.Canonicalize([]byte(`{"a": 1} {"b": 2}`))
+	require.NotNil(t, err)
+
+	require.Equal(t, "hello\nfoo\nbar", h.Text([]byte(`{"words":["foo","bar"],"title":"hello","n":3}`)))
+}
+
+func TestPDFHandler(t *testing.T) {
+	var content bytes.Buffer
+	w := zlib.NewWriter(&content)
+	w.Write([]byte("BT /F1 12 Tf 72 712 Td (Hello \\(decenarch\\)) Tj ET\nBT [(Wor) -20 (ld)] TJ ET"))
+	w.Close()
+	pdf := fmt.Sprintf("%%PDF-1.4\n1 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream\nendobj\n"+
+		"2 0 obj\n<< /Length 30 >>\nstream\nBT (Plain \\101) Tj ET\nendstream\nendobj\ntrailer\n<< >>\n%%%%EOF\n",
+		content.Len(), content.Bytes())
+
+	h := pdfHandler{}
+	data, err := h.Canonicalize([]byte(pdf))
+	require.Nil(t, err)
+	require.Equal(t, []byte(pdf), data)
+	require.Equal(t, "Hello (decenarch) \nWorld \nPlain A", h.Text(data))
+
+	_, err = h.Canonicalize([]byte("<html></html>"))
+	require.NotNil(t, err)
+	_, err = h.Canonicalize([]byte(pdf[:len(pdf)-10]))
+	require.NotNil(t, err)
+}
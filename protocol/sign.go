@@ -13,6 +13,7 @@ import (
 
 	decenarch "github.com/dedis/student_18_decenar"
 	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/lib/canonhtml"
 )
 
 // We define two signing protocols, and their respective sub protocols, because
@@ -41,12 +42,45 @@ func init() {
 
 func NewSignStructuredProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 	log.Lvl4("Creating NewSignProtocol")
-	return ftcosiprotocol.NewFtCosi(n, verificationFunctionStructured, NameSubSignStructured, ftcosiprotocol.EdDSACompatibleCosiSuite)
+	return ftcosiprotocol.NewFtCosi(n, verificationFunctionStructured, NameSubSignStructured, decenarch.CosiSuite)
 }
 
 func NewSubSignStructuredProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 	log.Lvl4("Creating NewSubSignProtocol")
-	return ftcosiprotocol.NewSubFtCosi(n, verificationFunctionStructured, ftcosiprotocol.EdDSACompatibleCosiSuite)
+	return ftcosiprotocol.NewSubFtCosi(n, verificationFunctionStructured, decenarch.CosiSuite)
+}
+
+// NewSubSignStructuredCheckedProtocol is NewSubSignStructuredProtocol with the
+// additional checks of the consensus data and of the list of the additional
+// resources of the page, with the normalizer agreed at setup, done by the conode
+// before signing
+func NewSubSignStructuredCheckedProtocol(n *onet.TreeNodeInstance, check ConsensusCheck, normalizer *lib.URLNormalizer) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewSubSignProtocol")
+	return ftcosiprotocol.NewSubFtCosi(n, StructuredCheckedVerification(check, normalizer), decenarch.CosiSuite)
+}
+
+// StructuredCheckedVerification returns the verification function of
+// NewSubSignStructuredCheckedProtocol
+func StructuredCheckedVerification(check ConsensusCheck, normalizer *lib.URLNormalizer) ftcosiprotocol.VerificationFn {
+	return func(msg, data []byte) bool {
+		if !verificationFunctionStructured(msg, data) {
+			return false
+		}
+		_, vfData, err := network.Unmarshal(data, decenarch.Suite)
+		if err != nil {
+			return false
+		}
+		vd := vfData.(*VerificationData)
+		if err := check(vd.RequestID, vd.ConsensusDigest(), vd.ConsensusSignature); err != nil {
+			lib.NewLogger(vd.RequestID, vd.ConodeKey).With("protocol", NameSignStructured).Lvl1("Invalid consensus data, node refuses to sign", "error", err)
+			return false
+		}
+		if err := CheckPageLinks(vd.Url, msg, vd.AddsUrl, normalizer); err != nil {
+			lib.NewLogger(vd.RequestID, vd.ConodeKey).With("protocol", NameSignStructured).Lvl1("Invalid list of additional resources, node refuses to sign", "error", err)
+			return false
+		}
+		return true
+	}
 }
 
 func verificationFunctionStructured(msg, data []byte) bool {
@@ -56,18 +90,30 @@ func verificationFunctionStructured(msg, data []byte) bool {
 		log.Lvl1("Impossible ot decode verification data, node refuses to sign")
 		return false
 	}
+	logger := lib.NewLogger(vfData.(*VerificationData).RequestID, vfData.(*VerificationData).ConodeKey).With("protocol", NameSignStructured)
+
+	// the page must be in its canonical serialization, so that any root
+	// agreeing on the same leaves signs the same bytes
+	if !canonhtml.IsCanonical(msg) {
+		logger.Lvl1("Proposed HTML page not in its canonical serialization, node refuses to sign")
+		return false
+	}
 
 	// verify if the leaves of the message are really in the conode's Bloom
 	// filter
 	// first of all we have to recontruct the HTML tree
 	rootNode, err := html.Parse(bytes.NewReader(msg))
 	if err != nil {
-		log.Lvl1("Impossible to parse the proposed HTML page, node refuses to sign")
+		logger.Lvl1("Impossible to parse the proposed HTML page, node refuses to sign", "error", err)
 		return false
 	}
 
-	// then we get the leaves of the local HTML tree...
-	listLeaves := lib.ListUniqueDataLeaves(rootNode)
+	// then we get the extractor of the leaves of the save...
+	extractor, err := lib.GetLeafExtractor(vfData.(*VerificationData).Extractor)
+	if err != nil {
+		logger.Lvl1("Unknown leaf extractor, node refuses to sign", "error", err)
+		return false
+	}
 
 	// ...and the list of the leaves in the proposed consensus HTML tree
 	listLeavesConsensus := vfData.(*VerificationData).Leaves
@@ -82,33 +128,51 @@ func verificationFunctionStructured(msg, data []byte) bool {
 	// get consensus Bloom filter
 	consensusBloomSet := vfData.(*VerificationData).ConsensusSet
 	consensusParameters := vfData.(*VerificationData).ConsensusParameters
-	consensusCBF := lib.BloomFilterFromSet(consensusBloomSet, []uint{uint(consensusParameters[0]), uint(consensusParameters[1])})
-
-	// check if it is a subset and if the leave is indeed in the consensus
-	// Bloom filter
-	for _, l := range listLeaves {
-		// something there are problem with this leaves values with the
-		// Go parser, but since they are not important we simply skip
-		// this test
-		if l == "noscript" || l == "script" {
-			continue
+	param, err := lib.ParametersFromSent(consensusParameters)
+	if err != nil {
+		logger.Lvl1("Invalid consensus Bloom filter, node refuses to sign", "error", err)
+		return false
+	}
+	consensusCBF, err := lib.BloomFilterFromSet(consensusBloomSet, param)
+	if err != nil {
+		logger.Lvl1("Invalid consensus Bloom filter, node refuses to sign", "error", err)
+		return false
+	}
+
+	// check if every leaf of the page is a subset and if the leave is
+	// indeed in the consensus Bloom filter
+	valid := true
+	lib.WalkLeaves(rootNode, extractor, func(n *html.Node, l string) {
+		if !valid || skippedLeaf(n) {
+			return
 		}
 		// subset
 		if !consensusSet[l] {
-			return false
+			logger.Lvl1("Leaf of the proposed page is not a consensus leaf, node refuses to sign", "leaf", l)
+			valid = false
+			return
 		}
 		// consensus Bloom filter
 		if consensusCBF.Count([]byte(l)) == 0 {
-			return false
+			logger.Lvl1("Leaf of the proposed page is not in the consensus Bloom filter, node refuses to sign", "leaf", l)
+			valid = false
 		}
+	})
+	if !valid {
+		return false
 	}
 
-	// get complete proofs
-	completeProofs := vfData.(*VerificationData).CompleteProofs
+	// get complete proofs, by their digest, see proofstore.go
+	completeProofs, ok := LoadProofs(vfData.(*VerificationData).RequestID, vfData.(*VerificationData).ProofsDigest)
+	if !ok {
+		logger.Lvl1("Unknown complete proofs, node refuses to sign")
+		return false
+	}
 
 	// get conode and root keys
 	// verify all the proofs of the protocol
 	if !completeProofs.VerifyCompleteProofs() {
+		logger.Lvl1("Invalid complete proofs, node refuses to sign")
 		return false
 	}
 
@@ -120,45 +184,61 @@ func verificationFunctionStructured(msg, data []byte) bool {
 
 		// first check that the constributions of the root's children indeed
 		// sum up to the consensus filter proposed for the decryption protocol
-		encryptedCBFSet := vfData.(*VerificationData).EncryptedCBFSet
+		encryptedCBFSet := new(lib.CipherVector)
+		if err := encryptedCBFSet.Unpack(vfData.(*VerificationData).PackedCBFSet); err != nil {
+			logger.Lvl1("Invalid encrypted CBF set, node refuses to sign", "error", err)
+			return false
+		}
 		if !rootProofs.AggregationProof.VerifyAggregationProofWithAggregation(encryptedCBFSet) {
+			logger.Lvl1("Invalid aggregation proof of the root, node refuses to sign")
 			return false
 		}
 
 		// convert byte arrays to kyber.Point arrays
 		partialsKyber := make(map[int][]kyber.Point)
 		for k, p := range vfData.(*VerificationData).Partials {
-			partialsKyber[k] = lib.BytesToAbstractPoints(p)
+			partialsKyber[k], err = lib.BytesToAbstractPoints(p)
+			if err != nil {
+				logger.Lvl1("Invalid partials, node refuses to sign", "share", k, "error", err)
+				return false
+			}
 		}
 
 		// reconstruct consensus spectral Bloom filter
-		reconstructed, err := lib.ReconstructVectorFromPartials(len(completeProofs), vfData.(*VerificationData).Threshold, partialsKyber)
+		// some conodes may have failed during the consensus, so the
+		// number of shares is the size of the roster
+		reconstructed, err := lib.ReconstructVectorFromPartials(len(rootProofs.Roster.List), vfData.(*VerificationData).Threshold, partialsKyber)
 		if err != nil {
-			log.Lvl1("Impossible to reconstruct consensus vector, node refuses to sign")
+			logger.Lvl1("Impossible to reconstruct consensus vector, node refuses to sign", "error", err)
 			return false
 		}
 
 		// check if reconstruction is correct
 		for i := range reconstructed {
 			if reconstructed[i] != consensusBloomSet[i] {
+				logger.Lvl1("Wrong reconstruction of the consensus Bloom filter, node refuses to sign", "bucket", i)
 				return false
 			}
 		}
 	}
 
+	logger.Lvl3("Proposed consensus page verified")
 	return true
 }
 
 func NewSignUnstructuredProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 	log.Lvl4("Creating NewSignProtocol")
-	return ftcosiprotocol.NewFtCosi(n, verificationFunctionUnstructured, NameSubSignUnstructured, ftcosiprotocol.EdDSACompatibleCosiSuite)
+	return ftcosiprotocol.NewFtCosi(n, verificationFunctionUnstructured, NameSubSignUnstructured, decenarch.CosiSuite)
 }
 
 func NewSubSignUnstructuredProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 	log.Lvl4("Creating NewSubSignProtocol")
-	return ftcosiprotocol.NewSubFtCosi(n, verificationFunctionUnstructured, ftcosiprotocol.EdDSACompatibleCosiSuite)
+	return ftcosiprotocol.NewSubFtCosi(n, verificationFunctionUnstructured, decenarch.CosiSuite)
 }
 
-func verificationFunctionUnstructured(msg, data []byte) bool {
-	return true
+// skippedLeaf tells if the leaf n of a proposed page is not verified. There
+// are problems with the empty script elements with the Go parser, but since
+// they are not important we simply skip them.
+func skippedLeaf(n *html.Node) bool {
+	return n.Type == html.ElementNode && (n.Data == "noscript" || n.Data == "script")
 }
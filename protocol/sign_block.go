@@ -0,0 +1,153 @@
+package protocol
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/network"
+
+	ftcosiprotocol "gopkg.in/dedis/cothority.v2/ftcosi/protocol"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// The content of a skipblock is signed with its own protocol before the block
+// is stored, so that the conode storing the block cannot reorder or drop the
+// pages signed by the other conodes
+const NameSignBlock = "SignBlock"
+const NameSubSignBlock = "Sub" + NameSignBlock
+
+// BlockMaxAge is the maximal age of the timestamp of a block the conodes
+// accept to sign
+const BlockMaxAge = 10 * time.Minute
+
+func init() {
+	// as VerificationData, this message is only used to marshal the data
+	// of the verification function
+	network.RegisterMessage(BlockVerificationData{})
+
+	onet.GlobalProtocolRegister(NameSignBlock, NewSignBlockProtocol)
+	onet.GlobalProtocolRegister(NameSubSignBlock, NewSubSignBlockProtocol)
+}
+
+// BlockVerificationData holds the data a conode needs to verify the content
+// of a block
+//    - Publics are the public keys of the roster signing the pages
+//    - Threshold is the number of signatures needed for a page
+type BlockVerificationData struct {
+	RequestID string
+	ConodeKey string
+	Threshold int
+	Publics   []kyber.Point
+}
+
+func NewSignBlockProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewSignBlockProtocol")
+	return ftcosiprotocol.NewFtCosi(n, verificationFunctionBlock, NameSubSignBlock, decenarch.CosiSuite)
+}
+
+func NewSubSignBlockProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewSubSignBlockProtocol")
+	return ftcosiprotocol.NewSubFtCosi(n, verificationFunctionBlock, decenarch.CosiSuite)
+}
+
+// NewSubSignBlockCheckedProtocol is NewSubSignBlockProtocol with the
+// additional check of the payload done by the conode before signing, e.g. to
+// keep the content of the pages
+func NewSubSignBlockCheckedProtocol(n *onet.TreeNodeInstance, check func(payload []byte) error) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewSubSignBlockProtocol")
+	return ftcosiprotocol.NewSubFtCosi(n, BlockCheckedVerification(check), decenarch.CosiSuite)
+}
+
+// BlockCheckedVerification returns the verification function of
+// NewSubSignBlockCheckedProtocol
+func BlockCheckedVerification(check func(payload []byte) error) ftcosiprotocol.VerificationFn {
+	return func(msg, data []byte) bool {
+		if !verificationFunctionBlock(msg, data) {
+			return false
+		}
+		if err := check(msg); err != nil {
+			log.Lvl1("Block refused by the conode:", err)
+			return false
+		}
+		return true
+	}
+}
+
+// verificationFunctionBlock checks that msg is the payload of a recent block
+// whose pages and unchanged records all carry a valid collective signature
+func verificationFunctionBlock(msg, data []byte) bool {
+	_, vfData, err := network.Unmarshal(data, decenarch.Suite)
+	if err != nil {
+		log.Lvl1("Impossible to decode verification data, node refuses to sign")
+		return false
+	}
+	vd := vfData.(*BlockVerificationData)
+	logger := lib.NewLogger(vd.RequestID, vd.ConodeKey).With("protocol", NameSignBlock)
+
+	if err := VerifyBlockPayload(msg, vd.Publics, vd.Threshold, Now()); err != nil {
+		logger.Lvl1("Invalid block, node refuses to sign", "error", err)
+		return false
+	}
+	logger.Lvl3("Proposed block verified")
+	return true
+}
+
+// VerifyBlockPayload returns an error if payload is not the payload of a
+// block assembled less than BlockMaxAge before now, or if one of its pages or
+// unchanged records is not collectively signed by threshold conodes of
+// publics
+func VerifyBlockPayload(payload []byte, publics []kyber.Point, threshold int, now time.Time) error {
+	var block decenarch.Block
+	if err := json.Unmarshal(payload, &block); err != nil {
+		return err
+	}
+	if block.Sig != nil {
+		return errors.New("block payload contains a signature")
+	}
+	if len(block.Pages) == 0 && len(block.Unchanged) == 0 {
+		return errors.New("block without pages")
+	}
+	if block.Mirror != nil {
+		return errors.New("block payload contains a mirrored block")
+	}
+	t, err := time.ParseInLocation(decenarch.StatTimeFormat, block.Timestamp, time.Local)
+	if err != nil {
+		return err
+	}
+	if now.Sub(t) > BlockMaxAge || t.Sub(now) > BlockMaxAge {
+		return fmt.Errorf("block timestamp %s is too far from local time", block.Timestamp)
+	}
+
+	for i, page := range block.Pages {
+		if page.Sig == nil {
+			return fmt.Errorf("page %d (%s) is not signed", i, page.Url)
+		}
+		b, err := base64.StdEncoding.DecodeString(page.Page)
+		if err != nil {
+			return fmt.Errorf("page %d (%s): %v", i, page.Url, err)
+		}
+		if err := lib.VerifySignature(page.Scheme, publics, page.SignerKeys, b, page.Sig.Signature, threshold); err != nil {
+			return fmt.Errorf("page %d (%s): %v", i, page.Url, err)
+		}
+		if page.PageHash != "" && page.PageHash != lib.ContentHash(b) {
+			return fmt.Errorf("page %d (%s) does not match its content hash", i, page.Url)
+		}
+	}
+	for i, u := range block.Unchanged {
+		if u.Sig == nil {
+			return fmt.Errorf("unchanged record %d (%s) is not signed", i, u.Url)
+		}
+		if err := lib.VerifySignature(u.Scheme, publics, u.SignerKeys, u.Message(), u.Sig.Signature, threshold); err != nil {
+			return fmt.Errorf("unchanged record %d (%s): %v", i, u.Url, err)
+		}
+	}
+	return nil
+}
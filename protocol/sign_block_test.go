@@ -0,0 +1,55 @@
+package protocol
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	cosiservice "gopkg.in/dedis/cothority.v2/ftcosi/service"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/util/key"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestVerifyBlockPayload(t *testing.T) {
+	now := time.Now()
+	publics := []kyber.Point{key.NewKeyPair(decenarch.Suite).Public}
+	page := decenarch.Webstore{
+		Url:  "http://example.com",
+		Page: base64.StdEncoding.EncodeToString([]byte("page")),
+	}
+	payload := func(b *decenarch.Block) []byte {
+		p, err := b.Payload()
+		require.NoError(t, err)
+		return p
+	}
+
+	// a block without pages is refused
+	empty := &decenarch.Block{Timestamp: now.Format(decenarch.StatTimeFormat)}
+	require.Error(t, VerifyBlockPayload(payload(empty), publics, 1, now))
+
+	// an unsigned page is refused
+	unsigned := &decenarch.Block{Pages: []decenarch.Webstore{page}, Timestamp: now.Format(decenarch.StatTimeFormat)}
+	require.Error(t, VerifyBlockPayload(payload(unsigned), publics, 1, now))
+
+	// a page with an invalid signature is refused
+	page.Sig = &cosiservice.SignatureResponse{Signature: []byte("invalid")}
+	invalid := &decenarch.Block{Pages: []decenarch.Webstore{page}, Timestamp: now.Format(decenarch.StatTimeFormat)}
+	require.Error(t, VerifyBlockPayload(payload(invalid), publics, 1, now))
+
+	// an old block is refused
+	old := &decenarch.Block{Pages: []decenarch.Webstore{page}, Timestamp: now.Add(-2 * BlockMaxAge).Format(decenarch.StatTimeFormat)}
+	err := VerifyBlockPayload(payload(old), publics, 1, now)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "too far")
+
+	// the payload never contains the signature of the block
+	signed := &decenarch.Block{Pages: []decenarch.Webstore{page}, Timestamp: now.Format(decenarch.StatTimeFormat), Sig: page.Sig}
+	var decoded decenarch.Block
+	require.NoError(t, json.Unmarshal(payload(signed), &decoded))
+	require.Nil(t, decoded.Sig)
+	require.Equal(t, payload(invalid), payload(signed))
+}
@@ -0,0 +1,289 @@
+package protocol
+
+/*
+The sign_bls.go defines the signing protocol of the archives set up with
+decenarch.SchemeBLS. The tree has a depth of one: the root sends the message
+to all the conodes, which verify it with the verification function of the
+ftcosi protocol of the same purpose, see Verification, and answer with their
+BLS signature and their BLS key. The root checks every signature and
+aggregates the valid ones, see lib.AggregateBLS. There is a single round
+trip, and the conodes that don't answer in time are left out of the mask of
+the signers, as with ftcosi.
+*/
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/bls"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/network"
+
+	ftcosiprotocol "gopkg.in/dedis/cothority.v2/ftcosi/protocol"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// NameSignBLS is the name of the BLS signing protocol
+const NameSignBLS = "SignBLS"
+
+// DefaultBLSTimeout is the default time the root waits for the signatures
+const DefaultBLSTimeout = time.Minute
+
+func init() {
+	network.RegisterMessage(BLSAnnouncement{})
+	network.RegisterMessage(BLSReply{})
+	onet.GlobalProtocolRegister(NameSignBLS, NewSignBLSProtocol)
+}
+
+// verificationFunctions are the verification functions of the signing
+// protocols, by name, without the checks added by the conodes
+var verificationFunctions = map[string]ftcosiprotocol.VerificationFn{
+	NameSignStructured:   verificationFunctionStructured,
+	NameSignUnstructured: verificationFunctionUnstructured,
+	NameSignMerkle:       verificationFunctionMerkle,
+	NameSignTimestamp:    verificationFunctionTimestamp,
+	NameSignBlock:        verificationFunctionBlock,
+	NameSignMirror:       verificationFunctionMirror,
+	NameSignUnchanged:    verificationFunctionUnchanged,
+}
+
+// VerificationFunction returns the verification function of the signing
+// protocol name, nil if there is none
+func VerificationFunction(name string) ftcosiprotocol.VerificationFn {
+	return verificationFunctions[name]
+}
+
+// Verification returns the verification function applied by the conode to
+// the messages of the ftcosi protocol name and the verification data of the
+// conode for the save requestID
+type Verification func(name, requestID string) (ftcosiprotocol.VerificationFn, []byte, error)
+
+// BLSAnnouncement asks the conodes to sign Msg
+//    - Name is the name of the ftcosi protocol whose verification applies
+//    - Version is the version of the protocol run by the root, see
+//      version.go
+type BLSAnnouncement struct {
+	RequestID string
+	Name      string
+	Msg       []byte
+	Version   int32
+}
+
+// StructBLSAnnouncement is a BLSAnnouncement received from the root
+type StructBLSAnnouncement struct {
+	*onet.TreeNode
+	BLSAnnouncement
+}
+
+// BLSReply is the BLS signature of a conode, nil if it refused to sign, and
+// its BLS key
+type BLSReply struct {
+	Signature []byte
+	Key       decenarch.SignerKey
+}
+
+// StructBLSReply is a BLSReply received from a child
+type StructBLSReply struct {
+	*onet.TreeNode
+	BLSReply
+}
+
+// SignBLS holds the state of a conode running the BLS signing protocol
+//    - Name is the name of the ftcosi protocol whose verification applies,
+//      and Msg the message to sign, set on the root
+//    - Data is the verification data of the root, as for ftcosi
+//    - Verification gives the verification function and data of the conode
+//    - BLSKey is the BLS private key of the conode
+//    - Timeout is the time the root waits for the signatures
+//    - FinalSignature receives the aggregated signature on the root, nil if
+//      no conode signed
+//    - Keys are the BLS keys of the signers, set on the root before
+//      FinalSignature
+//    - Version is the version of the protocol announced by the root
+type SignBLS struct {
+	*onet.TreeNodeInstance
+	RequestID      string
+	Name           string
+	Msg            []byte
+	Data           []byte
+	Verification   Verification
+	BLSKey         kyber.Scalar
+	Timeout        time.Duration
+	FinalSignature chan []byte
+	Keys           []decenarch.SignerKey
+	Version        int32
+
+	mutex    sync.Mutex
+	replies  int
+	signers  []kyber.Point
+	sigs     map[int][]byte
+	finished bool
+	timeout  *time.Timer
+}
+
+// NewSignBLSProtocol returns a new instance of the BLS signing protocol
+func NewSignBLSProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	p := &SignBLS{
+		TreeNodeInstance: n,
+		Version:          Version,
+		Timeout:          DefaultBLSTimeout,
+		FinalSignature:   make(chan []byte, 1),
+		signers:          make([]kyber.Point, len(n.Roster().List)),
+		sigs:             make(map[int][]byte),
+	}
+	for _, handler := range []interface{}{p.HandleAnnouncement, p.HandleReply} {
+		if err := p.RegisterHandler(handler); err != nil {
+			return nil, errors.New("couldn't register handler: " + err.Error())
+		}
+	}
+	return p, nil
+}
+
+// Start sends the message to the conodes and signs it on the root
+func (p *SignBLS) Start() error {
+	if p.Verification == nil || p.BLSKey == nil {
+		return errors.New("no verification or BLS key for the BLS signing protocol")
+	}
+	// the root signs before the replies of the children can end the
+	// protocol
+	reply := p.reply(p.Name, p.RequestID, p.Msg, p.Data)
+	p.add(p.TreeNode(), reply, false)
+	if err := p.SendToChildren(&BLSAnnouncement{RequestID: p.RequestID, Name: p.Name, Msg: p.Msg, Version: p.Version}); err != nil {
+		p.logger().Lvl2("Couldn't reach all the conodes", "error", err)
+	}
+	if len(p.Children()) == 0 {
+		p.finish()
+		return nil
+	}
+	// the replies may have ended the protocol already
+	p.mutex.Lock()
+	if !p.finished {
+		p.timeout = time.AfterFunc(p.Timeout, p.finish)
+	}
+	p.mutex.Unlock()
+	return nil
+}
+
+// HandleAnnouncement verifies and signs the message of the root
+func (p *SignBLS) HandleAnnouncement(msg StructBLSAnnouncement) error {
+	defer p.Done()
+	p.RequestID = msg.RequestID
+
+	// a node that doesn't support the version of the root replies without
+	// signature
+	version, err := NegotiateVersion(msg.Version)
+	if err != nil {
+		p.logger().Lvl1("Refusing to sign", "error", err)
+		return p.SendToParent(&BLSReply{})
+	}
+	p.Version = version
+	reply := p.reply(msg.Name, msg.RequestID, msg.Msg, nil)
+	return p.SendToParent(&reply)
+}
+
+// HandleReply collects the signature of a conode on the root
+func (p *SignBLS) HandleReply(msg StructBLSReply) error {
+	if p.add(msg.TreeNode, msg.BLSReply, true) {
+		p.finish()
+	}
+	return nil
+}
+
+// reply returns the reply of the conode to the message of the protocol
+// name, without signature if the verification function refuses it. data is
+// the verification data, nil for the data of the conode.
+func (p *SignBLS) reply(name, requestID string, msg, data []byte) BLSReply {
+	var reply BLSReply
+	if p.Verification == nil || p.BLSKey == nil {
+		p.logger().Lvl1("No verification or BLS key, node refuses to sign")
+		return reply
+	}
+	key, err := lib.NewSignerKey(p.Private(), p.BLSKey)
+	if err != nil {
+		p.logger().Error("Couldn't endorse the BLS key", "error", err)
+		return reply
+	}
+	reply.Key = *key
+	verify, local, err := p.Verification(name, requestID)
+	if err != nil || verify == nil {
+		p.logger().Lvl1("No verification function, node refuses to sign", "name", name, "error", err)
+		return reply
+	}
+	if data == nil {
+		data = local
+	}
+	if !verify(msg, data) {
+		return reply
+	}
+	if reply.Signature, err = bls.Sign(decenarch.BLSSuite, p.BLSKey, msg); err != nil {
+		p.logger().Error("Couldn't sign", "error", err)
+	}
+	return reply
+}
+
+// add records the reply of the conode of node, and returns true if all the
+// conodes replied. The signatures with an invalid key or an invalid
+// signature are left out.
+func (p *SignBLS) add(node *onet.TreeNode, reply BLSReply, child bool) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if child {
+		p.replies++
+	}
+	all := p.replies >= len(p.Children())
+	if p.finished || reply.Signature == nil {
+		return all
+	}
+	logger := p.logger().With("conode", node.ServerIdentity.Address.String())
+	public, err := lib.SignerPublic(reply.Key, node.ServerIdentity.Public)
+	if err != nil {
+		logger.Lvl1("Invalid BLS key", "error", err)
+		return all
+	}
+	if err := bls.Verify(decenarch.BLSSuite, public, p.Msg, reply.Signature); err != nil {
+		logger.Lvl1("Invalid BLS signature", "error", err)
+		return all
+	}
+	p.signers[node.RosterIndex] = public
+	p.sigs[node.RosterIndex] = reply.Signature
+	p.Keys = append(p.Keys, reply.Key)
+	return all
+}
+
+// finish aggregates the signatures received and ends the protocol, once
+func (p *SignBLS) finish() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.finished {
+		return
+	}
+	p.finished = true
+	if p.timeout != nil {
+		p.timeout.Stop()
+	}
+	defer p.Done()
+	if len(p.sigs) < len(p.Children())+1 {
+		p.logger().Lvl2("Not all the conodes signed", "signers", len(p.sigs), "conodes", len(p.Children())+1)
+	}
+	sig, err := lib.AggregateBLS(p.signers, p.sigs)
+	if err != nil {
+		p.logger().Lvl1("Couldn't aggregate the BLS signatures", "error", err)
+		sig = nil
+	}
+	p.FinalSignature <- sig
+}
+
+// Stop ends the protocol on the root before its timeout, with the signatures
+// received so far
+func (p *SignBLS) Stop() {
+	p.finish()
+}
+
+// logger returns the structured logger of the conode for the protocol
+func (p *SignBLS) logger() *lib.Logger {
+	return lib.NewLogger(p.RequestID, p.ServerIdentity().Address.String()).With("protocol", NameSignBLS)
+}
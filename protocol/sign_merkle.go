@@ -0,0 +1,168 @@
+package protocol
+
+import (
+	"bytes"
+
+	"golang.org/x/net/html"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/network"
+
+	ftcosiprotocol "gopkg.in/dedis/cothority.v2/ftcosi/protocol"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/lib/canonhtml"
+)
+
+// The pages agreed on with the Merkle engine are signed with their own
+// protocol, since the verification function checks the Merkle commitments
+// instead of the Bloom filter
+const NameSignMerkle = "SignMerkle"
+const NameSubSignMerkle = "Sub" + NameSignMerkle
+
+func init() {
+	// as VerificationData, this message is only used to marshal the data
+	// of the verification function
+	network.RegisterMessage(MerkleVerificationData{})
+
+	onet.GlobalProtocolRegister(NameSignMerkle, NewSignMerkleProtocol)
+	onet.GlobalProtocolRegister(NameSubSignMerkle, NewSubSignMerkleProtocol)
+}
+
+// MerkleVerificationData holds the data a conode needs to verify a page
+// agreed on with the Merkle engine
+//    - Leaves are the unique leaves of the page fetched by the conode
+//    - Commitments are the commitments the root used to build the page
+//    - ConsensusSignature is the signature of the root on the
+//      ConsensusDigest of the data, see ConsensusCheck
+//    - Extractor is the name of the leaf extractor of the save, see
+//      lib.GetLeafExtractor
+//    - Publics are the public keys of the roster given at setup, only the
+//      commitments of these conodes are counted
+type MerkleVerificationData struct {
+	RequestID          string
+	ConodeKey          string
+	Threshold          int
+	Leaves             []string
+	Commitments        []MerkleCommitment
+	ConsensusSignature []byte
+	Url                string
+	AddsUrl            []string
+	Extractor          string
+	Publics            []kyber.Point
+}
+
+// ConsensusDigest returns the digest of the consensus data of d
+func (d *MerkleVerificationData) ConsensusDigest() []byte {
+	return ConsensusDigest(d.RequestID, nil, nil, nil, d.Commitments, d.Url, d.AddsUrl)
+}
+
+func NewSignMerkleProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewSignMerkleProtocol")
+	return ftcosiprotocol.NewFtCosi(n, verificationFunctionMerkle, NameSubSignMerkle, decenarch.CosiSuite)
+}
+
+func NewSubSignMerkleProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewSubSignMerkleProtocol")
+	return ftcosiprotocol.NewSubFtCosi(n, verificationFunctionMerkle, decenarch.CosiSuite)
+}
+
+// NewSubSignMerkleCheckedProtocol is NewSubSignMerkleProtocol with the
+// additional checks of the consensus data and of the list of the additional
+// resources of the page, with the normalizer agreed at setup, done by the conode
+// before signing
+func NewSubSignMerkleCheckedProtocol(n *onet.TreeNodeInstance, check ConsensusCheck, normalizer *lib.URLNormalizer) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewSubSignMerkleProtocol")
+	return ftcosiprotocol.NewSubFtCosi(n, MerkleCheckedVerification(check, normalizer), decenarch.CosiSuite)
+}
+
+// MerkleCheckedVerification returns the verification function of
+// NewSubSignMerkleCheckedProtocol
+func MerkleCheckedVerification(check ConsensusCheck, normalizer *lib.URLNormalizer) ftcosiprotocol.VerificationFn {
+	return func(msg, data []byte) bool {
+		if !verificationFunctionMerkle(msg, data) {
+			return false
+		}
+		_, vfData, err := network.Unmarshal(data, decenarch.Suite)
+		if err != nil {
+			return false
+		}
+		vd := vfData.(*MerkleVerificationData)
+		if err := check(vd.RequestID, vd.ConsensusDigest(), vd.ConsensusSignature); err != nil {
+			lib.NewLogger(vd.RequestID, vd.ConodeKey).With("protocol", NameSignMerkle).Lvl1("Invalid consensus data, node refuses to sign", "error", err)
+			return false
+		}
+		if err := CheckPageLinks(vd.Url, msg, vd.AddsUrl, normalizer); err != nil {
+			lib.NewLogger(vd.RequestID, vd.ConodeKey).With("protocol", NameSignMerkle).Lvl1("Invalid list of additional resources, node refuses to sign", "error", err)
+			return false
+		}
+		return true
+	}
+}
+
+// verificationFunctionMerkle accepts to sign the page if all the commitments
+// are valid and every leaf of the page is a leaf of the conode committed by at
+// least threshold conodes
+func verificationFunctionMerkle(msg, data []byte) bool {
+	_, vfData, err := network.Unmarshal(data, decenarch.Suite)
+	if err != nil {
+		log.Lvl1("Impossible ot decode verification data, node refuses to sign")
+		return false
+	}
+	vd := vfData.(*MerkleVerificationData)
+	logger := lib.NewLogger(vd.RequestID, vd.ConodeKey).With("protocol", NameSignMerkle)
+
+	if len(vd.Publics) == 0 {
+		logger.Lvl1("No roster to check the commitments, node refuses to sign")
+		return false
+	}
+	for _, c := range vd.Commitments {
+		if err := c.Verify(vd.Publics); err != nil {
+			logger.Lvl1("Invalid commitment, node refuses to sign", "error", err)
+			return false
+		}
+	}
+	consensus := ReconcileCommitments(vd.Commitments, vd.Threshold, vd.Publics)
+
+	// see verificationFunctionStructured
+	if !canonhtml.IsCanonical(msg) {
+		logger.Lvl1("Proposed HTML page not in its canonical serialization, node refuses to sign")
+		return false
+	}
+	rootNode, err := html.Parse(bytes.NewReader(msg))
+	if err != nil {
+		logger.Lvl1("Impossible to parse the proposed HTML page, node refuses to sign", "error", err)
+		return false
+	}
+	extractor, err := lib.GetLeafExtractor(vd.Extractor)
+	if err != nil {
+		logger.Lvl1("Unknown leaf extractor, node refuses to sign", "error", err)
+		return false
+	}
+	local := make(map[string]bool)
+	for _, l := range vd.Leaves {
+		local[l] = true
+	}
+	valid := true
+	lib.WalkLeaves(rootNode, extractor, func(n *html.Node, l string) {
+		// see verificationFunctionStructured
+		if !valid || skippedLeaf(n) {
+			return
+		}
+		if !local[l] {
+			logger.Lvl1("Leaf of the proposed page is not a leaf of the conode, node refuses to sign", "leaf", l)
+			valid = false
+		} else if !consensus[string(lib.LeafHash(l))] {
+			logger.Lvl1("Leaf of the proposed page is not committed by enough conodes, node refuses to sign", "leaf", l)
+			valid = false
+		}
+	})
+	if !valid {
+		return false
+	}
+
+	logger.Lvl3("Proposed consensus page verified")
+	return true
+}
@@ -0,0 +1,94 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/network"
+
+	ftcosiprotocol "gopkg.in/dedis/cothority.v2/ftcosi/protocol"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	skip "github.com/dedis/student_18_decenar/skip"
+)
+
+// The blocks mirrored from the archive of another cothority are signed with
+// their own protocol, every conode checking the collective signatures of the
+// other roster before signing the mirror record
+const NameSignMirror = "SignMirror"
+const NameSubSignMirror = "Sub" + NameSignMirror
+
+func init() {
+	// as VerificationData, this message is only used to marshal the data
+	// of the verification function
+	network.RegisterMessage(MirrorVerificationData{})
+
+	onet.GlobalProtocolRegister(NameSignMirror, NewSignMirrorProtocol)
+	onet.GlobalProtocolRegister(NameSubSignMirror, NewSubSignMirrorProtocol)
+}
+
+// MirrorVerificationData holds the data a conode needs to verify a mirror
+// record
+type MirrorVerificationData struct {
+	RequestID string
+	ConodeKey string
+}
+
+func NewSignMirrorProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewSignMirrorProtocol")
+	return ftcosiprotocol.NewFtCosi(n, verificationFunctionMirror, NameSubSignMirror, decenarch.CosiSuite)
+}
+
+func NewSubSignMirrorProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewSubSignMirrorProtocol")
+	return ftcosiprotocol.NewSubFtCosi(n, verificationFunctionMirror, decenarch.CosiSuite)
+}
+
+// verificationFunctionMirror checks that msg is the payload of a recent
+// mirror record of a block collectively signed by the other roster
+func verificationFunctionMirror(msg, data []byte) bool {
+	_, vfData, err := network.Unmarshal(data, decenarch.Suite)
+	if err != nil {
+		log.Lvl1("Impossible to decode verification data, node refuses to sign")
+		return false
+	}
+	vd := vfData.(*MirrorVerificationData)
+	logger := lib.NewLogger(vd.RequestID, vd.ConodeKey).With("protocol", NameSignMirror)
+
+	if err := VerifyMirrorPayload(msg, Now()); err != nil {
+		logger.Lvl1("Invalid mirror record, node refuses to sign", "error", err)
+		return false
+	}
+	logger.Lvl3("Proposed mirror record verified")
+	return true
+}
+
+// VerifyMirrorPayload returns an error if payload is not the payload of a
+// block assembled less than BlockMaxAge before now and only holding a valid
+// mirrored block, see skip.VerifyMirror
+func VerifyMirrorPayload(payload []byte, now time.Time) error {
+	var block decenarch.Block
+	if err := json.Unmarshal(payload, &block); err != nil {
+		return err
+	}
+	if block.Sig != nil {
+		return errors.New("block payload contains a signature")
+	}
+	if block.Mirror == nil || len(block.Pages) > 0 {
+		return errors.New("block is not a mirror record")
+	}
+	t, err := time.ParseInLocation(decenarch.StatTimeFormat, block.Timestamp, time.Local)
+	if err != nil {
+		return err
+	}
+	if now.Sub(t) > BlockMaxAge || t.Sub(now) > BlockMaxAge {
+		return fmt.Errorf("block timestamp %s is too far from local time", block.Timestamp)
+	}
+	_, err = skip.VerifyMirror(block.Mirror)
+	return err
+}
@@ -0,0 +1,81 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/network"
+
+	ftcosiprotocol "gopkg.in/dedis/cothority.v2/ftcosi/protocol"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// The pruning of the storage tiers is approved with its own protocol, the
+// collective signature of the prune message proving that a threshold of
+// conodes accepted it
+const NamePrune = "Prune"
+const NameSubPrune = "Sub" + NamePrune
+
+func init() {
+	// as VerificationData, this message is only used to marshal the data
+	// of the verification function
+	network.RegisterMessage(PruneVerificationData{})
+
+	onet.GlobalProtocolRegister(NamePrune, NewPruneProtocol)
+	onet.GlobalProtocolRegister(NameSubPrune, NewSubPruneProtocol)
+}
+
+// PruneVerificationData holds the data a conode needs to approve a pruning
+//    - MinRetention is the minimal age in seconds of the pages the conode
+//      accepts to prune, zero if the conode never prunes
+type PruneVerificationData struct {
+	RequestID    string
+	ConodeKey    string
+	MinRetention int64
+}
+
+func NewPruneProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewPruneProtocol")
+	return ftcosiprotocol.NewFtCosi(n, verificationFunctionPrune, NameSubPrune, decenarch.CosiSuite)
+}
+
+func NewSubPruneProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewSubPruneProtocol")
+	return ftcosiprotocol.NewSubFtCosi(n, verificationFunctionPrune, decenarch.CosiSuite)
+}
+
+// verificationFunctionPrune approves the pruning of the pages older than the
+// minimal retention of the conode
+func verificationFunctionPrune(msg, data []byte) bool {
+	_, vfData, err := network.Unmarshal(data, decenarch.Suite)
+	if err != nil {
+		log.Lvl1("Impossible to decode verification data, node refuses to sign")
+		return false
+	}
+	vd := vfData.(*PruneVerificationData)
+	logger := lib.NewLogger(vd.RequestID, vd.ConodeKey).With("protocol", NamePrune)
+
+	// the message is a constant prefix followed by the time
+	prefix := decenarch.PruneMessage(0)
+	prefix = prefix[:len(prefix)-8]
+	if len(msg) != len(prefix)+8 || !bytes.HasPrefix(msg, prefix) {
+		logger.Lvl1("Invalid prune message, node refuses to sign")
+		return false
+	}
+	if vd.MinRetention <= 0 {
+		logger.Lvl1("Pruning disabled, node refuses to sign")
+		return false
+	}
+	before := time.Unix(int64(binary.BigEndian.Uint64(msg[len(msg)-8:])), 0)
+	if time.Since(before) < time.Duration(vd.MinRetention)*time.Second {
+		logger.Lvl1("Pages too recent to be pruned, node refuses to sign", "before", before)
+		return false
+	}
+	logger.Lvl2("Pruning approved", "before", before)
+	return true
+}
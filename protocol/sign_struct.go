@@ -1,17 +1,109 @@
 package protocol
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"sort"
+
 	"github.com/dedis/student_18_decenar/lib"
 )
 
+// VerificationData holds the data a conode needs to verify a page agreed on
+// with the CBF engine. ConsensusSignature is the signature of the root on
+// the ConsensusDigest of the data, see ConsensusCheck. The encrypted CBF set
+// is packed by lib.CipherVector.Pack. Url and AddsUrl are the URL of the page
+// and the list of its additional resources, see CheckPageLinks. The complete
+// proofs are given by ProofsDigest, resolved from the proofs the conode
+// received at the end of the consensus for the same save, see StoreProofs.
+// CompleteProofs is unused, it was set by the roots predating the digests.
+// Extractor is the name of the leaf extractor of the save, see
+// lib.GetLeafExtractor.
 type VerificationData struct {
+	RequestID           string
 	RootKey             string
 	Threshold           int
 	ConodeKey           string
 	Partials            map[int][]byte
-	EncryptedCBFSet     *lib.CipherVector
+	PackedCBFSet        []byte
 	Leaves              []string
 	CompleteProofs      lib.CompleteProofs
 	ConsensusSet        []int64
 	ConsensusParameters []uint64
+	ConsensusSignature  []byte
+	Url                 string
+	AddsUrl             []string
+	ProofsDigest        []byte
+	Extractor           string
+}
+
+// ConsensusDigest returns the digest of the consensus data of d
+func (d *VerificationData) ConsensusDigest() []byte {
+	return ConsensusDigest(d.RequestID, d.Partials, d.ConsensusSet, d.ConsensusParameters, nil, d.Url, d.AddsUrl)
+}
+
+// ConsensusCheck is called by the conodes, after the verification function of
+// the signing protocols, with the request, the ConsensusDigest and the
+// ConsensusSignature of the verification data. It returns an error if the
+// consensus data is not the data the root propagated to the conode.
+type ConsensusCheck func(requestID string, digest, signature []byte) error
+
+// ConsensusDigest returns the digest of the consensus data the root hands to
+// the other conodes before the signature of a page. The root signs this
+// digest, so that a conode can check that the data it verifies is the data
+// the root propagated to it, and not data forged for this conode only. The
+// digest covers the URL of the page and the list of its additional resources
+// adds.
+func ConsensusDigest(requestID string, partials map[int][]byte, set []int64, params []uint64, commitments []MerkleCommitment, url string, adds []string) []byte {
+	h := sha256.New()
+	writeBytes(h, []byte(requestID))
+
+	indexes := make([]int, 0, len(partials))
+	for i := range partials {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	binary.Write(h, binary.BigEndian, uint64(len(indexes)))
+	for _, i := range indexes {
+		binary.Write(h, binary.BigEndian, int64(i))
+		writeBytes(h, partials[i])
+	}
+
+	binary.Write(h, binary.BigEndian, uint64(len(set)))
+	binary.Write(h, binary.BigEndian, set)
+	binary.Write(h, binary.BigEndian, uint64(len(params)))
+	binary.Write(h, binary.BigEndian, params)
+
+	binary.Write(h, binary.BigEndian, uint64(len(commitments)))
+	for _, c := range commitments {
+		var public []byte
+		if c.Public != nil {
+			public, _ = c.Public.MarshalBinary()
+		}
+		writeBytes(h, public)
+		binary.Write(h, binary.BigEndian, uint64(len(c.Hashes)))
+		for _, leaf := range c.Hashes {
+			writeBytes(h, leaf)
+		}
+		writeBytes(h, c.Root)
+		writeBytes(h, []byte(c.CertificateHash))
+		binary.Write(h, binary.BigEndian, uint64(len(c.Redirects)))
+		for _, url := range c.Redirects {
+			writeBytes(h, []byte(url))
+		}
+		writeBytes(h, c.Signature)
+	}
+
+	writeBytes(h, []byte(url))
+	binary.Write(h, binary.BigEndian, uint64(len(adds)))
+	for _, add := range adds {
+		writeBytes(h, []byte(add))
+	}
+	return h.Sum(nil)
+}
+
+// writeBytes writes b to h, prefixed with its length
+func writeBytes(h hash.Hash, b []byte) {
+	binary.Write(h, binary.BigEndian, uint64(len(b)))
+	h.Write(b)
 }
@@ -0,0 +1,91 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/network"
+
+	ftcosiprotocol "gopkg.in/dedis/cothority.v2/ftcosi/protocol"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// The capture time of a page is endorsed with its own protocol, every conode
+// checking the time proposed by the root against its own clock, so that the
+// time of a snapshot does not only depend on the clock of the root
+const NameSignTimestamp = "SignTimestamp"
+const NameSubSignTimestamp = "Sub" + NameSignTimestamp
+
+// TimestampTolerance is the maximal difference between the capture time
+// proposed by the root and the clock of a conode endorsing it
+const TimestampTolerance = 2 * time.Minute
+
+func init() {
+	// as VerificationData, this message is only used to marshal the data
+	// of the verification function
+	network.RegisterMessage(TimestampVerificationData{})
+
+	onet.GlobalProtocolRegister(NameSignTimestamp, NewSignTimestampProtocol)
+	onet.GlobalProtocolRegister(NameSubSignTimestamp, NewSubSignTimestampProtocol)
+}
+
+// TimestampVerificationData holds the data a conode needs to endorse a
+// capture time
+type TimestampVerificationData struct {
+	RequestID string
+	ConodeKey string
+}
+
+func NewSignTimestampProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewSignTimestampProtocol")
+	return ftcosiprotocol.NewFtCosi(n, verificationFunctionTimestamp, NameSubSignTimestamp, decenarch.CosiSuite)
+}
+
+func NewSubSignTimestampProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewSubSignTimestampProtocol")
+	return ftcosiprotocol.NewSubFtCosi(n, verificationFunctionTimestamp, decenarch.CosiSuite)
+}
+
+// verificationFunctionTimestamp endorses the capture times close enough to
+// the clock of the conode
+func verificationFunctionTimestamp(msg, data []byte) bool {
+	_, vfData, err := network.Unmarshal(data, decenarch.Suite)
+	if err != nil {
+		log.Lvl1("Impossible to decode verification data, node refuses to sign")
+		return false
+	}
+	vd := vfData.(*TimestampVerificationData)
+	logger := lib.NewLogger(vd.RequestID, vd.ConodeKey).With("protocol", NameSignTimestamp)
+
+	captured, err := VerifyTimestampMessage(msg, Now())
+	if err != nil {
+		logger.Lvl1("Capture time refused, node refuses to sign", "error", err)
+		return false
+	}
+	logger.Lvl3("Capture time endorsed", "time", captured)
+	return true
+}
+
+// VerifyTimestampMessage returns the capture time of the timestamp message
+// msg, see decenarch.TimestampMessage, or an error if msg is not a timestamp
+// message or if its time is more than TimestampTolerance away from now
+func VerifyTimestampMessage(msg []byte, now time.Time) (time.Time, error) {
+	// the message is a constant prefix followed by the time and the hash
+	prefix := decenarch.TimestampMessage("", 0)
+	prefix = prefix[:len(prefix)-8]
+	if len(msg) < len(prefix)+8 || !bytes.HasPrefix(msg, prefix) {
+		return time.Time{}, errors.New("invalid timestamp message")
+	}
+	captured := time.Unix(int64(binary.BigEndian.Uint64(msg[len(prefix):len(prefix)+8])), 0)
+	if now.Sub(captured) > TimestampTolerance || captured.Sub(now) > TimestampTolerance {
+		return time.Time{}, fmt.Errorf("capture time %s is too far from local time", captured.Format(decenarch.StatTimeFormat))
+	}
+	return captured, nil
+}
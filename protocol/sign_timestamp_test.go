@@ -0,0 +1,36 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestVerifyTimestampMessage(t *testing.T) {
+	now := time.Now()
+	msg := decenarch.TimestampMessage("hash", now.Unix())
+	captured, err := VerifyTimestampMessage(msg, now)
+	require.NoError(t, err)
+	require.Equal(t, now.Unix(), captured.Unix())
+
+	// a conode whose clock is slightly late or early still endorses the time
+	_, err = VerifyTimestampMessage(msg, now.Add(TimestampTolerance/2))
+	require.NoError(t, err)
+	_, err = VerifyTimestampMessage(msg, now.Add(-TimestampTolerance/2))
+	require.NoError(t, err)
+
+	// the times too far from the clock of the conode are refused
+	_, err = VerifyTimestampMessage(msg, now.Add(2*TimestampTolerance))
+	require.Error(t, err)
+	_, err = VerifyTimestampMessage(msg, now.Add(-2*TimestampTolerance))
+	require.Error(t, err)
+
+	// the other messages are refused
+	_, err = VerifyTimestampMessage(decenarch.PruneMessage(now.Unix()), now)
+	require.Error(t, err)
+	_, err = VerifyTimestampMessage([]byte("timestamp"), now)
+	require.Error(t, err)
+}
@@ -0,0 +1,170 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/net/html"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/network"
+
+	ftcosiprotocol "gopkg.in/dedis/cothority.v2/ftcosi/protocol"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// A page identical to its last snapshot is not archived again, the conodes
+// only sign a decenarch.Unchanged record with their own protocol, each conode
+// fetching the page and comparing its leaves to the ones of the snapshot
+const NameSignUnchanged = "SignUnchanged"
+const NameSubSignUnchanged = "Sub" + NameSignUnchanged
+
+func init() {
+	// as VerificationData, this message is only used to marshal the data
+	// of the verification function
+	network.RegisterMessage(UnchangedVerificationData{})
+
+	onet.GlobalProtocolRegister(NameSignUnchanged, NewSignUnchangedProtocol)
+	onet.GlobalProtocolRegister(NameSubSignUnchanged, NewSubSignUnchangedProtocol)
+}
+
+// UnchangedVerificationData holds the data a conode needs to endorse that a
+// page is unchanged
+type UnchangedVerificationData struct {
+	RequestID string
+	ConodeKey string
+}
+
+// UnchangedCheck returns an error if the last snapshot of url in the archive
+// of the conode does not have the content hash pageHash and the leaves of
+// Merkle root digest, computed by the conode from its content, or if the page
+// of url, fetched by the conode, does not have these leaves, see PageDigest
+type UnchangedCheck func(url, pageHash string, digest []byte) error
+
+func NewSignUnchangedProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewSignUnchangedProtocol")
+	return ftcosiprotocol.NewFtCosi(n, verificationFunctionUnchanged, NameSubSignUnchanged, decenarch.CosiSuite)
+}
+
+func NewSubSignUnchangedProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewSubSignUnchangedProtocol")
+	return ftcosiprotocol.NewSubFtCosi(n, verificationFunctionUnchanged, decenarch.CosiSuite)
+}
+
+// NewSubSignUnchangedCheckedProtocol is NewSubSignUnchangedProtocol where the
+// conode fetches the page with check before signing
+func NewSubSignUnchangedCheckedProtocol(n *onet.TreeNodeInstance, check UnchangedCheck) (onet.ProtocolInstance, error) {
+	log.Lvl4("Creating NewSubSignUnchangedProtocol")
+	return ftcosiprotocol.NewSubFtCosi(n, UnchangedCheckedVerification(check), decenarch.CosiSuite)
+}
+
+// UnchangedCheckedVerification returns the verification function of
+// NewSubSignUnchangedCheckedProtocol
+func UnchangedCheckedVerification(check UnchangedCheck) ftcosiprotocol.VerificationFn {
+	return func(msg, data []byte) bool {
+		if !verificationFunctionUnchanged(msg, data) {
+			return false
+		}
+		url, pageHash, digest, _ := ParseUnchangedMessage(msg)
+		if err := check(url, pageHash, digest); err != nil {
+			log.Lvl2("Page not endorsed as unchanged:", err)
+			return false
+		}
+		return true
+	}
+}
+
+// verificationFunctionUnchanged checks that msg is a recent unchanged
+// message, the page itself is checked by UnchangedCheckedVerification
+func verificationFunctionUnchanged(msg, data []byte) bool {
+	_, vfData, err := network.Unmarshal(data, decenarch.Suite)
+	if err != nil {
+		log.Lvl1("Impossible to decode verification data, node refuses to sign")
+		return false
+	}
+	vd := vfData.(*UnchangedVerificationData)
+	logger := lib.NewLogger(vd.RequestID, vd.ConodeKey).With("protocol", NameSignUnchanged)
+
+	_, _, _, checked, err := parseUnchangedMessage(msg)
+	if err == nil {
+		err = checkTime(checked, Now())
+	}
+	if err != nil {
+		logger.Lvl1("Unchanged record refused, node refuses to sign", "error", err)
+		return false
+	}
+	return true
+}
+
+// ParseUnchangedMessage returns the url, the content hash of the snapshot and
+// the digest of the unchanged message msg, see decenarch.UnchangedMessage
+func ParseUnchangedMessage(msg []byte) (url, pageHash string, digest []byte, err error) {
+	url, pageHash, digest, _, err = parseUnchangedMessage(msg)
+	return
+}
+
+// parseUnchangedMessage is ParseUnchangedMessage also returning the time of
+// the check
+func parseUnchangedMessage(msg []byte) (string, string, []byte, time.Time, error) {
+	// the message is a constant prefix followed by the time, the digest,
+	// and the content hash and the url separated by a newline
+	prefix := decenarch.UnchangedMessage("", "", nil, 0)
+	prefix = prefix[:len(prefix)-9]
+	if len(msg) < len(prefix)+8+sha256.Size || !bytes.HasPrefix(msg, prefix) {
+		return "", "", nil, time.Time{}, errors.New("invalid unchanged message")
+	}
+	checked := time.Unix(int64(binary.BigEndian.Uint64(msg[len(prefix):len(prefix)+8])), 0)
+	digest := msg[len(prefix)+8 : len(prefix)+8+sha256.Size]
+	rest := msg[len(prefix)+8+sha256.Size:]
+	i := bytes.IndexByte(rest, '\n')
+	if i < 0 {
+		return "", "", nil, time.Time{}, errors.New("invalid unchanged message")
+	}
+	return string(rest[i+1:]), string(rest[:i]), digest, checked, nil
+}
+
+// checkTime returns an error if t is more than TimestampTolerance away from
+// now
+func checkTime(t, now time.Time) error {
+	if now.Sub(t) > TimestampTolerance || t.Sub(now) > TimestampTolerance {
+		return fmt.Errorf("time %s is too far from local time", t.Format(decenarch.StatTimeFormat))
+	}
+	return nil
+}
+
+// PageDigest fetches the HTML page at url as the consensus engines do, see
+// fetchHTMLPage, removes the elements matched by strip and returns the digest
+// of its leaves, see TreeDigest
+func PageDigest(fetch Fetcher, url string, check URLChecker, maxSize int64, strip []*lib.Selector) ([]byte, error) {
+	page, err := fetchHTMLPage(fetcher(fetch), url, check, maxSize, nil)
+	if err != nil {
+		return nil, err
+	}
+	if page.Tree == nil {
+		return nil, fmt.Errorf("%s is not an HTML page", url)
+	}
+	lib.StripElements(page.Tree, strip)
+	return TreeDigest(page.Tree), nil
+}
+
+// ContentDigest returns the digest of the leaves of the HTML page content,
+// e.g. an archived page
+func ContentDigest(content []byte) ([]byte, error) {
+	tree, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	return TreeDigest(tree), nil
+}
+
+// TreeDigest returns the Merkle root of the unique leaves of the tree, as
+// committed to by the Merkle consensus engine
+func TreeDigest(tree *html.Node) []byte {
+	return lib.MerkleRoot(lib.LeafHashes(lib.ListUniqueDataLeaves(tree)))
+}
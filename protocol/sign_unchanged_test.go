@@ -0,0 +1,60 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestUnchangedMessage(t *testing.T) {
+	digest, err := ContentDigest([]byte("<html><body><p>hello</p><p>world</p></body></html>"))
+	require.NoError(t, err)
+	now := time.Now()
+	msg := decenarch.UnchangedMessage("http://example.com/a", "hash", digest, now.Unix())
+	url, pageHash, parsed, err := ParseUnchangedMessage(msg)
+	require.NoError(t, err)
+	require.Equal(t, "http://example.com/a", url)
+	require.Equal(t, "hash", pageHash)
+	require.Equal(t, digest, parsed)
+
+	// the digest only depends on the leaves of the page
+	same, err := ContentDigest([]byte("<html><head></head><body><div><p>hello</p></div><p>world</p></body></html>"))
+	require.NoError(t, err)
+	require.Equal(t, digest, same)
+	other, err := ContentDigest([]byte("<html><body><p>hello</p><p>there</p></body></html>"))
+	require.NoError(t, err)
+	require.NotEqual(t, digest, other)
+
+	// the other messages are refused
+	_, _, _, err = ParseUnchangedMessage(decenarch.TimestampMessage("hash", now.Unix()))
+	require.Error(t, err)
+	_, _, _, err = ParseUnchangedMessage(msg[:20])
+	require.Error(t, err)
+}
+
+func TestUnchangedCheckedVerification(t *testing.T) {
+	digest, err := ContentDigest([]byte("<html><body><p>hello</p></body></html>"))
+	require.NoError(t, err)
+	msg := decenarch.UnchangedMessage("http://example.com/a", "hash", digest, time.Now().Unix())
+	data, err := network.Marshal(&UnchangedVerificationData{RequestID: "id", ConodeKey: "key"})
+	require.NoError(t, err)
+
+	// the conode checks the snapshot named by the message, not only the
+	// digest
+	var checked string
+	verify := UnchangedCheckedVerification(func(url, pageHash string, d []byte) error {
+		checked = pageHash
+		if pageHash != "hash" {
+			return errors.New("not the last snapshot")
+		}
+		return nil
+	})
+	require.True(t, verify(msg, data))
+	require.Equal(t, "hash", checked)
+	require.False(t, verify(decenarch.UnchangedMessage("http://example.com/a", "other", digest, time.Now().Unix()), data))
+}
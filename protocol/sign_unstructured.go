@@ -0,0 +1,137 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func init() {
+	// as VerificationData, this message is only used to marshal the data
+	// of the verification function
+	network.RegisterMessage(UnstructuredVerificationData{})
+}
+
+// UnstructuredVerificationData holds the data a conode needs to verify an
+// additional resource or an inline blob. It is built by each conode from
+// what it saw during the save, not by the root.
+//    - Threshold is the number of signatures needed on the hash of a resource
+//    - Publics are the public keys of the roster
+//    - Fetched are the hashes of the resources fetched by the conode, see
+//      decenarch.ResourceHash
+//    - Agreed are the resources agreed on during the unstructured consensus
+//    - Blobs are the placeholders of the inline blobs extracted by the conode
+type UnstructuredVerificationData struct {
+	RequestID string
+	ConodeKey string
+	Threshold int
+	Publics   []kyber.Point
+	Fetched   []string
+	Agreed    []AgreedResource
+	Blobs     []string
+}
+
+// AgreedResource is the hash of a resource agreed on with the unstructured
+// consensus and the signatures of the conodes on the hash, announced by the
+// root. Signatures[i] is the signature of Signers[i] on the hash and Url, see
+// decenarch.CommitmentMessage.
+type AgreedResource struct {
+	Hash       string
+	Signers    []kyber.Point
+	Signatures [][]byte
+	Url        string
+}
+
+// NewAgreedResource returns the resource of url and hash signed with
+// signatures, by public key, as in the MasterHash of
+// ConsensusUnstructuredState
+func NewAgreedResource(url, hash string, signatures map[kyber.Point][]byte) AgreedResource {
+	a := AgreedResource{Hash: hash, Url: url}
+	for signer, sig := range signatures {
+		a.Signers = append(a.Signers, signer)
+		a.Signatures = append(a.Signatures, sig)
+	}
+	return a
+}
+
+// verificationFunctionUnstructured accepts to sign the resource if it is an
+// inline blob extracted by the conode, or a resource fetched by the conode
+// whose hash was signed by threshold conodes
+func verificationFunctionUnstructured(msg, data []byte) bool {
+	_, vfData, err := network.Unmarshal(data, decenarch.Suite)
+	if err != nil {
+		log.Lvl1("Impossible to decode verification data, node refuses to sign")
+		return false
+	}
+	vd := vfData.(*UnstructuredVerificationData)
+	logger := lib.NewLogger(vd.RequestID, vd.ConodeKey).With("protocol", NameSignUnstructured)
+
+	if err := VerifyResource(msg, vd); err != nil {
+		logger.Lvl1("Invalid resource, node refuses to sign", "error", err)
+		return false
+	}
+	logger.Lvl3("Proposed resource verified")
+	return true
+}
+
+// VerifyResource returns an error if the conode must not sign resource, see
+// UnstructuredVerificationData
+func VerifyResource(resource []byte, vd *UnstructuredVerificationData) error {
+	placeholder := InlinePrefix + lib.ContentHash(resource)
+	for _, b := range vd.Blobs {
+		if b == placeholder {
+			return nil
+		}
+	}
+
+	hash := decenarch.ResourceHash(resource)
+	fetched := false
+	for _, h := range vd.Fetched {
+		fetched = fetched || h == hash
+	}
+	if !fetched {
+		return errors.New("the conode didn't fetch this version of the resource")
+	}
+	for _, a := range vd.Agreed {
+		if a.Hash == hash {
+			return a.verify(vd.RequestID, vd.Publics, vd.Threshold)
+		}
+	}
+	return errors.New("the resource was not agreed on")
+}
+
+// verify returns an error if the hash of a is not signed by threshold
+// distinct conodes of publics for the save requestID
+func (a *AgreedResource) verify(requestID string, publics []kyber.Point, threshold int) error {
+	msg := decenarch.CommitmentMessage(a.Url, requestID, a.Hash)
+	if len(a.Signers) != len(a.Signatures) {
+		return errors.New("signers and signatures don't match")
+	}
+	signed := make(map[string]bool)
+	for i, signer := range a.Signers {
+		if signer == nil || signed[signer.String()] {
+			continue
+		}
+		member := false
+		for _, p := range publics {
+			member = member || p.Equal(signer)
+		}
+		if !member {
+			continue
+		}
+		if schnorr.Verify(decenarch.Suite, signer, msg, a.Signatures[i]) == nil {
+			signed[signer.String()] = true
+		}
+	}
+	if len(signed) < threshold || len(signed) == 0 {
+		return fmt.Errorf("the hash of the resource is signed by %d conodes, %d needed", len(signed), threshold)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/kyber.v2/util/key"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func TestVerifyResource(t *testing.T) {
+	resource := []byte("body { color: red }")
+	hash := decenarch.ResourceHash(resource)
+	var publics []kyber.Point
+	sigs := make(map[kyber.Point][]byte)
+	for i := 0; i < 4; i++ {
+		kp := key.NewKeyPair(decenarch.Suite)
+		publics = append(publics, kp.Public)
+		if i < 3 {
+			sig, err := schnorr.Sign(decenarch.Suite, kp.Private, decenarch.CommitmentMessage("https://example.com/style.css", "request", hash))
+			require.NoError(t, err)
+			sigs[kp.Public] = sig
+		}
+	}
+	vd := &UnstructuredVerificationData{
+		RequestID: "request",
+		Threshold: 3,
+		Publics:   publics,
+		Fetched:   []string{hash},
+		Agreed:    []AgreedResource{NewAgreedResource("https://example.com/style.css", hash, sigs)},
+	}
+	require.NoError(t, VerifyResource(resource, vd))
+
+	// the resource must be the one agreed on and fetched by the conode
+	require.Error(t, VerifyResource([]byte("body { color: blue }"), vd))
+	vd.Fetched = nil
+	require.Error(t, VerifyResource(resource, vd))
+	vd.Fetched = []string{hash}
+
+	// the hash must be signed by threshold conodes of the roster
+	vd.Threshold = 4
+	require.Error(t, VerifyResource(resource, vd))
+	vd.Threshold = 3
+	vd.Publics = publics[1:]
+	require.Error(t, VerifyResource(resource, vd))
+	vd.Publics = publics
+
+	// the signatures are bound to the save and to the URL of the resource
+	vd.RequestID = "other request"
+	require.Error(t, VerifyResource(resource, vd))
+	vd.RequestID = "request"
+	vd.Agreed[0].Url = "https://example.com/other.css"
+	require.Error(t, VerifyResource(resource, vd))
+	vd.Agreed[0].Url = "https://example.com/style.css"
+	vd.Agreed[0].Signatures[0] = vd.Agreed[0].Signatures[1]
+	require.Error(t, VerifyResource(resource, vd))
+
+	// an inline blob is signed if the conode extracted it
+	blob := []byte("var x = 1;")
+	require.Error(t, VerifyResource(blob, vd))
+	vd.Blobs = []string{InlinePrefix + lib.ContentHash(blob)}
+	require.NoError(t, VerifyResource(blob, vd))
+}
@@ -0,0 +1,73 @@
+package protocol
+
+/*
+The template.go defines how the conodes replay the request template of a
+client, see decenarch.RequestTemplate. The template is part of the signed
+ClientRequest, so every conode sends the same request, with the sender of the
+conode, and its URL and redirections are checked as for a GET request.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+// ValidateTemplate returns an error if the conodes refuse to replay the
+// template t, which can be nil. A page fetched with a template cannot be
+// rendered, as the browser would only load its URL.
+func ValidateTemplate(t *decenarch.RequestTemplate, render bool) error {
+	if t == nil {
+		return nil
+	}
+	if render {
+		return errors.New("a page fetched with a request template cannot be rendered")
+	}
+	return t.Validate()
+}
+
+// NewTemplateRequest returns the request of the template t to url
+func NewTemplateRequest(url string, t *decenarch.RequestTemplate) (*http.Request, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	var body io.Reader
+	if len(t.Body) > 0 {
+		body = bytes.NewReader(t.Body)
+	}
+	req, err := http.NewRequest(t.Method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range t.Headers {
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+// templateFetcher returns the fetcher replaying the template t with send, or
+// fetch if t is nil
+func templateFetcher(fetch Fetcher, send Sender, t *decenarch.RequestTemplate) Fetcher {
+	if t == nil {
+		return fetch
+	}
+	return func(url string, check URLChecker) (*http.Response, error) {
+		req, err := NewTemplateRequest(url, t)
+		if err != nil {
+			return nil, err
+		}
+		return send(req, check)
+	}
+}
+
+// template returns the request template of the client request r, nil if r is
+// nil
+func (r *ClientRequest) template() *decenarch.RequestTemplate {
+	if r == nil {
+		return nil
+	}
+	return r.Template
+}
@@ -0,0 +1,46 @@
+package protocol
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestTemplateFetcher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + r.Header.Get("X-Search") + " " + string(body)))
+	}))
+	defer server.Close()
+	send := LocalSender(server.Listener.Addr().String())
+	fetch := GetFetcher(send)
+
+	// without template the page is fetched with a GET request
+	require.Nil(t, ValidateTemplate(nil, true))
+	body := func(resp *http.Response, err error) string {
+		require.Nil(t, err)
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Nil(t, err)
+		return string(b)
+	}
+	require.Equal(t, "GET  ", body(templateFetcher(fetch, send, nil)("http://example.com/", nil)))
+
+	template := &decenarch.RequestTemplate{
+		Method:  "POST",
+		Headers: map[string]string{"X-Search": "yes", "Content-Type": "application/x-www-form-urlencoded"},
+		Body:    []byte("q=archive"),
+	}
+	require.Nil(t, ValidateTemplate(template, false))
+	require.NotNil(t, ValidateTemplate(template, true))
+	require.Equal(t, "POST yes q=archive", body(templateFetcher(fetch, send, template)("http://example.com/search", nil)))
+
+	// an invalid template is not sent
+	_, err := templateFetcher(fetch, send, &decenarch.RequestTemplate{Method: "DELETE"})("http://example.com/", nil)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,57 @@
+package protocol
+
+/*
+The version.go defines the version of the protocols of decenarch. The root of
+a protocol announces the version it runs, and a node runs the protocol at that
+version if it supports it, or refuses to contribute otherwise, so that the
+conodes of a roster in the middle of a rolling upgrade never mix contributions
+computed with different rules. The conodes agree on the version at setup, see
+the SetupPropagation of the service.
+
+Every protocol of a save announces its version: the consensus protocols, the
+Decrypt protocol and the SignBLS protocol. The versions supported so far
+handle the messages the same way, LegacyVersion only lacks the version in the
+announcements, so no handler branches on the negotiated version yet. A change
+of the messages or of their handling increments Version and branches on the
+Version of the protocol instance, until MinVersion drops the older rules.
+*/
+
+import "fmt"
+
+// Versions of the protocols
+//    - LegacyVersion is the version of the conodes that predate the
+//      versioning: their messages carry no version, decoded as 0
+//    - Version is the version of the protocols run by this conode, it is
+//      incremented each time the messages or the way they are handled change,
+//      the handlers then branch on the negotiated version
+//    - MinVersion is the oldest version this conode still runs
+const (
+	LegacyVersion int32 = 1
+	Version       int32 = 2
+	MinVersion    int32 = LegacyVersion
+)
+
+// VersionError is returned when a node is asked to run a protocol at a
+// version it doesn't support
+type VersionError struct {
+	Version int32
+}
+
+// Error implements the error interface
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("protocol version %d not supported, supported versions are %d to %d", e.Version, MinVersion, Version)
+}
+
+// NegotiateVersion returns the version at which the node runs a protocol
+// announced at version v. A node newer than the root downgrades to the
+// version of the root, and a node older than the root refuses with a
+// VersionError.
+func NegotiateVersion(v int32) (int32, error) {
+	if v == 0 {
+		v = LegacyVersion
+	}
+	if v < MinVersion || v > Version {
+		return 0, &VersionError{Version: v}
+	}
+	return v, nil
+}
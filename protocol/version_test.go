@@ -0,0 +1,25 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	// the conodes that predate the versioning announce no version
+	v, err := NegotiateVersion(0)
+	require.Nil(t, err)
+	require.Equal(t, LegacyVersion, v)
+
+	for _, announced := range []int32{MinVersion, Version} {
+		v, err = NegotiateVersion(announced)
+		require.Nil(t, err)
+		require.Equal(t, announced, v)
+	}
+
+	_, err = NegotiateVersion(Version + 1)
+	require.IsType(t, &VersionError{}, err)
+	_, err = NegotiateVersion(-1)
+	require.IsType(t, &VersionError{}, err)
+}
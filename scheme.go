@@ -0,0 +1,50 @@
+package decenarch
+
+/*
+The scheme.go defines the signature schemes of the archive, chosen at setup.
+With SchemeCosi, the pages and the blocks are collectively signed with ftcosi.
+With SchemeBLS, every conode signs the message with its BLS key and the root
+aggregates the signatures in a single one, followed by the mask of the
+signers as with ftcosi, in one round trip instead of the commitment and the
+challenge rounds of ftcosi. The roster has no BLS keys, so the keys of the
+signers are stored with the signatures, each endorsed by the key of its
+conode in the roster, see SignerKey. The signatures are verified by the
+package client/verify, which doesn't depend on the conodes.
+*/
+
+import (
+	"fmt"
+
+	"github.com/dedis/student_18_decenar/client/verify"
+)
+
+// Signature schemes of the archive, see SetupRequest
+const (
+	SchemeCosi = verify.SchemeCosi
+	SchemeBLS  = verify.SchemeBLS
+)
+
+// ValidScheme returns an error if scheme is not a signature scheme. The
+// empty scheme is SchemeCosi.
+func ValidScheme(scheme string) error {
+	switch scheme {
+	case "", SchemeCosi, SchemeBLS:
+		return nil
+	}
+	return fmt.Errorf("unknown signature scheme %q", scheme)
+}
+
+// SignerKey is the BLS key of a conode, see SchemeBLS and verify.SignerKey
+type SignerKey = verify.SignerKey
+
+// PossessionMessage returns the bytes signed with the BLS key public to prove
+// the possession of its private key
+func PossessionMessage(public []byte) []byte {
+	return verify.PossessionMessage(public)
+}
+
+// EndorsementMessage returns the bytes signed by a conode to endorse the BLS
+// key public
+func EndorsementMessage(public []byte) []byte {
+	return verify.EndorsementMessage(public)
+}
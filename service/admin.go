@@ -0,0 +1,154 @@
+package service
+
+/*
+The admin.go defines the Admin API-call, which allows the operator of a
+conode to inspect and repair the storage of the service without editing the
+database by hand.
+*/
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/onet.v2/log"
+)
+
+// storageDump is the representation of the storage returned by the
+// dump-storage admin command. The secret share is never included.
+type storageDump struct {
+	GenesisID     string
+	LatestID      string
+	Threshold     int32
+	SecretPresent bool
+	SecretIndex   int
+	Saves         []string
+	LastSave      string
+}
+
+// Admin executes the admin command of the request, if the request is signed
+// by the private key of this conode
+func (s *Service) Admin(req *decenarch.AdminRequest) (*decenarch.AdminResponse, error) {
+	log.Lvl3("Decenarch Service new AdminRequest:", req.Command)
+	if err := s.verifyAdminRequest(req); err != nil {
+		return nil, err
+	}
+
+	switch req.Command {
+	case decenarch.AdminDumpStorage:
+		out, err := json.MarshalIndent(s.dumpStorage(), "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return &decenarch.AdminResponse{Output: string(out)}, nil
+	case decenarch.AdminShowSecretIndex:
+		// the argument is the namespace of the archive
+		secret := s.namespace(string(req.Argument)).Secret
+		if secret == nil {
+			return nil, errors.New("no DKG share stored: run setup first")
+		}
+		return &decenarch.AdminResponse{Output: strconv.Itoa(secret.Index)}, nil
+	case decenarch.AdminShowGenesis:
+		genesis := s.namespace(string(req.Argument)).GenesisID
+		if genesis == nil {
+			return nil, decenarch.ErrNoSetup
+		}
+		return &decenarch.AdminResponse{Output: hex.EncodeToString(genesis)}, nil
+	case decenarch.AdminClearPending:
+		cleared := s.clearPending()
+		return &decenarch.AdminResponse{Output: strconv.Itoa(cleared) + " idle saves cleared"}, nil
+	case decenarch.AdminShowExcluded:
+		out, err := s.showExcluded()
+		if err != nil {
+			return nil, err
+		}
+		return &decenarch.AdminResponse{Output: out}, nil
+	case decenarch.AdminReadmit:
+		n := s.readmit()
+		return &decenarch.AdminResponse{Output: strconv.Itoa(n) + " conodes re-admitted"}, nil
+	case decenarch.AdminReloadConfig:
+		out, err := s.reloadConfig()
+		if err != nil {
+			return nil, err
+		}
+		return &decenarch.AdminResponse{Output: out}, nil
+	case decenarch.AdminExportSecret, decenarch.AdminImportSecret:
+		arg := &decenarch.SecretBackupArgument{}
+		if err := json.Unmarshal(req.Argument, arg); err != nil {
+			return nil, errors.New("invalid argument of " + req.Command + ": " + err.Error())
+		}
+		if req.Command == decenarch.AdminImportSecret {
+			out, err := s.importSecret(arg)
+			if err != nil {
+				return nil, err
+			}
+			return &decenarch.AdminResponse{Output: out}, nil
+		}
+		backup, err := s.exportSecret(arg.Recipient)
+		if err != nil {
+			return nil, err
+		}
+		out, err := json.Marshal(backup)
+		if err != nil {
+			return nil, err
+		}
+		return &decenarch.AdminResponse{Output: string(out)}, nil
+	case decenarch.AdminBackupKey:
+		out, err := s.newBackupKey()
+		if err != nil {
+			return nil, err
+		}
+		return &decenarch.AdminResponse{Output: out}, nil
+	default:
+		return nil, errors.New("unknown admin command: " + req.Command)
+	}
+}
+
+// verifyAdminRequest returns an error if the request is not signed by the
+// private key of this conode or if it is too old
+func (s *Service) verifyAdminRequest(req *decenarch.AdminRequest) error {
+	age := time.Since(time.Unix(req.Timestamp, 0))
+	if age > decenarch.AdminMaxClockSkew || age < -decenarch.AdminMaxClockSkew {
+		return errors.New("admin request expired")
+	}
+	err := schnorr.Verify(decenarch.Suite, s.ServerIdentity().Public, req.Message(), req.Signature)
+	if err != nil {
+		return errors.New("invalid signature of admin request: " + err.Error())
+	}
+	return nil
+}
+
+// dumpStorage returns a copy of the storage without the secret share
+func (s *Service) dumpStorage() *storageDump {
+	s.Storage.Lock()
+	defer s.Storage.Unlock()
+	dump := &storageDump{
+		GenesisID:     hex.EncodeToString(s.Storage.GenesisID),
+		LatestID:      hex.EncodeToString(s.Storage.LatestID),
+		Threshold:     s.Storage.Threshold,
+		SecretPresent: s.Storage.Secret != nil,
+		Saves:         s.saves.ids(),
+		LastSave:      s.Storage.LastSave,
+	}
+	if s.Storage.Secret != nil {
+		dump.SecretIndex = s.Storage.Secret.Index
+	}
+	return dump
+}
+
+// clearPending removes the material of the idle saves, e.g. of the saves
+// interrupted in the middle, and returns their number. The saves running
+// concurrently keep their material.
+func (s *Service) clearPending() int {
+	cleared := s.saves.clearIdle(s.now())
+	s.Storage.Lock()
+	s.Storage.CompleteProofs = nil
+	s.Storage.Unlock()
+	s.save()
+	return cleared
+}
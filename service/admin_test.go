@@ -0,0 +1,105 @@
+package service
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmin(t *testing.T) {
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	servers, _, _ := local.GenBigTree(1, 1, 1, true)
+	s := local.GetServices(servers, templateID)[0].(*Service)
+	conode := local.GetPrivate(servers[0])
+	signed := func(private kyber.Scalar, timestamp time.Time, command, argument string) *decenarch.AdminRequest {
+		req := &decenarch.AdminRequest{Command: command, Timestamp: timestamp.Unix(), Argument: []byte(argument)}
+		sig, err := schnorr.Sign(decenarch.Suite, private, req.Message())
+		require.NoError(t, err)
+		req.Signature = sig
+		return req
+	}
+	admin := func(command, argument string) string {
+		resp, err := s.Admin(signed(conode, time.Now(), command, argument))
+		require.NoError(t, err)
+		return resp.Output
+	}
+
+	// only the requests signed by the conode key, and recent, are accepted
+	_, err := s.Admin(signed(key.NewKeyPair(decenarch.Suite).Private, time.Now(), decenarch.AdminDumpStorage, ""))
+	require.Error(t, err)
+	_, err = s.Admin(signed(conode, time.Now().Add(-2*decenarch.AdminMaxClockSkew), decenarch.AdminDumpStorage, ""))
+	require.Error(t, err)
+	req := signed(conode, time.Now(), decenarch.AdminShowGenesis, "")
+	req.Argument = []byte("tenant")
+	_, err = s.Admin(req)
+	require.Error(t, err)
+	_, err = s.Admin(signed(conode, time.Now(), "unknown", ""))
+	require.Error(t, err)
+
+	// before the setup
+	_, err = s.Admin(signed(conode, time.Now(), decenarch.AdminShowGenesis, ""))
+	require.Error(t, err)
+	_, err = s.Admin(signed(conode, time.Now(), decenarch.AdminShowSecretIndex, ""))
+	require.Error(t, err)
+
+	// the dump of the storage tells whether a share is stored, never the
+	// share itself
+	share := decenarch.Suite.Scalar().Pick(decenarch.Suite.RandomStream())
+	public := decenarch.Suite.Point().Mul(share, nil)
+	s.Storage.Secret = &lib.SharedSecret{Index: 2, V: share, X: public}
+	s.Storage.GenesisID = []byte("genesis")
+	s.updateNamespace("tenant", func(n *Namespace) {
+		n.GenesisID = []byte("tenant")
+		n.Secret = &lib.SharedSecret{Index: 1, V: share, X: public}
+	})
+	out := admin(decenarch.AdminDumpStorage, "")
+	dump := &storageDump{}
+	require.NoError(t, json.Unmarshal([]byte(out), dump))
+	require.True(t, dump.SecretPresent)
+	require.Equal(t, 2, dump.SecretIndex)
+	require.Equal(t, hex.EncodeToString([]byte("genesis")), dump.GenesisID)
+	shareBytes, err := share.MarshalBinary()
+	require.NoError(t, err)
+	require.False(t, strings.Contains(out, hex.EncodeToString(shareBytes)))
+	require.False(t, strings.Contains(out, share.String()))
+
+	require.Equal(t, "2", admin(decenarch.AdminShowSecretIndex, ""))
+	require.Equal(t, "1", admin(decenarch.AdminShowSecretIndex, "tenant"))
+	require.Equal(t, hex.EncodeToString([]byte("genesis")), admin(decenarch.AdminShowGenesis, ""))
+	require.Equal(t, hex.EncodeToString([]byte("tenant")), admin(decenarch.AdminShowGenesis, "tenant"))
+
+	s.saves.update("idle", time.Now().Add(-2*saveStateIdle), func(st *saveState) {})
+	require.Equal(t, "1 idle saves cleared", admin(decenarch.AdminClearPending, ""))
+	require.Empty(t, s.saves.ids())
+
+	require.Equal(t, "{}", admin(decenarch.AdminShowExcluded, ""))
+	s.Storage.Excluded = map[string]decenarch.Evidence{"conode": {}}
+	require.Contains(t, admin(decenarch.AdminShowExcluded, ""), "conode")
+	require.Equal(t, "1 conodes re-admitted", admin(decenarch.AdminReadmit, ""))
+	require.Equal(t, "{}", admin(decenarch.AdminShowExcluded, ""))
+
+	dir, err := ioutil.TempDir("", "decenarch")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	p := path.Join(dir, ConfigFileName)
+	require.NoError(t, os.Setenv(ConfigEnv, p))
+	defer os.Unsetenv(ConfigEnv)
+	require.Equal(t, "configuration reloaded from "+p, admin(decenarch.AdminReloadConfig, ""))
+
+	require.NotEmpty(t, admin(decenarch.AdminBackupKey, ""))
+}
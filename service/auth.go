@@ -0,0 +1,168 @@
+package service
+
+/*
+The auth.go defines the authorization of the clients asking to save web pages.
+The authorized public keys are registered at setup and propagated to all the
+conodes, which check the signature of the save request before running the
+consensus protocols. The authorized clients also sign the setups that run a
+new DKG: the forced setups of their archive, and the new namespaces for the
+clients of the default archive. The saves of the entries of a feed carry the
+signed request of the client watching the feed instead, see feed.go.
+*/
+
+import (
+	"errors"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/protocol"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+)
+
+// clientRequest returns the signed client request forwarded to the other
+// conodes, or nil if the client neither signed the request nor gave a request
+// template
+func clientRequest(req *decenarch.SaveRequest) *protocol.ClientRequest {
+	if req.PublicKey == nil && req.Template == nil && req.Feed == nil {
+		return nil
+	}
+	return &protocol.ClientRequest{
+		Url:       req.Url,
+		Timestamp: req.Timestamp,
+		PublicKey: req.PublicKey,
+		Signature: req.Signature,
+		Template:  req.Template,
+		Feed:      req.Feed,
+	}
+}
+
+// verifyClientRequest returns the client of req for the quota, see clientID,
+// or an error if the archive of the namespace ns only accepts save requests
+// from authorized clients and req is not signed by one of them. The signature
+// is verified in an open archive too, the requests not signed by their key
+// are counted as anonymous, so that a client cannot take the quota of
+// another key.
+func (s *Service) verifyClientRequest(ns string, req *protocol.ClientRequest) (string, error) {
+	authorized := s.namespace(ns).AuthorizedKeys
+	if req != nil && req.Feed != nil {
+		return verifyFeedSave(authorized, req.Feed)
+	}
+	if len(authorized) == 0 {
+		if req == nil || req.PublicKey == nil {
+			return anonymousClient, nil
+		}
+		if err := verifySigned([]kyber.Point{req.PublicKey}, "save", req.PublicKey, req.Timestamp, clientMessage(ns, req), req.Signature); err != nil {
+			return anonymousClient, nil
+		}
+		return clientID(req.PublicKey), nil
+	}
+	if req == nil || req.PublicKey == nil {
+		return "", errors.New("save request must be signed by an authorized client")
+	}
+	if err := verifySigned(authorized, "save", req.PublicKey, req.Timestamp, clientMessage(ns, req), req.Signature); err != nil {
+		return "", err
+	}
+	return clientID(req.PublicKey), nil
+}
+
+// verifyFeedSave returns the client of the save of an entry of the feed
+// watched by watch, or an error if watch is not signed by the client or if
+// the client is not one of the authorized keys. The conodes cannot check that
+// the page is an entry of the feed, the root can only make them save pages
+// for a client who watches a feed.
+func verifyFeedSave(authorized []kyber.Point, watch *decenarch.WatchFeedRequest) (string, error) {
+	if watch.PublicKey == nil || watch.Remove {
+		return "", errors.New("invalid feed request of the save")
+	}
+	if err := schnorr.Verify(decenarch.Suite, watch.PublicKey, watch.Message(), watch.Signature); err != nil {
+		return "", errors.New("invalid signature of feed request: " + err.Error())
+	}
+	if len(authorized) > 0 && !hasKey(authorized, watch.PublicKey) {
+		return "", errors.New("client " + watch.PublicKey.String() + " is not authorized to save the entries of feeds")
+	}
+	return clientID(watch.PublicKey), nil
+}
+
+// clientMessage returns the bytes signed by the client of req for the
+// namespace ns
+func clientMessage(ns string, req *protocol.ClientRequest) []byte {
+	return append(decenarch.SaveRequestMessage(req.Url, req.Timestamp, ns), req.Template.Hash()...)
+}
+
+// requestVerifier returns the check of the client requests of the saves of
+// the namespace ns by the conodes following the root, see
+// verifyClientRequest. The conodes also count the save against the quota of
+// the client, so that a root ignoring the quota cannot make them work for the
+// client.
+func (s *Service) requestVerifier(ns string) func(*protocol.ClientRequest) error {
+	return func(req *protocol.ClientRequest) error {
+		client, err := s.verifyClientRequest(ns, req)
+		if err != nil {
+			return err
+		}
+		return s.quota.allowSave(client, s.now())
+	}
+}
+
+// verifySigned returns an error if public is not one of the authorized keys,
+// if the timestamp is too old or if signature is not the signature of msg by
+// public. what names the request in the errors.
+func verifySigned(authorized []kyber.Point, what string, public kyber.Point, timestamp int64, msg, signature []byte) error {
+	if !hasKey(authorized, public) {
+		return errors.New("client " + public.String() + " is not authorized to send " + what + " requests")
+	}
+
+	age := time.Since(time.Unix(timestamp, 0))
+	if age > decenarch.SaveRequestMaxAge || age < -decenarch.SaveRequestMaxAge {
+		return errors.New(what + " request expired")
+	}
+
+	if err := schnorr.Verify(decenarch.Suite, public, msg, signature); err != nil {
+		return errors.New("invalid signature of " + what + " request: " + err.Error())
+	}
+	return nil
+}
+
+// hasKey returns true if public is one of keys
+func hasKey(keys []kyber.Point, public kyber.Point) bool {
+	for _, k := range keys {
+		if k.Equal(public) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySetupRequest returns an error if the setup request forces a new DKG
+// without the signature of an authorized client of the archive, or sets up a
+// new namespace without the signature of an authorized client of the default
+// archive. The archives without authorized clients accept any setup.
+func (s *Service) verifySetupRequest(req *decenarch.SetupRequest) error {
+	ns := req.Namespace
+	_, err := s.GetSetupInfo(&decenarch.SetupInfoRequest{Namespace: ns})
+	setUp := err == nil
+	var authorized []kyber.Point
+	switch {
+	case setUp && req.Force:
+		authorized = s.namespace(ns).AuthorizedKeys
+	case !setUp && ns != "":
+		authorized = s.namespace("").AuthorizedKeys
+	}
+	if len(authorized) == 0 {
+		return nil
+	}
+	if req.PublicKey == nil {
+		return errors.New("setup request must be signed by an authorized client")
+	}
+	return verifySigned(authorized, "setup", req.PublicKey, req.Timestamp, req.Message(), req.Signature)
+}
+
+// authorizedKeys returns the public keys of the clients allowed to save web
+// pages
+func (s *Service) authorizedKeys() []kyber.Point {
+	s.Storage.Lock()
+	defer s.Storage.Unlock()
+	return s.Storage.AuthorizedKeys
+}
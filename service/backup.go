@@ -0,0 +1,195 @@
+package service
+
+/*
+The backup.go defines the backup of the DKG share of a conode, exported and
+imported with the admin API, so that a conode can move to new hardware
+without running the DKG again. The backup holds the share and the setup of
+the conode. The conode only sends it sealed to a transport key of the
+operator, who encrypts the backup file with a passphrase, and only receives
+it sealed to a transport key of its own, see lib/backup.go. It can only be
+imported by a conode with the same server identity, i.e. the private.toml of
+the conode is moved with it, and never replaces another share.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/util/encoding"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func init() {
+	network.RegisterMessage(&backupContent{})
+}
+
+// backupContent is the part of the Storage saved in a backup: the share and
+// everything the conode agreed on at setup, for the default archive and every
+// namespace. Public is the public key of the conode exporting the backup.
+type backupContent struct {
+	Public            kyber.Point
+	Secret            *lib.SharedSecret
+	KeyCreated        int64
+	GenesisID         skipchain.SkipBlockID
+	LatestID          skipchain.SkipBlockID
+	Threshold         int32
+	AuthorizedKeys    []kyber.Point
+	DomainPolicy      *lib.DomainPolicy
+	FalsePositiveRate float64
+	BlockInterval     int64
+	Roster            *onet.Roster
+	ProtocolVersion   int32
+	Scheme            string
+	FetchHeaders      map[string]string
+	CounterWidth      int32
+	MaxHomomorphicInt int64
+	Namespaces        map[string]*Namespace
+}
+
+// exportSecret returns the backup of the share of the conode sealed to the
+// hex encoded transport key of the operator
+func (s *Service) exportSecret(recipient string) (*decenarch.SecretBackupArgument, error) {
+	public, err := encoding.StringHexToPoint(decenarch.Suite, recipient)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transport key: %v", err)
+	}
+	s.Storage.Lock()
+	if s.Storage.Secret == nil {
+		s.Storage.Unlock()
+		return nil, errors.New("no DKG share stored: run setup first")
+	}
+	content := &backupContent{
+		Public:            s.ServerIdentity().Public,
+		Secret:            s.Storage.Secret,
+		KeyCreated:        s.Storage.KeyCreated,
+		GenesisID:         s.Storage.GenesisID,
+		LatestID:          s.Storage.LatestID,
+		Threshold:         s.Storage.Threshold,
+		AuthorizedKeys:    s.Storage.AuthorizedKeys,
+		DomainPolicy:      s.Storage.DomainPolicy,
+		FalsePositiveRate: s.Storage.FalsePositiveRate,
+		BlockInterval:     s.Storage.BlockInterval,
+		Roster:            s.Storage.Roster,
+		ProtocolVersion:   s.Storage.ProtocolVersion,
+		Scheme:            s.Storage.Scheme,
+		FetchHeaders:      s.Storage.FetchHeaders,
+		CounterWidth:      s.Storage.CounterWidth,
+		MaxHomomorphicInt: s.Storage.MaxHomomorphicInt,
+		Namespaces:        s.Storage.Namespaces,
+	}
+	plain, err := network.Marshal(content)
+	s.Storage.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	collective, err := encoding.PointToStringHex(decenarch.Suite, content.Secret.X)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := lib.SealTo(public, plain)
+	if err != nil {
+		return nil, err
+	}
+	return &decenarch.SecretBackupArgument{Key: collective, Index: content.Secret.Index, Sealed: sealed}, nil
+}
+
+// newBackupKey returns the hex encoded public key of a new transport key,
+// which opens the next imported share
+func (s *Service) newBackupKey() (string, error) {
+	pair := key.NewKeyPair(decenarch.Suite)
+	s.backupKeyMutex.Lock()
+	s.backupKey = pair
+	s.backupKeyMutex.Unlock()
+	return encoding.PointToStringHex(decenarch.Suite, pair.Public)
+}
+
+// importSecret restores the share and the setup of the backup sealed to the
+// transport key of the conode, which is then discarded. It refuses a backup
+// of another conode, or whose key or archives differ from the ones already
+// stored by the conode.
+func (s *Service) importSecret(arg *decenarch.SecretBackupArgument) (string, error) {
+	s.backupKeyMutex.Lock()
+	pair := s.backupKey
+	s.backupKey = nil
+	s.backupKeyMutex.Unlock()
+	if pair == nil {
+		return "", errors.New("no transport key: ask for the backup key first")
+	}
+	plain, err := lib.OpenSealed(pair.Private, arg.Sealed)
+	if err != nil {
+		return "", err
+	}
+	_, msg, err := network.Unmarshal(plain, decenarch.Suite)
+	if err != nil {
+		return "", err
+	}
+	content, ok := msg.(*backupContent)
+	if !ok || content.Secret == nil || content.Public == nil {
+		return "", errors.New("invalid backup: no DKG share")
+	}
+	if !content.Public.Equal(s.ServerIdentity().Public) {
+		return "", errors.New("the backup is the share of another conode")
+	}
+
+	s.Storage.Lock()
+	if s.Storage.Secret != nil && !s.Storage.Secret.X.Equal(content.Secret.X) {
+		s.Storage.Unlock()
+		return "", errors.New("the conode already holds a share of another key")
+	}
+	if s.Storage.GenesisID != nil && !bytes.Equal(s.Storage.GenesisID, content.GenesisID) {
+		s.Storage.Unlock()
+		return "", errors.New("the conode already stores another archive")
+	}
+	for ns, n := range content.Namespaces {
+		stored, ok := s.Storage.Namespaces[ns]
+		if !ok {
+			continue
+		}
+		if stored.Secret != nil && n.Secret != nil && !stored.Secret.X.Equal(n.Secret.X) {
+			s.Storage.Unlock()
+			return "", fmt.Errorf("the conode already holds a share of another key in namespace %s", ns)
+		}
+		if stored.GenesisID != nil && !bytes.Equal(stored.GenesisID, n.GenesisID) {
+			s.Storage.Unlock()
+			return "", fmt.Errorf("the conode already stores another archive in namespace %s", ns)
+		}
+	}
+	s.Storage.Secret = content.Secret
+	s.Storage.KeyCreated = content.KeyCreated
+	s.Storage.GenesisID = content.GenesisID
+	if s.Storage.LatestID == nil {
+		s.Storage.LatestID = content.LatestID
+	}
+	s.Storage.Threshold = content.Threshold
+	s.Storage.AuthorizedKeys = content.AuthorizedKeys
+	s.Storage.DomainPolicy = content.DomainPolicy
+	s.Storage.FalsePositiveRate = content.FalsePositiveRate
+	s.Storage.BlockInterval = content.BlockInterval
+	s.Storage.Roster = content.Roster
+	s.Storage.ProtocolVersion = content.ProtocolVersion
+	s.Storage.Scheme = content.Scheme
+	s.Storage.FetchHeaders = content.FetchHeaders
+	s.Storage.CounterWidth = content.CounterWidth
+	s.Storage.MaxHomomorphicInt = content.MaxHomomorphicInt
+	if len(content.Namespaces) > 0 && s.Storage.Namespaces == nil {
+		s.Storage.Namespaces = make(map[string]*Namespace)
+	}
+	for ns, n := range content.Namespaces {
+		if stored, ok := s.Storage.Namespaces[ns]; ok && stored.LatestID != nil {
+			n.LatestID = stored.LatestID
+		}
+		s.Storage.Namespaces[ns] = n
+	}
+	s.Storage.Unlock()
+	s.save()
+	s.refillZeroPool()
+	return fmt.Sprintf("DKG share %d of key %s restored", content.Secret.Index, content.Secret.X), nil
+}
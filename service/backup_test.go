@@ -0,0 +1,92 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/dedis/kyber.v2/util/encoding"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretBackup(t *testing.T) {
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	nodes, roster, _ := local.GenBigTree(3, 3, 1, true)
+	services := local.GetServices(nodes, templateID)
+	s0 := services[0].(*Service)
+	s1 := services[1].(*Service)
+
+	// the operator receives the share sealed to its transport key, and
+	// seals it to the transport key of the conode to import it
+	operator := key.NewKeyPair(decenarch.Suite)
+	recipient, err := encoding.PointToStringHex(decenarch.Suite, operator.Public)
+	require.Nil(t, err)
+	reseal := func(s *Service, backup *decenarch.SecretBackupArgument) *decenarch.SecretBackupArgument {
+		content, err := lib.OpenSealed(operator.Private, backup.Sealed)
+		require.Nil(t, err)
+		transport, err := s.newBackupKey()
+		require.Nil(t, err)
+		public, err := encoding.StringHexToPoint(decenarch.Suite, transport)
+		require.Nil(t, err)
+		sealed, err := lib.SealTo(public, content)
+		require.Nil(t, err)
+		return &decenarch.SecretBackupArgument{Sealed: sealed}
+	}
+
+	_, err = s1.exportSecret(recipient)
+	require.NotNil(t, err)
+	setupResponse, err := s0.Setup(&decenarch.SetupRequest{Roster: roster})
+	require.Nil(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	// a namespace set up on the same roster is backed up with the default one
+	s1.updateNamespace("team", func(n *Namespace) {
+		n.Secret = s1.secret()
+		n.GenesisID = s1.genesisID()
+		n.Threshold = 2
+	})
+
+	_, err = s1.exportSecret("not a key")
+	require.NotNil(t, err)
+	backup, err := s1.exportSecret(recipient)
+	require.Nil(t, err)
+	_, err = lib.OpenSealed(key.NewKeyPair(decenarch.Suite).Private, backup.Sealed)
+	require.NotNil(t, err)
+	index := s1.secret().Index
+	genesis := s1.genesisID()
+
+	// the conode moves to new hardware with its private.toml only
+	s1.Storage = &Storage{Version: storageVersion}
+	_, err = s1.importSecret(backup)
+	require.NotNil(t, err)
+	_, err = s0.importSecret(reseal(s0, backup))
+	require.NotNil(t, err)
+	imported := reseal(s1, backup)
+	_, err = s1.importSecret(imported)
+	require.Nil(t, err)
+	// the transport key is discarded after an import
+	_, err = s1.importSecret(imported)
+	require.NotNil(t, err)
+	key, err := s1.key()
+	require.Nil(t, err)
+	require.True(t, setupResponse.Key.Equal(key))
+	require.Equal(t, index, s1.secret().Index)
+	require.Equal(t, genesis, s1.genesisID())
+	require.True(t, sameRoster(roster, s1.Storage.Roster))
+	team := s1.namespace("team")
+	require.Equal(t, index, team.Secret.Index)
+	require.Equal(t, genesis, team.GenesisID)
+	require.Equal(t, int32(2), team.Threshold)
+
+	// importing again is harmless, but the share of another key is refused
+	_, err = s1.importSecret(reseal(s1, backup))
+	require.Nil(t, err)
+	s1.Storage.Secret.X = decenarch.Suite.Point().Pick(decenarch.Suite.RandomStream())
+	_, err = s1.importSecret(reseal(s1, backup))
+	require.NotNil(t, err)
+}
@@ -0,0 +1,219 @@
+package service
+
+/*
+The batch.go defines how the pages saved by the conode are grouped in the
+blocks of the skipchain. Without block interval every save is stored in its
+own block. Otherwise the pages are kept until the interval since the first
+pending save elapsed, or until a client asks to flush them, and are then
+collectively signed and stored in a single block. A client asking for a
+synchronous save waits until its pages are stored in a block, so that they
+cannot be lost if the conode restarts in the meantime. The pages of the
+namespaces other than the default one are stored immediately, in the
+skipchain of their namespace, see namespace.go.
+*/
+
+import (
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// flushRetry is the delay before storing again pages whose block could not
+// be stored
+const flushRetry = time.Minute
+
+// blockResult is the outcome of the storage of a block, given to the
+// synchronous saves waiting for it
+type blockResult struct {
+	id  skipchain.SkipBlockID
+	err error
+}
+
+// pendingSave holds the pages of saves waiting for the next block
+//    - requests are the IDs of the saves
+//    - done receives the result of the storage of the block, nil for the
+//      asynchronous saves
+type pendingSave struct {
+	pages    []decenarch.Webstore
+	requests []string
+	done     chan<- blockResult
+}
+
+// batch holds the pages saved by the conode and not yet stored in the
+// skipchain, with the synchronous saves waiting for them
+type batch struct {
+	sync.Mutex
+	saves  []pendingSave
+	roster *onet.Roster
+	timer  *time.Timer
+
+	// storing serializes the creation of the blocks
+	storing sync.Mutex
+}
+
+// add appends the pages of the saves requests to the batch. done, if not nil,
+// receives the result of the storage of the block containing the pages. The
+// first pending pages start a timer calling flush once the interval elapsed.
+func (b *batch) add(r *onet.Roster, pages []decenarch.Webstore, requests []string, done chan<- blockResult, interval time.Duration, flush func()) {
+	b.Lock()
+	defer b.Unlock()
+	b.saves = append(b.saves, pendingSave{pages: pages, requests: requests, done: done})
+	b.roster = r
+	if b.timer == nil {
+		b.timer = time.AfterFunc(interval, flush)
+	}
+}
+
+// take empties the batch and returns its saves and its roster
+func (b *batch) take() ([]pendingSave, *onet.Roster) {
+	b.Lock()
+	defer b.Unlock()
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	saves, r := b.saves, b.roster
+	b.saves, b.roster = nil, nil
+	return saves, r
+}
+
+// blockInterval returns the minimal duration between two blocks, the one
+// given at setup or else the one of the configuration
+func (s *Service) blockInterval() time.Duration {
+	s.Storage.Lock()
+	interval := s.Storage.BlockInterval
+	s.Storage.Unlock()
+	if interval == 0 {
+		interval = s.conf().Skip.BlockInterval
+	}
+	return time.Duration(interval) * time.Second
+}
+
+// storePages stores the pages of a save in the skipchain, immediately if
+// there is no block interval, otherwise with the next block. If sync is true
+// the call returns once the next block is stored, with its ID.
+func (s *Service) storePages(requestID string, r *onet.Roster, pages []decenarch.Webstore, sync bool) (skipchain.SkipBlockID, error) {
+	interval := s.blockInterval()
+	if interval <= 0 || s.saves.get(requestID).namespace != "" {
+		return s.storeBlock(requestID, r, &decenarch.Block{Pages: pages})
+	}
+
+	var done chan blockResult
+	if sync {
+		done = make(chan blockResult, 1)
+	}
+	s.batch.add(r, pages, []string{requestID}, done, interval, s.flushPending)
+	s.logger(requestID).Lvl2("Pages stored with the next block", "pages", len(pages), "interval", interval, "sync", sync)
+	if done == nil {
+		return nil, nil
+	}
+	res := <-done
+	return res.id, res.err
+}
+
+// flush stores the pending pages in a new block and returns their number.
+// The synchronous saves waiting for the pages are given the result.
+func (s *Service) flush(requestID string) (int, error) {
+	saves, r := s.batch.take()
+	var pages []decenarch.Webstore
+	var requests []string
+	for _, p := range saves {
+		pages = append(pages, p.pages...)
+		requests = append(requests, p.requests...)
+	}
+	if len(pages) == 0 {
+		return 0, nil
+	}
+	id, err := s.storeBlock(requestID, r, &decenarch.Block{Pages: pages})
+	for _, p := range saves {
+		if p.done != nil {
+			p.done <- blockResult{id: id, err: err}
+		}
+	}
+	if err != nil {
+		// keep the pages of the asynchronous saves for the next block. The
+		// synchronous saves fail with the error, so their pages are dropped
+		// rather than stored after their client was told they were not.
+		for _, p := range saves {
+			if p.done == nil {
+				s.batch.add(r, p.pages, p.requests, nil, flushRetry, s.flushPending)
+			}
+		}
+		return 0, err
+	}
+	s.journalRemove(requests...)
+	return len(pages), nil
+}
+
+// flushPending stores the pending pages once the block interval elapsed
+func (s *Service) flushPending() {
+	if _, err := s.flush(lib.NewRequestID()); err != nil {
+		log.Error("Couldn't store the pending pages:", err)
+	}
+}
+
+// storeBlock timestamps and collectively signs the block, with its pages or
+// its unchanged records, stores it in the skipchain of the namespace of the
+// save and returns its ID
+func (s *Service) storeBlock(requestID string, r *onet.Roster, block *decenarch.Block) (skipchain.SkipBlockID, error) {
+	s.batch.storing.Lock()
+	defer s.batch.storing.Unlock()
+	logger := s.logger(requestID)
+	ns := s.saves.get(requestID).namespace
+
+	tree := s.saveTree(r)
+	if tree == nil {
+		return nil, errors.New("error while creating the tree for the block signature")
+	}
+	block.Timestamp = s.now().Format(decenarch.StatTimeFormat)
+
+	// the content hash of the pages is signed with the block, so that
+	// their content can be moved to the storage tiers
+	for i := range block.Pages {
+		content, err := base64.StdEncoding.DecodeString(block.Pages[i].Page)
+		if err != nil {
+			return nil, err
+		}
+		block.Pages[i].PageHash = lib.ContentHash(content)
+	}
+
+	// the conodes sign the content of the block, so that the pages
+	// cannot be reordered or dropped when the block is stored
+	var err error
+	block.Sig, err = s.signBlock(requestID, tree, block)
+	if err != nil {
+		return nil, err
+	}
+	block.Scheme, block.SignerKeys = s.signerKeys(requestID)
+
+	// send data to the blockchain
+	logger.Lvl4("Sending data to skipchain", "pages", len(block.Pages))
+	resp, err := s.namespaceArchive(ns).AddData(s.namespace(ns).GenesisID, r, block)
+	if err != nil {
+		return nil, err
+	}
+
+	// store latest block ID for retrieval
+	s.updateNamespace(ns, func(n *Namespace) {
+		n.LatestID = resp.Latest.Hash
+	})
+	s.notify(decenarch.Event{Type: decenarch.EventBlockCreated, RequestID: requestID, BlockID: resp.Latest.Hash})
+	return resp.Latest.Hash, nil
+}
+
+// Flush stores the pages saved by the conode since its last block
+func (s *Service) Flush(req *decenarch.FlushRequest) (*decenarch.FlushResponse, error) {
+	pages, err := s.flush(lib.NewRequestID())
+	if err != nil {
+		return nil, err
+	}
+	return &decenarch.FlushResponse{Pages: pages}, nil
+}
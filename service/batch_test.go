@@ -0,0 +1,84 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockInterval(t *testing.T) {
+	s := &Service{Storage: &Storage{}, config: DefaultConfig()}
+	require.Equal(t, time.Duration(0), s.blockInterval())
+
+	s.config.Skip.BlockInterval = 120
+	require.Equal(t, 2*time.Minute, s.blockInterval())
+
+	// the interval agreed at setup overrides the configuration
+	s.Storage.BlockInterval = 30
+	require.Equal(t, 30*time.Second, s.blockInterval())
+}
+
+func TestBatch(t *testing.T) {
+	b := &batch{}
+	flushed := make(chan bool, 2)
+	flush := func() { flushed <- true }
+
+	b.add(nil, []decenarch.Webstore{{Url: "a"}}, []string{"1"}, nil, time.Hour, flush)
+	b.add(nil, []decenarch.Webstore{{Url: "b"}, {Url: "c"}}, []string{"2"}, nil, time.Hour, flush)
+	saves, _ := b.take()
+	require.Equal(t, 2, len(saves))
+	require.Equal(t, "a", saves[0].pages[0].Url)
+	require.Equal(t, 2, len(saves[1].pages))
+	require.Equal(t, []string{"2"}, saves[1].requests)
+	require.Nil(t, b.timer)
+
+	saves, _ = b.take()
+	require.Equal(t, 0, len(saves))
+
+	// the first pending pages start the timer
+	b.add(nil, []decenarch.Webstore{{Url: "d"}}, nil, nil, 10*time.Millisecond, flush)
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		t.Fatal("pending pages not flushed")
+	}
+}
+
+func TestBatchWaiters(t *testing.T) {
+	b := &batch{}
+	done := make(chan blockResult, 1)
+	b.add(nil, []decenarch.Webstore{{Url: "a"}}, nil, nil, time.Hour, func() {})
+	b.add(nil, []decenarch.Webstore{{Url: "b"}}, nil, done, time.Hour, func() {})
+	saves, _ := b.take()
+	require.Equal(t, 2, len(saves))
+	require.Nil(t, saves[0].done)
+	require.NotNil(t, saves[1].done)
+	saves, _ = b.take()
+	require.Equal(t, 0, len(saves))
+}
+
+func TestFlushFailure(t *testing.T) {
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	nodes, _, _ := local.GenBigTree(1, 1, 1, true)
+	_, other, _ := local.GenBigTree(1, 1, 1, true)
+	s := local.GetServices(nodes, templateID)[0].(*Service)
+
+	// no block can be stored for a roster without the conode
+	done := make(chan blockResult, 1)
+	s.batch.add(other, []decenarch.Webstore{{Url: "async"}}, []string{"async"}, nil, time.Hour, func() {})
+	s.batch.add(other, []decenarch.Webstore{{Url: "sync"}}, []string{"sync"}, done, time.Hour, func() {})
+	_, err := s.flush("flush")
+	require.Error(t, err)
+	require.Error(t, (<-done).err)
+
+	// the synchronous save failed, only the pages of the asynchronous save
+	// wait for the next block
+	saves, _ := s.batch.take()
+	require.Len(t, saves, 1)
+	require.Equal(t, []string{"async"}, saves[0].requests)
+}
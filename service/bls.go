@@ -0,0 +1,185 @@
+package service
+
+/*
+The bls.go defines what the conodes need to sign with decenarch.SchemeBLS,
+agreed at the setup of an archive: the BLS key of the conode and the
+verification functions and data of the signing protocols, shared with the
+sub-protocols of ftcosi so that a conode accepts the same messages with both
+schemes.
+*/
+
+import (
+	"errors"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/protocol"
+
+	ftcosiprotocol "gopkg.in/dedis/cothority.v2/ftcosi/protocol"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/network"
+)
+
+// blsKey returns the BLS private key of the conode, created and stored the
+// first time it is needed
+func (s *Service) blsKey() (kyber.Scalar, error) {
+	s.Storage.Lock()
+	private := decenarch.BLSSuite.G2().Scalar()
+	if s.Storage.BLSKey != nil {
+		err := private.UnmarshalBinary(s.Storage.BLSKey)
+		s.Storage.Unlock()
+		return private, err
+	}
+	private = lib.NewBLSKey()
+	b, err := private.MarshalBinary()
+	if err != nil {
+		s.Storage.Unlock()
+		return nil, err
+	}
+	s.Storage.BLSKey = b
+	s.Storage.Unlock()
+	s.save()
+	return private, nil
+}
+
+// newSignBLS configures the instance of the BLS signing protocol of the
+// conode of node, for the namespace carried by conf
+func (s *Service) newSignBLS(node *onet.TreeNodeInstance, conf *onet.GenericConfig) (onet.ProtocolInstance, error) {
+	instance, err := protocol.NewSignBLSProtocol(node)
+	if err != nil {
+		return nil, err
+	}
+	proto := instance.(*protocol.SignBLS)
+	if proto.BLSKey, err = s.blsKey(); err != nil {
+		return nil, err
+	}
+	proto.Verification = func(name, requestID string) (ftcosiprotocol.VerificationFn, []byte, error) {
+		verify, err := s.verificationFunction(name, configNamespace(conf), node.Root().ServerIdentity.Public, node.Roster())
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := s.verificationData(name, requestID, configNamespace(conf), node.Public().String(), node.Roster())
+		return verify, data, err
+	}
+	return proto, nil
+}
+
+// verificationFunction returns the verification function applied by the
+// conode to the messages of the signing protocol name led by the conode of
+// public key root on the roster r, for the namespace ns, with the checks of
+// the conode
+func (s *Service) verificationFunction(name, ns string, root kyber.Point, r *onet.Roster) (ftcosiprotocol.VerificationFn, error) {
+	switch name {
+	case protocol.NameSignStructured:
+		return protocol.StructuredCheckedVerification(s.faults.Check(s.checkConsensusData(root)), s.linkNormalizer(ns)), nil
+	case protocol.NameSignMerkle:
+		return protocol.MerkleCheckedVerification(s.faults.Check(s.checkConsensusData(root)), s.linkNormalizer(ns)), nil
+	case protocol.NameSignBlock:
+		return protocol.BlockCheckedVerification(s.keepPages), nil
+	case protocol.NameSignUnchanged:
+		return protocol.UnchangedCheckedVerification(s.unchangedCheck(ns, r)), nil
+	}
+	if verify := protocol.VerificationFunction(name); verify != nil {
+		return verify, nil
+	}
+	return nil, errors.New("no verification function for protocol " + name)
+}
+
+// verificationData returns the marshaled verification data of the conode of
+// key conodeKey for the signing protocol name of the save requestID on the
+// roster r, in the archive of the namespace ns. The data comes from what the
+// conode saw during the save, not from the root.
+func (s *Service) verificationData(name, requestID, ns, conodeKey string, r *onet.Roster) ([]byte, error) {
+	setup := s.namespace(ns)
+	threshold := setup.Threshold
+	var data interface{}
+	switch name {
+	case protocol.NameSignStructured:
+		st := s.saves.get(requestID)
+		consensus := st.consensus
+		if consensus == nil {
+			consensus = &ConsensusPropagation{RequestID: requestID}
+		}
+		proofsDigest, err := protocol.StoreProofs(requestID, st.completeProofs)
+		if err != nil {
+			return nil, err
+		}
+		data = &protocol.VerificationData{
+			RequestID:           consensus.RequestID,
+			Threshold:           int(threshold),
+			RootKey:             consensus.RootKey,
+			Partials:            consensus.PartialsBytes,
+			ConodeKey:           conodeKey,
+			PackedCBFSet:        st.packedCBFSet(),
+			Leaves:              st.leaves,
+			ConsensusSet:        consensus.ConsensusSet,
+			ConsensusParameters: consensus.ConsensusParameters,
+			ConsensusSignature:  consensus.Signature,
+			Url:                 consensus.Url,
+			AddsUrl:             consensus.AddsUrl,
+			ProofsDigest:        proofsDigest,
+			Extractor:           st.extractor,
+		}
+	case protocol.NameSignMerkle:
+		st := s.saves.get(requestID)
+		consensus := st.consensus
+		if consensus == nil {
+			consensus = &ConsensusPropagation{RequestID: requestID}
+		}
+		data = &protocol.MerkleVerificationData{
+			RequestID:   consensus.RequestID,
+			ConodeKey:   conodeKey,
+			Threshold:   int(threshold),
+			Leaves:      st.leaves,
+			Commitments: consensus.Commitments,
+
+			ConsensusSignature: consensus.Signature,
+			Url:                consensus.Url,
+			AddsUrl:            consensus.AddsUrl,
+			Extractor:          st.extractor,
+			Publics:            setup.publics(r),
+		}
+	case protocol.NameSignBlock:
+		// the pages are verified against the roster of the tree and the
+		// threshold of the conode, not the ones proposed by the root
+		data = &protocol.BlockVerificationData{
+			RequestID: requestID,
+			ConodeKey: conodeKey,
+			Threshold: int(threshold),
+			Publics:   r.Publics(),
+		}
+	case protocol.NameSignMirror:
+		data = &protocol.MirrorVerificationData{ConodeKey: conodeKey}
+	case protocol.NameSignTimestamp:
+		data = &protocol.TimestampVerificationData{
+			RequestID: requestID,
+			ConodeKey: conodeKey,
+		}
+	case protocol.NameSignUnchanged:
+		data = &protocol.UnchangedVerificationData{
+			RequestID: requestID,
+			ConodeKey: conodeKey,
+		}
+	case protocol.NameSignUnstructured:
+		// the resources are verified against what the conode saw
+		// during the save, not against data proposed by the root
+		data = s.resourceData(requestID, conodeKey, threshold, r)
+	default:
+		return nil, errors.New("no verification data for protocol " + name)
+	}
+	return network.Marshal(data)
+}
+
+// flatTree returns the tree of depth one with the root and the conodes of t,
+// each keeping its index in the roster of t, on which the BLS signing
+// protocol runs
+func flatTree(t *onet.Tree) *onet.Tree {
+	root := onet.NewTreeNode(t.Root.RosterIndex, t.Root.ServerIdentity)
+	for _, n := range t.List() {
+		if n != t.Root {
+			root.AddChild(onet.NewTreeNode(n.RosterIndex, n.ServerIdentity))
+		}
+	}
+	return onet.NewTree(t.Roster, root)
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/stretchr/testify/require"
+
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/network"
+)
+
+func TestFlatTree(t *testing.T) {
+	list := make([]*network.ServerIdentity, 6)
+	for i := range list {
+		addr := network.NewAddress(network.TLS, fmt.Sprintf("127.0.0.1:%d", 7000+i))
+		list[i] = network.NewServerIdentity(key.NewKeyPair(decenarch.Suite).Public, addr)
+	}
+	r := onet.NewRoster(list)
+
+	// the conode 3 is excluded from the planned tree
+	tree, _ := planTree(r, nil, 2, map[string]bool{list[3].Public.String(): true})
+	flat := flatTree(tree)
+	require.Equal(t, 0, flat.Root.RosterIndex)
+	require.Len(t, flat.Root.Children, 4)
+	for _, c := range flat.Root.Children {
+		require.Empty(t, c.Children)
+		require.NotEqual(t, 3, c.RosterIndex)
+		require.True(t, c.ServerIdentity.Equal(list[c.RosterIndex]))
+	}
+
+	keys := mergeSignerKeys([]decenarch.SignerKey{{Conode: "a"}}, []decenarch.SignerKey{{Conode: "a", Public: []byte{1}}, {Conode: "b"}})
+	require.Equal(t, []decenarch.SignerKey{{Conode: "a"}, {Conode: "b"}}, keys)
+}
@@ -0,0 +1,71 @@
+package service
+
+/*
+The cancel.go defines how a client cancels a save led by the conode, see
+decenarch.CancelRequest. The client identifies its save by a random session
+given in the save request, so that only the client can cancel it. A queued
+save leaves the queue at once, a running save stops at the next step of the
+save and returns decenarch.ErrSaveCanceled, before its pages are signed.
+*/
+
+import (
+	"context"
+	"sync"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+// sessions holds the cancel functions of the saves led by the conode, by
+// session
+type sessions struct {
+	sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+// newSessions returns an empty set of sessions
+func newSessions() *sessions {
+	return &sessions{cancels: make(map[string]context.CancelFunc)}
+}
+
+// start returns the context of the save of session, done when the client
+// cancels it, and the function to call once the save ended. A save without
+// session, or whose session is already running, cannot be canceled.
+func (ss *sessions) start(session string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if ss == nil || session == "" {
+		return ctx, cancel
+	}
+	ss.Lock()
+	defer ss.Unlock()
+	if _, ok := ss.cancels[session]; ok {
+		return ctx, cancel
+	}
+	ss.cancels[session] = cancel
+	return ctx, func() {
+		ss.Lock()
+		delete(ss.cancels, session)
+		ss.Unlock()
+		cancel()
+	}
+}
+
+// cancel cancels the save of session. It returns false if no save of the
+// session is running.
+func (ss *sessions) cancel(session string) bool {
+	if ss == nil {
+		return false
+	}
+	ss.Lock()
+	defer ss.Unlock()
+	cancel, ok := ss.cancels[session]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// Cancel stops the save of the session of the request, see
+// decenarch.CancelRequest
+func (s *Service) Cancel(req *decenarch.CancelRequest) (*decenarch.CancelResponse, error) {
+	return &decenarch.CancelResponse{Canceled: req.Session != "" && s.sessions.cancel(req.Session)}, nil
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCancelSession(t *testing.T) {
+	s := &Service{sessions: newSessions()}
+	ctx, end := s.sessions.start("session")
+	resp, err := s.Cancel(&decenarch.CancelRequest{Session: "other"})
+	require.Nil(t, err)
+	require.False(t, resp.Canceled)
+	require.Nil(t, ctx.Err())
+
+	// a session already running cannot be canceled by another save
+	again, endAgain := s.sessions.start("session")
+	endAgain()
+	require.NotNil(t, again.Err())
+	require.Nil(t, ctx.Err())
+
+	resp, err = s.Cancel(&decenarch.CancelRequest{Session: "session"})
+	require.Nil(t, err)
+	require.True(t, resp.Canceled)
+	require.NotNil(t, ctx.Err())
+
+	// the session ends with its save
+	end()
+	resp, err = s.Cancel(&decenarch.CancelRequest{Session: "session"})
+	require.Nil(t, err)
+	require.False(t, resp.Canceled)
+
+	// the saves without session cannot be canceled
+	ctx, end = s.sessions.start("")
+	defer end()
+	resp, err = s.Cancel(&decenarch.CancelRequest{})
+	require.Nil(t, err)
+	require.False(t, resp.Canceled)
+	require.Nil(t, ctx.Err())
+}
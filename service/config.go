@@ -0,0 +1,464 @@
+package service
+
+/*
+The config.go defines the decenarch-specific options of a conode. They are
+read at startup from decenarch.toml, stored in the configuration directory of
+the conode, or from the file given by the DECENARCH_CONFIG environment
+variable. A missing file means that the default options are used.
+*/
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	urlpkg "net/url"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/protocol"
+
+	"gopkg.in/dedis/onet.v2/cfgpath"
+	"gopkg.in/dedis/onet.v2/log"
+)
+
+// ConfigFileName is the name of the configuration file of the service
+const ConfigFileName = "decenarch.toml"
+
+// ConfigEnv is the environment variable overriding the path of the
+// configuration file
+const ConfigEnv = "DECENARCH_CONFIG"
+
+// Config holds the decenarch options of a conode
+type Config struct {
+	Quota    QuotaConfig
+	Policy   PolicyConfig
+	Limits   LimitsConfig
+	Tree     TreeConfig
+	Skip     SkipConfig
+	Tier     TierConfig
+	Render   RenderConfig
+	Profile  ProfileConfig
+	Evidence EvidenceConfig
+	Queue    QueueConfig
+	Notify   NotifyConfig
+	URL      URLConfig
+	Fetch    FetchConfig
+	Verify   VerifyConfig
+	Sign     SignConfig
+	Strip    StripConfig
+	CPU      CPUConfig
+}
+
+// QuotaConfig limits the work a single client can ask to the cothority. A
+// zero value means no limit.
+//    - SavesPerHour is the number of saves a client can do in one hour
+//    - MaxPageSize is the maximal size in bytes of the consensus page
+//    - MaxAdditionalResources is the maximal number of additional resources
+//      of a page
+type QuotaConfig struct {
+	SavesPerHour           int
+	MaxPageSize            int
+	MaxAdditionalResources int
+}
+
+// PolicyConfig lists the domains the conode refuses to archive, see
+// lib.DomainPolicy. A domain also matches all its subdomains.
+//    - Allow contains the only domains that can be archived, if not empty
+//    - Block contains the domains that cannot be archived
+type PolicyConfig struct {
+	Allow []string
+	Block []string
+}
+
+// DomainPolicy returns the hashed policy corresponding to the configuration
+func (c PolicyConfig) DomainPolicy() *lib.DomainPolicy {
+	return lib.NewDomainPolicy(c.Allow, c.Block)
+}
+
+// LimitsConfig bounds the resources fetched by the conode, so that a huge
+// resource cannot exhaust its memory. A zero value means no limit.
+//    - MaxResourceSize is the maximal size in bytes of the page and of each
+//      of its additional resources
+//    - ZeroPool is the number of encryptions of 0 the conode precomputes
+//      between the saves to encrypt its Bloom filters, see lib.ZeroPool.
+//      An encryption takes about 1KB of memory
+type LimitsConfig struct {
+	MaxResourceSize int64
+	ZeroPool        int
+}
+
+// TreeConfig defines the shape of the tree used for the saves led by the
+// conode.
+//    - BranchingFactor is the maximal number of children of a node. Zero
+//      means that it is chosen from the size of the roster
+//    - RTT gives the round-trip time in milliseconds to the conodes, by
+//      address. The conodes not listed are measured
+type TreeConfig struct {
+	BranchingFactor int
+	RTT             map[string]int
+}
+
+// SkipConfig defines how the conode stores the saved pages in the skipchain.
+//    - BlockInterval is the minimal number of seconds between two blocks
+//      stored by the conode, used if no interval was given at setup. Zero
+//      means that every save is stored in its own block
+//    - UnsignedBefore is the index of the first block of the default archive
+//      whose content must be signed, for the archives created before the
+//      signature of the blocks, see skip.SkipClient. Zero means that every
+//      block must be signed
+type SkipConfig struct {
+	BlockInterval  int64
+	UnsignedBefore int
+}
+
+// TierConfig defines where the conode stores the content of the pages, see
+// lib.Tier. All the conodes of a cothority should use the same option.
+//    - Hot is the directory of the content of the pages. Empty means that
+//      the content is stored in the skipchain
+//    - Cold is the directory the pruned contents are moved to. Empty means
+//      that the pruned contents are deleted
+//    - MinRetention is the minimal age in days of the contents the conode
+//      approves to prune. Zero means that the conode never prunes
+//    - IPFS is the URL of the HTTP API of an IPFS node pinning the content of
+//      the pages, e.g. http://127.0.0.1:5001. Empty means that IPFS is not
+//      used
+type TierConfig struct {
+	Hot          string
+	Cold         string
+	MinRetention int
+	IPFS         string
+}
+
+// RenderConfig defines the browser rendering the pages built by JavaScript,
+// for the saves asking for it, see protocol.Renderer.
+//    - CDP is the HTTP address of the DevTools of a headless Chromium, e.g.
+//      http://127.0.0.1:9222. Empty means that the conode cannot render the
+//      pages
+//    - Timeout is the maximal number of seconds of a rendering, zero means
+//      protocol.DefaultRenderTimeout
+//    - Settle is the number of milliseconds given to the scripts of the page
+//      after it is loaded
+type RenderConfig struct {
+	CDP     string
+	Timeout int
+	Settle  int
+}
+
+// Renderer returns the renderer corresponding to the configuration, nil if
+// no browser is configured
+func (c RenderConfig) Renderer() protocol.Renderer {
+	if c.CDP == "" {
+		return nil
+	}
+	return &protocol.CDPRenderer{
+		Endpoint: c.CDP,
+		Timeout:  time.Duration(c.Timeout) * time.Second,
+		Settle:   time.Duration(c.Settle) * time.Millisecond,
+	}
+}
+
+// ProfileConfig defines the profiling of the conode, see profile.go.
+//    - Address is the address of the HTTP server of the pprof profiles, e.g.
+//      127.0.0.1:6060. Empty means that the profiles are not served
+type ProfileConfig struct {
+	Address string
+}
+
+// EvidenceConfig defines what the conode does with the evidence of the
+// misbehaving conodes of its saves, see evidence.go.
+//    - Exclude excludes the accused conodes from the trees of the next saves
+//      led by the conode, until the operator re-admits them. The threshold
+//      is unchanged, so that too many exclusions make the saves fail
+type EvidenceConfig struct {
+	Exclude bool
+}
+
+// QueueConfig bounds the saves led by the conode at the same time, see
+// queue.go. A zero value means no limit.
+//    - MaxConcurrent is the maximal number of running saves
+//    - MaxQueue is the maximal number of saves waiting for a running one to
+//      end. The saves arriving when the queue is full are refused
+type QueueConfig struct {
+	MaxConcurrent int
+	MaxQueue      int
+}
+
+// NotifyConfig defines the webhooks the conode posts its events to, see
+// notify.go. The webhooks registered by the clients are added to them.
+//    - Webhooks are the URLs receiving all the events of the conode, e.g.
+//      the endpoint of a monitoring system. They can be private addresses
+//    - Timeout is the maximal number of seconds of a delivery, zero means
+//      DefaultNotifyTimeout
+type NotifyConfig struct {
+	Webhooks []string
+	Timeout  int
+}
+
+// URLConfig defines the canonical form of the URLs saved and retrieved by the
+// conode, see lib.URLNormalizer. All the conodes of a cothority should use
+// the same option. The normalizer of the links to the additional resources
+// of the pages is the one of the conode leading the setup of the archive.
+//    - StripParams are the query parameters removed from the URLs, e.g.
+//      utm_* for all the parameters starting with utm_. The default is
+//      lib.DefaultStripParams, an empty list keeps all the parameters
+type URLConfig struct {
+	StripParams []string
+}
+
+// Normalizer returns the normalizer corresponding to the configuration
+func (c URLConfig) Normalizer() *lib.URLNormalizer {
+	return lib.NewURLNormalizer(c.StripParams)
+}
+
+// FetchConfig defines how the conode fetches the pages, see
+// protocol.FetchOptions.
+//    - Timeout is the maximal number of seconds of a fetch, zero for the
+//      default of the protocols
+//    - Proxy is the URL of the HTTP proxy the pages are fetched through, e.g.
+//      http://127.0.0.1:3128. Empty means that the conode connects to the web
+//      sites directly
+//    - Politeness is the minimal number of milliseconds between two fetches
+//      to the same host
+//    - CacheDir is the directory of the cache of the fetched resources, see
+//      protocol.FetchCache. Empty means that the resources are always
+//      downloaded
+//    - CacheSize is the maximal size in megabytes of the cache, zero for
+//      protocol.DefaultCacheSize
+type FetchConfig struct {
+	Timeout    int
+	Proxy      string
+	Politeness int
+	CacheDir   string
+	CacheSize  int
+}
+
+// VerifyConfig defines the background re-verification of the skipblocks
+// stored by the conode, see verifier.go.
+//    - Interval is the number of minutes between two rounds. Zero means that
+//      the skipblocks are not verified again
+//    - Sample is the average number of skipblocks verified per round
+type VerifyConfig struct {
+	Interval int
+	Sample   int
+}
+
+// SignConfig defines the ftcosi protocols signing the saves led by the
+// conode, see signing.go. A save can lower the timeout and the retries, see
+// decenarch.SignOptions.
+//    - Subtrees is the number of subtrees of the protocols. Zero means the
+//      cube root of the number of conodes
+//    - Timeout is the number of seconds the root waits for a subtree before
+//      replacing its subleader, zero means DefaultSignTimeout
+//    - Retries is the number of times a protocol is run again after a
+//      timeout
+type SignConfig struct {
+	Subtrees int
+	Timeout  int
+	Retries  int
+}
+
+// StripConfig lists the elements removed from the pages before the consensus,
+// e.g. the cookie banners and the ad containers whose content changes on
+// every fetch, see lib.StripElements. The root sends the selectors of the
+// page to the other conodes, so that all apply the same, and the conodes
+// refuse the selectors missing from their own option: all the conodes of a
+// cothority should use the same option.
+//    - Selectors are the CSS selectors of the elements removed from all the
+//      pages
+//    - Domains are the CSS selectors of the elements removed from the pages
+//      of a domain and of its subdomains, by domain
+type StripConfig struct {
+	Selectors []string
+	Domains   map[string][]string
+}
+
+// Rules returns the strip rules corresponding to the configuration
+func (c StripConfig) Rules() (*lib.StripRules, error) {
+	return lib.NewStripRules(c.Selectors, c.Domains)
+}
+
+// CPUConfig bounds the CPUs used by the computations on the encrypted Bloom
+// filters, i.e. their encryption, the verification of their proofs and their
+// decryption, see lib.Workers.
+//    - Workers is the number of goroutines of these computations. Zero means
+//      GOMAXPROCS and 1 disables their parallelization
+//    - SaveWorkers is the maximal number of goroutines of these computations
+//      for a single save, so that a big save cannot starve the other
+//      services of the conode. Zero means Workers
+type CPUConfig struct {
+	Workers     int
+	SaveWorkers int
+}
+
+// Fetcher returns the fetcher corresponding to the configuration, nil for the
+// default fetcher
+func (c FetchConfig) Fetcher() (protocol.Fetcher, error) {
+	send, err := c.Sender()
+	if err != nil || send == nil {
+		return nil, err
+	}
+	return protocol.GetFetcher(send), nil
+}
+
+// Sender returns the sender corresponding to the configuration, nil for the
+// default sender
+func (c FetchConfig) Sender() (protocol.Sender, error) {
+	if c == (FetchConfig{}) {
+		return nil, nil
+	}
+	opts := protocol.FetchOptions{
+		Timeout:    time.Duration(c.Timeout) * time.Second,
+		Politeness: time.Duration(c.Politeness) * time.Millisecond,
+	}
+	if c.Proxy != "" {
+		proxy, err := urlpkg.Parse(c.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		opts.Proxy = proxy
+	}
+	send := protocol.NewHTTPSender(opts)
+	if c.CacheDir == "" {
+		return send, nil
+	}
+	cache, err := protocol.NewFetchCache(c.CacheDir, int64(c.CacheSize)*1024*1024)
+	if err != nil {
+		return nil, err
+	}
+	return cache.Sender(send), nil
+}
+
+// DefaultMaxResourceSize is the default maximal size of a fetched resource
+const DefaultMaxResourceSize = 32 * 1024 * 1024
+
+// DefaultZeroPool is the default number of precomputed encryptions of 0,
+// enough for the filters of the pages of a few thousand unique leaves
+const DefaultZeroPool = 1 << 16
+
+// DefaultNotifyTimeout is the default maximal duration of the delivery of an
+// event to a webhook
+const DefaultNotifyTimeout = 10 * time.Second
+
+// DefaultVerifyInterval and DefaultVerifySample are the default rounds of the
+// re-verification of the skipblocks
+const (
+	DefaultVerifyInterval = 60
+	DefaultVerifySample   = 8
+)
+
+// DefaultSignTimeout is the default number of seconds the root of a signing
+// protocol waits for a subtree
+const DefaultSignTimeout = 5 * 60
+
+// DefaultMaxConcurrent and DefaultMaxQueue are the default limits of the
+// saves led by the conode
+const (
+	DefaultMaxConcurrent = 4
+	DefaultMaxQueue      = 32
+)
+
+// DefaultConfig returns the options used when no configuration file is given
+func DefaultConfig() *Config {
+	return &Config{
+		Limits: LimitsConfig{MaxResourceSize: DefaultMaxResourceSize, ZeroPool: DefaultZeroPool},
+		Queue:  QueueConfig{MaxConcurrent: DefaultMaxConcurrent, MaxQueue: DefaultMaxQueue},
+		URL:    URLConfig{StripParams: lib.DefaultStripParams},
+		Verify: VerifyConfig{Interval: DefaultVerifyInterval, Sample: DefaultVerifySample},
+		Sign:   SignConfig{Timeout: DefaultSignTimeout},
+	}
+}
+
+// configPath returns the path of the configuration file of the service
+func configPath() string {
+	if p := os.Getenv(ConfigEnv); p != "" {
+		return p
+	}
+	return path.Join(cfgpath.GetConfigPath("conode"), ConfigFileName)
+}
+
+// loadConfig reads the configuration file at the given path. The default
+// options are returned if the file doesn't exist. The unknown options and
+// the invalid values are refused, see Validate.
+func loadConfig(p string) (*Config, error) {
+	c := DefaultConfig()
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		log.Lvl2("No decenarch configuration in", p, "using default options")
+		return c, nil
+	}
+	md, err := toml.DecodeFile(p, c)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown option %s in %s", undecoded[0], p)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration %s: %s", p, err)
+	}
+	return c, nil
+}
+
+// Validate returns an error if an option has an invalid value
+func (c *Config) Validate() error {
+	for name, v := range map[string]int64{
+		"Quota.SavesPerHour":           int64(c.Quota.SavesPerHour),
+		"Quota.MaxPageSize":            int64(c.Quota.MaxPageSize),
+		"Quota.MaxAdditionalResources": int64(c.Quota.MaxAdditionalResources),
+		"Limits.MaxResourceSize":       c.Limits.MaxResourceSize,
+		"Limits.ZeroPool":              int64(c.Limits.ZeroPool),
+		"Tree.BranchingFactor":         int64(c.Tree.BranchingFactor),
+		"Skip.BlockInterval":           c.Skip.BlockInterval,
+		"Skip.UnsignedBefore":          int64(c.Skip.UnsignedBefore),
+		"Tier.MinRetention":            int64(c.Tier.MinRetention),
+		"Render.Timeout":               int64(c.Render.Timeout),
+		"Render.Settle":                int64(c.Render.Settle),
+		"Queue.MaxConcurrent":          int64(c.Queue.MaxConcurrent),
+		"Queue.MaxQueue":               int64(c.Queue.MaxQueue),
+		"Notify.Timeout":               int64(c.Notify.Timeout),
+		"Fetch.Timeout":                int64(c.Fetch.Timeout),
+		"Fetch.Politeness":             int64(c.Fetch.Politeness),
+		"Fetch.CacheSize":              int64(c.Fetch.CacheSize),
+		"Verify.Interval":              int64(c.Verify.Interval),
+		"Verify.Sample":                int64(c.Verify.Sample),
+		"Sign.Subtrees":                int64(c.Sign.Subtrees),
+		"Sign.Timeout":                 int64(c.Sign.Timeout),
+		"Sign.Retries":                 int64(c.Sign.Retries),
+		"CPU.Workers":                  int64(c.CPU.Workers),
+		"CPU.SaveWorkers":              int64(c.CPU.SaveWorkers),
+	} {
+		if v < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	for addr, ms := range c.Tree.RTT {
+		if ms < 0 {
+			return fmt.Errorf("Tree.RTT of %s must not be negative", addr)
+		}
+	}
+	urls := map[string]string{
+		"Render.CDP":  c.Render.CDP,
+		"Tier.IPFS":   c.Tier.IPFS,
+		"Fetch.Proxy": c.Fetch.Proxy,
+	}
+	for i, w := range c.Notify.Webhooks {
+		urls[fmt.Sprintf("Notify.Webhooks[%d]", i)] = w
+	}
+	for name, raw := range urls {
+		if raw == "" {
+			continue
+		}
+		u, err := urlpkg.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s must be an http or https URL", name)
+		}
+	}
+	if _, err := c.Strip.Rules(); err != nil {
+		return fmt.Errorf("Strip: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "decenarch-config")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	p := path.Join(dir, ConfigFileName)
+	write := func(content string) {
+		require.Nil(t, ioutil.WriteFile(p, []byte(content), 0600))
+	}
+
+	// a missing file gives the default options
+	c, err := loadConfig(p)
+	require.Nil(t, err)
+	require.Equal(t, DefaultConfig(), c)
+
+	write("[Fetch]\nTimeout = 10\nProxy = \"http://127.0.0.1:3128\"\nPoliteness = 500\n")
+	c, err = loadConfig(p)
+	require.Nil(t, err)
+	require.Equal(t, FetchConfig{Timeout: 10, Proxy: "http://127.0.0.1:3128", Politeness: 500}, c.Fetch)
+	require.Equal(t, DefaultMaxResourceSize, int(c.Limits.MaxResourceSize))
+	fetch, err := c.Fetch.Fetcher()
+	require.Nil(t, err)
+	require.NotNil(t, fetch)
+
+	write("[Strip]\nSelectors = [\"#cookie-banner\"]\n[Strip.Domains]\n\"example.com\" = [\"div.ad\"]\n")
+	c, err = loadConfig(p)
+	require.Nil(t, err)
+	rules, err := c.Strip.Rules()
+	require.Nil(t, err)
+	require.Equal(t, []string{"#cookie-banner", "div.ad"}, rules.Selectors("www.example.com"))
+
+	// the misspelled options and the invalid values are refused
+	for _, content := range []string{
+		"[Fetch]\nTimeOut = 10\n",
+		"[Queue]\nMaxConcurrent = -1\n",
+		"[Sign]\nRetries = -1\n",
+		"[CPU]\nSaveWorkers = -1\n",
+		"[Fetch]\nCacheSize = -1\n",
+		"[Fetch]\nProxy = \"127.0.0.1:3128\"\n",
+		"[Notify]\nWebhooks = [\"ftp://example.com\"]\n",
+		"[Strip]\nSelectors = [\"div[\"]\n",
+	} {
+		write(content)
+		_, err = loadConfig(p)
+		require.NotNil(t, err, content)
+	}
+
+	// no fetcher without fetch options
+	fetch, err = DefaultConfig().Fetch.Fetcher()
+	require.Nil(t, err)
+	require.Nil(t, fetch)
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "decenarch-config")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	p := path.Join(dir, ConfigFileName)
+	require.Nil(t, os.Setenv(ConfigEnv, p))
+	defer os.Unsetenv(ConfigEnv)
+
+	config := DefaultConfig()
+	s := &Service{Storage: &Storage{}, quota: newQuota(config.Quota), queue: newSaveQueue(config.Queue)}
+	require.Nil(t, s.applyConfig(config))
+
+	content := "[Quota]\nSavesPerHour = 3\n[Tier]\nHot = \"" + dir + "\"\n"
+	require.Nil(t, ioutil.WriteFile(p, []byte(content), 0600))
+	out, err := s.reloadConfig()
+	require.Nil(t, err)
+	require.Contains(t, out, "restart the conode to apply Tier")
+	require.Equal(t, 3, s.conf().Quota.SavesPerHour)
+	require.Equal(t, 3, s.quota.config.SavesPerHour)
+	require.Equal(t, "", s.conf().Tier.Hot)
+
+	// an invalid file keeps the current options
+	require.Nil(t, ioutil.WriteFile(p, []byte("[Quota]\nSavesPerHour = -1\n"), 0600))
+	_, err = s.reloadConfig()
+	require.NotNil(t, err)
+	require.Equal(t, 3, s.conf().Quota.SavesPerHour)
+}
+
+func TestVerifyStrip(t *testing.T) {
+	c := DefaultConfig()
+	c.Strip = StripConfig{Selectors: []string{"#cookie-banner"}, Domains: map[string][]string{"example.com": {"div.ad"}}}
+	s := &Service{config: c}
+
+	// the conodes only apply the selectors of their own configuration
+	require.Nil(t, s.verifyStrip("https://www.example.com/a", []string{"#cookie-banner", "div.ad"}))
+	require.Nil(t, s.verifyStrip("https://www.example.com/a", nil))
+	require.NotNil(t, s.verifyStrip("https://other.org/a", []string{"div.ad"}))
+	require.NotNil(t, s.verifyStrip("https://www.example.com/a", []string{"body"}))
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/stretchr/testify/require"
+)
+
+// testSitePage is a page with a style sheet and an image, saved by the
+// end-to-end test
+const testSitePage = `<html><head><title>decenarch</title>
+<link rel="stylesheet" href="style.css"></head><body>
+<h1>Decentralized archive</h1><img src="/images/logo.png">
+<p>The conodes agree on the page and on its resources.</p>
+</body></html>`
+
+// testSite is the site served to the conodes by the end-to-end test
+var testSite = map[string]testResource{
+	"/site/index.html": {"text/html; charset=utf-8", testSitePage},
+	"/site/style.css":  {"text/css", "h1 { color: navy; }\n"},
+	"/images/logo.png": {"image/png", "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"},
+}
+
+// TestEndToEnd saves a page with its resources, stores them in a block and
+// retrieves them, through all the modules of the conodes
+func TestEndToEnd(t *testing.T) {
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	nodes, roster, _ := local.GenBigTree(5, 5, 1, true)
+	var services []*Service
+	for _, s := range local.GetServices(nodes, templateID) {
+		services = append(services, s.(*Service))
+	}
+	root := services[0]
+	server := newTestServer(testSite)
+	defer server.Close()
+	now := time.Date(2018, time.June, 1, 12, 0, 0, 0, time.Local)
+	defer useTestHooks(services, server, now)()
+	pageURL := "http://example.com/site/index.html"
+	timestamp := now.Format("2006/01/02 15:04")
+
+	// setup, the pages are kept until the block is flushed
+	_, err := root.Setup(&decenarch.SetupRequest{Roster: roster, BlockInterval: 3600})
+	require.Nil(t, err)
+
+	save, err := root.SaveWebpage(&decenarch.SaveRequest{Roster: roster, Url: pageURL})
+	require.Nil(t, err)
+	require.Nil(t, save.BlockID)
+	require.Equal(t, timestamp, save.Timestamp)
+	require.Equal(t, []string{"http://example.com/site/style.css", "http://example.com/images/logo.png"}, save.Adds)
+
+	// nothing can be retrieved before the block is stored
+	_, err = root.Retrieve(&decenarch.RetrieveRequest{Roster: roster, Url: pageURL, Timestamp: timestamp})
+	require.NotNil(t, err)
+
+	flushed, err := root.Flush(&decenarch.FlushRequest{})
+	require.Nil(t, err)
+	require.Equal(t, 3, flushed.Pages)
+
+	// the retrieved pages are signed by the roster
+	resp, err := root.Retrieve(&decenarch.RetrieveRequest{Roster: roster, Url: pageURL, Timestamp: timestamp})
+	require.Nil(t, err)
+	require.Equal(t, pageURL, resp.Main.Url)
+	require.Equal(t, timestamp, resp.Main.Timestamp)
+	threshold := decenarch.Threshold(len(roster.List))
+	page, err := base64.StdEncoding.DecodeString(resp.Main.Page)
+	require.Nil(t, err)
+	require.Nil(t, lib.VerifyCosi(roster.Publics(), page, resp.Main.Sig.Signature, threshold))
+	require.Equal(t, save.PageHash, lib.ContentHash(page))
+
+	// all the conodes agree on the whole page, which is rendered as the
+	// parsed page of the server
+	doc, err := html.Parse(bytes.NewBufferString(testSitePage))
+	require.Nil(t, err)
+	var rendered bytes.Buffer
+	require.Nil(t, html.Render(&rendered, doc))
+	require.Equal(t, rendered.String(), string(page))
+
+	// the resources are stored with their content
+	require.Len(t, resp.Adds, 2)
+	for _, add := range resp.Adds {
+		content, err := base64.StdEncoding.DecodeString(add.Page)
+		require.Nil(t, err)
+		require.Nil(t, lib.VerifyCosi(roster.Publics(), content, add.Sig.Signature, threshold))
+		res := testSite[add.Url[len("http://example.com"):]]
+		require.Equal(t, res.content, string(content))
+		require.Equal(t, res.contentType, add.ContentType)
+	}
+
+	// a page saved later isn't returned for an earlier time
+	_, err = root.Retrieve(&decenarch.RetrieveRequest{Roster: roster, Url: pageURL,
+		Timestamp: now.Add(-time.Hour).Format("2006/01/02 15:04")})
+	require.NotNil(t, err)
+}
+
+// TestRetrieveResources saves two snapshots of a page whose style sheet
+// changed into the same block, and retrieves the first one: the style sheet
+// of the second snapshot has the same url but is not returned
+func TestRetrieveResources(t *testing.T) {
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	nodes, roster, _ := local.GenBigTree(5, 5, 1, true)
+	var services []*Service
+	for _, s := range local.GetServices(nodes, templateID) {
+		services = append(services, s.(*Service))
+	}
+	root := services[0]
+	pageURL := "http://example.com/site/index.html"
+	now := time.Date(2018, time.June, 1, 12, 0, 0, 0, time.Local)
+	timestamp := now.Format("2006/01/02 15:04")
+
+	server := newTestServer(testSite)
+	defer server.Close()
+	restore := useTestHooks(services, server, now)
+	defer restore()
+	_, err := root.Setup(&decenarch.SetupRequest{Roster: roster, BlockInterval: 3600})
+	require.Nil(t, err)
+	_, err = root.SaveWebpage(&decenarch.SaveRequest{Roster: roster, Url: pageURL})
+	require.Nil(t, err)
+
+	changed := make(map[string]testResource)
+	for path, res := range testSite {
+		changed[path] = res
+	}
+	changed["/site/style.css"] = testResource{"text/css", "h1 { color: red; }\n"}
+	other := newTestServer(changed)
+	defer other.Close()
+	useTestHooks(services, other, now.Add(time.Hour))
+	_, err = root.SaveWebpage(&decenarch.SaveRequest{Roster: roster, Url: pageURL, Force: true})
+	require.Nil(t, err)
+
+	_, err = root.Flush(&decenarch.FlushRequest{})
+	require.Nil(t, err)
+
+	// the resources are matched by content hash, the unchanged logo may
+	// be returned once per snapshot
+	resp, err := root.Retrieve(&decenarch.RetrieveRequest{Roster: roster, Url: pageURL, Timestamp: timestamp})
+	require.Nil(t, err)
+	require.Equal(t, timestamp, resp.Main.Timestamp)
+	styles := 0
+	for _, add := range resp.Adds {
+		content, err := base64.StdEncoding.DecodeString(add.Page)
+		require.Nil(t, err)
+		require.Equal(t, testSite[add.Url[len("http://example.com"):]].content, string(content))
+		if add.Url == "http://example.com/site/style.css" {
+			styles++
+		}
+	}
+	require.Equal(t, 1, styles)
+}
@@ -0,0 +1,84 @@
+package service
+
+/*
+The evidence.go defines how the conode handles the evidence of misbehaviour
+reported by the protocols of a save, see decenarch.Evidence. The evidence is
+always returned to the client and stored with the page. If EvidenceConfig
+asks for it, the accused conodes are also excluded from the trees of the next
+saves led by the conode, until the operator re-admits them with the readmit
+admin command.
+*/
+
+import (
+	"encoding/json"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/protocol"
+
+	"gopkg.in/dedis/onet.v2"
+)
+
+// excluded returns the public keys of the conodes excluded from the trees
+func (s *Service) excluded() map[string]bool {
+	s.Storage.Lock()
+	defer s.Storage.Unlock()
+	excluded := make(map[string]bool, len(s.Storage.Excluded))
+	for k := range s.Storage.Excluded {
+		excluded[k] = true
+	}
+	return excluded
+}
+
+// exclude excludes from the trees the conodes accused by the evidence, if the
+// configuration asks for it. The evidence not signed by a conode of the
+// roster, or whose contribution does not prove the misbehaviour of the
+// accused conode, is ignored, and the conode never excludes itself.
+func (s *Service) exclude(r *onet.Roster, evidence []decenarch.Evidence, logger *lib.Logger) {
+	if !s.conf().Evidence.Exclude || len(evidence) == 0 {
+		return
+	}
+	self := s.ServerIdentity().Public.String()
+	s.Storage.Lock()
+	for _, e := range evidence {
+		if e.Accused == self {
+			continue
+		}
+		if err := protocol.VerifyEvidence(e, r.Publics()); err != nil {
+			logger.Lvl1("Invalid evidence, conode not excluded", "accused", e.Accused, "error", err)
+			continue
+		}
+		if s.Storage.Excluded == nil {
+			s.Storage.Excluded = make(map[string]decenarch.Evidence)
+		}
+		if _, ok := s.Storage.Excluded[e.Accused]; !ok {
+			logger.Lvl1("Conode excluded from the trees", "accused", e.Accused, "reason", e.Reason)
+			s.Storage.Excluded[e.Accused] = e
+		}
+	}
+	s.Storage.Unlock()
+	s.save()
+}
+
+// readmit re-admits all the excluded conodes in the trees and returns how
+// many were excluded
+func (s *Service) readmit() int {
+	s.Storage.Lock()
+	n := len(s.Storage.Excluded)
+	s.Storage.Excluded = nil
+	s.Storage.Unlock()
+	s.save()
+	return n
+}
+
+// showExcluded returns the evidence against the excluded conodes as JSON
+func (s *Service) showExcluded() (string, error) {
+	s.Storage.Lock()
+	defer s.Storage.Unlock()
+	excluded := s.Storage.Excluded
+	if excluded == nil {
+		excluded = make(map[string]decenarch.Evidence)
+	}
+	out, err := json.MarshalIndent(excluded, "", "  ")
+	return string(out), err
+}
@@ -0,0 +1,78 @@
+package service
+
+/*
+The export.go defines the API-calls used to export and import the archive.
+The export is done by the client, which reads the skipchain and asks the
+conodes for the content of the pages kept in their storage tiers. The import
+stores the exported blocks in the skipchain of the conode, after checking
+the collective signatures of the pages and of the blocks. Since the
+signatures are checked against the roster given at setup, an archive can only
+be imported by the conodes that signed it, e.g. after a migration to new
+hardware, and only on the request of an authorized client or of the operator
+of the conode.
+*/
+
+import (
+	"errors"
+
+	"gopkg.in/dedis/kyber.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// Content returns the content of a page stored in the storage tiers of the
+// conode
+func (s *Service) Content(req *decenarch.ContentRequest) (*decenarch.ContentResponse, error) {
+	tier := lib.NewMultiTier(s.hot, s.cold)
+	if tier == nil {
+		return nil, errors.New("no storage tier configured, the pages are stored in the skipchain")
+	}
+	data, err := tier.Get(req.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return &decenarch.ContentResponse{Data: data}, nil
+}
+
+// Import stores an exported block in the skipchain of the namespace of the
+// request
+func (s *Service) Import(req *decenarch.ImportRequest) (*decenarch.ImportResponse, error) {
+	requestID := lib.NewRequestID()
+	setup := s.namespace(req.Namespace)
+	if setup.GenesisID == nil || setup.Roster == nil {
+		return nil, decenarch.ErrNoSetup
+	}
+	if err := s.verifyImportRequest(req, setup.AuthorizedKeys); err != nil {
+		return nil, err
+	}
+
+	// pages waiting for the next block are stored first, so that the
+	// imported blocks keep their order
+	if _, err := s.flush(requestID); err != nil {
+		return nil, err
+	}
+
+	s.batch.storing.Lock()
+	defer s.batch.storing.Unlock()
+	resp, err := s.namespaceArchive(req.Namespace).AddData(setup.GenesisID, setup.Roster, &req.Block)
+	if err != nil {
+		return nil, err
+	}
+	s.updateNamespace(req.Namespace, func(n *Namespace) {
+		n.LatestID = resp.Latest.Hash
+	})
+	s.notify(decenarch.Event{Type: decenarch.EventBlockCreated, RequestID: requestID, BlockID: resp.Latest.Hash})
+	s.logger(requestID).Lvl2("Block imported", "pages", len(req.Block.Pages), "timestamp", req.Block.Timestamp)
+	return &decenarch.ImportResponse{BlockID: resp.Latest.Hash}, nil
+}
+
+// verifyImportRequest returns an error if the import request is not signed by
+// one of the authorized clients or by the private key of this conode
+func (s *Service) verifyImportRequest(req *decenarch.ImportRequest, authorized []kyber.Point) error {
+	if req.PublicKey == nil {
+		return errors.New("import request must be signed by an authorized client or by the conode")
+	}
+	signers := append([]kyber.Point{s.ServerIdentity().Public}, authorized...)
+	return verifySigned(signers, "import", req.PublicKey, req.Timestamp, req.Message(), req.Signature)
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	cosiservice "gopkg.in/dedis/cothority.v2/ftcosi/service"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestImportAuthorization(t *testing.T) {
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	servers, _, _ := local.GenTree(1, true)
+	s := local.GetServices(servers, templateID)[0].(*Service)
+
+	sign := func(kp *key.Pair) *decenarch.ImportRequest {
+		req := &decenarch.ImportRequest{
+			Block:     decenarch.Block{Sig: &cosiservice.SignatureResponse{Hash: []byte("block")}},
+			Timestamp: time.Now().Unix(),
+			PublicKey: kp.Public,
+		}
+		sig, err := schnorr.Sign(decenarch.Suite, kp.Private, req.Message())
+		require.Nil(t, err)
+		req.Signature = sig
+		return req
+	}
+	client := key.NewKeyPair(decenarch.Suite)
+	authorized := []kyber.Point{client.Public}
+
+	// unsigned requests and requests of unknown clients are refused
+	require.NotNil(t, s.verifyImportRequest(&decenarch.ImportRequest{Timestamp: time.Now().Unix()}, authorized))
+	require.NotNil(t, s.verifyImportRequest(sign(client), nil))
+
+	// authorized clients and the conode itself can import
+	require.Nil(t, s.verifyImportRequest(sign(client), authorized))
+	conode := &key.Pair{Public: servers[0].ServerIdentity.Public, Private: local.GetPrivate(servers[0])}
+	require.Nil(t, s.verifyImportRequest(sign(conode), nil))
+
+	// the signature covers the block
+	req := sign(client)
+	req.Block.Sig.Hash = []byte("other block")
+	require.NotNil(t, s.verifyImportRequest(req, authorized))
+}
@@ -0,0 +1,394 @@
+package service
+
+/*
+The feed.go defines the feeds watched by the conode. The conode polls every
+watched RSS or Atom feed at its interval and saves, with the roster of its
+setup, the pages linked by the entries it did not see yet. The pages record
+the URL of their feed, see decenarch.Webstore, so that the entries of a feed
+can be found in the skipchain. The state of the feeds is kept in the storage,
+so that a restarted conode does not save the same entries again. A feed is
+owned by the client who signed the request watching it, only this client or
+the conode itself can change or remove it. The entries are saved for the
+owner: the conodes check that it is authorized and count the saves against
+its quota.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+)
+
+const (
+	// DefaultFeedInterval is the default duration between two polls of a
+	// feed
+	DefaultFeedInterval = 15 * time.Minute
+	// minFeedInterval is the minimal duration between two polls of a feed
+	minFeedInterval = time.Minute
+	// feedTick is the duration between two checks of the feeds to poll
+	feedTick = time.Minute
+	// maxFeeds is the maximal number of feeds watched by a conode
+	maxFeeds = 100
+	// maxFeedSize is the maximal size in bytes of a feed
+	maxFeedSize = 4 * 1024 * 1024
+	// maxFeedSaves is the maximal number of entries saved per poll, the
+	// other new entries are saved by the next polls
+	maxFeedSaves = 20
+	// maxFeedSeen is the number of entries remembered per feed
+	maxFeedSeen = 1000
+)
+
+// Feed is a feed watched by the conode
+//    - Url is the address of the feed
+//    - Interval is the number of seconds between two polls
+//    - LastPoll is the unix time of the last poll, zero if never polled
+//    - Seen are the links of the last entries already saved
+//    - Saved is the number of entries saved
+//    - Error is the error of the last poll or of the last save, if any
+//    - Watch is the signed request of the client who watches the feed, given
+//      with the saves of its entries, see decenarch.SaveRequest. Nil for the
+//      feeds watched before the requests were signed
+type Feed struct {
+	Url      string
+	Interval int64
+	LastPoll int64
+	Seen     []string
+	Saved    int
+	Error    string
+	Watch    *decenarch.WatchFeedRequest
+}
+
+// owner returns the key of the client who watches the feed, nil if unknown
+func (f Feed) owner() kyber.Point {
+	if f.Watch == nil {
+		return nil
+	}
+	return f.Watch.PublicKey
+}
+
+// WatchFeed adds or removes the feed of the request, and returns the feeds
+// watched by the conode
+func (s *Service) WatchFeed(req *decenarch.WatchFeedRequest) (*decenarch.WatchFeedResponse, error) {
+	log.Lvl3("Decenarch Service new WatchFeedRequest:", req.Url)
+	// the feeds are kept under their canonical URL, see URLConfig
+	url := s.normalizeURL(req.Url)
+	if url != "" {
+		if err := s.verifyFeedRequest(req, url); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case url == "":
+	case req.Remove:
+		if !s.removeFeed(url) {
+			return nil, errors.New("the conode does not watch " + url)
+		}
+	default:
+		if err := s.addFeed(url, time.Duration(req.Interval)*time.Second, req); err != nil {
+			return nil, err
+		}
+		s.scheduleFeeds()
+	}
+	return &decenarch.WatchFeedResponse{Feeds: s.feedStatus()}, nil
+}
+
+// verifyFeedRequest returns an error if the request changing the feed at url
+// is not signed by the client who watches the feed or by the private key of
+// this conode. A feed not watched yet can be watched by any client signing
+// the request, or only by the authorized clients if the cothority only
+// accepts save requests from them.
+func (s *Service) verifyFeedRequest(req *decenarch.WatchFeedRequest, url string) error {
+	if req.PublicKey == nil {
+		return errors.New("feed request must be signed")
+	}
+	signers := []kyber.Point{s.ServerIdentity().Public}
+	s.Storage.Lock()
+	watched := false
+	for _, f := range s.Storage.Feeds {
+		if f.Url == url {
+			watched = true
+			if owner := f.owner(); owner != nil {
+				signers = append(signers, owner)
+			}
+		}
+	}
+	s.Storage.Unlock()
+	if !watched {
+		if authorized := s.authorizedKeys(); len(authorized) > 0 && !hasKey(authorized, req.PublicKey) {
+			return errors.New("client " + req.PublicKey.String() + " is not authorized to watch feeds")
+		}
+		signers = append(signers, req.PublicKey)
+	}
+	return verifySigned(signers, "feed", req.PublicKey, req.Timestamp, req.Message(), req.Signature)
+}
+
+// addFeed starts watching the feed at url for the client of watch, or changes
+// its interval if it is already watched
+func (s *Service) addFeed(url string, interval time.Duration, watch *decenarch.WatchFeedRequest) error {
+	if s.setupRoster() == nil {
+		return decenarch.ErrNoSetup
+	}
+	if err := s.checkRawURL(url); err != nil {
+		return err
+	}
+	if interval == 0 {
+		interval = DefaultFeedInterval
+	}
+	if interval < minFeedInterval {
+		return fmt.Errorf("the interval of a feed cannot be shorter than %s", minFeedInterval)
+	}
+
+	seconds := int64(interval / time.Second)
+	s.Storage.Lock()
+	watched := false
+	for i := range s.Storage.Feeds {
+		if s.Storage.Feeds[i].Url == url {
+			s.Storage.Feeds[i].Interval = seconds
+			// the request of the owner replaces the one given with
+			// the saves, the conode only changes the interval of a
+			// feed it does not own
+			if owner := s.Storage.Feeds[i].owner(); owner == nil || owner.Equal(watch.PublicKey) {
+				s.Storage.Feeds[i].Watch = watch
+			}
+			watched = true
+		}
+	}
+	if !watched {
+		if len(s.Storage.Feeds) >= maxFeeds {
+			s.Storage.Unlock()
+			return fmt.Errorf("the conode already watches %d feeds", maxFeeds)
+		}
+		s.Storage.Feeds = append(s.Storage.Feeds, Feed{Url: url, Interval: seconds, Watch: watch})
+	}
+	s.Storage.Unlock()
+	s.save()
+	return nil
+}
+
+// removeFeed stops watching the feed at url, it returns false if the feed
+// was not watched
+func (s *Service) removeFeed(url string) bool {
+	s.Storage.Lock()
+	found := false
+	kept := s.Storage.Feeds[:0]
+	for _, f := range s.Storage.Feeds {
+		if f.Url == url {
+			found = true
+			continue
+		}
+		kept = append(kept, f)
+	}
+	s.Storage.Feeds = kept
+	s.Storage.Unlock()
+	if found {
+		s.save()
+	}
+	return found
+}
+
+// feedStatus returns the status of the watched feeds
+func (s *Service) feedStatus() []decenarch.FeedStatus {
+	s.Storage.Lock()
+	defer s.Storage.Unlock()
+	status := make([]decenarch.FeedStatus, len(s.Storage.Feeds))
+	for i, f := range s.Storage.Feeds {
+		status[i] = decenarch.FeedStatus{Url: f.Url, Interval: f.Interval, Saved: f.Saved, Error: f.Error}
+		if f.LastPoll != 0 {
+			status[i].LastPoll = time.Unix(f.LastPoll, 0).Format(decenarch.StatTimeFormat)
+		}
+	}
+	return status
+}
+
+// setupRoster returns the roster given at setup
+func (s *Service) setupRoster() *onet.Roster {
+	s.Storage.Lock()
+	defer s.Storage.Unlock()
+	return s.Storage.Roster
+}
+
+// scheduleFeeds checks the feeds to poll after feedTick, if the conode
+// watches feeds and no check is scheduled yet
+func (s *Service) scheduleFeeds() {
+	s.Storage.Lock()
+	watched := len(s.Storage.Feeds)
+	s.Storage.Unlock()
+	s.feedMutex.Lock()
+	defer s.feedMutex.Unlock()
+	if watched == 0 || s.feedTimer != nil {
+		return
+	}
+	s.feedTimer = time.AfterFunc(feedTick, func() {
+		s.feedMutex.Lock()
+		s.feedTimer = nil
+		s.feedMutex.Unlock()
+		s.pollFeeds()
+		s.scheduleFeeds()
+	})
+}
+
+// pollFeeds polls the feeds whose interval elapsed
+func (s *Service) pollFeeds() {
+	for _, url := range s.dueFeeds(s.now()) {
+		s.pollFeed(url)
+	}
+}
+
+// dueFeeds returns the URLs of the feeds whose interval elapsed, and marks
+// them as polled at now
+func (s *Service) dueFeeds(now time.Time) []string {
+	s.Storage.Lock()
+	defer s.Storage.Unlock()
+	var due []string
+	for i, f := range s.Storage.Feeds {
+		if now.Sub(time.Unix(f.LastPoll, 0)) >= time.Duration(f.Interval)*time.Second {
+			s.Storage.Feeds[i].LastPoll = now.Unix()
+			due = append(due, f.Url)
+		}
+	}
+	return due
+}
+
+// pollFeed fetches the feed at url and saves the pages linked by its new
+// entries, the oldest first
+func (s *Service) pollFeed(url string) {
+	links, err := s.fetchFeed(url)
+	if err != nil {
+		log.Lvl2("Couldn't poll the feed", url, ":", err)
+		s.updateFeed(url, func(f *Feed) { f.Error = err.Error() })
+		return
+	}
+	fresh := s.newEntries(url, links)
+	if len(fresh) > maxFeedSaves {
+		fresh = fresh[len(fresh)-maxFeedSaves:]
+	}
+
+	roster := s.setupRoster()
+	watch := s.feedWatch(url)
+	for i := len(fresh) - 1; i >= 0; i-- {
+		link := fresh[i]
+		req := &decenarch.SaveRequest{Url: link, Roster: roster, Timestamp: s.now().Unix(), Feed: watch}
+		// the entries refused to the owner of the feed are not seen, the
+		// next polls save them once the owner is allowed to
+		if _, err := s.verifyClientRequest("", clientRequest(req)); err != nil {
+			log.Lvl2("Couldn't save the entries of the feed", url, ":", err)
+			s.updateFeed(url, func(f *Feed) { f.Error = err.Error() })
+			return
+		}
+		_, err := s.archivePage(req, url)
+		if _, ok := err.(*decenarch.QuotaError); ok {
+			log.Lvl2("Couldn't save the entries of the feed", url, ":", err)
+			s.updateFeed(url, func(f *Feed) { f.Error = err.Error() })
+			return
+		}
+		if err != nil {
+			log.Lvl2("Couldn't save the entry", link, "of the feed", url, ":", err)
+		}
+		// a failed entry is not saved again, the feed would otherwise
+		// retry it at every poll
+		s.updateFeed(url, func(f *Feed) {
+			f.Seen = append(f.Seen, link)
+			if len(f.Seen) > maxFeedSeen {
+				f.Seen = f.Seen[len(f.Seen)-maxFeedSeen:]
+			}
+			f.Error = ""
+			if err != nil {
+				f.Error = err.Error()
+			} else {
+				f.Saved++
+			}
+		})
+	}
+	if len(fresh) == 0 {
+		s.updateFeed(url, func(f *Feed) { f.Error = "" })
+	}
+}
+
+// feedWatch returns the signed request of the client who watches the feed at
+// url, nil if unknown
+func (s *Service) feedWatch(url string) *decenarch.WatchFeedRequest {
+	s.Storage.Lock()
+	defer s.Storage.Unlock()
+	for _, f := range s.Storage.Feeds {
+		if f.Url == url {
+			return f.Watch
+		}
+	}
+	return nil
+}
+
+// fetchFeed returns the canonical links of the entries of the feed at url,
+// the newest first as in the feed
+func (s *Service) fetchFeed(url string) ([]string, error) {
+	resp, err := s.fetcher()(url, s.checkURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, errors.New("feed answered " + resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxFeedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFeedSize {
+		return nil, &decenarch.SizeError{URL: url, Limit: maxFeedSize}
+	}
+	links, err := lib.ParseFeed(url, data)
+	if err != nil {
+		return nil, err
+	}
+	for i := range links {
+		links[i] = s.normalizeURL(links[i])
+	}
+	return links, nil
+}
+
+// newEntries returns the links not seen yet of the feed at url
+func (s *Service) newEntries(url string, links []string) []string {
+	seen := make(map[string]bool)
+	s.Storage.Lock()
+	for _, f := range s.Storage.Feeds {
+		if f.Url == url {
+			for _, l := range f.Seen {
+				seen[l] = true
+			}
+		}
+	}
+	s.Storage.Unlock()
+	var fresh []string
+	for _, l := range links {
+		if !seen[l] {
+			seen[l] = true
+			fresh = append(fresh, l)
+		}
+	}
+	return fresh
+}
+
+// updateFeed calls update on the feed at url, if it is still watched, and
+// saves the storage
+func (s *Service) updateFeed(url string, update func(f *Feed)) {
+	s.Storage.Lock()
+	found := false
+	for i := range s.Storage.Feeds {
+		if s.Storage.Feeds[i].Url == url {
+			update(&s.Storage.Feeds[i])
+			found = true
+		}
+	}
+	s.Storage.Unlock()
+	if found {
+		s.save()
+	}
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDueFeeds(t *testing.T) {
+	now := time.Now()
+	s := &Service{Storage: &Storage{Feeds: []Feed{
+		{Url: "https://example.com/new.xml", Interval: 60},
+		{Url: "https://example.com/recent.xml", Interval: 60, LastPoll: now.Add(-30 * time.Second).Unix()},
+		{Url: "https://example.com/old.xml", Interval: 60, LastPoll: now.Add(-2 * time.Minute).Unix()},
+	}}}
+	require.Equal(t, []string{"https://example.com/new.xml", "https://example.com/old.xml"}, s.dueFeeds(now))
+
+	// the polled feeds are not due again before their interval
+	require.Empty(t, s.dueFeeds(now.Add(time.Second)))
+	require.Equal(t, 3, len(s.dueFeeds(now.Add(2*time.Minute))))
+}
+
+func TestNewEntries(t *testing.T) {
+	s := &Service{Storage: &Storage{Feeds: []Feed{
+		{Url: "https://example.com/feed.xml", Seen: []string{"https://example.com/a"}},
+	}}}
+	links := []string{"https://example.com/c", "https://example.com/b", "https://example.com/a", "https://example.com/b"}
+	require.Equal(t, []string{"https://example.com/c", "https://example.com/b"}, s.newEntries("https://example.com/feed.xml", links))
+	require.Equal(t, links[:3], s.newEntries("https://example.com/other.xml", links[:3]))
+}
+
+func TestFetchFeed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/feed.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`<rss version="2.0"><channel><item><link>/a</link></item></channel></rss>`))
+	}))
+	defer server.Close()
+
+	s := &Service{
+		Storage: &Storage{},
+		config:  DefaultConfig(),
+		fetch:   protocol.LocalFetcher(server.Listener.Addr().String()),
+	}
+	links, err := s.fetchFeed("http://example.com/feed.xml")
+	require.Nil(t, err)
+	require.Equal(t, []string{"http://example.com/a"}, links)
+
+	_, err = s.fetchFeed("http://example.com/missing.xml")
+	require.NotNil(t, err)
+}
+
+func TestVerifyFeedRequest(t *testing.T) {
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	servers, _, _ := local.GenBigTree(1, 1, 1, true)
+	s := local.GetServices(servers, templateID)[0].(*Service)
+	conode := &key.Pair{Public: servers[0].ServerIdentity.Public, Private: local.GetPrivate(servers[0])}
+	owner := key.NewKeyPair(decenarch.Suite)
+	outsider := key.NewKeyPair(decenarch.Suite)
+	url := "https://example.com/feed.xml"
+	signed := func(kp *key.Pair, remove bool) *decenarch.WatchFeedRequest {
+		req := &decenarch.WatchFeedRequest{Url: url, Remove: remove, Timestamp: time.Now().Unix()}
+		sig, err := schnorr.Sign(decenarch.Suite, kp.Private, req.Message())
+		require.NoError(t, err)
+		req.PublicKey = kp.Public
+		req.Signature = sig
+		return req
+	}
+
+	// any client can watch a new feed, but must sign the request
+	require.Error(t, s.verifyFeedRequest(&decenarch.WatchFeedRequest{Url: url}, url))
+	require.NoError(t, s.verifyFeedRequest(signed(outsider, false), url))
+	req := signed(outsider, false)
+	req.Url = "https://example.com/other.xml"
+	require.Error(t, s.verifyFeedRequest(req, req.Url))
+
+	// a watched feed can only be changed by its owner or by the conode
+	s.Storage.Feeds = []Feed{{Url: url, Interval: 60, Watch: signed(owner, false)}}
+	require.Error(t, s.verifyFeedRequest(signed(outsider, true), url))
+	require.Error(t, s.verifyFeedRequest(signed(outsider, false), url))
+	require.NoError(t, s.verifyFeedRequest(signed(owner, true), url))
+	require.NoError(t, s.verifyFeedRequest(signed(conode, true), url))
+
+	// the handler refuses to remove the feed for another client
+	_, err := s.WatchFeed(signed(outsider, true))
+	require.Error(t, err)
+	resp, err := s.WatchFeed(signed(owner, true))
+	require.NoError(t, err)
+	require.Empty(t, resp.Feeds)
+}
+
+func TestFeedRestricted(t *testing.T) {
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	servers, _, _ := local.GenBigTree(1, 1, 1, true)
+	s := local.GetServices(servers, templateID)[0].(*Service)
+	owner := key.NewKeyPair(decenarch.Suite)
+	outsider := key.NewKeyPair(decenarch.Suite)
+	url := "http://example.com/feed.xml"
+	signed := func(kp *key.Pair) *decenarch.WatchFeedRequest {
+		req := &decenarch.WatchFeedRequest{Url: url, Timestamp: time.Now().Unix()}
+		sig, err := schnorr.Sign(decenarch.Suite, kp.Private, req.Message())
+		require.NoError(t, err)
+		req.PublicKey = kp.Public
+		req.Signature = sig
+		return req
+	}
+	s.Storage.AuthorizedKeys = []kyber.Point{owner.Public}
+	s.quota = newQuota(QuotaConfig{SavesPerHour: 1})
+
+	// only the authorized clients watch the feeds of a restricted archive
+	require.Error(t, s.verifyFeedRequest(signed(outsider), url))
+	require.NoError(t, s.verifyFeedRequest(signed(owner), url))
+
+	// the conodes accept the entries saved for an authorized owner, and
+	// count them against its quota
+	entry := func(watch *decenarch.WatchFeedRequest) *protocol.ClientRequest {
+		return clientRequest(&decenarch.SaveRequest{Url: "http://example.com/a", Timestamp: time.Now().Unix(), Feed: watch})
+	}
+	client, err := s.verifyClientRequest("", entry(signed(owner)))
+	require.NoError(t, err)
+	require.Equal(t, clientID(owner.Public), client)
+	_, err = s.verifyClientRequest("", entry(signed(outsider)))
+	require.Error(t, err)
+	forged := signed(outsider)
+	forged.PublicKey = owner.Public
+	_, err = s.verifyClientRequest("", entry(forged))
+	require.Error(t, err)
+	verify := s.requestVerifier("")
+	require.NoError(t, verify(entry(signed(owner))))
+	err = verify(entry(signed(owner)))
+	_, ok := err.(*decenarch.QuotaError)
+	require.True(t, ok)
+
+	// the clients cannot give the request of a feed
+	_, err = s.SaveWebpage(&decenarch.SaveRequest{Url: "http://example.com/a", Feed: signed(owner)})
+	require.Error(t, err)
+
+	// the entries of a feed without authorized owner are kept for the
+	// next polls
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<rss version="2.0"><channel><item><link>/a</link></item></channel></rss>`))
+	}))
+	defer server.Close()
+	s.fetch = protocol.LocalFetcher(server.Listener.Addr().String())
+	s.Storage.Feeds = []Feed{{Url: url, Interval: 60}}
+	s.pollFeed(url)
+	require.Empty(t, s.Storage.Feeds[0].Seen)
+	require.NotEmpty(t, s.Storage.Feeds[0].Error)
+}
@@ -0,0 +1,122 @@
+package service
+
+/*
+The journal.go defines the journal of the saves led by the conode, kept in the
+storage so that a save interrupted by a restart of the conode is not silently
+lost. Every save records a checkpoint when it starts and once its pages are
+collectively signed, and its entry is removed once the pages are stored in a
+block. On restart, the saves whose pages were signed are resumed by storing
+the pages with the next block, and the saves interrupted before are aborted.
+The outcome of the interrupted saves is reported in the status of the conode.
+*/
+
+import (
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+// Phases of the saves recorded in the journal
+const (
+	// journalConsensus is the phase of the saves whose pages are not
+	// signed yet, they cannot be resumed
+	journalConsensus = "consensus"
+	// journalSigned is the phase of the saves whose pages are signed and
+	// wait to be stored in a block
+	journalSigned = "signed"
+)
+
+// maxInterrupted is the number of interrupted saves reported in the status
+const maxInterrupted = 100
+
+// SaveCheckpoint is the entry of a running save in the journal
+//    - Entry describes the save
+//    - Roster is the roster of the save
+//    - Pages are the signed pages of the save, from the signed phase
+type SaveCheckpoint struct {
+	Entry  decenarch.JournalEntry
+	Roster *onet.Roster
+	Pages  []decenarch.Webstore
+}
+
+// journalStart records the start of a save
+func (s *Service) journalStart(requestID string, req *decenarch.SaveRequest) {
+	s.Storage.Lock()
+	s.Storage.Journal = append(s.Storage.Journal, SaveCheckpoint{
+		Entry: decenarch.JournalEntry{
+			RequestID: requestID,
+			Url:       req.Url,
+			Phase:     journalConsensus,
+			Started:   s.now().Format(decenarch.StatTimeFormat),
+		},
+		Roster: req.Roster,
+	})
+	s.Storage.Unlock()
+	s.save()
+}
+
+// journalSign records that the pages of the save are signed, so that they can
+// be stored even if the conode restarts
+func (s *Service) journalSign(requestID string, pages []decenarch.Webstore) {
+	s.Storage.Lock()
+	for i := range s.Storage.Journal {
+		if s.Storage.Journal[i].Entry.RequestID == requestID {
+			s.Storage.Journal[i].Entry.Phase = journalSigned
+			s.Storage.Journal[i].Pages = pages
+		}
+	}
+	s.Storage.Unlock()
+	s.save()
+}
+
+// journalRemove removes the saves from the journal, once they failed and the
+// client was told or once their pages are stored in a block
+func (s *Service) journalRemove(requestIDs ...string) {
+	remove := make(map[string]bool, len(requestIDs))
+	for _, id := range requestIDs {
+		remove[id] = true
+	}
+	s.Storage.Lock()
+	journal := s.Storage.Journal[:0]
+	for _, c := range s.Storage.Journal {
+		if !remove[c.Entry.RequestID] {
+			journal = append(journal, c)
+		}
+	}
+	s.Storage.Journal = journal
+	s.Storage.Unlock()
+	s.save()
+}
+
+// recoverJournal resumes or aborts the saves interrupted by the restart of
+// the conode. The signed pages are stored with the next block, possibly a
+// second time if the conode stopped right after storing them.
+func (s *Service) recoverJournal() {
+	s.Storage.Lock()
+	journal := s.Storage.Journal
+	s.Storage.Journal = nil
+	aborted := false
+	for _, c := range journal {
+		entry := c.Entry
+		if entry.Phase == journalSigned && len(c.Pages) > 0 {
+			s.logger(entry.RequestID).Lvl1("Resuming the save interrupted by the restart", "url", entry.Url)
+			entry.Outcome = "resumed, the pages are stored with the next block"
+			s.Storage.Journal = append(s.Storage.Journal, c)
+			s.batch.add(c.Roster, c.Pages, []string{entry.RequestID}, nil, flushRetry, s.flushPending)
+		} else {
+			s.logger(entry.RequestID).Lvl1("Aborting the save interrupted by the restart", "url", entry.Url, "phase", entry.Phase)
+			entry.Outcome = "aborted, the conode restarted during the " + entry.Phase
+			aborted = true
+		}
+		s.Storage.Interrupted = append(s.Storage.Interrupted, entry)
+	}
+	if len(s.Storage.Interrupted) > maxInterrupted {
+		s.Storage.Interrupted = s.Storage.Interrupted[len(s.Storage.Interrupted)-maxInterrupted:]
+	}
+	s.Storage.Unlock()
+	if aborted {
+		// the proofs of the aborted saves are useless
+		s.clearPending()
+	}
+	s.save()
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	nodes, roster, _ := local.GenBigTree(1, 1, 1, true)
+	s := local.GetServices(nodes, templateID)[0].(*Service)
+
+	// the saves are journaled until their pages are stored
+	signed := []decenarch.Webstore{{Url: "http://example.com/signed"}}
+	s.journalStart("consensus", &decenarch.SaveRequest{Roster: roster, Url: "http://example.com/consensus"})
+	s.journalStart("signed", &decenarch.SaveRequest{Roster: roster, Url: "http://example.com/signed"})
+	s.journalStart("stored", &decenarch.SaveRequest{Roster: roster, Url: "http://example.com/stored"})
+	s.journalSign("signed", signed)
+	s.journalRemove("stored")
+	require.Len(t, s.Storage.Journal, 2)
+	require.Equal(t, journalSigned, s.Storage.Journal[1].Entry.Phase)
+
+	// after a restart the signed pages are stored with the next block and
+	// the other saves are aborted
+	s.recoverJournal()
+	saves, _ := s.batch.take()
+	require.Len(t, saves, 1)
+	require.Equal(t, signed, saves[0].pages)
+	require.Equal(t, []string{"signed"}, saves[0].requests)
+	require.Len(t, s.Storage.Journal, 1)
+	require.Len(t, s.Storage.Interrupted, 2)
+	require.Equal(t, "consensus", s.Storage.Interrupted[0].RequestID)
+	require.Contains(t, s.Storage.Interrupted[0].Outcome, "aborted")
+	require.Contains(t, s.Storage.Interrupted[1].Outcome, "resumed")
+	require.Equal(t, s.Storage.Interrupted, s.localStatus().Interrupted)
+}
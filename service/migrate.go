@@ -0,0 +1,59 @@
+package service
+
+/*
+The migrate.go defines the versions of the schema of the Storage of the
+conode. The Storage is saved with the version of its schema, and tryLoad
+upgrades a Storage saved by an older conode with the migrations below before
+using it, so that a change of the stored types doesn't prevent a conode from
+starting after an upgrade. A Storage saved by a newer conode is refused
+instead of being overwritten.
+
+To change the schema, append the migration from the current version to
+migrations, which increments storageVersion.
+*/
+
+import (
+	"fmt"
+
+	"gopkg.in/dedis/onet.v2/log"
+
+	"github.com/dedis/student_18_decenar/protocol"
+)
+
+// migrations upgrade the Storage, migrations[i] from version i to version
+// i+1. The Storage saved before the versioning of the schema has version 0.
+var migrations = []func(*Storage) error{
+	migrateUnversioned,
+}
+
+// storageVersion is the version of the schema of the Storage of this conode
+var storageVersion = int32(len(migrations))
+
+// migrateStorage upgrades st to storageVersion. It returns true if st was
+// saved with an older version.
+func migrateStorage(st *Storage) (bool, error) {
+	if st.Version > storageVersion {
+		return false, fmt.Errorf("storage saved with schema version %d, this conode only knows versions up to %d", st.Version, storageVersion)
+	}
+	migrated := st.Version < storageVersion
+	for st.Version < storageVersion {
+		log.Lvl1("Migrating the storage from schema version", st.Version)
+		if err := migrations[st.Version](st); err != nil {
+			return false, fmt.Errorf("migrating the storage from schema version %d: %v", st.Version, err)
+		}
+		st.Version++
+	}
+	return migrated, nil
+}
+
+// migrateUnversioned upgrades the Storage of the conodes that predate the
+// versioning: the complete proofs are now kept by save, and a conode that was
+// already set up runs the legacy version of the protocols, see
+// protocolVersion
+func migrateUnversioned(st *Storage) error {
+	st.CompleteProofs = nil
+	if st.GenesisID != nil && st.ProtocolVersion == 0 {
+		st.ProtocolVersion = protocol.LegacyVersion
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/protocol"
+)
+
+func TestMigrateStorage(t *testing.T) {
+	// the storage of a conode set up before the versioning
+	st := &Storage{
+		GenesisID:      []byte("genesis"),
+		Threshold:      3,
+		CompleteProofs: lib.CompleteProofs{"key": &lib.CompleteProof{}},
+	}
+	migrated, err := migrateStorage(st)
+	require.Nil(t, err)
+	require.True(t, migrated)
+	require.Equal(t, storageVersion, st.Version)
+	require.Nil(t, st.CompleteProofs)
+	require.Equal(t, protocol.LegacyVersion, st.ProtocolVersion)
+	require.Equal(t, int32(3), st.Threshold)
+
+	// a conode not set up yet agrees on the version at setup
+	st = &Storage{}
+	_, err = migrateStorage(st)
+	require.Nil(t, err)
+	require.Equal(t, int32(0), st.ProtocolVersion)
+
+	// an up to date storage is left as is
+	migrated, err = migrateStorage(st)
+	require.Nil(t, err)
+	require.False(t, migrated)
+
+	// the storage of a newer conode is refused
+	st = &Storage{Version: storageVersion + 1}
+	_, err = migrateStorage(st)
+	require.NotNil(t, err)
+	require.Equal(t, storageVersion+1, st.Version)
+}
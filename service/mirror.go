@@ -0,0 +1,177 @@
+package service
+
+/*
+The mirror.go defines the Mirror API-call, used by a cothority to mirror the
+archive of another cothority. The conode reads the blocks of the other
+archive not mirrored yet, and every block becomes a mirror record: a block of
+the archive holding the skipblock of the other archive and its content. The
+roster checks the collective signatures of the other roster before signing
+the record, so that the mirrored pages can still be retrieved and verified if
+the other roster disappears.
+*/
+
+import (
+	"encoding/hex"
+	"errors"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/protocol"
+	skip "github.com/dedis/student_18_decenar/skip"
+
+	ftcosiservice "gopkg.in/dedis/cothority.v2/ftcosi/service"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/network"
+)
+
+// Mirror stores in the skipchain a mirror record of every block of the other
+// archive not mirrored yet
+func (s *Service) Mirror(req *decenarch.MirrorRequest) (*decenarch.MirrorResponse, error) {
+	requestID := lib.NewRequestID()
+	logger := s.logger(requestID)
+	if err := s.verifyMirrorRequest(req); err != nil {
+		return nil, err
+	}
+	if s.namespace(req.Namespace).GenesisID == nil {
+		return nil, decenarch.ErrNoSetup
+	}
+	// the records are signed by the roster of the namespace, see newCosi
+	s.saves.update(requestID, s.now(), func(st *saveState) {
+		st.namespace = req.Namespace
+	})
+	origin := mirroredKey(req.Namespace, req.OriginID)
+
+	client := skip.NewSkipClient(decenarch.Threshold(len(req.Origin.List)))
+	client.Tier = skip.NewRemoteTier(req.Origin)
+
+	// the genesis block pins the roster of the mirrored archive, the other
+	// rosters are reached from it by forward links, see skip.VerifyMirror
+	genesis, err := client.Genesis(req.Origin, req.OriginID)
+	if err != nil {
+		return nil, err
+	}
+	if !sameRoster(genesis.Roster, req.Origin) {
+		return nil, errors.New("the mirrored archive was not set up by the given roster")
+	}
+	chain, err := client.Chain(req.OriginID, req.Origin)
+	if err != nil {
+		return nil, err
+	}
+	tree := s.saveTree(req.Roster)
+	if tree == nil {
+		return nil, errors.New("error while creating the tree for the mirror protocol")
+	}
+
+	done := s.mirrored(origin)
+	if done > len(chain) {
+		return nil, errors.New("the mirrored archive has less blocks than already mirrored")
+	}
+	mirrored := 0
+	for _, sb := range chain[done:] {
+		block, err := client.BlockContent(sb.Roster, sb)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := network.Marshal(sb)
+		if err != nil {
+			return nil, err
+		}
+		links, err := client.Proof(req.OriginID, req.Origin, sb.Hash)
+		if err != nil {
+			return nil, err
+		}
+		record := &decenarch.Block{
+			Timestamp: s.now().Format(decenarch.StatTimeFormat),
+			Mirror:    &decenarch.Mirror{Origin: req.OriginID, SkipBlock: raw, Block: *block, Links: links},
+		}
+		if _, err := skip.VerifyMirror(record.Mirror); err != nil {
+			return nil, err
+		}
+		if record.Sig, err = s.signMirror(requestID, tree, record); err != nil {
+			return nil, err
+		}
+		record.Scheme, record.SignerKeys = s.signerKeys(requestID)
+		if err := s.storeMirror(requestID, req.Namespace, req.Roster, origin, sb.Index, record); err != nil {
+			return nil, err
+		}
+		mirrored++
+		logger.Lvl2("Block mirrored", "origin", hex.EncodeToString(req.OriginID), "index", sb.Index, "pages", len(block.Pages))
+	}
+	return &decenarch.MirrorResponse{Blocks: mirrored}, nil
+}
+
+// verifyMirrorRequest returns an error if the request is not recent or not
+// signed with the private key of the conode
+func (s *Service) verifyMirrorRequest(req *decenarch.MirrorRequest) error {
+	age := s.now().Sub(time.Unix(req.Timestamp, 0))
+	if age > decenarch.AdminMaxClockSkew || age < -decenarch.AdminMaxClockSkew {
+		return errors.New("mirror request expired")
+	}
+	err := schnorr.Verify(decenarch.Suite, s.ServerIdentity().Public, req.Message(), req.Signature)
+	if err != nil {
+		return errors.New("invalid signature of mirror request: " + err.Error())
+	}
+	if req.Origin == nil || len(req.Origin.List) == 0 || len(req.OriginID) == 0 {
+		return errors.New("no archive to mirror")
+	}
+	return nil
+}
+
+// mirroredKey returns the key of Storage.Mirrored for the archive originID
+// mirrored in the archive of the namespace ns. The key of the default archive
+// is the hexadecimal ID, as before the namespaces.
+func mirroredKey(ns string, originID []byte) string {
+	if ns == "" {
+		return hex.EncodeToString(originID)
+	}
+	return ns + "/" + hex.EncodeToString(originID)
+}
+
+// mirrored returns the number of blocks already mirrored from the archive
+func (s *Service) mirrored(origin string) int {
+	s.Storage.Lock()
+	defer s.Storage.Unlock()
+	return s.Storage.Mirrored[origin]
+}
+
+// signMirror collectively signs the payload of the mirror record
+func (s *Service) signMirror(requestID string, t *onet.Tree, record *decenarch.Block) (*ftcosiservice.SignatureResponse, error) {
+	payload, err := record.Payload()
+	if err != nil {
+		return nil, err
+	}
+	data := protocol.MirrorVerificationData{
+		RequestID: requestID,
+		ConodeKey: s.ServerIdentity().Public.String(),
+	}
+	dataMarshaled, err := network.Marshal(&data)
+	if err != nil {
+		return nil, err
+	}
+	return s.cosign(requestID, t, protocol.NameSignMirror, payload, dataMarshaled)
+}
+
+// storeMirror stores the signed mirror record of the block index of the
+// archive in the skipchain of the namespace ns
+func (s *Service) storeMirror(requestID, ns string, r *onet.Roster, origin string, index int, record *decenarch.Block) error {
+	s.batch.storing.Lock()
+	defer s.batch.storing.Unlock()
+	resp, err := s.namespaceArchive(ns).AddData(s.namespace(ns).GenesisID, r, record)
+	if err != nil {
+		return err
+	}
+	s.updateNamespace(ns, func(n *Namespace) {
+		n.LatestID = resp.Latest.Hash
+	})
+	s.Storage.Lock()
+	if s.Storage.Mirrored == nil {
+		s.Storage.Mirrored = make(map[string]int)
+	}
+	s.Storage.Mirrored[origin] = index
+	s.Storage.Unlock()
+	s.save()
+	s.notify(decenarch.Event{Type: decenarch.EventBlockCreated, RequestID: requestID, BlockID: resp.Latest.Hash})
+	return nil
+}
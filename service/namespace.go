@@ -0,0 +1,208 @@
+package service
+
+/*
+The namespace.go defines the archives hosted by the conode besides the
+default one, see decenarch.ValidNamespace. The setup of the default archive is
+kept in the fields of Storage, as before the namespaces, and the setup of
+every other namespace in Storage.Namespaces. The root of a save tells the
+other conodes the namespace of the save in the config of the protocols, with
+the request ID, see saveConfig, so that they check the request and decrypt
+with the key of the namespace.
+*/
+
+import (
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// Namespace is the setup of the archive of a namespace, with the same
+// meaning as the fields of Storage
+type Namespace struct {
+	GenesisID         skipchain.SkipBlockID
+	LatestID          skipchain.SkipBlockID
+	Threshold         int32
+	Secret            *lib.SharedSecret
+	KeyCreated        int64
+	AuthorizedKeys    []kyber.Point
+	FalsePositiveRate float64
+	Roster            *onet.Roster
+	ProtocolVersion   int32
+	Scheme            string
+	CounterWidth      int32
+	MaxHomomorphicInt int64
+	FetchHeaders      map[string]string
+	Normalizer        *lib.URLNormalizer
+}
+
+// namespace returns a copy of the setup of the namespace ns, an empty setup
+// if the namespace is not set up on the conode
+func (s *Service) namespace(ns string) Namespace {
+	s.Storage.Lock()
+	defer s.Storage.Unlock()
+	if ns != "" {
+		if n, ok := s.Storage.Namespaces[ns]; ok {
+			return *n
+		}
+		return Namespace{}
+	}
+	return s.Storage.defaultNamespace()
+}
+
+// namespaces returns the namespaces set up on the conode, the default archive
+// first
+func (s *Service) namespaces() []string {
+	s.Storage.Lock()
+	defer s.Storage.Unlock()
+	namespaces := []string{""}
+	for ns := range s.Storage.Namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces
+}
+
+// updateNamespace calls f on the setup of the namespace ns, created if
+// needed, and saves the storage
+func (s *Service) updateNamespace(ns string, f func(n *Namespace)) {
+	s.Storage.Lock()
+	if ns != "" {
+		if s.Storage.Namespaces == nil {
+			s.Storage.Namespaces = make(map[string]*Namespace)
+		}
+		n, ok := s.Storage.Namespaces[ns]
+		if !ok {
+			n = &Namespace{}
+			s.Storage.Namespaces[ns] = n
+		}
+		f(n)
+		s.Storage.Unlock()
+		s.save()
+		return
+	}
+	n := s.Storage.defaultNamespace()
+	f(&n)
+	s.Storage.setDefaultNamespace(n)
+	s.Storage.Unlock()
+	s.save()
+}
+
+// defaultNamespace returns the setup of the default archive, the caller
+// holds the lock
+func (st *Storage) defaultNamespace() Namespace {
+	return Namespace{
+		GenesisID:         st.GenesisID,
+		LatestID:          st.LatestID,
+		Threshold:         st.Threshold,
+		Secret:            st.Secret,
+		KeyCreated:        st.KeyCreated,
+		AuthorizedKeys:    st.AuthorizedKeys,
+		FalsePositiveRate: st.FalsePositiveRate,
+		Roster:            st.Roster,
+		ProtocolVersion:   st.ProtocolVersion,
+		Scheme:            st.Scheme,
+		CounterWidth:      st.CounterWidth,
+		MaxHomomorphicInt: st.MaxHomomorphicInt,
+		FetchHeaders:      st.FetchHeaders,
+		Normalizer:        st.Normalizer,
+	}
+}
+
+// setDefaultNamespace replaces the setup of the default archive by n, the
+// caller holds the lock
+func (st *Storage) setDefaultNamespace(n Namespace) {
+	st.GenesisID = n.GenesisID
+	st.LatestID = n.LatestID
+	st.Threshold = n.Threshold
+	st.Secret = n.Secret
+	st.KeyCreated = n.KeyCreated
+	st.AuthorizedKeys = n.AuthorizedKeys
+	st.FalsePositiveRate = n.FalsePositiveRate
+	st.Roster = n.Roster
+	st.ProtocolVersion = n.ProtocolVersion
+	st.Scheme = n.Scheme
+	st.CounterWidth = n.CounterWidth
+	st.MaxHomomorphicInt = n.MaxHomomorphicInt
+	st.FetchHeaders = n.FetchHeaders
+	st.Normalizer = n.Normalizer
+}
+
+// saveNamespace returns the setup of the namespace of the save requestID, the
+// default archive for the saves the conode doesn't lead
+func (s *Service) saveNamespace(requestID string) Namespace {
+	return s.namespace(s.saves.get(requestID).namespace)
+}
+
+// publics returns the public keys of the roster of the namespace given at
+// setup, or of r for the setups that predate the storage of the roster
+func (n *Namespace) publics(r *onet.Roster) []kyber.Point {
+	if n.Roster != nil {
+		return n.Roster.Publics()
+	}
+	return r.Publics()
+}
+
+// key returns the collective key of the namespace
+func (n *Namespace) key() (kyber.Point, error) {
+	if n.Secret == nil {
+		return nil, decenarch.ErrNoSetup
+	}
+	return n.Secret.X, nil
+}
+
+// scheme returns the signature scheme of the namespace
+func (n *Namespace) scheme() string {
+	if n.Scheme == "" {
+		return decenarch.SchemeCosi
+	}
+	return n.Scheme
+}
+
+// counters returns the width of the counters of the aggregated filters and
+// the bound of their decrypted values. The setups that predate them derive
+// them from their roster, or from the tree of the save if the roster is not
+// stored, see protocol.EngineContext.
+func (n *Namespace) counters() (int, int64) {
+	if n.CounterWidth > 0 && n.MaxHomomorphicInt > 0 {
+		return int(n.CounterWidth), n.MaxHomomorphicInt
+	}
+	if n.Roster == nil {
+		return 0, 0
+	}
+	width := lib.CounterWidth(len(n.Roster.List))
+	return width, lib.CounterMax(width)
+}
+
+// createProtocol creates the root instance of the protocol name of the save
+// requestID. The instances of a save of a namespace carry the namespace to
+// the other conodes, see saveConfig.
+func (s *Service) createProtocol(requestID, name string, t *onet.Tree) (onet.ProtocolInstance, error) {
+	pi, err := s.CreateProtocol(name, t)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := pi.(configurable)
+	if ns := s.saves.get(requestID).namespace; ns != "" && ok {
+		if err := c.SetConfig(saveConfig(requestID, ns)); err != nil {
+			return nil, err
+		}
+	}
+	return pi, nil
+}
+
+// configurable is a protocol instance whose config is sent to the children,
+// see onet.TreeNodeInstance
+type configurable interface {
+	SetConfig(*onet.GenericConfig) error
+}
+
+// passConfig passes conf on to the children of the conode of node, so that
+// the namespace of the save reaches the whole tree
+func passConfig(node *onet.TreeNodeInstance, conf *onet.GenericConfig) error {
+	if conf == nil {
+		return nil
+	}
+	return node.SetConfig(conf)
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespace(t *testing.T) {
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	nodes, _, _ := local.GenBigTree(1, 1, 1, true)
+	s := local.GetServices(nodes, templateID)[0].(*Service)
+
+	// the default archive is kept in the fields of the storage
+	s.updateNamespace("", func(n *Namespace) {
+		n.GenesisID = []byte("default")
+		n.Threshold = 3
+	})
+	require.Equal(t, []byte("default"), []byte(s.Storage.GenesisID))
+	require.Equal(t, int32(3), s.Storage.Threshold)
+
+	// the other namespaces are set up apart
+	require.Nil(t, s.namespace("tenant").GenesisID)
+	s.updateNamespace("tenant", func(n *Namespace) {
+		n.GenesisID = []byte("tenant")
+		n.Scheme = decenarch.SchemeBLS
+	})
+	tenant := s.namespace("tenant")
+	require.Equal(t, []byte("tenant"), []byte(tenant.GenesisID))
+	require.Equal(t, decenarch.SchemeBLS, tenant.scheme())
+	require.Equal(t, []byte("default"), []byte(s.namespace("").GenesisID))
+	require.Equal(t, decenarch.SchemeCosi, s.namespace("").scheme())
+
+	// the headers of the fetches are agreed by namespace
+	s.updateNamespace("tenant", func(n *Namespace) {
+		n.FetchHeaders = map[string]string{"Accept-Language": "fr"}
+	})
+	require.Equal(t, "fr", s.fetchHeaders("tenant", nil)["Accept-Language"])
+	require.Equal(t, decenarch.DefaultFetchHeaders, s.fetchHeaders("", nil))
+
+	// so is the normalizer of the links, whatever the configuration of the
+	// conode
+	s.updateNamespace("tenant", func(n *Namespace) {
+		n.Normalizer = lib.NewURLNormalizer([]string{"ref"})
+	})
+	require.Equal(t, []string{"ref"}, s.linkNormalizer("tenant").StripParams)
+	require.Equal(t, s.conf().URL.StripParams, s.linkNormalizer("").StripParams)
+	tenant = s.namespace("tenant")
+
+	// the namespace of a save is the one recorded by the root
+	s.saves.update("id", s.now(), func(st *saveState) {
+		st.namespace = "tenant"
+	})
+	require.Equal(t, tenant, s.saveNamespace("id"))
+	require.Equal(t, []byte("default"), []byte(s.saveNamespace("other").GenesisID))
+
+	// a save request signed for a namespace is refused by another one
+	client := key.NewKeyPair(decenarch.Suite)
+	s.updateNamespace("tenant", func(n *Namespace) {
+		n.AuthorizedKeys = []kyber.Point{client.Public}
+	})
+	s.updateNamespace("other", func(n *Namespace) {
+		n.AuthorizedKeys = []kyber.Point{client.Public}
+	})
+	req := &decenarch.SaveRequest{Url: "https://example.com", Timestamp: time.Now().Unix(), Namespace: "tenant"}
+	sig, err := schnorr.Sign(decenarch.Suite, client.Private, req.Message())
+	require.NoError(t, err)
+	req.PublicKey = client.Public
+	req.Signature = sig
+	id, err := s.verifyClientRequest("tenant", clientRequest(req))
+	require.NoError(t, err)
+	require.Equal(t, clientID(client.Public), id)
+	_, err = s.verifyClientRequest("other", clientRequest(req))
+	require.Error(t, err)
+
+	require.NoError(t, decenarch.ValidNamespace("tenant-1"))
+	require.Error(t, decenarch.ValidNamespace("Tenant"))
+	require.Error(t, decenarch.ValidNamespace("-tenant"))
+	require.Error(t, decenarch.ValidNamespace("a\nb"))
+}
+
+func TestVerifySetupRequest(t *testing.T) {
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	nodes, roster, _ := local.GenBigTree(1, 1, 1, true)
+	s := local.GetServices(nodes, templateID)[0].(*Service)
+	client := key.NewKeyPair(decenarch.Suite)
+	outsider := key.NewKeyPair(decenarch.Suite)
+	signed := func(kp *key.Pair, req *decenarch.SetupRequest) *decenarch.SetupRequest {
+		req.Roster = roster
+		req.Timestamp = time.Now().Unix()
+		sig, err := schnorr.Sign(decenarch.Suite, kp.Private, req.Message())
+		require.NoError(t, err)
+		req.PublicKey = kp.Public
+		req.Signature = sig
+		return req
+	}
+
+	// the first setup of the default archive needs no signature, nor the
+	// namespaces of a default archive without authorized clients
+	require.NoError(t, s.verifySetupRequest(&decenarch.SetupRequest{Roster: roster}))
+	require.NoError(t, s.verifySetupRequest(&decenarch.SetupRequest{Roster: roster, Namespace: "tenant"}))
+
+	// a new namespace must be signed by an authorized client of the
+	// default archive
+	s.updateNamespace("", func(n *Namespace) {
+		n.AuthorizedKeys = []kyber.Point{client.Public}
+	})
+	require.Error(t, s.verifySetupRequest(&decenarch.SetupRequest{Roster: roster, Namespace: "tenant"}))
+	require.Error(t, s.verifySetupRequest(signed(outsider, &decenarch.SetupRequest{Namespace: "tenant"})))
+	require.NoError(t, s.verifySetupRequest(signed(client, &decenarch.SetupRequest{Namespace: "tenant"})))
+	req := signed(client, &decenarch.SetupRequest{Namespace: "tenant"})
+	req.Namespace = "other"
+	require.Error(t, s.verifySetupRequest(req))
+
+	// once set up, the namespace returns its key to anyone, but only its
+	// authorized clients can force a new DKG
+	s.updateNamespace("tenant", func(n *Namespace) {
+		n.GenesisID = []byte("tenant")
+		n.Secret = &lib.SharedSecret{X: client.Public}
+		n.AuthorizedKeys = []kyber.Point{outsider.Public}
+	})
+	require.NoError(t, s.verifySetupRequest(&decenarch.SetupRequest{Roster: roster, Namespace: "tenant"}))
+	require.Error(t, s.verifySetupRequest(&decenarch.SetupRequest{Roster: roster, Namespace: "tenant", Force: true}))
+	require.Error(t, s.verifySetupRequest(signed(client, &decenarch.SetupRequest{Namespace: "tenant", Force: true})))
+	require.NoError(t, s.verifySetupRequest(signed(outsider, &decenarch.SetupRequest{Namespace: "tenant", Force: true})))
+}
@@ -0,0 +1,173 @@
+package service
+
+/*
+The notify.go defines the webhooks of the conode. The conode posts a
+decenarch.Event, as JSON, to the webhooks of its configuration and to the
+webhooks registered by the clients with the Subscribe API-call, when a save it
+leads completes or fails and when it stores a new block. The events are
+delivered once, in the background, so that a slow webhook never delays a
+save.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	urlpkg "net/url"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/protocol"
+
+	"gopkg.in/dedis/onet.v2/log"
+)
+
+// maxSubscriptions is the maximal number of webhooks registered by the
+// clients on a conode
+const maxSubscriptions = 100
+
+// Subscription is a webhook registered by a client
+//    - ID identifies the subscription to remove it
+//    - Url is the address the events are posted to
+//    - Events are the types of the events posted, all of them if empty
+type Subscription struct {
+	ID     string
+	Url    string
+	Events []string
+}
+
+// Subscribe registers the webhook of the request
+func (s *Service) Subscribe(req *decenarch.SubscribeRequest) (*decenarch.SubscribeResponse, error) {
+	log.Lvl3("Decenarch Service new SubscribeRequest:", req.Url)
+	if authorized := s.authorizedKeys(); len(authorized) > 0 {
+		if req.PublicKey == nil {
+			return nil, errors.New("subscribe request must be signed by an authorized client")
+		}
+		if err := verifySigned(authorized, "subscribe", req.PublicKey, req.Timestamp, req.Message(), req.Signature); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkSubscription(req.Url, req.Events); err != nil {
+		return nil, err
+	}
+
+	sub := Subscription{ID: lib.NewRequestID(), Url: req.Url, Events: req.Events}
+	s.Storage.Lock()
+	if len(s.Storage.Subscriptions) >= maxSubscriptions {
+		s.Storage.Unlock()
+		return nil, fmt.Errorf("the conode already has %d subscriptions", maxSubscriptions)
+	}
+	s.Storage.Subscriptions = append(s.Storage.Subscriptions, sub)
+	s.Storage.Unlock()
+	s.save()
+	return &decenarch.SubscribeResponse{ID: sub.ID}, nil
+}
+
+// Unsubscribe removes the subscription of the request
+func (s *Service) Unsubscribe(req *decenarch.UnsubscribeRequest) (*decenarch.UnsubscribeResponse, error) {
+	log.Lvl3("Decenarch Service new UnsubscribeRequest")
+	s.Storage.Lock()
+	found := false
+	kept := s.Storage.Subscriptions[:0]
+	for _, sub := range s.Storage.Subscriptions {
+		if sub.ID == req.ID {
+			found = true
+			continue
+		}
+		kept = append(kept, sub)
+	}
+	s.Storage.Subscriptions = kept
+	s.Storage.Unlock()
+	if !found {
+		return nil, errors.New("unknown subscription " + req.ID)
+	}
+	s.save()
+	return &decenarch.UnsubscribeResponse{}, nil
+}
+
+// checkSubscription returns an error if the events cannot be posted to url,
+// or if one of the events is unknown
+func checkSubscription(url string, events []string) error {
+	u, err := urlpkg.Parse(url)
+	if err != nil {
+		return err
+	}
+	if err := protocol.ValidateURL(u); err != nil {
+		return err
+	}
+	for _, e := range events {
+		switch e {
+		case decenarch.EventSaveCompleted, decenarch.EventSaveFailed, decenarch.EventBlockCreated, decenarch.EventBlockCorrupted:
+		default:
+			return errors.New("unknown event type " + e)
+		}
+	}
+	return nil
+}
+
+// wants returns true if the events of type typ are posted to a webhook
+// subscribed to events
+func wants(events []string, typ string) bool {
+	if len(events) == 0 {
+		return true
+	}
+	for _, e := range events {
+		if e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// notify posts the event to the configured webhooks and to the subscribed
+// ones, in the background
+func (s *Service) notify(e decenarch.Event) {
+	if s.conf() == nil {
+		return
+	}
+	e.Conode = s.ServerIdentity().Public.String()
+	e.Time = s.now().Format(decenarch.StatTimeFormat)
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Error("Couldn't encode the event:", err)
+		return
+	}
+
+	timeout := time.Duration(s.conf().Notify.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultNotifyTimeout
+	}
+	configured := &http.Client{Timeout: timeout}
+	for _, url := range s.conf().Notify.Webhooks {
+		go postEvent(configured, url, body)
+	}
+
+	// the webhooks of the clients cannot reach the private network of
+	// the conode
+	subscribed := &http.Client{Timeout: timeout, Transport: protocol.SafeTransport()}
+	s.Storage.Lock()
+	for _, sub := range s.Storage.Subscriptions {
+		if wants(sub.Events, e.Type) {
+			go postEvent(subscribed, sub.Url, body)
+		}
+	}
+	s.Storage.Unlock()
+}
+
+// postEvent posts the JSON encoded event to url
+func postEvent(client *http.Client, url string, body []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Lvl2("Couldn't deliver the event to", url, ":", err)
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Lvl2("Webhook", url, "refused the event:", resp.Status)
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
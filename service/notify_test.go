@@ -0,0 +1,50 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSubscription(t *testing.T) {
+	require.Nil(t, checkSubscription("https://example.com/hook", nil))
+	require.Nil(t, checkSubscription("https://example.com/hook", []string{decenarch.EventSaveFailed, decenarch.EventBlockCreated}))
+
+	// the webhooks of the clients must be public
+	require.NotNil(t, checkSubscription("http://127.0.0.1:8080/hook", nil))
+	require.NotNil(t, checkSubscription("file:///etc/passwd", nil))
+	require.NotNil(t, checkSubscription("https://example.com/hook", []string{"unknown"}))
+}
+
+func TestWants(t *testing.T) {
+	require.True(t, wants(nil, decenarch.EventSaveCompleted))
+	require.True(t, wants([]string{decenarch.EventSaveCompleted}, decenarch.EventSaveCompleted))
+	require.False(t, wants([]string{decenarch.EventSaveFailed}, decenarch.EventSaveCompleted))
+}
+
+func TestPostEvent(t *testing.T) {
+	received := make(chan decenarch.Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := decenarch.Event{}
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil || e.Type == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- e
+	}))
+	defer server.Close()
+
+	body, err := json.Marshal(decenarch.Event{Type: decenarch.EventBlockCreated, BlockID: []byte{1, 2}})
+	require.Nil(t, err)
+	require.Nil(t, postEvent(http.DefaultClient, server.URL, body))
+	e := <-received
+	require.Equal(t, decenarch.EventBlockCreated, e.Type)
+	require.Equal(t, []byte{1, 2}, e.BlockID)
+
+	// a webhook refusing the event is reported
+	require.NotNil(t, postEvent(http.DefaultClient, server.URL, []byte("{}")))
+}
@@ -0,0 +1,62 @@
+package service
+
+/*
+The policy.go defines which URLs the conode accepts to fetch. The policy
+agreed at setup is propagated to all the conodes, and each conode can add its
+own restrictions in its configuration file.
+*/
+
+import (
+	urlpkg "net/url"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/protocol"
+)
+
+// checkURL returns a PolicyError if the conode refuses to fetch u, either
+// because of the policy agreed at setup or because of its local policy
+func (s *Service) checkURL(u *urlpkg.URL) error {
+	host := u.Hostname()
+	if !s.domainPolicy().Allowed(host) {
+		return &decenarch.PolicyError{URL: u.String(), Reason: "domain refused by the cothority policy"}
+	}
+	if !s.conf().Policy.DomainPolicy().Allowed(host) {
+		return &decenarch.PolicyError{URL: u.String(), Reason: "domain refused by the conode policy"}
+	}
+	return nil
+}
+
+// checkRawURL parses rawurl and checks it with protocol.ValidateURL and
+// checkURL
+func (s *Service) checkRawURL(rawurl string) error {
+	u, err := urlpkg.Parse(rawurl)
+	if err != nil {
+		return &decenarch.PolicyError{URL: rawurl, Reason: err.Error()}
+	}
+	if err := protocol.ValidateURL(u); err != nil {
+		return &decenarch.PolicyError{URL: rawurl, Reason: err.Error()}
+	}
+	return s.checkURL(u)
+}
+
+// normalizeURL returns the canonical form of rawurl, see URLConfig, or
+// rawurl itself if it is not an absolute URL
+func (s *Service) normalizeURL(rawurl string) string {
+	normalizer := lib.NewURLNormalizer(lib.DefaultStripParams)
+	if s.conf() != nil {
+		normalizer = s.conf().URL.Normalizer()
+	}
+	normalized, err := normalizer.Normalize(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	return normalized
+}
+
+// domainPolicy returns the domain policy agreed at setup
+func (s *Service) domainPolicy() *lib.DomainPolicy {
+	s.Storage.Lock()
+	defer s.Storage.Unlock()
+	return s.Storage.DomainPolicy
+}
@@ -0,0 +1,43 @@
+package service
+
+/*
+The profile.go defines the profiling hooks of the service. If an address is
+configured, the conode serves the pprof profiles of its process on it, e.g.
+
+    go tool pprof http://127.0.0.1:6060/debug/pprof/profile
+
+to profile the CPU during a save. The profiles expose the internals of the
+conode, so the address should only be reachable locally.
+*/
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"gopkg.in/dedis/onet.v2/log"
+)
+
+// profileMux returns the handlers of the pprof profiles
+func profileMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// startProfiling serves the pprof profiles on the configured address, if
+// any. A failure of the server is logged and doesn't stop the conode.
+func startProfiling(c ProfileConfig) {
+	if c.Address == "" {
+		return
+	}
+	log.Lvl1("Serving the profiles of the conode on", c.Address)
+	go func() {
+		if err := http.ListenAndServe(c.Address, profileMux()); err != nil {
+			log.Error("Profiling server stopped:", err)
+		}
+	}()
+}
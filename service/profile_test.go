@@ -0,0 +1,24 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileMux(t *testing.T) {
+	server := httptest.NewServer(profileMux())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/debug/pprof/heap?debug=1")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
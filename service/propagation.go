@@ -0,0 +1,71 @@
+package service
+
+/*
+The propagation.go defines how the root hands the consensus data, i.e. the
+partial decryptions and the consensus Bloom filter or the Merkle commitments,
+and the list of the additional resources of the page, to the other conodes before the signature of a page. The root signs the data
+with its key, and every conode checks, before signing the page, that the data
+of the verification message is the data the root signed. A malicious root
+thus cannot make a conode verify data that differs from the data it
+propagated.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/protocol"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/onet.v2"
+)
+
+// digest returns the digest of the consensus data signed by the root
+func (c *ConsensusPropagation) digest() []byte {
+	return protocol.ConsensusDigest(c.RequestID, c.PartialsBytes, c.ConsensusSet, c.ConsensusParameters, c.Commitments, c.Url, c.AddsUrl)
+}
+
+// propagateConsensusData signs the consensus data with the private key of the
+// root of the signing protocol and propagates it to the roster
+func (s *Service) propagateConsensusData(r *onet.Roster, private kyber.Scalar, data *ConsensusPropagation) error {
+	sig, err := schnorr.Sign(decenarch.Suite, private, data.digest())
+	if err != nil {
+		return err
+	}
+	data.Signature = sig
+
+	replies, err := s.propagateConsensus(r, data, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	if replies != len(r.List) {
+		s.logger(data.RequestID).Lvl1("Got only partial replies for consensus-propagation", "replies", replies)
+	}
+	return nil
+}
+
+// checkConsensusData returns the check done by the conode before signing a
+// page: the consensus data of the verification message must be the data
+// propagated by the root, and both must be signed by root
+func (s *Service) checkConsensusData(root kyber.Point) protocol.ConsensusCheck {
+	return func(requestID string, digest, signature []byte) error {
+		propagated := s.saves.get(requestID).consensus
+		if propagated == nil {
+			return errors.New("no consensus data propagated for this save")
+		}
+		if !bytes.Equal(propagated.digest(), digest) {
+			return errors.New("consensus data differs from the propagated data")
+		}
+		if err := schnorr.Verify(decenarch.Suite, root, digest, propagated.Signature); err != nil {
+			return fmt.Errorf("invalid signature of the propagated data: %v", err)
+		}
+		if err := schnorr.Verify(decenarch.Suite, root, digest, signature); err != nil {
+			return fmt.Errorf("invalid signature of the consensus data: %v", err)
+		}
+		return nil
+	}
+}
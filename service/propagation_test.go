@@ -0,0 +1,43 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/kyber.v2/util/key"
+)
+
+func TestCheckConsensusData(t *testing.T) {
+	root := key.NewKeyPair(decenarch.Suite)
+	propagated := &ConsensusPropagation{
+		RequestID:           "request",
+		PartialsBytes:       map[int][]byte{0: []byte("a"), 2: []byte("b")},
+		ConsensusSet:        []int64{0, 3, 1},
+		ConsensusParameters: []uint64{3, 2},
+	}
+	sig, err := schnorr.Sign(decenarch.Suite, root.Private, propagated.digest())
+	require.Nil(t, err)
+	propagated.Signature = sig
+
+	s := &Service{saves: newSaveStates()}
+	s.saves.update(propagated.RequestID, time.Now(), func(st *saveState) {
+		st.consensus = propagated
+	})
+	check := s.checkConsensusData(root.Public)
+	require.Nil(t, check("request", propagated.digest(), sig))
+
+	// data differing from the propagated data is refused
+	forged := *propagated
+	forged.ConsensusSet = []int64{0, 3, 2}
+	require.NotNil(t, check("request", forged.digest(), sig))
+	require.NotNil(t, check("other", propagated.digest(), sig))
+
+	// data not signed by the root is refused
+	other := key.NewKeyPair(decenarch.Suite)
+	require.NotNil(t, s.checkConsensusData(other.Public)("request", propagated.digest(), sig))
+	s.saves.remove("request")
+	require.NotNil(t, check("request", propagated.digest(), sig))
+}
@@ -0,0 +1,214 @@
+package service
+
+/*
+The prune.go defines the storage tiers of the conode and the Prune API-call.
+When a hot tier is configured, the skipchain only keeps the content hash of
+the pages, and every conode keeps their content in its hot tier when it signs
+the block. A pruning moves the content of the old pages from the hot tier to
+the cold tier, or deletes it. It must be approved by a threshold of conodes,
+which collectively sign the prune message, and is then propagated to the
+whole roster. Only the operator of a conode asks for a pruning, by signing the
+request with the private key of the conode. Every conode checks the collective
+signature against the roster of the genesis block of the archive of the
+namespace of the request before pruning. The pruned pages are skipped by the
+retrievals, see skip.MissingContentError.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/protocol"
+	skip "github.com/dedis/student_18_decenar/skip"
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/kyber.v2/sign/cosi"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/network"
+)
+
+// PrunePropagation is the approved pruning sent to all the conodes
+//    - Before is the unix time before which the contents are pruned
+//    - Signature is the collective signature of the prune message
+//    - Namespace is the archive whose roster approved the pruning
+type PrunePropagation struct {
+	RequestID string
+	Before    int64
+	Signature []byte
+	Namespace string
+}
+
+// openTiers opens the storage tiers given in the configuration
+func (s *Service) openTiers() error {
+	if s.conf().Tier.Hot != "" {
+		hot, err := lib.NewDiskTier(s.conf().Tier.Hot)
+		if err != nil {
+			return err
+		}
+		s.hot = hot
+	}
+	if s.conf().Tier.Cold != "" {
+		cold, err := lib.NewDiskTier(s.conf().Tier.Cold)
+		if err != nil {
+			return err
+		}
+		s.cold = cold
+	}
+	if s.conf().Tier.IPFS != "" {
+		s.ipfs = lib.NewIPFS(s.conf().Tier.IPFS)
+	}
+	return nil
+}
+
+// keepPages stores the content of the pages of the block payload in the hot
+// tier and pins it on IPFS, before the conode signs the block
+func (s *Service) keepPages(payload []byte) error {
+	if s.hot == nil && s.ipfs == nil {
+		return nil
+	}
+	block := &decenarch.Block{}
+	if err := json.Unmarshal(payload, block); err != nil {
+		return err
+	}
+	_, err := skip.CompactBlock(block, s.hot, s.ipfs)
+	return err
+}
+
+// Prune asks the roster to approve the pruning of the request, signed by the
+// operator of the conode, and propagates it once approved
+func (s *Service) Prune(req *decenarch.PruneRequest) (*decenarch.PruneResponse, error) {
+	requestID := lib.NewRequestID()
+	logger := s.logger(requestID)
+	if err := s.verifyPruneRequest(req); err != nil {
+		return nil, err
+	}
+	if s.hot == nil {
+		return nil, errors.New("no storage tier configured, the pages are stored in the skipchain")
+	}
+
+	if s.namespace(req.Namespace).GenesisID == nil {
+		return nil, decenarch.ErrNoSetup
+	}
+	s.saves.update(requestID, s.now(), func(st *saveState) {
+		st.namespace = req.Namespace
+	})
+
+	tree := s.saveTree(req.Roster)
+	if tree == nil {
+		return nil, errors.New("error while creating the tree for the prune protocol")
+	}
+	data := protocol.PruneVerificationData{
+		RequestID:    requestID,
+		ConodeKey:    s.ServerIdentity().Public.String(),
+		MinRetention: s.minRetention(),
+	}
+	dataMarshaled, err := network.Marshal(&data)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := s.cosign(requestID, tree, protocol.NamePrune, req.Message(), dataMarshaled)
+	if err != nil {
+		return nil, err
+	}
+	logger.Lvl2("Pruning approved", "before", time.Unix(req.Before, 0))
+
+	replies, err := s.propagatePrune(req.Roster, &PrunePropagation{RequestID: requestID, Before: req.Before, Signature: sig.Signature, Namespace: req.Namespace}, time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	return &decenarch.PruneResponse{Conodes: replies}, nil
+}
+
+// verifyPruneRequest returns an error if the request is not recent or not
+// signed with the private key of the conode
+func (s *Service) verifyPruneRequest(req *decenarch.PruneRequest) error {
+	age := s.now().Sub(time.Unix(req.Timestamp, 0))
+	if age > decenarch.AdminMaxClockSkew || age < -decenarch.AdminMaxClockSkew {
+		return errors.New("prune request expired")
+	}
+	err := schnorr.Verify(decenarch.Suite, s.ServerIdentity().Public, req.RequestMessage(), req.Signature)
+	if err != nil {
+		return errors.New("invalid signature of prune request: " + err.Error())
+	}
+	return nil
+}
+
+// minRetention returns the minimal age in seconds of the contents the conode
+// approves to prune
+func (s *Service) minRetention() int64 {
+	return int64(s.conf().Tier.MinRetention) * 24 * 3600
+}
+
+// propagatePruneFunc prunes the hot tier of the conode, if the pruning is
+// signed by a threshold of the roster of the genesis block
+func (s *Service) propagatePruneFunc(pruneMessage network.Message) {
+	m, ok := pruneMessage.(*PrunePropagation)
+	if !ok {
+		log.Error("got something else than a prune propagation message")
+		return
+	}
+	logger := s.logger(m.RequestID)
+	if err := s.verifyPrune(m); err != nil {
+		logger.Lvl1("Invalid pruning refused", "error", err)
+		return
+	}
+	pruned, err := s.prune(time.Unix(m.Before, 0))
+	if err != nil {
+		logger.Error("Pruning failed", "error", err)
+		return
+	}
+	logger.Lvl2("Storage tier pruned", "contents", pruned)
+}
+
+// verifyPrune returns an error if the pruning is not collectively signed by a
+// threshold of the roster of the genesis block of the archive of the
+// namespace of the pruning
+func (s *Service) verifyPrune(m *PrunePropagation) error {
+	setup := s.namespace(m.Namespace)
+	if setup.GenesisID == nil {
+		return decenarch.ErrNoSetup
+	}
+	local := onet.NewRoster([]*network.ServerIdentity{s.ServerIdentity()})
+	genesis, err := skipchain.NewClient().GetSingleBlock(local, setup.GenesisID)
+	if err != nil {
+		return err
+	}
+	return cosi.Verify(
+		decenarch.CosiSuite,
+		genesis.Roster.Publics(),
+		decenarch.PruneMessage(m.Before),
+		m.Signature,
+		cosi.NewThresholdPolicy(int(setup.Threshold)))
+}
+
+// prune moves the contents stored before the given time from the hot tier to
+// the cold tier, or deletes them if there is no cold tier, and returns their
+// number
+func (s *Service) prune(before time.Time) (int, error) {
+	if s.hot == nil {
+		return 0, nil
+	}
+	hashes, err := s.hot.List(before)
+	if err != nil {
+		return 0, err
+	}
+	for i, hash := range hashes {
+		if s.cold != nil {
+			content, err := s.hot.Get(hash)
+			if err != nil {
+				return i, err
+			}
+			if err := s.cold.Put(hash, content); err != nil {
+				return i, err
+			}
+		}
+		if err := s.hot.Delete(hash); err != nil {
+			return i, err
+		}
+	}
+	return len(hashes), nil
+}
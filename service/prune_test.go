@@ -0,0 +1,85 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func TestPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tiers")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s := &Service{config: DefaultConfig()}
+	s.config.Tier.Hot = filepath.Join(dir, "hot")
+	s.config.Tier.Cold = filepath.Join(dir, "cold")
+	s.config.Tier.MinRetention = 30
+	require.Nil(t, s.openTiers())
+	require.Equal(t, int64(30*24*3600), s.minRetention())
+
+	old := []byte("old page")
+	recent := []byte("recent page")
+	require.Nil(t, s.hot.Put(lib.ContentHash(old), old))
+	require.Nil(t, s.hot.Put(lib.ContentHash(recent), recent))
+	past := time.Now().Add(-time.Hour)
+	require.Nil(t, os.Chtimes(filepath.Join(s.config.Tier.Hot, lib.ContentHash(old)), past, past))
+
+	// only the old content is moved to the cold tier
+	pruned, err := s.prune(time.Now().Add(-time.Minute))
+	require.Nil(t, err)
+	require.Equal(t, 1, pruned)
+	_, err = s.hot.Get(lib.ContentHash(old))
+	require.NotNil(t, err)
+	_, err = s.cold.Get(lib.ContentHash(old))
+	require.Nil(t, err)
+	_, err = s.hot.Get(lib.ContentHash(recent))
+	require.Nil(t, err)
+
+	// the archive still reads the pruned content
+	content, err := lib.NewMultiTier(s.hot, s.cold).Get(lib.ContentHash(old))
+	require.Nil(t, err)
+	require.Equal(t, old, content)
+}
+
+func TestPruneRequestSignature(t *testing.T) {
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(1, true)
+	s := local.GetServices(servers, templateID)[0].(*Service)
+	sign := func(private kyber.Scalar, timestamp time.Time) *decenarch.PruneRequest {
+		req := &decenarch.PruneRequest{Roster: roster, Before: time.Now().Unix(), Timestamp: timestamp.Unix()}
+		sig, err := schnorr.Sign(decenarch.Suite, private, req.RequestMessage())
+		require.Nil(t, err)
+		req.Signature = sig
+		return req
+	}
+	conode := local.GetPrivate(servers[0])
+
+	// only the operator of the conode asks for a pruning
+	_, err := s.Prune(&decenarch.PruneRequest{Roster: roster, Timestamp: time.Now().Unix()})
+	require.Contains(t, err.Error(), "invalid signature")
+	_, err = s.Prune(sign(key.NewKeyPair(decenarch.Suite).Private, time.Now()))
+	require.Contains(t, err.Error(), "invalid signature")
+	_, err = s.Prune(sign(conode, time.Now().Add(-time.Hour)))
+	require.Contains(t, err.Error(), "expired")
+
+	// the signature covers the time of the pruning
+	req := sign(conode, time.Now())
+	req.Before = 0
+	_, err = s.Prune(req)
+	require.Contains(t, err.Error(), "invalid signature")
+	_, err = s.Prune(sign(conode, time.Now()))
+	require.Contains(t, err.Error(), "no storage tier")
+}
@@ -0,0 +1,100 @@
+package service
+
+/*
+The queue.go defines the admission control of the saves led by the conode. At
+most QueueConfig.MaxConcurrent saves run at the same time, the other ones wait
+in their order of arrival in a queue of at most QueueConfig.MaxQueue saves.
+The saves arriving when the queue is full are refused with
+decenarch.ErrQueueFull, so that a burst of requests is slowed down instead of
+starting an unbounded number of protocol instances.
+*/
+
+import (
+	"sync"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+// saveQueue counts the running saves and holds the waiting ones
+type saveQueue struct {
+	sync.Mutex
+	config  QueueConfig
+	running int
+	waiting []chan struct{}
+}
+
+// newSaveQueue returns an empty queue enforcing the given limits
+func newSaveQueue(c QueueConfig) *saveQueue {
+	return &saveQueue{config: c}
+}
+
+// enter admits a new save. It returns the position of the save in the queue,
+// zero if it can run at once, and a channel closed when the save can run. It
+// returns decenarch.ErrQueueFull if the queue is full. Every admitted save
+// must call leave once it is done.
+func (q *saveQueue) enter() (int, <-chan struct{}, error) {
+	q.Lock()
+	defer q.Unlock()
+	ready := make(chan struct{})
+	if q.config.MaxConcurrent <= 0 || (q.running < q.config.MaxConcurrent && len(q.waiting) == 0) {
+		q.running++
+		close(ready)
+		return 0, ready, nil
+	}
+	if q.config.MaxQueue > 0 && len(q.waiting) >= q.config.MaxQueue {
+		return 0, nil, decenarch.ErrQueueFull
+	}
+	q.waiting = append(q.waiting, ready)
+	return len(q.waiting), ready, nil
+}
+
+// leave ends a save and hands its slot over to the first waiting save, if any
+// and if the running saves are not above the limit, which may have been
+// lowered
+func (q *saveQueue) leave() {
+	q.Lock()
+	defer q.Unlock()
+	if len(q.waiting) == 0 || (q.config.MaxConcurrent > 0 && q.running > q.config.MaxConcurrent) {
+		q.running--
+		return
+	}
+	close(q.waiting[0])
+	q.waiting = q.waiting[1:]
+}
+
+// abandon ends a save admitted by enter whose ready channel was not yet
+// received from, e.g. a canceled save. A waiting save is removed from the
+// queue, a save allowed to run leaves it.
+func (q *saveQueue) abandon(ready <-chan struct{}) {
+	q.Lock()
+	for i, w := range q.waiting {
+		if w == ready {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			q.Unlock()
+			return
+		}
+	}
+	q.Unlock()
+	q.leave()
+}
+
+// setConfig replaces the limits of the queue. The waiting saves allowed to
+// run by a higher limit are started, the running saves above a lower limit
+// end normally.
+func (q *saveQueue) setConfig(c QueueConfig) {
+	q.Lock()
+	defer q.Unlock()
+	q.config = c
+	for len(q.waiting) > 0 && (c.MaxConcurrent <= 0 || q.running < c.MaxConcurrent) {
+		q.running++
+		close(q.waiting[0])
+		q.waiting = q.waiting[1:]
+	}
+}
+
+// length returns the number of running and of waiting saves
+func (q *saveQueue) length() (int, int) {
+	q.Lock()
+	defer q.Unlock()
+	return q.running, len(q.waiting)
+}
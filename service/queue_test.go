@@ -0,0 +1,168 @@
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/stretchr/testify/require"
+
+	"gopkg.in/dedis/onet.v2"
+)
+
+func TestSaveQueue(t *testing.T) {
+	q := newSaveQueue(QueueConfig{MaxConcurrent: 1, MaxQueue: 2})
+
+	pos, first, err := q.enter()
+	require.Nil(t, err)
+	require.Equal(t, 0, pos)
+	<-first
+
+	// the next saves wait in their order of arrival
+	pos, second, err := q.enter()
+	require.Nil(t, err)
+	require.Equal(t, 1, pos)
+	pos, third, err := q.enter()
+	require.Nil(t, err)
+	require.Equal(t, 2, pos)
+	running, waiting := q.length()
+	require.Equal(t, 1, running)
+	require.Equal(t, 2, waiting)
+
+	// a full queue refuses the saves
+	_, _, err = q.enter()
+	require.Equal(t, decenarch.ErrQueueFull, err)
+
+	q.leave()
+	<-second
+	select {
+	case <-third:
+		t.Fatal("third save started before the second one ended")
+	default:
+	}
+	q.leave()
+	<-third
+	q.leave()
+	running, waiting = q.length()
+	require.Equal(t, 0, running)
+	require.Equal(t, 0, waiting)
+
+	// no limit by default
+	q = newSaveQueue(QueueConfig{})
+	for i := 0; i < 10; i++ {
+		pos, _, err = q.enter()
+		require.Nil(t, err)
+		require.Equal(t, 0, pos)
+	}
+}
+
+func TestSaveQueueSetConfig(t *testing.T) {
+	q := newSaveQueue(QueueConfig{MaxConcurrent: 1})
+	_, first, err := q.enter()
+	require.Nil(t, err)
+	<-first
+	_, second, err := q.enter()
+	require.Nil(t, err)
+	_, third, err := q.enter()
+	require.Nil(t, err)
+
+	// a higher limit starts the waiting saves
+	q.setConfig(QueueConfig{MaxConcurrent: 2})
+	<-second
+	running, waiting := q.length()
+	require.Equal(t, 2, running)
+	require.Equal(t, 1, waiting)
+
+	// a lower limit lets the running saves end before the next one starts
+	q.setConfig(QueueConfig{MaxConcurrent: 1})
+	q.leave()
+	select {
+	case <-third:
+		t.Fatal("third save started above the limit")
+	default:
+	}
+	q.leave()
+	<-third
+	running, waiting = q.length()
+	require.Equal(t, 1, running)
+	require.Equal(t, 0, waiting)
+}
+
+func TestSaveQueueAbandon(t *testing.T) {
+	q := newSaveQueue(QueueConfig{MaxConcurrent: 1})
+	_, first, err := q.enter()
+	require.Nil(t, err)
+	<-first
+	_, second, err := q.enter()
+	require.Nil(t, err)
+	_, third, err := q.enter()
+	require.Nil(t, err)
+
+	// a canceled waiting save leaves the queue without taking a slot
+	q.abandon(second)
+	running, waiting := q.length()
+	require.Equal(t, 1, running)
+	require.Equal(t, 1, waiting)
+	q.leave()
+	<-third
+
+	// a canceled save allowed to run hands its slot over
+	_, fourth, err := q.enter()
+	require.Nil(t, err)
+	q.leave()
+	q.abandon(fourth)
+	running, waiting = q.length()
+	require.Equal(t, 0, running)
+	require.Equal(t, 0, waiting)
+}
+
+func TestQueuedSaveClearPending(t *testing.T) {
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	nodes, _, _ := local.GenBigTree(1, 1, 1, true)
+	s := local.GetServices(nodes, templateID)[0].(*Service)
+	var mutex sync.Mutex
+	now := time.Now()
+	s.clock = func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	}
+	s.updateNamespace("tenant", func(n *Namespace) {
+		n.GenesisID = []byte("tenant")
+		n.Secret = &lib.SharedSecret{}
+	})
+
+	// a running save holds the only slot, the save of the namespace waits
+	s.queue = newSaveQueue(QueueConfig{MaxConcurrent: 1})
+	_, ready, err := s.queue.enter()
+	require.NoError(t, err)
+	<-ready
+	done := make(chan error)
+	go func() {
+		_, err := s.SaveWebpage(&decenarch.SaveRequest{Url: "http://example.com/page.html", Namespace: "tenant", Session: "queued"})
+		done <- err
+	}()
+	for len(s.saves.ids()) == 0 || s.saves.get(s.saves.ids()[0]).namespace == "" {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the queued save keeps its namespace once the other states are cleared
+	s.saves.update("idle", now, func(st *saveState) {})
+	mutex.Lock()
+	now = now.Add(2 * saveStateIdle)
+	mutex.Unlock()
+	require.Equal(t, 1, s.clearPending())
+	ids := s.saves.ids()
+	require.Len(t, ids, 1)
+	require.Equal(t, "tenant", s.saves.get(ids[0]).namespace)
+
+	resp, err := s.Cancel(&decenarch.CancelRequest{Session: "queued"})
+	require.NoError(t, err)
+	require.True(t, resp.Canceled)
+	require.Equal(t, decenarch.ErrSaveCanceled, <-done)
+	require.Empty(t, s.saves.ids())
+	s.queue.leave()
+}
@@ -0,0 +1,106 @@
+package service
+
+/*
+The quota.go limits the number of saves and the size of the saves a single
+client can ask, to protect the cothority from abuse. The number of saves is
+counted by every conode of the save, see requestVerifier, the size of the
+consensus page by the root. A client is identified by the key signing its
+requests, the requests without a valid signature share the anonymous quota,
+see verifyClientRequest.
+*/
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+
+	"gopkg.in/dedis/kyber.v2"
+)
+
+// anonymousClient identifies the clients that don't sign their requests
+const anonymousClient = "anonymous"
+
+// quota keeps track of the saves of every client during the last hour
+type quota struct {
+	sync.Mutex
+	config QuotaConfig
+	saves  map[string][]time.Time
+}
+
+// newQuota returns a quota enforcing the given limits
+func newQuota(c QuotaConfig) *quota {
+	return &quota{config: c, saves: make(map[string][]time.Time)}
+}
+
+// setConfig replaces the limits of the quota, the saves already counted are
+// kept
+func (q *quota) setConfig(c QuotaConfig) {
+	q.Lock()
+	defer q.Unlock()
+	q.config = c
+}
+
+// clientID returns the identifier used to account the saves of a client
+func clientID(public kyber.Point) string {
+	if public == nil {
+		return anonymousClient
+	}
+	return public.String()
+}
+
+// allowSave records a new save for client, or returns a QuotaError if the
+// client already did too many saves during the last hour
+func (q *quota) allowSave(client string, now time.Time) error {
+	q.Lock()
+	defer q.Unlock()
+	if q.config.SavesPerHour <= 0 {
+		return nil
+	}
+
+	// forget the saves older than one hour, and the clients without
+	// recent saves
+	for c, saves := range q.saves {
+		recent := saves[:0]
+		for _, t := range saves {
+			if now.Sub(t) < time.Hour {
+				recent = append(recent, t)
+			}
+		}
+		if len(recent) == 0 {
+			delete(q.saves, c)
+		} else {
+			q.saves[c] = recent
+		}
+	}
+	recent := q.saves[client]
+	if len(recent) >= q.config.SavesPerHour {
+		return &decenarch.QuotaError{
+			Client: client,
+			Reason: fmt.Sprintf("more than %d saves per hour", q.config.SavesPerHour),
+		}
+	}
+	q.saves[client] = append(recent, now)
+	return nil
+}
+
+// checkPage returns a QuotaError if the consensus page of client is too big
+// or has too many additional resources
+func (q *quota) checkPage(client string, pageSize, additionalResources int) error {
+	q.Lock()
+	defer q.Unlock()
+	if q.config.MaxPageSize > 0 && pageSize > q.config.MaxPageSize {
+		return &decenarch.QuotaError{
+			Client: client,
+			Reason: fmt.Sprintf("page size %d bytes exceeds %d bytes", pageSize, q.config.MaxPageSize),
+		}
+	}
+	if q.config.MaxAdditionalResources > 0 && additionalResources > q.config.MaxAdditionalResources {
+		return &decenarch.QuotaError{
+			Client: client,
+			Reason: fmt.Sprintf("%d additional resources exceed %d", additionalResources, q.config.MaxAdditionalResources),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/protocol"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+)
+
+func TestQuota(t *testing.T) {
+	q := newQuota(QuotaConfig{SavesPerHour: 2, MaxPageSize: 100, MaxAdditionalResources: 3})
+	now := time.Now()
+
+	// two saves per hour are allowed, the third one is rejected
+	require.Nil(t, q.allowSave("client", now))
+	require.Nil(t, q.allowSave("client", now.Add(time.Minute)))
+	err := q.allowSave("client", now.Add(2*time.Minute))
+	require.NotNil(t, err)
+	_, ok := err.(*decenarch.QuotaError)
+	require.True(t, ok)
+
+	// other clients are not affected
+	require.Nil(t, q.allowSave(anonymousClient, now))
+
+	// after one hour the client can save again
+	require.Nil(t, q.allowSave("client", now.Add(time.Hour+time.Minute)))
+
+	// size limits
+	require.Nil(t, q.checkPage("client", 100, 3))
+	require.NotNil(t, q.checkPage("client", 101, 0))
+	require.NotNil(t, q.checkPage("client", 0, 4))
+
+	// no limits
+	q = newQuota(QuotaConfig{})
+	for i := 0; i < 10; i++ {
+		require.Nil(t, q.allowSave("client", now))
+	}
+	require.Nil(t, q.checkPage("client", 1<<30, 1000))
+}
+
+func TestQuotaFollowers(t *testing.T) {
+	local := onet.NewLocalTest(decenarch.Suite)
+	defer local.CloseAll()
+	nodes, _, _ := local.GenBigTree(1, 1, 1, true)
+	s := local.GetServices(nodes, templateID)[0].(*Service)
+	s.quota = newQuota(QuotaConfig{SavesPerHour: 1})
+
+	// a conode following the root counts the saves of the client, even if
+	// the root didn't
+	verify := s.requestVerifier("")
+	kp := key.NewKeyPair(decenarch.Suite)
+	client := &protocol.ClientRequest{Url: "http://example.com", Timestamp: time.Now().Unix(), PublicKey: kp.Public}
+	sig, err := schnorr.Sign(decenarch.Suite, kp.Private, clientMessage("", client))
+	require.NoError(t, err)
+	client.Signature = sig
+	require.NoError(t, verify(client))
+	err = verify(client)
+	require.Error(t, err)
+	_, ok := err.(*decenarch.QuotaError)
+	require.True(t, ok)
+
+	// the anonymous clients share their quota, with the clients giving a
+	// key they did not sign with
+	require.NoError(t, verify(nil))
+	require.Error(t, verify(nil))
+	unsigned := &protocol.ClientRequest{Url: "http://example.com", Timestamp: time.Now().Unix(), PublicKey: key.NewKeyPair(decenarch.Suite).Public}
+	require.Error(t, verify(unsigned))
+	unsigned.Signature = sig
+	require.Error(t, verify(unsigned))
+}
+
+func TestQuotaForget(t *testing.T) {
+	q := newQuota(QuotaConfig{SavesPerHour: 1})
+	now := time.Now()
+	for _, c := range []string{"a", "b", "c"} {
+		require.Nil(t, q.allowSave(c, now))
+	}
+	require.Len(t, q.saves, 3)
+
+	// the clients without saves during the last hour are forgotten
+	require.Nil(t, q.allowSave("d", now.Add(time.Hour)))
+	require.Len(t, q.saves, 1)
+	require.NotNil(t, q.allowSave("d", now.Add(time.Hour+time.Minute)))
+	require.Len(t, q.saves, 1)
+}
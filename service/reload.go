@@ -0,0 +1,85 @@
+package service
+
+/*
+The reload.go defines how the options of the conode are changed without a
+restart, see decenarch.AdminReloadConfig. Most of the options are read at
+every save and take effect for the next saves. The storage tiers and the
+profiling are only set up at startup, a change of their options is reported
+and waits for the next restart.
+*/
+
+import (
+	"strings"
+
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/protocol"
+)
+
+// conf returns the current options of the conode
+func (s *Service) conf() *Config {
+	s.configMutex.Lock()
+	defer s.configMutex.Unlock()
+	return s.config
+}
+
+// pageRenderer returns the browser of the current options, nil if not
+// configured
+func (s *Service) pageRenderer() protocol.Renderer {
+	s.configMutex.Lock()
+	defer s.configMutex.Unlock()
+	return s.renderer
+}
+
+// applyConfig makes c the options of the conode
+func (s *Service) applyConfig(c *Config) error {
+	send, err := c.Fetch.Sender()
+	if err != nil {
+		return err
+	}
+	var fetch protocol.Fetcher
+	if send != nil {
+		fetch = protocol.GetFetcher(send)
+	}
+	renderer := c.Render.Renderer()
+	s.configMutex.Lock()
+	s.config = c
+	s.configFetch = fetch
+	s.configSend = send
+	s.renderer = renderer
+	s.configMutex.Unlock()
+	s.quota.setConfig(c.Quota)
+	s.queue.setConfig(c.Queue)
+	lib.SetWorkers(c.CPU.Workers)
+	return nil
+}
+
+// reloadConfig reads the configuration file again and applies it. The
+// options only read at startup are kept and listed in the returned message.
+func (s *Service) reloadConfig() (string, error) {
+	p := configPath()
+	c, err := loadConfig(p)
+	if err != nil {
+		return "", err
+	}
+	old := s.conf()
+	var restart []string
+	if c.Tier != old.Tier {
+		restart = append(restart, "Tier")
+		c.Tier = old.Tier
+	}
+	if c.Profile != old.Profile {
+		restart = append(restart, "Profile")
+		c.Profile = old.Profile
+	}
+	if err := s.applyConfig(c); err != nil {
+		return "", err
+	}
+	s.refillZeroPool()
+	s.scheduleVerification()
+
+	out := "configuration reloaded from " + p
+	if len(restart) > 0 {
+		out += ", restart the conode to apply " + strings.Join(restart, ", ")
+	}
+	return out, nil
+}
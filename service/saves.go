@@ -0,0 +1,190 @@
+package service
+
+/*
+The saves.go defines the material kept by the conode for each save it takes
+part in, keyed by the request ID of the save, so that concurrent saves do not
+interfere. The conodes learn the request ID from the messages of the consensus
+protocols and of the propagation of the consensus data. The sub-protocols of
+ftcosi carry no request ID in their messages, so the root gives it in their
+config, see saveConfig, and every conode passes the config on to its
+children.
+*/
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/protocol"
+)
+
+// saveStateTTL is the time after which the material of a save is dropped.
+// The root drops it at the end of the save, the other conodes are not told.
+const saveStateTTL = time.Hour
+
+// saveStateIdle is the time without update after which the save of a state is
+// not running anymore on a conode following the root, so that the
+// clear-pending admin command can drop it. The root knows when its saves run,
+// see start.
+const saveStateIdle = 10 * time.Minute
+
+// saveState is the material of the conode for a single save
+//    - localTree is the HTML tree fetched by the root
+//    - leaves are the unique leaves of the HTML tree fetched by the conode,
+//      given by the leaf extractor of the save named extractor
+//    - encryptedCBFSet is the aggregated filter received for the decryption
+//    - consensus is the consensus data propagated by the root
+//    - completeProofs are the proofs of the conode, or of all the conodes on
+//      the root
+//    - fetched are the hashes of the additional resources fetched by the
+//      conode, agreed the resources agreed on and blobs the placeholders of
+//      the inline blobs extracted by the conode, see
+//      protocol.UnstructuredVerificationData
+//    - sign are the sign options of the request, on the root
+//    - signerKeys are the BLS keys of the conodes that signed with
+//      decenarch.SchemeBLS, on the root
+//    - namespace is the namespace of the archive of the save, on the root
+//    - updated is the time of the last update of the state
+//    - running is true on the root from the start of the save, queued or
+//      not, until its end
+type saveState struct {
+	localTree       *html.Node
+	leaves          []string
+	extractor       string
+	encryptedCBFSet *lib.CipherVector
+	consensus       *ConsensusPropagation
+	completeProofs  lib.CompleteProofs
+	fetched         []string
+	agreed          []protocol.AgreedResource
+	blobs           []string
+	sign            *decenarch.SignOptions
+	signerKeys      []decenarch.SignerKey
+	namespace       string
+	created         time.Time
+	updated         time.Time
+	running         bool
+}
+
+// saveStates holds the material of the saves by request ID
+type saveStates struct {
+	sync.Mutex
+	states map[string]*saveState
+}
+
+// newSaveStates returns an empty set of save states
+func newSaveStates() *saveStates {
+	return &saveStates{states: make(map[string]*saveState)}
+}
+
+// update calls f on the state of the save, created if needed, and drops the
+// states older than saveStateTTL
+func (ss *saveStates) update(requestID string, now time.Time, f func(*saveState)) {
+	ss.Lock()
+	defer ss.Unlock()
+	for id, st := range ss.states {
+		if !st.running && now.Sub(st.created) > saveStateTTL {
+			delete(ss.states, id)
+		}
+	}
+	st, ok := ss.states[requestID]
+	if !ok {
+		st = &saveState{created: now}
+		ss.states[requestID] = st
+	}
+	st.updated = now
+	f(st)
+}
+
+// get returns a copy of the state of the save, an empty state if the conode
+// knows nothing about the save
+func (ss *saveStates) get(requestID string) saveState {
+	ss.Lock()
+	defer ss.Unlock()
+	if st, ok := ss.states[requestID]; ok {
+		return *st
+	}
+	return saveState{}
+}
+
+// start marks the save led by the conode as running until remove drops its
+// state
+func (ss *saveStates) start(requestID string, now time.Time) {
+	ss.update(requestID, now, func(st *saveState) { st.running = true })
+}
+
+// remove drops the state of the save
+func (ss *saveStates) remove(requestID string) {
+	ss.Lock()
+	defer ss.Unlock()
+	delete(ss.states, requestID)
+}
+
+// clearIdle drops the states of the saves not running and not updated since
+// saveStateIdle, and returns the number of dropped states
+func (ss *saveStates) clearIdle(now time.Time) int {
+	ss.Lock()
+	defer ss.Unlock()
+	cleared := 0
+	for id, st := range ss.states {
+		if !st.running && now.Sub(st.updated) > saveStateIdle {
+			delete(ss.states, id)
+			cleared++
+		}
+	}
+	return cleared
+}
+
+// ids returns the sorted request IDs of the saves with a state
+func (ss *saveStates) ids() []string {
+	ss.Lock()
+	defer ss.Unlock()
+	ids := make([]string, 0, len(ss.states))
+	for id := range ss.states {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// configSeparator separates the request ID from the namespace in the config
+// of the protocols
+const configSeparator = "\n"
+
+// saveConfig returns the config of the protocols of the save, carrying its
+// request ID and the namespace of its archive. The config of a save of the
+// default archive is the request ID alone.
+func saveConfig(requestID, namespace string) *onet.GenericConfig {
+	if namespace == "" {
+		return &onet.GenericConfig{Data: []byte(requestID)}
+	}
+	return &onet.GenericConfig{Data: []byte(requestID + configSeparator + namespace)}
+}
+
+// configRequestID returns the request ID of the save carried by conf, empty
+// if there is none
+func configRequestID(conf *onet.GenericConfig) string {
+	if conf == nil {
+		return ""
+	}
+	return strings.SplitN(string(conf.Data), configSeparator, 2)[0]
+}
+
+// configNamespace returns the namespace of the save carried by conf, empty
+// for the default archive
+func configNamespace(conf *onet.GenericConfig) string {
+	if conf == nil {
+		return ""
+	}
+	parts := strings.SplitN(string(conf.Data), configSeparator, 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveStates(t *testing.T) {
+	ss := newSaveStates()
+	now := time.Now()
+
+	// the states of concurrent saves are kept apart
+	ss.update("a", now, func(st *saveState) { st.leaves = []string{"a"} })
+	ss.update("b", now, func(st *saveState) { st.leaves = []string{"b"} })
+	ss.update("a", now, func(st *saveState) { st.completeProofs = nil })
+	require.Equal(t, []string{"a"}, ss.get("a").leaves)
+	require.Equal(t, []string{"b"}, ss.get("b").leaves)
+	require.Nil(t, ss.get("c").leaves)
+	require.Equal(t, []string{"a", "b"}, ss.ids())
+
+	ss.remove("a")
+	require.Equal(t, []string{"b"}, ss.ids())
+
+	// the old states are dropped
+	later := now.Add(2 * saveStateTTL)
+	ss.update("c", later, func(st *saveState) {})
+	require.Equal(t, []string{"c"}, ss.ids())
+
+	// only the idle states are cleared, the running saves keep theirs
+	ss.update("d", later.Add(saveStateIdle), func(st *saveState) {})
+	require.Equal(t, 1, ss.clearIdle(later.Add(saveStateIdle+time.Second)))
+	require.Equal(t, []string{"d"}, ss.ids())
+	require.Equal(t, 0, ss.clearIdle(later.Add(saveStateIdle+time.Second)))
+	require.Equal(t, 1, ss.clearIdle(later.Add(3*saveStateIdle)))
+	require.Empty(t, ss.ids())
+
+	// the saves led by the conode keep their state until they end
+	ss.start("e", later)
+	require.Equal(t, 0, ss.clearIdle(later.Add(3*saveStateIdle)))
+	ss.update("f", later.Add(2*saveStateTTL), func(st *saveState) {})
+	require.Equal(t, []string{"e", "f"}, ss.ids())
+	ss.remove("e")
+	require.Equal(t, []string{"f"}, ss.ids())
+
+	require.Equal(t, "id", configRequestID(saveConfig("id", "")))
+	require.Equal(t, "", configRequestID(nil))
+	require.Equal(t, "", configNamespace(saveConfig("id", "")))
+	require.Equal(t, "id", configRequestID(saveConfig("id", "tenant")))
+	require.Equal(t, "tenant", configNamespace(saveConfig("id", "tenant")))
+}
@@ -7,17 +7,18 @@ runs on the node.
 
 import (
 	"bytes"
+	"context"
 	"errors"
-	"math"
+	"fmt"
 	"sync"
 	"time"
 
 	"encoding/base64"
+	"net/http"
 	urlpkg "net/url"
 
-	"golang.org/x/net/html"
-
 	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/client/verify"
 	"github.com/dedis/student_18_decenar/lib"
 	"github.com/dedis/student_18_decenar/protocol"
 	skip "github.com/dedis/student_18_decenar/skip"
@@ -27,7 +28,7 @@ import (
 	ftcosiservice "gopkg.in/dedis/cothority.v2/ftcosi/service"
 	"gopkg.in/dedis/cothority.v2/skipchain"
 	"gopkg.in/dedis/kyber.v2"
-	"gopkg.in/dedis/kyber.v2/sign/cosi"
+	"gopkg.in/dedis/kyber.v2/util/key"
 	"gopkg.in/dedis/onet.v2"
 	"gopkg.in/dedis/onet.v2/log"
 	"gopkg.in/dedis/onet.v2/network"
@@ -43,7 +44,7 @@ func init() {
 	var err error
 	templateID, err = onet.RegisterNewService(decenarch.ServiceName, newService)
 	log.ErrFatal(err)
-	network.RegisterMessages(&Storage{}, SetupPropagation{}, ConsensusPropagation{})
+	network.RegisterMessages(&Storage{}, SetupPropagation{}, ConsensusPropagation{}, PrunePropagation{})
 }
 
 // Service is our template-service
@@ -55,14 +56,63 @@ type Service struct {
 	// used to propagate setup parameters to other conodes
 	propagateSetup     messaging.PropagationFunc
 	propagateConsensus messaging.PropagationFunc
+	propagatePrune     messaging.PropagationFunc
 
-	// material for consensus on a single wepage
-	LocalHTMLTree        *html.Node // HTML tree received by this node
-	Leaves               []string   // unique leaves of the HTML tree
-	EncryptedCBFSet      *lib.CipherVector
-	ConsensusPropagation *ConsensusPropagation
+	// material of the conode for the saves it takes part in, see saves.go
+	saves *saveStates
 
 	Storage *Storage
+
+	// decenarch options of the conode, replaced by ReloadConfig, quota of
+	// the clients and queue of the saves
+	config      *Config
+	configMutex sync.Mutex
+	quota       *quota
+	queue       *saveQueue
+	topology    *topology
+
+	// pages saved by the conode and not yet stored in the skipchain
+	batch *batch
+
+	// storage tiers of the content of the pages, nil if not configured
+	hot  lib.Tier
+	cold lib.Tier
+	ipfs *lib.IPFS
+
+	// browser rendering the pages, fetcher and sender of the
+	// configuration, nil if not configured
+	renderer    protocol.Renderer
+	configFetch protocol.Fetcher
+	configSend  protocol.Sender
+
+	// encryptions of 0 under the DKG key, see zeroPool
+	zeros      *lib.ZeroPool
+	zerosMutex sync.Mutex
+
+	// fetcher of the pages, sender of the request templates and clock of
+	// the conode, replaced by the tests, see protocol.Fetcher. A nil value
+	// means the default
+	fetch protocol.Fetcher
+	send  protocol.Sender
+	clock protocol.Clock
+
+	// faults are the misbehaviours injected by the simulations, see
+	// UseFaults
+	faults *protocol.Faults
+
+	// timer of the next poll of the watched feeds, see feed.go
+	feedTimer *time.Timer
+	feedMutex sync.Mutex
+
+	// re-verification of the stored skipblocks, see verifier.go
+	verifier verifier
+
+	// cancel functions of the saves led by the conode, see cancel.go
+	sessions *sessions
+
+	// transport key opening the next imported share, see backup.go
+	backupKey      *key.Pair
+	backupKeyMutex sync.Mutex
 }
 
 // storageID reflects the data we're storing - we could store more
@@ -71,54 +121,179 @@ var storageID = []byte("storage")
 
 type Storage struct {
 	sync.Mutex
-	GenesisID      skipchain.SkipBlockID
-	LatestID       skipchain.SkipBlockID
-	Threshold      int32
-	Secret         *lib.SharedSecret
+	GenesisID skipchain.SkipBlockID
+	LatestID  skipchain.SkipBlockID
+	Threshold int32
+	Secret    *lib.SharedSecret
+	// unused, the proofs are kept by save, see saves.go
 	CompleteProofs lib.CompleteProofs
+	LastSave       string // time of the last successful save led by the conode
+	AuthorizedKeys []kyber.Point
+	DomainPolicy   *lib.DomainPolicy
+	// target false positive rate of the Bloom filters agreed at setup
+	FalsePositiveRate float64
+	// minimal number of seconds between two blocks agreed at setup
+	BlockInterval int64
+	// index of the last block mirrored from each archive, by hexadecimal ID
+	// of its genesis block, see mirroredKey
+	Mirrored map[string]int
+	// evidence against the conodes excluded from the trees, by public key,
+	// see evidence.go
+	Excluded map[string]decenarch.Evidence
+	// roster given at setup
+	Roster *onet.Roster
+	// running saves led by the conode, and the last saves interrupted by a
+	// restart, see journal.go
+	Journal     []SaveCheckpoint
+	Interrupted []decenarch.JournalEntry
+	// webhooks registered by the clients, see notify.go
+	Subscriptions []Subscription
+	// feeds watched by the conode, see feed.go
+	Feeds []Feed
+	// version of the protocols agreed at setup, see protocolVersion
+	ProtocolVersion int32
+	// version of the schema of the storage, see migrate.go
+	Version int32
+	// unix time at which the DKG gave Secret, 0 if unknown
+	KeyCreated int64
+	// signature scheme agreed at setup, see decenarch.ValidScheme, and
+	// marshaled BLS private key of the conode, created when it first signs
+	// with decenarch.SchemeBLS
+	Scheme string
+	BLSKey []byte
+	// setup of the archives of the namespaces other than the default one,
+	// see namespace.go
+	Namespaces map[string]*Namespace
+	// headers of the fetches of the pages agreed at the setup of the
+	// default archive, see fetchHeaders
+	FetchHeaders map[string]string
+	// width of the counters of the aggregated Bloom filters and bound of
+	// their decrypted values, derived from the roster at setup, see
+	// lib.CounterWidth
+	CounterWidth      int32
+	MaxHomomorphicInt int64
+	// normalizer of the links to the additional resources of the pages
+	// agreed at the setup of the default archive, see linkNormalizer
+	Normalizer *lib.URLNormalizer
 }
 
 type SetupPropagation struct {
-	GenesisID skipchain.SkipBlockID
-	Threshold int32
+	GenesisID         skipchain.SkipBlockID
+	Threshold         int32
+	AuthorizedKeys    []kyber.Point
+	DomainPolicy      *lib.DomainPolicy
+	FalsePositiveRate float64
+	BlockInterval     int64
+	Roster            *onet.Roster
+	// version of the protocols run by the conode leading the setup, 0 for
+	// the conodes that predate the versioning
+	Version int32
+	// signature scheme of the archive
+	Scheme string
+	// namespace of the archive, empty for the default archive
+	Namespace string
+	// headers of the fetches of the pages of the archive
+	FetchHeaders map[string]string
+	// width of the counters of the aggregated filters and bound of their
+	// decrypted values
+	CounterWidth      int32
+	MaxHomomorphicInt int64
+	// normalizer of the links to the additional resources of the pages of
+	// the archive, nil from the leaders that predate its agreement
+	Normalizer *lib.URLNormalizer
 }
 
 type ConsensusPropagation struct {
+	RequestID           string
 	RootKey             string
 	PartialsBytes       map[int][]byte
 	ConsensusSet        []int64
 	ConsensusParameters []uint64
+	Commitments         []protocol.MerkleCommitment
+	// signature of the root on the digest of the data, see
+	// propagateConsensusData
+	Signature []byte
+	// URL of the page and list of its additional resources, checked by
+	// the conodes against the page, see protocol.CheckPageLinks
+	Url     string
+	AddsUrl []string
 }
 
 // Setup is the function called by the service to setup everything is needed
-// for DecenArch, in particular this function runs the DKG protocol
+// for DecenArch, in particular this function runs the DKG protocol. A conode
+// already set up returns its key instead, unless the request forces a new
+// DKG, so that the secret shares stay consistent with the skipchain.
 func (s *Service) Setup(req *decenarch.SetupRequest) (*decenarch.SetupResponse, error) {
+	if err := lib.ValidFalsePositiveRate(req.FalsePositiveRate); err != nil {
+		return nil, err
+	}
+	if req.BlockInterval < 0 {
+		return nil, errors.New("the block interval cannot be negative")
+	}
+	if err := decenarch.ValidScheme(req.Scheme); err != nil {
+		return nil, err
+	}
+	if err := decenarch.ValidNamespace(req.Namespace); err != nil {
+		return nil, err
+	}
+	if err := decenarch.ValidFetchHeaders(req.FetchHeaders); err != nil {
+		return nil, err
+	}
+	if err := s.verifySetupRequest(req); err != nil {
+		return nil, err
+	}
+	if info, err := s.GetSetupInfo(&decenarch.SetupInfoRequest{Namespace: req.Namespace}); err == nil && !req.Force {
+		if info.Roster != nil && !sameRoster(info.Roster, req.Roster) {
+			return nil, errors.New("the conode is already set up with another roster: force the setup to run the DKG again")
+		}
+		log.Lvl2("Conode already set up, returning its key")
+		return &decenarch.SetupResponse{Key: info.Key}, nil
+	}
+
 	// compute and store threshold. This threshold will be used also by the
 	// other conodes of the roster
-	s.Storage.Lock()
-	s.Storage.Threshold = int32(len(req.Roster.List) - (len(req.Roster.List)-1)/3)
-	s.Storage.Unlock()
-	s.save()
+	ns := req.Namespace
+	threshold := int32(decenarch.Threshold(len(req.Roster.List)))
+	width := lib.CounterWidth(len(req.Roster.List))
+	s.updateNamespace(ns, func(n *Namespace) {
+		n.Threshold = threshold
+		n.CounterWidth = int32(width)
+		n.MaxHomomorphicInt = lib.CounterMax(width)
+		n.AuthorizedKeys = req.AuthorizedKeys
+		n.FalsePositiveRate = req.FalsePositiveRate
+		n.Roster = req.Roster
+		n.ProtocolVersion = protocol.Version
+		n.Scheme = req.Scheme
+		n.FetchHeaders = decenarch.MergeFetchHeaders(req.FetchHeaders, nil)
+		n.Normalizer = s.conf().URL.Normalizer()
+	})
+	blockInterval := int64(0)
+	if ns == "" {
+		blockInterval = req.BlockInterval
+		s.Storage.Lock()
+		s.Storage.DomainPolicy = s.conf().Policy.DomainPolicy()
+		s.Storage.BlockInterval = blockInterval
+		s.Storage.Unlock()
+		s.save()
+	}
 
 	// start a new skipchain only if there isn't one already
-	if s.genesisID() == nil {
-		client := skip.NewSkipClient(int(s.threshold()))
-		genesis, err := client.SkipStart(req.Roster)
+	if s.namespace(ns).GenesisID == nil {
+		genesis, err := s.archive().Start(req.Roster)
 		if err != nil {
 			return nil, err
 		}
 
-		// store genesisID and latestID
-		s.Storage.Lock()
-		s.Storage.GenesisID = genesis.Hash
-		s.Storage.LatestID = genesis.Hash // latest know block is genesis at the beginning
-		s.Storage.Unlock()
-		s.save()
+		// store genesisID and latestID, latest know block is genesis at
+		// the beginning
+		s.updateNamespace(ns, func(n *Namespace) {
+			n.GenesisID = genesis.Hash
+			n.LatestID = genesis.Hash
+		})
 	}
 
 	// propagate setup
-	threshold := int32(len(req.Roster.List) - (len(req.Roster.List)-1)/3)
-	replies, err := s.propagateSetup(req.Roster, &SetupPropagation{s.genesisID(), threshold}, 10*time.Second)
+	replies, err := s.propagateSetup(req.Roster, &SetupPropagation{s.namespace(ns).GenesisID, threshold, req.AuthorizedKeys, s.domainPolicy(), req.FalsePositiveRate, blockInterval, req.Roster, protocol.Version, req.Scheme, ns, s.fetchHeaders(ns, nil), int32(width), lib.CounterMax(width), s.namespace(ns).Normalizer}, 10*time.Second)
 	if err != nil {
 		return nil, err
 	}
@@ -140,6 +315,12 @@ func (s *Service) Setup(req *decenarch.SetupRequest) (*decenarch.SetupResponse,
 	}
 	protocol := instance.(*protocol.SetupDKG)
 	protocol.Wait = true
+	protocol.Namespace = ns
+	if ns != "" {
+		if err := protocol.SetConfig(saveConfig("", ns)); err != nil {
+			return nil, err
+		}
+	}
 
 	err = protocol.Start()
 	if err != nil {
@@ -152,10 +333,7 @@ func (s *Service) Setup(req *decenarch.SetupRequest) (*decenarch.SetupResponse,
 		if err != nil {
 			return nil, err
 		}
-		s.Storage.Lock()
-		s.Storage.Secret = secret
-		s.Storage.Unlock()
-		s.save()
+		s.storeSecret(ns, secret)
 
 		return &decenarch.SetupResponse{Key: secret.X}, nil
 	case <-time.After(timeout):
@@ -163,156 +341,386 @@ func (s *Service) Setup(req *decenarch.SetupRequest) (*decenarch.SetupResponse,
 	}
 }
 
-// Save is the function called by the service when a client want to save a website in the
-// archive.
-func (s *Service) SaveWebpage(req *decenarch.SaveRequest) (*decenarch.SaveResponse, error) {
-	log.Lvl3("Decenarch Service new SaveWebpage")
+// GetSetupInfo returns the key, the genesis block, the threshold and the
+// roster of the setup of the archive of the namespace of the request
+func (s *Service) GetSetupInfo(req *decenarch.SetupInfoRequest) (*decenarch.SetupInfoResponse, error) {
+	n := s.namespace(req.Namespace)
+	if n.Secret == nil || n.GenesisID == nil {
+		return nil, decenarch.ErrNoSetup
+	}
+	return &decenarch.SetupInfoResponse{
+		Key:       n.Secret.X,
+		GenesisID: n.GenesisID,
+		Threshold: n.Threshold,
+		Roster:    n.Roster,
+		Scheme:    n.scheme(),
+	}, nil
+}
 
-	// create the tree
-	root := req.Roster.NewRosterWithRoot(s.ServerIdentity())
-	tree := root.GenerateNaryTree(len(req.Roster.List))
-	if tree == nil {
-		return nil, errors.New("error while creating the tree for the consensus protocol")
+// storeSecret stores the secret given by the DKG for the namespace ns
+func (s *Service) storeSecret(ns string, secret *lib.SharedSecret) {
+	s.updateNamespace(ns, func(n *Namespace) {
+		n.Secret = secret
+		n.KeyCreated = s.now().Unix()
+	})
+	if ns == "" {
+		s.refillZeroPool()
 	}
+}
 
-	// configure the protocol
-	instance, err := s.CreateProtocol(protocol.NameConsensusStructured, tree)
+// GetPublicKey returns the collective key of the conode for the archive of
+// the namespace of the request, when it was created and the hash of the
+// roster it was created for
+func (s *Service) GetPublicKey(req *decenarch.PublicKeyRequest) (*decenarch.PublicKeyResponse, error) {
+	setup := s.namespace(req.Namespace)
+	key, err := setup.key()
 	if err != nil {
 		return nil, err
 	}
-	structuredConsensusProtocol := instance.(*protocol.ConsensusStructuredState)
-	structuredConsensusProtocol.SharedKey, err = s.key()
+	resp := &decenarch.PublicKeyResponse{
+		Key:     key,
+		Created: setup.KeyCreated,
+	}
+	if setup.Roster != nil {
+		resp.RosterHash = decenarch.RosterHash(setup.Roster)
+	}
+	return resp, nil
+}
+
+// sameRoster returns true if both rosters list the same conodes in the same
+// order, which gives the indices of the DKG shares
+func sameRoster(a, b *onet.Roster) bool {
+	if a == nil || b == nil || len(a.List) != len(b.List) {
+		return false
+	}
+	for i := range a.List {
+		if !a.List[i].Equal(b.List[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Save is the function called by the service when a client want to save a website in the
+// archive. The save is recorded in the journal until its pages are stored in
+// a block, see journal.go.
+func (s *Service) SaveWebpage(req *decenarch.SaveRequest) (*decenarch.SaveResponse, error) {
+	// only the conode gives the request of a feed, see feed.go
+	if req.Feed != nil {
+		return nil, errors.New("the entries of the feeds are saved by the conodes watching them")
+	}
+	return s.archivePage(req, "")
+}
+
+// archivePage runs the save of the request. feed is the URL of the feed
+// listing the page for the saves of the watched feeds, see feed.go, empty
+// otherwise.
+func (s *Service) archivePage(req *decenarch.SaveRequest, feed string) (*decenarch.SaveResponse, error) {
+	// the request ID is passed to all the protocols to correlate the logs
+	// of all the conodes for this save
+	requestID := lib.NewRequestID()
+	s.saves.start(requestID, s.now())
+	defer s.saves.remove(requestID)
+	ctx, end := s.sessions.start(req.Session)
+	defer end()
+	resp, err := s.saveWebpage(ctx, requestID, req, feed)
+	if err != nil || resp.BlockID != nil {
+		s.journalRemove(requestID)
+	}
 	if err != nil {
+		s.notify(decenarch.Event{Type: decenarch.EventSaveFailed, RequestID: requestID, Url: req.Url, Error: err.Error()})
+	} else {
+		s.notify(decenarch.Event{Type: decenarch.EventSaveCompleted, RequestID: requestID, Url: resp.Url, BlockID: resp.BlockID})
+	}
+	return resp, err
+}
+
+// saveWebpage runs the save of the request, until ctx is canceled by the
+// client, see cancel.go
+func (s *Service) saveWebpage(ctx context.Context, requestID string, req *decenarch.SaveRequest, feed string) (*decenarch.SaveResponse, error) {
+	logger := s.logger(requestID)
+	logger.Lvl3("Decenarch Service new SaveWebpage", "url", req.Url)
+
+	// the pages are stored in the archive of the namespace of the request
+	ns := req.Namespace
+	if err := decenarch.ValidNamespace(ns); err != nil {
 		return nil, err
 	}
-	structuredConsensusProtocol.Url = req.Url
+	s.saves.update(requestID, s.now(), func(st *saveState) {
+		st.namespace = ns
+	})
 
-	// start the protocol
-	err = structuredConsensusProtocol.Start()
+	// only authorized clients can trigger a save
+	clientKey, err := s.verifyClientRequest(ns, clientRequest(req))
 	if err != nil {
+		logger.Lvl1("Unauthorized save request", "error", err)
 		return nil, err
 	}
-	log.Lvl4("Waiting for structuredConsensusProtocol data...")
-	var webmain decenarch.Webstore
-	var mainTimestamp string
-	select {
-	case <-structuredConsensusProtocol.Finished:
-		// only if the consensus protocol terminates succesfully it
-		// makes sense to store the webpage, otherwise an error should
-		// be returned
 
-		// get HTML tree to reconstruct the HTML page after consensus.
-		s.LocalHTMLTree = structuredConsensusProtocol.LocalTree
+	setup := s.namespace(ns)
+	if setup.GenesisID == nil || setup.Secret == nil {
+		return nil, decenarch.ErrNoSetup
+	}
 
-		// get unique leaves
-		s.Leaves = lib.ListUniqueDataLeaves(structuredConsensusProtocol.LocalTree)
+	// the page is saved under its canonical URL, the request signed by the
+	// client is kept as is
+	url := s.normalizeURL(req.Url)
 
-		// get complete proofs of the whole consensus over structured
-		// data protocol
-		s.Storage.Lock()
-		s.Storage.CompleteProofs = structuredConsensusProtocol.CompleteProofs
-		s.Storage.Unlock()
-		s.save()
+	// refuse to archive domains forbidden by the policy before doing any
+	// work
+	if err := s.checkRawURL(url); err != nil {
+		logger.Lvl1("Save request refused", "error", err)
+		return nil, err
+	}
 
-		// run decryt protocol
-		partials, err := s.decrypt(tree, structuredConsensusProtocol.EncryptedCBFSet)
-		if err != nil {
-			return nil, err
-		}
+	// the false positive rate of the request overrides the one of the setup
+	if err := lib.ValidFalsePositiveRate(req.FalsePositiveRate); err != nil {
+		return nil, err
+	}
+	fpRate := req.FalsePositiveRate
+	if fpRate == 0 {
+		fpRate = setup.FalsePositiveRate
+	}
 
-		// reconstruct html page
-		consensusCBF, msgToSign, err := s.reconstruct(len(req.Roster.List), partials, s.localHTMLTree(), structuredConsensusProtocol.ParametersCBF)
-		if err != nil {
-			return nil, err
-		}
+	if err := protocol.ValidateTemplate(req.Template, req.Render); err != nil {
+		logger.Lvl1("Request template refused", "error", err)
+		return nil, err
+	}
+	if err := req.Sign.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := lib.GetLeafExtractor(req.Extractor); err != nil {
+		return nil, err
+	}
+	if err := decenarch.ValidFetchHeaders(req.Headers); err != nil {
+		return nil, err
+	}
 
-		// propagate consensus result
-		partialsBytes := make(map[int][]byte)
-		for k, p := range partials {
-			partialsBytes[k] = lib.AbstractPointsToBytes(p)
-		}
+	// reject clients that exceeded their quota
+	if err := s.quota.allowSave(clientKey, s.now()); err != nil {
+		logger.Lvl1("Save request rejected", "error", err)
+		return nil, err
+	}
 
-		// get CBF parameters
-		paramCBF := structuredConsensusProtocol.ParametersCBF
-		parametersToMarshal := []uint64{uint64(paramCBF[0]), uint64(paramCBF[1])}
+	// wait until the conode runs few enough saves, see queue.go
+	position, ready, err := s.queue.enter()
+	if err != nil {
+		logger.Lvl1("Save request rejected", "error", err)
+		return nil, err
+	}
+	if position > 0 {
+		logger.Lvl2("Save request queued", "position", position)
+	}
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		s.queue.abandon(ready)
+		logger.Lvl2("Save canceled by the client while queued")
+		return nil, decenarch.ErrSaveCanceled
+	}
+	defer s.queue.leave()
 
-		// pass consensus set and parameters to children
-		childrenData := &ConsensusPropagation{
-			RootKey:             s.ServerIdentity().Public.String(),
-			ConsensusSet:        consensusCBF,
-			ConsensusParameters: parametersToMarshal,
-			PartialsBytes:       partialsBytes,
-		}
-		replies, err := s.propagateConsensus(req.Roster, childrenData, 10*time.Second)
-		if err != nil {
-			return nil, err
-		}
-		if replies != len(req.Roster.List) {
-			log.Lvl1("Got only", replies, "replies for setup-propagation")
-		}
+	// create the tree
+	tree := s.saveTree(req.Roster)
+	if tree == nil {
+		return nil, errors.New("error while creating the tree for the consensus protocol")
+	}
 
-		// sign the consensus website found
-		sig, sigErr := s.sign(tree, msgToSign, partials, consensusCBF, structuredConsensusProtocol.ParametersCBF, true)
-		if sigErr != nil {
-			return nil, sigErr
-		}
+	// a page identical to its last snapshot is not archived again, see
+	// unchanged.go
+	unchanged, err := s.saveUnchanged(requestID, req, tree, url)
+	if err != nil {
+		logger.Lvl2("Page archived without comparison to its last snapshot", "error", err)
+	} else if unchanged != nil {
+		unchanged.QueuePosition = position
+		return unchanged, nil
+	}
 
-		// create storing structure
-		mainTimestamp = time.Now().Format("2006/01/02 15:04")
-		webmain = decenarch.Webstore{
-			Url:         structuredConsensusProtocol.Url,
-			ContentType: structuredConsensusProtocol.ContentType,
-			Sig:         sig,
-			Page:        base64.StdEncoding.EncodeToString(msgToSign),
-			AddsUrl:     make([]string, 0),
-			Timestamp:   mainTimestamp,
-		}
-	case <-time.After(timeout):
-		return nil, errors.New("structuredConsensusProtocol timeout")
+	s.journalStart(requestID, req)
+	logger.Lvl2("Tree of the save", "topology", s.topology.lastTopology())
+
+	// run the consensus on the structured data with the consensus engine
+	engine, err := protocol.GetConsensusEngine(req.Engine)
+	if err != nil {
+		return nil, err
+	}
+	strip := s.stripSelectors(url)
+	width, maxInt := setup.counters()
+	result, err := engine.Run(&protocol.EngineContext{
+		RequestID:         requestID,
+		Tree:              tree,
+		Url:               url,
+		Threshold:         int(setup.Threshold),
+		Secret:            setup.Secret,
+		FalsePositiveRate: fpRate,
+		Logger:            logger,
+		CreateProtocol: func(name string, t *onet.Tree) (onet.ProtocolInstance, error) {
+			return s.createProtocol(requestID, name, t)
+		},
+		Configure: func(pi onet.ProtocolInstance) error {
+			return s.configureRoot(pi, req, strip)
+		},
+		Diagnostics:       req.Diagnostics,
+		CounterWidth:      width,
+		MaxHomomorphicInt: maxInt,
+		Workers:           s.conf().CPU.SaveWorkers,
+		Canceled:          ctx.Done(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range result.Evidence {
+		logger.Lvl1("Invalid contribution to the consensus", "conode", e.Accused, "protocol", e.Protocol, "reason", e.Reason)
+	}
+	for _, e := range result.Errors {
+		logger.Lvl2("Error of a conode during the consensus", "conode", e.ConodeID, "phase", e.Phase, "error", e.Message)
+	}
+	if d := result.Divergence; d != nil {
+		logger.Lvl2("Leaves dropped from the consensus page", "dropped", d.Dropped, "leaves", d.Leaves, "reasons", d.Reasons)
+	}
+	nodeErrors := result.Errors
+	s.exclude(req.Roster, result.Evidence, logger)
+
+	// keep the local data of the root for the verification of the
+	// consensus and the complete proofs of the whole consensus
+	s.saves.update(requestID, s.now(), func(st *saveState) {
+		st.sign = req.Sign
+		st.localTree = result.LocalTree
+		st.leaves = result.Leaves
+		st.extractor = req.Extractor
+		st.completeProofs = result.CompleteProofs
+		st.blobs = blobPlaceholders(result.Blobs)
+	})
+	s.refillZeroPool()
+
+	msgToSign := result.Page
+	if err := s.quota.checkPage(clientKey, len(msgToSign), 0); err != nil {
+		return nil, err
+	}
+
+	// the additional resources of the page are signed with the page, so
+	// that the conodes check the root archives all of them
+	pageUrl := s.normalizeURL(result.Url)
+	addsLinks := ExtractPageExternalLinks(pageUrl, bytes.NewBuffer(msgToSign), s.linkNormalizer(req.Namespace))
+	if err := s.quota.checkPage(clientKey, 0, len(addsLinks)); err != nil {
+		return nil, err
+	}
+
+	// consensus set and parameters for the children, propagated by the
+	// signing functions, see propagateConsensusData
+	partialsBytes := make(map[int][]byte)
+	for k, p := range result.Partials {
+		partialsBytes[k] = lib.AbstractPointsToBytes(p)
+	}
+	childrenData := &ConsensusPropagation{
+		RequestID:     requestID,
+		RootKey:       s.ServerIdentity().Public.String(),
+		ConsensusSet:  result.ConsensusSet,
+		PartialsBytes: partialsBytes,
+		Commitments:   result.Commitments,
+		Url:           pageUrl,
+		AddsUrl:       addsLinks,
+	}
+	if paramCBF := result.ParametersCBF; len(paramCBF) >= 2 {
+		childrenData.ConsensusParameters = lib.ParametersToSend(paramCBF)
 	}
 
-	log.Lvl4("Create stored request")
+	if ctx.Err() != nil {
+		logger.Lvl2("Save canceled by the client before the signature")
+		return nil, decenarch.ErrSaveCanceled
+	}
 
-	//  run consensus protocol for all additional ressources
-	//var webadds []decenarch.Webstore = make([]decenarch.Webstore, 0)
-	bytePage, err := base64.StdEncoding.DecodeString(webmain.Page)
+	// sign the consensus website found
+	var sig *ftcosiservice.SignatureResponse
+	switch result.SignProtocol {
+	case protocol.NameSignMerkle:
+		sig, err = s.signMerkle(requestID, tree, msgToSign, childrenData)
+	default:
+		sig, err = s.sign(requestID, tree, msgToSign, childrenData)
+	}
 	if err != nil {
 		return nil, err
 	}
-	addsLinks := ExtractPageExternalLinks(webmain.Url, bytes.NewBuffer(bytePage))
 
-	// iterate over additional links and retrieve the content
+	// the capture time is endorsed by the conodes, the save fails if too
+	// many conodes disagree with the clock of the root, so that no page is
+	// archived with a time only the root vouches for
+	captured := s.now()
+	timestampSig, err := s.signTimestamp(requestID, tree, lib.ContentHash(msgToSign), captured.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("capture time not endorsed by the conodes: %v", err)
+	}
+
+	// create storing structure
+	mainTimestamp := captured.Format("2006/01/02 15:04")
+	webmain := decenarch.Webstore{
+		Url:         pageUrl,
+		ContentType: result.ContentType,
+		Charset:     result.Charset,
+		Sig:         sig,
+		Page:        base64.StdEncoding.EncodeToString(msgToSign),
+		AddsUrl:     make([]string, 0),
+		Timestamp:   mainTimestamp,
+		Evidence:    result.Evidence,
+		Feed:        feed,
+		Template:    req.Template.Redact(),
+		Extractor:   req.Extractor,
+		Strip:       strip,
+		Headers:     s.fetchHeaders(req.Namespace, req.Headers),
+	}
+	webmain.QueryHash = lib.QueryHash(webmain.Url)
+	webmain.CaptureTime = captured.Unix()
+	webmain.TimestampSig = timestampSig
+	webmain.CertificateHash, webmain.CertificateChain = certificateRecord(result)
+	if webmain.CertificateHash == "" && len(result.CertificateChain) > 0 {
+		logger.Info("No consensus on the TLS certificate of the page", "url", webmain.Url)
+	}
+
+	logger.Lvl4("Create stored request")
+
+	// run consensus protocol for all additional ressources signed with
+	// the page
 	webadds := make([]decenarch.Webstore, len(addsLinks))
 	webmain.AddsUrl = make([]string, len(addsLinks))
+	webmain.AddsHash = make([]string, len(addsLinks))
 	for i, al := range addsLinks {
-		log.Lvl4("Get additional", al)
-		api, err := s.CreateProtocol(protocol.NameConsensusUnstructured, tree)
+		logger.Lvl4("Get additional", "url", al)
+		api, err := s.createProtocol(requestID, protocol.NameConsensusUnstructured, tree)
 		if err != nil {
 			// If there is an error for additional data we
 			// do not return an error, we simply inform the
 			// user and handle the next additional data
-			log.Infof("Error during unstructured consensus protocol for additional link %v: %v\n", al, err)
+			logger.Info("Error during unstructured consensus protocol for additional link", "url", al, "error", err)
 			continue
 		}
 		unstructuredConsensusProtocol := api.(*protocol.ConsensusUnstructuredState)
+		unstructuredConsensusProtocol.RequestID = requestID
+		unstructuredConsensusProtocol.Version = s.protocolVersion(ns)
+		unstructuredConsensusProtocol.CheckURL = s.checkURL
+		unstructuredConsensusProtocol.Fetch = s.fetcher()
+		unstructuredConsensusProtocol.Send = s.sender()
+		unstructuredConsensusProtocol.Headers = s.fetchHeaders(req.Namespace, req.Headers)
+		unstructuredConsensusProtocol.MaxSize = s.conf().Limits.MaxResourceSize
 		unstructuredConsensusProtocol.Url = al
-		unstructuredConsensusProtocol.Threshold = uint32(s.threshold())
+		unstructuredConsensusProtocol.Threshold = uint32(setup.Threshold)
+		s.recordResources(unstructuredConsensusProtocol)
 		err = api.Start()
 		if err != nil {
-			log.Infof("Error during unstructured consensus protocol for additional link %v: %v\n", al, err)
+			logger.Info("Error during unstructured consensus protocol for additional link", "url", al, "error", err)
 			continue
 		}
 		select {
 		case <-unstructuredConsensusProtocol.Finished:
+			nodeErrors = append(nodeErrors, unstructuredConsensusProtocol.Errs...)
 			ru := unstructuredConsensusProtocol.Url
 			ct := unstructuredConsensusProtocol.ContentType
 			mts := unstructuredConsensusProtocol.MsgToSign
 
-			// sign the consensus additional data
-			// consensus Bloom filter is not needed for additional data
-			as, err := s.sign(tree, mts, nil, nil, nil, false)
+			// sign the consensus additional data, whose hash was
+			// signed by the conodes during the consensus
+			as, err := s.signResource(requestID, tree, mts)
 			if err != nil {
-				log.Error(err)
+				logger.Error("Impossible to sign additional data", "url", ru, "error", err)
 			}
 
 			// create storing structure
@@ -323,235 +731,323 @@ func (s *Service) SaveWebpage(req *decenarch.SaveRequest) (*decenarch.SaveRespon
 				Page:        base64.StdEncoding.EncodeToString(mts),
 				AddsUrl:     make([]string, 0),
 				Timestamp:   mainTimestamp,
+				Text:        protocol.ResourceText(ct, mts),
+				Commitments: unstructuredConsensusProtocol.Transcript,
 			}
 			webadds[i] = aweb
 			webmain.AddsUrl[i] = al
+			webmain.AddsHash[i] = lib.ContentHash(mts)
 		case <-time.After(timeout):
-			log.Infof("Timeout for unstructured consensus protocol for additional link %v: %v\n", al, err)
+			logger.Info("Timeout for unstructured consensus protocol for additional link", "url", al)
+		}
+	}
+
+	// the inline blobs extracted by the root are archived as additional
+	// resources, if the conodes agreed on their placeholder. The
+	// placeholder holds the hash of the blob, so the blob is only signed
+	for _, blob := range result.Blobs {
+		if !bytes.Contains(msgToSign, []byte(blob.Placeholder)) {
+			continue
 		}
+		bs, err := s.signResource(requestID, tree, blob.Data)
+		if err != nil {
+			logger.Error("Impossible to sign inline blob", "placeholder", blob.Placeholder, "error", err)
+			continue
+		}
+		webadds = append(webadds, decenarch.Webstore{
+			Url:         blob.Placeholder,
+			ContentType: blob.ContentType,
+			Sig:         bs,
+			Page:        base64.StdEncoding.EncodeToString(blob.Data),
+			AddsUrl:     make([]string, 0),
+			Timestamp:   mainTimestamp,
+		})
+		webmain.AddsUrl = append(webmain.AddsUrl, blob.Placeholder)
+		webmain.AddsHash = append(webmain.AddsHash, lib.ContentHash(blob.Data))
+	}
+
+	// add additional data to the slice of storing structures, the
+	// additional ressources without consensus are not stored
+	pages := make([]decenarch.Webstore, 0, len(webadds)+1)
+	archived := make([]string, 0, len(webadds))
+	for _, w := range webadds {
+		if w.Sig != nil {
+			pages = append(pages, w)
+			archived = append(archived, w.Url)
+		}
+	}
+	pages = append(pages, webmain)
+	scheme, keys := s.signerKeys(requestID)
+	for i := range pages {
+		pages[i].Scheme = scheme
+		pages[i].SignerKeys = keys
+		pages[i].Mask = lib.MaskBytes(scheme, pages[i].Sig.Signature)
 	}
+	s.journalSign(requestID, pages)
 
-	// add additional data to the slice of storing structures
-	webadds = append(webadds, webmain)
-	// send data to the blockchain
-	log.Lvl4("sending", webadds, "to skipchain")
-	skipclient := skip.NewSkipClient(int(s.threshold()))
-	resp, err := skipclient.SkipAddData(s.genesisID(), req.Roster, webadds)
+	// send data to the blockchain, now or with the next block
+	blockID, err := s.storePages(requestID, req.Roster, pages, req.Sync)
 	if err != nil {
 		return nil, err
 	}
 
-	// store latest block ID for retrieval
 	s.Storage.Lock()
-	s.Storage.LatestID = resp.Latest.Hash
+	s.Storage.LastSave = s.now().Format(decenarch.StatTimeFormat)
 	s.Storage.Unlock()
 	s.save()
 
-	return &decenarch.SaveResponse{}, nil
+	resp := &decenarch.SaveResponse{
+		BlockID:   blockID,
+		Url:       webmain.Url,
+		PageHash:  lib.ContentHash(msgToSign),
+		Sig:       webmain.Sig,
+		Timestamp: webmain.Timestamp,
+		Adds:      archived,
+		Evidence:  result.Evidence,
+		Errors:    nodeErrors,
+
+		QueuePosition: position,
+		Divergence:    result.Divergence,
+	}
+	if req.IncludeProof {
+		if resp.Proof, err = network.Marshal(protocol.NewConsensusProof(result)); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
 }
 
-func (s *Service) decrypt(t *onet.Tree, encryptedCBFSet *lib.CipherVector) (map[int][]kyber.Point, error) {
-	pi, err := s.CreateProtocol(protocol.NameDecrypt, t)
+// sign runs the signing protocol on the HTML page msgToSign. The consensus
+// data is propagated to the conodes before the signature, so that they can
+// verify the page
+func (s *Service) sign(requestID string, t *onet.Tree, msgToSign []byte, consensus *ConsensusPropagation) (*ftcosiservice.SignatureResponse, error) {
+	p, err := s.newCosi(requestID, t, protocol.NameSignStructured, msgToSign)
 	if err != nil {
 		return nil, err
 	}
-	p := pi.(*protocol.Decrypt)
-	pi.(*protocol.Decrypt).EncryptedCBFSet = encryptedCBFSet
-	pi.(*protocol.Decrypt).Secret = s.secret()
-	pi.(*protocol.Decrypt).Threshold = s.threshold()
-	err = p.Start()
-	if err != nil {
+	if err := s.propagateConsensusData(t.Roster, p.private(), consensus); err != nil {
 		return nil, err
 	}
 
-	if !<-p.Finished {
-		return nil, errors.New("decrypt error, impossible to ge partials")
+	// set and marshal verification data, the complete proofs are given by
+	// their digest
+	st := s.saves.get(requestID)
+	proofsDigest, err := protocol.StoreProofs(requestID, st.completeProofs)
+	if err != nil {
+		return nil, err
 	}
-	log.Lvl3("Decryption protocol is done.")
-	return p.Partials, nil
-}
-
-func (s *Service) reconstruct(nodes int, partials map[int][]kyber.Point, localTree *html.Node, paramCBF []uint) ([]int64, []byte, error) {
-	reconstructed, err := lib.ReconstructVectorFromPartials(nodes, int(s.threshold()), partials)
+	data := protocol.VerificationData{
+		RequestID:           requestID,
+		RootKey:             s.ServerIdentity().Public.String(),
+		ConodeKey:           s.ServerIdentity().Public.String(),
+		Partials:            consensus.PartialsBytes,
+		Leaves:              st.leaves,
+		ConsensusSet:        consensus.ConsensusSet,
+		ConsensusParameters: consensus.ConsensusParameters,
+		ConsensusSignature:  consensus.Signature,
+		Url:                 consensus.Url,
+		AddsUrl:             consensus.AddsUrl,
+		ProofsDigest:        proofsDigest,
+		Extractor:           st.extractor,
+	}
+	dataMarshaled, err := network.Marshal(&data)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	return s.runCosi(requestID, p, msgToSign, dataMarshaled)
+}
 
-	// build the consensus HTML page using the reconstructed Bloom filter
-	consensusCBF := lib.BloomFilterFromSet(reconstructed, paramCBF)
-	htmlPage, err := s.buildConsensusHtmlPage(localTree, consensusCBF)
+// signResource signs an additional resource or an inline blob of the save
+func (s *Service) signResource(requestID string, t *onet.Tree, resource []byte) (*ftcosiservice.SignatureResponse, error) {
+	data := s.resourceData(requestID, s.ServerIdentity().Public.String(), s.saveNamespace(requestID).Threshold, t.Roster)
+	dataMarshaled, err := network.Marshal(data)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-
-	return reconstructed, htmlPage, nil
+	return s.cosign(requestID, t, protocol.NameSignUnstructured, resource, dataMarshaled)
 }
 
-// BuildConsensusHtmlPage takes the p.LocalTree of the root made of HTML nodes
-// and returns the consensus HTML page coming from the consensus HTML tree.
-// Only the leaves that appears in the combined Bloom filter more than
-// threshold times are included in the HTML page. All the other nodes are
-// included by the root.  The output is a valid HTML page there, it creates a
-// valid html page and outputs it.
-func (s *Service) buildConsensusHtmlPage(localTree *html.Node, CBF *lib.CBF) ([]byte, error) {
-	log.Lvl4("Begin building consensus html page")
-
-	var f func(*html.Node)
-	f = func(n *html.Node) {
-		if n.FirstChild == nil { // it is a leaf
-			if CBF.Count([]byte(n.Data)) < int64(s.threshold()) {
-				n.Parent.RemoveChild(n)
-			}
+// resourceData returns the data the conode of key conodeKey needs to verify
+// the additional resources and the inline blobs of the save signed by the
+// roster r, with the threshold of the archive of the save
+func (s *Service) resourceData(requestID, conodeKey string, threshold int32, r *onet.Roster) *protocol.UnstructuredVerificationData {
+	st := s.saves.get(requestID)
+	return &protocol.UnstructuredVerificationData{
+		RequestID: requestID,
+		ConodeKey: conodeKey,
+		Threshold: int(threshold),
+		Publics:   r.Publics(),
+		Fetched:   st.fetched,
+		Agreed:    st.agreed,
+		Blobs:     st.blobs,
+	}
+}
 
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			f(c)
-		}
+// recordResources keeps the additional resources fetched and agreed on
+// during the unstructured consensus p, for the verification of the resources
+// before signing them
+func (s *Service) recordResources(p *protocol.ConsensusUnstructuredState) {
+	p.Fetched = func(requestID, hash string) {
+		s.saves.update(requestID, s.now(), func(st *saveState) {
+			st.fetched = append(st.fetched, hash)
+		})
+	}
+	p.Agreed = func(requestID string, resource protocol.AgreedResource) {
+		s.saves.update(requestID, s.now(), func(st *saveState) {
+			st.agreed = append(st.agreed, resource)
+		})
 	}
-	f(localTree)
+}
 
-	// convert *html.Nodes tree to an html page
-	var page bytes.Buffer
-	err := html.Render(&page, localTree)
+// signMerkle signs a page agreed on with the Merkle consensus engine
+func (s *Service) signMerkle(requestID string, t *onet.Tree, msgToSign []byte, consensus *ConsensusPropagation) (*ftcosiservice.SignatureResponse, error) {
+	p, err := s.newCosi(requestID, t, protocol.NameSignMerkle, msgToSign)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.propagateConsensusData(t.Roster, p.private(), consensus); err != nil {
+		return nil, err
+	}
 
-	return page.Bytes(), nil
+	data := protocol.MerkleVerificationData{
+		RequestID:          requestID,
+		ConodeKey:          s.ServerIdentity().Public.String(),
+		Threshold:          int(s.saveNamespace(requestID).Threshold),
+		Leaves:             s.saves.get(requestID).leaves,
+		Commitments:        consensus.Commitments,
+		ConsensusSignature: consensus.Signature,
+		Url:                consensus.Url,
+		AddsUrl:            consensus.AddsUrl,
+		Extractor:          s.saves.get(requestID).extractor,
+	}
+	dataMarshaled, err := network.Marshal(&data)
+	if err != nil {
+		return nil, err
+	}
+	return s.runCosi(requestID, p, msgToSign, dataMarshaled)
 }
 
-func (s *Service) sign(t *onet.Tree, msgToSign []byte, partials map[int][]kyber.Point, reconstructedCBF []int64, paramCBF []uint, structured bool) (*ftcosiservice.SignatureResponse, error) {
-	// create the protocol depending on the data we want to sign -
-	// structured, i.e. HTML, or unstructured data
-	var pi onet.ProtocolInstance
-	var err error
-	if structured {
-		// protocol instance
-		pi, err = s.CreateProtocol(protocol.NameSignStructured, t)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		// protocol instance
-		pi, err = s.CreateProtocol(protocol.NameSignUnstructured, t)
-		if err != nil {
-			return nil, err
-		}
+// signTimestamp collectively signs the capture time of the page of content
+// hash pageHash, see protocol.NameSignTimestamp
+func (s *Service) signTimestamp(requestID string, t *onet.Tree, pageHash string, captured int64) (*ftcosiservice.SignatureResponse, error) {
+	data := protocol.TimestampVerificationData{
+		RequestID: requestID,
+		ConodeKey: s.ServerIdentity().Public.String(),
 	}
-
-	// configure the protocol
-	p := pi.(*ftcosiprotocol.FtCosi)
-	p.CreateProtocol = s.CreateProtocol
-	p.Msg = msgToSign
-	// We set NSubtrees to the cube root of n to evenly distribute the load,
-	// i.e. depth (=3) = log_f n, where f is the fan-out (branching factor).
-	p.NSubtrees = int(math.Pow(float64(t.Size()), 1.0/3.0))
-	if p.NSubtrees < 1 {
-		p.NSubtrees = 1
+	dataMarshaled, err := network.Marshal(&data)
+	if err != nil {
+		return nil, err
 	}
-	// Timeout is not a global timeout for the protocol, but a timeout used
-	// for waiting for responses for sub protocols.
-	//p.Timeout = time.Second * 5
-	p.Timeout = time.Minute * 5
-
-	// add data for verification depending on what we want to sign
-	if structured {
-		// get CBF parameters
-		parametersToMarshal := []uint64{uint64(paramCBF[0]), uint64(paramCBF[1])}
-
-		// set and marshal verification data
-		data := protocol.VerificationData{
-			RootKey:             p.Public().String(),
-			ConodeKey:           p.Public().String(),
-			Leaves:              s.uniqueLeaves(),
-			CompleteProofs:      s.completeProofs(),
-			ConsensusSet:        reconstructedCBF,
-			ConsensusParameters: parametersToMarshal,
-		}
+	return s.cosign(requestID, t, protocol.NameSignTimestamp, decenarch.TimestampMessage(pageHash, captured), dataMarshaled)
+}
 
-		dataMarshaled, err := network.Marshal(&data)
-		if err != nil {
-			return nil, err
-		}
-		p.Data = dataMarshaled
-		p.CreateProtocol = s.CreateProtocol
+// signBlock signs the payload of the block before it is stored in the
+// skipchain
+func (s *Service) signBlock(requestID string, t *onet.Tree, block *decenarch.Block) (*ftcosiservice.SignatureResponse, error) {
+	payload, err := block.Payload()
+	if err != nil {
+		return nil, err
 	}
-
-	// start the protocol
-	log.Lvl3("Cosi Service starting up root protocol")
-	if err = pi.Start(); err != nil {
+	data := protocol.BlockVerificationData{
+		RequestID: requestID,
+		ConodeKey: s.ServerIdentity().Public.String(),
+		Threshold: int(s.saveNamespace(requestID).Threshold),
+		Publics:   t.Roster.Publics(),
+	}
+	dataMarshaled, err := network.Marshal(&data)
+	if err != nil {
 		return nil, err
 	}
+	return s.cosign(requestID, t, protocol.NameSignBlock, payload, dataMarshaled)
+}
 
-	// wait for reply
-	var sig []byte
-	select {
-	case sig = <-p.FinalSignature:
-	case <-time.After(p.Timeout*5 + time.Second):
-		return nil, errors.New("signature protocol timed out")
+// cosign runs the ftcosi protocol with the given name on msgToSign. data is
+// given to the verification function of the protocol
+func (s *Service) cosign(requestID string, t *onet.Tree, name string, msgToSign []byte, data []byte) (*ftcosiservice.SignatureResponse, error) {
+	p, err := s.newCosi(requestID, t, name, msgToSign)
+	if err != nil {
+		return nil, err
 	}
-
-	//The hash is the message ftcosi actually signs, we recompute it the
-	//same way as ftcosi and then return it.
-	h := decenarch.Suite.Hash()
-	h.Write(msgToSign)
-	return &ftcosiservice.SignatureResponse{Hash: h.Sum(nil), Signature: sig}, nil
+	return s.runCosi(requestID, p, msgToSign, data)
 }
 
-// Retrieve returns the webpage retrieved from the skipchain
+// Retrieve returns the webpage retrieved from the skipchain of the namespace
+// of the request
 func (s *Service) Retrieve(req *decenarch.RetrieveRequest) (*decenarch.RetrieveResponse, error) {
 	log.Lvl3("Decenarch Service new RetrieveRequest:", req)
 	returnResp := decenarch.RetrieveResponse{}
 	returnResp.Adds = make([]decenarch.Webstore, 0)
-	skipclient := skip.NewSkipClient(int(s.threshold()))
-	resp, err := skipclient.SkipGetData(s.latestID(), req.Roster, req.Url, req.Timestamp)
+	setup := s.namespace(req.Namespace)
+	if setup.LatestID == nil {
+		return nil, decenarch.ErrNoSetup
+	}
+	archive := s.namespaceArchive(req.Namespace)
+	resp, err := archive.GetData(setup.LatestID, req.Roster, s.normalizeURL(req.Url), req.Timestamp)
 	if err != nil {
 		return nil, err
 	}
 	log.Lvl4("service-RetrieveRequest-skipchain response")
 	log.Lvl4("the response:", resp, "and the error", err)
 	returnResp.Main = resp.MainPage
-	mainPage := resp.MainPage.Page
-	bPage, bErr := base64.StdEncoding.DecodeString(mainPage)
-	if bErr != nil {
-		return nil, bErr
-	}
 	log.Lvl4("service-RetrieveRequest-verify signature")
-	vsigErr := cosi.Verify(
-		ftcosiprotocol.EdDSACompatibleCosiSuite,
-		req.Roster.Publics(),
-		bPage,
-		resp.MainPage.Sig.Signature,
-		cosi.NewThresholdPolicy(int(s.threshold())))
-	if vsigErr != nil {
-		log.Lvl1(vsigErr)
-		return nil, vsigErr
+	// the pages are verified against the roster that signed them, and not
+	// the roster of the request, which may only list the online conodes.
+	// Mirrored pages are signed by the roster of the mirrored archive.
+	signers, threshold := resp.Signers, int(setup.Threshold)
+	if len(resp.Origin) > 0 {
+		threshold = decenarch.Threshold(len(signers.List))
+	}
+	if _, err := verify.Page(signers.Publics(), threshold, resp.MainPage.Verifiable()); err != nil {
+		log.Lvl1(err)
+		return nil, err
+	}
+	indices, err := verify.Signers(signers.Publics(), resp.MainPage.Verifiable())
+	if err != nil {
+		return nil, err
 	}
+	for _, i := range indices {
+		returnResp.Signers = append(returnResp.Signers, signers.List[i].Address.String())
+	}
+	if req.IncludeChainProof {
+		proof, err := archive.Proof(setup.GenesisID, req.Roster, resp.Block)
+		if err != nil {
+			return nil, err
+		}
+		returnResp.ChainProof = proof
+	}
+	// the additional ressources are matched by url and content hash, see
+	// verify.Resource
 	for _, addUrl := range resp.MainPage.AddsUrl {
 		for _, addPage := range resp.AllPages {
 			if addUrl == addPage.Url {
-				baPage, baErr := base64.StdEncoding.DecodeString(addPage.Page)
-				if baErr == nil {
-					sErr := cosi.Verify(
-						ftcosiprotocol.EdDSACompatibleCosiSuite,
-						req.Roster.Publics(),
-						baPage,
-						addPage.Sig.Signature,
-						cosi.NewThresholdPolicy(int(s.threshold())))
-					if sErr == nil {
-						returnResp.Adds = append(returnResp.Adds, addPage)
-					} else {
-						log.Lvl1("A non-fatal error occured:", sErr)
-					}
-				} else {
-					log.Lvl1("A non-fatal error occured:", baErr)
+				if err := verify.Resource(signers.Publics(), threshold, resp.MainPage.Verifiable(), addPage.Verifiable()); err != nil {
+					log.Lvl1("A non-fatal error occured:", err)
+					continue
 				}
+				returnResp.Adds = append(returnResp.Adds, addPage)
 			}
 		}
 	}
 	return &returnResp, nil
 }
 
+// Stats returns how often the page of the url of the request changes, from
+// its observations in the archive of the namespace of the request. A client
+// or a conode saving the page regularly can wait the suggested interval
+// between two saves.
+func (s *Service) Stats(req *decenarch.StatsRequest) (*decenarch.StatsResponse, error) {
+	log.Lvl3("Decenarch Service new StatsRequest:", req.Url)
+	setup := s.namespace(req.Namespace)
+	if setup.GenesisID == nil || setup.Roster == nil {
+		return nil, decenarch.ErrNoSetup
+	}
+	stats, err := s.namespaceArchive(req.Namespace).Stats(setup.GenesisID, setup.Roster, s.normalizeURL(req.Url))
+	if err != nil {
+		return nil, err
+	}
+	return &decenarch.StatsResponse{Stats: *stats}, nil
+}
+
 // NewProtocol is called on all nodes of a Tree (except the root, since it is
 // the one starting the protocol) so it's the Service that will be called to
 // generate the PI on all others node.
@@ -568,6 +1064,7 @@ func (s *Service) NewProtocol(node *onet.TreeNodeInstance, conf *onet.GenericCon
 			return nil, err
 		}
 		proto := instance.(*protocol.SetupDKG)
+		proto.Namespace = configNamespace(conf)
 		go func() {
 			<-proto.Done
 			secret, err := lib.NewSharedSecret(proto.DKG)
@@ -575,10 +1072,7 @@ func (s *Service) NewProtocol(node *onet.TreeNodeInstance, conf *onet.GenericCon
 				log.Error(err)
 				return
 			}
-			s.Storage.Lock()
-			s.Storage.Secret = secret
-			s.Storage.Unlock()
-			s.save()
+			s.storeSecret(proto.Namespace, secret)
 		}()
 		return proto, nil
 	case protocol.NameConsensusStructured:
@@ -587,19 +1081,75 @@ func (s *Service) NewProtocol(node *onet.TreeNodeInstance, conf *onet.GenericCon
 			return nil, err
 		}
 		proto := instance.(*protocol.ConsensusStructuredState)
-		proto.SharedKey, err = s.key()
-		if err != nil {
+		ns := configNamespace(conf)
+		setup := s.namespace(ns)
+		// the root gets the key of the archive of the save in
+		// configureRoot
+		proto.SharedKey, err = setup.key()
+		if err != nil && !node.IsRoot() {
+			return nil, err
+		}
+		if ns == "" {
+			proto.ZeroPool = s.zeroPool()
+		}
+		if err := passConfig(node, conf); err != nil {
 			return nil, err
 		}
+		proto.Faults = s.faults
+		proto.VerifyRequest = s.requestVerifier(ns)
+		proto.VerifyStrip = s.verifyStrip
+		proto.CheckURL = s.checkURL
+		proto.Fetch = s.fetcher()
+		proto.Send = s.sender()
+		proto.MaxSize = s.conf().Limits.MaxResourceSize
+		proto.Renderer = s.pageRenderer()
+		proto.Workers = s.conf().CPU.SaveWorkers
 		go func() {
 			<-proto.Finished
+			s.logger(proto.RequestID).Lvl4("Structured consensus finished")
 			// get local HTML of the conode for later verification of the
 			// proposed consensus HTML page
-			s.Leaves = lib.ListUniqueDataLeaves(proto.LocalTree)
-			s.Storage.Lock()
-			s.Storage.CompleteProofs = proto.CompleteProofsToSend
-			s.Storage.Unlock()
-			s.save()
+			var leaves []string
+			extractor, err := lib.GetLeafExtractor(proto.Extractor)
+			if proto.LocalTree != nil && err == nil {
+				leaves = lib.ListLeaves(proto.LocalTree, extractor)
+			}
+			s.saves.update(proto.RequestID, s.now(), func(st *saveState) {
+				st.leaves = leaves
+				st.extractor = proto.Extractor
+				st.completeProofs = proto.CompleteProofsToSend
+				st.blobs = blobPlaceholders(proto.Blobs)
+			})
+			s.refillZeroPool()
+		}()
+		return proto, nil
+	case protocol.NameConsensusMerkle:
+		instance, err := protocol.NewConsensusMerkleProtocol(node)
+		if err != nil {
+			return nil, err
+		}
+		proto := instance.(*protocol.ConsensusMerkleState)
+		if err := passConfig(node, conf); err != nil {
+			return nil, err
+		}
+		proto.VerifyRequest = s.requestVerifier(configNamespace(conf))
+		proto.VerifyStrip = s.verifyStrip
+		setup := s.namespace(configNamespace(conf))
+		proto.Publics = setup.publics(node.Roster())
+		proto.CheckURL = s.checkURL
+		proto.Fetch = s.fetcher()
+		proto.Send = s.sender()
+		proto.MaxSize = s.conf().Limits.MaxResourceSize
+		proto.Renderer = s.pageRenderer()
+		go func() {
+			<-proto.Finished
+			// keep the leaves of the conode for the verification of
+			// the proposed consensus HTML page
+			s.saves.update(proto.RequestID, s.now(), func(st *saveState) {
+				st.leaves = proto.Leaves
+				st.extractor = proto.Extractor
+				st.blobs = blobPlaceholders(proto.Blobs)
+			})
 		}()
 		return proto, nil
 	case protocol.NameConsensusUnstructured:
@@ -608,6 +1158,14 @@ func (s *Service) NewProtocol(node *onet.TreeNodeInstance, conf *onet.GenericCon
 			return nil, err
 		}
 		proto := instance.(*protocol.ConsensusUnstructuredState)
+		if err := passConfig(node, conf); err != nil {
+			return nil, err
+		}
+		proto.CheckURL = s.checkURL
+		proto.Fetch = s.fetcher()
+		proto.Send = s.sender()
+		proto.MaxSize = s.conf().Limits.MaxResourceSize
+		s.recordResources(proto)
 		return proto, nil
 	case protocol.NameDecrypt:
 		instance, err := protocol.NewDecrypt(node)
@@ -615,31 +1173,73 @@ func (s *Service) NewProtocol(node *onet.TreeNodeInstance, conf *onet.GenericCon
 			return nil, err
 		}
 		proto := instance.(*protocol.Decrypt)
-		proto.Secret = s.secret()
-		proto.Threshold = s.threshold()
+		if err := passConfig(node, conf); err != nil {
+			return nil, err
+		}
+		setup := s.namespace(configNamespace(conf))
+		proto.Secret = setup.Secret
+		proto.Threshold = setup.Threshold
+		proto.Faults = s.faults
+		proto.Workers = s.conf().CPU.SaveWorkers
 		go func() {
 			<-proto.Received
-			s.EncryptedCBFSet = proto.EncryptedCBFSet
+			s.saves.update(proto.RequestID, s.now(), func(st *saveState) {
+				st.encryptedCBFSet = proto.EncryptedCBFSet
+			})
 		}()
 		return proto, nil
 	// for the sign protocol only the sub protocol is needed here
 	case protocol.NameSubSignStructured:
-		instance, err := protocol.NewSubSignStructuredProtocol(node)
+		instance, err := protocol.NewSubSignStructuredCheckedProtocol(node, s.faults.Check(s.checkConsensusData(node.Root().ServerIdentity.Public)), s.linkNormalizer(configNamespace(conf)))
 		if err != nil {
 			return nil, err
 		}
 		proto := instance.(*ftcosiprotocol.SubFtCosi)
-		// set verification data
-		data := protocol.VerificationData{
-			Threshold:           int(s.threshold()),
-			RootKey:             s.ConsensusPropagation.RootKey,
-			Partials:            s.ConsensusPropagation.PartialsBytes,
-			ConodeKey:           proto.Public().String(),
-			EncryptedCBFSet:     s.EncryptedCBFSet,
-			Leaves:              s.uniqueLeaves(),
-			CompleteProofs:      s.completeProofs(),
-			ConsensusSet:        s.ConsensusPropagation.ConsensusSet,
-			ConsensusParameters: s.ConsensusPropagation.ConsensusParameters,
+		st, err := s.cosiSaveState(proto, conf)
+		if err != nil {
+			return nil, err
+		}
+		// set verification data, see sign
+		if proto.Data, err = s.verificationData(protocol.NameSignStructured, st.consensus.RequestID, configNamespace(conf), proto.Public().String(), node.Roster()); err != nil {
+			return nil, err
+		}
+		return proto, nil
+	case protocol.NameSubSignMerkle:
+		instance, err := protocol.NewSubSignMerkleCheckedProtocol(node, s.faults.Check(s.checkConsensusData(node.Root().ServerIdentity.Public)), s.linkNormalizer(configNamespace(conf)))
+		if err != nil {
+			return nil, err
+		}
+		proto := instance.(*ftcosiprotocol.SubFtCosi)
+		st, err := s.cosiSaveState(proto, conf)
+		if err != nil {
+			return nil, err
+		}
+		if proto.Data, err = s.verificationData(protocol.NameSignMerkle, st.consensus.RequestID, configNamespace(conf), proto.Public().String(), node.Roster()); err != nil {
+			return nil, err
+		}
+		return proto, nil
+	case protocol.NameSubSignBlock:
+		instance, err := protocol.NewSubSignBlockCheckedProtocol(node, s.keepPages)
+		if err != nil {
+			return nil, err
+		}
+		proto := instance.(*ftcosiprotocol.SubFtCosi)
+		if err := passConfig(node, conf); err != nil {
+			return nil, err
+		}
+		if proto.Data, err = s.verificationData(protocol.NameSignBlock, configRequestID(conf), configNamespace(conf), proto.Public().String(), node.Roster()); err != nil {
+			return nil, err
+		}
+		return proto, nil
+	case protocol.NameSubPrune:
+		instance, err := protocol.NewSubPruneProtocol(node)
+		if err != nil {
+			return nil, err
+		}
+		proto := instance.(*ftcosiprotocol.SubFtCosi)
+		data := protocol.PruneVerificationData{
+			ConodeKey:    proto.Public().String(),
+			MinRetention: s.minRetention(),
 		}
 		dataMarshaled, err := network.Marshal(&data)
 		if err != nil {
@@ -647,33 +1247,276 @@ func (s *Service) NewProtocol(node *onet.TreeNodeInstance, conf *onet.GenericCon
 		}
 		proto.Data = dataMarshaled
 		return proto, nil
+	case protocol.NameSubSignMirror:
+		instance, err := protocol.NewSubSignMirrorProtocol(node)
+		if err != nil {
+			return nil, err
+		}
+		proto := instance.(*ftcosiprotocol.SubFtCosi)
+		if err := passConfig(node, conf); err != nil {
+			return nil, err
+		}
+		if proto.Data, err = s.verificationData(protocol.NameSignMirror, configRequestID(conf), configNamespace(conf), proto.Public().String(), node.Roster()); err != nil {
+			return nil, err
+		}
+		return proto, nil
+	case protocol.NameSubSignTimestamp:
+		instance, err := protocol.NewSubSignTimestampProtocol(node)
+		if err != nil {
+			return nil, err
+		}
+		proto := instance.(*ftcosiprotocol.SubFtCosi)
+		if err := passConfig(node, conf); err != nil {
+			return nil, err
+		}
+		if proto.Data, err = s.verificationData(protocol.NameSignTimestamp, configRequestID(conf), configNamespace(conf), proto.Public().String(), node.Roster()); err != nil {
+			return nil, err
+		}
+		return proto, nil
+	case protocol.NameSubSignUnchanged:
+		instance, err := protocol.NewSubSignUnchangedCheckedProtocol(node, s.unchangedCheck(configNamespace(conf), node.Roster()))
+		if err != nil {
+			return nil, err
+		}
+		proto := instance.(*ftcosiprotocol.SubFtCosi)
+		if err := passConfig(node, conf); err != nil {
+			return nil, err
+		}
+		if proto.Data, err = s.verificationData(protocol.NameSignUnchanged, configRequestID(conf), configNamespace(conf), proto.Public().String(), node.Roster()); err != nil {
+			return nil, err
+		}
+		return proto, nil
 	case protocol.NameSubSignUnstructured:
-		proto, err := protocol.NewSubSignUnstructuredProtocol(node)
+		instance, err := protocol.NewSubSignUnstructuredProtocol(node)
 		if err != nil {
 			return nil, err
 		}
+		proto := instance.(*ftcosiprotocol.SubFtCosi)
+		if err := passConfig(node, conf); err != nil {
+			return nil, err
+		}
+		if proto.Data, err = s.verificationData(protocol.NameSignUnstructured, configRequestID(conf), configNamespace(conf), proto.Public().String(), node.Roster()); err != nil {
+			return nil, err
+		}
 		return proto, nil
+	case protocol.NameSignBLS:
+		return s.newSignBLS(node, conf)
 	}
 	return nil, nil
 }
 
-// completeProofs returns complete proofs stored by the conode
-func (s *Service) completeProofs() lib.CompleteProofs {
-	s.Storage.Lock()
-	defer s.Storage.Unlock()
-	return s.Storage.CompleteProofs
+// configureRoot sets the options of the service on the root instance of the
+// protocols run by the consensus engines
+func (s *Service) configureRoot(pi onet.ProtocolInstance, req *decenarch.SaveRequest, strip []string) error {
+	setup := s.namespace(req.Namespace)
+	switch p := pi.(type) {
+	case *protocol.ConsensusStructuredState:
+		key, err := setup.key()
+		if err != nil {
+			return err
+		}
+		p.Version = s.protocolVersion(req.Namespace)
+		p.SharedKey = key
+		// the pool holds encryptions under the key of the default archive
+		if req.Namespace == "" {
+			p.ZeroPool = s.zeroPool()
+		}
+		p.Faults = s.faults
+		p.ClientRequest = clientRequest(req)
+		p.CheckURL = s.checkURL
+		p.Fetch = s.fetcher()
+		p.Send = s.sender()
+		p.MaxSize = s.conf().Limits.MaxResourceSize
+		p.Render = req.Render
+		p.Renderer = s.pageRenderer()
+		p.Extractor = req.Extractor
+		p.Strip = strip
+		p.Headers = s.fetchHeaders(req.Namespace, req.Headers)
+		p.Workers = s.conf().CPU.SaveWorkers
+	case *protocol.Decrypt:
+		p.Version = s.protocolVersion(req.Namespace)
+	case *protocol.ConsensusMerkleState:
+		p.Version = s.protocolVersion(req.Namespace)
+		p.Publics = setup.publics(p.Roster())
+		p.ClientRequest = clientRequest(req)
+		p.CheckURL = s.checkURL
+		p.Fetch = s.fetcher()
+		p.Send = s.sender()
+		p.MaxSize = s.conf().Limits.MaxResourceSize
+		p.Render = req.Render
+		p.Renderer = s.pageRenderer()
+		p.Extractor = req.Extractor
+		p.Strip = strip
+		p.Headers = s.fetchHeaders(req.Namespace, req.Headers)
+	}
+	return nil
 }
 
-// uniqueLeaves returns unique leaves stored by the conode
-func (s *Service) uniqueLeaves() []string {
-	return s.Leaves
+// stripSelectors returns the CSS selectors of the elements removed from the
+// page of url before the consensus, see StripConfig
+func (s *Service) stripSelectors(url string) []string {
+	u, err := urlpkg.Parse(url)
+	if err != nil {
+		return nil
+	}
+	// the rules are validated with the configuration
+	rules, err := s.conf().Strip.Rules()
+	if err != nil {
+		return nil
+	}
+	return rules.Selectors(u.Hostname())
 }
 
-// latestID returns the ID of the last skipchain block as stored by the conode
-func (s *Service) latestID() skipchain.SkipBlockID {
-	s.Storage.Lock()
-	defer s.Storage.Unlock()
-	return s.Storage.LatestID
+// verifyStrip returns an error if one of the strip selectors sent by the root
+// for the page of url is not in the configuration of the conode, see
+// StripConfig
+func (s *Service) verifyStrip(url string, strip []string) error {
+	own := make(map[string]bool)
+	for _, sel := range s.stripSelectors(url) {
+		own[sel] = true
+	}
+	for _, sel := range strip {
+		if !own[sel] {
+			return fmt.Errorf("strip selector %q is not configured on the conode", sel)
+		}
+	}
+	return nil
+}
+
+// logger returns the structured logger of this conode for the save with the
+// given request ID
+func (s *Service) logger(requestID string) *lib.Logger {
+	return lib.NewLogger(requestID, s.ServerIdentity().Address.String()).With("service", decenarch.ServiceName)
+}
+
+// cosiSaveState returns the material of the save of the ftcosi sub-protocol
+// proto, whose request ID is carried by conf. The config is passed on to the
+// children of the conode. The root instance has no config and gets an empty
+// state, its verification data is the one of the root protocol.
+func (s *Service) cosiSaveState(proto *ftcosiprotocol.SubFtCosi, conf *onet.GenericConfig) (saveState, error) {
+	requestID := configRequestID(conf)
+	if conf != nil {
+		if err := proto.SetConfig(conf); err != nil {
+			return saveState{}, err
+		}
+	}
+	st := s.saves.get(requestID)
+	if st.consensus == nil {
+		st.consensus = &ConsensusPropagation{RequestID: requestID}
+	}
+	return st, nil
+}
+
+// fetcher returns the fetcher of the pages of the conode
+func (s *Service) fetcher() protocol.Fetcher {
+	if s.fetch != nil {
+		return s.fetch
+	}
+	s.configMutex.Lock()
+	defer s.configMutex.Unlock()
+	if s.configFetch != nil {
+		return s.configFetch
+	}
+	return protocol.HTTPFetcher
+}
+
+// fetchHeaders returns the headers of the fetches of the pages agreed at the
+// setup of the namespace ns, overridden by the ones of a save request, see
+// decenarch.MergeFetchHeaders
+func (s *Service) fetchHeaders(ns string, override map[string]string) map[string]string {
+	return decenarch.MergeFetchHeaders(s.namespace(ns).FetchHeaders, override)
+}
+
+// linkNormalizer returns the normalizer of the links to the additional
+// resources of the pages agreed at the setup of the namespace ns, so that
+// the root and the conodes checking its list agree on the links, see
+// protocol.CheckPageLinks. The archives set up before its agreement use the
+// normalizer of the configuration of the conode.
+func (s *Service) linkNormalizer(ns string) *lib.URLNormalizer {
+	if n := s.namespace(ns).Normalizer; n != nil {
+		return n
+	}
+	return s.conf().URL.Normalizer()
+}
+
+// sender returns the sender of the request templates of the conode
+func (s *Service) sender() protocol.Sender {
+	if s.send != nil {
+		return s.send
+	}
+	s.configMutex.Lock()
+	defer s.configMutex.Unlock()
+	if s.configSend != nil {
+		return s.configSend
+	}
+	return protocol.HTTPSender
+}
+
+// UseFetcher makes the conode fetch the pages with f instead of fetching
+// them from the web, e.g. with protocol.LocalFetcher in the simulations. It
+// must be called before the first save and must not be used by the conodes.
+// The pages fetched with the headers agreed at setup are sent with the
+// sender, see UseSender.
+func (s *Service) UseFetcher(f protocol.Fetcher) {
+	s.fetch = f
+}
+
+// UseSender makes the conode send the requests replayed from the request
+// templates with f, as UseFetcher does for the pages
+func (s *Service) UseSender(f protocol.Sender) {
+	s.send = f
+}
+
+// UseFaults makes the conode misbehave in the protocols, see
+// protocol.Faults. It is used by the simulations and must not be used by the
+// conodes.
+func (s *Service) UseFaults(f *protocol.Faults) {
+	s.faults = f
+}
+
+// now returns the current time of the clock of the conode
+func (s *Service) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock()
+}
+
+// zeroPool returns the pool of encryptions of 0 under the DKG key, created
+// for the current key. It returns nil if the conode is not set up or
+// precomputes no encryption.
+func (s *Service) zeroPool() *lib.ZeroPool {
+	if s.conf() == nil || s.conf().Limits.ZeroPool <= 0 {
+		return nil
+	}
+	key, err := s.key()
+	if err != nil {
+		return nil
+	}
+	s.zerosMutex.Lock()
+	defer s.zerosMutex.Unlock()
+	if s.zeros == nil || !s.zeros.Public().Equal(key) {
+		s.zeros = lib.NewZeroPool(key)
+	}
+	return s.zeros
+}
+
+// refillZeroPool fills the pool of encryptions of 0 in background, so that
+// the next filter of the conode is encrypted in advance
+func (s *Service) refillZeroPool() {
+	if pool := s.zeroPool(); pool != nil {
+		go pool.Fill(s.conf().Limits.ZeroPool)
+	}
+}
+
+// packedCBFSet returns the encrypted CBF set received by the conode for the
+// decryption, packed for the verification data. It returns nil if the conode
+// received no valid set.
+func (st *saveState) packedCBFSet() []byte {
+	if st.encryptedCBFSet == nil {
+		return nil
+	}
+	return st.encryptedCBFSet.Pack()
 }
 
 // genesisID returns the ID of the genesis block as stored be the conode
@@ -683,17 +1526,39 @@ func (s *Service) genesisID() skipchain.SkipBlockID {
 	return s.Storage.GenesisID
 }
 
-// LocalHTMLTree returns the HTML tree resulting from the download of the
-// webpage by the conode
-func (s *Service) localHTMLTree() *html.Node {
-	return s.LocalHTMLTree
+// archive returns the client of the skipchain storing the archive. The urls
+// to retrieve are resolved with the fetcher of the conode.
+func (s *Service) archive() skip.Archive {
+	return s.namespaceArchive("")
 }
 
-// threshold returns the threshold stored by the conode
-func (s *Service) threshold() int32 {
-	s.Storage.Lock()
-	defer s.Storage.Unlock()
-	return s.Storage.Threshold
+// namespaceArchive returns the client of the skipchain storing the archive of
+// the namespace ns, see archive
+func (s *Service) namespaceArchive(ns string) skip.Archive {
+	client := skip.NewSkipClient(int(s.namespace(ns).Threshold))
+	client.Tier = lib.NewMultiTier(s.hot, s.cold)
+	client.IPFS = s.ipfs
+	client.Get = func(url string) (*http.Response, error) {
+		return s.fetcher()(url, nil)
+	}
+	client.Normalize = s.normalizeURL
+	if ns == "" {
+		client.UnsignedBefore = s.conf().Skip.UnsignedBefore
+	}
+	return client
+}
+
+// protocolVersion returns the version of the protocols agreed at the setup of
+// the namespace ns, at which the conode runs the protocols it leads. A conode
+// set up before the versioning runs the legacy version, and one whose version
+// is not supported anymore runs its own.
+func (s *Service) protocolVersion(ns string) int32 {
+	version, err := protocol.NegotiateVersion(s.namespace(ns).ProtocolVersion)
+	if err != nil {
+		log.Lvl1("Stored protocol version not supported:", err)
+		return protocol.Version
+	}
+	return version
 }
 
 // secret returns the shared secret for a given election.
@@ -708,7 +1573,7 @@ func (s *Service) key() (kyber.Point, error) {
 	s.Storage.Lock()
 	defer s.Storage.Unlock()
 	if s.Storage.Secret == nil {
-		return nil, errors.New("Shared public key not found: run setup before saving a webpage")
+		return nil, decenarch.ErrNoSetup
 	}
 	return s.Storage.Secret.X, nil
 }
@@ -721,7 +1586,9 @@ func (s *Service) propagateConsensusFunc(consensusMessage network.Message) {
 		log.Error("got something else than a setup propagation message")
 		return
 	}
-	s.ConsensusPropagation = m
+	s.saves.update(m.RequestID, s.now(), func(st *saveState) {
+		st.consensus = m
+	})
 }
 
 // propagateSetupFunc is the function executed by the conode when receiving a
@@ -732,11 +1599,38 @@ func (s *Service) propagateSetupFunc(setupMessage network.Message) {
 		log.Error("got something else than a setup propagation message")
 		return
 	}
-	s.Storage.Lock()
-	s.Storage.GenesisID = m.GenesisID
-	s.Storage.Threshold = m.Threshold
-	s.Storage.Unlock()
-	s.save()
+	// a conode that doesn't support the version of the leader keeps its
+	// previous setup, and one that is newer runs the protocols at the
+	// version of the leader
+	version, err := protocol.NegotiateVersion(m.Version)
+	if err != nil {
+		log.Error("Refusing the setup:", err)
+		return
+	}
+	if err := decenarch.ValidNamespace(m.Namespace); err != nil {
+		log.Error("Refusing the setup:", err)
+		return
+	}
+	s.updateNamespace(m.Namespace, func(n *Namespace) {
+		n.GenesisID = m.GenesisID
+		n.Threshold = m.Threshold
+		n.AuthorizedKeys = m.AuthorizedKeys
+		n.FalsePositiveRate = m.FalsePositiveRate
+		n.Roster = m.Roster
+		n.ProtocolVersion = version
+		n.Scheme = m.Scheme
+		n.CounterWidth = m.CounterWidth
+		n.MaxHomomorphicInt = m.MaxHomomorphicInt
+		n.FetchHeaders = m.FetchHeaders
+		n.Normalizer = m.Normalizer
+	})
+	if m.Namespace == "" {
+		s.Storage.Lock()
+		s.Storage.DomainPolicy = m.DomainPolicy
+		s.Storage.BlockInterval = m.BlockInterval
+		s.Storage.Unlock()
+		s.save()
+	}
 }
 
 // saves all the the storage data
@@ -768,6 +1662,13 @@ func (s *Service) tryLoad() error {
 	if !ok {
 		return errors.New("service error: could not unmarshal storage")
 	}
+	migrated, err := migrateStorage(s.Storage)
+	if err != nil {
+		return err
+	}
+	if migrated {
+		return s.Save(storageID, s.Storage)
+	}
 	return nil
 }
 
@@ -777,9 +1678,9 @@ func (s *Service) tryLoad() error {
 func newService(c *onet.Context) (onet.Service, error) {
 	s := &Service{
 		ServiceProcessor: onet.NewServiceProcessor(c),
-		Storage:          &Storage{},
+		Storage:          &Storage{Version: storageVersion},
 	}
-	if err := s.RegisterHandlers(s.Setup, s.SaveWebpage, s.Retrieve); err != nil {
+	if err := s.RegisterHandlers(s.Setup, s.GetSetupInfo, s.GetPublicKey, s.SaveWebpage, s.Retrieve, s.Status, s.Admin, s.Flush, s.Prune, s.Content, s.Import, s.Mirror, s.Subscribe, s.Unsubscribe, s.WatchFeed, s.Stats, s.Cancel); err != nil {
 		log.Error(err, "Couldn't register messages")
 		return nil, err
 	}
@@ -787,10 +1688,36 @@ func newService(c *onet.Context) (onet.Service, error) {
 		log.Error(err)
 		return nil, err
 	}
-	var err error
+	config, err := loadConfig(configPath())
+	if err != nil {
+		log.Error(err, "Couldn't load decenarch configuration")
+		return nil, err
+	}
+	s.quota = newQuota(config.Quota)
+	s.queue = newSaveQueue(config.Queue)
+	if err := s.applyConfig(config); err != nil {
+		log.Error(err, "Couldn't apply decenarch configuration")
+		return nil, err
+	}
+	s.topology = newTopology()
+	s.batch = &batch{}
+	s.saves = newSaveStates()
+	s.sessions = newSessions()
+	s.refillZeroPool()
+	startProfiling(config.Profile)
+	if err := s.openTiers(); err != nil {
+		log.Error(err, "Couldn't open the storage tiers")
+		return nil, err
+	}
+	s.recoverJournal()
+	s.scheduleFeeds()
+	s.scheduleVerification()
+
 	s.propagateSetup, err = messaging.NewPropagationFunc(c, "PropagateSetup", s.propagateSetupFunc, -1)
 	s.propagateConsensus, err = messaging.NewPropagationFunc(c, "PropagateConsensus", s.propagateConsensusFunc, -1)
 	log.ErrFatal(err)
+	s.propagatePrune, err = messaging.NewPropagationFunc(c, "PropagatePrune", s.propagatePruneFunc, -1)
+	log.ErrFatal(err)
 	return s, nil
 }
 
@@ -799,47 +1726,35 @@ func newService(c *onet.Context) (onet.Service, error) {
 // "Additional ressources" means :
 //    - css file
 //    - images
-func ExtractPageExternalLinks(pageUrl string, page *bytes.Buffer) []string {
+// If normalizer is not nil, the links are given in their canonical form,
+// without duplicates, see protocol.ExtractPageLinks.
+func ExtractPageExternalLinks(pageUrl string, page *bytes.Buffer, normalizer *lib.URLNormalizer) []string {
 	log.Lvl4("Parsing parent page")
-	var links []string
-	// parse page to extract links
-	tokensPage := html.NewTokenizer(page)
-	for tok := tokensPage.Next(); tok != html.ErrorToken; tok = tokensPage.Next() {
-		tagName, _ := tokensPage.TagName()
-		// extract attribute
-		attributeMap := make(map[string]string)
-		for moreAttr := true; moreAttr; {
-			attrKey, attrValue, isMore := tokensPage.TagAttr()
-			moreAttr = isMore
-			attributeMap[string(attrKey)] = string(attrValue)
-		}
-		// check for relevant ressources, i.e. CSS file and/or images
-		if tok == html.StartTagToken || tok == html.SelfClosingTagToken {
-			if string(tagName) == "link" && attributeMap["rel"] == "stylesheet" {
-				links = append(links, attributeMap["href"])
-			} else if string(tagName) == "img" {
-				links = append(links, attributeMap["src"])
-			}
-		}
+	return protocol.ExtractPageLinks(pageUrl, page.Bytes(), normalizer)
+}
+
+// blobPlaceholders returns the placeholders of the inline blobs
+func blobPlaceholders(blobs []protocol.InlineBlob) []string {
+	placeholders := make([]string, len(blobs))
+	for i, b := range blobs {
+		placeholders[i] = b.Placeholder
 	}
-	// turns found links into web-requestable links
-	var requestLinks []string = make([]string, 0)
-	urlStruct, urlErr := urlpkg.Parse(pageUrl)
-	if urlErr != nil {
-		return make([]string, 0)
-	}
-	for _, link := range links {
-		urlS, urlE := urlpkg.Parse(link)
-		if urlE == nil {
-			if urlS.IsAbs() {
-				requestLinks = append(requestLinks, link)
-			} else {
-				reqLink, reqErr := urlStruct.Parse(link)
-				if reqErr == nil {
-					requestLinks = append(requestLinks, reqLink.String())
-				}
-			}
-		}
+	return placeholders
+}
+
+// certificateRecord returns the certificate hash agreed on by the conodes
+// during the structured consensus, and the chain observed by the root if its
+// leaf is the agreed certificate
+func certificateRecord(p *protocol.EngineResult) (string, []string) {
+	if p.CertificateHash == "" || len(p.CertificateChain) == 0 {
+		return p.CertificateHash, nil
+	}
+	if lib.CertificateHash(p.CertificateChain[0]) != p.CertificateHash {
+		return p.CertificateHash, nil
+	}
+	chain := make([]string, len(p.CertificateChain))
+	for i, c := range p.CertificateChain {
+		chain[i] = base64.StdEncoding.EncodeToString(c)
 	}
-	return requestLinks
+	return p.CertificateHash, chain
 }
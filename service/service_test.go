@@ -1,18 +1,59 @@
 package service
 
 import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
-	"gopkg.in/dedis/cothority.v2"
 	"gopkg.in/dedis/onet.v2"
 
 	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/protocol"
 	"github.com/stretchr/testify/require"
 )
 
+// testPage is the page saved by the tests of the service
+const testPage = `<html><head><title>decenarch</title></head><body>
+<h1>Decentralized archive</h1><p>The conodes agree on the content of the page.</p>
+</body></html>`
+
+// testResource is a file served to the conodes by the tests
+type testResource struct {
+	contentType string
+	content     string
+}
+
+// newTestServer returns a server serving the resources of site by path
+func newTestServer(site map[string]testResource) *httptest.Server {
+	mux := http.NewServeMux()
+	for path, res := range site {
+		res := res
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", res.contentType)
+			w.Write([]byte(res.content))
+		})
+	}
+	return httptest.NewServer(mux)
+}
+
+// useTestHooks makes the services fetch all the pages from server and sets
+// their clock, and the clock of the signing protocols, to now
+func useTestHooks(services []*Service, server *httptest.Server, now time.Time) func() {
+	clock := func() time.Time { return now }
+	for _, s := range services {
+		s.fetch = protocol.LocalFetcher(server.Listener.Addr().String())
+		s.send = protocol.LocalSender(server.Listener.Addr().String())
+		s.clock = clock
+	}
+	protocol.Now = clock
+	return func() { protocol.Now = time.Now }
+}
+
 func TestService(t *testing.T) {
-	local := onet.NewLocalTest(cothority.Suite)
+	local := onet.NewLocalTest(decenarch.Suite)
 	defer local.CloseAll()
 	nodes, roster, _ := local.GenBigTree(6, 6, 1, true)
 	s0 := local.GetServices(nodes, templateID)[0].(*Service)
@@ -22,6 +63,12 @@ func TestService(t *testing.T) {
 	s4 := local.GetServices(nodes, templateID)[4].(*Service)
 	s5 := local.GetServices(nodes, templateID)[5].(*Service)
 	services := []*Service{s0, s1, s2, s3, s4, s5}
+	server := newTestServer(map[string]testResource{
+		"/page.html": {"text/html; charset=utf-8", testPage},
+	})
+	defer server.Close()
+	now := time.Date(2018, time.June, 1, 12, 0, 0, 0, time.Local)
+	defer useTestHooks(services, server, now)()
 
 	// setup
 	setupResponse, err := s0.Setup(&decenarch.SetupRequest{Roster: roster})
@@ -37,8 +84,49 @@ func TestService(t *testing.T) {
 		require.True(t, setupResponse.Key.Equal(key))
 	}
 
+	// a second setup keeps the key, which every conode reports
+	again, err := s3.Setup(&decenarch.SetupRequest{Roster: roster})
+	require.Nil(t, err)
+	require.True(t, setupResponse.Key.Equal(again.Key))
+	for _, s := range services {
+		info, err := s.GetSetupInfo(&decenarch.SetupInfoRequest{})
+		require.Nil(t, err)
+		require.True(t, setupResponse.Key.Equal(info.Key))
+		require.Equal(t, []byte(s0.genesisID()), info.GenesisID)
+		require.Equal(t, int32(decenarch.Threshold(len(roster.List))), info.Threshold)
+		width, max := s.namespace("").counters()
+		require.Equal(t, lib.CounterWidth(len(roster.List)), width)
+		require.Equal(t, lib.CounterMax(width), max)
+		require.True(t, sameRoster(roster, info.Roster))
+
+		key, err := s.GetPublicKey(&decenarch.PublicKeyRequest{})
+		require.Nil(t, err)
+		require.True(t, setupResponse.Key.Equal(key.Key))
+		require.Equal(t, decenarch.RosterHash(roster), key.RosterHash)
+		require.NotEqual(t, int64(0), key.Created)
+	}
+	_, err = s3.Setup(&decenarch.SetupRequest{Roster: onet.NewRoster(roster.List[:4])})
+	require.NotNil(t, err)
+
 	// save web page
-	saveResponse, err := s0.SaveWebpage(&decenarch.SaveRequest{Roster: roster, Url: "http://nibelung.ch/decenarch/100p.html"})
+	saveResponse, err := s0.SaveWebpage(&decenarch.SaveRequest{Roster: roster, Url: "http://example.com/page.html"})
 	require.Nil(t, err)
 	require.NotNil(t, saveResponse)
+	require.Equal(t, now.Format(decenarch.StatTimeFormat), s0.Storage.LastSave)
+}
+
+func TestExtractPageExternalLinks(t *testing.T) {
+	page := `<html><head><link rel="stylesheet" href="/main.css?utm_source=feed">
+<link rel="stylesheet" href="http://EXAMPLE.com:80/main.css#top"></head>
+<body><img src="img/a.png"><img src="decenarch-inline:00"></body></html>`
+	links := ExtractPageExternalLinks("http://example.com/blog/", bytes.NewBufferString(page), nil)
+	require.Equal(t, []string{"http://example.com/main.css?utm_source=feed", "http://EXAMPLE.com:80/main.css#top",
+		"http://example.com/blog/img/a.png"}, links)
+
+	// the canonical links are deduplicated
+	s := &Service{config: DefaultConfig()}
+	links = ExtractPageExternalLinks("http://example.com/blog/", bytes.NewBufferString(page), s.config.URL.Normalizer())
+	require.Equal(t, []string{"http://example.com/main.css", "http://example.com/blog/img/a.png"}, links)
+	require.Equal(t, "http://example.com/page.html", s.normalizeURL("http://example.com/page.html/?fbclid=1"))
+	require.Equal(t, "not a url", s.normalizeURL("not a url"))
 }
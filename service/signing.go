@@ -0,0 +1,313 @@
+package service
+
+/*
+The signing.go defines how the root runs the protocols signing a save, ftcosi
+or the BLS signing protocol depending on the scheme agreed at setup, see
+bls.go. The number of subtrees, the time the root waits for a subtree and the
+number of runs after a timeout are options of the conode, see SignConfig, that
+a save can lower, see decenarch.SignOptions. The root records the subtrees it
+starts: when a subleader doesn't answer in time, ftcosi starts its subtree
+again with another subleader, so that a timeout of the whole protocol is
+reported with the subtrees and their replaced subleaders, see
+decenarch.SignatureTimeoutError.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ftcosiprotocol "gopkg.in/dedis/cothority.v2/ftcosi/protocol"
+	ftcosiservice "gopkg.in/dedis/cothority.v2/ftcosi/service"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/protocol"
+)
+
+// signOptions returns the options of the signing protocols of the save on a
+// tree of size conodes: the options of the conode, lowered by the options of
+// the request
+func (s *Service) signOptions(requestID string, size int) decenarch.SignOptions {
+	c := s.conf().Sign
+	o := decenarch.SignOptions{Subtrees: c.Subtrees, Timeout: c.Timeout, Retries: c.Retries}
+	if o.Timeout == 0 {
+		o.Timeout = DefaultSignTimeout
+	}
+	if req := s.saves.get(requestID).sign; req != nil {
+		if req.Subtrees > 0 {
+			o.Subtrees = req.Subtrees
+		}
+		if req.Timeout > 0 && req.Timeout < o.Timeout {
+			o.Timeout = req.Timeout
+		}
+		if req.Retries > 0 && req.Retries < o.Retries {
+			o.Retries = req.Retries
+		}
+	}
+	if o.Subtrees == 0 {
+		// We set NSubtrees to the cube root of n to evenly distribute the
+		// load, i.e. depth (=3) = log_f n, where f is the fan-out
+		// (branching factor).
+		o.Subtrees = int(math.Pow(float64(size), 1.0/3.0))
+	}
+	// the subtrees are made of the conodes other than the root
+	if o.Subtrees > size-1 {
+		o.Subtrees = size - 1
+	}
+	if o.Subtrees < 1 {
+		o.Subtrees = 1
+	}
+	return o
+}
+
+// cosiRun is the root instance of a signing protocol with the subtrees it
+// started. With decenarch.SchemeBLS, the protocol is protocol.SignBLS on a
+// flat tree, instead of ftcosi.
+//    - name is the name of the ftcosi protocol and tree the tree it was
+//      asked to run on
+//    - wait is the time the root waits for the signature
+type cosiRun struct {
+	name     string
+	tree     *onet.Tree
+	cosi     *ftcosiprotocol.FtCosi
+	bls      *protocol.SignBLS
+	subtrees *subtreeLog
+	wait     time.Duration
+}
+
+// private returns the private key of the root
+func (r *cosiRun) private() kyber.Scalar {
+	if r.bls != nil {
+		return r.bls.Private()
+	}
+	return r.cosi.Private()
+}
+
+// start starts the protocol with the verification data of the root
+func (r *cosiRun) start(data []byte) error {
+	if r.bls != nil {
+		r.bls.Data = data
+		return r.bls.Start()
+	}
+	r.cosi.Data = data
+	return r.cosi.Start()
+}
+
+// final returns the channel of the signature
+func (r *cosiRun) final() chan []byte {
+	if r.bls != nil {
+		return r.bls.FinalSignature
+	}
+	return r.cosi.FinalSignature
+}
+
+// done ends the root instance of a run that timed out, so that it doesn't
+// outlive the next attempt
+func (r *cosiRun) done() {
+	if r.bls != nil {
+		r.bls.Stop()
+		return
+	}
+	r.cosi.Done()
+}
+
+// newCosi creates and configures the root instance of the signing protocol
+// with the given name on msgToSign, with the scheme agreed at the setup of the
+// archive of the save. The approval of a pruning is only checked by the
+// conodes, against the roster without BLS keys, so it is always signed with
+// ftcosi. The sub-protocols carry the request ID and the namespace of the save
+// in their config, see saves.go
+func (s *Service) newCosi(requestID string, t *onet.Tree, name string, msgToSign []byte) (*cosiRun, error) {
+	opts := s.signOptions(requestID, t.Size())
+	run := &cosiRun{name: name, tree: t, subtrees: newSubtreeLog()}
+	ns := s.saves.get(requestID).namespace
+	setup := s.namespace(ns)
+	if setup.scheme() == decenarch.SchemeBLS && name != protocol.NamePrune {
+		pi, err := s.createProtocol(requestID, protocol.NameSignBLS, flatTree(t))
+		if err != nil {
+			return nil, err
+		}
+		p := pi.(*protocol.SignBLS)
+		p.RequestID = requestID
+		p.Name = name
+		p.Msg = msgToSign
+		p.Version = s.protocolVersion(ns)
+		p.Timeout = time.Duration(opts.Timeout) * time.Second
+		run.bls = p
+		run.wait = p.Timeout + time.Second
+		return run, nil
+	}
+
+	// protocol instance
+	pi, err := s.CreateProtocol(name, t)
+	if err != nil {
+		return nil, err
+	}
+
+	// configure the protocol
+	p := pi.(*ftcosiprotocol.FtCosi)
+	p.CreateProtocol = func(name string, t *onet.Tree) (onet.ProtocolInstance, error) {
+		sub, err := s.CreateProtocol(name, t)
+		if err != nil {
+			return nil, err
+		}
+		run.subtrees.start(t)
+		return sub, sub.(*ftcosiprotocol.SubFtCosi).SetConfig(saveConfig(requestID, ns))
+	}
+	p.Msg = msgToSign
+	p.NSubtrees = opts.Subtrees
+	// Timeout is not a global timeout for the protocol, but a timeout used
+	// for waiting for responses for sub protocols.
+	p.Timeout = time.Duration(opts.Timeout) * time.Second
+	run.cosi = p
+	run.wait = p.Timeout*5 + time.Second
+	return run, nil
+}
+
+// runCosi starts the signing protocol of run with the verification data and
+// waits for the collective signature. After a timeout, a new instance of the
+// protocol is run as many times as the sign options of the save allow. The
+// BLS keys of the signers are kept with the save, see signerKeys.
+func (s *Service) runCosi(requestID string, run *cosiRun, msgToSign []byte, data []byte) (*ftcosiservice.SignatureResponse, error) {
+	name := run.name
+	logger := s.logger(requestID).With("protocol", name)
+	retries := s.signOptions(requestID, run.tree.Size()).Retries
+	for attempt := 1; ; attempt++ {
+		// start the protocol
+		logger.Lvl3("Cosi Service starting up root protocol", "attempt", attempt)
+		if err := run.start(data); err != nil {
+			return nil, err
+		}
+
+		// wait for reply
+		select {
+		case sig := <-run.final():
+			if run.bls != nil {
+				if sig == nil {
+					return nil, errors.New("no conode signed with protocol " + name)
+				}
+				s.saves.update(requestID, s.now(), func(st *saveState) {
+					st.signerKeys = mergeSignerKeys(st.signerKeys, run.bls.Keys)
+				})
+			}
+			//The hash is the message ftcosi actually signs, we recompute it
+			//the same way as ftcosi and then return it.
+			h := decenarch.Suite.Hash()
+			h.Write(msgToSign)
+			return &ftcosiservice.SignatureResponse{Hash: h.Sum(nil), Signature: sig}, nil
+		case <-time.After(run.wait):
+		}
+
+		subtrees := run.subtrees.describe()
+		logger.Lvl1("Signature protocol timed out", "attempt", attempt, "subtrees", strings.Join(subtrees, "; "))
+		run.done()
+		if attempt > retries {
+			return nil, &decenarch.SignatureTimeoutError{Protocol: name, Attempts: attempt, Subtrees: subtrees}
+		}
+		var err error
+		if run, err = s.newCosi(requestID, run.tree, name, msgToSign); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// signerKeys returns the scheme of the signatures of the save and the BLS
+// keys of their signers, to be stored with the signatures. The scheme is
+// empty with decenarch.SchemeCosi.
+func (s *Service) signerKeys(requestID string) (string, []decenarch.SignerKey) {
+	if setup := s.saveNamespace(requestID); setup.scheme() != decenarch.SchemeBLS {
+		return "", nil
+	}
+	return decenarch.SchemeBLS, s.saves.get(requestID).signerKeys
+}
+
+// mergeSignerKeys returns keys with the keys of added whose conode has no
+// key in keys
+func mergeSignerKeys(keys, added []decenarch.SignerKey) []decenarch.SignerKey {
+	known := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		known[k.Conode] = true
+	}
+	for _, k := range added {
+		if !known[k.Conode] {
+			known[k.Conode] = true
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// subtreeLog records the subtrees started by the root of a signing protocol,
+// identified by their conodes
+type subtreeLog struct {
+	sync.Mutex
+	order    []string
+	subtrees map[string]*subtreeStatus
+}
+
+// subtreeStatus is a subtree of a subtreeLog
+//    - leader is the address of the current subleader
+//    - size is the number of conodes of the subtree, the root excepted
+//    - replaced are the addresses of the previous subleaders
+type subtreeStatus struct {
+	leader   string
+	size     int
+	replaced []string
+}
+
+// newSubtreeLog returns an empty log
+func newSubtreeLog() *subtreeLog {
+	return &subtreeLog{subtrees: make(map[string]*subtreeStatus)}
+}
+
+// start records the subtree t, whose root is the root of the protocol. A
+// subtree started again with another subleader had its subleader replaced.
+func (l *subtreeLog) start(t *onet.Tree) {
+	if t.Root == nil || len(t.Root.Children) == 0 {
+		return
+	}
+	leader := t.Root.Children[0].ServerIdentity.Address.String()
+	var conodes []string
+	for _, n := range t.List() {
+		if n != t.Root {
+			conodes = append(conodes, n.ServerIdentity.Address.String())
+		}
+	}
+	sort.Strings(conodes)
+	key := strings.Join(conodes, ",")
+
+	l.Lock()
+	defer l.Unlock()
+	st, ok := l.subtrees[key]
+	if !ok {
+		st = &subtreeStatus{size: len(conodes)}
+		l.subtrees[key] = st
+		l.order = append(l.order, key)
+	} else if st.leader != leader {
+		st.replaced = append(st.replaced, st.leader)
+	}
+	st.leader = leader
+}
+
+// describe returns a description of the subtrees, in the order they were
+// started
+func (l *subtreeLog) describe() []string {
+	l.Lock()
+	defer l.Unlock()
+	descriptions := make([]string, 0, len(l.order))
+	for _, key := range l.order {
+		st := l.subtrees[key]
+		d := fmt.Sprintf("subleader %s of %d conodes", st.leader, st.size)
+		if len(st.replaced) > 0 {
+			d += ", replaced " + strings.Join(st.replaced, ", ")
+		}
+		descriptions = append(descriptions, d)
+	}
+	return descriptions
+}
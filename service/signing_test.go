@@ -0,0 +1,63 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/stretchr/testify/require"
+
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/network"
+)
+
+func TestSignOptions(t *testing.T) {
+	s := &Service{config: DefaultConfig(), saves: newSaveStates()}
+
+	// the default options of the conode
+	require.Equal(t, decenarch.SignOptions{Subtrees: 2, Timeout: DefaultSignTimeout}, s.signOptions("a", 10))
+	require.Equal(t, 1, s.signOptions("a", 1).Subtrees)
+
+	// the request lowers the timeout and the retries of the conode
+	s.config.Sign = SignConfig{Timeout: 60, Retries: 2}
+	s.saves.update("a", s.now(), func(st *saveState) {
+		st.sign = &decenarch.SignOptions{Subtrees: 20, Timeout: 600, Retries: 1}
+	})
+	require.Equal(t, decenarch.SignOptions{Subtrees: 9, Timeout: 60, Retries: 1}, s.signOptions("a", 10))
+	s.saves.update("a", s.now(), func(st *saveState) {
+		st.sign = &decenarch.SignOptions{Timeout: 10, Retries: 5}
+	})
+	require.Equal(t, decenarch.SignOptions{Subtrees: 2, Timeout: 10, Retries: 2}, s.signOptions("a", 10))
+
+	require.NotNil(t, (&decenarch.SignOptions{Retries: -1}).Validate())
+	require.Nil(t, (*decenarch.SignOptions)(nil).Validate())
+}
+
+func TestSubtreeLog(t *testing.T) {
+	list := make([]*network.ServerIdentity, 7)
+	for i := range list {
+		addr := network.NewAddress(network.TLS, fmt.Sprintf("127.0.0.1:%d", 7000+i))
+		list[i] = network.NewServerIdentity(key.NewKeyPair(decenarch.Suite).Public, addr)
+	}
+	// the subtrees are chains from the root, the first child is the
+	// subleader
+	subtree := func(conodes ...int) *onet.Tree {
+		si := []*network.ServerIdentity{list[0]}
+		for _, c := range conodes {
+			si = append(si, list[c])
+		}
+		return onet.NewRoster(si).GenerateNaryTree(1)
+	}
+
+	l := newSubtreeLog()
+	require.Empty(t, l.describe())
+	l.start(subtree(1, 2, 3))
+	l.start(subtree(4, 5, 6))
+	// the first subleader didn't answer, the subtree is started again
+	l.start(subtree(2, 1, 3))
+	require.Equal(t, []string{
+		"subleader tls://127.0.0.1:7002 of 3 conodes, replaced tls://127.0.0.1:7001",
+		"subleader tls://127.0.0.1:7004 of 3 conodes",
+	}, l.describe())
+}
@@ -0,0 +1,117 @@
+package service
+
+/*
+The status.go defines the Status API-call, used by operators to detect a
+broken conode before a save fails.
+*/
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/network"
+)
+
+// statusTimeout is the maximal duration of the status request to another
+// conode. A conode not answering in time is reported as unreachable.
+const statusTimeout = 5 * time.Second
+
+// Status returns the status of this conode. If the request has a roster, the
+// status of all the other conodes of the setup of this conode is requested
+// too, so that the response also tells which conodes are reachable from this
+// one. The conodes of the roster of the request are never contacted, a
+// client could otherwise make the conode probe any address.
+func (s *Service) Status(req *decenarch.StatusRequest) (*decenarch.StatusResponse, error) {
+	log.Lvl3("Decenarch Service new StatusRequest")
+	resp := &decenarch.StatusResponse{
+		Conodes: []decenarch.ConodeStatus{s.localStatus()},
+	}
+	roster := s.setupRoster()
+	if req.Roster == nil || roster == nil {
+		return resp, nil
+	}
+
+	// the conodes are asked concurrently, each one within statusTimeout
+	var others []*network.ServerIdentity
+	for _, si := range roster.List {
+		if !si.Equal(s.ServerIdentity()) {
+			others = append(others, si)
+		}
+	}
+	statuses := make([]decenarch.ConodeStatus, len(others))
+	var wg sync.WaitGroup
+	for i, si := range others {
+		wg.Add(1)
+		go func(i int, si *network.ServerIdentity) {
+			defer wg.Done()
+			statuses[i] = remoteStatus(si)
+		}(i, si)
+	}
+	wg.Wait()
+	resp.Conodes = append(resp.Conodes, statuses...)
+	return resp, nil
+}
+
+// remoteStatus returns the status of the conode si, or its address and the
+// error of the request if it does not answer within statusTimeout
+func remoteStatus(si *network.ServerIdentity) decenarch.ConodeStatus {
+	type result struct {
+		resp *decenarch.StatusResponse
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		client := decenarch.NewClient()
+		defer client.Close()
+		remote := &decenarch.StatusResponse{}
+		err := client.SendProtobuf(si, &decenarch.StatusRequest{}, remote)
+		done <- result{remote, err}
+	}()
+	var err error
+	select {
+	case r := <-done:
+		if r.err == nil && len(r.resp.Conodes) > 0 {
+			return r.resp.Conodes[0]
+		}
+		err = r.err
+	case <-time.After(statusTimeout):
+		err = errors.New("no status within " + statusTimeout.String())
+	}
+	status := decenarch.ConodeStatus{Address: si.Address.String()}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// localStatus returns the status of this conode
+func (s *Service) localStatus() decenarch.ConodeStatus {
+	s.Storage.Lock()
+	defer s.Storage.Unlock()
+	status := decenarch.ConodeStatus{
+		Address:    s.ServerIdentity().Address.String(),
+		Reachable:  true,
+		KeyPresent: s.Storage.Secret != nil,
+		GenesisID:  s.Storage.GenesisID,
+		LatestID:   s.Storage.LatestID,
+		LastSave:   s.Storage.LastSave,
+		Topology:   s.topology.lastTopology(),
+	}
+	status.Interrupted = append(status.Interrupted, s.Storage.Interrupted...)
+	status.RunningSaves, status.QueuedSaves = s.queue.length()
+	status.Verification = s.verificationStatus()
+	if s.Storage.Secret != nil {
+		status.ShareIndex = s.Storage.Secret.Index
+	}
+	if b, err := network.Marshal(s.Storage); err == nil {
+		status.StorageSize = len(b)
+	} else {
+		log.Error("Impossible to compute storage size:", err)
+	}
+
+	return status
+}
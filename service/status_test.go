@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/stretchr/testify/require"
+
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/network"
+)
+
+func TestStatus(t *testing.T) {
+	local := onet.NewTCPTest(decenarch.Suite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(3, true)
+	s := local.GetServices(servers, templateID)[0].(*Service)
+
+	// the local status
+	resp, err := s.Status(&decenarch.StatusRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.Conodes, 1)
+	require.Equal(t, roster.List[0].Address.String(), resp.Conodes[0].Address)
+	require.True(t, resp.Conodes[0].Reachable)
+	require.False(t, resp.Conodes[0].KeyPresent)
+
+	// a conode not set up only gives its own status
+	probe := network.NewServerIdentity(key.NewKeyPair(decenarch.Suite).Public, network.NewAddress(network.TLS, "10.0.0.1:22"))
+	other := onet.NewRoster([]*network.ServerIdentity{probe})
+	resp, err = s.Status(&decenarch.StatusRequest{Roster: other})
+	require.NoError(t, err)
+	require.Len(t, resp.Conodes, 1)
+
+	// the status of the conodes of the setup is asked, never the one of the
+	// conodes of the request
+	s.Storage.Roster = roster
+	resp, err = s.Status(&decenarch.StatusRequest{Roster: other})
+	require.NoError(t, err)
+	require.Len(t, resp.Conodes, 3)
+	for i, status := range resp.Conodes {
+		require.Equal(t, roster.List[i].Address.String(), status.Address)
+		require.True(t, status.Reachable)
+		require.Empty(t, status.Error)
+	}
+}
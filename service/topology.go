@@ -0,0 +1,218 @@
+package service
+
+/*
+The topology.go defines how the conode leading a save chooses the tree of the
+protocols. The round-trip time to the other conodes is read from the
+configuration or measured, and the tree is built so that the conodes closest
+to the root are its inner nodes, while the slow or unreachable conodes are
+leaves. Small rosters use a flat tree, which has the lowest depth. The roster
+of the tree is never reordered, as the protocols rely on the roster index of
+the conodes.
+*/
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/network"
+)
+
+// flatTreeLimit is the largest roster using a flat tree when no branching
+// factor is configured
+const flatTreeLimit = 20
+
+// rttTimeout is the maximal duration of a round-trip time measurement. A
+// conode not answering in time is considered the slowest one.
+const rttTimeout = 2 * time.Second
+
+// rttValidity is the duration during which a measured round-trip time is used
+// without measuring it again
+const rttValidity = 10 * time.Minute
+
+// rttSample is a measured round-trip time
+type rttSample struct {
+	rtt  time.Duration
+	time time.Time
+}
+
+// topology keeps the measured round-trip times and the last tree used
+type topology struct {
+	sync.Mutex
+	samples map[string]rttSample
+	last    string
+}
+
+// newTopology returns an empty topology
+func newTopology() *topology {
+	return &topology{samples: make(map[string]rttSample)}
+}
+
+// lastTopology returns the description of the last tree used for a save
+func (t *topology) lastTopology() string {
+	t.Lock()
+	defer t.Unlock()
+	return t.last
+}
+
+// setLast records the description of the last tree used for a save
+func (t *topology) setLast(desc string) {
+	t.Lock()
+	defer t.Unlock()
+	t.last = desc
+}
+
+// saveTree returns the tree rooted at the conode used for a save, see
+// planTree and TreeConfig
+func (s *Service) saveTree(r *onet.Roster) *onet.Tree {
+	root := r.NewRosterWithRoot(s.ServerIdentity())
+	if root == nil {
+		return nil
+	}
+	rtts := s.roundTripTimes(root)
+	tree, desc := planTree(root, rtts, s.conf().Tree.BranchingFactor, s.excluded())
+	s.topology.setLast(desc)
+	return tree
+}
+
+// roundTripTimes returns the round-trip time from this conode to every conode
+// of the roster. The times given in the configuration are used first, then
+// the measurements done less than rttValidity ago. The other conodes are
+// measured concurrently.
+func (s *Service) roundTripTimes(r *onet.Roster) map[string]time.Duration {
+	rtts := make(map[string]time.Duration, len(r.List))
+	var measure []*network.ServerIdentity
+	now := time.Now()
+	s.topology.Lock()
+	for _, si := range r.List {
+		addr := si.Address.String()
+		if si.Equal(s.ServerIdentity()) {
+			rtts[addr] = 0
+		} else if ms, ok := s.conf().Tree.RTT[addr]; ok {
+			rtts[addr] = time.Duration(ms) * time.Millisecond
+		} else if sample, ok := s.topology.samples[addr]; ok && now.Sub(sample.time) < rttValidity {
+			rtts[addr] = sample.rtt
+		} else {
+			measure = append(measure, si)
+		}
+	}
+	s.topology.Unlock()
+
+	var wg sync.WaitGroup
+	measured := make([]time.Duration, len(measure))
+	for i, si := range measure {
+		wg.Add(1)
+		go func(i int, si *network.ServerIdentity) {
+			defer wg.Done()
+			measured[i] = measureRTT(si)
+		}(i, si)
+	}
+	wg.Wait()
+
+	s.topology.Lock()
+	defer s.topology.Unlock()
+	for i, si := range measure {
+		addr := si.Address.String()
+		rtts[addr] = measured[i]
+		s.topology.samples[addr] = rttSample{rtt: measured[i], time: now}
+	}
+	return rtts
+}
+
+// measureRTT returns the time needed to open a connection to the conode, or
+// rttTimeout if the conode cannot be contacted
+func measureRTT(si *network.ServerIdentity) time.Duration {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", si.Address.NetworkAddress(), rttTimeout)
+	if err != nil {
+		return rttTimeout
+	}
+	conn.Close()
+	return time.Since(start)
+}
+
+// branchingFactor returns the branching factor of the tree for n conodes. A
+// positive configured factor is used as is, otherwise small rosters use a
+// flat tree and larger ones a tree of depth two.
+func branchingFactor(n, configured int) int {
+	if n <= 1 {
+		return 1
+	}
+	if configured > 0 {
+		if configured > n-1 {
+			return n - 1
+		}
+		return configured
+	}
+	if n <= flatTreeLimit {
+		return n - 1
+	}
+	return int(math.Ceil(math.Sqrt(float64(n - 1))))
+}
+
+// planTree builds the tree over the roster r, whose first conode is the root.
+// The other conodes are placed breadth-first by increasing round-trip time, so
+// that the fastest conodes are the inner nodes of the tree. The conodes whose
+// public key is excluded are left out of the tree, without changing the indices
+// of the roster. The returned string describes the tree for debugging.
+func planTree(r *onet.Roster, rtts map[string]time.Duration, configured int, excluded map[string]bool) (*onet.Tree, string) {
+	others := make([]int, 0, len(r.List)-1)
+	for i := 1; i < len(r.List); i++ {
+		if !excluded[r.List[i].Public.String()] {
+			others = append(others, i)
+		}
+	}
+	bf := branchingFactor(len(others)+1, configured)
+	rtt := func(i int) time.Duration {
+		if d, ok := rtts[r.List[i].Address.String()]; ok {
+			return d
+		}
+		return rttTimeout
+	}
+	sort.SliceStable(others, func(a, b int) bool {
+		return rtt(others[a]) < rtt(others[b])
+	})
+
+	root := onet.NewTreeNode(0, r.List[0])
+	parents := []*onet.TreeNode{root}
+	for len(others) > 0 {
+		parent := parents[0]
+		parents = parents[1:]
+		for c := 0; c < bf && len(others) > 0; c++ {
+			child := onet.NewTreeNode(others[0], r.List[others[0]])
+			others = others[1:]
+			parent.AddChild(child)
+			parents = append(parents, child)
+		}
+	}
+	tree := onet.NewTree(r, root)
+	return tree, describeTree(tree, bf)
+}
+
+// describeTree returns a readable description of the tree, e.g.
+// "depth 1, branching factor 2: tls://a:7770(tls://b:7770 tls://c:7770)"
+func describeTree(t *onet.Tree, bf int) string {
+	var node func(n *onet.TreeNode) (string, int)
+	node = func(n *onet.TreeNode) (string, int) {
+		if len(n.Children) == 0 {
+			return n.ServerIdentity.Address.String(), 0
+		}
+		children := make([]string, len(n.Children))
+		depth := 0
+		for i, c := range n.Children {
+			var d int
+			children[i], d = node(c)
+			if d+1 > depth {
+				depth = d + 1
+			}
+		}
+		return fmt.Sprintf("%s(%s)", n.ServerIdentity.Address, strings.Join(children, " ")), depth
+	}
+	desc, depth := node(t.Root)
+	return fmt.Sprintf("depth %d, branching factor %d: %s", depth, bf, desc)
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/stretchr/testify/require"
+
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/network"
+)
+
+func TestBranchingFactor(t *testing.T) {
+	require.Equal(t, 1, branchingFactor(1, 0))
+	require.Equal(t, 4, branchingFactor(5, 0))
+	require.Equal(t, flatTreeLimit-1, branchingFactor(flatTreeLimit, 0))
+	require.Equal(t, 10, branchingFactor(101, 0))
+	require.Equal(t, 3, branchingFactor(10, 3))
+	require.Equal(t, 9, branchingFactor(10, 30))
+}
+
+func TestPlanTree(t *testing.T) {
+	list := make([]*network.ServerIdentity, 7)
+	rtts := make(map[string]time.Duration)
+	for i := range list {
+		addr := network.NewAddress(network.TLS, fmt.Sprintf("127.0.0.1:%d", 7000+i))
+		list[i] = network.NewServerIdentity(key.NewKeyPair(decenarch.Suite).Public, addr)
+		// the last conodes of the roster are the fastest ones
+		rtts[addr.String()] = time.Duration(10-i) * time.Millisecond
+	}
+	r := onet.NewRoster(list)
+
+	tree, desc := planTree(r, rtts, 2, nil)
+	require.Equal(t, 7, tree.Size())
+	require.Contains(t, desc, "depth 2, branching factor 2")
+
+	// the fastest conodes are the children of the root
+	require.Equal(t, 2, len(tree.Root.Children))
+	require.Equal(t, 6, tree.Root.Children[0].RosterIndex)
+	require.Equal(t, 5, tree.Root.Children[1].RosterIndex)
+
+	// the roster is not reordered
+	for _, n := range tree.List() {
+		require.True(t, n.ServerIdentity.Equal(r.List[n.RosterIndex]))
+	}
+
+	// small rosters use a flat tree
+	tree, _ = planTree(r, rtts, 0, nil)
+	require.Equal(t, 6, len(tree.Root.Children))
+
+	// the excluded conodes are left out without reordering the roster
+	excluded := map[string]bool{list[6].Public.String(): true, list[3].Public.String(): true}
+	tree, _ = planTree(r, rtts, 0, excluded)
+	require.Equal(t, 5, tree.Size())
+	require.Equal(t, 4, len(tree.Root.Children))
+	for _, n := range tree.List() {
+		require.False(t, excluded[n.ServerIdentity.Public.String()])
+		require.True(t, n.ServerIdentity.Equal(r.List[n.RosterIndex]))
+	}
+}
@@ -0,0 +1,145 @@
+package service
+
+/*
+The unchanged.go defines the deduplication of the saves. Before running the
+consensus on a page, the root compares the leaves of the page it fetches to
+the ones of the last snapshot of the page in the archive, see
+protocol.PageDigest. If they are identical, the conodes fetch the page in
+turn and sign a decenarch.Unchanged record if they find the same leaves. A
+record signed by a threshold of the conodes is stored in a block of its own
+instead of a duplicate of the snapshot. Otherwise, or if the request is
+forced, the page is archived as usual.
+*/
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/protocol"
+)
+
+// saveUnchanged stores an Unchanged record if the page of url did not change
+// since its last snapshot in the archive of the save, and returns the
+// response of the save. It returns nil if the page must be archived.
+func (s *Service) saveUnchanged(requestID string, req *decenarch.SaveRequest, tree *onet.Tree, url string) (*decenarch.SaveResponse, error) {
+	// the pages replayed from a template or rendered are not compared,
+	// the conodes would not fetch them as the consensus engines do, and a
+	// client asking for the transcript of the consensus needs one. The
+	// digest only covers the text leaves, fetched with the agreed headers.
+	if req.Force || req.Template != nil || req.Render || req.IncludeProof || req.Extractor != "" || len(req.Headers) > 0 {
+		return nil, nil
+	}
+	logger := s.logger(requestID)
+	ns := s.saves.get(requestID).namespace
+	setup := s.namespace(ns)
+	pageHash, digest, err := s.lastSnapshot(ns, req.Roster, url)
+	if err != nil || digest == nil {
+		return nil, err
+	}
+	// the root checks the page first, so that the conodes only fetch it
+	// again when it is likely unchanged
+	if err := s.checkFetched(ns, url, digest); err != nil {
+		logger.Lvl3("Page changed since its last snapshot", "reason", err)
+		return nil, nil
+	}
+
+	record := decenarch.Unchanged{
+		Url:       url,
+		PageHash:  pageHash,
+		Digest:    digest,
+		CheckTime: s.now().Unix(),
+	}
+	record.Timestamp = record.Time()
+	data, err := network.Marshal(&protocol.UnchangedVerificationData{
+		RequestID: requestID,
+		ConodeKey: s.ServerIdentity().Public.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if record.Sig, err = s.cosign(requestID, tree, protocol.NameSignUnchanged, record.Message(), data); err != nil {
+		return nil, err
+	}
+	record.Scheme, record.SignerKeys = s.signerKeys(requestID)
+	// the conodes that found the page changed refused to sign
+	if err := lib.VerifySignature(record.Scheme, tree.Roster.Publics(), record.SignerKeys, record.Message(), record.Sig.Signature, int(setup.Threshold)); err != nil {
+		logger.Lvl2("Page not endorsed as unchanged", "error", err)
+		return nil, nil
+	}
+
+	// the record is stored at once, it does not wait for the next block
+	blockID, err := s.storeBlock(requestID, req.Roster, &decenarch.Block{Unchanged: []decenarch.Unchanged{record}})
+	if err != nil {
+		return nil, err
+	}
+	logger.Lvl2("Page unchanged since its last snapshot", "url", url, "pageHash", record.PageHash)
+	return &decenarch.SaveResponse{
+		BlockID:   blockID,
+		Url:       url,
+		PageHash:  record.PageHash,
+		Sig:       record.Sig,
+		Timestamp: record.Time(),
+		Unchanged: true,
+	}, nil
+}
+
+// lastSnapshot returns the content hash of the last snapshot of url in the
+// archive of the namespace ns and the digest of its leaves, computed from its
+// content. The digest is nil if there is no snapshot whose leaves can be
+// compared.
+func (s *Service) lastSnapshot(ns string, r *onet.Roster, url string) (string, []byte, error) {
+	history, err := s.namespaceArchive(ns).History(s.namespace(ns).GenesisID, r, url)
+	if err != nil || len(history) == 0 || history[0].Extractor != "" {
+		return "", nil, err
+	}
+	content, err := base64.StdEncoding.DecodeString(history[0].Page)
+	if err != nil {
+		return "", nil, err
+	}
+	digest, err := protocol.ContentDigest(content)
+	if err != nil {
+		return "", nil, err
+	}
+	return lib.ContentHash(content), digest, nil
+}
+
+// unchangedCheck returns the protocol.UnchangedCheck of the conode for the
+// saves of the namespace ns on the roster r: the conode looks the last
+// snapshot up itself, instead of trusting the root, before fetching the page
+func (s *Service) unchangedCheck(ns string, r *onet.Roster) protocol.UnchangedCheck {
+	return func(url, pageHash string, digest []byte) error {
+		snapshotHash, snapshotDigest, err := s.lastSnapshot(ns, r, url)
+		if err != nil {
+			return err
+		}
+		if snapshotDigest == nil || snapshotHash != pageHash || !bytes.Equal(snapshotDigest, digest) {
+			return errors.New("the record does not match the last snapshot of the page")
+		}
+		return s.checkFetched(ns, url, digest)
+	}
+}
+
+// checkFetched returns an error if the page of url, fetched by the conode
+// with the headers of the namespace ns, does not have the leaves of digest
+// once its boilerplate is removed
+func (s *Service) checkFetched(ns, url string, digest []byte) error {
+	strip, err := lib.ParseSelectors(s.stripSelectors(url))
+	if err != nil {
+		return err
+	}
+	fetch := protocol.HeaderFetcher(s.fetcher(), s.sender(), s.fetchHeaders(ns, nil))
+	fresh, err := protocol.PageDigest(fetch, url, s.checkURL, s.conf().Limits.MaxResourceSize, strip)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(fresh, digest) {
+		return errors.New("the leaves of the page differ from its last snapshot")
+	}
+	return nil
+}
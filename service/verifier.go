@@ -0,0 +1,141 @@
+package service
+
+/*
+The verifier.go defines the background re-verification of the skipblocks
+stored by the conode. At every round, the conode samples some of the
+skipblocks of its own copy of the skipchain and verifies them again as a
+client would, see skip.SkipClient.Audit, so that the bit-rot or the tampering
+of its storage is detected before a client retrieves the pages. The failures
+are reported in the status of the conode and sent to the webhooks as
+EventBlockCorrupted.
+*/
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	skip "github.com/dedis/student_18_decenar/skip"
+
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/network"
+)
+
+// maxVerifyFailures is the number of failures kept in the status
+const maxVerifyFailures = 20
+
+// verifier keeps the outcome of the rounds of re-verification and the timer
+// of the next round
+type verifier struct {
+	sync.Mutex
+	status decenarch.VerificationStatus
+	timer  *time.Timer
+}
+
+// record adds the results of a round to the status, and returns the failures
+func (v *verifier) record(results []skip.AuditResult, now time.Time) []decenarch.BlockFailure {
+	v.Lock()
+	defer v.Unlock()
+	v.status.Rounds++
+	v.status.LastRound = now.Format(decenarch.StatTimeFormat)
+	var failures []decenarch.BlockFailure
+	for _, r := range results {
+		v.status.Checked++
+		if r.Err == nil {
+			continue
+		}
+		_, missing := r.Err.(*skip.MissingContentError)
+		if missing {
+			v.status.Unverifiable++
+		} else {
+			v.status.Corrupted++
+		}
+		failures = append(failures, decenarch.BlockFailure{
+			Index:   r.Index,
+			BlockID: r.BlockID,
+			Reason:  r.Err.Error(),
+			Missing: missing,
+			Time:    v.status.LastRound,
+		})
+	}
+	v.status.Failures = append(v.status.Failures, failures...)
+	if len(v.status.Failures) > maxVerifyFailures {
+		v.status.Failures = v.status.Failures[len(v.status.Failures)-maxVerifyFailures:]
+	}
+	return failures
+}
+
+// report returns a copy of the status
+func (v *verifier) report() *decenarch.VerificationStatus {
+	v.Lock()
+	defer v.Unlock()
+	status := v.status
+	status.Failures = append([]decenarch.BlockFailure(nil), v.status.Failures...)
+	return &status
+}
+
+// verificationStatus returns the status of the re-verification, nil if it
+// is disabled
+func (s *Service) verificationStatus() *decenarch.VerificationStatus {
+	if s.conf().Verify.Interval == 0 {
+		return nil
+	}
+	return s.verifier.report()
+}
+
+// scheduleVerification runs a round of re-verification after the interval
+// of the options, if it is enabled and no round is scheduled yet
+func (s *Service) scheduleVerification() {
+	interval := time.Duration(s.conf().Verify.Interval) * time.Minute
+	s.verifier.Lock()
+	defer s.verifier.Unlock()
+	if interval == 0 || s.verifier.timer != nil {
+		return
+	}
+	s.verifier.timer = time.AfterFunc(interval, func() {
+		s.verifier.Lock()
+		s.verifier.timer = nil
+		s.verifier.Unlock()
+		s.verifyArchive()
+		s.scheduleVerification()
+	})
+}
+
+// verifyArchive runs a round of re-verification of the skipblocks stored by
+// the conode, in the archives of all the namespaces
+func (s *Service) verifyArchive() {
+	for _, ns := range s.namespaces() {
+		s.verifyNamespace(ns)
+	}
+}
+
+// verifyNamespace re-verifies the skipblocks of the archive of the namespace
+// ns. Each skipblock is sampled with the probability giving Sample skipblocks
+// on average, computed from the index of the latest skipblock, which is the
+// first one the audit reaches.
+func (s *Service) verifyNamespace(ns string) {
+	genesisID := s.namespace(ns).GenesisID
+	sample := s.conf().Verify.Sample
+	if genesisID == nil || sample == 0 {
+		return
+	}
+	p := -1.0
+	selected := func(index int) bool {
+		if p < 0 {
+			p = float64(sample) / float64(index)
+		}
+		return rand.Float64() < p
+	}
+	self := onet.NewRoster([]*network.ServerIdentity{s.ServerIdentity()})
+	results, err := s.namespaceArchive(ns).Audit(genesisID, self, selected)
+	if err != nil {
+		log.Lvl2("Couldn't verify the stored skipblocks:", err)
+		return
+	}
+	for _, f := range s.verifier.record(results, s.now()) {
+		log.Error("Skipblock", f.Index, "of the archive failed its verification:", f.Reason)
+		s.notify(decenarch.Event{Type: decenarch.EventBlockCorrupted, BlockID: f.BlockID, Error: f.Reason})
+	}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	skip "github.com/dedis/student_18_decenar/skip"
+)
+
+func TestVerifierRecord(t *testing.T) {
+	s := &Service{config: DefaultConfig()}
+	require.Equal(t, 0, s.verificationStatus().Rounds)
+	now := time.Date(2018, time.June, 1, 12, 0, 0, 0, time.Local)
+
+	failures := s.verifier.record([]skip.AuditResult{
+		{Index: 3, BlockID: []byte{3}},
+		{Index: 2, BlockID: []byte{2}, Err: errors.New("invalid signature")},
+		{Index: 1, BlockID: []byte{1}, Err: &skip.MissingContentError{Url: "http://example.com", Err: errors.New("pruned")}},
+	}, now)
+	require.Equal(t, 2, len(failures))
+	require.False(t, failures[0].Missing)
+	require.True(t, failures[1].Missing)
+	require.Equal(t, now.Format(decenarch.StatTimeFormat), failures[0].Time)
+
+	status := s.verificationStatus()
+	require.Equal(t, 1, status.Rounds)
+	require.Equal(t, 3, status.Checked)
+	require.Equal(t, 1, status.Corrupted)
+	require.Equal(t, 1, status.Unverifiable)
+	require.Equal(t, failures, status.Failures)
+
+	// only the last failures are kept
+	for i := 0; i < maxVerifyFailures; i++ {
+		s.verifier.record([]skip.AuditResult{{Index: 10 + i, Err: errors.New("invalid signature")}}, now)
+	}
+	status = s.verificationStatus()
+	require.Equal(t, maxVerifyFailures, len(status.Failures))
+	require.Equal(t, 10, status.Failures[0].Index)
+	require.Equal(t, 1+maxVerifyFailures, status.Corrupted)
+
+	// the status is not reported when the verification is disabled
+	s.config.Verify.Interval = 0
+	require.Nil(t, s.verificationStatus())
+}
@@ -0,0 +1,196 @@
+package main
+
+/*
+The byzantine.go defines the Byzantine simulation, where a fraction of the
+conodes lie in the protocols with the Fault of the simulation, see
+protocol.Faults: WrongFilter, InvalidProof, RefuseSignature, CorruptPartials
+or All. The liars are the last conodes of the roster, the tree should be a
+star (BF equal to Hosts) so that each liar is a leaf and only its own
+contribution is rejected. At most a third of the conodes lie, so that the
+honest conodes reach the threshold.
+
+Each round saves the page served by the server of the process, see
+end_to_end.go, and checks that the save succeeded with the served page and
+that the detectable lies were detected: the rejected contributions are
+reported in the response of the save and the refusals are missing from the
+collective signature.
+*/
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/network"
+	"gopkg.in/dedis/onet.v2/simul/monitor"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/protocol"
+	"github.com/dedis/student_18_decenar/service"
+)
+
+func init() {
+	onet.SimulationRegister("Byzantine", NewByzantineSimulation)
+}
+
+// ByzantineSimulation holds the options of the simulation
+//    - Fraction is the fraction of the conodes that lie, at most a third
+//    - Fault is the lie of the conodes, see byzantine.go
+type ByzantineSimulation struct {
+	onet.SimulationBFTree
+	Fraction float64
+	Fault    string
+}
+
+// NewByzantineSimulation returns the simulation described by config
+func NewByzantineSimulation(config string) (onet.Simulation, error) {
+	s := &ByzantineSimulation{}
+	if _, err := toml.Decode(config, s); err != nil {
+		return nil, err
+	}
+	if _, err := s.faults(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Setup creates the roster and the tree of the simulation
+func (s *ByzantineSimulation) Setup(dir string, hosts []string) (*onet.SimulationConfig, error) {
+	sc := &onet.SimulationConfig{}
+	s.CreateRoster(sc, hosts, 2000)
+	if err := s.CreateTree(sc); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// faults returns the faults of the liars
+func (s *ByzantineSimulation) faults() (*protocol.Faults, error) {
+	switch s.Fault {
+	case "WrongFilter":
+		return &protocol.Faults{WrongFilter: true}, nil
+	case "InvalidProof":
+		return &protocol.Faults{InvalidProof: true}, nil
+	case "RefuseSignature":
+		return &protocol.Faults{RefuseSignature: true}, nil
+	case "CorruptPartials":
+		return &protocol.Faults{CorruptPartials: true}, nil
+	case "All":
+		return &protocol.Faults{WrongFilter: true, InvalidProof: true, RefuseSignature: true, CorruptPartials: true}, nil
+	}
+	return nil, fmt.Errorf("unknown fault %q", s.Fault)
+}
+
+// liars returns the conodes of the roster that lie
+func (s *ByzantineSimulation) liars(roster *onet.Roster) []*network.ServerIdentity {
+	n := len(roster.List)
+	count := int(s.Fraction * float64(n))
+	if max := (n - 1) / 3; count > max {
+		count = max
+	}
+	return roster.List[n-count:]
+}
+
+// Node makes the conode fetch the pages from the server of its process, and
+// lie if it is one of the liars
+func (s *ByzantineSimulation) Node(config *onet.SimulationConfig) error {
+	srv := config.GetService(decenarch.ServiceName).(*service.Service)
+	srv.UseFetcher(protocol.LocalFetcher(siteAddress()))
+	srv.UseSender(protocol.LocalSender(siteAddress()))
+	for _, si := range s.liars(config.Roster) {
+		if si.Equal(config.Server.ServerIdentity) {
+			faults, err := s.faults()
+			if err != nil {
+				return err
+			}
+			log.Lvl2("Conode", si.Address, "lies with", s.Fault)
+			srv.UseFaults(faults)
+		}
+	}
+	return s.SimulationBFTree.Node(config)
+}
+
+// Run saves the page once per round and checks that the lies were tolerated
+// and detected
+func (s *ByzantineSimulation) Run(config *onet.SimulationConfig) error {
+	roster := config.Roster
+	faults, err := s.faults()
+	if err != nil {
+		return err
+	}
+	liars := s.liars(roster)
+	log.Lvl1(len(liars), "conodes of", len(roster.List), "lie with", s.Fault)
+	expected, err := renderPage(sitePage)
+	if err != nil {
+		return err
+	}
+
+	client := decenarch.NewClient()
+	if _, err := client.Setup(roster); err != nil {
+		return err
+	}
+
+	for round := 0; round < s.Rounds; round++ {
+		log.Lvl1("Starting round", round)
+
+		m := monitor.NewTimeMeasure("save")
+		save, err := client.Save(roster, siteURL)
+		if err != nil {
+			return err
+		}
+		m.Record()
+
+		// the lies on the filters are below the threshold
+		if save.PageHash != lib.ContentHash(expected) {
+			return errors.New("saved page differs from the served page")
+		}
+
+		// the invalid proofs and partials are reported with signed
+		// evidence, which proves the misbehaviour
+		misbehaving := make(map[string]bool)
+		for _, e := range save.Evidence {
+			if err := protocol.VerifyEvidence(e, roster.Publics()); err != nil {
+				return err
+			}
+			misbehaving[e.Accused] = true
+		}
+		for k := range misbehaving {
+			if !isLiar(liars, k) {
+				return errors.New("honest conode reported as misbehaving: " + k)
+			}
+		}
+		if faults.InvalidProof && len(misbehaving) != len(liars) {
+			return fmt.Errorf("%d invalid proofs detected instead of %d", len(misbehaving), len(liars))
+		}
+		monitor.RecordSingleMeasure("misbehaving", float64(len(misbehaving)))
+
+		// the refusals are missing from the signature
+		mask, err := lib.SignerMask(roster.Publics(), save.Sig.Signature)
+		if err != nil {
+			return err
+		}
+		refused := len(roster.List) - mask.CountEnabled()
+		if faults.RefuseSignature {
+			for _, si := range liars {
+				if enabled, err := mask.KeyEnabled(si.Public); err != nil || enabled {
+					return errors.New("liar signed the page: " + si.Address.String())
+				}
+			}
+		}
+		monitor.RecordSingleMeasure("refused", float64(refused))
+	}
+	return nil
+}
+
+// isLiar tells if the public key k is the one of a liar
+func isLiar(liars []*network.ServerIdentity, k string) bool {
+	for _, si := range liars {
+		if si.Public.String() == k {
+			return true
+		}
+	}
+	return false
+}
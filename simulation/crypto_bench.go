@@ -0,0 +1,119 @@
+package main
+
+/*
+The crypto_bench.go defines the CryptoBench simulation, measuring the
+cryptographic operations of a save with the CBF engine for the filters of
+FilterSize buckets, in a cothority of the size of the roster. The operations
+run on the root only, one measure per operation and per round, so that the
+durations can be compared from one commit to the next.
+*/
+
+import (
+	"github.com/BurntSushi/toml"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/share"
+	"gopkg.in/dedis/kyber.v2/util/random"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/simul/monitor"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func init() {
+	onet.SimulationRegister("CryptoBench", NewCryptoBenchSimulation)
+}
+
+// CryptoBenchSimulation holds the options of the simulation
+//    - FilterSize is the number of buckets of the filters
+type CryptoBenchSimulation struct {
+	onet.SimulationBFTree
+	FilterSize int
+}
+
+// NewCryptoBenchSimulation returns the simulation described by config
+func NewCryptoBenchSimulation(config string) (onet.Simulation, error) {
+	s := &CryptoBenchSimulation{}
+	if _, err := toml.Decode(config, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Setup creates the roster and the tree of the simulation
+func (s *CryptoBenchSimulation) Setup(dir string, hosts []string) (*onet.SimulationConfig, error) {
+	sc := &onet.SimulationConfig{}
+	s.CreateRoster(sc, hosts, 2000)
+	if err := s.CreateTree(sc); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// Run measures the operations of a save on the root
+func (s *CryptoBenchSimulation) Run(config *onet.SimulationConfig) error {
+	nodes := len(config.Roster.List)
+	threshold := decenarch.Threshold(nodes)
+	log.Lvl2("Measuring filters of", s.FilterSize, "buckets for", nodes, "conodes")
+
+	secret := decenarch.Suite.Scalar().Pick(random.New())
+	shares := share.NewPriPoly(decenarch.Suite, threshold, secret, random.New()).Shares(nodes)
+	public := decenarch.Suite.Point().Mul(secret, nil)
+	set := make([]int64, s.FilterSize)
+	for i := 0; i < len(set); i += 10 {
+		set[i] = 1
+	}
+
+	for round := 0; round < s.Rounds; round++ {
+		log.Lvl1("Starting round", round)
+
+		m := monitor.NewTimeMeasure("encrypt")
+		encrypted, proof := lib.EncryptIntVector(public, set)
+		m.Record()
+
+		pool := lib.NewZeroPool(public)
+		pool.Fill(len(set))
+		m = monitor.NewTimeMeasure("encrypt_pool")
+		lib.EncryptIntVectorPool(pool, public, set)
+		m.Record()
+
+		m = monitor.NewTimeMeasure("verify_proof")
+		if !proof.VerifyCipherVectorProof(encrypted) {
+			log.Error("Invalid proof of the filter")
+		}
+		m.Record()
+
+		m = monitor.NewTimeMeasure("pack")
+		var unpacked lib.CipherVector
+		if err := unpacked.Unpack(encrypted.Pack()); err != nil {
+			return err
+		}
+		m.Record()
+
+		// each conode adds the same filter
+		m = monitor.NewTimeMeasure("aggregate")
+		aggregation := lib.NewCipherVector(len(set))
+		for i := 0; i < nodes; i++ {
+			aggregation.Add(*aggregation, unpacked)
+		}
+		m.Record()
+
+		m = monitor.NewTimeMeasure("partial_decrypt")
+		partials := make(map[int][]kyber.Point)
+		for _, sh := range shares[:threshold] {
+			partials[sh.I] = make([]kyber.Point, len(*aggregation))
+			for i, c := range *aggregation {
+				partials[sh.I][i] = lib.DecryptPoint(sh.V, c)
+			}
+		}
+		m.Record()
+
+		m = monitor.NewTimeMeasure("reconstruct")
+		if _, err := lib.ReconstructVectorFromPartials(nodes, threshold, partials); err != nil {
+			return err
+		}
+		m.Record()
+	}
+	return nil
+}
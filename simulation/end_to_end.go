@@ -0,0 +1,210 @@
+package main
+
+/*
+The end_to_end.go defines the EndToEnd simulation, running the whole life of
+a page on the cothority of the roster: the root sets up the archive, then
+each round saves a page with a style sheet and an image, flushes the block,
+retrieves the page at the current time, verifies the signatures and compares
+the retrieved page with the served one. The pages are served by a server
+started in each process of the simulation, so that no site on the web is
+needed.
+*/
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/net/html"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/simul/monitor"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/protocol"
+	"github.com/dedis/student_18_decenar/service"
+)
+
+func init() {
+	onet.SimulationRegister("EndToEnd", NewEndToEndSimulation)
+}
+
+// siteURL is the url of the saved page, whatever the address of the server
+const siteURL = "http://example.com/site/index.html"
+
+// sitePage is the saved page, referencing its style sheet and its image
+const sitePage = `<html><head><title>decenarch</title>
+<link rel="stylesheet" href="style.css"></head><body>
+<h1>Decentralized archive</h1><img src="/images/logo.png">
+<p>The conodes agree on the page and on its resources.</p>
+</body></html>`
+
+// siteResources are the content types and the contents served by path
+var siteResources = map[string][2]string{
+	"/site/index.html": {"text/html; charset=utf-8", sitePage},
+	"/site/style.css":  {"text/css", "h1 { color: navy; }\n"},
+	"/images/logo.png": {"image/png", "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"},
+}
+
+var (
+	site     *httptest.Server
+	siteOnce sync.Once
+)
+
+// siteAddress returns the address of the server of the process, started on
+// the first call
+func siteAddress() string {
+	siteOnce.Do(func() {
+		mux := http.NewServeMux()
+		for path, res := range siteResources {
+			res := res
+			mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", res[0])
+				w.Write([]byte(res[1]))
+			})
+		}
+		site = httptest.NewServer(mux)
+	})
+	return site.Listener.Addr().String()
+}
+
+// EndToEndSimulation holds the options of the simulation
+//    - BlockInterval is the block interval given at setup, the blocks are
+//      flushed by the simulation anyway
+type EndToEndSimulation struct {
+	onet.SimulationBFTree
+	BlockInterval int64
+}
+
+// NewEndToEndSimulation returns the simulation described by config
+func NewEndToEndSimulation(config string) (onet.Simulation, error) {
+	s := &EndToEndSimulation{BlockInterval: 3600}
+	if _, err := toml.Decode(config, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Setup creates the roster and the tree of the simulation
+func (s *EndToEndSimulation) Setup(dir string, hosts []string) (*onet.SimulationConfig, error) {
+	sc := &onet.SimulationConfig{}
+	s.CreateRoster(sc, hosts, 2000)
+	if err := s.CreateTree(sc); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// Node makes the conode fetch the pages from the server of its process
+func (s *EndToEndSimulation) Node(config *onet.SimulationConfig) error {
+	srv := config.GetService(decenarch.ServiceName).(*service.Service)
+	srv.UseFetcher(protocol.LocalFetcher(siteAddress()))
+	srv.UseSender(protocol.LocalSender(siteAddress()))
+	return s.SimulationBFTree.Node(config)
+}
+
+// Run saves, stores and retrieves the page once per round
+func (s *EndToEndSimulation) Run(config *onet.SimulationConfig) error {
+	roster := config.Roster
+	threshold := decenarch.Threshold(len(roster.List))
+	expected, err := renderPage(sitePage)
+	if err != nil {
+		return err
+	}
+
+	client := decenarch.NewClient()
+	client.BlockInterval = s.BlockInterval
+	m := monitor.NewTimeMeasure("setup")
+	if _, err := client.Setup(roster); err != nil {
+		return err
+	}
+	m.Record()
+
+	for round := 0; round < s.Rounds; round++ {
+		log.Lvl1("Starting round", round)
+
+		m = monitor.NewTimeMeasure("save")
+		save, err := client.Save(roster, siteURL)
+		if err != nil {
+			return err
+		}
+		m.Record()
+		if len(save.Adds) != 2 {
+			return fmt.Errorf("%d resources saved instead of 2", len(save.Adds))
+		}
+
+		m = monitor.NewTimeMeasure("flush")
+		if _, err := client.Flush(roster); err != nil {
+			return err
+		}
+		m.Record()
+
+		m = monitor.NewTimeMeasure("retrieve")
+		resp, err := client.Retrieve(roster, siteURL, "")
+		if err != nil {
+			return err
+		}
+		m.Record()
+
+		// the conode verified the signatures, the client checks them
+		// again before comparing the content
+		m = monitor.NewTimeMeasure("verify")
+		page, err := verifiedContent(roster, resp.Main, threshold)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(expected, page) {
+			return errors.New("retrieved page differs from the served page")
+		}
+		if len(resp.Adds) != len(save.Adds) {
+			return fmt.Errorf("%d resources retrieved instead of %d", len(resp.Adds), len(save.Adds))
+		}
+		for _, add := range resp.Adds {
+			content, err := verifiedContent(roster, add, threshold)
+			if err != nil {
+				return err
+			}
+			if res := siteResources[add.Url[len("http://example.com"):]]; string(content) != res[1] {
+				return errors.New("retrieved resource differs from the served one: " + add.Url)
+			}
+		}
+		m.Record()
+	}
+	return nil
+}
+
+// verifiedContent returns the content of the page once its signature by the
+// roster is verified
+func verifiedContent(roster *onet.Roster, page decenarch.Webstore, threshold int) ([]byte, error) {
+	content, err := base64.StdEncoding.DecodeString(page.Page)
+	if err != nil {
+		return nil, err
+	}
+	if page.Sig == nil {
+		return nil, errors.New("page is not signed: " + page.Url)
+	}
+	if err := lib.VerifySignature(page.Scheme, roster.Publics(), page.SignerKeys, content, page.Sig.Signature, threshold); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// renderPage returns the page as rendered by the conodes when they all agree
+// on its content
+func renderPage(page string) ([]byte, error) {
+	doc, err := html.Parse(bytes.NewBufferString(page))
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := html.Render(&b, doc); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
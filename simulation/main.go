@@ -0,0 +1,18 @@
+/*
+The simulation package runs the simulations of decenarch with the simul
+framework of onet, e.g.
+
+    go build && ./simulation crypto_bench.toml
+
+Each simulation is described by its .toml file, whose Simulation field names
+the simulation registered in this package.
+*/
+package main
+
+import (
+	"gopkg.in/dedis/onet.v2/simul"
+)
+
+func main() {
+	simul.Start()
+}
@@ -1,11 +1,11 @@
 package decenarch
 
 /*
-The skipapi.go defines the methods that can be called from the outside. Most
-of the methods will take a roster so that the service knows which nodes
-it should work with.
-
-This part of the service runs on the client or the app.
+The api.go defines the methods used to store and retrieve the archive in the
+skipchain. The blocks are handled by the skipchain service of cothority.v2,
+there is no dedicated skipchain service for the archive. Most of the methods
+will take a roster so that the skipchain service knows which nodes it should
+work with.
 */
 
 import (
@@ -16,63 +16,121 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"time"
 
-	ftcosiprotocol "gopkg.in/dedis/cothority.v2/ftcosi/protocol"
 	"gopkg.in/dedis/cothority.v2/skipchain"
 	"gopkg.in/dedis/kyber.v2/sign/cosi"
 	"gopkg.in/dedis/onet.v2"
 	"gopkg.in/dedis/onet.v2/log"
+	"gopkg.in/dedis/onet.v2/network"
 
 	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
 )
 
-// ServiceName is used for registration on the onet.
-const SkipServiceName = "Decenskip"
+// Archive is the client of the skipchain storing the archive, used by the
+// service and the command line interface. The pages and the blocks are always
+// collectively signed, the implementations check the signatures.
+type Archive interface {
+	// Start creates the genesis block of the archive
+	Start(r *onet.Roster) (*skipchain.SkipBlock, error)
+	// AddData stores a block in the archive
+	AddData(genesisID skipchain.SkipBlockID, r *onet.Roster, block *decenarch.Block) (*skipchain.StoreSkipBlockReply, error)
+	// GetData returns the page saved for the url at the given time
+	GetData(latestID skipchain.SkipBlockID, r *onet.Roster, url string, timeString string) (*SkipGetDataResponse, error)
+	// History returns all the saved versions of the url, newest first
+	History(genesisID skipchain.SkipBlockID, r *onet.Roster, url string) ([]decenarch.Webstore, error)
+	// ListVariants returns the variants of the url, i.e. the saved urls
+	// differing from it only by their query, see Variant
+	ListVariants(genesisID skipchain.SkipBlockID, r *onet.Roster, url string) ([]Variant, error)
+	// Proof returns the inclusion proof of a skipblock, see VerifyProof
+	Proof(genesisID skipchain.SkipBlockID, r *onet.Roster, blockID skipchain.SkipBlockID) ([][]byte, error)
+	// Audit verifies again the sampled skipblocks, see AuditResult
+	Audit(genesisID skipchain.SkipBlockID, r *onet.Roster, sample func(index int) bool) ([]AuditResult, error)
+	// Versions returns all the saved versions of the url with the
+	// skipblock storing them, oldest first
+	Versions(genesisID skipchain.SkipBlockID, r *onet.Roster, url string) ([]Version, error)
+	// Timeline verifies the signature and the inclusion proof of all the
+	// saved versions of the url, oldest first, see TimelineEntry
+	Timeline(genesisID skipchain.SkipBlockID, r *onet.Roster, url string) ([]TimelineEntry, error)
+	// Stats returns the statistics of the changes of the page of the url,
+	// see decenarch.ChangeStats
+	Stats(genesisID skipchain.SkipBlockID, r *onet.Roster, url string) (*decenarch.ChangeStats, error)
+}
 
-// SkipClient is a structure to communicate with the Decenskip
-// service
+// SkipClient is the Archive using the skipchain service. If Tier or IPFS is
+// not nil, the content of the pages is stored in Tier or pinned on IPFS, and
+// the skipchain only keeps their content hash and CID. Get fetches the urls
+// given to GetData to find the url they were saved with, http.Get is used if
+// it is nil. Normalize gives the canonical form of the urls compared by
+// GetData and History, see lib.URLNormalizer, lib.NormalizeURL is used if it
+// is nil. UnsignedBefore is the index of the first skipblock whose content
+// must be signed: the blocks stored before the signature of the blocks are
+// only accepted without signature below it, and zero, for the archives
+// created with signed blocks, requires the signature of every block.
 type SkipClient struct {
 	*skipchain.Client
-	Policy *cosi.ThresholdPolicy
+	Policy         *cosi.ThresholdPolicy
+	Tier           lib.Tier
+	IPFS           *lib.IPFS
+	Get            func(url string) (*http.Response, error)
+	Normalize      func(url string) string
+	UnsignedBefore int
 }
 
-// NewClient instantiates a new decenarch.Client
+// NewSkipClient instantiates a new SkipClient checking the signatures with
+// the given threshold
 func NewSkipClient(threshold int) *SkipClient {
 	return &SkipClient{Client: skipchain.NewClient(), Policy: cosi.NewThresholdPolicy(threshold)}
 }
 
-// SkipStart starts the infinite skipblocks creations loop on all the conodes.
-func (c *SkipClient) SkipStart(r *onet.Roster) (*skipchain.SkipBlock, error) {
+// normalize returns the canonical form of url, or url itself if it is not an
+// absolute URL
+func (c *SkipClient) normalize(url string) string {
+	if c.Normalize != nil {
+		return c.Normalize(url)
+	}
+	normalized, err := lib.NormalizeURL(url)
+	if err != nil {
+		return url
+	}
+	return normalized
+}
+
+// Start creates the genesis block of the archive on all the conodes
+func (c *SkipClient) Start(r *onet.Roster) (*skipchain.SkipBlock, error) {
 	log.Lvl1("SkipStart")
 	return c.CreateGenesis(r, 2, 2, skipchain.VerificationStandard, nil, nil)
 }
 
-// SkipAddData allows to add data to the next block that will be created by the conode.
-func (c *SkipClient) SkipAddData(genesisID skipchain.SkipBlockID, r *onet.Roster, data []decenarch.Webstore) (*skipchain.StoreSkipBlockReply, error) {
+// AddData allows to add a block to the skipchain. The pages and the block
+// itself must be collectively signed by the roster.
+func (c *SkipClient) AddData(genesisID skipchain.SkipBlockID, r *onet.Roster, block *decenarch.Block) (*skipchain.StoreSkipBlockReply, error) {
 	log.Lvl1("SkipAddData")
 
-	// verify signatures of all the pages before adding the data to the
-	// skipchain
-	for _, d := range data {
-		bd, err := base64.StdEncoding.DecodeString(d.Page)
-		if err != nil {
+	// verify signatures of all the pages and of the block before adding
+	// the data to the skipchain
+	for _, d := range block.Pages {
+		if err := c.verifyPage(r, d); err != nil {
 			return nil, err
 		}
-		vsErr := cosi.Verify(
-			ftcosiprotocol.EdDSACompatibleCosiSuite,
-			r.Publics(),
-			bd,
-			d.Sig.Signature,
-			c.Policy)
-		if vsErr != nil {
-			return nil, vsErr
+	}
+	if err := c.verifyBlock(r, block); err != nil {
+		return nil, err
+	}
+
+	// keep the content of the pages out of the skipchain
+	if c.Tier != nil || c.IPFS != nil {
+		var err error
+		if block, err = CompactBlock(block, c.Tier, c.IPFS); err != nil {
+			return nil, err
 		}
 	}
 
 	// marshal data
-	dataBytes, err := webstoreExtractAndConvert(data)
+	dataBytes, err := webstoreExtractAndConvert(block)
 	if err != nil {
 		return nil, err
 	}
@@ -101,19 +159,23 @@ func (c *SkipClient) SkipAddData(genesisID skipchain.SkipBlockID, r *onet.Roster
 	return c.StoreSkipBlock(genesis, r, b.Bytes())
 }
 
-// SkipGetData allow to get the data related to the url at the time given that
+// GetData allow to get the data related to the url at the time given that
 // were stored on the skipchain. Time format is "2006/01/02 15:04". url must
-// be given with scheme.
-func (c *SkipClient) SkipGetData(latestID skipchain.SkipBlockID, r *onet.Roster, url string, timeString string) (*SkipGetDataResponse, error) {
+// be given with scheme. The blocks whose content was pruned are skipped.
+func (c *SkipClient) GetData(latestID skipchain.SkipBlockID, r *onet.Roster, url string, timeString string) (*SkipGetDataResponse, error) {
 	// get real url, since the page is stored with the real url and if we
 	// don't use it we risk to miss the block because of a missing slash o
 	// a redirect
-	getResp, err := http.Get(url)
+	get := c.Get
+	if get == nil {
+		get = http.Get
+	}
+	getResp, err := get(url)
 	if err != nil {
 		return nil, err
 	}
 	defer getResp.Body.Close()
-	realUrl := getResp.Request.URL.String()
+	realUrl := c.normalize(getResp.Request.URL.String())
 
 	// parse timestamp
 	tReq, err := time.Parse("2006/01/02 15:04", timeString)
@@ -122,7 +184,10 @@ func (c *SkipClient) SkipGetData(latestID skipchain.SkipBlockID, r *onet.Roster,
 	}
 
 	// get latest block
-	block, err := c.GetSingleBlock(r, latestID)
+	block, err := c.singleBlock(r, latestID)
+	if err != nil {
+		return nil, err
+	}
 
 	// iterate until we find the right block
 	notFound := true
@@ -133,41 +198,41 @@ func (c *SkipClient) SkipGetData(latestID skipchain.SkipBlockID, r *onet.Roster,
 		// that we tested all the possible blocks and we don't have the
 		// website
 		if block.Index == 0 {
-			return nil, errors.New("Could not find block in skipcain")
+			return nil, decenarch.ErrBlockNotFound
 		}
 
 		log.Lvl4("Test with block:", block)
 
-		// decompress data stored in block
-		rData := bytes.NewReader(block.Data)
-		rz, err := gzip.NewReader(rData)
+		// test if data contains the correct (url,timestamp) couple. The
+		// pages are verified against the roster of the skipblock, the
+		// conodes of r are only asked for the blocks
+		stored, err := c.readableContent(block)
 		if err != nil {
 			return nil, err
 		}
-		decompressedData, err := ioutil.ReadAll(rz)
-		if err != nil {
-			return nil, err
-		}
-
-		// test if data contains the correct (url,timestamp) couple
-		webs, err := webstoreCompleteFromBytes(decompressedData)
+		webs, signers, err := blockPages(block.Roster, stored)
 		if err != nil {
 			return nil, err
 		}
-		log.Lvl4("WE HAVE", webs)
+		log.Lvl4("Pages of block", block.Index, ":", len(webs))
 
 		// iterate over the webpages present in the block to look for
 		// the given url
 		for _, webpage := range webs {
 			tBlock, err := time.Parse("2006/01/02 15:04", webpage.Timestamp)
 			if err != nil {
-				fmt.Println("Nel parsing")
+				log.Lvl2("Invalid timestamp of page", webpage.Url, "in block", block.Index, ":", err)
 				return nil, err
 			}
-			if webpage.Url == realUrl && (tReq.Equal(tBlock) || tReq.After(tBlock)) {
+			if c.normalize(webpage.Url) == realUrl && (tReq.Equal(tBlock) || tReq.After(tBlock)) {
 				finalResp := SkipGetDataResponse{
 					MainPage: webpage,
 					AllPages: webs,
+					Signers:  signers,
+					Block:    block.Hash,
+				}
+				if stored.Mirror != nil {
+					finalResp.Origin = stored.Mirror.Origin
 				}
 				notFound = true
 				return &finalResp, nil
@@ -176,38 +241,267 @@ func (c *SkipClient) SkipGetData(latestID skipchain.SkipBlockID, r *onet.Roster,
 		}
 
 		// go to previous block
-		block, err = c.GetSingleBlock(r, block.BackLinkIDs[0])
+		index := block.Index
+		block, err = c.singleBlock(r, block.BackLinkIDs[0])
+		if err != nil {
+			log.Lvl2("Couldn't get the block before block", index, ":", err)
+			return nil, err
+		}
+
+	}
+
+	return nil, decenarch.ErrBlockNotFound
+}
+
+// History returns all the versions of the url saved in the skipchain, newest
+// first. The url is compared in its canonical form, without following
+// redirections.
+func (c *SkipClient) History(genesisID skipchain.SkipBlockID, r *onet.Roster, url string) ([]decenarch.Webstore, error) {
+	url = c.normalize(url)
+	return c.matchingPages(genesisID, r, func(u string) bool {
+		return c.normalize(u) == url
+	})
+}
+
+// matchingPages returns the pages of the archive whose url matches, newest
+// first. The pages whose signature is invalid and the blocks whose content was
+// pruned are skipped.
+func (c *SkipClient) matchingPages(genesisID skipchain.SkipBlockID, r *onet.Roster, match func(url string) bool) ([]decenarch.Webstore, error) {
+	// get latest block
+	block, err := c.latestBlock(r, genesisID)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := make([]decenarch.Webstore, 0)
+	for block.Index > 0 {
+		stored, err := c.readableContent(block)
+		if err != nil {
+			return nil, err
+		}
+		pages, _, err := blockPages(block.Roster, stored)
+		if err != nil {
+			log.Lvl1("Skipping invalid mirrored block:", err)
+			pages = nil
+		}
+		for i := len(pages) - 1; i >= 0; i-- {
+			if !match(pages[i].Url) {
+				continue
+			}
+			if stored.Mirror == nil {
+				if err := c.verifyPage(block.Roster, pages[i]); err != nil {
+					log.Lvl1("Skipping page with an invalid signature:", err)
+					continue
+				}
+			}
+			matching = append(matching, pages[i])
+		}
+		block, err = c.singleBlock(r, block.BackLinkIDs[0])
 		if err != nil {
-			fmt.Printf("Nel previsou")
 			return nil, err
 		}
+	}
+	return matching, nil
+}
 
+// Chain returns all the skipblocks of the archive, oldest first, the genesis
+// block excluded
+func (c *SkipClient) Chain(genesisID skipchain.SkipBlockID, r *onet.Roster) ([]*skipchain.SkipBlock, error) {
+	block, err := c.latestBlock(r, genesisID)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, errors.New("Could not find block in skipchain")
+	chain := make([]*skipchain.SkipBlock, block.Index)
+	for block.Index > 0 {
+		chain[block.Index-1] = block
+		block, err = c.singleBlock(r, block.BackLinkIDs[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return chain, nil
 }
 
-// webstoreExtractAndConvert takes an array of Webstore and do three things:
+// Genesis returns the genesis block genesisID of the skipchain of the roster
+func (c *SkipClient) Genesis(r *onet.Roster, genesisID skipchain.SkipBlockID) (*skipchain.SkipBlock, error) {
+	block, err := c.singleBlock(r, genesisID)
+	if err != nil {
+		return nil, err
+	}
+	if block.Index != 0 {
+		return nil, errors.New("skipblock is not a genesis block")
+	}
+	return block, nil
+}
+
+// singleBlock returns the skipblock id, asking the conodes of the roster in a
+// random order until one of them returns it, so that the blocks can be read
+// while some conodes are offline
+func (c *SkipClient) singleBlock(r *onet.Roster, id skipchain.SkipBlockID) (*skipchain.SkipBlock, error) {
+	err := errors.New("empty roster")
+	for _, i := range rand.Perm(len(r.List)) {
+		var block *skipchain.SkipBlock
+		block, err = c.GetSingleBlock(onet.NewRoster([]*network.ServerIdentity{r.List[i]}), id)
+		if err == nil && !block.CalculateHash().Equal(id) {
+			err = errors.New("returned block does not match its ID")
+		}
+		if err == nil {
+			return block, nil
+		}
+		log.Lvl2("Conode", r.List[i].Address, "could not return the block:", err)
+	}
+	return nil, err
+}
+
+// latestBlock returns the latest skipblock of the skipchain, asking the
+// conodes of the roster in a random order until one of them returns it
+func (c *SkipClient) latestBlock(r *onet.Roster, genesisID skipchain.SkipBlockID) (*skipchain.SkipBlock, error) {
+	err := errors.New("empty roster")
+	for _, i := range rand.Perm(len(r.List)) {
+		var update *skipchain.GetUpdateChainReply
+		update, err = c.GetUpdateChain(onet.NewRoster([]*network.ServerIdentity{r.List[i]}), genesisID)
+		if err == nil && len(update.Update) == 0 {
+			err = errors.New("Could not find genesis block in skipchain")
+		}
+		if err == nil {
+			return update.Update[len(update.Update)-1], nil
+		}
+		log.Lvl2("Conode", r.List[i].Address, "could not return the skipchain:", err)
+	}
+	return nil, err
+}
+
+// BlockContent decompresses the content of the skipblock and checks the
+// signature of the block. The blocks stored before the signature of the
+// blocks have no signature and are only accepted below UnsignedBefore, their
+// pages are still verified by the callers.
+func (c *SkipClient) BlockContent(r *onet.Roster, block *skipchain.SkipBlock) (*decenarch.Block, error) {
+	stored, err := storedBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	if err := expandBlock(stored, c.Tier, c.IPFS); err != nil {
+		return nil, err
+	}
+	if stored.Sig == nil && block.Index < c.UnsignedBefore {
+		return stored, nil
+	}
+	if err := c.verifyBlock(r, stored); err != nil {
+		return nil, fmt.Errorf("skipblock %d: %v", block.Index, err)
+	}
+	return stored, nil
+}
+
+// readableContent returns the content of the skipblock, see BlockContent, or
+// an empty block if the content of its pages was pruned from the storage
+// tiers, so that the searches skip it
+func (c *SkipClient) readableContent(block *skipchain.SkipBlock) (*decenarch.Block, error) {
+	stored, err := c.BlockContent(block.Roster, block)
+	if _, pruned := err.(*MissingContentError); pruned {
+		log.Lvl2("Skipping block", block.Index, "whose content was pruned:", err)
+		return &decenarch.Block{}, nil
+	}
+	return stored, err
+}
+
+// blockPages returns the pages of the block and the roster that signed them,
+// i.e. r, or the roster of the mirrored skipblock for a mirrored block, whose
+// pages are then already verified
+func blockPages(r *onet.Roster, block *decenarch.Block) ([]decenarch.Webstore, *onet.Roster, error) {
+	if block.Mirror == nil {
+		return block.Pages, r, nil
+	}
+	sb, err := VerifyMirror(block.Mirror)
+	if err != nil {
+		return nil, nil, err
+	}
+	return block.Mirror.Block.Pages, sb.Roster, nil
+}
+
+// storedBlock decompresses the content of the skipblock
+func storedBlock(block *skipchain.SkipBlock) (*decenarch.Block, error) {
+	rz, err := gzip.NewReader(bytes.NewReader(block.Data))
+	if err != nil {
+		return nil, err
+	}
+	decompressedData, err := ioutil.ReadAll(rz)
+	if err != nil {
+		return nil, err
+	}
+	return webstoreCompleteFromBytes(decompressedData)
+}
+
+// verifyPage returns an error if the page is not collectively signed by the
+// roster, with the signature scheme of the page
+func (c *SkipClient) verifyPage(r *onet.Roster, page decenarch.Webstore) error {
+	if page.Sig == nil {
+		return fmt.Errorf("page %s is not signed", page.Url)
+	}
+	b, err := base64.StdEncoding.DecodeString(page.Page)
+	if err != nil {
+		return err
+	}
+	if page.Scheme == decenarch.SchemeBLS {
+		return lib.VerifyBLS(r.Publics(), page.SignerKeys, b, page.Sig.Signature, c.Policy)
+	}
+	return cosi.Verify(
+		decenarch.CosiSuite,
+		r.Publics(),
+		b,
+		page.Sig.Signature,
+		c.Policy)
+}
+
+// verifyBlock returns an error if the block is not collectively signed by the
+// roster, with the signature scheme of the block
+func (c *SkipClient) verifyBlock(r *onet.Roster, block *decenarch.Block) error {
+	if block.Sig == nil {
+		return errors.New("block is not signed")
+	}
+	payload, err := block.Payload()
+	if err != nil {
+		return err
+	}
+	if block.Scheme == decenarch.SchemeBLS {
+		return lib.VerifyBLS(r.Publics(), block.SignerKeys, payload, block.Sig.Signature, c.Policy)
+	}
+	return cosi.Verify(
+		decenarch.CosiSuite,
+		r.Publics(),
+		payload,
+		block.Sig.Signature,
+		c.Policy)
+}
+
+// webstoreExtractAndConvert takes a block and do three things:
 //    1 extract the useful subset of the data contained in the Webstore
 //      to be stored in the skipchain
 //    2 convert the extracted data into a []byte format or any format
 //      understood by the skipchain API
 //    3 if the subset is not all the set, store the Webstore on disk
-func webstoreExtractAndConvert(webarray []decenarch.Webstore) ([]byte, error) {
+func webstoreExtractAndConvert(block *decenarch.Block) ([]byte, error) {
 	log.Lvl4("extract and convert webstore")
-	b, err := json.Marshal(webarray)
+	b, err := json.Marshal(block)
 	return b, err
 }
 
-// webstoreCompleteFromBytes reconstructs the webpage and its external
-// resources from the bytes stored in a skipblock
-func webstoreCompleteFromBytes(data []byte) ([]decenarch.Webstore, error) {
+// webstoreCompleteFromBytes reconstructs the block, i.e. the webpage and its
+// external resources, from the bytes stored in a skipblock. The blocks stored
+// before the signature of the blocks only contain the list of pages.
+func webstoreCompleteFromBytes(data []byte) (*decenarch.Block, error) {
 	log.Lvl4("unmarshal webstore - begin")
-	var webs []decenarch.Webstore = make([]decenarch.Webstore, 0)
-	err := json.Unmarshal(data, &webs)
-	if err != nil {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var webs []decenarch.Webstore = make([]decenarch.Webstore, 0)
+		if err := json.Unmarshal(data, &webs); err != nil {
+			return nil, err
+		}
+		return &decenarch.Block{Pages: webs}, nil
+	}
+	block := &decenarch.Block{}
+	if err := json.Unmarshal(data, block); err != nil {
 		return nil, err
 	}
 	log.Lvl4("unmarshal webstore - success")
-	return webs, nil
+	return block, nil
 }
@@ -0,0 +1,35 @@
+package decenarch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestWebstoreCompleteFromBytes(t *testing.T) {
+	var _ Archive = NewSkipClient(1)
+
+	pages := []decenarch.Webstore{{Url: "http://example.com"}, {Url: "http://example.com/a.png"}}
+
+	// blocks stored before the signature of the blocks
+	legacy, err := json.Marshal(pages)
+	require.NoError(t, err)
+	block, err := webstoreCompleteFromBytes(legacy)
+	require.NoError(t, err)
+	require.Equal(t, pages, block.Pages)
+	require.Nil(t, block.Sig)
+
+	// signed blocks
+	data, err := webstoreExtractAndConvert(&decenarch.Block{Pages: pages, Timestamp: "2018/06/01 10:00:00.0000"})
+	require.NoError(t, err)
+	block, err = webstoreCompleteFromBytes(data)
+	require.NoError(t, err)
+	require.Equal(t, pages, block.Pages)
+	require.Equal(t, "2018/06/01 10:00:00.0000", block.Timestamp)
+
+	_, err = webstoreCompleteFromBytes([]byte("{"))
+	require.Error(t, err)
+}
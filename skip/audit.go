@@ -0,0 +1,82 @@
+package decenarch
+
+/*
+The audit.go defines the re-verification of the skipblocks stored by a
+conode, run in the background by the service to detect the bit-rot or the
+tampering of its storage. A skipblock is audited as a client would verify it:
+its hash, the collective signatures of its content and of its pages, and its
+inclusion proof from the genesis block are checked again.
+*/
+
+import (
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/onet.v2"
+)
+
+// AuditResult is the outcome of the audit of a skipblock
+//    - Index and BlockID identify the skipblock
+//    - Err is nil if the skipblock is valid. It is a MissingContentError if
+//      the content of a page cannot be found, the skipblock is then
+//      unverifiable rather than corrupted
+type AuditResult struct {
+	Index   int
+	BlockID skipchain.SkipBlockID
+	Err     error
+}
+
+// Audit audits the skipblocks of the archive whose index is selected by
+// sample, the genesis block excluded, the latest index first. The skipchain
+// is read from the conodes of r, e.g. only the audited conode, and only the
+// skipblocks linking the genesis block to the sampled ones are fetched. A
+// sampled skipblock that cannot be reached is reported without its ID.
+func (c *SkipClient) Audit(genesisID skipchain.SkipBlockID, r *onet.Roster, sample func(index int) bool) ([]AuditResult, error) {
+	latest, err := c.latestBlock(r, genesisID)
+	if err != nil {
+		return nil, err
+	}
+	var results []AuditResult
+	for index := latest.Index; index > 0; index-- {
+		if !sample(index) {
+			continue
+		}
+		blocks, err := c.linkedBlocks(genesisID, r, index)
+		if err != nil {
+			results = append(results, AuditResult{Index: index, Err: err})
+			continue
+		}
+		block := blocks[len(blocks)-1]
+		results = append(results, AuditResult{index, block.Hash, c.auditBlock(genesisID, blocks)})
+	}
+	return results, nil
+}
+
+// auditBlock returns an error if blocks are not linked from the genesis
+// block by valid forward links, or if the content, the signatures or the
+// inclusion of the pages of the last skipblock are not valid. The roster of
+// the audited skipblock is trusted as part of the skipblock signed by the
+// forward link of the previous one.
+func (c *SkipClient) auditBlock(genesisID skipchain.SkipBlockID, blocks []*skipchain.SkipBlock) error {
+	block, err := verifyLinks(genesisID, blocks)
+	if err != nil {
+		return err
+	}
+	stored, err := c.BlockContent(block.Roster, block)
+	if err != nil {
+		return err
+	}
+	pages, _, err := blockPages(block.Roster, stored)
+	if err != nil {
+		return err
+	}
+	if stored.Mirror == nil {
+		for _, page := range pages {
+			if err := c.verifyPage(block.Roster, page); err != nil {
+				return err
+			}
+		}
+	}
+	if len(pages) == 0 {
+		return nil
+	}
+	return verifyStored(block, pages[0])
+}
@@ -0,0 +1,106 @@
+package decenarch
+
+/*
+The mirror.go defines the verification of the blocks mirrored from the
+archive of another cothority. A mirrored block carries the skipblock of the
+other archive, whose roster signed the pages and the block, and the chain of
+skipblocks linking it to the genesis block of the other archive, so that
+anyone can check the mirrored pages without contacting the other roster. The
+roster of the skipblock is only trusted once the forward links, starting at
+the roster of the genesis block pinned by its ID, lead to the skipblock.
+*/
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// VerifyMirror returns the mirrored skipblock, or an error if it is not a
+// block of the mirrored archive, if the mirrored content is not the one of
+// the skipblock, if the pages and the block are not collectively signed by a
+// threshold of the roster of the skipblock, or if the links of the record
+// don't lead from the genesis block Origin to the skipblock
+func VerifyMirror(m *decenarch.Mirror) (*skipchain.SkipBlock, error) {
+	_, msg, err := network.Unmarshal(m.SkipBlock, decenarch.Suite)
+	if err != nil {
+		return nil, err
+	}
+	sb, ok := msg.(*skipchain.SkipBlock)
+	if !ok {
+		return nil, errors.New("mirrored data is not a skipblock")
+	}
+	if !sb.Hash.Equal(sb.CalculateHash()) {
+		return nil, errors.New("mirrored skipblock does not match its hash")
+	}
+	if sb.Index == 0 || !sb.SkipChainID().Equal(m.Origin) || sb.Roster == nil {
+		return nil, errors.New("skipblock is not a block of the mirrored archive")
+	}
+
+	// the skipblock may only hold the content hash of the pages
+	stored, err := storedBlock(sb)
+	if err != nil {
+		return nil, err
+	}
+	storedPayload, err := hashedPayload(stored)
+	if err != nil {
+		return nil, err
+	}
+	mirroredPayload, err := hashedPayload(&m.Block)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(storedPayload, mirroredPayload) {
+		return nil, errors.New("mirrored block is not the content of the skipblock")
+	}
+
+	c := NewSkipClient(decenarch.Threshold(len(sb.Roster.List)))
+	for _, page := range m.Block.Pages {
+		if err := c.verifyPage(sb.Roster, page); err != nil {
+			return nil, err
+		}
+	}
+	if m.Block.Sig != nil {
+		if err := c.verifyBlock(sb.Roster, &m.Block); err != nil {
+			return nil, err
+		}
+	}
+
+	// the skipblock itself, and so its roster, is authenticated by the
+	// forward links from the genesis block
+	linked, err := verifyChain(m.Origin, m.Links)
+	if err != nil {
+		return nil, fmt.Errorf("mirrored skipblock is not linked to the genesis block: %v", err)
+	}
+	if !linked.Hash.Equal(sb.Hash) {
+		return nil, errors.New("links of the mirror record lead to another skipblock")
+	}
+	return sb, nil
+}
+
+// hashedPayload returns the payload of the block where the content of every
+// page is replaced by its content hash, so that a block can be compared to
+// its compact version
+func hashedPayload(block *decenarch.Block) ([]byte, error) {
+	hashed := *block
+	hashed.Pages = make([]decenarch.Webstore, len(block.Pages))
+	for i, page := range block.Pages {
+		if page.Page != "" {
+			content, err := base64.StdEncoding.DecodeString(page.Page)
+			if err != nil {
+				return nil, err
+			}
+			page.PageHash = lib.ContentHash(content)
+			page.Page = ""
+		}
+		hashed.Pages[i] = page
+	}
+	return hashed.Payload()
+}
@@ -0,0 +1,77 @@
+package decenarch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func TestVerifyMirror(t *testing.T) {
+	content := []byte("page")
+	page := decenarch.Webstore{Url: "http://example.com", Page: base64.StdEncoding.EncodeToString(content)}
+	full := &decenarch.Block{Pages: []decenarch.Webstore{page}, Timestamp: "2018/06/01 10:00:00.0000"}
+	compact, err := CompactBlock(full, nil, nil)
+	require.NoError(t, err)
+
+	// the compact block stored in the skipchain has the payload of the
+	// full block once the content is hashed
+	hashedFull, err := hashedPayload(full)
+	require.NoError(t, err)
+	hashedCompact, err := hashedPayload(compact)
+	require.NoError(t, err)
+	require.Equal(t, hashedFull, hashedCompact)
+	require.Equal(t, lib.ContentHash(content), compact.Pages[0].PageHash)
+
+	origin := skipchain.SkipBlockID([]byte("genesis"))
+	si := network.NewServerIdentity(key.NewKeyPair(decenarch.Suite).Public, "tls://127.0.0.1:7770")
+	skipblock := func(block *decenarch.Block) []byte {
+		data, err := webstoreExtractAndConvert(block)
+		require.NoError(t, err)
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		sb := skipchain.NewSkipBlock()
+		sb.Index = 1
+		sb.GenesisID = origin
+		sb.Roster = onet.NewRoster([]*network.ServerIdentity{si})
+		sb.Data = b.Bytes()
+		sb.Hash = sb.CalculateHash()
+		raw, err := network.Marshal(sb)
+		require.NoError(t, err)
+		return raw
+	}
+
+	// not a skipblock
+	_, err = VerifyMirror(&decenarch.Mirror{Origin: origin, SkipBlock: []byte("invalid"), Block: *full})
+	require.Error(t, err)
+
+	// a skipblock of another archive
+	_, err = VerifyMirror(&decenarch.Mirror{Origin: []byte("other"), SkipBlock: skipblock(compact), Block: *full})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not a block of the mirrored archive")
+
+	// a content which is not the one of the skipblock
+	other := &decenarch.Block{Pages: []decenarch.Webstore{{Url: "http://example.org", Page: page.Page}}, Timestamp: full.Timestamp}
+	_, err = VerifyMirror(&decenarch.Mirror{Origin: origin, SkipBlock: skipblock(compact), Block: *other})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not the content of the skipblock")
+
+	// the right content, but pages not signed by the roster of the
+	// skipblock
+	_, err = VerifyMirror(&decenarch.Mirror{Origin: origin, SkipBlock: skipblock(compact), Block: *full})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not signed")
+}
@@ -0,0 +1,209 @@
+package decenarch
+
+/*
+The proof.go defines the inclusion proofs of the pages in the archive. A proof
+is the list of the skipblocks from the genesis block to the block storing the
+page, following the highest forward links, so that a client knowing only the
+ID of the genesis block can check that the page is part of the archive without
+trusting the conode that answered, and without downloading the whole chain.
+Every forward link is collectively signed by the roster of the block it
+starts from.
+*/
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// Proof returns the inclusion proof of the skipblock blockID: the skipblocks
+// from the genesis block to blockID, network marshaled, see VerifyProof
+func (c *SkipClient) Proof(genesisID skipchain.SkipBlockID, r *onet.Roster, blockID skipchain.SkipBlockID) ([][]byte, error) {
+	target, err := c.singleBlock(r, blockID)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := c.linkedBlocks(genesisID, r, target.Index)
+	if err != nil {
+		return nil, err
+	}
+	if !blocks[len(blocks)-1].Hash.Equal(target.Hash) {
+		return nil, errors.New("forward links do not lead to the target block")
+	}
+	proof := make([][]byte, len(blocks))
+	for i, block := range blocks {
+		if proof[i], err = network.Marshal(block); err != nil {
+			return nil, err
+		}
+	}
+	return proof, nil
+}
+
+// linkedBlocks returns the skipblocks from the genesis block genesisID to the
+// skipblock at index, following from each skipblock the highest forward link
+// not jumping over index. The links are not verified, see verifyLinks
+func (c *SkipClient) linkedBlocks(genesisID skipchain.SkipBlockID, r *onet.Roster, index int) ([]*skipchain.SkipBlock, error) {
+	block, err := c.singleBlock(r, genesisID)
+	if err != nil {
+		return nil, err
+	}
+	blocks := []*skipchain.SkipBlock{block}
+	for block.Index < index {
+		// the forward link of height h jumps BaseHeight^h blocks, the
+		// highest one not jumping over the target is followed
+		var link *skipchain.ForwardLink
+		jump := 1
+		for _, fl := range block.ForwardLink {
+			if block.Index+jump > index {
+				break
+			}
+			link = fl
+			jump *= block.BaseHeight
+		}
+		if link == nil {
+			return nil, errors.New("skipblock is not linked to the target block yet")
+		}
+		if block, err = c.singleBlock(r, link.To); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	if block.Index != index {
+		return nil, fmt.Errorf("forward links do not lead to skipblock %d", index)
+	}
+	return blocks, nil
+}
+
+// VerifyProof returns the skipblock storing page, or an error if proof is not
+// a chain of skipblocks starting at the genesis block genesisID and linked by
+// valid forward links, or if page is not stored in the last skipblock
+func VerifyProof(genesisID skipchain.SkipBlockID, proof [][]byte, page decenarch.Webstore) (*skipchain.SkipBlock, error) {
+	sb, err := verifyChain(genesisID, proof)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyStored(sb, page); err != nil {
+		return nil, err
+	}
+	return sb, nil
+}
+
+// SigningRoster returns the roster that signed the pages of the skipblock:
+// its own roster, or the roster of the mirrored skipblock for a mirrored
+// block
+func SigningRoster(sb *skipchain.SkipBlock) (*onet.Roster, error) {
+	stored, err := storedBlock(sb)
+	if err != nil {
+		return nil, err
+	}
+	_, r, err := blockPages(sb.Roster, stored)
+	return r, err
+}
+
+// verifyChain returns the last skipblock of proof, or an error if proof is not
+// a chain of skipblocks starting at the genesis block genesisID and linked by
+// valid forward links
+func verifyChain(genesisID skipchain.SkipBlockID, proof [][]byte) (*skipchain.SkipBlock, error) {
+	blocks := make([]*skipchain.SkipBlock, len(proof))
+	for i, b := range proof {
+		_, msg, err := network.Unmarshal(b, decenarch.Suite)
+		if err != nil {
+			return nil, err
+		}
+		sb, ok := msg.(*skipchain.SkipBlock)
+		if !ok {
+			return nil, errors.New("proof is not made of skipblocks")
+		}
+		blocks[i] = sb
+	}
+	return verifyLinks(genesisID, blocks)
+}
+
+// verifyLinks returns the last skipblock of blocks, or an error if blocks are
+// not a chain of skipblocks starting at the genesis block genesisID and linked
+// by valid forward links
+func verifyLinks(genesisID skipchain.SkipBlockID, blocks []*skipchain.SkipBlock) (*skipchain.SkipBlock, error) {
+	var prev *skipchain.SkipBlock
+	for _, sb := range blocks {
+		if !sb.Hash.Equal(sb.CalculateHash()) {
+			return nil, errors.New("skipblock of the proof does not match its hash")
+		}
+		if prev == nil {
+			if !sb.Hash.Equal(genesisID) {
+				return nil, errors.New("proof does not start at the genesis block")
+			}
+		} else if err := verifyLink(prev, sb); err != nil {
+			return nil, err
+		}
+		prev = sb
+	}
+	if prev == nil {
+		return nil, errors.New("empty proof")
+	}
+	return prev, nil
+}
+
+// verifyLink returns an error if no forward link of from, signed by the
+// roster of from, leads to to
+func verifyLink(from, to *skipchain.SkipBlock) error {
+	if to.Index <= from.Index || from.Roster == nil {
+		return fmt.Errorf("skipblock %d cannot link to skipblock %d", from.Index, to.Index)
+	}
+	for _, fl := range from.ForwardLink {
+		if fl.To.Equal(to.Hash) {
+			return fl.Verify(decenarch.Suite, from.Roster.Publics())
+		}
+	}
+	return fmt.Errorf("no forward link from skipblock %d to skipblock %d", from.Index, to.Index)
+}
+
+// verifyStored returns an error if page, with the same url, timestamp,
+// content and signature, is not stored in the skipblock
+func verifyStored(sb *skipchain.SkipBlock, page decenarch.Webstore) error {
+	stored, err := storedBlock(sb)
+	if err != nil {
+		return err
+	}
+	pages, _, err := blockPages(sb.Roster, stored)
+	if err != nil {
+		return err
+	}
+	hash, err := pageHash(page)
+	if err != nil {
+		return err
+	}
+	for _, p := range pages {
+		if p.Url != page.Url || p.Timestamp != page.Timestamp {
+			continue
+		}
+		if h, err := pageHash(p); err != nil || h != hash {
+			continue
+		}
+		if p.Sig == nil || page.Sig == nil || !bytes.Equal(p.Sig.Signature, page.Sig.Signature) {
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("page %s is not stored in skipblock %d", page.Url, sb.Index)
+}
+
+// pageHash returns the content hash of the page, which may only hold its
+// content hash in a compact block
+func pageHash(page decenarch.Webstore) (string, error) {
+	if page.Page == "" {
+		return page.PageHash, nil
+	}
+	content, err := base64.StdEncoding.DecodeString(page.Page)
+	if err != nil {
+		return "", err
+	}
+	return lib.ContentHash(content), nil
+}
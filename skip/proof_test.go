@@ -0,0 +1,79 @@
+package decenarch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	cosiservice "gopkg.in/dedis/cothority.v2/ftcosi/service"
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestVerifyProof(t *testing.T) {
+	page := decenarch.Webstore{
+		Url:       "http://example.com",
+		Page:      base64.StdEncoding.EncodeToString([]byte("page")),
+		Timestamp: "2018/06/01 10:00",
+		Sig:       &cosiservice.SignatureResponse{Signature: []byte("signature")},
+	}
+	compact, err := CompactBlock(&decenarch.Block{Pages: []decenarch.Webstore{page}}, nil, nil)
+	require.NoError(t, err)
+	data, err := webstoreExtractAndConvert(compact)
+	require.NoError(t, err)
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	si := network.NewServerIdentity(key.NewKeyPair(decenarch.Suite).Public, "tls://127.0.0.1:7770")
+	genesis := skipchain.NewSkipBlock()
+	genesis.Roster = onet.NewRoster([]*network.ServerIdentity{si})
+	genesis.Hash = genesis.CalculateHash()
+	sb := skipchain.NewSkipBlock()
+	sb.Index = 1
+	sb.GenesisID = genesis.Hash
+	sb.Roster = genesis.Roster
+	sb.Data = b.Bytes()
+	sb.Hash = sb.CalculateHash()
+	marshal := func(sb *skipchain.SkipBlock) []byte {
+		raw, err := network.Marshal(sb)
+		require.NoError(t, err)
+		return raw
+	}
+
+	// the compact page of the skipblock is the retrieved page
+	require.NoError(t, verifyStored(sb, page))
+	other := page
+	other.Page = base64.StdEncoding.EncodeToString([]byte("other"))
+	require.Error(t, verifyStored(sb, other))
+	other = page
+	other.Sig = &cosiservice.SignatureResponse{Signature: []byte("other")}
+	require.Error(t, verifyStored(sb, other))
+
+	// the proof starts at the genesis block
+	_, err = VerifyProof(genesis.Hash, nil, page)
+	require.Error(t, err)
+	_, err = VerifyProof(genesis.Hash, [][]byte{marshal(sb)}, page)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "genesis")
+
+	// the skipblocks are linked by forward links
+	_, err = VerifyProof(genesis.Hash, [][]byte{marshal(genesis), marshal(sb)}, page)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no forward link")
+
+	// a tampered skipblock does not match its hash
+	tampered := *sb
+	tampered.Data = []byte("tampered")
+	_, err = VerifyProof(genesis.Hash, [][]byte{marshal(genesis), marshal(&tampered)}, page)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "hash")
+}
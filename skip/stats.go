@@ -0,0 +1,136 @@
+package decenarch
+
+/*
+The stats.go defines the statistics of the changes of a page, computed from
+its observations in the archive: the versions saved in the skipchain and the
+Unchanged records stored when the conodes found the page identical to its
+last snapshot. The interval suggested for the next save of the page follows
+how often the page changed, see decenarch.ChangeStats.
+*/
+
+import (
+	"encoding/base64"
+	"sort"
+	"time"
+
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+const (
+	// MinSuggestedInterval is the shortest interval suggested between two
+	// saves of a page
+	MinSuggestedInterval = time.Hour
+	// MaxSuggestedInterval is the longest interval suggested between two
+	// saves of a page
+	MaxSuggestedInterval = 30 * 24 * time.Hour
+)
+
+// Stats returns the statistics of the changes of the page of the url, from
+// all its observations in the skipchain. The url is compared in its
+// canonical form.
+func (c *SkipClient) Stats(genesisID skipchain.SkipBlockID, r *onet.Roster, url string) (*decenarch.ChangeStats, error) {
+	url = c.normalize(url)
+	block, err := c.latestBlock(r, genesisID)
+	if err != nil {
+		return nil, err
+	}
+	var samples []decenarch.StatsSample
+	for block.Index > 0 {
+		stored, err := c.BlockContent(block.Roster, block)
+		if err != nil {
+			return nil, err
+		}
+		pages, _, err := blockPages(block.Roster, stored)
+		if err != nil {
+			log.Lvl1("Skipping invalid mirrored block:", err)
+			pages = nil
+		}
+		for _, p := range pages {
+			if c.normalize(p.Url) == url {
+				samples = append(samples, pageSample(p))
+			}
+		}
+		for _, u := range stored.Unchanged {
+			if c.normalize(u.Url) == url {
+				samples = append(samples, decenarch.StatsSample{Time: u.CheckTime, PageHash: u.PageHash, Unchanged: true})
+			}
+		}
+		block, err = c.singleBlock(r, block.BackLinkIDs[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+	stats := changeStats(samples)
+	stats.Url = url
+	return stats, nil
+}
+
+// pageSample returns the observation of the saved page
+func pageSample(p decenarch.Webstore) decenarch.StatsSample {
+	s := decenarch.StatsSample{Time: p.CaptureTime, Resources: len(p.AddsUrl)}
+	if s.Time == 0 {
+		if t, err := time.ParseInLocation("2006/01/02 15:04", p.Timestamp, time.Local); err == nil {
+			s.Time = t.Unix()
+		}
+	}
+	s.PageHash, _ = pageHash(p)
+	if content, err := base64.StdEncoding.DecodeString(p.Page); err == nil {
+		s.Size = len(content)
+	}
+	return s
+}
+
+// changeStats returns the statistics of the observations of a page, in any
+// order
+func changeStats(samples []decenarch.StatsSample) *decenarch.ChangeStats {
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Time < samples[j].Time
+	})
+	stats := &decenarch.ChangeStats{Samples: samples}
+	var size int64
+	for i := range samples {
+		s := &samples[i]
+		if s.Unchanged {
+			stats.Unchanged++
+		} else {
+			stats.Versions++
+			size += int64(s.Size)
+		}
+		if i > 0 && !s.Unchanged && s.PageHash != samples[i-1].PageHash {
+			s.Changed = true
+			stats.Changes++
+		}
+	}
+	if stats.Versions > 0 {
+		stats.AverageSize = size / int64(stats.Versions)
+	}
+	if len(samples) == 0 {
+		return stats
+	}
+	stats.First = samples[0].Time
+	stats.Last = samples[len(samples)-1].Time
+	if len(samples) < 2 {
+		return stats
+	}
+	span := time.Duration(stats.Last-stats.First) * time.Second
+
+	// the page is sampled twice per change, and a page that never changed
+	// is saved again after twice the time it was observed unchanged
+	suggested := 2 * span
+	if stats.Changes > 0 {
+		stats.ChangeInterval = (stats.Last - stats.First) / int64(stats.Changes)
+		suggested = time.Duration(stats.ChangeInterval) * time.Second / 2
+	}
+	if suggested < MinSuggestedInterval {
+		suggested = MinSuggestedInterval
+	}
+	if suggested > MaxSuggestedInterval {
+		suggested = MaxSuggestedInterval
+	}
+	stats.SuggestedInterval = int64(suggested / time.Second)
+	return stats
+}
@@ -0,0 +1,46 @@
+package decenarch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	decenarch "github.com/dedis/student_18_decenar"
+)
+
+func TestChangeStats(t *testing.T) {
+	day := int64(24 * 3600)
+	samples := []decenarch.StatsSample{
+		{Time: 4 * day, PageHash: "b", Size: 300, Resources: 3},
+		{Time: 0, PageHash: "a", Size: 100, Resources: 1},
+		{Time: 2 * day, PageHash: "a", Unchanged: true},
+		{Time: 8 * day, PageHash: "c", Size: 200, Resources: 2},
+	}
+	stats := changeStats(samples)
+	require.Equal(t, 3, stats.Versions)
+	require.Equal(t, 1, stats.Unchanged)
+	require.Equal(t, 2, stats.Changes)
+	require.Equal(t, int64(0), stats.First)
+	require.Equal(t, 8*day, stats.Last)
+	require.Equal(t, 4*day, stats.ChangeInterval)
+	require.Equal(t, int64(200), stats.AverageSize)
+	require.Equal(t, 2*day, stats.SuggestedInterval)
+	require.Equal(t, int64(0), stats.Samples[0].Time)
+	require.True(t, stats.Samples[2].Changed)
+	require.False(t, stats.Samples[1].Changed)
+
+	// a page that never changed is saved less and less often
+	stats = changeStats([]decenarch.StatsSample{
+		{Time: 0, PageHash: "a"},
+		{Time: day, PageHash: "a", Unchanged: true},
+	})
+	require.Equal(t, 0, stats.Changes)
+	require.Equal(t, 2*day, stats.SuggestedInterval)
+	stats = changeStats([]decenarch.StatsSample{{Time: 0, PageHash: "a"}, {Time: 60, PageHash: "b"}})
+	require.Equal(t, int64(MinSuggestedInterval.Seconds()), stats.SuggestedInterval)
+
+	// a single observation gives no interval
+	stats = changeStats([]decenarch.StatsSample{{Time: day, PageHash: "a"}})
+	require.Equal(t, int64(0), stats.SuggestedInterval)
+	require.Equal(t, day, stats.First)
+}
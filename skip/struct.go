@@ -5,6 +5,8 @@ This holds the messages used to communicate with the service over the network.
 */
 
 import (
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/onet.v2"
 	"gopkg.in/dedis/onet.v2/network"
 
 	decenarch "github.com/dedis/student_18_decenar"
@@ -17,8 +19,15 @@ func init() {
 
 // SkipGetDataResponse is used by the skipchain handling conode to provide the
 // data requested by the user. The MainPage contains the page requested, AllPages
-// contains the additional ressources necessary to display the webpage.
+// contains the additional ressources necessary to display the webpage. Signers
+// is the roster that signed the pages, i.e. the roster of the skipblock or of
+// the mirrored skipblock. Origin is the ID of the genesis block of the
+// mirrored archive, nil if the pages were not mirrored. Block is the ID of the
+// skipblock storing the pages.
 type SkipGetDataResponse struct {
 	MainPage decenarch.Webstore
 	AllPages []decenarch.Webstore
+	Signers  *onet.Roster
+	Origin   []byte
+	Block    skipchain.SkipBlockID
 }
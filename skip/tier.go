@@ -0,0 +1,136 @@
+package decenarch
+
+/*
+The tier.go defines how the content of the pages is moved between the
+skipchain and the storage tiers of the conodes, see lib.Tier, or IPFS. The block
+stored in the skipchain keeps the content hash of every page, the content is
+put back in the block when it is read, so that the signatures of the pages
+and of the block can be checked as if the content was in the skipchain. A
+client without storage tier asks the conodes for the content, see RemoteTier.
+*/
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// CompactBlock stores the content of the pages in the tier and pins it on
+// IPFS, either of them can be nil, and returns a copy of the block holding
+// only their content hash and CID
+func CompactBlock(block *decenarch.Block, tier lib.Tier, ipfs *lib.IPFS) (*decenarch.Block, error) {
+	compact := *block
+	compact.Pages = make([]decenarch.Webstore, len(block.Pages))
+	for i, page := range block.Pages {
+		content, err := base64.StdEncoding.DecodeString(page.Page)
+		if err != nil {
+			return nil, err
+		}
+		hash := lib.ContentHash(content)
+		if page.PageHash != "" && page.PageHash != hash {
+			return nil, fmt.Errorf("page %s does not match its content hash", page.Url)
+		}
+		if tier != nil {
+			if err := tier.Put(hash, content); err != nil {
+				return nil, err
+			}
+		}
+		if ipfs != nil {
+			if page.PageCID, err = ipfs.Add(content); err != nil {
+				return nil, err
+			}
+		}
+		page.PageHash = hash
+		page.Page = ""
+		compact.Pages[i] = page
+	}
+	return &compact, nil
+}
+
+// MissingContentError is returned when the content of a page stored outside
+// the skipchain cannot be found, e.g. because it was pruned
+type MissingContentError struct {
+	Url string
+	Err error
+}
+
+// Error implements the error interface
+func (e *MissingContentError) Error() string {
+	return fmt.Sprintf("content of page %s not found: %v", e.Url, e.Err)
+}
+
+// expandBlock puts back in the block the content of the pages stored in the
+// tier, or else fetched from IPFS. The content fetched from IPFS is checked
+// against the content hash of the page.
+func expandBlock(block *decenarch.Block, tier lib.Tier, ipfs *lib.IPFS) error {
+	for i, page := range block.Pages {
+		if page.Page != "" || page.PageHash == "" {
+			continue
+		}
+		var content []byte
+		err := fmt.Errorf("content of page %s is not stored in the skipchain", page.Url)
+		if tier != nil {
+			content, err = tier.Get(page.PageHash)
+		}
+		if err != nil && ipfs != nil && page.PageCID != "" {
+			content, err = ipfs.Cat(page.PageCID)
+			if err == nil && lib.ContentHash(content) != page.PageHash {
+				err = fmt.Errorf("content %s does not match its hash", page.PageCID)
+			}
+		}
+		if err != nil {
+			return &MissingContentError{Url: page.Url, Err: err}
+		}
+		block.Pages[i].Page = base64.StdEncoding.EncodeToString(content)
+	}
+	return nil
+}
+
+// RemoteTier is the read-only lib.Tier asking the conodes for the content of
+// the pages kept in their storage tiers
+type RemoteTier struct {
+	client *decenarch.Client
+	roster *onet.Roster
+}
+
+// NewRemoteTier returns the RemoteTier asking the conodes of the roster
+func NewRemoteTier(r *onet.Roster) *RemoteTier {
+	return &RemoteTier{client: decenarch.NewClient(), roster: r}
+}
+
+// Put implements lib.Tier
+func (t *RemoteTier) Put(hash string, data []byte) error {
+	return errors.New("remote tier is read-only")
+}
+
+// Get implements lib.Tier, the content is checked against its hash
+func (t *RemoteTier) Get(hash string) ([]byte, error) {
+	err := errors.New("empty roster")
+	for _, si := range t.roster.List {
+		var data []byte
+		data, err = t.client.Content(si, hash)
+		if err == nil && lib.ContentHash(data) == hash {
+			return data, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("conode %s returned corrupted content", si.Address)
+		}
+	}
+	return nil, err
+}
+
+// Delete implements lib.Tier
+func (t *RemoteTier) Delete(hash string) error {
+	return errors.New("remote tier is read-only")
+}
+
+// List implements lib.Tier
+func (t *RemoteTier) List(before time.Time) ([]string, error) {
+	return nil, errors.New("remote tier cannot be listed")
+}
@@ -0,0 +1,101 @@
+package decenarch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/cothority.v2/skipchain"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func TestCompactBlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tier")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	tier, err := lib.NewDiskTier(dir)
+	require.Nil(t, err)
+
+	content := []byte("<html>page</html>")
+	page := base64.StdEncoding.EncodeToString(content)
+	block := &decenarch.Block{Pages: []decenarch.Webstore{{Url: "http://example.com", Page: page}}}
+	payload, err := block.Payload()
+	require.Nil(t, err)
+
+	// the skipchain only keeps the content hash
+	compact, err := CompactBlock(block, tier, nil)
+	require.Nil(t, err)
+	require.Equal(t, "", compact.Pages[0].Page)
+	require.Equal(t, lib.ContentHash(content), compact.Pages[0].PageHash)
+	require.Equal(t, page, block.Pages[0].Page)
+
+	// the content is put back from the tier
+	require.NotNil(t, expandBlock(compact, nil, nil))
+	require.Nil(t, expandBlock(compact, tier, nil))
+	require.Equal(t, page, compact.Pages[0].Page)
+
+	// pages whose content doesn't match their hash are refused
+	block.Pages[0].PageHash = lib.ContentHash([]byte("other"))
+	_, err = CompactBlock(block, tier, nil)
+	require.NotNil(t, err)
+
+	// the payload of blocks without content hash is unchanged
+	block.Pages[0].PageHash = ""
+	p, err := block.Payload()
+	require.Nil(t, err)
+	require.Equal(t, payload, p)
+}
+
+func TestReadableContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tier")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	tier, err := lib.NewDiskTier(dir)
+	require.Nil(t, err)
+
+	content := []byte("<html>page</html>")
+	page := base64.StdEncoding.EncodeToString(content)
+	compact, err := CompactBlock(&decenarch.Block{Pages: []decenarch.Webstore{{Url: "http://example.com", Page: page}}}, tier, nil)
+	require.Nil(t, err)
+	data, err := webstoreExtractAndConvert(compact)
+	require.Nil(t, err)
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	_, err = w.Write(data)
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+	sb := skipchain.NewSkipBlock()
+	sb.Index = 1
+	sb.Data = b.Bytes()
+
+	// the unsigned block is only accepted below the pinned index of the
+	// first signed block
+	c := NewSkipClient(1)
+	c.Tier = tier
+	_, err = c.readableContent(sb)
+	require.NotNil(t, err)
+	c.UnsignedBefore = 1
+	_, err = c.readableContent(sb)
+	require.NotNil(t, err)
+	c.UnsignedBefore = 2
+	stored, err := c.readableContent(sb)
+	require.Nil(t, err)
+	require.Equal(t, page, stored.Pages[0].Page)
+
+	// the pruned block is skipped by the searches
+	require.Nil(t, tier.Delete(lib.ContentHash(content)))
+	stored, err = c.readableContent(sb)
+	require.Nil(t, err)
+	require.Empty(t, stored.Pages)
+
+	// the other errors are returned
+	sb.Data = []byte("not gzip")
+	_, err = c.readableContent(sb)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,148 @@
+package decenarch
+
+/*
+The timeline.go defines the audit of the versions of a url, from the oldest
+to the newest: every version saved in the skipchain is listed with the
+skipblock storing it, including the versions whose signature is invalid, and
+its signature and its inclusion proof from the genesis block are checked, so
+that a client gets the chain of custody of the page, see Timeline.
+*/
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/log"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// Version is a saved version of a url with the skipblock storing it
+//    - Index and BlockID identify the skipblock
+//    - Roster is the roster that signed the page, the roster of the mirrored
+//      archive for a mirrored page
+//    - Mirrored tells if the page is stored in a mirrored block
+type Version struct {
+	Page     decenarch.Webstore
+	Index    int
+	BlockID  skipchain.SkipBlockID
+	Roster   *onet.Roster
+	Mirrored bool
+}
+
+// Versions returns all the versions of the url saved in the skipchain, oldest
+// first. Unlike History, the versions whose signature is invalid are kept, so
+// that they can be audited. The url is compared in its canonical form.
+func (c *SkipClient) Versions(genesisID skipchain.SkipBlockID, r *onet.Roster, url string) ([]Version, error) {
+	url = c.normalize(url)
+	block, err := c.latestBlock(r, genesisID)
+	if err != nil {
+		return nil, err
+	}
+	var versions []Version
+	for block.Index > 0 {
+		stored, err := c.BlockContent(block.Roster, block)
+		if err != nil {
+			return nil, err
+		}
+		pages, roster, err := blockPages(block.Roster, stored)
+		if err != nil {
+			log.Lvl1("Skipping invalid mirrored block:", err)
+			pages = nil
+		}
+		for i := len(pages) - 1; i >= 0; i-- {
+			if c.normalize(pages[i].Url) == url {
+				versions = append(versions, Version{pages[i], block.Index, block.Hash, roster, stored.Mirror != nil})
+			}
+		}
+		block, err = c.singleBlock(r, block.BackLinkIDs[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+		versions[i], versions[j] = versions[j], versions[i]
+	}
+	return versions, nil
+}
+
+// TimelineEntry is the audit of a version of a url, see Timeline
+//    - PageHash is the content hash of the page
+//    - Signers are the addresses of the conodes that signed the page, from
+//      the participation mask of its signature, and Conodes the size of the
+//      roster that signed it
+//    - SignatureErr is nil if the page is signed by a threshold of the roster
+//    - ProofErr is nil if the inclusion proof of the skipblock from the
+//      genesis block is valid
+type TimelineEntry struct {
+	Version
+	PageHash     string
+	Signers      []string
+	Conodes      int
+	SignatureErr error
+	ProofErr     error
+}
+
+// Valid tells if both the signature and the inclusion proof of the version
+// are valid
+func (e *TimelineEntry) Valid() bool {
+	return e.SignatureErr == nil && e.ProofErr == nil
+}
+
+// Timeline audits all the versions of the url saved in the skipchain, oldest
+// first, see Versions. The skipblocks are read from the conodes of r.
+func (c *SkipClient) Timeline(genesisID skipchain.SkipBlockID, r *onet.Roster, url string) ([]TimelineEntry, error) {
+	versions, err := c.Versions(genesisID, r, url)
+	if err != nil {
+		return nil, err
+	}
+	// the versions stored in the same skipblock share its proof
+	proofs := make(map[string][][]byte)
+	proofErrs := make(map[string]error)
+	entries := make([]TimelineEntry, len(versions))
+	for i, v := range versions {
+		e := TimelineEntry{Version: v, Conodes: len(v.Roster.List)}
+		e.PageHash, _ = pageHash(v.Page)
+		e.Signers, e.SignatureErr = c.auditSignature(v)
+
+		id := string(v.BlockID)
+		if _, ok := proofs[id]; !ok {
+			proofs[id], proofErrs[id] = c.Proof(genesisID, r, v.BlockID)
+		}
+		if e.ProofErr = proofErrs[id]; e.ProofErr == nil {
+			_, e.ProofErr = VerifyProof(genesisID, proofs[id], v.Page)
+		}
+		entries[i] = e
+	}
+	return entries, nil
+}
+
+// auditSignature returns the addresses of the signers of the version, and an
+// error if it is not signed by a threshold of the roster that signed it. The
+// mirrored pages are checked against the threshold of the mirrored roster.
+func (c *SkipClient) auditSignature(v Version) ([]string, error) {
+	page := v.Page
+	if page.Sig == nil {
+		return nil, errors.New("page is not signed")
+	}
+	mask, err := lib.SignatureMask(page.Scheme, v.Roster.Publics(), page.SignerKeys, page.Sig.Signature)
+	if err != nil {
+		return nil, err
+	}
+	var signers []string
+	for _, i := range lib.MaskIndices(mask) {
+		signers = append(signers, v.Roster.List[i].Address.String())
+	}
+	if !v.Mirrored {
+		return signers, c.verifyPage(v.Roster, page)
+	}
+	content, err := base64.StdEncoding.DecodeString(page.Page)
+	if err != nil {
+		return signers, err
+	}
+	threshold := decenarch.Threshold(len(v.Roster.List))
+	return signers, lib.VerifySignature(page.Scheme, v.Roster.Publics(), page.SignerKeys, content, page.Sig.Signature, threshold)
+}
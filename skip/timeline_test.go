@@ -0,0 +1,57 @@
+package decenarch
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	cosiservice "gopkg.in/dedis/cothority.v2/ftcosi/service"
+	"gopkg.in/dedis/kyber.v2/util/key"
+	"gopkg.in/dedis/onet.v2"
+	"gopkg.in/dedis/onet.v2/network"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib/cositest"
+)
+
+func TestAuditSignature(t *testing.T) {
+	suite := decenarch.CosiSuite
+	content := []byte("page")
+
+	// three conodes, the second one offline while signing
+	kps := []*key.Pair{key.NewKeyPair(suite), key.NewKeyPair(suite), key.NewKeyPair(suite)}
+	list := make([]*network.ServerIdentity, len(kps))
+	for i, kp := range kps {
+		list[i] = network.NewServerIdentity(kp.Public, network.NewAddress(network.TLS, fmt.Sprintf("127.0.0.1:%d", 7770+i)))
+	}
+	r := onet.NewRoster(list)
+	sig, err := cositest.Sign(suite, kps, []int{0, 2}, content)
+	require.NoError(t, err)
+
+	page := decenarch.Webstore{
+		Url:  "http://example.com",
+		Page: base64.StdEncoding.EncodeToString(content),
+		Sig:  &cosiservice.SignatureResponse{Signature: sig},
+	}
+	c := NewSkipClient(2)
+	addrs, err := c.auditSignature(Version{Page: page, Roster: r})
+	require.NoError(t, err)
+	require.Equal(t, []string{"tls://127.0.0.1:7770", "tls://127.0.0.1:7772"}, addrs)
+
+	// the signers are listed even if there are too few of them
+	addrs, err = NewSkipClient(3).auditSignature(Version{Page: page, Roster: r})
+	require.Error(t, err)
+	require.Len(t, addrs, 2)
+
+	// a mirrored page is checked against the threshold of its roster, not
+	// the policy of the client
+	_, err = c.auditSignature(Version{Page: page, Roster: r, Mirrored: true})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "signed by 2 conodes")
+
+	unsigned := page
+	unsigned.Sig = nil
+	_, err = c.auditSignature(Version{Page: unsigned, Roster: r})
+	require.Error(t, err)
+}
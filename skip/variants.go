@@ -0,0 +1,65 @@
+package decenarch
+
+/*
+The variants.go defines the variants of the pages of the archive. The URLs
+differing only in their query, e.g. the pages of the results of a search, are
+saved as distinct pages, identified by the hash of their canonical query, see
+lib.QueryHash. The variants of a page are all the saved URLs sharing its URL
+without query.
+*/
+
+import (
+	"gopkg.in/dedis/cothority.v2/skipchain"
+	"gopkg.in/dedis/onet.v2"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+// Variant is a saved URL of a page
+//    - Url is the canonical URL of the variant
+//    - QueryHash is the hash of its query, empty for the URL without query
+//    - Versions is the number of saved versions of the variant
+//    - Latest is the timestamp of its latest version
+type Variant struct {
+	Url       string
+	QueryHash string
+	Versions  int
+	Latest    string
+}
+
+// ListVariants returns the variants of the url saved in the archive, the
+// variant saved last first. The url is compared in its canonical form, and
+// its query is ignored.
+func (c *SkipClient) ListVariants(genesisID skipchain.SkipBlockID, r *onet.Roster, url string) ([]Variant, error) {
+	base := lib.WithoutQuery(c.normalize(url))
+	pages, err := c.matchingPages(genesisID, r, func(u string) bool {
+		return lib.WithoutQuery(c.normalize(u)) == base
+	})
+	if err != nil {
+		return nil, err
+	}
+	return variants(pages, c.normalize), nil
+}
+
+// variants groups the pages, newest first, by the hash of their query. The
+// pages saved before the hash was stored are grouped by the hash of their
+// canonical URL.
+func variants(pages []decenarch.Webstore, normalize func(string) string) []Variant {
+	list := make([]Variant, 0)
+	index := make(map[string]int)
+	for _, p := range pages {
+		url := normalize(p.Url)
+		hash := p.QueryHash
+		if hash == "" {
+			hash = lib.QueryHash(url)
+		}
+		if i, ok := index[hash]; ok {
+			list[i].Versions++
+			continue
+		}
+		index[hash] = len(list)
+		list = append(list, Variant{Url: url, QueryHash: hash, Versions: 1, Latest: p.Timestamp})
+	}
+	return list
+}
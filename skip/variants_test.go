@@ -0,0 +1,29 @@
+package decenarch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/lib"
+)
+
+func TestVariants(t *testing.T) {
+	c := NewSkipClient(1)
+	search := "https://example.com/search?q=a"
+	pages := []decenarch.Webstore{
+		{Url: search, QueryHash: lib.QueryHash(search), Timestamp: "2018/06/03 10:00"},
+		{Url: "https://example.com/search?q=b", Timestamp: "2018/06/02 10:00"},
+		// saved before the hash of the query was stored
+		{Url: "https://example.com/search?q=a", Timestamp: "2018/06/01 10:00"},
+		{Url: "https://example.com/search", Timestamp: "2018/05/01 10:00"},
+	}
+	list := variants(pages, c.normalize)
+	require.Len(t, list, 3)
+	require.Equal(t, Variant{Url: search, QueryHash: lib.QueryHash(search), Versions: 2, Latest: "2018/06/03 10:00"}, list[0])
+	require.Equal(t, "https://example.com/search?q=b", list[1].Url)
+	require.Equal(t, 1, list[1].Versions)
+	require.NotEqual(t, list[0].QueryHash, list[1].QueryHash)
+	require.Equal(t, Variant{Url: "https://example.com/search", Versions: 1, Latest: "2018/05/01 10:00"}, list[2])
+}
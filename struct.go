@@ -5,18 +5,40 @@ This holds the messages used to communicate with the service over the network.
 */
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
 	cosiservice "gopkg.in/dedis/cothority.v2/ftcosi/service"
 	"gopkg.in/dedis/kyber.v2"
 	"gopkg.in/dedis/onet.v2"
 	"gopkg.in/dedis/onet.v2/network"
+
+	"github.com/dedis/student_18_decenar/client/verify"
 )
 
 // We need to register all messages so the network knows how to handle them.
 func init() {
 	for _, msg := range []interface{}{
 		SetupRequest{}, SetupResponse{},
+		SetupInfoRequest{}, SetupInfoResponse{},
+		PublicKeyRequest{}, PublicKeyResponse{},
 		SaveRequest{}, SaveResponse{},
+		CancelRequest{}, CancelResponse{},
 		RetrieveRequest{}, RetrieveResponse{},
+		StatusRequest{}, StatusResponse{},
+		FlushRequest{}, FlushResponse{},
+		PruneRequest{}, PruneResponse{},
+		ContentRequest{}, ContentResponse{},
+		ImportRequest{}, ImportResponse{},
+		MirrorRequest{}, MirrorResponse{},
+		AdminRequest{}, AdminResponse{},
+		SubscribeRequest{}, SubscribeResponse{},
+		UnsubscribeRequest{}, UnsubscribeResponse{},
+		WatchFeedRequest{}, WatchFeedResponse{},
+		StatsRequest{}, StatsResponse{},
 	} {
 		network.RegisterMessage(msg)
 	}
@@ -29,54 +51,1067 @@ const (
 	CachePath = "/tmp/cocache"
 )
 
+// SetupRequest asks the conodes to setup DecenArch.
+//    - AuthorizedKeys are the public keys of the clients allowed to save web
+//      pages. If empty, anyone can save web pages
+//    - FalsePositiveRate is the default target false positive rate of the
+//      Bloom filters, 0 for lib.DefaultFalsePositiveRate
+//    - BlockInterval is the minimal number of seconds between two blocks
+//      stored by a conode, the pages saved in the meantime are stored in the
+//      same block. 0 for the interval of the configuration of the conodes
+//    - Force runs the DKG again on a conode already set up. Otherwise the
+//      conode returns its key if it was set up with the same roster
+//    - Scheme is the signature scheme of the pages and the blocks, see
+//      scheme.go. Empty for SchemeCosi
+//    - Namespace is the archive to set up, with its own skipchain and key,
+//      see namespace.go. Empty for the default archive, the only one with
+//      BlockInterval
+//    - FetchHeaders are the headers of the requests of the conodes fetching
+//      the pages, by name, see headers.go. Empty for DefaultFetchHeaders.
+//      Only agreed with the default archive, for all the namespaces
+//    - Timestamp is the unix time of the request, used against replays
+//    - PublicKey is the key of the client. A forced setup must be signed by
+//      an authorized client of the archive, and the setup of a new namespace
+//      by an authorized client of the default archive, unless they have no
+//      authorized clients
+//    - Signature is the schnorr signature of Message() by PublicKey
 type SetupRequest struct {
-	Roster *onet.Roster
+	Roster            *onet.Roster
+	AuthorizedKeys    []kyber.Point
+	FalsePositiveRate float64
+	BlockInterval     int64
+	Force             bool
+	Scheme            string
+	Namespace         string
+	FetchHeaders      map[string]string
+	Timestamp         int64
+	PublicKey         kyber.Point
+	Signature         []byte
+}
+
+// Message returns the bytes signed by the client, which bind the request to
+// the roster, the authorized keys, the forced DKG and the namespace
+func (r *SetupRequest) Message() []byte {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(r.Timestamp))
+	msg = append(msg, []byte("setup")...)
+	if r.Force {
+		msg = append(msg, 1)
+	} else {
+		msg = append(msg, 0)
+	}
+	if r.Roster != nil {
+		msg = append(msg, r.Roster.ID[:]...)
+	}
+	for _, k := range r.AuthorizedKeys {
+		b, err := k.MarshalBinary()
+		if err == nil {
+			msg = append(msg, b...)
+		}
+	}
+	if r.Namespace != "" {
+		msg = append(append(msg, 0), []byte(r.Namespace)...)
+	}
+	return msg
 }
 
 type SetupResponse struct {
 	Key kyber.Point
 }
 
+// SetupInfoRequest asks a conode how the archive of Namespace was set up, so
+// that a client can check the archive before saving pages
+type SetupInfoRequest struct {
+	Namespace string
+}
+
+// SetupInfoResponse describes the setup of a conode
+//    - Key is the public key given by the DKG
+//    - GenesisID is the ID of the genesis block of the archive skipchain
+//    - Threshold is the number of conodes needed for the consensus and the
+//      collective signatures
+//    - Roster is the roster given at setup, nil if the conode was set up
+//      before the roster was stored
+//    - Scheme is the signature scheme given at setup, see scheme.go
+type SetupInfoResponse struct {
+	Key       kyber.Point
+	GenesisID []byte
+	Threshold int32
+	Roster    *onet.Roster
+	Scheme    string
+}
+
+// PublicKeyRequest asks a conode for the collective key given by the DKG for
+// the archive of Namespace, so that a client can pin it
+type PublicKeyRequest struct {
+	Namespace string
+}
+
+// PublicKeyResponse describes the collective key of a conode
+//    - Key is the public key given by the DKG
+//    - Created is the unix time at which the DKG finished on the conode, 0 if
+//      the key was created before the time was stored
+//    - RosterHash is the RosterHash of the roster the key was created for,
+//      nil if the conode was set up before the roster was stored
+type PublicKeyResponse struct {
+	Key        kyber.Point
+	Created    int64
+	RosterHash []byte
+}
+
+// RosterHash returns the hash of the public keys and addresses of the conodes
+// of r, in order, which identifies the roster a key was created for
+func RosterHash(r *onet.Roster) []byte {
+	h := sha256.New()
+	for _, si := range r.List {
+		public, err := si.Public.MarshalBinary()
+		if err != nil {
+			return nil
+		}
+		h.Write(public)
+		h.Write([]byte(si.Address))
+	}
+	return h.Sum(nil)
+}
+
+// SaveRequestMaxAge is the maximal age of a signed save request accepted by
+// the conodes
+const SaveRequestMaxAge = 10 * time.Minute
+
 // SaveRequest will save the website in the conodes using the protocol and
 // return the exit state of the saving process
+//    - Timestamp is the unix time of the request, used against replays
+//    - PublicKey is the key of the client, that must be authorized at setup
+//    - Signature is the schnorr signature of Message() by the client
+//    - Engine is the name of the consensus engine, "cbf" or "merkle", empty
+//      for the default engine
+//    - FalsePositiveRate is the target false positive rate of the Bloom
+//      filters of the cbf engine, 0 for the rate given at setup
+//    - Sync makes the conode answer only once the pages are stored in a block
+//      of the skipchain, instead of with the next block
+//    - IncludeProof asks the conode for the transcript of the consensus
+//    - Render asks the conodes to run the consensus on the page rendered by
+//      their browser, for the pages built by JavaScript
+//    - Template is the request replayed by the conodes to fetch the page, nil
+//      for a GET request, see template.go. It cannot be rendered
+//    - Sign tunes the collective signatures of the save, nil for the options
+//      of the conode, see SignOptions
+//    - Namespace is the archive storing the page, empty for the default
+//      archive, see namespace.go
+//    - Force makes the conodes archive the page again even if it did not
+//      change since its last snapshot, see Unchanged
+//    - Extractor is the name of the leaf extractor selecting the leaves the
+//      conodes agree on, empty for the text of the page, see
+//      lib.LeafExtractor
+//    - Headers override the headers agreed at setup for the fetches of the
+//      save, a header with an empty value is removed, see
+//      MergeFetchHeaders
+//    - Diagnostics asks for the summary of the leaves of the page dropped
+//      from the consensus page, see DivergenceSummary
+//    - Session is a random identifier chosen by the client to cancel the
+//      save, see CancelRequest. Only the client knows it, empty if the save
+//      cannot be canceled
+//    - Feed is the signed request of the client watching the feed listing
+//      the page, set by the conode for the saves of the entries of the feeds
+//      it watches. The save is counted against the quota of this client. Nil
+//      for the requests of the clients
 type SaveRequest struct {
-	Url    string
-	Roster *onet.Roster
+	Url               string
+	Roster            *onet.Roster
+	Timestamp         int64
+	PublicKey         kyber.Point
+	Signature         []byte
+	Engine            string
+	FalsePositiveRate float64
+	Sync              bool
+	IncludeProof      bool
+	Render            bool
+	Template          *RequestTemplate
+	Sign              *SignOptions
+	Namespace         string
+	Force             bool
+	Extractor         string
+	Headers           map[string]string
+	Diagnostics       bool
+	Session           string
+	Feed              *WatchFeedRequest
+}
+
+// SignOptions tunes the ftcosi protocols signing a save. A zero value means
+// the option of the conode, and the options of a request can only lower the
+// timeout and the retries of the conode.
+//    - Subtrees is the number of subtrees of the protocol, at most the number
+//      of conodes
+//    - Timeout is the number of seconds the root waits for a subtree before
+//      replacing its subleader
+//    - Retries is the number of times the protocol is run again after a
+//      timeout
+type SignOptions struct {
+	Subtrees int
+	Timeout  int
+	Retries  int
+}
+
+// Validate returns an error if an option is negative. Nil options are valid.
+func (o *SignOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.Subtrees < 0 || o.Timeout < 0 || o.Retries < 0 {
+		return errors.New("the sign options must not be negative")
+	}
+	return nil
+}
+
+// Message returns the bytes signed by the client, the hash of the template
+// is appended to SaveRequestMessage
+func (r *SaveRequest) Message() []byte {
+	return append(SaveRequestMessage(r.Url, r.Timestamp, r.Namespace), r.Template.Hash()...)
+}
+
+// SaveRequestMessage returns the bytes a client signs to save url at the
+// given unix time in the archive of the namespace ns. The namespace is
+// appended after a zero byte, which no url holds, so that the message of the
+// default archive is unchanged.
+func SaveRequestMessage(url string, timestamp int64, ns string) []byte {
+	msg := make([]byte, 8, 8+len(url))
+	binary.BigEndian.PutUint64(msg, uint64(timestamp))
+	msg = append(msg, []byte(url)...)
+	if ns != "" {
+		msg = append(append(msg, 0), []byte(ns)...)
+	}
+	return msg
 }
 
 // SaveResponse return an error if the website could not be saved correctly
 //     - Times  collect statistic times in form key;decenarch.StatTimeFormat
+//     - BlockID is the ID of the block storing the pages, nil if they are
+//       stored with the next block
+//     - Url is the address of the saved page, after the redirections
+//     - PageHash is the content hash of the consensus page, see
+//       lib.ContentHash
+//     - Sig is the collective signature of the consensus page
+//     - Timestamp is the time of the saved page, format 2006/01/02 15:04
+//     - Adds are the urls of the additional resources archived with the page
+//     - Proof is the network encoded protocol.ConsensusProof of the page, if
+//       asked by the request
+//     - Evidence are the misbehaviours of the conodes detected during the
+//       save, also stored with the page
+//     - Errors are the errors of the conodes during the consensus on the page
+//       and on its additional resources
+//     - Unchanged tells that the page did not change since its last snapshot,
+//       whose content hash is PageHash, and that only an Unchanged record
+//       signed by Sig was stored
+//     - Divergence summarizes the leaves dropped from the consensus page, if
+//       asked by the request
 type SaveResponse struct {
-	Times []string
+	Times     []string
+	BlockID   []byte
+	Url       string
+	PageHash  string
+	Sig       *cosiservice.SignatureResponse
+	Timestamp string
+	Adds      []string
+	Proof     []byte
+	Evidence  []Evidence
+	Errors    []NodeError
+	// number of saves waiting before this one when it reached the conode,
+	// zero if it ran at once
+	QueuePosition int
+	Unchanged     bool
+	Divergence    *DivergenceSummary
+}
+
+// CancelRequest asks the conode leading a save to stop it. A queued save is
+// removed from the queue, a running save stops before its pages are signed
+// and returns ErrSaveCanceled. The protocols already started with the other
+// conodes end with their timeouts.
+//    - Session is the identifier of the save given by the client, see
+//      SaveRequest
+type CancelRequest struct {
+	Session string
+}
+
+// CancelResponse tells if a save of the session was running on the conode
+type CancelResponse struct {
+	Canceled bool
+}
+
+// Evidence records that a conode misbehaved during a save, signed by the
+// conode that detected it
+//     - RequestID is the ID of the save
+//     - Accused is the public key of the misbehaving conode
+//     - Reporter is the public key of the conode that detected it
+//     - Protocol is the name of the protocol in which the conode misbehaved
+//     - Reason describes the misbehaviour
+//     - Signature is the schnorr signature of Message() by Reporter
+//     - Contribution is the network marshaled contribution of the accused
+//       conode, signed by it, see protocol.VerifyEvidence
+type Evidence struct {
+	RequestID    string
+	Accused      string
+	Reporter     string
+	Protocol     string
+	Reason       string
+	Signature    []byte
+	Contribution []byte
+}
+
+// Message returns the bytes signed by the reporter of the evidence
+func (e *Evidence) Message() []byte {
+	msg := []byte("evidence")
+	fields := []string{e.RequestID, e.Accused, e.Reporter, e.Protocol, e.Reason}
+	if len(e.Contribution) > 0 {
+		fields = append(fields, string(e.Contribution))
+	}
+	for _, f := range fields {
+		l := make([]byte, 8)
+		binary.BigEndian.PutUint64(l, uint64(len(f)))
+		msg = append(append(msg, l...), f...)
+	}
+	return msg
 }
 
 // RetrieveRequest will retreive the website from the conode using the protocol
 // and return the website file
+//    - IncludeChainProof asks the conode for the inclusion proof of the
+//      skipblock storing the page
+//    - Namespace is the archive the page is retrieved from, empty for the
+//      default archive
 type RetrieveRequest struct {
-	Url       string
-	Roster    *onet.Roster
-	Timestamp string
+	Url               string
+	Roster            *onet.Roster
+	Timestamp         string
+	IncludeChainProof bool
+	Namespace         string
 }
 
 // RetrieveResponse return the website requested.
 // - Path is the path to the page requested on the filesystem
+//    - ChainProof are the network encoded skipblocks from the genesis block
+//      to the skipblock storing Main, linked by their forward links, if asked
+//      by the request. See skip.VerifyProof
+//    - Signers are the addresses of the conodes that signed Main, from the
+//      participation mask of its signature
 type RetrieveResponse struct {
-	Main Webstore
-	Adds []Webstore
+	Main       Webstore
+	Adds       []Webstore
+	ChainProof [][]byte
+	Signers    []string
+}
+
+// FlushRequest asks a conode to store immediately the pages saved since its
+// last block, instead of waiting for the block interval
+type FlushRequest struct {
+}
+
+// FlushResponse is returned once the pending pages are stored
+//    - Pages is the number of pages stored in the new block
+type FlushResponse struct {
+	Pages int
+}
+
+// PruneRequest asks the conodes to move the content of the pages stored
+// before Before, a unix time, from their hot storage tier to their cold one.
+// The pruning must be approved by a threshold of the roster of the archive of
+// Namespace. The request must be signed with the private key of the
+// contacted conode.
+//    - Timestamp is the unix time of the request, used against replays
+//    - Signature is the schnorr signature of RequestMessage()
+type PruneRequest struct {
+	Roster    *onet.Roster
+	Before    int64
+	Namespace string
+	Timestamp int64
+	Signature []byte
+}
+
+// Message returns the bytes collectively signed by the conodes approving the
+// pruning
+func (r *PruneRequest) Message() []byte {
+	return PruneMessage(r.Before)
+}
+
+// RequestMessage returns the bytes signed by the conode operator
+func (r *PruneRequest) RequestMessage() []byte {
+	msg := make([]byte, 8, 16+len(r.Namespace))
+	binary.BigEndian.PutUint64(msg, uint64(r.Timestamp))
+	msg = append(msg, PruneMessage(r.Before)...)
+	return append(msg, []byte(r.Namespace)...)
+}
+
+// PruneMessage returns the bytes collectively signed to approve the pruning
+// of the pages stored before the given unix time
+func PruneMessage(before int64) []byte {
+	msg := []byte("prune")
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(before))
+	return append(msg, b...)
+}
+
+// PruneResponse is returned once the pruning is approved
+//    - Conodes is the number of conodes the approval was propagated to
+type PruneResponse struct {
+	Conodes int
+}
+
+// ContentRequest asks a conode for the content of a page stored in its
+// storage tiers, see Webstore.PageHash
+type ContentRequest struct {
+	Hash string
+}
+
+// ContentResponse holds the content of the page
+type ContentResponse struct {
+	Data []byte
+}
+
+// ImportRequest asks a conode to store in its skipchain a block exported from
+// an archive signed by the same conodes, e.g. after a migration to new
+// hardware. The pages and the block must carry their content and be
+// collectively signed by the roster given at setup. The request must be
+// signed by an authorized client of the archive or by the contacted conode.
+//    - Roster is unused, the block is verified against the roster given at
+//      setup
+//    - Timestamp is the unix time of the request, used against replays
+//    - Signature is the schnorr signature of Message() by PublicKey
+//    - Namespace is the archive the block is imported in
+type ImportRequest struct {
+	Roster    *onet.Roster
+	Block     Block
+	Timestamp int64
+	PublicKey kyber.Point
+	Signature []byte
+	Namespace string
+}
+
+// Message returns the bytes signed by the client, which bind the request to
+// the collectively signed hash of the block and to the namespace
+func (r *ImportRequest) Message() []byte {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(r.Timestamp))
+	msg = append(msg, []byte("import")...)
+	if r.Block.Sig != nil {
+		msg = append(msg, r.Block.Sig.Hash...)
+	}
+	if r.Namespace != "" {
+		msg = append(append(msg, 0), []byte(r.Namespace)...)
+	}
+	return msg
+}
+
+// ImportResponse returns the ID of the block storing the imported block
+type ImportResponse struct {
+	BlockID []byte
+}
+
+// MirrorRequest asks the roster to mirror the archive of another cothority.
+// The request must be signed with the private key of the contacted conode.
+//    - Origin is the roster of the mirrored archive
+//    - OriginID is the ID of the genesis block of the mirrored archive
+//    - Timestamp is the unix time of the request, used against replays
+//    - Signature is the schnorr signature of Message()
+//    - Namespace is the archive storing the mirror records
+type MirrorRequest struct {
+	Roster    *onet.Roster
+	Origin    *onet.Roster
+	OriginID  []byte
+	Timestamp int64
+	Signature []byte
+	Namespace string
+}
+
+// MirrorResponse contains the number of blocks mirrored by the request
+type MirrorResponse struct {
+	Blocks int
+}
+
+// Message returns the bytes signed by the conode operator. The namespace is
+// appended to the ID of the mirrored archive, so the message of the default
+// archive is unchanged.
+func (r *MirrorRequest) Message() []byte {
+	msg := make([]byte, 8, 8+len(r.OriginID))
+	binary.BigEndian.PutUint64(msg, uint64(r.Timestamp))
+	msg = append(msg, r.OriginID...)
+	if r.Namespace != "" {
+		msg = append(append(msg, 0), []byte(r.Namespace)...)
+	}
+	return msg
+}
+
+// StatusRequest asks a conode for its status. If Roster is not nil, the
+// contacted conode also asks the status of all the other conodes of its
+// setup. The conodes of Roster are not contacted, it only asks for the others.
+type StatusRequest struct {
+	Roster *onet.Roster
+}
+
+// StatusResponse contains the status of every conode contacted
+type StatusResponse struct {
+	Conodes []ConodeStatus
+}
+
+// ConodeStatus describes the state of a single conode
+//    - Address is the address of the conode
+//    - Reachable is false if the conode could not be contacted
+//    - Error is the reason why the conode could not be contacted
+//    - KeyPresent is true if the conode holds a DKG share
+//    - ShareIndex is the index of the DKG share of the conode
+//    - GenesisID is the ID of the genesis block of the archive skipchain
+//    - LatestID is the ID of the latest block known by the conode
+//    - StorageSize is the size in bytes of the stored service data
+//    - LastSave is the time of the last successful save led by the conode
+//    - Topology describes the tree of the last save led by the conode
+//    - Interrupted are the last saves led by the conode and interrupted by its
+//      restart
+//    - Verification is the outcome of the background re-verification of the
+//      skipblocks stored by the conode, nil if it is disabled
+type ConodeStatus struct {
+	Address     string
+	Reachable   bool
+	Error       string
+	KeyPresent  bool
+	ShareIndex  int
+	GenesisID   []byte
+	LatestID    []byte
+	StorageSize int
+	LastSave    string
+	Topology    string
+	Interrupted []JournalEntry
+	// saves led by the conode that run and that wait, see QueuePosition
+	RunningSaves int
+	QueuedSaves  int
+	Verification *VerificationStatus
+}
+
+// VerificationStatus describes the re-verification of the skipblocks stored
+// by a conode since it started
+//    - Rounds is the number of rounds run, LastRound the time of the last one
+//    - Checked is the number of skipblocks checked
+//    - Corrupted is the number of skipblocks found invalid
+//    - Unverifiable is the number of skipblocks whose content is missing
+//    - Failures are the last invalid or unverifiable skipblocks
+type VerificationStatus struct {
+	Rounds       int
+	LastRound    string
+	Checked      int
+	Corrupted    int
+	Unverifiable int
+	Failures     []BlockFailure
+}
+
+// BlockFailure is a skipblock that failed its re-verification
+//    - Index and BlockID identify the skipblock
+//    - Reason is the error of the verification
+//    - Missing is true if the skipblock is unverifiable because the content of
+//      a page is missing, e.g. after a pruning without cold tier
+//    - Time is the time of the verification, in StatTimeFormat
+type BlockFailure struct {
+	Index   int
+	BlockID []byte
+	Reason  string
+	Missing bool
+	Time    string
+}
+
+// JournalEntry describes a save recorded in the journal of the conode leading
+// it
+//    - RequestID is the ID of the save, found in the logs of the conodes
+//    - Url is the URL of the saved page
+//    - Phase is the last checkpoint of the save
+//    - Started is the time the save started
+//    - Outcome tells if an interrupted save was resumed or aborted
+type JournalEntry struct {
+	RequestID string
+	Url       string
+	Phase     string
+	Started   string
+	Outcome   string
+}
+
+// Commands understood by the admin API of the conodes
+const (
+	// AdminDumpStorage returns the content of the storage, except the secret
+	AdminDumpStorage = "dump-storage"
+	// AdminShowSecretIndex returns the index of the DKG share
+	AdminShowSecretIndex = "show-secret-index"
+	// AdminShowGenesis returns the ID of the genesis block
+	AdminShowGenesis = "show-genesis"
+	// AdminClearPending removes the state of the idle pending saves
+	AdminClearPending = "clear-pending"
+	// AdminShowExcluded returns the conodes excluded from the trees of the
+	// saves, with the evidence against them
+	AdminShowExcluded = "show-excluded"
+	// AdminReadmit re-admits all the excluded conodes in the trees of the
+	// saves
+	AdminReadmit = "readmit"
+	// AdminReloadConfig reads the configuration file of the conode again
+	AdminReloadConfig = "reload-config"
+	// AdminExportSecret returns the DKG share and the setup of the conode
+	// sealed to the transport key of the operator, see
+	// SecretBackupArgument
+	AdminExportSecret = "export-secret"
+	// AdminBackupKey returns the hex encoded transport key the conode
+	// opens the next AdminImportSecret with
+	AdminBackupKey = "backup-key"
+	// AdminImportSecret restores the DKG share and the setup exported by
+	// AdminExportSecret, e.g. on the new hardware of the conode
+	AdminImportSecret = "import-secret"
+)
+
+// AdminMaxClockSkew is the maximal age of an admin request accepted by a
+// conode
+const AdminMaxClockSkew = 5 * time.Minute
+
+// AdminRequest asks a conode to inspect or repair its storage. The request
+// must be signed with the private key of the conode.
+//    - Command is one of the Admin* commands
+//    - Timestamp is the unix time of the request, used against replays
+//    - Signature is the schnorr signature of Message()
+//    - Argument is the argument of the command, e.g. the JSON encoded
+//      SecretBackupArgument of the secret commands or the namespace of the
+//      archive of AdminShowSecretIndex and AdminShowGenesis, nil for the
+//      others
+type AdminRequest struct {
+	Command   string
+	Timestamp int64
+	Signature []byte
+	Argument  []byte
+}
+
+// AdminResponse contains the output of the admin command
+type AdminResponse struct {
+	Output string
+}
+
+// Message returns the bytes signed by the conode operator. The argument is
+// appended to the command, so the message of a command without argument is
+// unchanged.
+func (r *AdminRequest) Message() []byte {
+	msg := make([]byte, 8, 8+len(r.Command)+len(r.Argument))
+	binary.BigEndian.PutUint64(msg, uint64(r.Timestamp))
+	msg = append(msg, []byte(r.Command)...)
+	return append(msg, r.Argument...)
+}
+
+// SecretBackupArgument is the argument of the AdminExportSecret and
+// AdminImportSecret commands, and the output of AdminExportSecret. The
+// passphrase of the backup file is only used by the operator, see
+// lib.EncryptBackup, and the share is only sent sealed, see lib.SealTo.
+//    - Recipient is the hex encoded transport key of the operator the
+//      exported share is sealed to
+//    - Key is the hex encoded collective key of the share
+//    - Index is the index of the share
+//    - Sealed is the exported share sealed to Recipient, or the share to
+//      import sealed to the key returned by AdminBackupKey
+type SecretBackupArgument struct {
+	Recipient string `json:",omitempty"`
+	Key       string `json:",omitempty"`
+	Index     int    `json:",omitempty"`
+	Sealed    []byte `json:",omitempty"`
+}
+
+// Types of the events sent by the conodes to the webhooks
+const (
+	// EventSaveCompleted is sent when a save led by the conode succeeds
+	EventSaveCompleted = "save-completed"
+	// EventSaveFailed is sent when a save led by the conode fails
+	EventSaveFailed = "save-failed"
+	// EventBlockCreated is sent when the conode stores a new block in the
+	// skipchain
+	EventBlockCreated = "block-created"
+	// EventBlockCorrupted is sent when the re-verification of a skipblock
+	// stored by the conode fails
+	EventBlockCorrupted = "block-corrupted"
+)
+
+// Event is sent by a conode, as JSON in a POST request, to the webhooks
+// subscribed to its type
+//    - Type is one of the Event* types
+//    - Conode is the public key of the conode sending the event
+//    - RequestID is the ID of the save or of the block creation, found in
+//      the logs of the conodes
+//    - Url is the URL of the saved page, empty for the block events
+//    - BlockID is the ID of the new or corrupted block, or of the block
+//      storing the page, empty if the page is stored with the next block
+//    - Error is the reason of the failure of a save or of the verification
+//      of a block
+//    - Time is the time of the event, in StatTimeFormat
+type Event struct {
+	Type      string
+	Conode    string
+	RequestID string
+	Url       string `json:",omitempty"`
+	BlockID   []byte `json:",omitempty"`
+	Error     string `json:",omitempty"`
+	Time      string
+}
+
+// SubscribeRequest registers a webhook receiving the events of a conode. If
+// the cothority only accepts save requests from authorized clients, the
+// request must be signed by one of them.
+//    - Url is the address the events are posted to. It must be public
+//    - Events are the types of the events sent to Url, all of them if empty
+//    - Timestamp is the unix time of the request, used against replays
+//    - Signature is the schnorr signature of Message() by PublicKey
+type SubscribeRequest struct {
+	Url       string
+	Events    []string
+	Timestamp int64
+	PublicKey kyber.Point
+	Signature []byte
+}
+
+// Message returns the bytes signed by the client
+func (r *SubscribeRequest) Message() []byte {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(r.Timestamp))
+	msg = append(msg, []byte("subscribe")...)
+	for _, s := range append([]string{r.Url}, r.Events...) {
+		var l [4]byte
+		binary.BigEndian.PutUint32(l[:], uint32(len(s)))
+		msg = append(append(msg, l[:]...), []byte(s)...)
+	}
+	return msg
+}
+
+// SubscribeResponse contains the ID of the new subscription, needed to
+// remove it
+type SubscribeResponse struct {
+	ID string
+}
+
+// UnsubscribeRequest removes the subscription of the given ID
+type UnsubscribeRequest struct {
+	ID string
+}
+
+// UnsubscribeResponse is returned once the subscription is removed
+type UnsubscribeResponse struct {
+}
+
+// WatchFeedRequest asks a conode to watch an RSS or Atom feed and to save
+// the pages linked by its new entries. The conode leads the saves with the
+// roster of its setup. The conode keeps the request of the client watching
+// the feed and gives it with the saves of the entries, so that the other
+// conodes check that the client is authorized, see SaveRequest.
+//    - Url is the address of the feed, empty to only list the watched feeds
+//    - Interval is the number of seconds between two polls of the feed, 0
+//      for the default interval
+//    - Remove stops watching the feed instead
+//    - Timestamp is the unix time of the request, used against replays
+//    - PublicKey is the key of the client. If the cothority only accepts
+//      save requests from authorized clients, only them can watch a feed. A
+//      watched feed is only changed or removed by the client who watches it
+//      or by the conode
+//    - Signature is the schnorr signature of Message() by PublicKey, needed
+//      unless the request only lists the feeds
+type WatchFeedRequest struct {
+	Url       string
+	Interval  int64
+	Remove    bool
+	Timestamp int64
+	PublicKey kyber.Point
+	Signature []byte
+}
+
+// Message returns the bytes signed by the client
+func (r *WatchFeedRequest) Message() []byte {
+	msg := make([]byte, 17)
+	binary.BigEndian.PutUint64(msg, uint64(r.Timestamp))
+	binary.BigEndian.PutUint64(msg[8:], uint64(r.Interval))
+	if r.Remove {
+		msg[16] = 1
+	}
+	msg = append(msg, []byte("feed")...)
+	return append(msg, []byte(r.Url)...)
+}
+
+// WatchFeedResponse lists the feeds watched by the conode
+type WatchFeedResponse struct {
+	Feeds []FeedStatus
+}
+
+// FeedStatus describes a feed watched by a conode
+//    - Url is the address of the feed
+//    - Interval is the number of seconds between two polls of the feed
+//    - LastPoll is the time of the last poll, format StatTimeFormat, empty if
+//      the feed was not polled yet
+//    - Saved is the number of entries of the feed saved by the conode
+//    - Error is the error of the last poll or of the last save, if any
+type FeedStatus struct {
+	Url      string
+	Interval int64
+	LastPoll string
+	Saved    int
+	Error    string
+}
+
+// StatsRequest asks a conode how often the page of a url changes, from its
+// snapshots in the archive
+//    - Namespace is the archive of the page, empty for the default archive
+type StatsRequest struct {
+	Url       string
+	Namespace string
+}
+
+// StatsResponse holds the statistics of the page
+type StatsResponse struct {
+	Stats ChangeStats
+}
+
+// ChangeStats is the history of the changes of the page of a url, computed
+// from its saved versions and its Unchanged records
+//    - Versions is the number of saved versions and Unchanged the number of
+//      Unchanged records
+//    - Changes is the number of versions whose content differs from the
+//      previous observation of the page
+//    - First and Last are the unix times of the first and the last
+//      observations
+//    - ChangeInterval is the mean number of seconds between two changes, 0
+//      if the page never changed
+//    - AverageSize is the mean size in bytes of the saved versions
+//    - SuggestedInterval is the number of seconds after which the page
+//      should be archived again, 0 if there are too few observations
+//    - Samples are the observations of the page, oldest first
+type ChangeStats struct {
+	Url               string
+	Versions          int
+	Unchanged         int
+	Changes           int
+	First             int64
+	Last              int64
+	ChangeInterval    int64
+	AverageSize       int64
+	SuggestedInterval int64
+	Samples           []StatsSample
+}
+
+// StatsSample is an observation of a page, a saved version or an Unchanged
+// record
+//    - Time is the unix time of the observation
+//    - PageHash is the content hash of the page
+//    - Size is the size in bytes of the page and Resources the number of its
+//      additional resources, zero for an Unchanged record
+//    - Changed tells that the content differs from the previous observation
+//    - Unchanged tells that the observation is an Unchanged record
+type StatsSample struct {
+	Time      int64
+	PageHash  string
+	Size      int
+	Resources int
+	Changed   bool
+	Unchanged bool
 }
 
 // Webstore is used to store website
 //    - Url is the address of the page
 //    - ContentType is the MIME TYPE
+//    - Charset is the original charset of the page, whose content was
+//      converted to UTF-8. Empty for the additional resources
 //    - Sig is the collective signature for  base64.StdEncoding.DecodeString(Page)
 //    - Page is a base64 string representing a []byte
 //    - AddsUrl is the urls of the attached additional ressources
+//    - AddsHash are the content hashes of the additional ressources, see
+//      lib.ContentHash, AddsHash[i] being the hash of AddsUrl[i]. Empty for
+//      the pages saved before the hashes were stored
 //    - Timestamp is the time at which the page was retrieved format 2006/01/02 15:04
+//    - CertificateHash is the hash of the leaf TLS certificate a threshold of
+//      conodes observed, empty if the page was not fetched over TLS or if no
+//      consensus was reached
+//    - CertificateChain is the base64 DER encoded chain, leaf first, observed
+//      by the root, only stored if its leaf matches CertificateHash
+//    - PageHash is the content hash of the page, see lib.ContentHash. The
+//      skipchain only keeps PageHash, with an empty Page, when the content
+//      is stored in the storage tiers of the conodes
+//    - PageCID is the IPFS CID of the page, if the content is pinned on IPFS.
+//      It is not signed, the content is checked against PageHash
+//    - Evidence are the misbehaviours detected during the save of the page,
+//      only stored with the main page
+//    - Feed is the URL of the feed whose entry links to the page, for the
+//      pages saved by a conode watching the feed. Empty otherwise
+//    - Text is the text of an additional resource whose content type has a
+//      handler, e.g. a PDF document, see protocol.ResourceHandler. It is
+//      extracted from Page, to index the resource
+//    - CaptureTime is the unix time at which the page was captured, and
+//      TimestampSig the collective signature of TimestampMessage, by which
+//      the conodes endorse that CaptureTime agrees with their clock. Only
+//      set for the main page, whose save fails if too few conodes endorse
+//      the time. Unset for the pages archived before the endorsement
+//    - QueryHash is the hash of the query of Url, see lib.QueryHash. The
+//      main pages are indexed by Url without its query and QueryHash, so
+//      that the URLs differing only in their query are distinct variants of
+//      the page. Empty for the pages without query and the additional
+//      resources
+//    - Template is the request template replayed by the conodes to fetch the
+//      main page, with its secrets redacted, see RequestTemplate.Redact. Nil
+//      for a GET request
+//    - Commitments are the commitments of the conodes on the hash of the
+//      additional resource they fetched, see HashCommitment and ConfirmedBy.
+//      Only set for the additional resources fetched by the conodes
+//    - Scheme is the signature scheme of Sig and TimestampSig, empty for
+//      SchemeCosi, and SignerKeys the BLS keys of their signers with
+//      SchemeBLS, see scheme.go
+//    - Mask is the participation mask of Sig, whose bit i is set if the
+//      conode i of the roster signed. It is a copy of the mask that ends
+//      the signature, so that the signers can be listed without parsing it
+//    - Extractor is the leaf extractor of the save of the main page, see
+//      SaveRequest. Empty for the text leaves and the additional resources
+//    - Strip are the CSS selectors of the elements removed from the main
+//      page before the consensus, by the configuration of the conodes
+//    - Headers are the headers of the requests fetching the main page, see
+//      MergeFetchHeaders
 type Webstore struct {
-	Url         string
-	ContentType string
-	Sig         *cosiservice.SignatureResponse
-	Page        string
-	AddsUrl     []string
-	Timestamp   string
+	Url              string
+	ContentType      string
+	Charset          string
+	Sig              *cosiservice.SignatureResponse
+	Page             string
+	AddsUrl          []string
+	Timestamp        string
+	CertificateHash  string
+	CertificateChain []string
+	PageHash         string
+	PageCID          string
+	Evidence         []Evidence
+	// omitted when empty, so that the payload of the older blocks is
+	// unchanged
+	Feed         string                         `json:",omitempty"`
+	Text         string                         `json:",omitempty"`
+	AddsHash     []string                       `json:",omitempty"`
+	CaptureTime  int64                          `json:",omitempty"`
+	TimestampSig *cosiservice.SignatureResponse `json:",omitempty"`
+	QueryHash    string                         `json:",omitempty"`
+	Template     *RequestTemplate               `json:",omitempty"`
+	Commitments  []HashCommitment               `json:",omitempty"`
+	Scheme       string                         `json:",omitempty"`
+	SignerKeys   []SignerKey                    `json:",omitempty"`
+	Mask         []byte                         `json:",omitempty"`
+	Extractor    string                         `json:",omitempty"`
+	Strip        []string                       `json:",omitempty"`
+	Headers      map[string]string              `json:",omitempty"`
+}
+
+// Verifiable returns the signed data of the page checked by the package
+// client/verify
+func (w *Webstore) Verifiable() verify.Webstore {
+	v := verify.Webstore{
+		Url:         w.Url,
+		Page:        w.Page,
+		AddsUrl:     w.AddsUrl,
+		AddsHash:    w.AddsHash,
+		CaptureTime: w.CaptureTime,
+		Scheme:      w.Scheme,
+		SignerKeys:  w.SignerKeys,
+		Mask:        w.Mask,
+	}
+	if w.Sig != nil {
+		v.Sig = w.Sig.Signature
+	}
+	if w.TimestampSig != nil {
+		v.TimestampSig = w.TimestampSig.Signature
+	}
+	return v
+}
+
+// TimestampMessage returns the bytes collectively signed to endorse that the
+// page of content hash pageHash was captured at the given unix time, see
+// verify.TimestampMessage
+func TimestampMessage(pageHash string, captured int64) []byte {
+	return verify.TimestampMessage(pageHash, captured)
+}
+
+// Block is the content of a skipblock of the archive
+//    - Pages are the pages saved in the block, the main page last
+//    - Timestamp is the time at which the block was assembled, format
+//      StatTimeFormat
+//    - Sig is the collective signature of the Payload of the block, so that
+//      the conode storing the block cannot reorder or drop pages
+//    - Mirror is the block of another archive mirrored by the block, which
+//      then has no pages of its own
+//    - Scheme is the signature scheme of Sig and SignerKeys the BLS keys of
+//      its signers, as for Webstore
+//    - Unchanged are the pages found unchanged since their last snapshot,
+//      recorded instead of being archived again
+type Block struct {
+	Pages      []Webstore
+	Timestamp  string
+	Sig        *cosiservice.SignatureResponse
+	Mirror     *Mirror
+	Scheme     string      `json:",omitempty"`
+	SignerKeys []SignerKey `json:",omitempty"`
+	Unchanged  []Unchanged `json:",omitempty"`
+}
+
+// Unchanged records that a threshold of conodes found the page of a url
+// identical to its last snapshot
+//    - Url is the URL of the page, as requested
+//    - PageHash is the content hash of the last snapshot of the page
+//    - Digest is the Merkle root of the leaves of the page, see lib.MerkleRoot,
+//      that the conodes computed both on the snapshot and on the page they
+//      fetched
+//    - CheckTime is the unix time of the check
+//    - Timestamp is the same time in the format of the pages, it is not
+//      signed and only kept for the old readers, see Time
+//    - Sig is the collective signature of UnchangedMessage, Scheme and
+//      SignerKeys as for Webstore
+type Unchanged struct {
+	Url        string
+	PageHash   string
+	Digest     []byte
+	CheckTime  int64
+	Timestamp  string
+	Sig        *cosiservice.SignatureResponse
+	Scheme     string      `json:",omitempty"`
+	SignerKeys []SignerKey `json:",omitempty"`
+}
+
+// Message returns the bytes collectively signed for the record
+func (u *Unchanged) Message() []byte {
+	return UnchangedMessage(u.Url, u.PageHash, u.Digest, u.CheckTime)
+}
+
+// Time returns the signed time of the check in the format of the pages,
+// which readers use instead of Timestamp
+func (u *Unchanged) Time() string {
+	return time.Unix(u.CheckTime, 0).Format("2006/01/02 15:04")
+}
+
+// UnchangedMessage returns the bytes collectively signed to endorse that the
+// page of url, whose last snapshot has the content hash pageHash, still had
+// the leaves of Merkle root digest at the given unix time
+func UnchangedMessage(url, pageHash string, digest []byte, checked int64) []byte {
+	msg := []byte("unchanged")
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(checked))
+	msg = append(append(msg, b...), digest...)
+	return append(msg, []byte(pageHash+"\n"+url)...)
+}
+
+// Mirror is a block of the archive of another cothority, kept in the archive
+// so that its pages can still be retrieved if the other roster disappears
+//    - Origin is the ID of the genesis block of the mirrored archive
+//    - SkipBlock is the network encoded skipblock of the mirrored archive, its
+//      roster signed the pages and the block
+//    - Block is the content of the skipblock, with the content of its pages
+//    - Links are the network encoded skipblocks from the genesis block Origin
+//      to SkipBlock, following the forward links, see skip.VerifyMirror
+type Mirror struct {
+	Origin    []byte
+	SkipBlock []byte
+	Block     Block
+	Links     [][]byte
+}
+
+// Payload returns the bytes collectively signed for the block, i.e. the JSON
+// encoding of the pages, the timestamp, the mirrored block and the unchanged
+// records of the block. The CIDs of the pages are pinned after the signature
+// and are not part of the payload.
+func (b *Block) Payload() ([]byte, error) {
+	pages := make([]Webstore, len(b.Pages))
+	for i, p := range b.Pages {
+		p.PageCID = ""
+		pages[i] = p
+	}
+	return json.Marshal(&Block{Pages: pages, Timestamp: b.Timestamp, Mirror: b.Mirror, Unchanged: b.Unchanged})
 }
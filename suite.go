@@ -1,7 +1,30 @@
 package decenarch
 
-import "gopkg.in/dedis/cothority.v2"
+/*
+The suite.go defines the cryptographic suites of decenarch. They are the only
+suites used by the packages of the repository, so that a key, a signature or
+a ciphertext made by one package can be checked by any other one.
+*/
 
-// Suite is a convenience. It might go away when we decide the a better way to set the
-// suite in repo decenarch
+import (
+	"gopkg.in/dedis/cothority.v2"
+	ftcosiprotocol "gopkg.in/dedis/cothority.v2/ftcosi/protocol"
+	"gopkg.in/dedis/kyber.v2/pairing/bn256"
+)
+
+// Suite is the suite of the keys of the conodes and of the clients, of the
+// Schnorr signatures of the requests, of the DKG and of the ElGamal
+// encryption of the Bloom filters. It is the suite of the conodes.
 var Suite = cothority.Suite
+
+// CosiSuite is the suite of the collective signatures of the pages, the
+// blocks and the other messages signed by the conodes. It works on the
+// group of Suite, so the keys of Suite verify its signatures, and its
+// signatures are EdDSA compatible.
+var CosiSuite = ftcosiprotocol.EdDSACompatibleCosiSuite
+
+// BLSSuite is the pairing suite of the BLS aggregate signatures, used
+// instead of CosiSuite by the archives set up with SchemeBLS. The BLS keys of
+// the conodes are on its group G2 and its signatures on G1, and the keys are
+// endorsed by the keys of Suite, see SignerKey.
+var BLSSuite = bn256.NewSuite()
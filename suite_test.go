@@ -0,0 +1,52 @@
+package decenarch_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	cosiservice "gopkg.in/dedis/cothority.v2/ftcosi/service"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/eddsa"
+	"gopkg.in/dedis/kyber.v2/util/key"
+
+	decenarch "github.com/dedis/student_18_decenar"
+	"github.com/dedis/student_18_decenar/client/verify"
+	"github.com/dedis/student_18_decenar/lib"
+	"github.com/dedis/student_18_decenar/lib/cositest"
+)
+
+// TestSuites checks that what a package makes with the suites of decenarch is
+// valid for the other packages
+func TestSuites(t *testing.T) {
+	kp := key.NewKeyPair(decenarch.Suite)
+	publics := []kyber.Point{kp.Public}
+
+	// a collective signature by a key of Suite, as made by the signing
+	// protocols
+	msg := []byte("page")
+	sig, err := cositest.Sign(decenarch.CosiSuite, []*key.Pair{kp}, nil, msg)
+	require.NoError(t, err)
+
+	// is verified by lib, by the light client and as an EdDSA signature
+	require.NoError(t, lib.VerifyCosi(publics, msg, sig, 1))
+	page := decenarch.Webstore{
+		Url:  "http://example.com",
+		Page: base64.StdEncoding.EncodeToString(msg),
+		Sig:  &cosiservice.SignatureResponse{Signature: sig},
+	}
+	_, err = verify.Page(publics, 1, page.Verifiable())
+	require.NoError(t, err)
+	require.NoError(t, eddsa.Verify(kp.Public, msg, sig[:64]))
+
+	// the Schnorr signatures of the evidence
+	accused := key.NewKeyPair(decenarch.Suite)
+	evidence, err := lib.NewEvidence(kp.Private, kp.Public, "id", accused.Public, "protocol", errors.New("misbehaviour"), nil)
+	require.NoError(t, err)
+	require.NoError(t, lib.VerifyEvidence(evidence, []kyber.Point{kp.Public, accused.Public}))
+
+	// the ElGamal encryption of the Bloom filters
+	c, _ := lib.EncryptInt(kp.Public, 3)
+	require.Equal(t, int64(3), lib.DecryptInt(kp.Private, *c))
+}
@@ -0,0 +1,163 @@
+package decenarch
+
+/*
+The template.go defines the request templates of the saves. By default the
+conodes fetch the page with a GET request, a client can instead give the
+request all the conodes replay, e.g. the POST request of a search form, so
+that the pages only reachable through such a request can be archived. The
+template is signed with the save request, and stored with the page once its
+secrets are redacted, so that the snapshot can be reproduced.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// MaxTemplateBody is the maximal size in bytes of the body of a request
+// template
+const MaxTemplateBody = 64 * 1024
+
+// Redacted replaces the secrets of a redacted request template
+const Redacted = "REDACTED"
+
+// secretHeaders are the headers always redacted from the stored templates
+var secretHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// RequestTemplate is the request replayed by all the conodes to fetch a page
+//    - Method is GET or POST
+//    - Headers are the headers of the request, by name
+//    - Body is the body of a POST request
+//    - Secrets are the names of the headers and of the form fields of the
+//      body redacted before the template is stored, in addition to the
+//      Authorization, Cookie and Proxy-Authorization headers. The fields of
+//      a body whose Content-Type is not an URL encoded form cannot be
+//      redacted, the whole body is then redacted if Secrets is not empty
+type RequestTemplate struct {
+	Method  string
+	Headers map[string]string
+	Body    []byte
+	Secrets []string
+}
+
+// Validate returns an error if the conodes refuse to replay the template
+func (t *RequestTemplate) Validate() error {
+	switch t.Method {
+	case http.MethodGet:
+		if len(t.Body) > 0 {
+			return fmt.Errorf("a %s request has no body", t.Method)
+		}
+	case http.MethodPost:
+	default:
+		return fmt.Errorf("method %q not allowed in a request template", t.Method)
+	}
+	if len(t.Body) > MaxTemplateBody {
+		return fmt.Errorf("body of the request template bigger than %d bytes", MaxTemplateBody)
+	}
+	for name, value := range t.Headers {
+		switch http.CanonicalHeaderKey(name) {
+		case "Host", "Content-Length", "Connection", "Transfer-Encoding":
+			return fmt.Errorf("header %s cannot be set by a request template", name)
+		}
+		if name == "" || strings.ContainsAny(name, " :\r\n") || strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid header %q in the request template", name)
+		}
+	}
+	return nil
+}
+
+// Hash returns the hash of the template, signed with the save request, see
+// SaveRequest.Message. It returns nil for a nil template.
+func (t *RequestTemplate) Hash() []byte {
+	if t == nil {
+		return nil
+	}
+	h := sha256.New()
+	write := func(b []byte) {
+		size := make([]byte, 8)
+		binary.BigEndian.PutUint64(size, uint64(len(b)))
+		h.Write(size)
+		h.Write(b)
+	}
+	write([]byte(t.Method))
+	names := make([]string, 0, len(t.Headers))
+	for name := range t.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		write([]byte(name))
+		write([]byte(t.Headers[name]))
+	}
+	write(t.Body)
+	for _, s := range t.Secrets {
+		write([]byte(s))
+	}
+	return h.Sum(nil)
+}
+
+// Redact returns a copy of the template whose secrets are replaced by
+// Redacted, see RequestTemplate.Secrets. It returns nil for a nil template.
+func (t *RequestTemplate) Redact() *RequestTemplate {
+	if t == nil {
+		return nil
+	}
+	secret := make(map[string]bool)
+	for _, s := range append(secretHeaders, t.Secrets...) {
+		secret[strings.ToLower(s)] = true
+	}
+	r := &RequestTemplate{Method: t.Method, Secrets: t.Secrets}
+	if len(t.Headers) > 0 {
+		r.Headers = make(map[string]string, len(t.Headers))
+		for name, value := range t.Headers {
+			if secret[strings.ToLower(name)] {
+				value = Redacted
+			}
+			r.Headers[name] = value
+		}
+	}
+	r.Body = redactBody(t.Body, t.header("Content-Type"), t.Secrets)
+	return r
+}
+
+// header returns the value of the header of the template, whatever the case
+// of its name
+func (t *RequestTemplate) header(name string) string {
+	for n, value := range t.Headers {
+		if strings.EqualFold(n, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// redactBody returns the body with the values of the secret fields replaced
+// by Redacted, or Redacted if body is not an URL encoded form and there are
+// secrets
+func redactBody(body []byte, contentType string, secrets []string) []byte {
+	if len(body) == 0 || len(secrets) == 0 {
+		return body
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "application/x-www-form-urlencoded" {
+		return []byte(Redacted)
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return []byte(Redacted)
+	}
+	for _, s := range secrets {
+		if values, ok := form[s]; ok {
+			for i := range values {
+				values[i] = Redacted
+			}
+		}
+	}
+	return []byte(form.Encode())
+}
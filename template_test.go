@@ -0,0 +1,71 @@
+package decenarch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestTemplateValidate(t *testing.T) {
+	post := &RequestTemplate{Method: "POST", Headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, Body: []byte("q=a")}
+	require.Nil(t, post.Validate())
+	require.Nil(t, (&RequestTemplate{Method: "GET"}).Validate())
+
+	for _, bad := range []*RequestTemplate{
+		{Method: "PUT"},
+		{Method: "GET", Body: []byte("q=a")},
+		{Method: "POST", Body: make([]byte, MaxTemplateBody+1)},
+		{Method: "POST", Headers: map[string]string{"host": "example.com"}},
+		{Method: "POST", Headers: map[string]string{"X-A": "a\r\nX-B: b"}},
+		{Method: "POST", Headers: map[string]string{"X A": "a"}},
+	} {
+		require.NotNil(t, bad.Validate())
+	}
+}
+
+func TestRequestTemplateHash(t *testing.T) {
+	var none *RequestTemplate
+	require.Nil(t, none.Hash())
+
+	a := &RequestTemplate{Method: "POST", Headers: map[string]string{"X-A": "1", "X-B": "2"}, Body: []byte("q=a")}
+	b := &RequestTemplate{Method: "POST", Headers: map[string]string{"X-B": "2", "X-A": "1"}, Body: []byte("q=a")}
+	require.Equal(t, a.Hash(), b.Hash())
+
+	// the fields cannot be shifted into each other
+	b.Headers = map[string]string{"X-A": "1X-B", "": "2"}
+	require.NotEqual(t, a.Hash(), b.Hash())
+	b = &RequestTemplate{Method: "POST", Headers: a.Headers, Body: []byte("q=b")}
+	require.NotEqual(t, a.Hash(), b.Hash())
+}
+
+func TestRequestTemplateRedact(t *testing.T) {
+	var none *RequestTemplate
+	require.Nil(t, none.Redact())
+
+	form := &RequestTemplate{
+		Method:  "POST",
+		Headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded; charset=utf-8", "cookie": "s=1", "X-Token": "t", "Accept": "text/html"},
+		Body:    []byte("q=archive&password=hunter2"),
+		Secrets: []string{"x-token", "password"},
+	}
+	redacted := form.Redact()
+	require.Equal(t, Redacted, redacted.Headers["cookie"])
+	require.Equal(t, Redacted, redacted.Headers["X-Token"])
+	require.Equal(t, "text/html", redacted.Headers["Accept"])
+	require.Equal(t, "password=REDACTED&q=archive", string(redacted.Body))
+	// the template itself is not modified
+	require.Equal(t, "s=1", form.Headers["cookie"])
+	require.Equal(t, "q=archive&password=hunter2", string(form.Body))
+
+	// the fields of other bodies cannot be redacted
+	json := &RequestTemplate{
+		Method:  "POST",
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body:    []byte(`{"password":"hunter2"}`),
+		Secrets: []string{"password"},
+	}
+	require.Equal(t, Redacted, string(json.Redact().Body))
+	json.Secrets = nil
+	require.False(t, strings.Contains(string(json.Redact().Body), Redacted))
+}
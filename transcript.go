@@ -0,0 +1,101 @@
+package decenarch
+
+/*
+The transcript.go defines the transcript of the unstructured consensus on an
+additional resource, stored with the resource: every conode signs the hash of
+the resource it fetched with the URL of the resource and the ID of the save,
+and the root keeps all the signatures, whatever the hash. An auditor can then count the conodes that fetched the same bytes as the
+archived resource, instead of only checking its collective signature.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/kyber.v2/util/encoding"
+)
+
+// ResourceHash returns the hash of the resource signed by each conode during
+// the unstructured consensus
+func ResourceHash(data []byte) string {
+	return base64.StdEncoding.EncodeToString(Suite.Hash().Sum(data))
+}
+
+// HashCommitment is the signature of a conode on the hash of the resource it
+// fetched, see ResourceHash
+//    - Conode is the public key of the conode, hex encoded
+//    - Digest is the SHA-256 of the hash, hex encoded, see CommitmentDigest.
+//      The hash itself is not stored, as it grows with the resource
+//    - Signature is the Schnorr signature of the conode on CommitmentMessage,
+//      which can only be checked for the hash of the archived resource
+//    - Url is the URL of the resource requested by the save, before its
+//      redirections
+//    - RequestID is the ID of the save
+type HashCommitment struct {
+	Conode    string
+	Digest    string
+	Signature []byte
+	Url       string
+	RequestID string
+}
+
+// CommitmentDigest returns the Digest of a commitment on hash
+func CommitmentDigest(hash string) string {
+	h := sha256.Sum256([]byte(hash))
+	return hex.EncodeToString(h[:])
+}
+
+// CommitmentMessage returns the bytes signed by a conode that fetched the
+// resource of the given hash at url during the save requestID, so that its
+// signature cannot be replayed for another resource or another save
+func CommitmentMessage(url, requestID, hash string) []byte {
+	msg := []byte("commitment")
+	for _, f := range []string{url, requestID, hash} {
+		l := make([]byte, 8)
+		binary.BigEndian.PutUint64(l, uint64(len(f)))
+		msg = append(append(msg, l...), f...)
+	}
+	return msg
+}
+
+// ConfirmedBy returns the keys of the conodes of publics whose commitment
+// confirms that they fetched resource at url, each conode counted once. No
+// conode is confirmed without publics, as anyone can sign a commitment.
+func ConfirmedBy(commitments []HashCommitment, url string, resource []byte, publics []kyber.Point) []kyber.Point {
+	if len(publics) == 0 {
+		return nil
+	}
+	hash := ResourceHash(resource)
+	digest := CommitmentDigest(hash)
+	var confirmed []kyber.Point
+	seen := make(map[string]bool)
+	for _, c := range commitments {
+		if c.Digest != digest || c.Url != url || seen[c.Conode] {
+			continue
+		}
+		public, err := encoding.StringHexToPoint(Suite, c.Conode)
+		if err != nil || !containsPoint(publics, public) {
+			continue
+		}
+		if schnorr.Verify(Suite, public, CommitmentMessage(c.Url, c.RequestID, hash), c.Signature) != nil {
+			continue
+		}
+		seen[c.Conode] = true
+		confirmed = append(confirmed, public)
+	}
+	return confirmed
+}
+
+// containsPoint returns true if p is in points
+func containsPoint(points []kyber.Point, p kyber.Point) bool {
+	for _, q := range points {
+		if q.Equal(p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package decenarch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/dedis/kyber.v2"
+	"gopkg.in/dedis/kyber.v2/sign/schnorr"
+	"gopkg.in/dedis/kyber.v2/util/key"
+)
+
+func TestConfirmedBy(t *testing.T) {
+	url := "https://example.com/image.png"
+	image := []byte("image bytes")
+	other := []byte("other image bytes")
+	var publics []kyber.Point
+	var commitments []HashCommitment
+	for i := 0; i < 4; i++ {
+		kp := key.NewKeyPair(Suite)
+		publics = append(publics, kp.Public)
+		// the last conode fetched another version of the image
+		hash := ResourceHash(image)
+		if i == 3 {
+			hash = ResourceHash(other)
+		}
+		sig, err := schnorr.Sign(Suite, kp.Private, CommitmentMessage(url, "request", hash))
+		require.NoError(t, err)
+		commitments = append(commitments, HashCommitment{Conode: kp.Public.String(), Digest: CommitmentDigest(hash), Signature: sig, Url: url, RequestID: "request"})
+	}
+	// a commitment counted twice or with a forged signature is ignored
+	commitments = append(commitments, commitments[0])
+	commitments = append(commitments, HashCommitment{Conode: publics[3].String(), Digest: CommitmentDigest(ResourceHash(image)), Signature: commitments[0].Signature, Url: url, RequestID: "request"})
+
+	require.Len(t, ConfirmedBy(commitments, url, image, publics), 3)
+	require.Len(t, ConfirmedBy(commitments, url, image, publics[1:]), 2)
+	require.Len(t, ConfirmedBy(commitments, url, other, publics), 1)
+	require.Len(t, ConfirmedBy(commitments, url, []byte("unknown"), publics), 0)
+
+	// no conode is confirmed without a roster
+	require.Empty(t, ConfirmedBy(commitments, url, image, nil))
+
+	// a signature doesn't confirm the resource of another URL or save
+	require.Empty(t, ConfirmedBy(commitments, "https://example.com/other.png", image, publics))
+	replayed := commitments[0]
+	replayed.Url = "https://example.com/other.png"
+	require.Empty(t, ConfirmedBy([]HashCommitment{replayed}, replayed.Url, image, publics))
+	replayed = commitments[0]
+	replayed.RequestID = "other request"
+	require.Empty(t, ConfirmedBy([]HashCommitment{replayed}, url, image, publics))
+}